@@ -0,0 +1,163 @@
+package ebaymcp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ### GPT Action Bundle ######################################################
+
+// A GPT keeps its own copy of the action schema and OAuth settings, pasted
+// into the GPT builder, and OpenAI offers no API to update them. To keep the
+// deployed GPT from drifting when the tools or the policy change, the proxy
+// produces everything the builder asks for as one bundle: the schema of a
+// tool profile, the OAuth settings and the privacy policy URL, plus a hash
+// of the schema. Record the hash when you update the GPT; the bundle
+// endpoint compares it with the current schema.
+//
+//	GET /admin/action-bundle?profile=seller&deployed=<schema_sha256>
+//	ebay-mcp action-bundle <base-url> [dir]
+
+// actionBundle is what the GPT builder's action editor needs.
+type actionBundle struct {
+	Profile          string                 `json:"profile"`
+	Schema           map[string]interface{} `json:"schema,omitempty"`
+	SchemaSHA256     string                 `json:"schema_sha256"`
+	Authentication   actionAuthentication   `json:"authentication"`
+	PrivacyPolicyURL string                 `json:"privacy_policy_url"`
+	// InSync tells whether the deployed schema hash passed in matches
+	InSync *bool `json:"in_sync,omitempty"`
+}
+
+// actionAuthentication mirrors the builder's OAuth form. The proxy only
+// checks the client ID and secret the GPT sends when OAUTH_CLIENTS is set,
+// but the builder requires them.
+type actionAuthentication struct {
+	Type                string `json:"type"`
+	ClientID            string `json:"client_id"`
+	ClientSecret        string `json:"client_secret"`
+	AuthorizationURL    string `json:"authorization_url"`
+	TokenURL            string `json:"token_url"`
+	Scope               string `json:"scope"`
+	TokenExchangeMethod string `json:"token_exchange_method"`
+}
+
+// buildActionBundle assembles the bundle of profile tp (nil for all tools).
+func buildActionBundle(p *Policy, tp *toolProfile, baseURL, serviceName string, scopes []string) (*actionBundle, error) {
+	schema := buildOpenAPI(p, tp, baseURL, serviceName, scopes)
+	data, err := json.Marshal(schema) // map keys are sorted, so the hash is stable
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+
+	profile := "all"
+	if tp != nil {
+		profile = tp.Name
+		scopes = profileScopes(p, profileTools(p, tp), scopes)
+	}
+	return &actionBundle{
+		Profile:      profile,
+		Schema:       schema,
+		SchemaSHA256: hex.EncodeToString(sum[:]),
+		Authentication: actionAuthentication{
+			Type:                "oauth",
+			ClientID:            "ebay-mcp",
+			ClientSecret:        "unused",
+			AuthorizationURL:    baseURL + "/authorize",
+			TokenURL:            baseURL + "/token",
+			Scope:               strings.Join(scopes, " "),
+			TokenExchangeMethod: "default",
+		},
+		PrivacyPolicyURL: baseURL + "/privacy",
+	}, nil
+}
+
+// handleActionBundle returns the bundle of the ?profile= profile for this
+// host. With ?deployed=<schema_sha256> it says whether that schema is
+// current.
+// GET /admin/action-bundle
+func handleActionBundle(w http.ResponseWriter, r *http.Request) {
+	tp, err := toolProfileFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d := legalDetailsFor(r)
+	bundle, err := buildActionBundle(currentPolicy(), tp, d.BaseURL, d.ServiceName, defaultEnvironmentFor(r).OAuth.Scopes)
+	if err != nil {
+		http.Error(w, "Failed to build the action bundle", http.StatusInternalServerError)
+		return
+	}
+	if deployed := r.URL.Query().Get("deployed"); deployed != "" {
+		inSync := strings.EqualFold(deployed, bundle.SchemaSHA256)
+		bundle.InSync = &inSync
+	}
+	writeJSON(w, http.StatusOK, bundle)
+}
+
+// runActionBundleCommand implements `ebay-mcp action-bundle <base-url>
+// [dir]` for POLICY_FILE, EBAY_SCOPES and TOOL_PROFILE: the bundle as JSON
+// on stdout, or in dir as openapi.json (the schema to paste) and
+// action.json (everything else).
+func runActionBundleCommand(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: ebay-mcp action-bundle <base-url> [dir]")
+	}
+
+	p, err := loadPolicy(os.Getenv("POLICY_FILE"))
+	if err != nil {
+		return err
+	}
+	tp, err := defaultToolProfile()
+	if err != nil {
+		return err
+	}
+	scopes := strings.Fields(os.Getenv("EBAY_SCOPES"))
+	sort.Strings(scopes)
+
+	bundle, err := buildActionBundle(p, tp, strings.TrimRight(args[0], "/"), envOr("SERVICE_NAME", "eBay Assistant"), scopes)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		data, err := indentedJSON(bundle)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.MkdirAll(args[1], 0o755); err != nil {
+		return err
+	}
+	schema, err := indentedJSON(bundle.Schema)
+	if err != nil {
+		return err
+	}
+	bundle.Schema = nil
+	action, err := indentedJSON(bundle)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(args[1], "openapi.json"), schema, 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(args[1], "action.json"), action, 0o644)
+}
+
+func indentedJSON(v interface{}) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,170 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// ### Page Aggregation #######################################################
+
+// With ?aggregate_pages=N the proxy follows eBay's `next` links for search
+// style endpoints and returns up to N pages merged into one response, so the
+// assistant doesn't have to orchestrate pagination itself. N is capped at
+// MAX_AGGREGATE_PAGES (default 5). The X-Aggregated-Pages response header
+// reports how many pages were merged; `next` points past the last one.
+
+const aggregatePagesParam = "aggregate_pages"
+
+const defaultMaxAggregatePages = 5
+
+var maxAggregatePages = defaultMaxAggregatePages
+
+// aggregatedCollections maps paths that support aggregation to the array
+// holding each page's results.
+var aggregatedCollections = map[string]string{
+	"/buy/browse/v1/item_summary/search": "itemSummaries",
+	"/sell/fulfillment/v1/order":         "orders",
+}
+
+// pageAggregation is the aggregation requested for one call.
+type pageAggregation struct {
+	collection string
+	pages      int
+}
+
+// maxAggregatePagesFromEnv reads MAX_AGGREGATE_PAGES.
+func maxAggregatePagesFromEnv() (int, error) {
+	if v := os.Getenv("MAX_AGGREGATE_PAGES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid MAX_AGGREGATE_PAGES %q", v)
+		}
+		return n, nil
+	}
+	return defaultMaxAggregatePages, nil
+}
+
+// aggregationFor parses the aggregate_pages parameter. It returns nil when
+// no aggregation was requested.
+func aggregationFor(method, path, value string) (*pageAggregation, error) {
+	if value == "" {
+		return nil, nil
+	}
+	collection, ok := aggregatedCollections[path]
+	if !ok || method != http.MethodGet {
+		return nil, fmt.Errorf("%s is not supported for %s %s", aggregatePagesParam, method, path)
+	}
+	pages, err := strconv.Atoi(value)
+	if err != nil || pages < 1 {
+		return nil, fmt.Errorf("%s must be a positive integer", aggregatePagesParam)
+	}
+	if pages > maxAggregatePages {
+		pages = maxAggregatePages
+	}
+	if pages == 1 {
+		return nil, nil
+	}
+	return &pageAggregation{collection: collection, pages: pages}, nil
+}
+
+// apply fetches the following pages of a successful, decoded first page
+// through transport and merges them into resp. Follow-up requests reuse the
+// first request's headers and only go to the same eBay host.
+func (a *pageAggregation) apply(resp *http.Response, transport http.RoundTripper) error {
+	body, err := readLimited(resp.Body, maxResponseBufferSize)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		// Not a page we understand: pass it through
+		a.setBody(resp, body, 1)
+		return nil
+	}
+	items, _ := doc[a.collection].([]interface{})
+
+	fetched := 1
+	for ; fetched < a.pages; fetched++ {
+		next, _ := doc["next"].(string)
+		page, err := a.fetch(resp.Request, transport, next)
+		if err != nil {
+			log.Printf("Stopping page aggregation after %d pages: %v", fetched, err)
+			break
+		}
+		if page == nil {
+			break
+		}
+		more, _ := page[a.collection].([]interface{})
+		items = append(items, more...)
+		doc["next"] = page["next"]
+		if page["next"] == nil {
+			delete(doc, "next")
+		}
+	}
+	doc[a.collection] = items
+
+	merged, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if int64(len(merged)) > maxResponseBufferSize {
+		return errResponseTooLarge
+	}
+	a.setBody(resp, merged, fetched)
+	return nil
+}
+
+// fetch retrieves the page at next, or returns nil when there is none.
+func (a *pageAggregation) fetch(first *http.Request, transport http.RoundTripper, next string) (map[string]interface{}, error) {
+	if next == "" {
+		return nil, nil
+	}
+	nextURL, err := url.Parse(next)
+	if err != nil {
+		return nil, err
+	}
+	if nextURL.Host != first.URL.Host || nextURL.Path != first.URL.Path {
+		return nil, fmt.Errorf("next link %s leaves %s%s", next, first.URL.Host, first.URL.Path)
+	}
+
+	req := first.Clone(first.Context())
+	req.URL = nextURL
+	req.Body = nil
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("eBay returned status %d", resp.StatusCode)
+	}
+	if err := decodeBody(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := readLimited(resp.Body, maxResponseBufferSize)
+	if err != nil {
+		return nil, err
+	}
+	var page map[string]interface{}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, fmt.Errorf("failed to parse page: %w", err)
+	}
+	return page, nil
+}
+
+func (a *pageAggregation) setBody(resp *http.Response, body []byte, pages int) {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("X-Aggregated-Pages", strconv.Itoa(pages))
+}
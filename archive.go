@@ -0,0 +1,272 @@
+package ebaymcp
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ### Partitioned Logs #######################################################
+
+// The audit log and the notifications file would grow forever, so they are
+// written in monthly partitions next to the configured path:
+// AUDIT_LOG_FILE=/data/audit.jsonl becomes /data/audit-2026-10.jsonl,
+// /data/audit-2026-11.jsonl, ... Only the current month's partition is
+// written; `ebay-mcp archive` compresses older ones into ARCHIVE_DIR, so
+// the files queries scan stay small. A file at the configured path itself
+// was written before partitioning and is treated as the oldest partition.
+
+const partitionMonth = "2006-01"
+
+// partitionedFile appends lines to the partition of the current month.
+type partitionedFile struct {
+	mu    sync.Mutex
+	base  string
+	month string
+	file  *os.File
+}
+
+// openPartitionedFile opens the current partition of base for appending.
+func openPartitionedFile(base string) (*partitionedFile, error) {
+	p := &partitionedFile{base: base}
+	if err := p.rotate(time.Now()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// partitionPath returns the partition of base for month ("2006-01").
+func partitionPath(base, month string) string {
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "-" + month + ext
+}
+
+// rotate switches to the partition of now's month. p.mu must be held.
+func (p *partitionedFile) rotate(now time.Time) error {
+	month := now.UTC().Format(partitionMonth)
+	if p.file != nil && month == p.month {
+		return nil
+	}
+	f, err := os.OpenFile(partitionPath(p.base, month), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if p.file != nil {
+		p.file.Close()
+	}
+	p.file, p.month = f, month
+	return nil
+}
+
+// WriteLine appends line and a newline to the current partition.
+func (p *partitionedFile) WriteLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.rotate(time.Now()); err != nil {
+		return err
+	}
+	_, err := p.file.Write(append(line, '\n'))
+	return err
+}
+
+// partition is one partition of a log on disk.
+type partition struct {
+	Path  string
+	Month string // empty for the file written before partitioning
+}
+
+// overlaps reports whether the partition may hold records in [since, until).
+func (p partition) overlaps(since, until time.Time) bool {
+	start, err := time.Parse(partitionMonth, p.Month)
+	if err != nil {
+		return true
+	}
+	end := start.AddDate(0, 1, 0)
+	return (since.IsZero() || end.After(since)) && (until.IsZero() || start.Before(until))
+}
+
+// listPartitions returns the partitions of base, oldest first.
+func listPartitions(base string) ([]partition, error) {
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+	matches, err := filepath.Glob(prefix + "[0-9][0-9][0-9][0-9]-[0-9][0-9]" + ext)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	var parts []partition
+	if _, err := os.Stat(base); err == nil {
+		parts = append(parts, partition{Path: base})
+	}
+	for _, m := range matches {
+		parts = append(parts, partition{Path: m, Month: strings.TrimSuffix(strings.TrimPrefix(m, prefix), ext)})
+	}
+	return parts, nil
+}
+
+// ### Archiving ##############################################################
+
+// defaultArchiveKeepMonths is how many months (the current one included)
+// stay hot unless ARCHIVE_KEEP_MONTHS says otherwise.
+const defaultArchiveKeepMonths = 3
+
+// archivedLog is a partitioned log the archive command handles, with the
+// JSON field holding each record's time.
+type archivedLog struct {
+	Env       string
+	TimeField string
+}
+
+var archivedLogs = []archivedLog{
+	{Env: "AUDIT_LOG_FILE", TimeField: "time"},
+	{Env: "NOTIFICATIONS_FILE", TimeField: "received_at"},
+}
+
+// runArchiveCommand moves partitions older than ARCHIVE_KEEP_MONTHS months
+// into ARCHIVE_DIR as gzipped JSON lines, one file per log and month.
+// Archiving a month twice appends to its archive. Safe to run while the
+// server is up: it never touches the partition being written.
+func runArchiveCommand(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: ebay-mcp archive (configured by ARCHIVE_DIR and ARCHIVE_KEEP_MONTHS)")
+	}
+	keep := defaultArchiveKeepMonths
+	if v := os.Getenv("ARCHIVE_KEEP_MONTHS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid ARCHIVE_KEEP_MONTHS %q", v)
+		}
+		keep = n
+	}
+	now := time.Now().UTC()
+	cutoff := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1-keep, 0).Format(partitionMonth)
+
+	archived := 0
+	for _, l := range archivedLogs {
+		base := os.Getenv(l.Env)
+		if base == "" {
+			continue
+		}
+		dir := envOr("ARCHIVE_DIR", filepath.Join(filepath.Dir(base), "archive"))
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		n, err := archiveLog(base, l.TimeField, dir, cutoff)
+		archived += n
+		if err != nil {
+			return fmt.Errorf("%s: %w", l.Env, err)
+		}
+	}
+	log.Printf("Archived %d records from before %s", archived, cutoff)
+	return nil
+}
+
+// archiveLog archives the partitions of base from before the cutoff month
+// and returns how many records it moved.
+func archiveLog(base, timeField, dir, cutoff string) (int, error) {
+	parts, err := listPartitions(base)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, p := range parts {
+		if p.Month != "" && p.Month >= cutoff {
+			continue
+		}
+		n, err := archivePartition(base, p, timeField, dir, cutoff)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// archivePartition appends the records of p to the archives of their months
+// and removes them from p. Records of the unpartitioned file are sorted by
+// their own time; the ones not due yet stay there.
+func archivePartition(base string, p partition, timeField, dir, cutoff string) (int, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return 0, err
+	}
+
+	byMonth := make(map[string][]byte)
+	var kept []byte
+	count := 0
+	month := p.Month
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if p.Month == "" {
+			// Lines without a readable time go with the line before
+			if t, ok := recordTime(line, timeField); ok {
+				month = t.UTC().Format(partitionMonth)
+			}
+			if month == "" || month >= cutoff {
+				kept = append(append(kept, line...), '\n')
+				continue
+			}
+		}
+		byMonth[month] = append(append(byMonth[month], line...), '\n')
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	for m, lines := range byMonth {
+		archive := filepath.Join(dir, filepath.Base(partitionPath(base, m))+".gz")
+		if err := appendGzip(archive, lines); err != nil {
+			return 0, fmt.Errorf("failed to write %s: %w", archive, err)
+		}
+	}
+
+	if len(kept) > 0 {
+		return count, writeFileAtomic(p.Path, kept)
+	}
+	return count, os.Remove(p.Path)
+}
+
+// recordTime reads the RFC 3339 time in field of a JSON line.
+func recordTime(line []byte, field string) (time.Time, bool) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(line, &fields) != nil {
+		return time.Time{}, false
+	}
+	var t time.Time
+	if raw, ok := fields[field]; !ok || json.Unmarshal(raw, &t) != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// appendGzip appends data to path as a new gzip member and syncs it to disk
+// before the source is removed. gzip readers read concatenated members as
+// one stream.
+func appendGzip(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	_, err = zw.Write(data)
+	err = errors.Join(err, zw.Close(), f.Sync(), f.Close())
+	return err
+}
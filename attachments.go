@@ -0,0 +1,315 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ### Attachments ############################################################
+
+// Files eBay generates (feed result files, shipping labels, CSV reports) are
+// useless inlined into a conversation. Instead the proxy stores them in
+// ATTACHMENTS_DIR and answers with a small JSON descriptor holding a signed
+// download URL, valid for ATTACHMENT_TTL (default 24h):
+//
+//	{"attachment": {"url": ".../attachments/<id>?expires=...&sig=...", "name": "...", "content_type": "...", "size": 123, "expires_at": "..."}}
+//
+// File responses are converted automatically; ?attachment=true also converts
+// other successful responses (e.g. a large JSON report) and
+// ?attachment=false passes files through. Responses carrying a descriptor
+// have the attachmentHeader header, which the MCP server turns into resource
+// links. URLs are signed with ATTACHMENT_SIGNING_KEY (random per process when
+// unset, so links die with the process).
+
+const (
+	attachmentParam  = "attachment"
+	attachmentHeader = "X-Proxy-Attachment"
+
+	defaultAttachmentTTL     = 24 * time.Hour
+	defaultMaxAttachmentSize = 100 << 20
+)
+
+// fileMediaTypes are the response types stored as attachments by default.
+var fileMediaTypes = []string{
+	"application/octet-stream", "application/zip", "application/gzip", "application/x-gzip",
+	"application/pdf", "text/csv", "text/tab-separated-values",
+}
+
+// attachmentInfo describes a stored attachment.
+type attachmentInfo struct {
+	URL         string    `json:"url"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// attachmentMeta is kept next to each stored file.
+type attachmentMeta struct {
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// attachmentStore keeps attachment files on disk until they expire.
+type attachmentStore struct {
+	dir     string
+	key     []byte
+	ttl     time.Duration
+	maxSize int64
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// attachments is nil until configured at startup.
+var attachments *attachmentStore
+
+// attachmentStoreFromEnv reads ATTACHMENTS_DIR (default a directory under the
+// system temp dir), ATTACHMENT_TTL, MAX_ATTACHMENT_SIZE and
+// ATTACHMENT_SIGNING_KEY.
+func attachmentStoreFromEnv() (*attachmentStore, error) {
+	s := &attachmentStore{
+		dir:     envOr("ATTACHMENTS_DIR", filepath.Join(os.TempDir(), "ebay-mcp-attachments")),
+		ttl:     defaultAttachmentTTL,
+		maxSize: defaultMaxAttachmentSize,
+	}
+	if v := os.Getenv("ATTACHMENT_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid ATTACHMENT_TTL %q", v)
+		}
+		s.ttl = ttl
+	}
+	if v := os.Getenv("MAX_ATTACHMENT_SIZE"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid MAX_ATTACHMENT_SIZE %q", v)
+		}
+		s.maxSize = n
+	}
+	if v := os.Getenv("ATTACHMENT_SIGNING_KEY"); v != "" {
+		s.key = []byte(v)
+	} else {
+		s.key = make([]byte, 32)
+		if _, err := rand.Read(s.key); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create attachments directory: %w", err)
+	}
+	return s, nil
+}
+
+// sign returns the signature of a download URL for id expiring at expires.
+func (s *attachmentStore) sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s\n%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Put stores body (up to maxSize bytes) and returns its descriptor, with a
+// download URL under baseURL.
+func (s *attachmentStore) Put(body io.Reader, name, contentType, baseURL string, now time.Time) (*attachmentInfo, error) {
+	s.prune(now)
+
+	id, err := randomID(18)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.dir, id)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(f, io.LimitReader(body, s.maxSize+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size > s.maxSize {
+		err = errResponseTooLarge
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	meta := attachmentMeta{Name: name, ContentType: contentType, Size: size, ExpiresAt: now.Add(s.ttl).UTC()}
+	data, _ := json.Marshal(meta)
+	if err := writeFileAtomic(path+".json", data); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	expires := meta.ExpiresAt.Unix()
+	return &attachmentInfo{
+		URL: fmt.Sprintf("%s/attachments/%s?expires=%d&sig=%s",
+			strings.TrimRight(baseURL, "/"), id, expires, s.sign(id, expires)),
+		Name:        name,
+		ContentType: contentType,
+		Size:        size,
+		ExpiresAt:   meta.ExpiresAt,
+	}, nil
+}
+
+// prune deletes expired attachments, at most hourly.
+func (s *attachmentStore) prune(now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastPrune) < time.Hour {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPrune = now
+	s.mu.Unlock()
+
+	metas, _ := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	for _, metaPath := range metas {
+		data, err := os.ReadFile(metaPath)
+		if err != nil {
+			continue
+		}
+		var meta attachmentMeta
+		if json.Unmarshal(data, &meta) == nil && now.Before(meta.ExpiresAt) {
+			continue
+		}
+		os.Remove(strings.TrimSuffix(metaPath, ".json"))
+		os.Remove(metaPath)
+	}
+}
+
+// handleAttachment serves a stored attachment to holders of a valid signed URL.
+// GET /attachments/{id}?expires=...&sig=...
+func handleAttachment(w http.ResponseWriter, r *http.Request) {
+	if attachments == nil {
+		http.NotFound(w, r)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/attachments/")
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	sig := r.URL.Query().Get("sig")
+	if err != nil || id == "" || strings.ContainsAny(id, "/.") ||
+		subtle.ConstantTimeCompare([]byte(sig), []byte(attachments.sign(id, expires))) != 1 {
+		http.Error(w, "Invalid attachment link", http.StatusForbidden)
+		return
+	}
+	if time.Now().Unix() > expires {
+		http.Error(w, "This attachment link has expired", http.StatusGone)
+		return
+	}
+
+	path := filepath.Join(attachments.dir, id)
+	data, err := os.ReadFile(path + ".json")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var meta attachmentMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", meta.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": meta.Name}))
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, meta.Name, time.Time{}, f)
+}
+
+// isFileResponse reports whether resp is a file download rather than data.
+func isFileResponse(resp *http.Response) bool {
+	if disposition, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); disposition == "attachment" {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "image/") {
+		return true
+	}
+	for _, t := range fileMediaTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsAttachment decides from the attachment parameter whether a response
+// becomes an attachment.
+func wantsAttachment(resp *http.Response, param string) bool {
+	if attachments == nil || resp.StatusCode < 200 || resp.StatusCode >= 300 || resp.StatusCode == http.StatusNoContent {
+		return false
+	}
+	switch param {
+	case "true":
+		return true
+	case "false":
+		return false
+	default:
+		return isFileResponse(resp)
+	}
+}
+
+// attachmentName picks a file name: eBay's Content-Disposition filename, or
+// the last path segment with an extension for the content type.
+func attachmentName(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return filepath.Base(params["filename"])
+	}
+	name := filepath.Base(resp.Request.URL.Path)
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 && filepath.Ext(name) == "" {
+		name += exts[0]
+	}
+	return name
+}
+
+// storeAttachment replaces a (decoded) response body with the descriptor
+// of the stored attachment.
+func storeAttachment(resp *http.Response, baseURL string) error {
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	info, err := attachments.Put(resp.Body, attachmentName(resp), contentType, baseURL, time.Now())
+	resp.Body.Close()
+	if err != nil {
+		if errors.Is(err, errResponseTooLarge) {
+			return err
+		}
+		return fmt.Errorf("failed to store attachment: %w", err)
+	}
+	log.Printf("Stored %s (%d bytes) as an attachment", info.Name, info.Size)
+
+	body, _ := json.Marshal(map[string]interface{}{"attachment": info})
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Del("Content-Disposition")
+	resp.Header.Set(attachmentHeader, "1")
+	return nil
+}
@@ -0,0 +1,205 @@
+package ebaymcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ### Audit Records ##########################################################
+
+// auditRecord is one line of the proxy's audit trail.
+type auditRecord struct {
+	Time   time.Time         `json:"time"`
+	Event  string            `json:"event"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// auditLog appends JSON lines to monthly partitions of AUDIT_LOG_FILE (see
+// partitionedFile), or to the regular log when that isn't set.
+type auditLog struct {
+	path string
+	file *partitionedFile
+}
+
+var audit = &auditLog{}
+
+// auditProxyCalls (AUDIT_PROXY_CALLS=true) adds a proxy.call record for every
+// proxied eBay call, with method, path, status and the caller's token hash.
+var auditProxyCalls bool
+
+// openAuditLog opens path for appending; an empty path logs to stderr.
+func openAuditLog(path string) (*auditLog, error) {
+	if path == "" {
+		return &auditLog{}, nil
+	}
+	f, err := openPartitionedFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{path: path, file: f}, nil
+}
+
+// Record writes an audit record. Failures are logged, never returned: an
+// audit write must not fail the action being audited.
+func (a *auditLog) Record(event string, fields map[string]string) {
+	line, err := json.Marshal(auditRecord{Time: time.Now().UTC(), Event: event, Fields: fields})
+	if err != nil {
+		log.Printf("Failed to encode audit record %s: %v", event, err)
+		return
+	}
+
+	if a.file == nil {
+		log.Printf("AUDIT %s", line)
+		return
+	}
+
+	if err := a.file.WriteLine(line); err != nil {
+		log.Printf("Failed to write audit record %s: %v", event, err)
+	}
+}
+
+// auditQuery selects audit records: event names (a trailing "*" matches a
+// prefix), a time range and exact field values.
+type auditQuery struct {
+	Event  string
+	Since  time.Time
+	Until  time.Time
+	Fields map[string]string
+	Limit  int
+}
+
+func (q auditQuery) matches(rec auditRecord) bool {
+	if prefix, ok := strings.CutSuffix(q.Event, "*"); ok {
+		if !strings.HasPrefix(rec.Event, prefix) {
+			return false
+		}
+	} else if q.Event != "" && rec.Event != q.Event {
+		return false
+	}
+	if !q.Since.IsZero() && rec.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !rec.Time.Before(q.Until) {
+		return false
+	}
+	for k, v := range q.Fields {
+		if rec.Fields[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Query returns the newest records matching q, newest first. It needs
+// AUDIT_LOG_FILE: records written to the regular log can't be queried, and
+// archived months aren't searched.
+func (a *auditLog) Query(q auditQuery) ([]auditRecord, error) {
+	if a.path == "" {
+		return nil, fmt.Errorf("AUDIT_LOG_FILE is not set")
+	}
+	parts, err := listPartitions(a.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []auditRecord
+	for i := len(parts) - 1; i >= 0 && len(matched) < q.Limit; i-- {
+		if !parts[i].overlaps(q.Since, q.Until) {
+			continue
+		}
+		records, err := queryAuditFile(parts[i].Path, q, q.Limit-len(matched))
+		if err != nil {
+			return nil, err
+		}
+		matched = append(matched, records...)
+	}
+	return matched, nil
+}
+
+// queryAuditFile returns the newest limit records of one partition matching
+// q, newest first.
+func queryAuditFile(path string, q auditQuery, limit int) ([]auditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var matched []auditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var rec auditRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil || !q.matches(rec) {
+			continue
+		}
+		matched = append(matched, rec)
+		if len(matched) > limit {
+			matched = matched[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	return matched, nil
+}
+
+// handleAuditLog lists the proxy's audit records, newest first. Parameters
+// other than event, since, until and limit filter on record fields, e.g.
+// ?event=proxy.call&token_hash=...&status=401.
+// GET /admin/audit?event=&since=&until=&limit=&<field>=
+func handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	q := auditQuery{Event: params.Get("event"), Limit: 100, Fields: map[string]string{}}
+	for name, values := range params {
+		switch name {
+		case "event":
+		case "since", "until":
+			t, err := time.Parse(time.RFC3339, values[0])
+			if err != nil {
+				http.Error(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			if name == "since" {
+				q.Since = t
+			} else {
+				q.Until = t
+			}
+		case "limit":
+			n, err := strconv.Atoi(values[0])
+			if err != nil || n < 1 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			q.Limit = min(n, 1000)
+		default:
+			q.Fields[name] = values[0]
+		}
+	}
+
+	records, err := audit.Query(q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read audit log: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	if records == nil {
+		records = []auditRecord{}
+	}
+	writeJSON(w, http.StatusOK, records)
+}
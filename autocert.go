@@ -0,0 +1,70 @@
+package ebaymcp
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ### Autocert (ACME) ########################################################
+
+// defaultAutocertCacheDir is where issued certificates are stored between
+// restarts when AUTOCERT_CACHE_DIR is not set. Reusing the cache matters:
+// Let's Encrypt rate-limits repeated issuance for the same domain.
+const defaultAutocertCacheDir = "autocert-cache"
+
+// autocertDomains parses the comma-separated AUTOCERT_DOMAINS list.
+func autocertDomains() []string {
+	return splitList(os.Getenv("AUTOCERT_DOMAINS"))
+}
+
+// enableAutocert configures server to obtain certificates for domains from
+// Let's Encrypt and starts the HTTP-01 challenge listener (AUTOCERT_HTTP_ADDR,
+// default ":80"). Plain HTTP requests that are not ACME challenges are
+// redirected to HTTPS. The challenge listener is closed when server shuts
+// down.
+func enableAutocert(server *http.Server, domains []string) {
+	cacheDir := os.Getenv("AUTOCERT_CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = defaultAutocertCacheDir
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      os.Getenv("AUTOCERT_EMAIL"),
+	}
+	server.TLSConfig = manager.TLSConfig()
+	servedCertificates = autocertCertificates(manager.Cache, domains)
+
+	httpAddr := os.Getenv("AUTOCERT_HTTP_ADDR")
+	if httpAddr == "" {
+		httpAddr = ":80"
+	}
+
+	// HTTPHandler(nil) answers ACME challenges and redirects everything else
+	// to https://.
+	challengeServer := &http.Server{
+		Addr:              httpAddr,
+		Handler:           manager.HTTPHandler(nil),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	server.RegisterOnShutdown(func() {
+		challengeServer.Close()
+	})
+
+	go func() {
+		log.Printf("Starting ACME HTTP-01 challenge listener on %s", httpAddr)
+		if err := challengeServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("ACME challenge listener error: %v", err)
+		}
+	}()
+
+	log.Printf("Autocert enabled for %s (cache: %s)", strings.Join(domains, ", "), cacheDir)
+}
@@ -0,0 +1,286 @@
+// Package app runs the backend: its commands, and the API server. The
+// backend binary and the combined ebay-mcp binary both start it from here
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/bootstrap"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/routes"
+	"github.com/ayouroukov/ebay-mcp/internal/secrets"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// Main runs the backend command in args (config check, migrate, bootstrap
+// or archive), or serves the API until SIGINT or SIGTERM when there is none.
+// It exits the process on errors
+func Main(args []string) {
+	// `backend config check [file]` validates the configuration and exits
+	if len(args) > 1 && args[0] == "config" && args[1] == "check" {
+		file := ""
+		if len(args) > 2 {
+			file = args[2]
+		}
+		if err := config.Check(file); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Configuration OK")
+		return
+	}
+
+	if len(args) == 0 {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		if err := Run(ctx, nil); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cfg := load()
+	switch args[0] {
+	// `backend migrate up|down|status` manages the schema and exits
+	case "migrate":
+		if err := runMigrate(cfg, args[1:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+
+	// `backend bootstrap <spec.json>` provisions resources and exits
+	case "bootstrap":
+		initialize(cfg)
+		if err := runBootstrap(args[1:]); err != nil {
+			log.Fatalf("Bootstrap failed: %v", err)
+		}
+
+	// `backend archive` moves old audit events to the cold table and exits
+	case "archive":
+		initialize(cfg)
+		if err := runArchive(cfg); err != nil {
+			log.Fatalf("Archive failed: %v", err)
+		}
+
+	default:
+		log.Fatalf("Unknown command %q", args[0])
+	}
+}
+
+// load reads the configuration and applies the password hashing settings
+func load() *config.Config {
+	cfg := config.Load()
+	if err := models.SetPasswordHashing(models.PasswordHashing{
+		Algorithm:     cfg.Login.PasswordHash,
+		BcryptCost:    cfg.Login.BcryptCost,
+		Argon2Time:    uint32(cfg.Login.Argon2Time),
+		Argon2Memory:  uint32(cfg.Login.Argon2Memory),
+		Argon2Threads: uint8(cfg.Login.Argon2Threads),
+	}); err != nil {
+		log.Fatalf("Invalid password hashing settings: %v", err)
+	}
+	return cfg
+}
+
+// initialize connects to the database and brings its schema up to date
+func initialize(cfg *config.Config) {
+	if err := database.Initialize(cfg); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+}
+
+// Run loads the configuration, prepares the database and serves the API on
+// PORT until ctx is done, then lets in-flight requests finish. listening, if
+// not nil, is closed once the port accepts connections
+func Run(ctx context.Context, listening chan<- struct{}) error {
+	cfg := load()
+	initialize(cfg)
+	defer func() {
+		if err := database.Close(); err != nil {
+			log.Printf("Failed to close database: %v", err)
+		}
+	}()
+
+	// Create Gin router
+	router := gin.Default()
+	// Let handlers pass *gin.Context to database.WithContext so statements
+	// stop when the client disconnects
+	router.ContextWithFallback = true
+	// Only proxies in TRUSTED_PROXIES may set the client IP that sign-in
+	// throttling and audit events use
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	// Configure CORS
+	router.Use(cors.New(cors.Config{
+		AllowOrigins:     []string{cfg.FrontendURL},
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		ExposeHeaders:    []string{"Content-Length"},
+		AllowCredentials: true,
+	}))
+
+	// Setup routes
+	routes.SetupRoutes(router, cfg)
+
+	// Start server
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	if listening != nil {
+		close(listening)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on port %s...", port)
+		serveErr <- server.Serve(ln)
+	}()
+
+	if cfg.Secrets.RefreshInterval > 0 {
+		go secrets.Watch(ctx, cfg.Secrets.Provider, func() []string { return config.SecretNames }, cfg.Secrets.RefreshInterval, cfg.Secrets.Values, applyRotatedSecret)
+	}
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("failed to start server: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Graceful shutdown did not complete: %v", err)
+	}
+
+	log.Println("Server stopped")
+	return nil
+}
+
+// applyRotatedSecret picks up a secret that changed in the secret backend.
+// The database password applies to new connections; the other secrets sign
+// or encrypt long-lived data and need a restart.
+func applyRotatedSecret(name, value string) {
+	switch name {
+	case "DB_PASSWORD":
+		database.SetPassword(value)
+		log.Println("Picked up rotated DB_PASSWORD for new database connections")
+	default:
+		log.Printf("Secret %s changed; restart to use the new value", name)
+	}
+}
+
+// runBootstrap applies a bootstrap spec file and prints the result as JSON
+func runBootstrap(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: backend bootstrap <spec.json>")
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	var spec bootstrap.Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return err
+	}
+
+	result, err := bootstrap.Apply(database.DB, &spec)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// runMigrate applies (up [id]), rolls back (down [steps], default 1) or
+// lists (status) the schema migrations
+func runMigrate(cfg *config.Config, args []string) error {
+	const usage = "usage: backend migrate up [id] | down [steps] | status"
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New(usage)
+	}
+	if err := database.Connect(cfg); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "up":
+		to := ""
+		if len(args) == 2 {
+			to = args[1]
+		}
+		return database.MigrateUp(to)
+	case "down":
+		steps := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return errors.New(usage)
+			}
+			steps = n
+		}
+		return database.MigrateDown(steps)
+	case "status":
+		states, err := database.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%-8s %s\n", state, s.ID)
+		}
+		return nil
+	default:
+		return errors.New(usage)
+	}
+}
+
+// runArchive moves audit events from before the last ARCHIVE_KEEP_MONTHS
+// months (the current one included) to audit_events_archive
+func runArchive(cfg *config.Config) error {
+	if cfg.ArchiveKeepMonths < 1 {
+		return errors.New("ARCHIVE_KEEP_MONTHS must be at least 1")
+	}
+	now := time.Now().UTC()
+	cutoff := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1-cfg.ArchiveKeepMonths, 0)
+
+	moved, err := audit.Archive(database.DB, cutoff)
+	log.Printf("Archived %d audit events from before %s", moved, cutoff.Format("2006-01"))
+	return err
+}
@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// archiveBatchSize bounds how many events one archive transaction moves, so
+// the rows are never locked for long
+const archiveBatchSize = 1000
+
+// Archive moves the events created before cutoff from audit_events to
+// audit_events_archive and returns how many it moved. Each batch is copied
+// and deleted in one transaction: an event is never in both tables or in
+// neither.
+func Archive(db *gorm.DB, cutoff time.Time) (int64, error) {
+	var total int64
+	for {
+		var moved int64
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var events []models.AuditEvent
+			if err := tx.Where("created_at < ?", cutoff).Order("id").Limit(archiveBatchSize).Find(&events).Error; err != nil {
+				return err
+			}
+			if len(events) == 0 {
+				return nil
+			}
+
+			archived := make([]models.ArchivedAuditEvent, len(events))
+			ids := make([]uint, len(events))
+			for i, event := range events {
+				archived[i] = models.ArchivedAuditEvent(event)
+				ids[i] = event.ID
+			}
+			if err := tx.Create(&archived).Error; err != nil {
+				return err
+			}
+			result := tx.Where("id IN ?", ids).Delete(&models.AuditEvent{})
+			moved = result.RowsAffected
+			return result.Error
+		})
+		total += moved
+		if err != nil || moved < archiveBatchSize {
+			return total, err
+		}
+	}
+}
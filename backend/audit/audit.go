@@ -0,0 +1,135 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Context keys of the annotations handlers add for the Middleware event
+const (
+	actionKey  = "audit_action"
+	actorKey   = "audit_actor_id"
+	clientKey  = "audit_client_id"
+	targetKey  = "audit_target"
+	detailsKey = "audit_details"
+	skipKey    = "audit_skip"
+)
+
+type target struct {
+	kind string
+	id   string
+}
+
+// Record stores an audit event for the request in c. The actor is the
+// authenticated user, if any. Failures are logged rather than returned: the
+// audited action has already happened.
+func Record(db *gorm.DB, c *gin.Context, action, targetType, targetID string, details map[string]interface{}) {
+	event := models.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+	}
+	if c != nil {
+		if userID, ok := c.Get("user_id"); ok {
+			id := userID.(uint)
+			event.ActorID = &id
+		}
+		if actorID, ok := c.Get(actorKey); ok {
+			id := actorID.(uint)
+			event.ActorID = &id
+		}
+		if adminID, ok := c.Get("impersonator_id"); ok {
+			id := adminID.(uint)
+			event.ImpersonatorID = &id
+		}
+		event.ClientID = c.GetString(clientKey)
+		event.IP = c.ClientIP()
+	}
+	if len(details) > 0 {
+		data, err := json.Marshal(details)
+		if err != nil {
+			log.Printf("Failed to encode audit details for %s: %v", action, err)
+		}
+		event.Details = string(data)
+	}
+
+	if err := db.Create(&event).Error; err != nil {
+		log.Printf("Failed to record audit event %s: %v", action, err)
+	}
+}
+
+// Middleware records one event per request once the handler has run: action
+// on success, action + "_failed" when the response is an error. Handlers
+// refine the event with SetAction, SetActor, SetClient, SetTarget and
+// AddDetail, or drop it with Skip.
+func Middleware(db *gorm.DB, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.GetBool(skipKey) {
+			return
+		}
+
+		status := c.Writer.Status()
+		recorded := action
+		if v := c.GetString(actionKey); v != "" {
+			recorded = v
+		} else if status >= 400 {
+			recorded = action + "_failed"
+		}
+
+		details := map[string]interface{}{"status": status}
+		if extra, ok := c.Get(detailsKey); ok {
+			for k, v := range extra.(map[string]interface{}) {
+				details[k] = v
+			}
+		}
+		var t target
+		if v, ok := c.Get(targetKey); ok {
+			t = v.(target)
+		}
+		Record(db, c, recorded, t.kind, t.id, details)
+	}
+}
+
+// SetAction replaces the action Middleware records, e.g. to tell a granted
+// consent from a denied one
+func SetAction(c *gin.Context, action string) {
+	c.Set(actionKey, action)
+}
+
+// Skip drops the Middleware event, for routine outcomes that aren't worth
+// recording, such as a device polling before its user has decided
+func Skip(c *gin.Context) {
+	c.Set(skipKey, true)
+}
+
+// SetActor names the user an unauthenticated request acted as, such as the
+// account a login was attempted for
+func SetActor(c *gin.Context, userID uint) {
+	c.Set(actorKey, userID)
+}
+
+// SetClient names the OAuth client the request was made by or for
+func SetClient(c *gin.Context, clientID string) {
+	c.Set(clientKey, clientID)
+}
+
+// SetTarget names the object the request acted on
+func SetTarget(c *gin.Context, targetType, targetID string) {
+	c.Set(targetKey, target{kind: targetType, id: targetID})
+}
+
+// AddDetail adds a detail to the Middleware event
+func AddDetail(c *gin.Context, key string, value interface{}) {
+	details, ok := c.Get(detailsKey)
+	if !ok {
+		details = map[string]interface{}{}
+		c.Set(detailsKey, details)
+	}
+	details.(map[string]interface{})[key] = value
+}
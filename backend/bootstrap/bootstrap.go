@@ -0,0 +1,307 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/utils"
+
+	"gorm.io/gorm"
+)
+
+// Spec is a declarative description of the OAuth scopes, clients, admin
+// users and proxy policies a deployment should have. Applying the same Spec
+// twice is a no-op.
+type Spec struct {
+	Scopes     []ScopeSpec  `json:"scopes"`
+	Clients    []ClientSpec `json:"clients"`
+	AdminUsers []UserSpec   `json:"admin_users"`
+	Policies   []PolicySpec `json:"policies"`
+}
+
+// ScopeSpec describes an entry of the OAuth scope registry
+type ScopeSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Restricted  bool   `json:"restricted"`
+	Write       bool   `json:"write"`
+}
+
+// ClientSpec describes an OAuth client. ID is required so that the client
+// keeps a stable identity across runs.
+type ClientSpec struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Secret        string   `json:"secret"`
+	RedirectURIs  []string `json:"redirect_uris"`
+	Trusted       bool     `json:"trusted"`        // skip the consent screen
+	Service       bool     `json:"service"`        // may use the client_credentials grant
+	PublicKeys    []string `json:"public_keys"`    // PEM keys for private_key_jwt authentication
+	AllowedScopes []string `json:"allowed_scopes"` // restricted scopes the client may request
+}
+
+// UserSpec describes an admin user, identified by email. Password is only
+// required when the user does not exist yet. Omitting Permissions grants
+// every admin permission, as before permissions existed.
+type UserSpec struct {
+	Email       string   `json:"email"`
+	Name        string   `json:"name"`
+	Password    string   `json:"password"`
+	Permissions []string `json:"permissions"`
+}
+
+// permissions returns the permissions the spec grants
+func (u UserSpec) permissions() []string {
+	if u.Permissions == nil {
+		return []string{models.PermissionAll}
+	}
+	return u.Permissions
+}
+
+// PolicySpec describes a named proxy policy document.
+type PolicySpec struct {
+	Name     string `json:"name"`
+	Document string `json:"document"`
+}
+
+// Outcome of applying a single resource
+const (
+	Created   = "created"
+	Updated   = "updated"
+	Unchanged = "unchanged"
+)
+
+// Result reports what happened to each resource, keyed by its stable ID
+type Result struct {
+	Scopes     map[string]string `json:"scopes"`
+	Clients    map[string]string `json:"clients"`
+	AdminUsers map[string]string `json:"admin_users"`
+	Policies   map[string]string `json:"policies"`
+}
+
+// Validate checks the spec before anything is written
+func (s *Spec) Validate() error {
+	var problems []string
+
+	for i, sc := range s.Scopes {
+		if !models.ValidScopeName(sc.Name) || sc.Description == "" {
+			problems = append(problems, fmt.Sprintf("scopes[%d]: a valid name and a description are required", i))
+		}
+	}
+	for i, c := range s.Clients {
+		if c.ID == "" || c.Name == "" || c.Secret == "" || len(c.RedirectURIs) == 0 {
+			problems = append(problems, fmt.Sprintf("clients[%d]: id, name, secret and redirect_uris are required", i))
+		}
+		for j, key := range c.PublicKeys {
+			if _, err := utils.ParsePublicKey(key); err != nil {
+				problems = append(problems, fmt.Sprintf("clients[%d].public_keys[%d]: %v", i, j, err))
+			}
+		}
+	}
+	for i, u := range s.AdminUsers {
+		if u.Email == "" || u.Name == "" {
+			problems = append(problems, fmt.Sprintf("admin_users[%d]: email and name are required", i))
+		}
+		if u.Password != "" && len(u.Password) < 8 {
+			problems = append(problems, fmt.Sprintf("admin_users[%d]: password must be at least 8 characters", i))
+		}
+		for _, p := range u.Permissions {
+			if !models.ValidPermission(p) {
+				problems = append(problems, fmt.Sprintf("admin_users[%d]: unknown permission %q", i, p))
+			}
+		}
+	}
+	for i, p := range s.Policies {
+		if p.Name == "" || p.Document == "" {
+			problems = append(problems, fmt.Sprintf("policies[%d]: name and document are required", i))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Apply creates or updates everything in spec inside a single transaction
+func Apply(db *gorm.DB, spec *Spec) (*Result, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Scopes:     make(map[string]string),
+		Clients:    make(map[string]string),
+		AdminUsers: make(map[string]string),
+		Policies:   make(map[string]string),
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, sc := range spec.Scopes {
+			outcome, err := applyScope(tx, sc)
+			if err != nil {
+				return fmt.Errorf("scope %s: %w", sc.Name, err)
+			}
+			result.Scopes[sc.Name] = outcome
+		}
+		for _, c := range spec.Clients {
+			outcome, err := applyClient(tx, c)
+			if err != nil {
+				return fmt.Errorf("client %s: %w", c.ID, err)
+			}
+			result.Clients[c.ID] = outcome
+		}
+		for _, u := range spec.AdminUsers {
+			outcome, err := applyAdminUser(tx, u)
+			if err != nil {
+				return fmt.Errorf("admin user %s: %w", u.Email, err)
+			}
+			result.AdminUsers[u.Email] = outcome
+		}
+		for _, p := range spec.Policies {
+			outcome, err := applyPolicy(tx, p)
+			if err != nil {
+				return fmt.Errorf("policy %s: %w", p.Name, err)
+			}
+			result.Policies[p.Name] = outcome
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func applyScope(tx *gorm.DB, spec ScopeSpec) (string, error) {
+	var scope models.OAuthScope
+	err := tx.Where("name = ?", spec.Name).First(&scope).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		scope = models.OAuthScope{Name: spec.Name, Description: spec.Description, Restricted: spec.Restricted, Write: spec.Write}
+		return Created, tx.Create(&scope).Error
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if scope.Description == spec.Description && scope.Restricted == spec.Restricted && scope.Write == spec.Write {
+		return Unchanged, nil
+	}
+	return Updated, tx.Model(&scope).Updates(map[string]interface{}{
+		"description": spec.Description,
+		"restricted":  spec.Restricted,
+		"write":       spec.Write,
+	}).Error
+}
+
+func applyClient(tx *gorm.DB, spec ClientSpec) (string, error) {
+	redirectURIs, err := json.Marshal(spec.RedirectURIs)
+	if err != nil {
+		return "", err
+	}
+	allowedScopes := strings.Join(models.ParseScope(strings.Join(spec.AllowedScopes, " ")), " ")
+	publicKeys := models.EncodePublicKeys(spec.PublicKeys)
+
+	var client models.OAuthClient
+	err = tx.Unscoped().Where("id = ?", spec.ID).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		client = models.OAuthClient{
+			ID:            spec.ID,
+			ClientSecret:  spec.Secret,
+			Name:          spec.Name,
+			RedirectURIs:  string(redirectURIs),
+			Trusted:       spec.Trusted,
+			Service:       spec.Service,
+			AllowedScopes: allowedScopes,
+			PublicKeys:    publicKeys,
+		}
+		return Created, tx.Create(&client).Error
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if client.Name == spec.Name && client.ClientSecret == spec.Secret &&
+		client.RedirectURIs == string(redirectURIs) && client.Trusted == spec.Trusted && client.Service == spec.Service &&
+		client.AllowedScopes == allowedScopes && client.PublicKeys == publicKeys &&
+		!client.DeletedAt.Valid {
+		return Unchanged, nil
+	}
+
+	// Restore soft-deleted clients: the spec says the client should exist
+	return Updated, tx.Unscoped().Model(&client).Updates(map[string]interface{}{
+		"name":           spec.Name,
+		"client_secret":  spec.Secret,
+		"redirect_uris":  string(redirectURIs),
+		"trusted":        spec.Trusted,
+		"service":        spec.Service,
+		"allowed_scopes": allowedScopes,
+		"public_keys":    publicKeys,
+		"deleted_at":     nil,
+	}).Error
+}
+
+func applyAdminUser(tx *gorm.DB, spec UserSpec) (string, error) {
+	var user models.User
+	err := tx.Where("email = ?", spec.Email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if spec.Password == "" {
+			return "", errors.New("password is required for new users")
+		}
+		user = models.User{Email: spec.Email, Name: spec.Name, Role: models.RoleAdmin}
+		user.SetPermissions(spec.permissions())
+		if err := user.HashPassword(spec.Password); err != nil {
+			return "", err
+		}
+		return Created, tx.Create(&user).Error
+	}
+	if err != nil {
+		return "", err
+	}
+
+	updates := map[string]interface{}{}
+	if user.Name != spec.Name {
+		updates["name"] = spec.Name
+	}
+	if user.Role != models.RoleAdmin {
+		updates["role"] = models.RoleAdmin
+	}
+	previous := user.Permissions
+	if user.SetPermissions(spec.permissions()); user.Permissions != previous {
+		updates["permissions"] = user.Permissions
+	}
+	// Only re-hash when the password actually changed, so re-applying a spec
+	// doesn't churn the stored hash
+	if spec.Password != "" && !user.CheckPassword(spec.Password) {
+		if err := user.HashPassword(spec.Password); err != nil {
+			return "", err
+		}
+		updates["password"] = user.Password
+	}
+
+	if len(updates) == 0 {
+		return Unchanged, nil
+	}
+	return Updated, tx.Model(&user).Updates(updates).Error
+}
+
+func applyPolicy(tx *gorm.DB, spec PolicySpec) (string, error) {
+	var policy models.ProxyPolicy
+	err := tx.Where("name = ?", spec.Name).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		policy = models.ProxyPolicy{Name: spec.Name, Document: spec.Document}
+		return Created, tx.Create(&policy).Error
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if policy.Document == spec.Document {
+		return Unchanged, nil
+	}
+	return Updated, tx.Model(&policy).Update("document", spec.Document).Error
+}
@@ -1,49 +1,272 @@
 package config
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/secrets"
+	"github.com/ayouroukov/ebay-mcp/internal/store"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port         string
-	FrontendURL  string
-	JWTSecret    string
-	OAuthIssuer  string
-	Database     DatabaseConfig
+	Port           string
+	FrontendURL    string
+	JWTSecret      string
+	OAuthIssuer    string
+	BootstrapToken string
+	// InternalSecrets sign requests between the proxy and the backend; the
+	// first signs, any verifies. None disables the internal API.
+	InternalSecrets []string
+	// Store keeps what replicas must share, such as the nonces of internal
+	// requests: the store of CACHE_BACKEND, as the proxy's cache uses
+	Store store.Store
+	// TrustedProxies are the addresses or CIDRs of reverse proxies whose
+	// X-Forwarded-For gives the client IP; none by default
+	TrustedProxies []string
+	// CredentialKey encrypts linked eBay refresh tokens at rest
+	CredentialKey []byte
+	// ArchiveKeepMonths is how many months of audit events, the current one
+	// included, `backend archive` leaves in audit_events
+	ArchiveKeepMonths int
+	WebAuthn          WebAuthnConfig
+	Database          DatabaseConfig
+	Login             LoginConfig
+	Secrets           SecretsConfig
+}
+
+// SecretNames are the backend secrets the secrets backend is asked for
+var SecretNames = []string{
+	"JWT_SECRET",
+	"DB_PASSWORD",
+	"BOOTSTRAP_TOKEN",
+	"INTERNAL_SIGNING_SECRETS",
+	"TOTP_ENCRYPTION_KEY",
+	"CREDENTIALS_ENCRYPTION_KEY",
+}
+
+// SecretsConfig is where the secrets were read from, for picking up
+// rotated values
+type SecretsConfig struct {
+	Provider        secrets.Provider
+	Values          map[string]string // read at startup
+	RefreshInterval time.Duration     // 0 disables
+}
+
+// LoginConfig hardens password sign-in
+type LoginConfig struct {
+	// PasswordHash is the algorithm new hashes use, "bcrypt" or "argon2id".
+	// Hashes made with other settings are upgraded at the next sign-in.
+	PasswordHash  string
+	BcryptCost    int
+	Argon2Time    int // passes
+	Argon2Memory  int // KiB
+	Argon2Threads int
+
+	MaxFailures     int           // wrong passwords before an account is locked; 0 disables
+	LockoutDuration time.Duration // how long an account stays locked
+	IPMaxFailures   int           // failed sign-ins per IP within IPWindow before it is throttled; 0 disables
+	IPWindow        time.Duration
+
+	TOTPIssuer string // shown by authenticator apps
+	TOTPKey    []byte // AES-256 key encrypting TOTP secrets at rest
+	// RequireAdmin2FA blocks admin actions for admins without two-factor
+	// authentication
+	RequireAdmin2FA bool
+}
+
+// WebAuthnConfig identifies this deployment as a passkey relying party
+type WebAuthnConfig struct {
+	RPID          string // domain the passkeys are bound to
+	RPDisplayName string
+	RPOrigins     []string // origins allowed to run the ceremonies
 }
 
 type DatabaseConfig struct {
+	Driver   string // postgres, mysql or sqlite
+	Path     string // database file, sqlite only
 	Host     string
 	Port     string
 	User     string
 	Password string
 	Name     string
+	// Replicas are host[:port] read replicas sharing the credentials above
+	Replicas []string
+	// AutoMigrate applies pending migrations at startup; without it startup
+	// fails until `backend migrate up` has run
+	AutoMigrate bool
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	QueryTimeout    time.Duration // per statement; 0 disables
+	SlowQuery       time.Duration // statements slower than this are logged and counted
+	LogLevel        string        // silent, error, warn or info
 }
 
 func Load() *Config {
-	// Try to load .env file (optional in production)
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
+	provider, values, err := prepare("")
+	if err != nil {
+		log.Fatal(err)
 	}
+	shared, err := store.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	frontendURL := getEnv("FRONTEND_URL", "http://localhost:3000")
+	jwtSecret := getEnv("JWT_SECRET", "change-this-secret-key")
+	dbDriver := getChoiceEnv("DB_DRIVER", "postgres", "postgres", "mysql", "sqlite")
 
 	return &Config{
-		Port:        getEnv("PORT", "8080"),
-		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:3000"),
-		JWTSecret:   getEnv("JWT_SECRET", "change-this-secret-key"),
-		OAuthIssuer: getEnv("OAUTH_ISSUER", "http://localhost:8080"),
+		Port:              getEnv("PORT", "8080"),
+		FrontendURL:       frontendURL,
+		JWTSecret:         getEnv("JWT_SECRET", "change-this-secret-key"),
+		OAuthIssuer:       getEnv("OAUTH_ISSUER", "http://localhost:8080"),
+		BootstrapToken:    getEnv("BOOTSTRAP_TOKEN", ""),
+		InternalSecrets:   splitList(getEnv("INTERNAL_SIGNING_SECRETS", "")),
+		Store:             shared,
+		TrustedProxies:    splitList(getEnv("TRUSTED_PROXIES", "")),
+		CredentialKey:     getKeyEnv("CREDENTIALS_ENCRYPTION_KEY", jwtSecret),
+		ArchiveKeepMonths: getIntEnv("ARCHIVE_KEEP_MONTHS", 3),
+		WebAuthn: WebAuthnConfig{
+			RPID:          getEnv("WEBAUTHN_RP_ID", hostOf(frontendURL)),
+			RPDisplayName: getEnv("WEBAUTHN_RP_NAME", "eBay MCP"),
+			RPOrigins:     splitList(getEnv("WEBAUTHN_RP_ORIGINS", frontendURL)),
+		},
 		Database: DatabaseConfig{
+			Driver:   dbDriver,
+			Path:     getEnv("DB_PATH", "ebay_mcp.db"),
 			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
+			Port:     getEnv("DB_PORT", defaultDBPort(dbDriver)),
 			User:     getEnv("DB_USER", "postgres"),
 			Password: getEnv("DB_PASSWORD", "postgres"),
 			Name:     getEnv("DB_NAME", "ebay_mcp_db"),
+			Replicas: splitList(getEnv("DB_REPLICA_HOSTS", "")),
+
+			AutoMigrate: getChoiceEnv("DB_AUTO_MIGRATE", "true", "true", "false") == "true",
+
+			MaxOpenConns:    getIntEnv("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:    getIntEnv("DB_MAX_IDLE_CONNS", 10),
+			ConnMaxLifetime: getDurationEnv("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+			ConnMaxIdleTime: getDurationEnv("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+			QueryTimeout:    getDurationEnv("DB_QUERY_TIMEOUT", 5*time.Second),
+			SlowQuery:       getDurationEnv("DB_SLOW_QUERY_THRESHOLD", 200*time.Millisecond),
+			LogLevel:        getEnv("DB_LOG_LEVEL", "info"),
+		},
+		Login: LoginConfig{
+			PasswordHash:  getChoiceEnv("PASSWORD_HASH", "bcrypt", "bcrypt", "argon2id"),
+			BcryptCost:    getIntEnv("BCRYPT_COST", 10),
+			Argon2Time:    getIntEnv("ARGON2_TIME", 3),
+			Argon2Memory:  getIntEnv("ARGON2_MEMORY_KIB", 64*1024),
+			Argon2Threads: getIntEnv("ARGON2_THREADS", 2),
+
+			MaxFailures:     getIntEnv("LOGIN_MAX_FAILURES", 5),
+			LockoutDuration: getDurationEnv("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+			IPMaxFailures:   getIntEnv("LOGIN_IP_MAX_FAILURES", 20),
+			IPWindow:        getDurationEnv("LOGIN_IP_WINDOW", 15*time.Minute),
+
+			TOTPIssuer:      getEnv("TOTP_ISSUER", "eBay MCP"),
+			TOTPKey:         getKeyEnv("TOTP_ENCRYPTION_KEY", jwtSecret),
+			RequireAdmin2FA: getEnv("REQUIRE_ADMIN_2FA", "false") == "true",
+		},
+		Secrets: SecretsConfig{
+			Provider:        provider,
+			Values:          values,
+			RefreshInterval: getDurationEnv("SECRETS_REFRESH_INTERVAL", 0),
 		},
 	}
 }
 
+// Check validates the configuration file (file, or CONFIG_FILE) and the
+// environment as Load would read them, without exiting
+func Check(file string) error {
+	_, _, err := prepare(file)
+	return err
+}
+
+// prepare fills the environment from .env, file and CONFIG_FILE and the
+// secrets backend, then validates it against Settings
+func prepare(file string) (secrets.Provider, map[string]string, error) {
+	// Try to load .env file (optional in production)
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	// Settings from the configuration file, under those already in the
+	// environment
+	for _, path := range []string{file, os.Getenv("CONFIG_FILE")} {
+		if path == "" {
+			continue
+		}
+		n, err := Settings.Load(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Printf("Loaded %d settings from %s", n, path)
+	}
+
+	if err := Settings.Public().Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	// Secrets from SECRETS_BACKEND land in the environment before anything
+	// below reads it
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	provider, err := secrets.FromEnv(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid secrets settings: %w", err)
+	}
+	values, err := secrets.Load(ctx, provider, SecretNames)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load secrets: %w", err)
+	}
+
+	if err := Settings.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return provider, values, nil
+}
+
+// hostOf returns the hostname of rawURL, or rawURL itself if it can't be parsed
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return rawURL
+	}
+	return u.Hostname()
+}
+
+// splitList splits a comma-separated value, dropping blanks
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// defaultDBPort is the port DB_DRIVER listens on out of the box
+func defaultDBPort(driver string) string {
+	if driver == "mysql" {
+		return "3306"
+	}
+	return "5432"
+}
+
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -51,3 +274,56 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getIntEnv reads a non-negative integer, exiting on malformed values
+func getIntEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid %s %q: expected a non-negative integer", key, value)
+	}
+	return n
+}
+
+// getChoiceEnv reads one of choices, exiting on anything else
+func getChoiceEnv(key, defaultValue string, choices ...string) string {
+	value := getEnv(key, defaultValue)
+	for _, choice := range choices {
+		if value == choice {
+			return value
+		}
+	}
+	log.Fatalf("Invalid %s %q: expected one of %s", key, value, strings.Join(choices, ", "))
+	return ""
+}
+
+// getKeyEnv reads a base64-encoded 32-byte key, exiting on malformed values.
+// Without one, the key is derived from fallbackSecret.
+func getKeyEnv(key, fallbackSecret string) []byte {
+	value := os.Getenv(key)
+	if value == "" {
+		derived := sha256.Sum256([]byte(key + ":" + fallbackSecret))
+		return derived[:]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(decoded) != 32 {
+		log.Fatalf("Invalid %s: expected 32 base64-encoded bytes", key)
+	}
+	return decoded
+}
+
+// getDurationEnv reads a duration such as "5s", exiting on malformed values
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Fatalf("Invalid %s %q: expected a duration such as 5s", key, value)
+	}
+	return d
+}
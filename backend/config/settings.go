@@ -0,0 +1,51 @@
+package config
+
+import cfgfile "github.com/ayouroukov/ebay-mcp/config"
+
+// Settings is the schema of the backend's section of CONFIG_FILE, a YAML
+// file that is an alternative to the environment variables below. Variables
+// that are set win over the file; `backend config check` validates both.
+var Settings = cfgfile.Shared.With(
+	cfgfile.Setting{Path: "backend.port", Env: "PORT", Kind: cfgfile.Int},
+	cfgfile.Setting{Path: "backend.frontend_url", Env: "FRONTEND_URL", Kind: cfgfile.URL},
+	cfgfile.Setting{Path: "backend.jwt_secret", Env: "JWT_SECRET", Secret: true},
+	cfgfile.Setting{Path: "backend.oauth_issuer", Env: "OAUTH_ISSUER", Kind: cfgfile.URL},
+	cfgfile.Setting{Path: "backend.bootstrap_token", Env: "BOOTSTRAP_TOKEN", Secret: true},
+	cfgfile.Setting{Path: "backend.credentials_encryption_key", Env: "CREDENTIALS_ENCRYPTION_KEY", Kind: cfgfile.Key, Secret: true},
+	cfgfile.Setting{Path: "backend.archive_keep_months", Env: "ARCHIVE_KEEP_MONTHS", Kind: cfgfile.Int},
+	cfgfile.Setting{Path: "backend.trusted_proxies", Env: "TRUSTED_PROXIES", Kind: cfgfile.List},
+
+	cfgfile.Setting{Path: "backend.webauthn.rp_id", Env: "WEBAUTHN_RP_ID"},
+	cfgfile.Setting{Path: "backend.webauthn.rp_name", Env: "WEBAUTHN_RP_NAME"},
+	cfgfile.Setting{Path: "backend.webauthn.rp_origins", Env: "WEBAUTHN_RP_ORIGINS", Kind: cfgfile.List},
+
+	cfgfile.Setting{Path: "backend.database.driver", Env: "DB_DRIVER", Choices: []string{"postgres", "mysql", "sqlite"}},
+	cfgfile.Setting{Path: "backend.database.path", Env: "DB_PATH"},
+	cfgfile.Setting{Path: "backend.database.host", Env: "DB_HOST"},
+	cfgfile.Setting{Path: "backend.database.port", Env: "DB_PORT", Kind: cfgfile.Int},
+	cfgfile.Setting{Path: "backend.database.user", Env: "DB_USER"},
+	cfgfile.Setting{Path: "backend.database.password", Env: "DB_PASSWORD", Secret: true},
+	cfgfile.Setting{Path: "backend.database.name", Env: "DB_NAME"},
+	cfgfile.Setting{Path: "backend.database.replica_hosts", Env: "DB_REPLICA_HOSTS", Kind: cfgfile.List},
+	cfgfile.Setting{Path: "backend.database.auto_migrate", Env: "DB_AUTO_MIGRATE", Kind: cfgfile.Bool},
+	cfgfile.Setting{Path: "backend.database.max_open_conns", Env: "DB_MAX_OPEN_CONNS", Kind: cfgfile.Int},
+	cfgfile.Setting{Path: "backend.database.max_idle_conns", Env: "DB_MAX_IDLE_CONNS", Kind: cfgfile.Int},
+	cfgfile.Setting{Path: "backend.database.conn_max_lifetime", Env: "DB_CONN_MAX_LIFETIME", Kind: cfgfile.Duration},
+	cfgfile.Setting{Path: "backend.database.conn_max_idle_time", Env: "DB_CONN_MAX_IDLE_TIME", Kind: cfgfile.Duration},
+	cfgfile.Setting{Path: "backend.database.query_timeout", Env: "DB_QUERY_TIMEOUT", Kind: cfgfile.Duration},
+	cfgfile.Setting{Path: "backend.database.slow_query_threshold", Env: "DB_SLOW_QUERY_THRESHOLD", Kind: cfgfile.Duration},
+	cfgfile.Setting{Path: "backend.database.log_level", Env: "DB_LOG_LEVEL", Choices: []string{"silent", "error", "warn", "info"}},
+
+	cfgfile.Setting{Path: "backend.login.password_hash", Env: "PASSWORD_HASH", Choices: []string{"bcrypt", "argon2id"}},
+	cfgfile.Setting{Path: "backend.login.bcrypt_cost", Env: "BCRYPT_COST", Kind: cfgfile.Int},
+	cfgfile.Setting{Path: "backend.login.argon2.time", Env: "ARGON2_TIME", Kind: cfgfile.Int},
+	cfgfile.Setting{Path: "backend.login.argon2.memory_kib", Env: "ARGON2_MEMORY_KIB", Kind: cfgfile.Int},
+	cfgfile.Setting{Path: "backend.login.argon2.threads", Env: "ARGON2_THREADS", Kind: cfgfile.Int},
+	cfgfile.Setting{Path: "backend.login.max_failures", Env: "LOGIN_MAX_FAILURES", Kind: cfgfile.Int},
+	cfgfile.Setting{Path: "backend.login.lockout_duration", Env: "LOGIN_LOCKOUT_DURATION", Kind: cfgfile.Duration},
+	cfgfile.Setting{Path: "backend.login.ip_max_failures", Env: "LOGIN_IP_MAX_FAILURES", Kind: cfgfile.Int},
+	cfgfile.Setting{Path: "backend.login.ip_window", Env: "LOGIN_IP_WINDOW", Kind: cfgfile.Duration},
+	cfgfile.Setting{Path: "backend.login.totp_issuer", Env: "TOTP_ISSUER"},
+	cfgfile.Setting{Path: "backend.login.totp_encryption_key", Env: "TOTP_ENCRYPTION_KEY", Kind: cfgfile.Key, Secret: true},
+	cfgfile.Setting{Path: "backend.login.require_admin_2fa", Env: "REQUIRE_ADMIN_2FA", Kind: cfgfile.Bool},
+)
@@ -0,0 +1,348 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AdminController struct {
+	config *config.Config
+}
+
+func NewAdminController(cfg *config.Config) *AdminController {
+	return &AdminController{config: cfg}
+}
+
+type UpdatePermissionsRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+type PutPolicyRequest struct {
+	Document string `json:"document" binding:"required"`
+}
+
+type StartImpersonationRequest struct {
+	UserID          uint   `json:"user_id" binding:"required"`
+	Reason          string `json:"reason" binding:"required"`
+	DurationMinutes int    `json:"duration_minutes"`
+	AllowMutations  bool   `json:"allow_mutations"`
+}
+
+// Impersonation sessions default to 15 minutes and can't exceed an hour
+const (
+	defaultImpersonationDuration = 15 * time.Minute
+	maxImpersonationDuration     = time.Hour
+)
+
+// currentAdmin returns the admin loaded by middleware.RequirePermission, or
+// nil when a service client is calling
+func currentAdmin(c *gin.Context) *models.User {
+	admin, ok := c.Get("admin")
+	if !ok {
+		return nil
+	}
+	return admin.(*models.User)
+}
+
+// parseLimit reads the ?limit= of list endpoints: default 100, max 500
+func parseLimit(c *gin.Context) (int, bool) {
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return 0, false
+		}
+		limit = n
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	return limit, true
+}
+
+// ListAuditEvents returns the most recent audit events, newest first,
+// optionally filtered by action (a trailing "*" matches a prefix such as
+// "oauth.*"), acting user, OAuth client, target and time range.
+// archived=true searches the events `backend archive` moved to the cold table.
+// GET /api/admin/audit?action=&user_id=&client_id=&target_type=&target_id=&since=&until=&archived=&limit=
+func (ctrl *AdminController) ListAuditEvents(c *gin.Context) {
+	limit, ok := parseLimit(c)
+	if !ok {
+		return
+	}
+
+	query := database.ReadReplica(c).Order("created_at DESC, id DESC").Limit(limit)
+	if c.Query("archived") == "true" {
+		query = query.Model(&models.ArchivedAuditEvent{})
+	}
+	if action := c.Query("action"); strings.HasSuffix(action, "*") {
+		query = query.Where("action LIKE ?", strings.TrimSuffix(action, "*")+"%")
+	} else if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be a user ID"})
+			return
+		}
+		query = query.Where("actor_id = ? OR impersonator_id = ? OR (target_type = ? AND target_id = ?)", id, id, "user", v)
+	}
+	if v := c.Query("client_id"); v != "" {
+		query = query.Where("client_id = ? OR (target_type = ? AND target_id = ?)", v, "client", v)
+	}
+	if v := c.Query("target_type"); v != "" {
+		query = query.Where("target_type = ?", v)
+	}
+	if v := c.Query("target_id"); v != "" {
+		query = query.Where("target_id = ?", v)
+	}
+	for _, bound := range []struct{ param, cond string }{
+		{"since", "created_at >= ?"},
+		{"until", "created_at < ?"},
+	} {
+		v := c.Query(bound.param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bound.param + " must be an RFC 3339 time"})
+			return
+		}
+		query = query.Where(bound.cond, t)
+	}
+
+	var events []models.AuditEvent
+	if err := query.Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load audit events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// UpdatePermissions replaces an admin's permissions. Admins can only grant
+// or revoke permissions they hold themselves, so a grant can never escalate.
+// PUT /api/admin/users/:id/permissions
+func (ctrl *AdminController) UpdatePermissions(c *gin.Context) {
+	actor := currentAdmin(c)
+
+	var req UpdatePermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, p := range req.Permissions {
+		if !models.ValidPermission(p) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + p})
+			return
+		}
+	}
+
+	var user models.User
+	if err := database.WithContext(c).First(&user, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return
+	}
+	if !user.IsAdmin() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Permissions can only be assigned to admins"})
+		return
+	}
+
+	previous := user.PermissionList()
+	for _, p := range append(append([]string{}, previous...), req.Permissions...) {
+		if !actor.HasPermission(p) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot grant or revoke a permission you don't hold: " + p})
+			return
+		}
+	}
+
+	user.SetPermissions(req.Permissions)
+	if err := database.WithContext(c).Model(&user).Update("permissions", user.Permissions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update permissions"})
+		return
+	}
+
+	audit.Record(database.DB, c, "admin.permissions_updated", "user", strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+		"previous":    previous,
+		"permissions": user.PermissionList(),
+	})
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ListPolicies returns all stored proxy policies
+// GET /api/admin/policies
+func (ctrl *AdminController) ListPolicies(c *gin.Context) {
+	var policies []models.ProxyPolicy
+	if err := database.WithContext(c).Order("name").Find(&policies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load policies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policies)
+}
+
+// PutPolicy creates or replaces a named proxy policy
+// PUT /api/admin/policies/:name
+func (ctrl *AdminController) PutPolicy(c *gin.Context) {
+	var req PutPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := c.Param("name")
+	action := "policy.updated"
+	var policy models.ProxyPolicy
+	err := database.WithContext(c).Where("name = ?", name).First(&policy).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		action = "policy.created"
+		policy = models.ProxyPolicy{Name: name, Document: req.Document}
+		err = database.WithContext(c).Create(&policy).Error
+	case err == nil:
+		policy.Document = req.Document
+		err = database.WithContext(c).Save(&policy).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save policy"})
+		return
+	}
+
+	audit.Record(database.DB, c, action, "policy", name, nil)
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// StartImpersonation opens a time-boxed session in which the admin acts as a
+// user, and returns a token for it. Sessions are read-only unless
+// allow_mutations is set.
+// POST /api/admin/impersonations
+func (ctrl *AdminController) StartImpersonation(c *gin.Context) {
+	admin := currentAdmin(c)
+
+	var req StartImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	duration := defaultImpersonationDuration
+	if req.DurationMinutes != 0 {
+		duration = time.Duration(req.DurationMinutes) * time.Minute
+	}
+	if duration <= 0 || duration > maxImpersonationDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration_minutes must be between 1 and 60"})
+		return
+	}
+
+	var user models.User
+	if err := database.WithContext(c).First(&user, req.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	// Impersonating an admin would hand out their permissions
+	if user.IsAdmin() || user.ID == admin.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admins cannot be impersonated"})
+		return
+	}
+
+	session := models.ImpersonationSession{
+		AdminID:        admin.ID,
+		UserID:         user.ID,
+		Reason:         req.Reason,
+		AllowMutations: req.AllowMutations,
+		ExpiresAt:      time.Now().Add(duration),
+	}
+	if err := database.WithContext(c).Create(&session).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		return
+	}
+
+	token, err := utils.GenerateImpersonationJWT(user.ID, user.Email, session.ID, admin.ID, session.ExpiresAt, ctrl.config.JWTSecret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	audit.Record(database.DB, c, "impersonation.started", "user", strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+		"session_id":      session.ID,
+		"reason":          session.Reason,
+		"allow_mutations": session.AllowMutations,
+		"expires_at":      session.ExpiresAt,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":   token,
+		"session": session,
+		"user":    user,
+	})
+}
+
+// ListImpersonations returns impersonation sessions that are still active
+// GET /api/admin/impersonations
+func (ctrl *AdminController) ListImpersonations(c *gin.Context) {
+	var sessions []models.ImpersonationSession
+	if err := database.WithContext(c).Where("ended_at IS NULL AND expires_at > ?", time.Now()).
+		Order("created_at DESC").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load impersonation sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// EndImpersonation ends a session early, invalidating its token
+// DELETE /api/admin/impersonations/:id
+func (ctrl *AdminController) EndImpersonation(c *gin.Context) {
+	var session models.ImpersonationSession
+	if err := database.WithContext(c).First(&session, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impersonation session not found"})
+		return
+	}
+	if !session.IsActive(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Impersonation session has already ended"})
+		return
+	}
+
+	now := time.Now()
+	if err := database.WithContext(c).Model(&session).Update("ended_at", now).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end impersonation"})
+		return
+	}
+
+	audit.Record(database.DB, c, "impersonation.ended", "user", strconv.FormatUint(uint64(session.UserID), 10), map[string]interface{}{
+		"session_id": session.ID,
+	})
+
+	c.Status(http.StatusNoContent)
+}
+
+// DatabaseStats reports the connection pool and per-statement timings
+// GET /api/admin/database
+func (ctrl *AdminController) DatabaseStats(c *gin.Context) {
+	stats, err := database.GetStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read database stats"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
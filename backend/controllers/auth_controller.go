@@ -1,12 +1,16 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
-	"ebay-mcp/backend/config"
-	"ebay-mcp/backend/database"
-	"ebay-mcp/backend/models"
-	"ebay-mcp/backend/utils"
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -45,7 +49,7 @@ func (ctrl *AuthController) Register(c *gin.Context) {
 
 	// Check if user already exists
 	var existingUser models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
+	if err := database.WithContext(c).Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
 		return
 	}
@@ -63,10 +67,11 @@ func (ctrl *AuthController) Register(c *gin.Context) {
 	}
 
 	// Save to database
-	if err := database.DB.Create(&user).Error; err != nil {
+	if err := database.WithContext(c).Create(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
+	audit.SetActor(c, user.ID)
 
 	// Generate JWT token
 	token, err := utils.GenerateJWT(user.ID, user.Email, ctrl.config.JWTSecret)
@@ -89,19 +94,70 @@ func (ctrl *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	// Find user by email
+	audit.AddDetail(c, "method", "password")
+	audit.AddDetail(c, "email", req.Email)
+
+	if throttled, retryAfter := ctrl.ipThrottled(c); throttled {
+		audit.AddDetail(c, "reason", "throttled")
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed sign-in attempts, try again later"})
+		return
+	}
+
+	// Unknown emails, locked accounts and wrong passwords all get the same
+	// answer, after the same amount of hashing
 	var user models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+	if err := database.WithContext(c).Where("email = ?", req.Email).First(&user).Error; err != nil {
+		models.DummyPasswordCheck(req.Password)
+		ctrl.recordLoginFailure(c, nil)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+	audit.SetActor(c, user.ID)
+
+	if user.IsLocked(time.Now()) {
+		models.DummyPasswordCheck(req.Password)
+		audit.AddDetail(c, "reason", "locked")
+		ctrl.recordLoginFailure(c, nil)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
 	// Check password
 	if !user.CheckPassword(req.Password) {
+		ctrl.recordLoginFailure(c, &user)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	if err := clearLoginFailures(database.WithContext(c), &user); err != nil {
+		log.Printf("Failed to reset failed sign-ins of user %d: %v", user.ID, err)
+	}
+	// Upgrade hashes made with an older algorithm or cost
+	if user.PasswordNeedsRehash() {
+		if err := user.HashPassword(req.Password); err == nil {
+			database.WithContext(c).Model(&user).Update("password", user.Password)
+		}
+	}
+
+	// With two-factor authentication the password only earns a challenge,
+	// exchanged for a session at /api/auth/2fa/verify
+	if user.TwoFactorEnabled() {
+		challenge, err := utils.GenerateTwoFactorChallenge(user.ID, user.Email, ctrl.config.JWTSecret)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		audit.SetAction(c, "auth.two_factor_challenge")
+		c.JSON(http.StatusOK, gin.H{"two_factor_required": true, "challenge": challenge})
+		return
+	}
+
 	// Generate JWT token
 	token, err := utils.GenerateJWT(user.ID, user.Email, ctrl.config.JWTSecret)
 	if err != nil {
@@ -124,7 +180,7 @@ func (ctrl *AuthController) GetProfile(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
+	if err := database.WithContext(c).First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/bootstrap"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BootstrapController struct {
+	config *config.Config
+}
+
+func NewBootstrapController(cfg *config.Config) *BootstrapController {
+	return &BootstrapController{config: cfg}
+}
+
+// Apply provisions scopes, clients, admin users and policies from a
+// declarative spec
+// POST /api/bootstrap
+// Authorization: Bearer <BOOTSTRAP_TOKEN>
+func (ctrl *BootstrapController) Apply(c *gin.Context) {
+	// The endpoint only exists when an operator has configured a token
+	if ctrl.config.BootstrapToken == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bootstrap is disabled"})
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(ctrl.config.BootstrapToken)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid bootstrap token"})
+		return
+	}
+
+	var spec bootstrap.Spec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := spec.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := bootstrap.Apply(database.WithContext(c), &spec)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(database.DB, c, "bootstrap.apply", "", "", map[string]interface{}{
+		"scopes":      result.Scopes,
+		"clients":     result.Clients,
+		"admin_users": result.AdminUsers,
+		"policies":    result.Policies,
+	})
+
+	c.JSON(http.StatusOK, result)
+}
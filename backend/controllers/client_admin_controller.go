@@ -0,0 +1,478 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ClientAdminController manages OAuth clients for admins holding
+// models.PermManageClients
+type ClientAdminController struct {
+	config *config.Config
+}
+
+func NewClientAdminController(cfg *config.Config) *ClientAdminController {
+	return &ClientAdminController{config: cfg}
+}
+
+type CreateClientRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	RedirectURIs  []string `json:"redirect_uris" binding:"required"`
+	Trusted       bool     `json:"trusted"`
+	Service       bool     `json:"service"`
+	AllowedScopes []string `json:"allowed_scopes"`
+	PublicKeys    []string `json:"public_keys"`
+}
+
+type UpdateClientRequest struct {
+	Name          *string  `json:"name"`
+	RedirectURIs  []string `json:"redirect_uris"`
+	Trusted       *bool    `json:"trusted"`
+	Service       *bool    `json:"service"`
+	AllowedScopes []string `json:"allowed_scopes"`
+	PublicKeys    []string `json:"public_keys"`
+}
+
+// ClientResponse is an OAuth client as admins see it. The secret is only
+// included right after it was generated.
+type ClientResponse struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	RedirectURIs  []string   `json:"redirect_uris"`
+	Trusted       bool       `json:"trusted"`
+	Service       bool       `json:"service"`        // may use the client_credentials grant
+	AllowedScopes []string   `json:"allowed_scopes"` // restricted scopes the client may request
+	PublicKeys    []string   `json:"public_keys"`    // PEM keys for private_key_jwt authentication
+	ClientSecret  string     `json:"client_secret,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+}
+
+// TokenSummary describes an issued token without revealing it
+type TokenSummary struct {
+	ID        uint      `json:"id"`
+	Type      string    `json:"type"`    // "access" or "refresh"
+	UserID    *uint     `json:"user_id"` // nil for client_credentials tokens
+	Scope     string    `json:"scope"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GrantSummary describes an authorization code issued to the client
+type GrantSummary struct {
+	ID          uint      `json:"id"`
+	UserID      uint      `json:"user_id"`
+	RedirectURI string    `json:"redirect_uri"`
+	Scope       string    `json:"scope"`
+	Used        bool      `json:"used"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newClientResponse(client *models.OAuthClient) ClientResponse {
+	resp := ClientResponse{
+		ID:            client.ID,
+		Name:          client.Name,
+		Trusted:       client.Trusted,
+		Service:       client.Service,
+		AllowedScopes: append([]string{}, client.AllowedScopeList()...),
+		PublicKeys:    append([]string{}, client.PublicKeyList()...),
+		CreatedAt:     client.CreatedAt,
+		UpdatedAt:     client.UpdatedAt,
+	}
+	json.Unmarshal([]byte(client.RedirectURIs), &resp.RedirectURIs)
+	if client.DeletedAt.Valid {
+		resp.DeletedAt = &client.DeletedAt.Time
+	}
+	return resp
+}
+
+// validateRedirectURIs requires absolute https URIs without fragments;
+// plain http is only accepted for localhost
+func validateRedirectURIs(uris []string) error {
+	if len(uris) == 0 {
+		return errors.New("At least one redirect URI is required")
+	}
+	for _, raw := range uris {
+		u, err := url.Parse(raw)
+		if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+			return errors.New("Invalid redirect URI: " + raw)
+		}
+		if u.Scheme != "https" && !(u.Scheme == "http" && u.Hostname() == "localhost") {
+			return errors.New("Redirect URIs must use https: " + raw)
+		}
+	}
+	return nil
+}
+
+// validateAllowedScopes requires every scope to be registered
+func validateAllowedScopes(ctx context.Context, scopes []string) error {
+	if len(scopes) == 0 {
+		return nil
+	}
+	var count int64
+	names := models.ParseScope(strings.Join(scopes, " "))
+	if err := database.WithContext(ctx).Model(&models.OAuthScope{}).Where("name IN ?", names).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(names) {
+		return errors.New("allowed_scopes may only contain registered scopes")
+	}
+	return nil
+}
+
+// checkAssignableScopes refuses to give a client admin: scopes for
+// permissions the caller doesn't hold, so that an admin can't gain them
+// through a service client. Scopes the client already had are exempt.
+func checkAssignableScopes(c *gin.Context, scopes []string, had []string) error {
+	held := make(map[string]bool, len(had))
+	for _, name := range had {
+		held[name] = true
+	}
+	for _, name := range models.ParseScope(strings.Join(scopes, " ")) {
+		permission, ok := strings.CutPrefix(name, models.ServiceScopePrefix)
+		if !ok || held[name] {
+			continue
+		}
+		if scope, ok := c.Get("service_scope"); ok {
+			if models.ScopeCovers(scope.(string), name) {
+				continue
+			}
+		} else if admin, ok := c.Get("admin"); ok && admin.(*models.User).HasPermission(permission) {
+			continue
+		}
+		return fmt.Errorf("You can only allow %s scopes for permissions you hold: %s", models.ServiceScopePrefix, name)
+	}
+	return nil
+}
+
+// validatePublicKeys requires every key to be a PEM RSA, ECDSA or Ed25519
+// public key
+func validatePublicKeys(keys []string) error {
+	for i, key := range keys {
+		if _, err := utils.ParsePublicKey(key); err != nil {
+			return fmt.Errorf("Invalid public key %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// generateClientSecret returns a new random client secret
+func generateClientSecret() (string, error) {
+	return utils.GenerateRandomToken(32)
+}
+
+// loadClient finds a client by the :id parameter, writing a 404 when absent
+func (ctrl *ClientAdminController) loadClient(c *gin.Context, client *models.OAuthClient) bool {
+	if err := database.WithContext(c).Where("id = ?", c.Param("id")).First(client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load client"})
+		return false
+	}
+	return true
+}
+
+// List returns all clients; deleted ones with ?include_deleted=true
+// GET /api/admin/clients
+func (ctrl *ClientAdminController) List(c *gin.Context) {
+	query := database.ReadReplica(c).Order("created_at ASC")
+	if c.Query("include_deleted") == "true" {
+		query = query.Unscoped()
+	}
+
+	var clients []models.OAuthClient
+	if err := query.Find(&clients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load clients"})
+		return
+	}
+
+	resp := make([]ClientResponse, 0, len(clients))
+	for i := range clients {
+		resp = append(resp, newClientResponse(&clients[i]))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Get returns one client
+// GET /api/admin/clients/:id
+func (ctrl *ClientAdminController) Get(c *gin.Context) {
+	var client models.OAuthClient
+	if !ctrl.loadClient(c, &client) {
+		return
+	}
+	c.JSON(http.StatusOK, newClientResponse(&client))
+}
+
+// Create registers a client with a generated secret, returned only here
+// POST /api/admin/clients
+func (ctrl *ClientAdminController) Create(c *gin.Context) {
+	var req CreateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateRedirectURIs(req.RedirectURIs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateAllowedScopes(c, req.AllowedScopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkAssignableScopes(c, req.AllowedScopes, nil); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePublicKeys(req.PublicKeys); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret, err := generateClientSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate client secret"})
+		return
+	}
+	redirectURIs, _ := json.Marshal(req.RedirectURIs)
+	client := models.OAuthClient{
+		ClientSecret:  secret,
+		Name:          req.Name,
+		RedirectURIs:  string(redirectURIs),
+		Trusted:       req.Trusted,
+		Service:       req.Service,
+		AllowedScopes: strings.Join(models.ParseScope(strings.Join(req.AllowedScopes, " ")), " "),
+		PublicKeys:    models.EncodePublicKeys(req.PublicKeys),
+	}
+	if err := database.WithContext(c).Create(&client).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create client"})
+		return
+	}
+
+	audit.Record(database.DB, c, "client.created", "oauth_client", client.ID, map[string]interface{}{
+		"name":           client.Name,
+		"redirect_uris":  req.RedirectURIs,
+		"trusted":        client.Trusted,
+		"service":        client.Service,
+		"allowed_scopes": client.AllowedScopeList(),
+		"public_keys":    len(req.PublicKeys),
+	})
+
+	resp := newClientResponse(&client)
+	resp.ClientSecret = secret
+	c.JSON(http.StatusCreated, resp)
+}
+
+// Update changes a client's name, redirect URIs, trusted and service flags,
+// allowed scopes and/or public keys
+// PATCH /api/admin/clients/:id
+func (ctrl *ClientAdminController) Update(c *gin.Context) {
+	var req UpdateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var client models.OAuthClient
+	if !ctrl.loadClient(c, &client) {
+		return
+	}
+
+	details := map[string]interface{}{}
+	if req.Name != nil {
+		if *req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name cannot be empty"})
+			return
+		}
+		client.Name = *req.Name
+		details["name"] = client.Name
+	}
+	if req.RedirectURIs != nil {
+		if err := validateRedirectURIs(req.RedirectURIs); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		redirectURIs, _ := json.Marshal(req.RedirectURIs)
+		client.RedirectURIs = string(redirectURIs)
+		details["redirect_uris"] = req.RedirectURIs
+	}
+	if req.Trusted != nil {
+		client.Trusted = *req.Trusted
+		details["trusted"] = client.Trusted
+	}
+	if req.Service != nil {
+		client.Service = *req.Service
+		details["service"] = client.Service
+	}
+	if req.AllowedScopes != nil {
+		if err := validateAllowedScopes(c, req.AllowedScopes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkAssignableScopes(c, req.AllowedScopes, client.AllowedScopeList()); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		client.AllowedScopes = strings.Join(models.ParseScope(strings.Join(req.AllowedScopes, " ")), " ")
+		details["allowed_scopes"] = client.AllowedScopeList()
+	}
+	if req.PublicKeys != nil {
+		if err := validatePublicKeys(req.PublicKeys); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		client.PublicKeys = models.EncodePublicKeys(req.PublicKeys)
+		details["public_keys"] = len(req.PublicKeys)
+	}
+
+	if err := database.WithContext(c).Save(&client).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update client"})
+		return
+	}
+
+	audit.Record(database.DB, c, "client.updated", "oauth_client", client.ID, details)
+	c.JSON(http.StatusOK, newClientResponse(&client))
+}
+
+// RotateSecret replaces the client secret; the old one stops working at once.
+// Issued tokens stay valid.
+// POST /api/admin/clients/:id/rotate-secret
+func (ctrl *ClientAdminController) RotateSecret(c *gin.Context) {
+	var client models.OAuthClient
+	if !ctrl.loadClient(c, &client) {
+		return
+	}
+
+	secret, err := generateClientSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate client secret"})
+		return
+	}
+	if err := database.WithContext(c).Model(&client).Update("client_secret", secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate client secret"})
+		return
+	}
+
+	audit.Record(database.DB, c, "client.secret_rotated", "oauth_client", client.ID, nil)
+
+	resp := newClientResponse(&client)
+	resp.ClientSecret = secret
+	c.JSON(http.StatusOK, resp)
+}
+
+// Delete soft-deletes a client and revokes its tokens
+// DELETE /api/admin/clients/:id
+func (ctrl *ClientAdminController) Delete(c *gin.Context) {
+	var client models.OAuthClient
+	if !ctrl.loadClient(c, &client) {
+		return
+	}
+
+	var revoked int64
+	err := database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		access := tx.Where("client_id = ?", client.ID).Delete(&models.OAuthAccessToken{})
+		if access.Error != nil {
+			return access.Error
+		}
+		refresh := tx.Where("client_id = ?", client.ID).Delete(&models.OAuthRefreshToken{})
+		if refresh.Error != nil {
+			return refresh.Error
+		}
+		revoked = access.RowsAffected + refresh.RowsAffected
+		return tx.Delete(&client).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete client"})
+		return
+	}
+
+	audit.Record(database.DB, c, "client.deleted", "oauth_client", client.ID, map[string]interface{}{
+		"name":           client.Name,
+		"revoked_tokens": revoked,
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "Client deleted", "revoked_tokens": revoked})
+}
+
+// ListTokens returns the client's unexpired access and refresh tokens
+// GET /api/admin/clients/:id/tokens
+func (ctrl *ClientAdminController) ListTokens(c *gin.Context) {
+	var client models.OAuthClient
+	if !ctrl.loadClient(c, &client) {
+		return
+	}
+
+	now := time.Now()
+	var accessTokens []models.OAuthAccessToken
+	var refreshTokens []models.OAuthRefreshToken
+	if err := database.ReadReplica(c).Where("client_id = ? AND expires_at > ?", client.ID, now).Order("created_at DESC").Find(&accessTokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tokens"})
+		return
+	}
+	if err := database.ReadReplica(c).Where("client_id = ? AND expires_at > ?", client.ID, now).Order("created_at DESC").Find(&refreshTokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tokens"})
+		return
+	}
+
+	tokens := make([]TokenSummary, 0, len(accessTokens)+len(refreshTokens))
+	for _, t := range accessTokens {
+		tokens = append(tokens, TokenSummary{ID: t.ID, Type: "access", UserID: t.UserID, Scope: t.Scope, ExpiresAt: t.ExpiresAt, CreatedAt: t.CreatedAt})
+	}
+	for _, t := range refreshTokens {
+		userID := t.UserID
+		tokens = append(tokens, TokenSummary{ID: t.ID, Type: "refresh", UserID: &userID, Scope: t.Scope, ExpiresAt: t.ExpiresAt, CreatedAt: t.CreatedAt})
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// ListGrants returns the authorization codes issued to the client, newest
+// first (limit default 100, max 500)
+// GET /api/admin/clients/:id/grants?limit=
+func (ctrl *ClientAdminController) ListGrants(c *gin.Context) {
+	limit, ok := parseLimit(c)
+	if !ok {
+		return
+	}
+
+	var client models.OAuthClient
+	if !ctrl.loadClient(c, &client) {
+		return
+	}
+
+	var codes []models.OAuthAuthorizationCode
+	if err := database.ReadReplica(c).Where("client_id = ?", client.ID).Order("created_at DESC, id DESC").Limit(limit).Find(&codes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load grants"})
+		return
+	}
+
+	grants := make([]GrantSummary, 0, len(codes))
+	for _, g := range codes {
+		grants = append(grants, GrantSummary{
+			ID:          g.ID,
+			UserID:      g.UserID,
+			RedirectURI: g.RedirectURI,
+			Scope:       g.Scope,
+			Used:        g.Used,
+			ExpiresAt:   g.ExpiresAt,
+			CreatedAt:   g.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, grants)
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm/clause"
+)
+
+// Confidential clients authenticate at the token and device authorization
+// endpoints either with their client_secret or, without ever sending a
+// secret, with a JWT signed by one of their registered keys (private_key_jwt,
+// RFC 7523 section 2.2).
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// maxAssertionLifetime bounds how far ahead a client assertion may expire,
+// and so how long its jti has to be remembered
+const maxAssertionLifetime = 5 * time.Minute
+
+// clientAssertionMethods are the asymmetric algorithms accepted for client
+// assertions; HMAC would need the very secret the assertion replaces
+var clientAssertionMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// clientCredentials are the client authentication parameters of a request
+type clientCredentials struct {
+	ClientID            string `form:"client_id"`
+	ClientSecret        string `form:"client_secret"`
+	ClientAssertionType string `form:"client_assertion_type"`
+	ClientAssertion     string `form:"client_assertion"`
+}
+
+// clientAuthError explains why client authentication failed
+type clientAuthError struct {
+	description string
+}
+
+func (e *clientAuthError) Error() string { return e.description }
+
+// authenticateClient loads the client a token or device authorization
+// request authenticates as, writing a 401 invalid_client when it can't
+func (ctrl *OAuthController) authenticateClient(c *gin.Context, creds clientCredentials) (*models.OAuthClient, bool) {
+	audit.SetClient(c, creds.ClientID)
+
+	var client models.OAuthClient
+	var err error
+	switch {
+	case creds.ClientAssertionType != "" || creds.ClientAssertion != "":
+		err = ctrl.verifyClientAssertion(c, creds, &client)
+	case creds.ClientID != "" && creds.ClientSecret != "":
+		err = database.WithContext(c).Where("id = ? AND client_secret = ?", creds.ClientID, creds.ClientSecret).First(&client).Error
+	default:
+		err = &clientAuthError{"Client authentication is required"}
+	}
+
+	var ae *clientAuthError
+	if errors.As(err, &ae) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client", "error_description": ae.description})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return nil, false
+	}
+	audit.SetClient(c, client.ID)
+	return &client, true
+}
+
+// verifyClientAssertion checks a private_key_jwt assertion: issued by the
+// client about itself (iss = sub = client_id), addressed to this server,
+// signed with one of the client's keys, short-lived and not seen before
+func (ctrl *OAuthController) verifyClientAssertion(c *gin.Context, creds clientCredentials, client *models.OAuthClient) error {
+	if creds.ClientAssertionType != clientAssertionType {
+		return &clientAuthError{"Unsupported client_assertion_type"}
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(creds.ClientAssertion, &claims, func(token *jwt.Token) (interface{}, error) {
+		// The keys are those of the client the (not yet verified) claims name
+		claims := token.Claims.(*jwt.RegisteredClaims)
+		if claims.Issuer == "" || claims.Subject != claims.Issuer {
+			return nil, &clientAuthError{"iss and sub must both be the client_id"}
+		}
+		if creds.ClientID != "" && creds.ClientID != claims.Issuer {
+			return nil, &clientAuthError{"The assertion was issued by another client"}
+		}
+		if err := database.WithContext(c).Where("id = ?", claims.Issuer).First(client).Error; err != nil {
+			return nil, &clientAuthError{"Unknown client"}
+		}
+
+		var keys jwt.VerificationKeySet
+		for _, data := range client.PublicKeyList() {
+			key, err := utils.ParsePublicKey(data)
+			if err != nil {
+				continue
+			}
+			keys.Keys = append(keys.Keys, key)
+		}
+		if len(keys.Keys) == 0 {
+			return nil, &clientAuthError{"The client has no registered public keys"}
+		}
+		return keys, nil
+	}, jwt.WithValidMethods(clientAssertionMethods), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+	if err != nil {
+		var ae *clientAuthError
+		if errors.As(err, &ae) {
+			return ae
+		}
+		return &clientAuthError{"Invalid client assertion"}
+	}
+
+	if !ctrl.assertionAudienceValid(claims.Audience) {
+		return &clientAuthError{"The assertion's aud must be " + ctrl.config.OAuthIssuer + "/oauth/token"}
+	}
+	if claims.ID == "" {
+		return &clientAuthError{"The assertion has no jti"}
+	}
+	if time.Until(claims.ExpiresAt.Time) > maxAssertionLifetime {
+		return &clientAuthError{"The assertion must expire within 5 minutes"}
+	}
+
+	// The unique index on (client_id, jti) rejects a replayed assertion
+	assertion := models.OAuthClientAssertion{ClientID: client.ID, JTI: claims.ID, ExpiresAt: claims.ExpiresAt.Time}
+	result := database.WithContext(c).Clauses(clause.OnConflict{DoNothing: true}).Create(&assertion)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &clientAuthError{"The assertion was already used"}
+	}
+	database.WithContext(c).Where("client_id = ? AND expires_at < ?", client.ID, time.Now()).Delete(&models.OAuthClientAssertion{})
+	return nil
+}
+
+// assertionAudienceValid accepts the issuer itself or the endpoints client
+// assertions are sent to, as RFC 7523 section 3 allows
+func (ctrl *OAuthController) assertionAudienceValid(audience jwt.ClaimStrings) bool {
+	valid := map[string]bool{
+		ctrl.config.OAuthIssuer:                        true,
+		ctrl.config.OAuthIssuer + "/oauth/token":       true,
+		ctrl.config.OAuthIssuer + "/oauth/device/code": true,
+	}
+	for _, aud := range audience {
+		if valid[aud] {
+			return true
+		}
+	}
+	return false
+}
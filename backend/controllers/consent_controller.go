@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ConsentController lets users review the clients they authorized and
+// withdraw those authorizations
+type ConsentController struct {
+	config *config.Config
+}
+
+func NewConsentController(cfg *config.Config) *ConsentController {
+	return &ConsentController{config: cfg}
+}
+
+// ConsentResponse is an approval as its user sees it
+type ConsentResponse struct {
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scope      string    `json:"scope"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// LinkedEbayAccountResponse is an eBay account linked to the user, as eBay's
+// Identity API described it when it was linked
+type LinkedEbayAccountResponse struct {
+	Environment             string    `json:"environment"`
+	EbayUsername            string    `json:"ebay_username"`
+	AccountType             string    `json:"account_type"`
+	RegistrationMarketplace string    `json:"registration_marketplace"`
+	Marketplace             string    `json:"marketplace"`
+	LinkedAt                time.Time `json:"linked_at"`
+}
+
+// List returns the clients the logged-in user has approved and the eBay
+// accounts linked to them, so they can tell which account the clients act on
+// GET /api/auth/consents
+func (ctrl *ConsentController) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var consents []models.OAuthConsent
+	if err := database.WithContext(c).Where("user_id = ?", userID).Preload("Client").Order("updated_at DESC").Find(&consents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load consents"})
+		return
+	}
+
+	resp := make([]ConsentResponse, 0, len(consents))
+	for _, consent := range consents {
+		resp = append(resp, ConsentResponse{
+			ClientID:   consent.ClientID,
+			ClientName: consent.Client.Name,
+			Scope:      consent.Scope,
+			CreatedAt:  consent.CreatedAt,
+			UpdatedAt:  consent.UpdatedAt,
+		})
+	}
+
+	var credentials []models.EbayCredential
+	if err := database.WithContext(c).Where("user_id = ?", userID).Order("environment").Find(&credentials).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load eBay accounts"})
+		return
+	}
+	accounts := make([]LinkedEbayAccountResponse, 0, len(credentials))
+	for _, credential := range credentials {
+		accounts = append(accounts, LinkedEbayAccountResponse{
+			Environment:             credential.Environment,
+			EbayUsername:            credential.EbayUsername,
+			AccountType:             credential.EbayAccountType,
+			RegistrationMarketplace: credential.EbayRegistrationMarketplace,
+			Marketplace:             credential.Marketplace,
+			LinkedAt:                credential.UpdatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"consents": resp, "ebay_accounts": accounts})
+}
+
+// Withdraw forgets the user's approval of a client and revokes the tokens
+// and pending authorization codes the client holds for them
+// DELETE /api/auth/consents/:client_id
+func (ctrl *ConsentController) Withdraw(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	clientID := c.Param("client_id")
+
+	var withdrawn, revoked int64
+	err := database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		consent := tx.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&models.OAuthConsent{})
+		if consent.Error != nil {
+			return consent.Error
+		}
+		access := tx.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&models.OAuthAccessToken{})
+		if access.Error != nil {
+			return access.Error
+		}
+		refresh := tx.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&models.OAuthRefreshToken{})
+		if refresh.Error != nil {
+			return refresh.Error
+		}
+		codes := tx.Model(&models.OAuthAuthorizationCode{}).
+			Where("user_id = ? AND client_id = ? AND used = ?", userID, clientID, false).
+			Update("used", true)
+		if codes.Error != nil {
+			return codes.Error
+		}
+		withdrawn = consent.RowsAffected
+		revoked = access.RowsAffected + refresh.RowsAffected
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw consent"})
+		return
+	}
+	if withdrawn == 0 && revoked == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Consent not found"})
+		return
+	}
+
+	audit.Record(database.DB, c, "oauth.consent_withdrawn", "oauth_client", clientID, map[string]interface{}{
+		"revoked_tokens": revoked,
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "Consent withdrawn", "revoked_tokens": revoked})
+}
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Device authorization grant (RFC 8628) for CLIs and headless MCP
+// deployments: the device gets a device_code and a short user_code, the user
+// enters the user_code on the frontend's /device page, and the device polls
+// /oauth/token until the user has decided.
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+const (
+	deviceCodeTTL          = 10 * time.Minute
+	devicePollInterval     = 5 // seconds
+	deviceSlowDownIncrease = 5 // seconds added on each slow_down
+	userCodeLength         = 8 // characters, shown as XXXX-XXXX
+)
+
+// userCodeAlphabet avoids vowels (no accidental words) and look-alike
+// characters, as RFC 8628 section 6.1 suggests
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// generateUserCode returns a random code such as "WDJB-MJHT"
+func generateUserCode() (string, error) {
+	var b strings.Builder
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// normalizeUserCode accepts a user code in any case, with or without the dash
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// DeviceAuthorization starts a device authorization
+// POST /oauth/device/code (client credentials, scope)
+func (ctrl *OAuthController) DeviceAuthorization(c *gin.Context) {
+	var req struct {
+		clientCredentials
+		Scope string `form:"scope"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+
+	client, ok := ctrl.authenticateClient(c, req.clientCredentials)
+	if !ok {
+		return
+	}
+
+	scope, _, err := resolveScope(c, client, req.Scope)
+	if err != nil {
+		writeScopeError(c, err)
+		return
+	}
+
+	deviceCode, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	record := models.OAuthDeviceCode{
+		DeviceCode: deviceCode,
+		UserCode:   userCode,
+		ClientID:   client.ID,
+		Scope:      scope,
+		Status:     models.DeviceCodePending,
+		Interval:   devicePollInterval,
+		ExpiresAt:  time.Now().Add(deviceCodeTTL),
+	}
+	if err := database.WithContext(c).Create(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	audit.AddDetail(c, "scope", scope)
+	verificationURI := ctrl.config.FrontendURL + "/device"
+	c.JSON(http.StatusOK, gin.H{
+		"device_code":               deviceCode,
+		"user_code":                 userCode,
+		"verification_uri":          verificationURI,
+		"verification_uri_complete": verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		"expires_in":                int(deviceCodeTTL.Seconds()),
+		"interval":                  devicePollInterval,
+	})
+}
+
+// loadPendingDeviceCode finds an undecided, unexpired device authorization
+// by its user code, writing a 404 when there is none
+func loadPendingDeviceCode(c *gin.Context, userCode string, record *models.OAuthDeviceCode) bool {
+	err := database.WithContext(c).Preload("Client").
+		Where("user_code = ? AND status = ? AND expires_at > ?", normalizeUserCode(userCode), models.DeviceCodePending, time.Now()).
+		First(record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown or expired code"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load code"})
+		return false
+	}
+	return true
+}
+
+// DeviceLookup returns what the user is asked to approve for a user code
+// GET /oauth/device?user_code=xxx
+func (ctrl *OAuthController) DeviceLookup(c *gin.Context) {
+	var record models.OAuthDeviceCode
+	if !loadPendingDeviceCode(c, c.Query("user_code"), &record) {
+		return
+	}
+
+	_, scopes, err := resolveScope(c, &record.Client, record.Scope)
+	if err != nil {
+		writeScopeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user_code":   record.UserCode,
+		"client_id":   record.ClientID,
+		"client_name": record.Client.Name,
+		"scope":       record.Scope,
+		"scopes":      scopes,
+		"expires_at":  record.ExpiresAt,
+	})
+}
+
+// DeviceConsent records the user's decision on a device authorization
+// POST /oauth/device/consent
+func (ctrl *OAuthController) DeviceConsent(c *gin.Context) {
+	var req struct {
+		UserCode string `json:"user_code" binding:"required"`
+		Approved bool   `json:"approved"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.MustGet("user_id").(uint)
+
+	var record models.OAuthDeviceCode
+	if !loadPendingDeviceCode(c, req.UserCode, &record) {
+		return
+	}
+	audit.SetClient(c, record.ClientID)
+	audit.AddDetail(c, "scope", record.Scope)
+
+	status := models.DeviceCodeDenied
+	if req.Approved {
+		_, scopes, err := resolveScope(c, &record.Client, record.Scope)
+		if err != nil {
+			writeScopeError(c, err)
+			return
+		}
+		if !requireTwoFactorForScopes(c, scopes) {
+			return
+		}
+		status = models.DeviceCodeApproved
+	}
+	// Only the first decision counts
+	result := database.WithContext(c).Model(&record).Where("status = ?", models.DeviceCodePending).
+		Updates(map[string]interface{}{"status": status, "user_id": userID})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save decision"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The code was already used"})
+		return
+	}
+
+	if !req.Approved {
+		audit.SetAction(c, "oauth.device_denied")
+		c.JSON(http.StatusOK, gin.H{"status": status})
+		return
+	}
+	if err := saveConsent(c, userID, record.ClientID, record.Scope); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save consent"})
+		return
+	}
+	audit.SetAction(c, "oauth.device_approved")
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
+
+// handleDeviceCodeGrant answers a device's poll: authorization_pending until
+// the user decides, slow_down when polled faster than the interval, then
+// tokens or access_denied
+func (ctrl *OAuthController) handleDeviceCodeGrant(c *gin.Context, deviceCode, clientID string) {
+	var record models.OAuthDeviceCode
+	if err := database.WithContext(c).Where("device_code = ? AND client_id = ? AND used = ?", deviceCode, clientID, false).
+		First(&record).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	if now.After(record.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expired_token"})
+		return
+	}
+	if record.LastPolledAt != nil && now.Sub(*record.LastPolledAt) < time.Duration(record.Interval)*time.Second {
+		database.WithContext(c).Model(&record).Updates(map[string]interface{}{
+			"interval":       record.Interval + deviceSlowDownIncrease,
+			"last_polled_at": now,
+		})
+		audit.Skip(c)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slow_down", "interval": record.Interval + deviceSlowDownIncrease})
+		return
+	}
+	database.WithContext(c).Model(&record).Update("last_polled_at", now)
+
+	switch record.Status {
+	case models.DeviceCodePending:
+		audit.Skip(c)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "authorization_pending"})
+		return
+	case models.DeviceCodeDenied:
+		database.WithContext(c).Model(&record).Update("used", true)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "access_denied"})
+		return
+	}
+
+	// Tokens are issued once, even if the device polls twice at once
+	result := database.WithContext(c).Model(&record).Where("used = ?", false).Update("used", true)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	if result.RowsAffected == 0 || record.UserID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+
+	audit.SetActor(c, *record.UserID)
+	ctrl.issueTokenPair(c, clientID, *record.UserID, record.Scope, "")
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/internal/telemetry"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds the checks of one readiness probe
+const readinessTimeout = 5 * time.Second
+
+// HealthController answers liveness and readiness probes
+type HealthController struct {
+	config *config.Config
+}
+
+func NewHealthController(cfg *config.Config) *HealthController {
+	return &HealthController{config: cfg}
+}
+
+// DependencyStatus is the outcome of one readiness check
+type DependencyStatus struct {
+	Status    string  `json:"status"` // ok or down
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Metrics exposes the database metrics in the Prometheus text format
+// GET /metrics
+func (ctrl *HealthController) Metrics(c *gin.Context) {
+	telemetry.Serve(c.Writer, database.WritePrometheus)
+}
+
+// Liveness reports that the process serves requests
+// GET /healthz
+func (ctrl *HealthController) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness checks the primary database, a replica if configured and that
+// no migration is pending, and answers 503 while any check fails
+// GET /readyz
+func (ctrl *HealthController) Readiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]DependencyStatus{
+		"database": timedCheck(func() error { return database.Ping(ctx) }),
+	}
+	replicas := false
+	replicaStatus := timedCheck(func() error {
+		var err error
+		replicas, err = database.PingReplica(ctx)
+		return err
+	})
+	if replicas {
+		checks["database_replica"] = replicaStatus
+	}
+	checks["migrations"] = timedCheck(func() error {
+		pending, err := database.PendingMigrations()
+		if err == nil && len(pending) > 0 {
+			return fmt.Errorf("pending: %s", strings.Join(pending, ", "))
+		}
+		return err
+	})
+
+	status, code := "ok", http.StatusOK
+	for _, check := range checks {
+		if check.Status != "ok" {
+			status, code = "down", http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(code, gin.H{
+		"status":     status,
+		"checked_at": time.Now().UTC(),
+		"checks":     checks,
+	})
+}
+
+// timedCheck runs check and records how long it took
+func timedCheck(check func() error) DependencyStatus {
+	start := time.Now()
+	err := check()
+	s := DependencyStatus{Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		s.Status, s.Error = "down", err.Error()
+	}
+	return s
+}
@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InternalController serves the proxy over the signed internal API (see
+// middleware.InternalAuth)
+type InternalController struct {
+	config *config.Config
+}
+
+func NewInternalController(cfg *config.Config) *InternalController {
+	return &InternalController{config: cfg}
+}
+
+// GetPolicy returns a stored proxy policy for the proxy to enforce
+// GET /internal/policies/:name
+func (ctrl *InternalController) GetPolicy(c *gin.Context) {
+	var policy models.ProxyPolicy
+	err := database.WithContext(c).Where("name = ?", c.Param("name")).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// IntrospectToken tells the proxy whether an access token issued by the
+// OAuth server is active, for which user and client, and for which
+// resource ("aud", empty for any). Unknown, expired
+// and revoked tokens, tokens of deleted clients and of disabled users are
+// inactive.
+// POST /internal/tokens/introspect
+func (ctrl *InternalController) IntrospectToken(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var accessToken models.OAuthAccessToken
+	err := database.WithContext(c).Preload("Client").Preload("User").
+		Where("token = ? AND expires_at > ?", req.Token, time.Now()).
+		First(&accessToken).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load token"})
+		return
+	}
+	// A deleted client loads empty
+	if err != nil || accessToken.Client.ID == "" || (accessToken.UserID != nil && accessToken.User.IsDisabled()) {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"active":     true,
+		"user_id":    accessToken.UserID,
+		"client_id":  accessToken.ClientID,
+		"scope":      accessToken.Scope,
+		"aud":        accessToken.Resource,
+		"expires_at": accessToken.ExpiresAt,
+	})
+}
+
+// EbayCredentialRequest is a linked eBay account as the proxy stores it
+type EbayCredentialRequest struct {
+	RefreshToken                string   `json:"refresh_token" binding:"required"`
+	Scopes                      []string `json:"scopes"`
+	Marketplace                 string   `json:"marketplace"`
+	Language                    string   `json:"language"`
+	EbayUserID                  string   `json:"ebay_user_id"`
+	EbayUsername                string   `json:"ebay_username"`
+	EbayAccountType             string   `json:"ebay_account_type"`
+	EbayRegistrationMarketplace string   `json:"ebay_registration_marketplace"`
+}
+
+// GetEbayCredential returns a user's linked eBay account in an environment,
+// with the refresh token the proxy mints access tokens from
+// GET /internal/users/:id/ebay-credentials/:environment
+func (ctrl *InternalController) GetEbayCredential(c *gin.Context) {
+	var credential models.EbayCredential
+	err := database.WithContext(c).Where("user_id = ? AND environment = ?", c.Param("id"), c.Param("environment")).
+		First(&credential).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No linked eBay account"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load eBay account"})
+		return
+	}
+	refreshToken, err := utils.DecryptSecret(ctrl.config.CredentialKey, credential.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt eBay account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"environment":                   credential.Environment,
+		"refresh_token":                 refreshToken,
+		"scopes":                        strings.Fields(credential.Scopes),
+		"marketplace":                   credential.Marketplace,
+		"language":                      credential.Language,
+		"ebay_user_id":                  credential.EbayUserID,
+		"ebay_username":                 credential.EbayUsername,
+		"ebay_account_type":             credential.EbayAccountType,
+		"ebay_registration_marketplace": credential.EbayRegistrationMarketplace,
+		"created_at":                    credential.CreatedAt,
+	})
+}
+
+// PutEbayCredential links an eBay account to a user, replacing the one
+// linked in the same environment
+// PUT /internal/users/:id/ebay-credentials/:environment
+func (ctrl *InternalController) PutEbayCredential(c *gin.Context) {
+	var req EbayCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.WithContext(c).First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	sealed, err := utils.EncryptSecret(ctrl.config.CredentialKey, req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt eBay account"})
+		return
+	}
+
+	credential := models.EbayCredential{
+		UserID:                      user.ID,
+		Environment:                 c.Param("environment"),
+		RefreshToken:                sealed,
+		Scopes:                      strings.Join(req.Scopes, " "),
+		Marketplace:                 req.Marketplace,
+		Language:                    req.Language,
+		EbayUserID:                  req.EbayUserID,
+		EbayUsername:                req.EbayUsername,
+		EbayAccountType:             req.EbayAccountType,
+		EbayRegistrationMarketplace: req.EbayRegistrationMarketplace,
+	}
+	err = database.WithContext(c).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "environment"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"refresh_token", "scopes", "marketplace", "language", "ebay_user_id", "ebay_username",
+			"ebay_account_type", "ebay_registration_marketplace", "updated_at",
+		}),
+	}).Create(&credential).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save eBay account"})
+		return
+	}
+
+	audit.Record(database.DB, c, "ebay.linked", "user", strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+		"environment":  credential.Environment,
+		"ebay_user_id": credential.EbayUserID,
+	})
+	c.JSON(http.StatusOK, gin.H{"environment": credential.Environment, "user_id": user.ID})
+}
+
+// DeleteEbayAccount removes every linked account of an eBay user, matched
+// by ebay_user_id or ebay_username, when eBay reports the account deleted
+// DELETE /internal/ebay-credentials?ebay_user_id=...&ebay_username=...
+func (ctrl *InternalController) DeleteEbayAccount(c *gin.Context) {
+	ebayUserID, username := c.Query("ebay_user_id"), c.Query("ebay_username")
+	if ebayUserID == "" && username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ebay_user_id or ebay_username is required"})
+		return
+	}
+
+	db := database.WithContext(c)
+	if ebayUserID != "" {
+		db = db.Where("ebay_user_id = ?", ebayUserID)
+		if username != "" {
+			db = db.Or("ebay_username = ?", username)
+		}
+	} else {
+		db = db.Where("ebay_username = ?", username)
+	}
+	result := db.Delete(&models.EbayCredential{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete eBay accounts"})
+		return
+	}
+
+	audit.Record(database.DB, c, "ebay.account_deleted", "ebay_user", ebayUserID, map[string]interface{}{
+		"deleted": result.RowsAffected,
+	})
+	c.JSON(http.StatusOK, gin.H{"deleted": result.RowsAffected})
+}
+
+// UsageReport is a batch of call counts from the proxy
+type UsageReport struct {
+	Records []struct {
+		UserID    uint   `json:"user_id"`
+		ClientID  string `json:"client_id" binding:"required"`
+		Day       string `json:"day" binding:"required"` // 2006-01-02, UTC
+		Operation string `json:"operation" binding:"required"`
+		Calls     int64  `json:"calls" binding:"min=0"`
+		Errors    int64  `json:"errors" binding:"min=0"`
+	} `json:"records" binding:"dive"`
+}
+
+// RecordUsage adds the proxy's call counts to the usage records
+// POST /internal/usage
+func (ctrl *InternalController) RecordUsage(c *gin.Context) {
+	var req UsageReport
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	records := make([]models.UsageRecord, 0, len(req.Records))
+	for _, r := range req.Records {
+		day, err := time.Parse("2006-01-02", r.Day)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid day: " + r.Day})
+			return
+		}
+		records = append(records, models.UsageRecord{
+			UserID:    r.UserID,
+			ClientID:  r.ClientID,
+			Day:       day,
+			Operation: r.Operation,
+			Calls:     r.Calls,
+			Errors:    r.Errors,
+		})
+	}
+
+	// Add to existing counts, so the proxy can report as often as it likes
+	err := database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		for i := range records {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "user_id"}, {Name: "client_id"}, {Name: "day"}, {Name: "operation"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"calls":      gorm.Expr("usage_records.calls + " + database.Excluded("calls")),
+					"errors":     gorm.Expr("usage_records.errors + " + database.Excluded("errors")),
+					"updated_at": time.Now(),
+				}),
+			}).Create(&records[i]).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recorded": len(records)})
+}
+
+// GetSpend returns what an account spent on a day in a currency, in cents
+// GET /internal/spend?account=...&day=2006-01-02&currency=USD
+func (ctrl *InternalController) GetSpend(c *gin.Context) {
+	account, day, currency := c.Query("account"), c.Query("day"), c.Query("currency")
+	if account == "" || currency == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account and currency are required"})
+		return
+	}
+	if _, err := time.Parse("2006-01-02", day); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid day: " + day})
+		return
+	}
+
+	var record models.SpendRecord
+	err := database.WithContext(c).Where("account = ? AND day = ? AND currency = ?", account, day, currency).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read spend"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"spent": record.Cents})
+}
+
+// SpendRequest reserves an amount against a daily limit, or releases one
+// when Amount is negative
+type SpendRequest struct {
+	Account  string `json:"account" binding:"required"`
+	Day      string `json:"day" binding:"required"` // 2006-01-02, UTC
+	Currency string `json:"currency" binding:"required,len=3"`
+	Amount   int64  `json:"amount"` // cents
+	Limit    int64  `json:"limit" binding:"min=0"`
+}
+
+// RecordSpend adds an amount to what an account spent on a day unless the
+// total would exceed the limit, and returns the new total. Reservations
+// from several proxy replicas can't both pass the limit, since the check
+// and the update are one statement.
+// POST /internal/spend
+func (ctrl *InternalController) RecordSpend(c *gin.Context) {
+	var req SpendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := time.Parse("2006-01-02", req.Day); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid day: " + req.Day})
+		return
+	}
+
+	reserved := true
+	var record models.SpendRecord
+	err := database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.SpendRecord{
+			Account:  req.Account,
+			Day:      req.Day,
+			Currency: req.Currency,
+		}).Error
+		if err != nil {
+			return err
+		}
+		match := tx.Model(&models.SpendRecord{}).Where("account = ? AND day = ? AND currency = ?", req.Account, req.Day, req.Currency)
+		var result *gorm.DB
+		if req.Amount >= 0 {
+			result = match.Where("cents + ? <= ?", req.Amount, req.Limit).Updates(map[string]interface{}{
+				"cents":      gorm.Expr("cents + ?", req.Amount),
+				"updated_at": time.Now(),
+			})
+		} else {
+			result = match.Updates(map[string]interface{}{
+				"cents":      gorm.Expr("CASE WHEN cents > ? THEN cents - ? ELSE 0 END", -req.Amount, -req.Amount),
+				"updated_at": time.Now(),
+			})
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		reserved = result.RowsAffected > 0
+		return tx.Where("account = ? AND day = ? AND currency = ?", req.Account, req.Day, req.Currency).First(&record).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record spend"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"spent": record.Cents, "reserved": reserved})
+}
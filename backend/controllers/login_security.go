@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Password sign-in is guarded twice: an account is locked for
+// LOGIN_LOCKOUT_DURATION after LOGIN_MAX_FAILURES wrong passwords, and an IP
+// with LOGIN_IP_MAX_FAILURES failed sign-ins (any account, known or not)
+// within LOGIN_IP_WINDOW is throttled. Locked accounts get the same answer as
+// wrong passwords, so the lock doesn't reveal which accounts exist. A passkey
+// sign-in or an admin lifts the lock early.
+
+// ipThrottled reports whether c's IP has too many recent failed sign-ins
+// and, if so, how long until the oldest of them leaves the window
+func (ctrl *AuthController) ipThrottled(c *gin.Context) (bool, time.Duration) {
+	cfg := ctrl.config.Login
+	if cfg.IPMaxFailures == 0 {
+		return false, 0
+	}
+	var failures []models.LoginFailure
+	err := database.WithContext(c).Where("ip = ? AND created_at > ?", c.ClientIP(), time.Now().Add(-cfg.IPWindow)).
+		Order("created_at DESC").Limit(cfg.IPMaxFailures).Find(&failures).Error
+	if err != nil || len(failures) < cfg.IPMaxFailures {
+		return false, 0
+	}
+	oldest := failures[len(failures)-1].CreatedAt
+	return true, time.Until(oldest.Add(cfg.IPWindow))
+}
+
+// recordLoginFailure counts a failed sign-in against c's IP and, for a wrong
+// password, against the account, locking it once it reaches the limit
+func (ctrl *AuthController) recordLoginFailure(c *gin.Context, user *models.User) {
+	cfg := ctrl.config.Login
+	now := time.Now()
+
+	if cfg.IPMaxFailures > 0 {
+		db := database.WithContext(c)
+		if err := db.Create(&models.LoginFailure{IP: c.ClientIP()}).Error; err != nil {
+			log.Printf("Failed to record failed sign-in: %v", err)
+		}
+		db.Where("created_at < ?", now.Add(-cfg.IPWindow)).Delete(&models.LoginFailure{})
+	}
+
+	if user == nil || cfg.MaxFailures == 0 {
+		return
+	}
+	// Count in the database so concurrent guesses can't slip past the limit
+	db := database.WithContext(c)
+	if err := db.Model(user).Update("failed_logins", gorm.Expr("failed_logins + 1")).Error; err != nil {
+		log.Printf("Failed to count failed sign-in of user %d: %v", user.ID, err)
+		return
+	}
+	until := now.Add(cfg.LockoutDuration)
+	lock := db.Model(user).Where("failed_logins >= ?", cfg.MaxFailures).
+		Updates(map[string]interface{}{"failed_logins": 0, "locked_until": until})
+	if lock.Error == nil && lock.RowsAffected > 0 {
+		audit.Record(database.DB, c, "user.locked", "user", strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+			"locked_until": until,
+		})
+	}
+}
+
+// clearLoginFailures forgets the account's wrong passwords and lifts its lock
+func clearLoginFailures(db *gorm.DB, user *models.User) error {
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	if err := db.Model(user).Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil}).Error; err != nil {
+		return err
+	}
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	return nil
+}
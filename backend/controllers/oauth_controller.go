@@ -1,17 +1,22 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
-	"ebay-mcp/backend/config"
-	"ebay-mcp/backend/database"
-	"ebay-mcp/backend/models"
-	"ebay-mcp/backend/utils"
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type OAuthController struct {
@@ -24,43 +29,44 @@ func NewOAuthController(cfg *config.Config) *OAuthController {
 
 // Authorize handles the OAuth authorization endpoint
 // GET /oauth/authorize?client_id=xxx&redirect_uri=xxx&response_type=code&scope=xxx&state=xxx
+// [&code_challenge=xxx&code_challenge_method=S256][&resource=xxx]
 func (ctrl *OAuthController) Authorize(c *gin.Context) {
 	clientID := c.Query("client_id")
 	redirectURI := c.Query("redirect_uri")
 	responseType := c.Query("response_type")
 	scope := c.Query("scope")
 	state := c.Query("state")
+	binding := codeBinding{
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: c.Query("code_challenge_method"),
+		Resource:            c.Query("resource"),
+	}
 
 	// Validate required parameters
 	if clientID == "" || redirectURI == "" || responseType != "code" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
 		return
 	}
+	if !binding.validate(c) {
+		return
+	}
 
 	// Verify client exists
 	var client models.OAuthClient
-	if err := database.DB.Where("id = ?", clientID).First(&client).Error; err != nil {
+	if err := database.WithContext(c).Where("id = ?", clientID).First(&client).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client_id"})
 		return
 	}
 
 	// Verify redirect_uri is registered for this client
-	var redirectURIs []string
-	if err := json.Unmarshal([]byte(client.RedirectURIs), &redirectURIs); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid client configuration"})
+	if !checkRedirectURI(c, &client, redirectURI) {
 		return
 	}
 
-	validRedirectURI := false
-	for _, uri := range redirectURIs {
-		if uri == redirectURI {
-			validRedirectURI = true
-			break
-		}
-	}
-
-	if !validRedirectURI {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid redirect_uri"})
+	// Reject unknown scopes and drop those the client may not request
+	grantedScope, scopes, err := resolveScope(c, &client, scope)
+	if err != nil {
+		writeScopeError(c, err)
 		return
 	}
 
@@ -77,14 +83,49 @@ func (ctrl *OAuthController) Authorize(c *gin.Context) {
 		return
 	}
 
-	// Return consent screen data
+	// Trusted clients and scopes the user already approved skip the consent screen
+	consented := client.Trusted
+	if !consented {
+		var consent models.OAuthConsent
+		if err := database.WithContext(c).Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error; err == nil {
+			consented = consent.Covers(grantedScope)
+		}
+	}
+	// Except under impersonation: this GET must not mint codes for a
+	// read-only session, so the admin goes through the (POST) consent step
+	if _, impersonated := c.Get("impersonation_id"); consented && !impersonated {
+		// Skipping the consent screen must not skip the second factor
+		// that granting write scopes asks for there
+		if !requireTwoFactorForScopes(c, scopes) {
+			return
+		}
+		redirectURL, err := issueAuthorizationCode(c, userID.(uint), clientID, redirectURI, grantedScope, state, binding)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create authorization code"})
+			return
+		}
+		audit.Record(database.DB, c, "oauth.consent_skipped", "oauth_client", clientID, map[string]interface{}{
+			"scope":   grantedScope,
+			"trusted": client.Trusted,
+		})
+		c.JSON(http.StatusOK, gin.H{
+			"redirect_url":  redirectURL,
+			"auto_approved": true,
+		})
+		return
+	}
+
+	// Return consent screen data. scope may be narrower than requested_scope.
 	c.JSON(http.StatusOK, gin.H{
-		"client_id":    clientID,
-		"client_name":  client.Name,
-		"redirect_uri": redirectURI,
-		"scope":        scope,
-		"state":        state,
-		"user_id":      userID,
+		"client_id":       clientID,
+		"client_name":     client.Name,
+		"redirect_uri":    redirectURI,
+		"scope":           grantedScope,
+		"scopes":          scopes,
+		"requested_scope": scope,
+		"state":           state,
+		"resource":        binding.Resource,
+		"user_id":         userID,
 	})
 }
 
@@ -92,6 +133,7 @@ func (ctrl *OAuthController) Authorize(c *gin.Context) {
 // POST /oauth/authorize/consent
 func (ctrl *OAuthController) AuthorizeConsent(c *gin.Context) {
 	var req struct {
+		codeBinding
 		ClientID    string `json:"client_id" binding:"required"`
 		RedirectURI string `json:"redirect_uri" binding:"required"`
 		Scope       string `json:"scope"`
@@ -104,6 +146,10 @@ func (ctrl *OAuthController) AuthorizeConsent(c *gin.Context) {
 		return
 	}
 
+	if !req.codeBinding.validate(c) {
+		return
+	}
+
 	// Get authenticated user
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -111,58 +157,174 @@ func (ctrl *OAuthController) AuthorizeConsent(c *gin.Context) {
 		return
 	}
 
+	audit.SetClient(c, req.ClientID)
+	audit.AddDetail(c, "scope", req.Scope)
+
+	// Both answers redirect, so only to a URI registered for the client
+	var client models.OAuthClient
+	if err := database.WithContext(c).Where("id = ?", req.ClientID).First(&client).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client_id"})
+		return
+	}
+	if !checkRedirectURI(c, &client, req.RedirectURI) {
+		return
+	}
+
 	// Check if user denied
 	if !req.Approved {
+		audit.SetAction(c, "oauth.consent_denied")
+		query := url.Values{"error": {"access_denied"}}
+		if req.State != "" {
+			query.Set("state", req.State)
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"redirect_url": req.RedirectURI + "?error=access_denied&state=" + req.State,
+			"redirect_url": redirectWithQuery(req.RedirectURI, query),
 		})
 		return
 	}
 
-	// Generate authorization code
-	code, err := utils.GenerateRandomToken(32)
+	// The user may approve fewer scopes than were requested, but only
+	// registered ones the client may have
+	scope, infos, err := resolveScope(c, &client, req.Scope)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate code"})
+		writeScopeError(c, err)
+		return
+	}
+	if !requireTwoFactorForScopes(c, infos) {
 		return
 	}
 
-	// Save authorization code to database
+	// Remember the approval so the same scopes don't need consent again
+	if err := saveConsent(c, userID.(uint), req.ClientID, scope); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save consent"})
+		return
+	}
+
+	redirectURL, err := issueAuthorizationCode(c, userID.(uint), req.ClientID, req.RedirectURI, scope, req.State, req.codeBinding)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create authorization code"})
+		return
+	}
+
+	audit.SetAction(c, "oauth.consent_granted")
+	c.JSON(http.StatusOK, gin.H{
+		"redirect_url": redirectURL,
+	})
+}
+
+// issueAuthorizationCode stores a new authorization code bound to binding
+// and returns the redirect URL that hands it to the client
+func issueAuthorizationCode(ctx context.Context, userID uint, clientID, redirectURI, scope, state string, binding codeBinding) (string, error) {
+	code, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
 	authCode := models.OAuthAuthorizationCode{
 		Code:        code,
-		ClientID:    req.ClientID,
-		UserID:      userID.(uint),
-		RedirectURI: req.RedirectURI,
-		Scope:       req.Scope,
+		ClientID:    clientID,
+		UserID:      userID,
+		RedirectURI: redirectURI,
+		Scope:       scope,
 		ExpiresAt:   time.Now().Add(10 * time.Minute), // Code valid for 10 minutes
 		Used:        false,
+
+		CodeChallenge:       binding.CodeChallenge,
+		CodeChallengeMethod: binding.CodeChallengeMethod,
+		Resource:            binding.Resource,
+	}
+	if err := database.WithContext(ctx).Create(&authCode).Error; err != nil {
+		return "", err
 	}
 
-	if err := database.DB.Create(&authCode).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create authorization code"})
-		return
+	query := url.Values{"code": {code}}
+	if state != "" {
+		query.Set("state", state)
+	}
+	return redirectWithQuery(redirectURI, query), nil
+}
+
+// checkRedirectURI reports whether redirectURI is registered for the
+// client, answering the request when it isn't
+func checkRedirectURI(c *gin.Context, client *models.OAuthClient, redirectURI string) bool {
+	var redirectURIs []string
+	if err := json.Unmarshal([]byte(client.RedirectURIs), &redirectURIs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid client configuration"})
+		return false
+	}
+	for _, uri := range redirectURIs {
+		if uri == redirectURI {
+			return true
+		}
 	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid redirect_uri"})
+	return false
+}
 
-	// Build redirect URL with code
-	redirectURL := req.RedirectURI + "?code=" + code
-	if req.State != "" {
-		redirectURL += "&state=" + req.State
+// redirectWithQuery adds query to redirectURI, escaping the values and
+// keeping any query the registered URI already has
+func redirectWithQuery(redirectURI string, query url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI + "?" + query.Encode()
 	}
+	merged := u.Query()
+	for key, values := range query {
+		merged[key] = values
+	}
+	u.RawQuery = merged.Encode()
+	return u.String()
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"redirect_url": redirectURL,
-	})
+// consentAttempts bounds how often saveConsent retries after losing a race
+const consentAttempts = 3
+
+// saveConsent adds scope to the scopes the user approved for the client.
+// When another request changed or created the consent in the meantime it
+// reloads it and merges again, so no approval is lost.
+func saveConsent(ctx context.Context, userID uint, clientID, scope string) error {
+	var err error
+	for attempt := 0; attempt < consentAttempts; attempt++ {
+		var consent models.OAuthConsent
+		err = database.WithContext(ctx).Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			consent = models.OAuthConsent{UserID: userID, ClientID: clientID}
+			consent.Grant(scope)
+			// Fails on the unique index if another request created it first
+			if err = database.WithContext(ctx).Create(&consent).Error; err == nil {
+				return nil
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if consent.Covers(scope) {
+			return nil
+		}
+
+		consent.Grant(scope)
+		err = database.Versioned(database.WithContext(ctx).Model(&consent).Update("scope", consent.Scope))
+		if !errors.Is(err, database.ErrConflict) {
+			return err
+		}
+	}
+	return err
 }
 
 // Token handles the OAuth token endpoint
 // POST /oauth/token
 func (ctrl *OAuthController) Token(c *gin.Context) {
 	var req struct {
+		clientCredentials
 		GrantType    string `form:"grant_type" binding:"required"`
 		Code         string `form:"code"`
 		RedirectURI  string `form:"redirect_uri"`
-		ClientID     string `form:"client_id" binding:"required"`
-		ClientSecret string `form:"client_secret" binding:"required"`
 		RefreshToken string `form:"refresh_token"`
+		Scope        string `form:"scope"`
+		DeviceCode   string `form:"device_code"`
+		CodeVerifier string `form:"code_verifier"`
+		Resource     string `form:"resource"`
 	}
 
 	if err := c.ShouldBind(&req); err != nil {
@@ -170,35 +332,65 @@ func (ctrl *OAuthController) Token(c *gin.Context) {
 		return
 	}
 
+	audit.AddDetail(c, "grant_type", req.GrantType)
+
 	// Verify client credentials
-	var client models.OAuthClient
-	if err := database.DB.Where("id = ? AND client_secret = ?", req.ClientID, req.ClientSecret).First(&client).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+	client, ok := ctrl.authenticateClient(c, req.clientCredentials)
+	if !ok {
 		return
 	}
 
 	switch req.GrantType {
 	case "authorization_code":
-		ctrl.handleAuthorizationCodeGrant(c, req.Code, req.RedirectURI, req.ClientID)
+		ctrl.handleAuthorizationCodeGrant(c, req.Code, req.RedirectURI, client.ID, req.CodeVerifier, req.Resource)
 	case "refresh_token":
-		ctrl.handleRefreshTokenGrant(c, req.RefreshToken, req.ClientID)
+		ctrl.handleRefreshTokenGrant(c, req.RefreshToken, client.ID, req.Scope, req.Resource)
+	case deviceCodeGrantType:
+		ctrl.handleDeviceCodeGrant(c, req.DeviceCode, client.ID)
+	case "client_credentials":
+		ctrl.handleClientCredentialsGrant(c, client, req.Scope, req.Resource)
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
 	}
 }
 
-func (ctrl *OAuthController) handleAuthorizationCodeGrant(c *gin.Context, code, redirectURI, clientID string) {
+func (ctrl *OAuthController) handleAuthorizationCodeGrant(c *gin.Context, code, redirectURI, clientID, verifier, resource string) {
 	// Find and validate authorization code
 	var authCode models.OAuthAuthorizationCode
-	if err := database.DB.Where("code = ? AND client_id = ? AND redirect_uri = ? AND used = ? AND expires_at > ?",
+	if err := database.WithContext(c).Where("code = ? AND client_id = ? AND redirect_uri = ? AND used = ? AND expires_at > ?",
 		code, clientID, redirectURI, false, time.Now()).First(&authCode).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
 		return
 	}
 
-	// Mark code as used
-	database.DB.Model(&authCode).Update("used", true)
+	audit.SetActor(c, authCode.UserID)
+
+	if !verifyCodeVerifier(&authCode, verifier) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant", "error_description": "code_verifier doesn't match the code_challenge"})
+		return
+	}
+	resource, ok := tokenResource(c, authCode.Resource, resource)
+	if !ok {
+		return
+	}
+
+	// Mark code as used. Of two concurrent exchanges of the same code, the
+	// version check lets only the first one through.
+	if err := database.Versioned(database.WithContext(c).Model(&authCode).Update("used", true)); err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		}
+		return
+	}
 
+	ctrl.issueTokenPair(c, clientID, authCode.UserID, authCode.Scope, resource)
+}
+
+// issueTokenPair answers a successful grant with a new access and refresh
+// token for resource ("" for any)
+func (ctrl *OAuthController) issueTokenPair(c *gin.Context, clientID string, userID uint, scope, resource string) {
 	// Generate access token
 	accessToken, err := utils.GenerateRandomToken(32)
 	if err != nil {
@@ -217,47 +409,76 @@ func (ctrl *OAuthController) handleAuthorizationCodeGrant(c *gin.Context, code,
 	accessTokenModel := models.OAuthAccessToken{
 		Token:     accessToken,
 		ClientID:  clientID,
-		UserID:    authCode.UserID,
-		Scope:     authCode.Scope,
+		UserID:    &userID,
+		Scope:     scope,
+		Resource:  resource,
 		ExpiresAt: time.Now().Add(1 * time.Hour),
 	}
 
 	refreshTokenModel := models.OAuthRefreshToken{
 		Token:     refreshToken,
 		ClientID:  clientID,
-		UserID:    authCode.UserID,
-		Scope:     authCode.Scope,
+		UserID:    userID,
+		Scope:     scope,
+		Resource:  resource,
 		ExpiresAt: time.Now().Add(30 * 24 * time.Hour), // 30 days
 	}
 
-	if err := database.DB.Create(&accessTokenModel).Error; err != nil {
+	if err := database.WithContext(c).Create(&accessTokenModel).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 		return
 	}
 
-	if err := database.DB.Create(&refreshTokenModel).Error; err != nil {
+	if err := database.WithContext(c).Create(&refreshTokenModel).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 		return
 	}
 
+	audit.SetAction(c, "oauth.token_issued")
 	c.JSON(http.StatusOK, gin.H{
 		"access_token":  accessToken,
 		"token_type":    "Bearer",
 		"expires_in":    3600,
 		"refresh_token": refreshToken,
-		"scope":         authCode.Scope,
+		"scope":         scope,
 	})
 }
 
-func (ctrl *OAuthController) handleRefreshTokenGrant(c *gin.Context, refreshToken, clientID string) {
+// handleRefreshTokenGrant issues a new access token for a refresh token. A
+// scope narrower than the refresh token's may be requested (RFC 6749
+// section 6); the refresh token keeps its scope. The access token is for
+// the refresh token's resource.
+func (ctrl *OAuthController) handleRefreshTokenGrant(c *gin.Context, refreshToken, clientID, scope, resource string) {
 	// Find and validate refresh token
 	var refreshTokenModel models.OAuthRefreshToken
-	if err := database.DB.Where("token = ? AND client_id = ? AND expires_at > ?",
+	if err := database.WithContext(c).Where("token = ? AND client_id = ? AND expires_at > ?",
 		refreshToken, clientID, time.Now()).First(&refreshTokenModel).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
 		return
 	}
 
+	audit.SetActor(c, refreshTokenModel.UserID)
+
+	// Disabled users keep no access
+	var user models.User
+	if err := database.WithContext(c).First(&user, refreshTokenModel.UserID).Error; err != nil || user.IsDisabled() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+
+	grantedScope := refreshTokenModel.Scope
+	if scope != "" {
+		if !models.ScopeCovers(refreshTokenModel.Scope, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope", "error_description": "The requested scope exceeds the scope originally granted"})
+			return
+		}
+		grantedScope = strings.Join(models.ParseScope(scope), " ")
+	}
+	resource, ok := tokenResource(c, refreshTokenModel.Resource, resource)
+	if !ok {
+		return
+	}
+
 	// Generate new access token
 	accessToken, err := utils.GenerateRandomToken(32)
 	if err != nil {
@@ -269,21 +490,70 @@ func (ctrl *OAuthController) handleRefreshTokenGrant(c *gin.Context, refreshToke
 	accessTokenModel := models.OAuthAccessToken{
 		Token:     accessToken,
 		ClientID:  clientID,
-		UserID:    refreshTokenModel.UserID,
-		Scope:     refreshTokenModel.Scope,
+		UserID:    &refreshTokenModel.UserID,
+		Scope:     grantedScope,
+		Resource:  resource,
 		ExpiresAt: time.Now().Add(1 * time.Hour),
 	}
 
-	if err := database.DB.Create(&accessTokenModel).Error; err != nil {
+	if err := database.WithContext(c).Create(&accessTokenModel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	audit.SetAction(c, "oauth.token_refreshed")
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"scope":        grantedScope,
+	})
+}
+
+// handleClientCredentialsGrant issues a user-less access token to a service
+// client (RFC 6749 section 4.4). No refresh token is issued: the client can
+// simply ask again.
+func (ctrl *OAuthController) handleClientCredentialsGrant(c *gin.Context, client *models.OAuthClient, scope, resource string) {
+	if !client.Service {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unauthorized_client", "error_description": "The client may not use the client_credentials grant"})
+		return
+	}
+
+	grantedScope, _, err := resolveScope(c, client, scope)
+	if err != nil {
+		writeScopeError(c, err)
+		return
+	}
+	resource, ok := tokenResource(c, "", resource)
+	if !ok {
+		return
+	}
+
+	accessToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	accessTokenModel := models.OAuthAccessToken{
+		Token:     accessToken,
+		ClientID:  client.ID,
+		Scope:     grantedScope,
+		Resource:  resource,
+		ExpiresAt: time.Now().Add(1 * time.Hour),
+	}
+	if err := database.WithContext(c).Create(&accessTokenModel).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
 		return
 	}
 
+	audit.SetAction(c, "oauth.token_issued")
+	audit.AddDetail(c, "scope", grantedScope)
 	c.JSON(http.StatusOK, gin.H{
 		"access_token": accessToken,
 		"token_type":   "Bearer",
 		"expires_in":   3600,
-		"scope":        refreshTokenModel.Scope,
+		"scope":        grantedScope,
 	})
 }
 
@@ -307,14 +577,14 @@ func (ctrl *OAuthController) UserInfo(c *gin.Context) {
 
 	// Find and validate access token
 	var accessToken models.OAuthAccessToken
-	if err := database.DB.Where("token = ? AND expires_at > ?", token, time.Now()).
-		Preload("User").First(&accessToken).Error; err != nil {
+	if err := database.WithContext(c).Where("token = ? AND expires_at > ?", token, time.Now()).
+		Preload("User").First(&accessToken).Error; err != nil || accessToken.UserID == nil || accessToken.User.IsDisabled() {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"sub":   accessToken.UserID,
+		"sub":   *accessToken.UserID,
 		"email": accessToken.User.Email,
 		"name":  accessToken.User.Name,
 	})
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authorization server metadata (RFC 8414), so that MCP clients connecting
+// to the proxy's /mcp endpoint can discover where to send the user and
+// where to get tokens. The authorization endpoint is the frontend's consent
+// page, which signs the user in and calls /oauth/authorize itself.
+
+// Metadata describes the OAuth server
+// GET /.well-known/oauth-authorization-server
+func (ctrl *OAuthController) Metadata(c *gin.Context) {
+	issuer := ctrl.config.OAuthIssuer
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                           issuer,
+		"authorization_endpoint":                           ctrl.config.FrontendURL + "/oauth/consent",
+		"token_endpoint":                                   issuer + "/oauth/token",
+		"device_authorization_endpoint":                    issuer + "/oauth/device/code",
+		"userinfo_endpoint":                                issuer + "/oauth/userinfo",
+		"response_types_supported":                         []string{"code"},
+		"grant_types_supported":                            []string{"authorization_code", "refresh_token", "client_credentials", deviceCodeGrantType},
+		"token_endpoint_auth_methods_supported":            []string{"client_secret_post", "private_key_jwt"},
+		"token_endpoint_auth_signing_alg_values_supported": clientAssertionMethods,
+		"code_challenge_methods_supported":                 []string{codeChallengeS256},
+	})
+}
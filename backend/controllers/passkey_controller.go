@@ -0,0 +1,407 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// passkeySessionTTL bounds how long a begun ceremony may take to finish
+const passkeySessionTTL = 5 * time.Minute
+
+type PasskeyController struct {
+	config   *config.Config
+	webAuthn *webauthn.WebAuthn
+}
+
+func NewPasskeyController(cfg *config.Config) *PasskeyController {
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthn.RPID,
+		RPDisplayName: cfg.WebAuthn.RPDisplayName,
+		RPOrigins:     cfg.WebAuthn.RPOrigins,
+	})
+	if err != nil {
+		log.Fatalf("Invalid WebAuthn configuration: %v", err)
+	}
+	return &PasskeyController{config: cfg, webAuthn: w}
+}
+
+type BeginPasskeyLoginRequest struct {
+	Email string `json:"email"` // optional: omit for a discoverable (username-less) login
+}
+
+type RenamePasskeyRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// passkeyUser adapts a User and their passkeys to webauthn.User
+type passkeyUser struct {
+	user     *models.User
+	passkeys []models.Passkey
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(strconv.FormatUint(uint64(u.user.ID), 10))
+}
+
+func (u *passkeyUser) WebAuthnName() string        { return u.user.Email }
+func (u *passkeyUser) WebAuthnDisplayName() string { return u.user.Name }
+func (u *passkeyUser) WebAuthnIcon() string        { return "" }
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, len(u.passkeys))
+	for i, p := range u.passkeys {
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Split(p.Transports, ",") {
+			if t != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(t))
+			}
+		}
+		creds[i] = webauthn.Credential{
+			ID:              p.CredentialID,
+			PublicKey:       p.PublicKey,
+			AttestationType: p.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: p.BackupEligible,
+				BackupState:    p.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    p.AAGUID,
+				SignCount: p.SignCount,
+			},
+		}
+	}
+	return creds
+}
+
+// loadPasskeyUser loads a user together with their passkeys
+func loadPasskeyUser(ctx context.Context, userID interface{}) (*passkeyUser, error) {
+	var user models.User
+	if err := database.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	var passkeys []models.Passkey
+	if err := database.WithContext(ctx).Where("user_id = ?", user.ID).Find(&passkeys).Error; err != nil {
+		return nil, err
+	}
+	return &passkeyUser{user: &user, passkeys: passkeys}, nil
+}
+
+// saveSession stores ceremony state and returns its ID
+func saveSession(ctx context.Context, session *webauthn.SessionData, userID *uint) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	id, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	record := models.WebAuthnSession{
+		ID:        id,
+		UserID:    userID,
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(passkeySessionTTL),
+	}
+	if err := database.WithContext(ctx).Create(&record).Error; err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// takeSession loads and deletes ceremony state, so each challenge is used once
+func takeSession(ctx context.Context, id string) (*models.WebAuthnSession, *webauthn.SessionData, error) {
+	var record models.WebAuthnSession
+	if err := database.WithContext(ctx).Where("id = ?", id).First(&record).Error; err != nil {
+		return nil, nil, errors.New("unknown or expired passkey session")
+	}
+	database.WithContext(ctx).Delete(&record)
+	if time.Now().After(record.ExpiresAt) {
+		return nil, nil, errors.New("unknown or expired passkey session")
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(record.Data), &session); err != nil {
+		return nil, nil, err
+	}
+	return &record, &session, nil
+}
+
+// BeginRegistration starts registering a passkey for the logged-in user
+func (ctrl *PasskeyController) BeginRegistration(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	user, err := loadPasskeyUser(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Don't let the same authenticator register twice
+	var exclusions []protocol.CredentialDescriptor
+	for _, cred := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, cred.Descriptor())
+	}
+
+	options, session, err := ctrl.webAuthn.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	id := user.user.ID
+	sessionID, err := saveSession(c, session, &id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store passkey session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"session_id": sessionID, "options": options})
+}
+
+// FinishRegistration verifies the authenticator's response and stores the
+// passkey. The body is the browser's PublicKeyCredential; the session and an
+// optional display name are passed as ?session_id=...&name=...
+func (ctrl *PasskeyController) FinishRegistration(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	record, session, err := takeSession(c, c.Query("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if record.UserID == nil || *record.UserID != userID.(uint) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey session belongs to another user"})
+		return
+	}
+
+	user, err := loadPasskeyUser(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	cred, err := ctrl.webAuthn.FinishRegistration(user, *session, c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey registration failed: " + err.Error()})
+		return
+	}
+
+	name := c.Query("name")
+	if name == "" {
+		name = "Passkey " + time.Now().UTC().Format("2006-01-02")
+	}
+	transports := make([]string, len(cred.Transport))
+	for i, t := range cred.Transport {
+		transports[i] = string(t)
+	}
+
+	passkey := models.Passkey{
+		UserID:          user.user.ID,
+		Name:            name,
+		CredentialID:    cred.ID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		Transports:      strings.Join(transports, ","),
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+	}
+	if err := database.WithContext(c).Create(&passkey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save passkey"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, passkey)
+}
+
+// BeginLogin starts a passkey login. With an email the user's passkeys are
+// offered; without one the browser lets the user pick a discoverable passkey.
+func (ctrl *PasskeyController) BeginLogin(c *gin.Context) {
+	var req BeginPasskeyLoginRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var (
+		options *protocol.CredentialAssertion
+		session *webauthn.SessionData
+		userID  *uint
+		err     error
+	)
+	if req.Email != "" {
+		var user models.User
+		if err := database.WithContext(c).Where("email = ?", req.Email).First(&user).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No passkeys registered for this account"})
+			return
+		}
+		pu, err := loadPasskeyUser(c, user.ID)
+		if err != nil || len(pu.passkeys) == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No passkeys registered for this account"})
+			return
+		}
+		options, session, err = ctrl.webAuthn.BeginLogin(pu)
+		userID = &user.ID
+	} else {
+		options, session, err = ctrl.webAuthn.BeginDiscoverableLogin()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+
+	sessionID, err := saveSession(c, session, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store passkey session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"session_id": sessionID, "options": options})
+}
+
+// FinishLogin verifies the assertion (?session_id=...) and returns a JWT
+// exactly like the password login does
+func (ctrl *PasskeyController) FinishLogin(c *gin.Context) {
+	audit.AddDetail(c, "method", "passkey")
+
+	record, session, err := takeSession(c, c.Query("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user *passkeyUser
+	var cred *webauthn.Credential
+	if record.UserID != nil {
+		if user, err = loadPasskeyUser(c, *record.UserID); err == nil {
+			cred, err = ctrl.webAuthn.FinishLogin(user, *session, c.Request)
+		}
+	} else {
+		cred, err = ctrl.webAuthn.FinishDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			id, err := strconv.ParseUint(string(userHandle), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			user, err = loadPasskeyUser(c, uint(id))
+			return user, err
+		}, *session, c.Request)
+	}
+	if user != nil {
+		audit.SetActor(c, user.user.ID)
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey login failed"})
+		return
+	}
+
+	// Track the signature counter so cloned authenticators are detected
+	now := time.Now()
+	database.WithContext(c).Model(&models.Passkey{}).
+		Where("user_id = ? AND credential_id = ?", user.user.ID, cred.ID).
+		Updates(map[string]interface{}{
+			"sign_count":   cred.Authenticator.SignCount,
+			"backup_state": cred.Flags.BackupState,
+			"last_used_at": now,
+		})
+	if cred.Authenticator.CloneWarning {
+		log.Printf("Passkey sign counter went backwards for user %d; the authenticator may be cloned", user.user.ID)
+	}
+
+	if user.user.IsDisabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+	// A passkey can't be guessed, so it also lifts a password lockout
+	if err := clearLoginFailures(database.WithContext(c), user.user); err != nil {
+		log.Printf("Failed to reset failed sign-ins of user %d: %v", user.user.ID, err)
+	}
+
+	// A passkey counts as two factors: the device holding it unlocks it
+	// with a PIN or biometric
+	token, err := utils.GenerateMFAJWT(user.user.ID, user.user.Email, ctrl.config.JWTSecret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Token: token,
+		User:  user.user,
+	})
+}
+
+// List returns the logged-in user's passkeys
+func (ctrl *PasskeyController) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var passkeys []models.Passkey
+	if err := database.WithContext(c).Where("user_id = ?", userID).Order("created_at").Find(&passkeys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"passkeys": passkeys})
+}
+
+// Rename changes a passkey's display name
+func (ctrl *PasskeyController) Rename(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req RenamePasskeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var passkey models.Passkey
+	if err := database.WithContext(c).Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&passkey).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+	passkey.Name = req.Name
+	if err := database.WithContext(c).Save(&passkey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename passkey"})
+		return
+	}
+
+	c.JSON(http.StatusOK, passkey)
+}
+
+// Delete removes one of the logged-in user's passkeys
+func (ctrl *PasskeyController) Delete(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	result := database.WithContext(c).Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.Passkey{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
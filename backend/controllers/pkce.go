@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// An authorization code is bound to more than its client and redirect URI:
+// with PKCE (RFC 7636) only the holder of the verifier of its challenge can
+// exchange it, and with a resource indicator (RFC 8707) the tokens are only
+// for that resource, such as the proxy's /mcp endpoint. Only the S256
+// challenge method is supported; "plain" would hand the verifier to anyone
+// who sees the authorization request.
+
+const codeChallengeS256 = "S256"
+
+// codeChallengePattern matches an S256 challenge: the base64url SHA-256 of
+// the verifier, without padding
+var codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+
+// codeVerifierPattern matches a verifier (RFC 7636 section 4.1)
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+// codeBinding is the PKCE challenge and resource of an authorization request
+type codeBinding struct {
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+	Resource            string `form:"resource" json:"resource"`
+}
+
+// validate answers 400 and returns false when the binding is malformed
+func (b *codeBinding) validate(c *gin.Context) bool {
+	switch {
+	case b.CodeChallenge == "" && b.CodeChallengeMethod != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "code_challenge_method without code_challenge"})
+		return false
+	case b.CodeChallenge != "" && b.CodeChallengeMethod != codeChallengeS256:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "code_challenge_method must be S256"})
+		return false
+	case b.CodeChallenge != "" && !codeChallengePattern.MatchString(b.CodeChallenge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "Malformed code_challenge"})
+		return false
+	case b.Resource != "" && !validResource(b.Resource):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_target", "error_description": "resource must be an absolute URI without a fragment"})
+		return false
+	}
+	return true
+}
+
+// validResource reports whether resource is an absolute URI without a
+// fragment (RFC 8707 section 2)
+func validResource(resource string) bool {
+	u, err := url.Parse(resource)
+	return err == nil && u.IsAbs() && u.Host != "" && u.Fragment == ""
+}
+
+// verifyCodeVerifier reports whether verifier proves possession of the
+// code's challenge. Codes without one must be exchanged without a verifier,
+// so a verifier can't hide a downgrade.
+func verifyCodeVerifier(code *models.OAuthAuthorizationCode, verifier string) bool {
+	if code.CodeChallenge == "" {
+		return verifier == ""
+	}
+	if code.CodeChallengeMethod != codeChallengeS256 || !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) == 1
+}
+
+// tokenResource returns the resource the tokens of a grant are for: the
+// one bound to the grant, which a token request may repeat but not change,
+// or else the one the token request names. It answers invalid_target and
+// returns false on a mismatch.
+func tokenResource(c *gin.Context, bound, requested string) (string, bool) {
+	switch {
+	case requested == "":
+		return bound, true
+	case bound != "" && requested != bound:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_target", "error_description": "resource differs from the one authorized"})
+		return "", false
+	case !validResource(requested):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_target", "error_description": "resource must be an absolute URI without a fragment"})
+		return "", false
+	}
+	return requested, true
+}
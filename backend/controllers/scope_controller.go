@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ScopeAdminController manages the scope registry for admins holding
+// models.PermManageClients
+type ScopeAdminController struct {
+	config *config.Config
+}
+
+func NewScopeAdminController(cfg *config.Config) *ScopeAdminController {
+	return &ScopeAdminController{config: cfg}
+}
+
+type PutScopeRequest struct {
+	Description string `json:"description" binding:"required"`
+	Restricted  bool   `json:"restricted"`
+	Write       bool   `json:"write"`
+}
+
+// ScopeInfo describes a scope on the consent screen
+type ScopeInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Write       bool   `json:"write,omitempty"`
+}
+
+// resolveScope checks a requested scope against the registry and returns
+// the scope to grant. Unknown scopes are rejected; restricted scopes the
+// client may not request are dropped, narrowing the grant as RFC 6749
+// section 3.3 allows. While the registry is empty every scope is granted
+// as requested, except admin: scopes, which are only granted when they are
+// registered as restricted and the client is allowed them.
+func resolveScope(ctx context.Context, client *models.OAuthClient, requested string) (string, []ScopeInfo, error) {
+	names := models.ParseScope(requested)
+
+	var registered int64
+	if err := database.WithContext(ctx).Model(&models.OAuthScope{}).Count(&registered).Error; err != nil {
+		return "", nil, err
+	}
+	if registered == 0 {
+		var granted []string
+		infos := make([]ScopeInfo, 0, len(names))
+		for _, name := range names {
+			if strings.HasPrefix(name, models.ServiceScopePrefix) {
+				continue
+			}
+			granted = append(granted, name)
+			infos = append(infos, ScopeInfo{Name: name})
+		}
+		if len(names) > 0 && len(granted) == 0 {
+			return "", nil, &scopeError{"The client may not request any of the requested scopes"}
+		}
+		return strings.Join(granted, " "), infos, nil
+	}
+	if len(names) == 0 {
+		return "", []ScopeInfo{}, nil
+	}
+
+	var known []models.OAuthScope
+	if err := database.WithContext(ctx).Where("name IN ?", names).Find(&known).Error; err != nil {
+		return "", nil, err
+	}
+	byName := make(map[string]models.OAuthScope, len(known))
+	for _, s := range known {
+		byName[s.Name] = s
+	}
+	allowed := make(map[string]bool)
+	for _, name := range client.AllowedScopeList() {
+		allowed[name] = true
+	}
+
+	var granted []string
+	infos := make([]ScopeInfo, 0, len(names))
+	for _, name := range names {
+		scope, ok := byName[name]
+		if !ok {
+			return "", nil, &scopeError{fmt.Sprintf("Unknown scope: %s", name)}
+		}
+		switch {
+		case scope.Restricted && !allowed[name]:
+			continue
+		case !scope.Restricted && strings.HasPrefix(name, models.ServiceScopePrefix):
+			// admin: scopes are only granted to clients allowed them
+			continue
+		}
+		granted = append(granted, name)
+		infos = append(infos, ScopeInfo{Name: name, Description: scope.Description, Write: scope.Write})
+	}
+	if len(granted) == 0 {
+		return "", nil, &scopeError{"The client may not request any of the requested scopes"}
+	}
+	return strings.Join(granted, " "), infos, nil
+}
+
+// scopeError is an invalid_scope error, as opposed to a database failure
+type scopeError struct {
+	description string
+}
+
+func (e *scopeError) Error() string { return e.description }
+
+// writeScopeError answers a failed resolveScope
+func writeScopeError(c *gin.Context, err error) {
+	var se *scopeError
+	if errors.As(err, &se) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope", "error_description": se.description})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+}
+
+// requireTwoFactorForScopes answers 403 and returns false when scopes
+// include a write scope and the user has two-factor authentication but
+// signed in without it
+func requireTwoFactorForScopes(c *gin.Context, scopes []ScopeInfo) bool {
+	if !c.GetBool("two_factor_enabled") || c.GetBool("mfa") {
+		return true
+	}
+	for _, s := range scopes {
+		if s.Write {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":             "two_factor_required",
+				"error_description": "Sign in with your second factor to grant write access",
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// List returns the registered scopes
+// GET /api/admin/scopes
+func (ctrl *ScopeAdminController) List(c *gin.Context) {
+	var scopes []models.OAuthScope
+	if err := database.WithContext(c).Order("name").Find(&scopes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load scopes"})
+		return
+	}
+	c.JSON(http.StatusOK, scopes)
+}
+
+// Put registers a scope or changes its description and restriction
+// PUT /api/admin/scopes/:name
+func (ctrl *ScopeAdminController) Put(c *gin.Context) {
+	var req PutScopeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := c.Param("name")
+	if !models.ValidScopeName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope name"})
+		return
+	}
+
+	var scope models.OAuthScope
+	err := database.WithContext(c).Where("name = ?", name).First(&scope).Error
+	created := errors.Is(err, gorm.ErrRecordNotFound)
+	if err != nil && !created {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load scope"})
+		return
+	}
+	scope.Name = name
+	scope.Description = req.Description
+	scope.Restricted = req.Restricted
+	scope.Write = req.Write
+	if created {
+		err = database.WithContext(c).Create(&scope).Error
+	} else {
+		err = database.WithContext(c).Save(&scope).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save scope"})
+		return
+	}
+
+	action := "scope.updated"
+	status := http.StatusOK
+	if created {
+		action = "scope.created"
+		status = http.StatusCreated
+	}
+	audit.Record(database.DB, c, action, "oauth_scope", name, map[string]interface{}{
+		"description": scope.Description,
+		"restricted":  scope.Restricted,
+		"write":       scope.Write,
+	})
+	c.JSON(status, scope)
+}
+
+// Delete removes a scope from the registry. Tokens already carrying it keep
+// it; new authorizations requesting it are rejected.
+// DELETE /api/admin/scopes/:name
+func (ctrl *ScopeAdminController) Delete(c *gin.Context) {
+	result := database.WithContext(c).Where("name = ?", c.Param("name")).Delete(&models.OAuthScope{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete scope"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scope not found"})
+		return
+	}
+
+	audit.Record(database.DB, c, "scope.deleted", "oauth_scope", c.Param("name"), nil)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Two-factor authentication is optional per user: setup stores a new TOTP
+// secret (encrypted with TOTP_ENCRYPTION_KEY) and recovery codes, and enable
+// turns it on once the user proves their authenticator app works. From then
+// on a correct password only yields a challenge, exchanged together with a
+// TOTP or recovery code for a session at /api/auth/2fa/verify. Sessions
+// created that way (or with a passkey) are marked as two-factor, which
+// admin routes and consent to write scopes require.
+
+const recoveryCodeCount = 10
+
+type TwoFactorSetupRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorVerifyRequest struct {
+	Challenge string `json:"challenge" binding:"required"`
+	Code      string `json:"code" binding:"required"`
+}
+
+// generateRecoveryCode returns a random code formatted as XXXXX-XXXXX
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := base32.StdEncoding.EncodeToString(b)[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// SetupTwoFactor creates a new TOTP secret and recovery codes for the
+// logged-in user. Two-factor authentication stays off until EnableTwoFactor
+// POST /api/auth/2fa/setup
+func (ctrl *AuthController) SetupTwoFactor(c *gin.Context) {
+	var req TwoFactorSetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	var user models.User
+	if err := database.WithContext(c).First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TwoFactorEnabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	// A stolen session alone must not be able to lock the owner out
+	if !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	sealed, err := utils.EncryptSecret(ctrl.config.Login.TOTPKey, secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt secret"})
+		return
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = generateRecoveryCode(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+			return
+		}
+	}
+
+	err = database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"totp_secret": sealed, "totp_last_step": 0}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, code := range codes {
+			if err := tx.Create(&models.RecoveryCode{UserID: user.ID, CodeHash: models.HashRecoveryCode(code)}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save two-factor setup"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":         secret,
+		"otpauth_uri":    utils.TOTPURI(ctrl.config.Login.TOTPIssuer, user.Email, secret),
+		"recovery_codes": codes,
+	})
+}
+
+// EnableTwoFactor turns on two-factor authentication once the user enters a
+// code from the secret created by SetupTwoFactor, and returns a two-factor
+// session in place of the current one
+// POST /api/auth/2fa/enable
+func (ctrl *AuthController) EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	var user models.User
+	if err := database.WithContext(c).First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TwoFactorEnabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set up two-factor authentication first"})
+		return
+	}
+
+	secret, err := utils.DecryptSecret(ctrl.config.Login.TOTPKey, user.TOTPSecret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read two-factor secret"})
+		return
+	}
+	step, ok := utils.ValidateTOTP(secret, req.Code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	now := time.Now()
+	if err := database.WithContext(c).Model(&user).Updates(map[string]interface{}{
+		"totp_enabled_at": now,
+		"totp_last_step":  step,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	token, err := utils.GenerateMFAJWT(user.ID, user.Email, ctrl.config.JWTSecret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Token: token,
+		User:  &user,
+	})
+}
+
+// DisableTwoFactor turns off two-factor authentication after checking a
+// TOTP or recovery code, and forgets the secret and recovery codes
+// POST /api/auth/2fa/disable
+func (ctrl *AuthController) DisableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	var user models.User
+	if err := database.WithContext(c).First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.TwoFactorEnabled() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	method, err := ctrl.checkSecondFactor(c, &user, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check code"})
+		return
+	}
+	if method == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+	audit.AddDetail(c, "method", method)
+
+	err = database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// VerifyTwoFactor completes a password sign-in: it exchanges the challenge
+// returned by Login and a TOTP or recovery code for a session. Wrong codes
+// count towards the account lockout like wrong passwords
+// POST /api/auth/2fa/verify
+func (ctrl *AuthController) VerifyTwoFactor(c *gin.Context) {
+	var req TwoFactorVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	audit.AddDetail(c, "step", "two_factor")
+
+	if throttled, retryAfter := ctrl.ipThrottled(c); throttled {
+		audit.AddDetail(c, "reason", "throttled")
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed sign-in attempts, try again later"})
+		return
+	}
+
+	claims, err := utils.ValidateTwoFactorChallenge(req.Challenge, ctrl.config.JWTSecret)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	var user models.User
+	if err := database.WithContext(c).First(&user, claims.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	audit.SetActor(c, user.ID)
+	if !user.TwoFactorEnabled() || !user.SessionValid(claims.IssuedAt.Time) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+	if user.IsLocked(time.Now()) {
+		audit.AddDetail(c, "reason", "locked")
+		ctrl.recordLoginFailure(c, nil)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	method, err := ctrl.checkSecondFactor(c, &user, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check code"})
+		return
+	}
+	if method == "" {
+		ctrl.recordLoginFailure(c, &user)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	audit.AddDetail(c, "method", method)
+
+	if err := clearLoginFailures(database.WithContext(c), &user); err != nil {
+		log.Printf("Failed to reset failed sign-ins of user %d: %v", user.ID, err)
+	}
+
+	token, err := utils.GenerateMFAJWT(user.ID, user.Email, ctrl.config.JWTSecret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Token: token,
+		User:  &user,
+	})
+}
+
+// checkSecondFactor accepts code as a TOTP code or an unused recovery code
+// and returns which it was, or "" when it is neither. Both are claimed with
+// conditional updates, so concurrent requests can't use a code twice.
+func (ctrl *AuthController) checkSecondFactor(c *gin.Context, user *models.User, code string) (string, error) {
+	db := database.WithContext(c)
+
+	secret, err := utils.DecryptSecret(ctrl.config.Login.TOTPKey, user.TOTPSecret)
+	if err != nil {
+		return "", err
+	}
+	if step, ok := utils.ValidateTOTP(secret, code, time.Now(), user.TOTPLastStep); ok {
+		claim := db.Model(user).Where("totp_last_step < ?", step).Update("totp_last_step", step)
+		if claim.Error != nil {
+			return "", claim.Error
+		}
+		if claim.RowsAffected > 0 {
+			return "totp", nil
+		}
+		return "", nil
+	}
+
+	claim := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, models.HashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if claim.Error != nil {
+		return "", claim.Error
+	}
+	if claim.RowsAffected > 0 {
+		return "recovery_code", nil
+	}
+	return "", nil
+}
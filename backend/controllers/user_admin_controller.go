@@ -0,0 +1,335 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserAdminController handles support and abuse tooling for admins holding
+// models.PermManageUsers
+type UserAdminController struct {
+	config *config.Config
+}
+
+func NewUserAdminController(cfg *config.Config) *UserAdminController {
+	return &UserAdminController{config: cfg}
+}
+
+type DisableUserRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// UserConnection summarizes a user's tokens for one OAuth client
+type UserConnection struct {
+	ClientID              string     `json:"client_id"`
+	ClientName            string     `json:"client_name"`
+	ActiveAccessTokens    int64      `json:"active_access_tokens"`
+	AccessTokenExpiresAt  *time.Time `json:"access_token_expires_at,omitempty"`
+	ActiveRefreshTokens   int64      `json:"active_refresh_tokens"`
+	RefreshTokenExpiresAt *time.Time `json:"refresh_token_expires_at,omitempty"`
+	LastAuthorizedAt      *time.Time `json:"last_authorized_at,omitempty"`
+}
+
+// UserDetail is a user with their connected clients
+type UserDetail struct {
+	models.User
+	Connections []UserConnection `json:"connections"`
+}
+
+// RevocationResult counts what revokeUserTokens removed
+type RevocationResult struct {
+	AccessTokens   int64 `json:"access_tokens"`
+	RefreshTokens  int64 `json:"refresh_tokens"`
+	Codes          int64 `json:"authorization_codes"`
+	Impersonations int64 `json:"impersonation_sessions"`
+}
+
+// revokeUserTokens deletes the user's OAuth tokens, invalidates unused
+// authorization codes, ends impersonation sessions of the user and rejects
+// JWTs issued until now
+func revokeUserTokens(tx *gorm.DB, user *models.User, now time.Time) (RevocationResult, error) {
+	var result RevocationResult
+
+	access := tx.Where("user_id = ?", user.ID).Delete(&models.OAuthAccessToken{})
+	if access.Error != nil {
+		return result, access.Error
+	}
+	refresh := tx.Where("user_id = ?", user.ID).Delete(&models.OAuthRefreshToken{})
+	if refresh.Error != nil {
+		return result, refresh.Error
+	}
+	codes := tx.Model(&models.OAuthAuthorizationCode{}).
+		Where("user_id = ? AND used = ? AND expires_at > ?", user.ID, false, now).
+		Update("used", true)
+	if codes.Error != nil {
+		return result, codes.Error
+	}
+	impersonations := tx.Model(&models.ImpersonationSession{}).
+		Where("user_id = ? AND ended_at IS NULL AND expires_at > ?", user.ID, now).
+		Update("ended_at", now)
+	if impersonations.Error != nil {
+		return result, impersonations.Error
+	}
+	if err := tx.Model(user).Update("sessions_revoked_at", now).Error; err != nil {
+		return result, err
+	}
+
+	result.AccessTokens = access.RowsAffected
+	result.RefreshTokens = refresh.RowsAffected
+	result.Codes = codes.RowsAffected
+	result.Impersonations = impersonations.RowsAffected
+	return result, nil
+}
+
+// loadUser finds a user by the :id parameter, writing a 404 when absent
+func (ctrl *UserAdminController) loadUser(c *gin.Context, user *models.User) bool {
+	if err := database.WithContext(c).First(user, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return false
+	}
+	return true
+}
+
+// List returns users, newest first, optionally filtered by email or name
+// GET /api/admin/users?q=&disabled=true&limit=
+func (ctrl *UserAdminController) List(c *gin.Context) {
+	limit, ok := parseLimit(c)
+	if !ok {
+		return
+	}
+
+	query := database.ReadReplica(c).Order("created_at DESC, id DESC").Limit(limit)
+	if q := c.Query("q"); q != "" {
+		like := "%" + q + "%"
+		query = query.Where("email LIKE ? OR name LIKE ?", like, like)
+	}
+	switch c.Query("disabled") {
+	case "true":
+		query = query.Where("disabled_at IS NOT NULL")
+	case "false":
+		query = query.Where("disabled_at IS NULL")
+	}
+
+	var users []models.User
+	if err := query.Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load users"})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// Get returns a user with the OAuth clients they connected and the state of
+// the tokens issued to each
+// GET /api/admin/users/:id
+func (ctrl *UserAdminController) Get(c *gin.Context) {
+	var user models.User
+	if !ctrl.loadUser(c, &user) {
+		return
+	}
+
+	now := time.Now()
+	byClient := make(map[string]*UserConnection)
+	var order []string
+	connection := func(clientID string) *UserConnection {
+		if conn, ok := byClient[clientID]; ok {
+			return conn
+		}
+		conn := &UserConnection{ClientID: clientID}
+		byClient[clientID] = conn
+		order = append(order, clientID)
+		return conn
+	}
+
+	var accessTokens []models.OAuthAccessToken
+	var refreshTokens []models.OAuthRefreshToken
+	var codes []models.OAuthAuthorizationCode
+	if err := database.ReadReplica(c).Where("user_id = ? AND expires_at > ?", user.ID, now).Find(&accessTokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tokens"})
+		return
+	}
+	if err := database.ReadReplica(c).Where("user_id = ? AND expires_at > ?", user.ID, now).Find(&refreshTokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tokens"})
+		return
+	}
+	if err := database.ReadReplica(c).Where("user_id = ? AND used = ?", user.ID, true).Order("created_at DESC").Find(&codes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load grants"})
+		return
+	}
+
+	for _, t := range accessTokens {
+		conn := connection(t.ClientID)
+		conn.ActiveAccessTokens++
+		if conn.AccessTokenExpiresAt == nil || t.ExpiresAt.After(*conn.AccessTokenExpiresAt) {
+			expires := t.ExpiresAt
+			conn.AccessTokenExpiresAt = &expires
+		}
+	}
+	for _, t := range refreshTokens {
+		conn := connection(t.ClientID)
+		conn.ActiveRefreshTokens++
+		if conn.RefreshTokenExpiresAt == nil || t.ExpiresAt.After(*conn.RefreshTokenExpiresAt) {
+			expires := t.ExpiresAt
+			conn.RefreshTokenExpiresAt = &expires
+		}
+	}
+	for _, code := range codes {
+		conn := connection(code.ClientID)
+		if conn.LastAuthorizedAt == nil {
+			created := code.CreatedAt
+			conn.LastAuthorizedAt = &created
+		}
+	}
+
+	if len(order) > 0 {
+		var clients []models.OAuthClient
+		if err := database.ReadReplica(c).Unscoped().Where("id IN ?", order).Find(&clients).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load clients"})
+			return
+		}
+		for _, client := range clients {
+			byClient[client.ID].ClientName = client.Name
+		}
+	}
+
+	detail := UserDetail{User: user, Connections: make([]UserConnection, 0, len(order))}
+	for _, id := range order {
+		detail.Connections = append(detail.Connections, *byClient[id])
+	}
+	c.JSON(http.StatusOK, detail)
+}
+
+// RevokeTokens signs the user out everywhere: OAuth tokens, pending
+// authorization codes, impersonation sessions and login sessions
+// POST /api/admin/users/:id/revoke-tokens
+func (ctrl *UserAdminController) RevokeTokens(c *gin.Context) {
+	var user models.User
+	if !ctrl.loadUser(c, &user) {
+		return
+	}
+
+	var result RevocationResult
+	err := database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = revokeUserTokens(tx, &user, time.Now())
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+		return
+	}
+
+	audit.Record(database.DB, c, "user.tokens_revoked", "user", strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+		"revoked": result,
+	})
+	c.JSON(http.StatusOK, gin.H{"revoked": result})
+}
+
+// Disable blocks the account and revokes all of its tokens
+// POST /api/admin/users/:id/disable
+func (ctrl *UserAdminController) Disable(c *gin.Context) {
+	var req DisableUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if !ctrl.loadUser(c, &user) {
+		return
+	}
+	admin := currentAdmin(c)
+	if admin != nil && user.ID == admin.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot disable your own account"})
+		return
+	}
+	if user.IsAdmin() && (admin == nil || !admin.HasPermission(models.PermissionAll)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins holding every permission can disable other admins"})
+		return
+	}
+
+	now := time.Now()
+	var result RevocationResult
+	err := database.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"disabled_at":     now,
+			"disabled_reason": req.Reason,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		result, err = revokeUserTokens(tx, &user, now)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable user"})
+		return
+	}
+	user.DisabledAt = &now
+	user.DisabledReason = req.Reason
+
+	audit.Record(database.DB, c, "user.disabled", "user", strconv.FormatUint(uint64(user.ID), 10), map[string]interface{}{
+		"reason":  req.Reason,
+		"revoked": result,
+	})
+	c.JSON(http.StatusOK, user)
+}
+
+// Enable lifts a disabled account. Revoked tokens stay revoked.
+// POST /api/admin/users/:id/enable
+func (ctrl *UserAdminController) Enable(c *gin.Context) {
+	var user models.User
+	if !ctrl.loadUser(c, &user) {
+		return
+	}
+	if !user.IsDisabled() {
+		c.JSON(http.StatusOK, user)
+		return
+	}
+
+	if err := database.WithContext(c).Model(&user).Updates(map[string]interface{}{
+		"disabled_at":     nil,
+		"disabled_reason": "",
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable user"})
+		return
+	}
+	user.DisabledAt = nil
+	user.DisabledReason = ""
+
+	audit.Record(database.DB, c, "user.enabled", "user", strconv.FormatUint(uint64(user.ID), 10), nil)
+	c.JSON(http.StatusOK, user)
+}
+
+// Unlock lifts a lockout after too many wrong passwords
+// POST /api/admin/users/:id/unlock
+func (ctrl *UserAdminController) Unlock(c *gin.Context) {
+	var user models.User
+	if !ctrl.loadUser(c, &user) {
+		return
+	}
+	wasLocked := user.IsLocked(time.Now())
+
+	if err := clearLoginFailures(database.WithContext(c), &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	if wasLocked {
+		audit.Record(database.DB, c, "user.unlocked", "user", strconv.FormatUint(uint64(user.ID), 10), nil)
+	}
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,251 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/optimisticlock"
+)
+
+// The baseline migration creates the schema as it was when migrations were
+// introduced. Its models are a frozen copy of the ones in models/ at that
+// point, reduced to what shapes the tables: later model changes must not
+// change what the baseline creates, or databases created before and after
+// them would differ. Change a model by adding a migration instead.
+
+// baselineAuditEvent and baselineArchivedAuditEvent are declared here
+// rather than in migrateBaseline because the archive needs a TableName
+type baselineAuditEvent struct {
+	ID             uint   `gorm:"primaryKey"`
+	ActorID        *uint  `gorm:"index"`
+	ImpersonatorID *uint  `gorm:"index"`
+	ClientID       string `gorm:"index"`
+	Action         string `gorm:"not null;index"`
+	TargetType     string `gorm:"index"`
+	TargetID       string `gorm:"index"`
+	Details        string `gorm:"type:text"`
+	IP             string
+	CreatedAt      time.Time `gorm:"index"`
+}
+
+func (baselineAuditEvent) TableName() string { return "audit_events" }
+
+type baselineArchivedAuditEvent baselineAuditEvent
+
+func (baselineArchivedAuditEvent) TableName() string { return "audit_events_archive" }
+
+// migrateBaseline creates the tables of the baseline, or adds what is
+// missing to those of a database created before migrations existed
+func migrateBaseline(tx *gorm.DB) error {
+	type User struct {
+		ID                uint   `gorm:"primaryKey"`
+		Email             string `gorm:"uniqueIndex;not null"`
+		Password          string `gorm:"not null"`
+		Name              string `gorm:"not null"`
+		Role              string `gorm:"not null;default:user"`
+		Permissions       string `gorm:"type:text;not null;default:''"`
+		CreatedAt         time.Time
+		UpdatedAt         time.Time
+		DeletedAt         gorm.DeletedAt `gorm:"index"`
+		DisabledAt        *time.Time
+		DisabledReason    string `gorm:"type:text"`
+		SessionsRevokedAt *time.Time
+		FailedLogins      int `gorm:"not null;default:0"`
+		LockedUntil       *time.Time
+		TOTPSecret        string `gorm:"type:text;not null;default:''"`
+		TOTPEnabledAt     *time.Time
+		TOTPLastStep      int64 `gorm:"not null;default:0"`
+	}
+	type LoginFailure struct {
+		ID        uint      `gorm:"primaryKey"`
+		IP        string    `gorm:"not null;index"`
+		CreatedAt time.Time `gorm:"index"`
+	}
+	type RecoveryCode struct {
+		ID        uint   `gorm:"primaryKey"`
+		UserID    uint   `gorm:"not null;index"`
+		CodeHash  string `gorm:"not null;uniqueIndex"`
+		UsedAt    *time.Time
+		CreatedAt time.Time
+	}
+	type OAuthClient struct {
+		ID            string `gorm:"primaryKey"`
+		ClientSecret  string `gorm:"not null"`
+		Name          string `gorm:"not null"`
+		RedirectURIs  string `gorm:"type:text;not null"`
+		Trusted       bool   `gorm:"default:false"`
+		AllowedScopes string `gorm:"type:text;not null;default:''"`
+		Service       bool   `gorm:"default:false"`
+		PublicKeys    string `gorm:"type:text;not null;default:''"`
+		CreatedAt     time.Time
+		UpdatedAt     time.Time
+		DeletedAt     gorm.DeletedAt `gorm:"index"`
+	}
+	type OAuthClientAssertion struct {
+		ID        uint      `gorm:"primaryKey"`
+		ClientID  string    `gorm:"not null;uniqueIndex:idx_oauth_client_assertion_jti"`
+		JTI       string    `gorm:"not null;uniqueIndex:idx_oauth_client_assertion_jti"`
+		ExpiresAt time.Time `gorm:"not null;index"`
+	}
+	type OAuthAuthorizationCode struct {
+		ID          uint      `gorm:"primaryKey"`
+		Code        string    `gorm:"uniqueIndex;not null"`
+		ClientID    string    `gorm:"not null;index"`
+		UserID      uint      `gorm:"not null;index"`
+		RedirectURI string    `gorm:"not null"`
+		Scope       string    `gorm:"type:text"`
+		ExpiresAt   time.Time `gorm:"not null;index"`
+		Used        bool      `gorm:"default:false;index"`
+		CreatedAt   time.Time
+		Version     optimisticlock.Version `gorm:"not null;default:1"`
+		Client      OAuthClient            `gorm:"foreignKey:ClientID"`
+		User        User                   `gorm:"foreignKey:UserID"`
+	}
+	type OAuthAccessToken struct {
+		ID        uint      `gorm:"primaryKey"`
+		Token     string    `gorm:"uniqueIndex;not null"`
+		ClientID  string    `gorm:"not null;index"`
+		UserID    *uint     `gorm:"index"`
+		Scope     string    `gorm:"type:text"`
+		ExpiresAt time.Time `gorm:"not null;index"`
+		CreatedAt time.Time
+		Client    OAuthClient `gorm:"foreignKey:ClientID"`
+		User      User        `gorm:"foreignKey:UserID"`
+	}
+	type OAuthRefreshToken struct {
+		ID        uint      `gorm:"primaryKey"`
+		Token     string    `gorm:"uniqueIndex;not null"`
+		ClientID  string    `gorm:"not null;index"`
+		UserID    uint      `gorm:"not null;index"`
+		Scope     string    `gorm:"type:text"`
+		ExpiresAt time.Time `gorm:"not null;index"`
+		CreatedAt time.Time
+		Client    OAuthClient `gorm:"foreignKey:ClientID"`
+		User      User        `gorm:"foreignKey:UserID"`
+	}
+	type OAuthConsent struct {
+		ID        uint   `gorm:"primaryKey"`
+		UserID    uint   `gorm:"not null;uniqueIndex:idx_oauth_consent_user_client"`
+		ClientID  string `gorm:"not null;uniqueIndex:idx_oauth_consent_user_client"`
+		Scope     string `gorm:"type:text"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+		Version   optimisticlock.Version `gorm:"not null;default:1"`
+		Client    OAuthClient            `gorm:"foreignKey:ClientID"`
+		User      User                   `gorm:"foreignKey:UserID"`
+	}
+	type OAuthScope struct {
+		Name        string `gorm:"primaryKey"`
+		Description string `gorm:"type:text;not null;default:''"`
+		Restricted  bool   `gorm:"default:false"`
+		Write       bool   `gorm:"default:false"`
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+	}
+	type OAuthDeviceCode struct {
+		ID           uint   `gorm:"primaryKey"`
+		DeviceCode   string `gorm:"uniqueIndex;not null"`
+		UserCode     string `gorm:"uniqueIndex;not null"`
+		ClientID     string `gorm:"not null;index"`
+		Scope        string `gorm:"type:text"`
+		UserID       *uint  `gorm:"index"`
+		Status       string `gorm:"not null;default:'pending'"`
+		Used         bool   `gorm:"default:false"`
+		Interval     int    `gorm:"not null"`
+		LastPolledAt *time.Time
+		ExpiresAt    time.Time `gorm:"not null;index"`
+		CreatedAt    time.Time
+		Client       OAuthClient `gorm:"foreignKey:ClientID"`
+	}
+	type ProxyPolicy struct {
+		ID        uint   `gorm:"primaryKey"`
+		Name      string `gorm:"uniqueIndex;not null"`
+		Document  string `gorm:"type:text;not null"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+		DeletedAt gorm.DeletedAt `gorm:"index"`
+	}
+	type Passkey struct {
+		ID              uint   `gorm:"primaryKey"`
+		UserID          uint   `gorm:"not null;index"`
+		Name            string `gorm:"not null"`
+		CredentialID    []byte `gorm:"uniqueIndex;not null"`
+		PublicKey       []byte `gorm:"not null"`
+		AttestationType string
+		AAGUID          []byte
+		SignCount       uint32
+		Transports      string
+		BackupEligible  bool
+		BackupState     bool
+		LastUsedAt      *time.Time
+		CreatedAt       time.Time
+		User            User `gorm:"foreignKey:UserID"`
+	}
+	type WebAuthnSession struct {
+		ID        string    `gorm:"primaryKey"`
+		UserID    *uint     `gorm:"index"`
+		Data      string    `gorm:"type:text;not null"`
+		ExpiresAt time.Time `gorm:"not null;index"`
+		CreatedAt time.Time
+	}
+	type ImpersonationSession struct {
+		ID             uint      `gorm:"primaryKey"`
+		AdminID        uint      `gorm:"not null;index"`
+		UserID         uint      `gorm:"not null;index"`
+		Reason         string    `gorm:"type:text;not null"`
+		AllowMutations bool      `gorm:"not null;default:false"`
+		ExpiresAt      time.Time `gorm:"not null"`
+		EndedAt        *time.Time
+		CreatedAt      time.Time
+	}
+	type EbayCredential struct {
+		ID           uint   `gorm:"primaryKey"`
+		UserID       uint   `gorm:"not null;uniqueIndex:idx_ebay_credential_user_env"`
+		Environment  string `gorm:"not null;uniqueIndex:idx_ebay_credential_user_env"`
+		RefreshToken string `gorm:"type:text;not null"`
+		Scopes       string `gorm:"type:text;not null;default:''"`
+		Marketplace  string
+		Language     string
+		EbayUserID   string `gorm:"index"`
+		EbayUsername string
+		CreatedAt    time.Time
+		UpdatedAt    time.Time
+		User         User `gorm:"foreignKey:UserID"`
+	}
+	type UsageRecord struct {
+		ID        uint      `gorm:"primaryKey"`
+		UserID    uint      `gorm:"not null;uniqueIndex:idx_usage_record"`
+		ClientID  string    `gorm:"not null;uniqueIndex:idx_usage_record"`
+		Day       time.Time `gorm:"type:date;not null;uniqueIndex:idx_usage_record"`
+		Operation string    `gorm:"not null;uniqueIndex:idx_usage_record"`
+		Calls     int64     `gorm:"not null;default:0"`
+		Errors    int64     `gorm:"not null;default:0"`
+		UpdatedAt time.Time
+	}
+
+	tables := []interface{}{
+		&User{},
+		&LoginFailure{},
+		&RecoveryCode{},
+		&OAuthClient{},
+		&OAuthClientAssertion{},
+		&OAuthAuthorizationCode{},
+		&OAuthAccessToken{},
+		&OAuthRefreshToken{},
+		&OAuthConsent{},
+		&OAuthScope{},
+		&OAuthDeviceCode{},
+		&ProxyPolicy{},
+		&Passkey{},
+		&WebAuthnSession{},
+		&baselineAuditEvent{},
+		&baselineArchivedAuditEvent{},
+		&ImpersonationSession{},
+		&EbayCredential{},
+		&UsageRecord{},
+	}
+	if err := adjustSchemas(tx, tables...); err != nil {
+		return err
+	}
+	return tx.AutoMigrate(tables...)
+}
@@ -1,12 +1,16 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"sync/atomic"
 
-	"ebay-mcp/backend/config"
-	"ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -14,42 +18,135 @@ import (
 
 var DB *gorm.DB
 
-func Initialize(cfg *config.Config) error {
-	dsn := fmt.Sprintf(
+// password is the DB_PASSWORD new connections use, replaced by SetPassword
+// when the secret rotates
+var password atomic.Value
+
+// dsnFor returns the connection string of the database on host and port
+func dsnFor(db config.DatabaseConfig, host, port string) string {
+	return fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=UTC",
-		cfg.Database.Host,
-		cfg.Database.User,
-		cfg.Database.Password,
-		cfg.Database.Name,
-		cfg.Database.Port,
+		host,
+		db.User,
+		db.Password,
+		db.Name,
+		port,
 	)
+}
+
+// SetPassword makes connections opened from now on, to the primary and the
+// replicas, use p. Open connections stay authenticated and are replaced as
+// they reach DB_CONN_MAX_LIFETIME.
+func SetPassword(p string) {
+	password.Store(p)
+}
+
+// openPostgres returns a dialector for the database on host and port whose
+// connections use the current password
+func openPostgres(db config.DatabaseConfig, host, port string) (gorm.Dialector, error) {
+	connConfig, err := pgx.ParseConfig(dsnFor(db, host, port))
+	if err != nil {
+		return nil, err
+	}
+	sqlDB := stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(_ context.Context, cc *pgx.ConnConfig) error {
+		if p, ok := password.Load().(string); ok {
+			cc.Password = p
+		}
+		return nil
+	}))
+	return postgres.New(postgres.Config{Conn: sqlDB}), nil
+}
+
+// Initialize connects to the database and brings its schema up to date, or
+// with DB_AUTO_MIGRATE=false checks that it is
+func Initialize(cfg *config.Config) error {
+	if err := Connect(cfg); err != nil {
+		return err
+	}
+	if !cfg.Database.AutoMigrate {
+		return checkMigrated()
+	}
+	return MigrateUp("")
+}
 
-	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+// Connect opens the connection pool without touching the schema
+func Connect(cfg *config.Config) error {
+	SetPassword(cfg.Database.Password)
+	dialector, err := openDialector(cfg.Database, cfg.Database.Host, cfg.Database.Port)
+	if err != nil {
+		return fmt.Errorf("invalid database settings: %w", err)
+	}
+	driverName = cfg.Database.Driver
+
+	logLevel, err := parseLogLevel(cfg.Database.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	DB, err = gorm.Open(dialector, &gorm.Config{
+		Logger: logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+			SlowThreshold:             cfg.Database.SlowQuery,
+			LogLevel:                  logLevel,
+			IgnoreRecordNotFoundError: true,
+			Colorful:                  true,
+		}),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	log.Println("Database connection established")
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return fmt.Errorf("failed to configure connection pool: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
 
-	// Auto-migrate models
-	if err := DB.AutoMigrate(
-		&models.User{},
-		&models.OAuthClient{},
-		&models.OAuthAuthorizationCode{},
-		&models.OAuthAccessToken{},
-		&models.OAuthRefreshToken{},
-	); err != nil {
-		return fmt.Errorf("failed to migrate database: %w", err)
+	if err := registerReplicas(cfg.Database); err != nil {
+		return fmt.Errorf("failed to configure read replicas: %w", err)
 	}
 
-	log.Println("Database migration completed")
+	metrics.timeout = cfg.Database.QueryTimeout
+	metrics.slow = cfg.Database.SlowQuery
+	if err := DB.Use(metrics); err != nil {
+		return fmt.Errorf("failed to register database metrics: %w", err)
+	}
 
+	log.Printf("Database connection established (%s)", DB.Dialector.Name())
 	return nil
 }
 
+// parseLogLevel maps DB_LOG_LEVEL to a GORM log level. Slow statements are
+// logged from "warn" up.
+func parseLogLevel(level string) (logger.LogLevel, error) {
+	switch level {
+	case "silent":
+		return logger.Silent, nil
+	case "error":
+		return logger.Error, nil
+	case "warn":
+		return logger.Warn, nil
+	case "info":
+		return logger.Info, nil
+	default:
+		return 0, fmt.Errorf("invalid DB_LOG_LEVEL %q (expected silent, error, warn or info)", level)
+	}
+}
+
 func GetDB() *gorm.DB {
 	return DB
 }
+
+// Close releases the underlying connection pool
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DB_DRIVER picks the database: PostgreSQL, the reference, MySQL 8 or a
+// SQLite file for single-instance and development setups. The models are
+// written for PostgreSQL; the little that does not carry over is adjusted
+// here, before AutoMigrate, rather than in the models themselves.
+
+const (
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+)
+
+// driverName is the DB_DRIVER Initialize connected with
+var driverName = DriverPostgres
+
+// openDialector returns a dialector for the database on host and port, or
+// for the DB_PATH file with sqlite
+func openDialector(db config.DatabaseConfig, host, port string) (gorm.Dialector, error) {
+	switch db.Driver {
+	case DriverMySQL:
+		return openMySQL(db, host, port), nil
+	case DriverSQLite:
+		return openSQLite(db.Path), nil
+	case DriverPostgres, "":
+		return openPostgres(db, host, port)
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q", db.Driver)
+	}
+}
+
+// mysqlConnector opens MySQL connections with the current password
+type mysqlConnector struct {
+	cfg *gomysql.Config
+}
+
+func (c mysqlConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	cfg := c.cfg.Clone()
+	if p, ok := password.Load().(string); ok {
+		cfg.Passwd = p
+	}
+	connector, err := gomysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c mysqlConnector) Driver() driver.Driver {
+	return gomysql.MySQLDriver{}
+}
+
+// openMySQL returns a dialector for the MySQL database on host and port
+// whose connections use the current password
+func openMySQL(db config.DatabaseConfig, host, port string) gorm.Dialector {
+	cfg := gomysql.NewConfig()
+	cfg.User = db.User
+	cfg.Passwd = db.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(host, port)
+	cfg.DBName = db.Name
+	cfg.Collation = "utf8mb4_unicode_ci"
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	return mysql.New(mysql.Config{Conn: sql.OpenDB(mysqlConnector{cfg: cfg})})
+}
+
+// openSQLite returns a dialector for the SQLite database in path. Writers
+// take the lock when their transaction starts and wait for each other
+// instead of failing with "database is locked".
+func openSQLite(path string) gorm.Dialector {
+	params := url.Values{}
+	params.Set("_foreign_keys", "on")
+	params.Set("_journal_mode", "WAL")
+	params.Set("_busy_timeout", "5000")
+	params.Set("_txlock", "immediate")
+	return sqliteDialector{&sqlite.Dialector{DSN: "file:" + path + "?" + params.Encode()}}
+}
+
+// sqliteDialector keeps AutoMigrate from rebuilding the tables with a
+// composite unique index on every start: the driver reports each column of
+// such an index as unique by itself, which never matches the model. It also
+// drops columns without rebuilding the table, which loses its indexes
+type sqliteDialector struct {
+	*sqlite.Dialector
+}
+
+func (d sqliteDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return sqliteMigrator{d.Dialector.Migrator(db), db}
+}
+
+type sqliteMigrator struct {
+	gorm.Migrator
+	db *gorm.DB
+}
+
+// DropColumn uses ALTER TABLE DROP COLUMN (SQLite 3.35 and later), which
+// keeps the other columns' indexes
+func (m sqliteMigrator) DropColumn(dst interface{}, name string) error {
+	stmt := &gorm.Statement{DB: m.db}
+	if err := stmt.Parse(dst); err != nil {
+		return err
+	}
+	if field := stmt.Schema.LookUpField(name); field != nil {
+		name = field.DBName
+	}
+	return m.db.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: stmt.Table}, clause.Column{Name: name}).Error
+}
+
+func (m sqliteMigrator) ColumnTypes(dst interface{}) ([]gorm.ColumnType, error) {
+	columns, err := m.Migrator.ColumnTypes(dst)
+	for i, column := range columns {
+		columns[i] = uniquenessUnknown{column}
+	}
+	return columns, err
+}
+
+// reportedColumn names the embedded column, whose ColumnType method would
+// clash with the field name
+type reportedColumn = gorm.ColumnType
+
+// uniquenessUnknown is a column that does not say whether it is unique
+type uniquenessUnknown struct {
+	reportedColumn
+}
+
+func (uniquenessUnknown) Unique() (bool, bool) {
+	return false, false
+}
+
+// adjustSchemas fits the parsed models to the driver before migrating them.
+// MySQL can only index strings and bytes of a bounded length and cannot
+// give TEXT columns a literal default, so indexed columns without a size
+// get one that fits an index on utf8mb4, and TEXT columns lose their
+// default: GORM then always inserts the value, which is never NULL.
+func adjustSchemas(db *gorm.DB, models ...interface{}) error {
+	if driverName != DriverMySQL {
+		return nil
+	}
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		for _, index := range stmt.Schema.ParseIndexes() {
+			for _, option := range index.Fields {
+				field := option.Field
+				if field.Size != 0 || field.TagSettings["TYPE"] != "" {
+					continue
+				}
+				switch field.DataType {
+				case schema.String:
+					field.Size = 191
+				case schema.Bytes:
+					field.Size = 255
+				}
+			}
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.HasDefaultValue && field.DataType == "text" {
+				field.HasDefaultValue = false
+				field.DefaultValue = ""
+				field.DefaultValueInterface = nil
+			}
+		}
+	}
+	return nil
+}
+
+// Excluded refers to the value an upsert tried to insert into column, for
+// use in the DoUpdates of a clause.OnConflict
+func Excluded(column string) string {
+	if driverName == DriverMySQL {
+		return "VALUES(" + column + ")"
+	}
+	return "EXCLUDED." + column
+}
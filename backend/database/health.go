@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// Ping checks that the primary answers
+func Ping(ctx context.Context) error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// PingReplica checks that a replica answers a read, and reports false
+// without replicas. The resolver picks one at random, so consecutive checks
+// cover all of them.
+func PingReplica(ctx context.Context) (bool, error) {
+	if !replicasEnabled {
+		return false, nil
+	}
+	var one int
+	if err := ReadReplica(ctx).Raw("SELECT 1").Scan(&one).Error; err != nil {
+		return true, err
+	}
+	if one != 1 {
+		return true, fmt.Errorf("unexpected answer %d", one)
+	}
+	return true, nil
+}
+
+// PendingMigrations lists the migrations the database has not run
+func PendingMigrations() ([]string, error) {
+	states, err := MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, s := range states {
+		if !s.Applied {
+			pending = append(pending, s.ID)
+		}
+	}
+	return pending, nil
+}
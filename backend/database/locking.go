@@ -0,0 +1,28 @@
+package database
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Rows several instances may update concurrently carry an
+// optimisticlock.Version: an update through Model(&row) only applies if the
+// version is still the one loaded, and bumps it. Tokens need none, they are
+// written once and only ever deleted.
+
+// ErrConflict reports that a versioned row was changed by another request
+// since it was loaded
+var ErrConflict = errors.New("row was modified concurrently")
+
+// Versioned checks the result of updating a versioned row, turning an
+// update that matched nothing into ErrConflict
+func Versioned(result *gorm.DB) error {
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
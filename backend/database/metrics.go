@@ -0,0 +1,210 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/telemetry"
+
+	"gorm.io/gorm"
+)
+
+// Every statement runs under a timeout derived from the context it was
+// issued with (see WithContext), so a stuck database fails the request
+// instead of hanging it, and is counted per operation and table.
+
+const (
+	startKey     = "metrics:start"
+	cancelKey    = "metrics:cancel"
+	noTimeoutKey = "metrics:no_timeout" // set on sessions whose statements may run long
+)
+
+// QueryStats aggregates the statements of one operation on one table
+type QueryStats struct {
+	Operation string  `json:"operation"`
+	Table     string  `json:"table"`
+	Count     int64   `json:"count"`
+	Errors    int64   `json:"errors"`
+	Timeouts  int64   `json:"timeouts"`
+	Slow      int64   `json:"slow"`
+	TotalMS   float64 `json:"total_ms"`
+	MaxMS     float64 `json:"max_ms"`
+}
+
+// PoolStats describes the connection pool
+type PoolStats struct {
+	MaxOpen        int     `json:"max_open"`
+	Open           int     `json:"open"`
+	InUse          int     `json:"in_use"`
+	Idle           int     `json:"idle"`
+	WaitCount      int64   `json:"wait_count"`
+	WaitMS         float64 `json:"wait_ms"`
+	MaxIdleClosed  int64   `json:"max_idle_closed"`
+	LifetimeClosed int64   `json:"max_lifetime_closed"`
+}
+
+// Stats is a snapshot of the database metrics
+type Stats struct {
+	Pool    PoolStats    `json:"pool"`
+	Queries []QueryStats `json:"queries"`
+}
+
+type queryKey struct {
+	operation string
+	table     string
+}
+
+// statementMetrics is a GORM plugin applying the statement timeout and
+// collecting QueryStats
+type statementMetrics struct {
+	timeout time.Duration
+	slow    time.Duration
+
+	mu      sync.Mutex
+	queries map[queryKey]*QueryStats
+}
+
+var metrics = &statementMetrics{queries: make(map[queryKey]*QueryStats)}
+
+func (m *statementMetrics) Name() string { return "statement_metrics" }
+
+// Initialize registers the callbacks around each kind of statement. Writes
+// are wrapped including their implicit transaction.
+func (m *statementMetrics) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	registrations := []error{
+		cb.Create().Before("gorm:begin_transaction").Register("metrics:before_create", m.before),
+		cb.Create().After("gorm:commit_or_rollback_transaction").Register("metrics:after_create", m.after("create")),
+		cb.Query().Before("gorm:query").Register("metrics:before_query", m.before),
+		cb.Query().After("gorm:after_query").Register("metrics:after_query", m.after("query")),
+		cb.Update().Before("gorm:begin_transaction").Register("metrics:before_update", m.before),
+		cb.Update().After("gorm:commit_or_rollback_transaction").Register("metrics:after_update", m.after("update")),
+		cb.Delete().Before("gorm:begin_transaction").Register("metrics:before_delete", m.before),
+		cb.Delete().After("gorm:commit_or_rollback_transaction").Register("metrics:after_delete", m.after("delete")),
+		cb.Raw().Before("gorm:raw").Register("metrics:before_raw", m.before),
+		cb.Raw().After("gorm:raw").Register("metrics:after_raw", m.after("raw")),
+	}
+	return errors.Join(registrations...)
+}
+
+// before starts the clock and the statement's timeout
+func (m *statementMetrics) before(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+	if _, untimed := db.Get(noTimeoutKey); m.timeout > 0 && !untimed {
+		ctx, cancel := context.WithTimeout(db.Statement.Context, m.timeout)
+		db.Statement.Context = ctx
+		db.InstanceSet(cancelKey, cancel)
+	}
+}
+
+// after releases the timeout and records the statement
+func (m *statementMetrics) after(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if cancel, ok := db.InstanceGet(cancelKey); ok {
+			cancel.(context.CancelFunc)()
+		}
+		start, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		elapsed := time.Since(start.(time.Time))
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		key := queryKey{operation: operation, table: db.Statement.Table}
+		stats, ok := m.queries[key]
+		if !ok {
+			stats = &QueryStats{Operation: key.operation, Table: key.table}
+			m.queries[key] = stats
+		}
+		ms := float64(elapsed) / float64(time.Millisecond)
+		stats.Count++
+		stats.TotalMS += ms
+		stats.MaxMS = max(stats.MaxMS, ms)
+		if m.slow > 0 && elapsed >= m.slow {
+			stats.Slow++
+		}
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			stats.Errors++
+			if errors.Is(db.Error, context.DeadlineExceeded) {
+				stats.Timeouts++
+			}
+		}
+	}
+}
+
+// WithContext returns the database bound to ctx, normally the request's
+// *gin.Context, so statements stop when the client goes away
+func WithContext(ctx context.Context) *gorm.DB {
+	return DB.WithContext(ctx)
+}
+
+// GetStats returns the pool and per-statement metrics, statements with the
+// most total time first
+func GetStats() (Stats, error) {
+	var stats Stats
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return stats, err
+	}
+	pool := sqlDB.Stats()
+	stats.Pool = PoolStats{
+		MaxOpen:        pool.MaxOpenConnections,
+		Open:           pool.OpenConnections,
+		InUse:          pool.InUse,
+		Idle:           pool.Idle,
+		WaitCount:      pool.WaitCount,
+		WaitMS:         float64(pool.WaitDuration) / float64(time.Millisecond),
+		MaxIdleClosed:  pool.MaxIdleClosed,
+		LifetimeClosed: pool.MaxLifetimeClosed,
+	}
+
+	metrics.mu.Lock()
+	for _, q := range metrics.queries {
+		stats.Queries = append(stats.Queries, *q)
+	}
+	metrics.mu.Unlock()
+	sort.Slice(stats.Queries, func(i, j int) bool {
+		return stats.Queries[i].TotalMS > stats.Queries[j].TotalMS
+	})
+	return stats, nil
+}
+
+// WritePrometheus appends the pool and per-statement metrics in the
+// Prometheus text format
+func WritePrometheus(w *strings.Builder) {
+	stats, err := GetStats()
+	if err != nil {
+		return
+	}
+	telemetry.Gauge(w, "ebay_backend_db_open_connections", "Open database connections.", float64(stats.Pool.Open))
+	telemetry.Gauge(w, "ebay_backend_db_in_use_connections", "Database connections in use.", float64(stats.Pool.InUse))
+	telemetry.Gauge(w, "ebay_backend_db_wait_seconds", "Time spent waiting for a database connection.", stats.Pool.WaitMS/1000)
+
+	sort.Slice(stats.Queries, func(i, j int) bool {
+		a, b := stats.Queries[i], stats.Queries[j]
+		if a.Operation != b.Operation {
+			return a.Operation < b.Operation
+		}
+		return a.Table < b.Table
+	})
+	for _, counter := range []struct {
+		name, help string
+		value      func(q QueryStats) float64
+	}{
+		{"ebay_backend_db_statements_total", "Database statements by operation and table.", func(q QueryStats) float64 { return float64(q.Count) }},
+		{"ebay_backend_db_statement_errors_total", "Failed database statements by operation and table.", func(q QueryStats) float64 { return float64(q.Errors) }},
+		{"ebay_backend_db_statement_timeouts_total", "Database statements stopped by DB_QUERY_TIMEOUT.", func(q QueryStats) float64 { return float64(q.Timeouts) }},
+		{"ebay_backend_db_statement_seconds_total", "Time spent in database statements by operation and table.", func(q QueryStats) float64 { return q.TotalMS / 1000 }},
+	} {
+		telemetry.Header(w, counter.name, counter.help, "counter")
+		for _, q := range stats.Queries {
+			fmt.Fprintf(w, "%s{operation=%q,table=%q} %g\n", counter.name, q.Operation, q.Table, counter.value(q))
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+)
+
+// The schema is versioned. Every change to it is a migration, appended to
+// migrations with the UTC time of writing and a short name as ID, e.g.
+//
+//	{
+//		ID: "202611021530_rename_oauth_client_name",
+//		Migrate: func(tx *gorm.DB) error {
+//			return tx.Migrator().RenameColumn(&models.OAuthClient{}, "name", "display_name")
+//		},
+//		Rollback: func(tx *gorm.DB) error {
+//			return tx.Migrator().RenameColumn(&models.OAuthClient{}, "display_name", "name")
+//		},
+//	},
+//
+// New columns too: nothing brings the tables in line with the models
+// behind the migrations' back. A migration that adds columns declares the
+// model it adds them to inside itself, with only those fields, so it keeps
+// doing what it did when the model changes again. The first migration is
+// the baseline (see baseline.go), which also takes over databases created
+// before migrations existed.
+
+const migrationsTable = "schema_migrations"
+
+// migrations run in this order. Never change or remove one that has been
+// released: add another.
+var migrations = []*gormigrate.Migration{
+	{
+		ID:      "202610151220_baseline",
+		Migrate: migrateBaseline,
+		// Rolling back would drop every table
+	},
+	{
+		ID: "202610151326_ebay_account_type",
+		Migrate: func(tx *gorm.DB) error {
+			type EbayCredential struct {
+				EbayAccountType             string
+				EbayRegistrationMarketplace string
+			}
+			return addColumns(tx, &EbayCredential{}, "EbayAccountType", "EbayRegistrationMarketplace")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			type EbayCredential struct{}
+			return dropColumns(tx, &EbayCredential{}, "ebay_account_type", "ebay_registration_marketplace")
+		},
+	},
+	{
+		ID: "202610151519_oauth_code_binding",
+		Migrate: func(tx *gorm.DB) error {
+			type OAuthAuthorizationCode struct {
+				CodeChallenge       string `gorm:"not null;default:''"`
+				CodeChallengeMethod string `gorm:"not null;default:''"`
+				Resource            string `gorm:"type:text;not null;default:''"`
+			}
+			type OAuthAccessToken struct {
+				Resource string `gorm:"type:text;not null;default:''"`
+			}
+			type OAuthRefreshToken struct {
+				Resource string `gorm:"type:text;not null;default:''"`
+			}
+			if err := addColumns(tx, &OAuthAuthorizationCode{}, "CodeChallenge", "CodeChallengeMethod", "Resource"); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &OAuthAccessToken{}, "Resource"); err != nil {
+				return err
+			}
+			return addColumns(tx, &OAuthRefreshToken{}, "Resource")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			type OAuthAuthorizationCode struct{}
+			type OAuthAccessToken struct{}
+			type OAuthRefreshToken struct{}
+			if err := dropColumns(tx, &OAuthAuthorizationCode{}, "code_challenge", "code_challenge_method", "resource"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &OAuthAccessToken{}, "resource"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &OAuthRefreshToken{}, "resource")
+		},
+	},
+	{
+		ID: "202610161040_spend_records",
+		Migrate: func(tx *gorm.DB) error {
+			type SpendRecord struct {
+				ID        uint   `gorm:"primaryKey"`
+				Account   string `gorm:"not null;uniqueIndex:idx_spend_record"`
+				Day       string `gorm:"size:10;not null;uniqueIndex:idx_spend_record"`
+				Currency  string `gorm:"size:3;not null;uniqueIndex:idx_spend_record"`
+				Cents     int64  `gorm:"not null;default:0"`
+				UpdatedAt time.Time
+			}
+			if err := adjustSchemas(tx, &SpendRecord{}); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(&SpendRecord{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("spend_records")
+		},
+	},
+}
+
+// addColumns adds the fields of model, by Go name, that its table lacks.
+// Databases created by builds that brought the tables in line with the
+// models at startup may have them already.
+func addColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	if err := adjustSchemas(tx, model); err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropColumns drops the columns of model's table that exist
+func dropColumns(tx *gorm.DB, model interface{}, columns ...string) error {
+	for _, column := range columns {
+		if !tx.Migrator().HasColumn(model, column) {
+			continue
+		}
+		if err := tx.Migrator().DropColumn(model, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrationState is whether one migration has run
+type MigrationState struct {
+	ID      string `json:"id"`
+	Applied bool   `json:"applied"`
+}
+
+// migrator runs the migrations without the statement timeout, since
+// backfills may take a while. MySQL commits schema changes on its own, so
+// there a failed migration may leave part of its work behind.
+func migrator() *gormigrate.Gormigrate {
+	return gormigrate.New(DB.Set(noTimeoutKey, true), &gormigrate.Options{
+		TableName:      migrationsTable,
+		UseTransaction: driverName != DriverMySQL,
+	}, migrations)
+}
+
+// MigrateUp runs the pending migrations, or those up to and including the
+// one with ID to
+func MigrateUp(to string) error {
+	m := migrator()
+	if to != "" {
+		if err := m.MigrateTo(to); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+		log.Printf("Database migrated to %s", to)
+		return nil
+	}
+	if err := m.Migrate(); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	log.Println("Database migration completed")
+	return nil
+}
+
+// MigrateDown rolls back the last steps migrations. The baseline can't be
+// rolled back.
+func MigrateDown(steps int) error {
+	m := migrator()
+	for i := 0; i < steps; i++ {
+		if err := m.RollbackLast(); err != nil {
+			if errors.Is(err, gormigrate.ErrNoMigrationDefined) || errors.Is(err, gormigrate.ErrNoRunMigration) {
+				return errors.New("no migration to roll back")
+			}
+			return fmt.Errorf("failed to roll back database: %w", err)
+		}
+	}
+	return nil
+}
+
+// MigrationStatus lists the migrations in order
+func MigrationStatus() ([]MigrationState, error) {
+	applied := make(map[string]bool)
+	if DB.Migrator().HasTable(migrationsTable) {
+		var ids []string
+		if err := DB.Table(migrationsTable).Pluck("id", &ids).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			applied[id] = true
+		}
+	}
+
+	var states []MigrationState
+	for _, m := range migrations {
+		states = append(states, MigrationState{ID: m.ID, Applied: applied[m.ID]})
+	}
+	return states, nil
+}
+
+// checkMigrated fails while migrations are pending, so an instance never
+// runs against a schema older than its models
+func checkMigrated() error {
+	pending, err := PendingMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to read migration status: %w", err)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is out of date (pending: %s); run `backend migrate up`",
+			strings.Join(pending, ", "))
+	}
+	return nil
+}
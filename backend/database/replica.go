@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Read replicas are opt-in per query: only statements issued through
+// ReadReplica go to a replica, everything else, token issuance and the
+// auth checks in particular, stays on the primary and never sees
+// replication lag.
+
+const replicaResolver = "replica"
+
+var replicasEnabled bool
+
+// registerReplicas connects the replicas from DB_REPLICA_HOSTS, if any
+func registerReplicas(db config.DatabaseConfig) error {
+	if len(db.Replicas) == 0 {
+		return nil
+	}
+	if db.Driver == DriverSQLite {
+		return errors.New("DB_REPLICA_HOSTS is not supported with DB_DRIVER=sqlite")
+	}
+
+	dialectors := make([]gorm.Dialector, 0, len(db.Replicas))
+	for _, replica := range db.Replicas {
+		host, port, ok := strings.Cut(replica, ":")
+		if !ok {
+			port = db.Port
+		}
+		dialector, err := openDialector(db, host, port)
+		if err != nil {
+			return err
+		}
+		dialectors = append(dialectors, dialector)
+	}
+
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: dialectors,
+		Policy:   dbresolver.RandomPolicy{},
+	}, replicaResolver).
+		SetMaxOpenConns(db.MaxOpenConns).
+		SetMaxIdleConns(db.MaxIdleConns).
+		SetConnMaxLifetime(db.ConnMaxLifetime).
+		SetConnMaxIdleTime(db.ConnMaxIdleTime)
+	if err := DB.Use(resolver); err != nil {
+		return err
+	}
+	replicasEnabled = true
+	return nil
+}
+
+// ReadReplica returns the database bound to ctx for reads that tolerate
+// replication lag: audit queries, dashboards and admin listings. Without
+// replicas it is the same as WithContext.
+func ReadReplica(ctx context.Context) *gorm.DB {
+	if !replicasEnabled {
+		return WithContext(ctx)
+	}
+	return WithContext(ctx).Clauses(dbresolver.Use(replicaResolver), dbresolver.Read)
+}
@@ -1,13 +0,0 @@
-module ebay-mcp/backend
-
-go 1.21
-
-require (
-	github.com/gin-contrib/cors v1.5.0
-	github.com/gin-gonic/gin v1.9.1
-	github.com/golang-jwt/jwt/v5 v5.2.0
-	github.com/google/uuid v1.5.0
-	golang.org/x/crypto v0.17.0
-	gorm.io/driver/postgres v1.5.4
-	gorm.io/gorm v1.25.5
-)
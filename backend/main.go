@@ -1,49 +1,11 @@
 package main
 
 import (
-	"log"
 	"os"
 
-	"ebay-mcp/backend/config"
-	"ebay-mcp/backend/database"
-	"ebay-mcp/backend/routes"
-
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
+	"github.com/ayouroukov/ebay-mcp/backend/app"
 )
 
 func main() {
-	// Load configuration
-	cfg := config.Load()
-
-	// Initialize database
-	if err := database.Initialize(cfg); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
-	}
-
-	// Create Gin router
-	router := gin.Default()
-
-	// Configure CORS
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{cfg.FrontendURL},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-	}))
-
-	// Setup routes
-	routes.SetupRoutes(router, cfg)
-
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	log.Printf("Starting server on port %s...", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
-	}
+	app.Main(os.Args[1:])
 }
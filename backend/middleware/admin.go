@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin allows only users with the admin role. It must run after
+// AuthMiddleware; the loaded user is stored in the context as "admin".
+func RequireAdmin() gin.HandlerFunc {
+	return RequirePermission("")
+}
+
+// RequirePermission allows only admins holding permission (any admin when
+// permission is empty). It must run after AuthMiddleware or
+// ServiceAuthMiddleware; service clients need the "admin:<permission>" scope
+// and never pass RequireAdmin or impersonation checks.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scope, ok := c.Get("service_scope"); ok {
+			if permission == "" || permission == models.PermImpersonateUser ||
+				!models.ScopeCovers(scope.(string), models.ServiceScopePrefix+permission) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Missing scope: " + models.ServiceScopePrefix + permission})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		userID, _ := c.Get("user_id")
+
+		var user models.User
+		if err := database.WithContext(c).First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		if !user.IsAdmin() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+		if permission != "" && !user.HasPermission(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing admin permission: " + permission})
+			c.Abort()
+			return
+		}
+
+		c.Set("admin", &user)
+		c.Next()
+	}
+}
+
+// RequireTwoFactor guards admin routes: users with two-factor authentication
+// must have signed in with their second factor, and with REQUIRE_ADMIN_2FA
+// users without it are turned away. Service clients pass. It must run after
+// AuthMiddleware or ServiceAuthMiddleware.
+func RequireTwoFactor(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("service_scope"); ok {
+			c.Next()
+			return
+		}
+
+		if c.GetBool("two_factor_enabled") && !c.GetBool("mfa") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "two_factor_required"})
+			c.Abort()
+			return
+		}
+		if cfg.Login.RequireAdmin2FA && !c.GetBool("two_factor_enabled") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication must be enabled for admin actions"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audit records an audit event for every request to the route, named action
+// (or action + "_failed" for error responses). See audit.Middleware.
+func Audit(action string) gin.HandlerFunc {
+	return audit.Middleware(database.DB, action)
+}
@@ -1,45 +1,173 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
-	"ebay-mcp/backend/config"
-	"ebay-mcp/backend/utils"
+	"github.com/ayouroukov/ebay-mcp/backend/audit"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/database"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
+	"github.com/ayouroukov/ebay-mcp/backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
+// bearerToken extracts the token from "Authorization: Bearer <token>",
+// writing a 401 when there is none
+func bearerToken(c *gin.Context) (string, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		return "", false
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		return "", false
+	}
+	return parts[1], true
+}
+
 // AuthMiddleware validates JWT tokens
 func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		token, ok := bearerToken(c)
+		if !ok {
 			c.Abort()
 			return
 		}
+		authenticateUser(c, cfg, token)
+	}
+}
 
-		// Extract token from "Bearer <token>"
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+// ServiceAuthMiddleware is AuthMiddleware that also accepts access tokens
+// from the client_credentials grant, for routes internal services may call.
+// Such requests set "service_client_id" and "service_scope" instead of
+// "user_id"; RequirePermission checks the scope.
+func ServiceAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c)
+		if !ok {
 			c.Abort()
 			return
 		}
+		// JWTs always contain dots, OAuth access tokens never do
+		if strings.Contains(token, ".") {
+			authenticateUser(c, cfg, token)
+			return
+		}
 
-		token := parts[1]
-
-		// Validate token
-		claims, err := utils.ValidateJWT(token, cfg.JWTSecret)
-		if err != nil {
+		var accessToken models.OAuthAccessToken
+		err := database.WithContext(c).Preload("Client").
+			Where("token = ? AND user_id IS NULL AND expires_at > ?", token, time.Now()).
+			First(&accessToken).Error
+		// A deleted client loads empty; one no longer allowed the grant
+		// loses its outstanding tokens too
+		if err != nil || !accessToken.Client.Service {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
-		// Set user ID in context
-		c.Set("user_id", claims.UserID)
+		c.Set("service_client_id", accessToken.ClientID)
+		c.Set("service_scope", serviceScope(accessToken.Scope, accessToken.Client.AllowedScopeList()))
+		audit.SetClient(c, accessToken.ClientID)
 		c.Next()
 	}
 }
+
+// serviceScope is the part of a service token's scope still in force:
+// admin: scopes only count while the client is allowed them, so tokens
+// issued before an admin scope was withdrawn lose it
+func serviceScope(scope string, allowed []string) string {
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		allowedSet[name] = true
+	}
+	var kept []string
+	for _, name := range models.ParseScope(scope) {
+		if strings.HasPrefix(name, models.ServiceScopePrefix) && !allowedSet[name] {
+			continue
+		}
+		kept = append(kept, name)
+	}
+	return strings.Join(kept, " ")
+}
+
+// authenticateUser validates a user's JWT and continues the chain
+func authenticateUser(c *gin.Context, cfg *config.Config, token string) {
+	// Validate token
+	claims, err := utils.ValidateJWT(token, cfg.JWTSecret)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return
+	}
+
+	user, ok := checkUserStatus(c, claims)
+	if !ok {
+		c.Abort()
+		return
+	}
+
+	// Set user ID in context
+	c.Set("user_id", claims.UserID)
+	c.Set("mfa", claims.MFA)
+	c.Set("two_factor_enabled", user.TwoFactorEnabled())
+
+	if claims.ImpersonationID != 0 && !checkImpersonation(c, claims) {
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// checkUserStatus loads the token's user, rejecting tokens of disabled users
+// and sessions an admin revoked
+func checkUserStatus(c *gin.Context, claims *utils.JWTClaims) (*models.User, bool) {
+	var user models.User
+	if err := database.WithContext(c).First(&user, claims.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return nil, false
+	}
+	if user.IsDisabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return nil, false
+	}
+	if claims.IssuedAt == nil || !user.SessionValid(claims.IssuedAt.Time) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// checkImpersonation validates an impersonation token's session and marks the
+// request as impersonated. Sessions are read-only unless the admin enabled
+// mutations when starting them.
+func checkImpersonation(c *gin.Context, claims *utils.JWTClaims) bool {
+	var session models.ImpersonationSession
+	if err := database.WithContext(c).First(&session, claims.ImpersonationID).Error; err != nil || !session.IsActive(time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Impersonation session has ended"})
+		return false
+	}
+
+	log.Printf("[IMPERSONATION] admin %d as user %d (session %d): %s %s",
+		session.AdminID, session.UserID, session.ID, c.Request.Method, c.Request.URL.Path)
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		if !session.AllowMutations {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Impersonation session is read-only"})
+			return false
+		}
+	}
+
+	c.Set("impersonator_id", session.AdminID)
+	c.Set("impersonation_id", session.ID)
+	return true
+}
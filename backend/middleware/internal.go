@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/internal/signing"
+	"github.com/ayouroukov/ebay-mcp/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// internalNonceTTL is how long the nonce of an accepted internal request is
+// remembered: long enough that its timestamp has left the replay window on
+// either side of now
+const internalNonceTTL = 2 * signing.ReplayWindow
+
+// internalBodyLimit caps the bodies read before the signature is checked;
+// the proxy's internal calls send small JSON objects
+const internalBodyLimit = 1 << 20
+
+// InternalAuth accepts only requests the proxy signed with one of
+// INTERNAL_SIGNING_SECRETS, within the replay window and with a fresh nonce.
+// Nonces are kept in the shared store (CACHE_BACKEND), so a request can't be
+// replayed to another replica either. The routes don't exist while no
+// secret is configured.
+func InternalAuth(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(cfg.InternalSecrets) == 0 {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "The internal API is disabled"})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, internalBodyLimit))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		nonce, err := signing.Verify(c.Request, cfg.InternalSecrets, body, time.Now())
+		switch {
+		case errors.Is(err, signing.ErrMissing):
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing request signature"})
+			return
+		case errors.Is(err, signing.ErrExpired):
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Request timestamp is outside the replay window"})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid request signature"})
+			return
+		}
+
+		// A store that can't be reached can't tell a replay either, so the
+		// request is refused rather than let through
+		fresh, err := cfg.Store.Add(c.Request.Context(), store.KeyPrefix()+"internal-nonce:"+nonce, []byte("1"), internalNonceTTL)
+		if err != nil {
+			log.Printf("Failed to record internal request nonce: %v", err)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to check the request nonce"})
+			return
+		}
+		if !fresh {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Request was already received"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditEvent records an administrative or security-relevant action: logins,
+// consent decisions, token issuance and revocation, admin changes
+type AuditEvent struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	ActorID        *uint     `gorm:"index" json:"actor_id"`                  // nil for system actions (e.g. bootstrap)
+	ImpersonatorID *uint     `gorm:"index" json:"impersonator_id,omitempty"` // admin acting as ActorID, if impersonating
+	ClientID       string    `gorm:"index" json:"client_id,omitempty"`       // OAuth client involved, if any
+	Action         string    `gorm:"not null;index" json:"action"`
+	TargetType     string    `gorm:"index" json:"target_type"`
+	TargetID       string    `gorm:"index" json:"target_id"`
+	Details        string    `gorm:"type:text" json:"details"` // JSON object
+	IP             string    `json:"ip"`
+	CreatedAt      time.Time `gorm:"index" json:"created_at"`
+}
+
+// ArchivedAuditEvent is an AuditEvent moved to the audit_events_archive cold
+// table by `backend archive`, keeping audit_events small
+type ArchivedAuditEvent AuditEvent
+
+func (ArchivedAuditEvent) TableName() string { return "audit_events_archive" }
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+// EbayCredential is a user's linked eBay account in one eBay environment
+// ("production" or "sandbox"). The refresh token is encrypted with
+// CREDENTIALS_ENCRYPTION_KEY and only handed out to the proxy over the
+// internal API.
+type EbayCredential struct {
+	ID                          uint      `gorm:"primaryKey" json:"id"`
+	UserID                      uint      `gorm:"not null;uniqueIndex:idx_ebay_credential_user_env" json:"user_id"`
+	Environment                 string    `gorm:"not null;uniqueIndex:idx_ebay_credential_user_env" json:"environment"`
+	RefreshToken                string    `gorm:"type:text;not null" json:"-"`
+	Scopes                      string    `gorm:"type:text;not null;default:''" json:"scopes"` // space-separated
+	Marketplace                 string    `json:"marketplace"`
+	Language                    string    `json:"language"`
+	EbayUserID                  string    `gorm:"index" json:"ebay_user_id"`
+	EbayUsername                string    `json:"ebay_username"`
+	EbayAccountType             string    `json:"ebay_account_type"`             // INDIVIDUAL or BUSINESS
+	EbayRegistrationMarketplace string    `json:"ebay_registration_marketplace"` // e.g. EBAY_US
+	CreatedAt                   time.Time `json:"created_at"`
+	UpdatedAt                   time.Time `json:"updated_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// UsageRecord counts the eBay calls the proxy made for a user through a
+// client, per day and eBay operation
+type UsageRecord struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_usage_record" json:"user_id"` // 0 for client_credentials tokens
+	ClientID  string    `gorm:"not null;uniqueIndex:idx_usage_record" json:"client_id"`
+	Day       time.Time `gorm:"type:date;not null;uniqueIndex:idx_usage_record" json:"day"`
+	Operation string    `gorm:"not null;uniqueIndex:idx_usage_record" json:"operation"`
+	Calls     int64     `gorm:"not null;default:0" json:"calls"`
+	Errors    int64     `gorm:"not null;default:0" json:"errors"` // answered with a 4xx or 5xx status
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SpendRecord is what an account bought through the proxy's purchase tools
+// on a UTC day, in cents of one currency, counted against the policy's
+// daily spend limit
+type SpendRecord struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Account   string    `gorm:"not null;uniqueIndex:idx_spend_record" json:"account"`
+	Day       string    `gorm:"size:10;not null;uniqueIndex:idx_spend_record" json:"day"` // 2006-01-02
+	Currency  string    `gorm:"size:3;not null;uniqueIndex:idx_spend_record" json:"currency"`
+	Cents     int64     `gorm:"not null;default:0" json:"cents"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
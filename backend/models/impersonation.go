@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// ImpersonationSession lets an admin act as a user for a limited time, e.g.
+// to debug the user's linked eBay account. Tokens issued for the session stop
+// working once it expires or is ended.
+type ImpersonationSession struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	AdminID        uint       `gorm:"not null;index" json:"admin_id"`
+	UserID         uint       `gorm:"not null;index" json:"user_id"`
+	Reason         string     `gorm:"type:text;not null" json:"reason"`
+	AllowMutations bool       `gorm:"not null;default:false" json:"allow_mutations"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	EndedAt        *time.Time `json:"ended_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// IsActive reports whether the session can still be used
+func (s *ImpersonationSession) IsActive(now time.Time) bool {
+	return s.EndedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -1,21 +1,29 @@
 package models
 
 import (
+	"encoding/json"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/plugin/optimisticlock"
 )
 
 // OAuthClient represents a third-party application that wants to access user data
 type OAuthClient struct {
-	ID           string         `gorm:"primaryKey" json:"id"`
-	ClientSecret string         `gorm:"not null" json:"-"`
-	Name         string         `gorm:"not null" json:"name"`
-	RedirectURIs string         `gorm:"type:text;not null" json:"redirect_uris"` // JSON array of allowed redirect URIs
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            string         `gorm:"primaryKey" json:"id"`
+	ClientSecret  string         `gorm:"not null" json:"-"`
+	Name          string         `gorm:"not null" json:"name"`
+	RedirectURIs  string         `gorm:"type:text;not null" json:"redirect_uris"`             // JSON array of allowed redirect URIs
+	Trusted       bool           `gorm:"default:false" json:"trusted"`                        // first-party client: users are never asked for consent
+	AllowedScopes string         `gorm:"type:text;not null;default:''" json:"allowed_scopes"` // space-separated restricted scopes the client may request
+	Service       bool           `gorm:"default:false" json:"service"`                        // may use the client_credentials grant
+	PublicKeys    string         `gorm:"type:text;not null;default:''" json:"public_keys"`    // JSON array of PEM keys for private_key_jwt
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // BeforeCreate hook to generate UUID
@@ -26,6 +34,34 @@ func (c *OAuthClient) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// PublicKeyList returns the PEM public keys registered for private_key_jwt
+// client authentication
+func (c *OAuthClient) PublicKeyList() []string {
+	var keys []string
+	if c.PublicKeys != "" {
+		json.Unmarshal([]byte(c.PublicKeys), &keys)
+	}
+	return keys
+}
+
+// EncodePublicKeys encodes PEM public keys for OAuthClient.PublicKeys
+func EncodePublicKeys(keys []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(keys)
+	return string(data)
+}
+
+// OAuthClientAssertion remembers the jti of a JWT a client authenticated
+// with until the JWT expires, so the JWT can't be replayed
+type OAuthClientAssertion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ClientID  string    `gorm:"not null;uniqueIndex:idx_oauth_client_assertion_jti" json:"client_id"`
+	JTI       string    `gorm:"not null;uniqueIndex:idx_oauth_client_assertion_jti" json:"jti"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
 // OAuthAuthorizationCode represents a temporary authorization code
 type OAuthAuthorizationCode struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
@@ -38,18 +74,29 @@ type OAuthAuthorizationCode struct {
 	Used        bool      `gorm:"default:false;index" json:"used"`
 	CreatedAt   time.Time `json:"created_at"`
 
+	// PKCE (RFC 7636): the exchange needs the verifier of the challenge
+	CodeChallenge       string `gorm:"not null;default:''" json:"-"`
+	CodeChallengeMethod string `gorm:"not null;default:''" json:"-"`
+	// Resource (RFC 8707) the tokens are for, "" for any
+	Resource string `gorm:"type:text;not null;default:''" json:"resource"`
+
+	// Only one concurrent exchange of the code can mark it used
+	Version optimisticlock.Version `gorm:"not null;default:1" json:"-"`
+
 	// Relationships
 	Client OAuthClient `gorm:"foreignKey:ClientID" json:"-"`
 	User   User        `gorm:"foreignKey:UserID" json:"-"`
 }
 
-// OAuthAccessToken represents an access token for API access
+// OAuthAccessToken represents an access token for API access. Tokens from
+// the client_credentials grant act for the client itself and have no user.
 type OAuthAccessToken struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Token     string    `gorm:"uniqueIndex;not null" json:"token"`
 	ClientID  string    `gorm:"not null;index" json:"client_id"`
-	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	UserID    *uint     `gorm:"index" json:"user_id"`
 	Scope     string    `gorm:"type:text" json:"scope"`
+	Resource  string    `gorm:"type:text;not null;default:''" json:"resource"` // audience (RFC 8707), "" for any
 	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
 
@@ -65,6 +112,7 @@ type OAuthRefreshToken struct {
 	ClientID  string    `gorm:"not null;index" json:"client_id"`
 	UserID    uint      `gorm:"not null;index" json:"user_id"`
 	Scope     string    `gorm:"type:text" json:"scope"`
+	Resource  string    `gorm:"type:text;not null;default:''" json:"resource"` // audience (RFC 8707), "" for any
 	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
 
@@ -72,3 +120,61 @@ type OAuthRefreshToken struct {
 	Client OAuthClient `gorm:"foreignKey:ClientID" json:"-"`
 	User   User        `gorm:"foreignKey:UserID" json:"-"`
 }
+
+// OAuthConsent records the scopes a user has approved for a client, so that
+// later authorizations for the same (or fewer) scopes skip the consent screen
+type OAuthConsent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_oauth_consent_user_client" json:"user_id"`
+	ClientID  string    `gorm:"not null;uniqueIndex:idx_oauth_consent_user_client" json:"client_id"`
+	Scope     string    `gorm:"type:text" json:"scope"` // space-separated union of approved scopes
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Concurrent approvals are merged instead of overwriting each other
+	Version optimisticlock.Version `gorm:"not null;default:1" json:"-"`
+
+	// Relationships
+	Client OAuthClient `gorm:"foreignKey:ClientID" json:"-"`
+	User   User        `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// Covers reports whether every scope in the space-separated scope was
+// approved
+func (c *OAuthConsent) Covers(scope string) bool {
+	return ScopeCovers(c.Scope, scope)
+}
+
+// Grant adds the space-separated scope to the approved scopes
+func (c *OAuthConsent) Grant(scope string) {
+	scopes := ParseScope(c.Scope + " " + scope)
+	sort.Strings(scopes)
+	c.Scope = strings.Join(scopes, " ")
+}
+
+// Device authorization states
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+// OAuthDeviceCode is a pending device authorization (RFC 8628): the device
+// polls with DeviceCode while the user approves UserCode in a browser
+type OAuthDeviceCode struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	DeviceCode   string     `gorm:"uniqueIndex;not null" json:"-"`
+	UserCode     string     `gorm:"uniqueIndex;not null" json:"user_code"`
+	ClientID     string     `gorm:"not null;index" json:"client_id"`
+	Scope        string     `gorm:"type:text" json:"scope"`
+	UserID       *uint      `gorm:"index" json:"user_id"` // set once the user decides
+	Status       string     `gorm:"not null;default:'pending'" json:"status"`
+	Used         bool       `gorm:"default:false" json:"used"` // tokens were issued
+	Interval     int        `gorm:"not null" json:"interval"`  // seconds between polls
+	LastPolledAt *time.Time `json:"last_polled_at"`
+	ExpiresAt    time.Time  `gorm:"not null;index" json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	// Relationships
+	Client OAuthClient `gorm:"foreignKey:ClientID" json:"-"`
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hash algorithms
+const (
+	PasswordBcrypt   = "bcrypt"
+	PasswordArgon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordHashing is how new password hashes are made
+type PasswordHashing struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Time    uint32
+	Argon2Memory  uint32 // KiB
+	Argon2Threads uint8
+}
+
+var (
+	passwordHashing = PasswordHashing{
+		Algorithm:     PasswordBcrypt,
+		BcryptCost:    bcrypt.DefaultCost,
+		Argon2Time:    3,
+		Argon2Memory:  64 * 1024,
+		Argon2Threads: 2,
+	}
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// SetPasswordHashing changes how new password hashes are made
+func SetPasswordHashing(p PasswordHashing) error {
+	switch p.Algorithm {
+	case PasswordBcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case PasswordArgon2id:
+		if p.Argon2Time < 1 || p.Argon2Threads < 1 || p.Argon2Memory < 8*uint32(p.Argon2Threads) {
+			return fmt.Errorf("argon2id needs at least 1 pass, 1 thread and 8 KiB of memory per thread")
+		}
+	default:
+		return fmt.Errorf("unknown password hash algorithm %q", p.Algorithm)
+	}
+	passwordHashing = p
+	return nil
+}
+
+// hashPassword hashes password with the current settings
+func hashPassword(password string) (string, error) {
+	p := passwordHashing
+	if p.Algorithm == PasswordArgon2id {
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, argon2KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Argon2Memory, p.Argon2Time, p.Argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), p.BcryptCost)
+	return string(hash), err
+}
+
+// argon2Hash is a decoded "$argon2id$v=19$m=...,t=...,p=...$salt$key" hash
+type argon2Hash struct {
+	params    PasswordHashing
+	salt, key []byte
+}
+
+func parseArgon2Hash(hash string) (*argon2Hash, bool) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != PasswordArgon2id {
+		return nil, false
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, false
+	}
+	h := argon2Hash{params: PasswordHashing{Algorithm: PasswordArgon2id}}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.params.Argon2Memory, &h.params.Argon2Time, &h.params.Argon2Threads); err != nil {
+		return nil, false
+	}
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, false
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, false
+	}
+	return &h, true
+}
+
+// checkPassword compares password with a bcrypt or argon2id hash
+func checkPassword(hash, password string) bool {
+	if strings.HasPrefix(hash, "$"+PasswordArgon2id+"$") {
+		h, ok := parseArgon2Hash(hash)
+		if !ok {
+			return false
+		}
+		p := h.params
+		key := argon2.IDKey([]byte(password), h.salt, p.Argon2Time, p.Argon2Memory, p.Argon2Threads, uint32(len(h.key)))
+		return subtle.ConstantTimeCompare(key, h.key) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// passwordNeedsRehash reports whether hash was made with other settings
+// than the current ones
+func passwordNeedsRehash(hash string) bool {
+	p := passwordHashing
+	if p.Algorithm == PasswordArgon2id {
+		h, ok := parseArgon2Hash(hash)
+		return !ok || h.params.Argon2Time != p.Argon2Time || h.params.Argon2Memory != p.Argon2Memory ||
+			h.params.Argon2Threads != p.Argon2Threads
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != p.BcryptCost
+}
+
+// DummyPasswordCheck takes as long as checking a real password, so sign-ins
+// for unknown or locked accounts can't be told apart by their timing
+func DummyPasswordCheck(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = hashPassword("dummy password for timing")
+	})
+	checkPassword(dummyHash, password)
+}
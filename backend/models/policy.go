@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProxyPolicy stores a named eBay proxy policy document (the YAML format
+// produced by `ebay-mcp config export`) so it can be provisioned alongside
+// clients and users
+type ProxyPolicy struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	Name      string         `gorm:"uniqueIndex;not null" json:"name"`
+	Document  string         `gorm:"type:text;not null" json:"document"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// OAuthScope is a scope clients may request. The description is shown on
+// the consent screen. Restricted scopes are only granted to clients that
+// list them in OAuthClient.AllowedScopes. Consenting to a write scope
+// needs a two-factor session when the user has two-factor authentication.
+type OAuthScope struct {
+	Name        string    `gorm:"primaryKey" json:"name"`
+	Description string    `gorm:"type:text;not null;default:''" json:"description"`
+	Restricted  bool      `gorm:"default:false" json:"restricted"`
+	Write       bool      `gorm:"default:false" json:"write"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ServiceScopePrefix prefixes the scopes that give client_credentials tokens
+// an admin permission: "admin:view_audit" grants models.PermViewAudit
+const ServiceScopePrefix = "admin:"
+
+// scopeNamePattern matches the scope-token syntax of RFC 6749 section 3.3,
+// which excludes spaces, double quotes and backslashes
+var scopeNamePattern = regexp.MustCompile(`^[\x21\x23-\x5B\x5D-\x7E]+$`)
+
+// ValidScopeName reports whether name can be used as a scope
+func ValidScopeName(name string) bool {
+	return scopeNamePattern.MatchString(name)
+}
+
+// ParseScope splits a space-separated scope into its scopes, without
+// duplicates
+func ParseScope(scope string) []string {
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// ScopeCovers reports whether every scope in requested is also in granted
+func ScopeCovers(granted, requested string) bool {
+	have := make(map[string]bool)
+	for _, s := range strings.Fields(granted) {
+		have[s] = true
+	}
+	for _, s := range strings.Fields(requested) {
+		if !have[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowedScopeList returns the scopes the client may request beyond the
+// unrestricted ones
+func (c *OAuthClient) AllowedScopeList() []string {
+	return ParseScope(c.AllowedScopes)
+}
@@ -1,34 +1,157 @@
 package models
 
 import (
+	"sort"
+	"strings"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Admin permissions. An admin may hold any combination; PermissionAll grants
+// every permission, including ones added later.
+const (
+	PermManageClients   = "manage_clients"
+	PermViewAudit       = "view_audit"
+	PermManagePolicies  = "manage_policies"
+	PermImpersonateUser = "impersonate_user"
+	PermManageUsers     = "manage_users"
+	PermissionAll       = "*"
+)
+
+// AllPermissions lists every grantable permission
+var AllPermissions = []string{PermManageClients, PermViewAudit, PermManagePolicies, PermImpersonateUser, PermManageUsers}
+
+// ValidPermission reports whether p can be granted
+func ValidPermission(p string) bool {
+	if p == PermissionAll {
+		return true
+	}
+	for _, known := range AllPermissions {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
 type User struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Email     string         `gorm:"uniqueIndex;not null" json:"email"`
-	Password  string         `gorm:"not null" json:"-"` // Never send password in JSON
-	Name      string         `gorm:"not null" json:"name"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Email       string         `gorm:"uniqueIndex;not null" json:"email"`
+	Password    string         `gorm:"not null" json:"-"` // Never send password in JSON
+	Name        string         `gorm:"not null" json:"name"`
+	Role        string         `gorm:"not null;default:user" json:"role"`
+	Permissions string         `gorm:"type:text;not null;default:''" json:"permissions"` // comma-separated, admins only
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Set by admins; a disabled user can't sign in or use any token
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason string     `gorm:"type:text" json:"disabled_reason,omitempty"`
+	// JWTs issued at or before this time are rejected
+	SessionsRevokedAt *time.Time `json:"-"`
+	// Wrong passwords since the last sign-in; reaching the limit locks the
+	// account until LockedUntil
+	FailedLogins int        `gorm:"not null;default:0" json:"-"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+
+	// Two-factor authentication: the TOTP secret, encrypted with
+	// TOTP_ENCRYPTION_KEY, is set at setup and used once TOTPEnabledAt is set
+	TOTPSecret    string     `gorm:"type:text;not null;default:''" json:"-"`
+	TOTPEnabledAt *time.Time `json:"two_factor_enabled_at,omitempty"`
+	TOTPLastStep  int64      `gorm:"not null;default:0" json:"-"` // time step of the last accepted code
+}
+
+// IsDisabled reports whether an admin disabled the account
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// TwoFactorEnabled reports whether sign-in needs a TOTP code
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// IsLocked reports whether too many wrong passwords locked the account
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
 }
 
-// HashPassword hashes the user's password using bcrypt
+// SessionValid reports whether a JWT issued at issuedAt is still accepted.
+// JWT times have second precision, so tokens from the second of the
+// revocation are rejected too.
+func (u *User) SessionValid(issuedAt time.Time) bool {
+	return u.SessionsRevokedAt == nil || issuedAt.After(u.SessionsRevokedAt.Truncate(time.Second))
+}
+
+// IsAdmin reports whether the user has the admin role
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// PermissionList returns the user's permissions
+func (u *User) PermissionList() []string {
+	var perms []string
+	for _, p := range strings.Split(u.Permissions, ",") {
+		if p != "" {
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+// SetPermissions stores perms in a stable order
+func (u *User) SetPermissions(perms []string) {
+	sorted := append([]string{}, perms...)
+	sort.Strings(sorted)
+	u.Permissions = strings.Join(sorted, ",")
+}
+
+// HasPermission reports whether the user is an admin holding permission p
+func (u *User) HasPermission(p string) bool {
+	if !u.IsAdmin() {
+		return false
+	}
+	for _, held := range u.PermissionList() {
+		if held == p || held == PermissionAll {
+			return true
+		}
+	}
+	return false
+}
+
+// HashPassword hashes the user's password with the configured algorithm
 func (u *User) HashPassword(password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(password)
 	if err != nil {
 		return err
 	}
-	u.Password = string(hashedPassword)
+	u.Password = hashedPassword
 	return nil
 }
 
 // CheckPassword compares a password with the user's hashed password
 func (u *User) CheckPassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	return err == nil
+	return checkPassword(u.Password, password)
+}
+
+// PasswordNeedsRehash reports whether the password hash predates the
+// configured algorithm or cost
+func (u *User) PasswordNeedsRehash() bool {
+	return passwordNeedsRehash(u.Password)
+}
+
+// LoginFailure is a failed password sign-in from an IP, kept for the
+// throttling window
+type LoginFailure struct {
+	ID        uint      `gorm:"primaryKey"`
+	IP        string    `gorm:"not null;index"`
+	CreatedAt time.Time `gorm:"index"`
 }
@@ -1,9 +1,10 @@
 package routes
 
 import (
-	"ebay-mcp/backend/config"
-	"ebay-mcp/backend/controllers"
-	"ebay-mcp/backend/middleware"
+	"github.com/ayouroukov/ebay-mcp/backend/config"
+	"github.com/ayouroukov/ebay-mcp/backend/controllers"
+	"github.com/ayouroukov/ebay-mcp/backend/middleware"
+	"github.com/ayouroukov/ebay-mcp/backend/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,17 +13,49 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 	// Initialize controllers
 	authController := controllers.NewAuthController(cfg)
 	oauthController := controllers.NewOAuthController(cfg)
+	bootstrapController := controllers.NewBootstrapController(cfg)
+	passkeyController := controllers.NewPasskeyController(cfg)
+	adminController := controllers.NewAdminController(cfg)
+	clientAdminController := controllers.NewClientAdminController(cfg)
+	userAdminController := controllers.NewUserAdminController(cfg)
+	consentController := controllers.NewConsentController(cfg)
+	scopeAdminController := controllers.NewScopeAdminController(cfg)
+	internalController := controllers.NewInternalController(cfg)
+	healthController := controllers.NewHealthController(cfg)
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
+	router.GET("/healthz", healthController.Liveness)
+	router.GET("/readyz", healthController.Readiness)
+	router.GET("/metrics", healthController.Metrics)
+
+	// Bootstrap endpoint (protected by BOOTSTRAP_TOKEN, for infrastructure-as-code)
+	router.POST("/api/bootstrap", bootstrapController.Apply)
+
+	// Internal API for the proxy, HMAC-signed with INTERNAL_SIGNING_SECRETS
+	internal := router.Group("/internal")
+	internal.Use(middleware.InternalAuth(cfg))
+	{
+		internal.GET("/policies/:name", internalController.GetPolicy)
+		internal.POST("/tokens/introspect", internalController.IntrospectToken)
+		internal.GET("/users/:id/ebay-credentials/:environment", internalController.GetEbayCredential)
+		internal.PUT("/users/:id/ebay-credentials/:environment", internalController.PutEbayCredential)
+		internal.DELETE("/ebay-credentials", internalController.DeleteEbayAccount)
+		internal.POST("/usage", internalController.RecordUsage)
+		internal.GET("/spend", internalController.GetSpend)
+		internal.POST("/spend", internalController.RecordSpend)
+	}
 
 	// Auth routes (public)
 	auth := router.Group("/api/auth")
 	{
-		auth.POST("/register", authController.Register)
-		auth.POST("/login", authController.Login)
+		auth.POST("/register", middleware.Audit("auth.register"), authController.Register)
+		auth.POST("/login", middleware.Audit("auth.login"), authController.Login)
+		auth.POST("/2fa/verify", middleware.Audit("auth.login"), authController.VerifyTwoFactor)
+		auth.POST("/passkeys/login/begin", passkeyController.BeginLogin)
+		auth.POST("/passkeys/login/finish", middleware.Audit("auth.login"), passkeyController.FinishLogin)
 	}
 
 	// Protected auth routes
@@ -30,8 +63,77 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 	authProtected.Use(middleware.AuthMiddleware(cfg))
 	{
 		authProtected.GET("/profile", authController.GetProfile)
+
+		// Two-factor authentication (TOTP)
+		authProtected.POST("/2fa/setup", middleware.Audit("auth.2fa_setup"), authController.SetupTwoFactor)
+		authProtected.POST("/2fa/enable", middleware.Audit("auth.2fa_enabled"), authController.EnableTwoFactor)
+		authProtected.POST("/2fa/disable", middleware.Audit("auth.2fa_disabled"), authController.DisableTwoFactor)
+
+		// Passkey management
+		authProtected.GET("/passkeys", passkeyController.List)
+		authProtected.POST("/passkeys/register/begin", passkeyController.BeginRegistration)
+		authProtected.POST("/passkeys/register/finish", passkeyController.FinishRegistration)
+		authProtected.PATCH("/passkeys/:id", passkeyController.Rename)
+		authProtected.DELETE("/passkeys/:id", passkeyController.Delete)
+
+		// Clients the user has authorized
+		authProtected.GET("/consents", consentController.List)
+		authProtected.DELETE("/consents/:client_id", consentController.Withdraw)
 	}
 
+	// Admin routes, each gated by a fine-grained permission. Service clients
+	// (client_credentials tokens) are accepted with "admin:<permission>" scopes.
+	admin := router.Group("/api/admin")
+	admin.Use(middleware.ServiceAuthMiddleware(cfg), middleware.RequireTwoFactor(cfg))
+	{
+		admin.GET("/audit", middleware.RequirePermission(models.PermViewAudit), adminController.ListAuditEvents)
+		admin.PUT("/users/:id/permissions", middleware.RequireAdmin(), adminController.UpdatePermissions)
+		admin.GET("/database", middleware.RequireAdmin(), adminController.DatabaseStats)
+		admin.GET("/policies", middleware.RequirePermission(models.PermManagePolicies), adminController.ListPolicies)
+		admin.PUT("/policies/:name", middleware.RequirePermission(models.PermManagePolicies), adminController.PutPolicy)
+		admin.GET("/impersonations", middleware.RequirePermission(models.PermImpersonateUser), adminController.ListImpersonations)
+		admin.POST("/impersonations", middleware.RequirePermission(models.PermImpersonateUser), adminController.StartImpersonation)
+		admin.DELETE("/impersonations/:id", middleware.RequirePermission(models.PermImpersonateUser), adminController.EndImpersonation)
+	}
+
+	// OAuth client management
+	clients := router.Group("/api/admin/clients")
+	clients.Use(middleware.ServiceAuthMiddleware(cfg), middleware.RequirePermission(models.PermManageClients), middleware.RequireTwoFactor(cfg))
+	{
+		clients.GET("", clientAdminController.List)
+		clients.POST("", clientAdminController.Create)
+		clients.GET("/:id", clientAdminController.Get)
+		clients.PATCH("/:id", clientAdminController.Update)
+		clients.DELETE("/:id", clientAdminController.Delete)
+		clients.POST("/:id/rotate-secret", clientAdminController.RotateSecret)
+		clients.GET("/:id/tokens", clientAdminController.ListTokens)
+		clients.GET("/:id/grants", clientAdminController.ListGrants)
+	}
+
+	// OAuth scope registry
+	scopes := router.Group("/api/admin/scopes")
+	scopes.Use(middleware.ServiceAuthMiddleware(cfg), middleware.RequirePermission(models.PermManageClients), middleware.RequireTwoFactor(cfg))
+	{
+		scopes.GET("", scopeAdminController.List)
+		scopes.PUT("/:name", scopeAdminController.Put)
+		scopes.DELETE("/:name", scopeAdminController.Delete)
+	}
+
+	// User support and abuse handling
+	users := router.Group("/api/admin/users")
+	users.Use(middleware.ServiceAuthMiddleware(cfg), middleware.RequirePermission(models.PermManageUsers), middleware.RequireTwoFactor(cfg))
+	{
+		users.GET("", userAdminController.List)
+		users.GET("/:id", userAdminController.Get)
+		users.POST("/:id/revoke-tokens", userAdminController.RevokeTokens)
+		users.POST("/:id/disable", userAdminController.Disable)
+		users.POST("/:id/enable", userAdminController.Enable)
+		users.POST("/:id/unlock", userAdminController.Unlock)
+	}
+
+	// Authorization server metadata (RFC 8414) for MCP clients
+	router.GET("/.well-known/oauth-authorization-server", oauthController.Metadata)
+
 	// OAuth routes
 	oauth := router.Group("/oauth")
 	{
@@ -40,11 +142,16 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 		oauthProtected.Use(middleware.AuthMiddleware(cfg))
 		{
 			oauthProtected.GET("/authorize", oauthController.Authorize)
-			oauthProtected.POST("/authorize/consent", oauthController.AuthorizeConsent)
+			oauthProtected.POST("/authorize/consent", middleware.Audit("oauth.consent"), oauthController.AuthorizeConsent)
+			oauthProtected.GET("/device", oauthController.DeviceLookup)
+			oauthProtected.POST("/device/consent", middleware.Audit("oauth.device_consent"), oauthController.DeviceConsent)
 		}
 
 		// Token endpoint (public - uses client credentials)
-		oauth.POST("/token", oauthController.Token)
+		oauth.POST("/token", middleware.Audit("oauth.token"), oauthController.Token)
+
+		// Device authorization endpoint (RFC 8628, uses client credentials)
+		oauth.POST("/device/code", middleware.Audit("oauth.device_code"), oauthController.DeviceAuthorization)
 
 		// UserInfo endpoint (requires OAuth access token)
 		oauth.GET("/userinfo", oauthController.UserInfo)
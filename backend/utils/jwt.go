@@ -10,14 +10,40 @@ import (
 type JWTClaims struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
+	// Set only on tokens issued for an impersonation session
+	ImpersonationID uint `json:"impersonation_id,omitempty"`
+	ImpersonatorID  uint `json:"impersonator_id,omitempty"`
+	// Set when the user proved a second factor (TOTP, a recovery code or
+	// a passkey) at sign-in
+	MFA bool `json:"mfa,omitempty"`
+	// Set on tokens that are not sessions, such as two-factor challenges;
+	// ValidateJWT rejects them
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// TwoFactorChallengePurpose marks the token a password sign-in returns when
+// a TOTP code is still needed
+const TwoFactorChallengePurpose = "2fa"
+
+// twoFactorChallengeTTL is how long the user has to enter the code
+const twoFactorChallengeTTL = 5 * time.Minute
+
 // GenerateJWT creates a new JWT token for a user
 func GenerateJWT(userID uint, email string, secret string) (string, error) {
+	return generateSessionJWT(userID, email, false, secret)
+}
+
+// GenerateMFAJWT creates a JWT for a user who also proved a second factor
+func GenerateMFAJWT(userID uint, email string, secret string) (string, error) {
+	return generateSessionJWT(userID, email, true, secret)
+}
+
+func generateSessionJWT(userID uint, email string, mfa bool, secret string) (string, error) {
 	claims := JWTClaims{
 		UserID: userID,
 		Email:  email,
+		MFA:    mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -29,8 +55,70 @@ func GenerateJWT(userID uint, email string, secret string) (string, error) {
 	return token.SignedString([]byte(secret))
 }
 
-// ValidateJWT validates a JWT token and returns the claims
+// GenerateImpersonationJWT creates a token that lets an admin act as a user
+// until expiresAt
+func GenerateImpersonationJWT(userID uint, email string, sessionID, adminID uint, expiresAt time.Time, secret string) (string, error) {
+	claims := JWTClaims{
+		UserID:          userID,
+		Email:           email,
+		ImpersonationID: sessionID,
+		ImpersonatorID:  adminID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// GenerateTwoFactorChallenge creates the short-lived token exchanged,
+// together with a TOTP or recovery code, for a session at
+// /api/auth/2fa/verify
+func GenerateTwoFactorChallenge(userID uint, email string, secret string) (string, error) {
+	claims := JWTClaims{
+		UserID:  userID,
+		Email:   email,
+		Purpose: TwoFactorChallengePurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(twoFactorChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// ValidateTwoFactorChallenge validates a token from
+// GenerateTwoFactorChallenge and returns its claims
+func ValidateTwoFactorChallenge(tokenString string, secret string) (*JWTClaims, error) {
+	claims, err := parseJWT(tokenString, secret)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != TwoFactorChallengePurpose {
+		return nil, errors.New("not a two-factor challenge")
+	}
+	return claims, nil
+}
+
+// ValidateJWT validates a session JWT and returns the claims
 func ValidateJWT(tokenString string, secret string) (*JWTClaims, error) {
+	claims, err := parseJWT(tokenString, secret)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("not a session token")
+	}
+	return claims, nil
+}
+
+func parseJWT(tokenString string, secret string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("invalid signing method")
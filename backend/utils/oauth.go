@@ -1,8 +1,16 @@
 package utils
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
+	"errors"
 )
 
 // GenerateRandomToken generates a cryptographically secure random token
@@ -13,3 +21,25 @@ func GenerateRandomToken(length int) (string, error) {
 	}
 	return base64.URLEncoding.EncodeToString(bytes), nil
 }
+
+// ParsePublicKey parses a PEM "PUBLIC KEY" block holding an RSA, ECDSA or
+// Ed25519 key, as clients register for private_key_jwt authentication
+func ParsePublicKey(data string) (crypto.PublicKey, error) {
+	block, rest := pem.Decode([]byte(data))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("expected a PEM encoded PUBLIC KEY")
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, errors.New("expected a single public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, errors.New("unsupported public key type")
+	}
+}
@@ -0,0 +1,422 @@
+package ebaymcp
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ### Best Offer Rules #######################################################
+
+// The policy's `best_offers` section answers incoming Best Offers of linked
+// (vault) accounts without the seller: offers at or above accept_at percent
+// of the asking price are accepted, offers below decline_below percent are
+// declined, and the rest are countered at counter_at percent, or left for
+// the seller when counter_at is unset. floor is a price, in the listing's
+// currency, below which nothing is accepted or countered. Overrides for a
+// SKU or item ID replace the fields they set.
+//
+// Incoming offers are only exposed by the Trading API (the Negotiation API
+// covers offers the seller sends), so the engine polls GetBestOffers every
+// poll_interval and answers with RespondToBestOffer. Notifications of the
+// trigger_topics, e.g. forwarded platform notifications, start a pass right
+// away. Every decision is written to the audit log as best_offer.<action>;
+// with dry_run the decisions are logged but not sent.
+//
+//	best_offers:
+//	  accounts: ["3q2-7w..."]
+//	  accept_at: 90
+//	  decline_below: 60
+//	  counter_at: 85
+//	  overrides:
+//	    - sku: CAMERA-01
+//	      floor: 450
+
+const (
+	defaultBestOfferPollInterval = 15 * time.Minute
+	minBestOfferPollInterval     = time.Minute
+	// Best Offers expire after 48 hours, so handled ones needn't be kept longer
+	bestOfferMemory = 48 * time.Hour
+)
+
+// BestOfferPolicy configures the Best Offer rules engine. It is off without
+// accounts.
+type BestOfferPolicy struct {
+	Accounts      []string        `yaml:"accounts,omitempty"` // vault IDs
+	PollInterval  time.Duration   `yaml:"poll_interval,omitempty"`
+	TriggerTopics []string        `yaml:"trigger_topics,omitempty"`
+	DryRun        bool            `yaml:"dry_run,omitempty"`
+	Default       BestOfferRule   `yaml:",inline"`
+	Overrides     []BestOfferRule `yaml:"overrides,omitempty"`
+}
+
+// BestOfferRule holds the thresholds, as percentages of the asking price,
+// and the price floor. Overrides name a SKU or an item ID.
+type BestOfferRule struct {
+	SKU          string  `yaml:"sku,omitempty"`
+	ItemID       string  `yaml:"item_id,omitempty"`
+	AcceptAt     float64 `yaml:"accept_at,omitempty"`
+	DeclineBelow float64 `yaml:"decline_below,omitempty"`
+	CounterAt    float64 `yaml:"counter_at,omitempty"`
+	Floor        float64 `yaml:"floor,omitempty"`
+}
+
+// bestOfferCache remembers offers that were handled, across replicas.
+var bestOfferCache = cacheNamespace{name: "best-offer"}
+
+// validate checks the section.
+func (b *BestOfferPolicy) validate() []string {
+	var problems []string
+	if b.PollInterval != 0 && b.PollInterval < minBestOfferPollInterval {
+		problems = append(problems, fmt.Sprintf("best_offers: poll_interval must be at least %s", minBestOfferPollInterval))
+	}
+	problems = append(problems, b.Default.validate("best_offers")...)
+	if b.Default.SKU != "" || b.Default.ItemID != "" {
+		problems = append(problems, "best_offers: sku and item_id only belong in overrides")
+	}
+	for i, o := range b.Overrides {
+		field := fmt.Sprintf("best_offers.overrides[%d]", i)
+		if (o.SKU == "") == (o.ItemID == "") {
+			problems = append(problems, field+": exactly one of sku and item_id is required")
+		}
+		problems = append(problems, b.ruleFor(o.SKU, o.ItemID).validate(field)...)
+	}
+	return problems
+}
+
+func (r BestOfferRule) validate(field string) []string {
+	var problems []string
+	for _, v := range []struct {
+		name  string
+		value float64
+	}{{"accept_at", r.AcceptAt}, {"decline_below", r.DeclineBelow}, {"counter_at", r.CounterAt}} {
+		if v.value < 0 || v.value > 100 {
+			problems = append(problems, fmt.Sprintf("%s: %s must be a percentage from 0 to 100", field, v.name))
+		}
+	}
+	if r.AcceptAt > 0 && r.DeclineBelow > r.AcceptAt {
+		problems = append(problems, field+": decline_below must not be above accept_at")
+	}
+	if r.CounterAt > 0 && r.CounterAt < r.DeclineBelow {
+		problems = append(problems, field+": counter_at must not be below decline_below")
+	}
+	if r.Floor < 0 {
+		problems = append(problems, field+": floor must not be negative")
+	}
+	return problems
+}
+
+// ruleFor returns the default rule with the fields set by the override for
+// the SKU or item ID, if any.
+func (b *BestOfferPolicy) ruleFor(sku, itemID string) BestOfferRule {
+	rule := b.Default
+	for _, o := range b.Overrides {
+		if (o.SKU == "" || o.SKU != sku) && (o.ItemID == "" || o.ItemID != itemID) {
+			continue
+		}
+		if o.AcceptAt != 0 {
+			rule.AcceptAt = o.AcceptAt
+		}
+		if o.DeclineBelow != 0 {
+			rule.DeclineBelow = o.DeclineBelow
+		}
+		if o.CounterAt != 0 {
+			rule.CounterAt = o.CounterAt
+		}
+		if o.Floor != 0 {
+			rule.Floor = o.Floor
+		}
+		break
+	}
+	return rule
+}
+
+// Best Offer actions, as RespondToBestOffer names them. actionLeave leaves
+// the offer to the seller.
+const (
+	actionAccept  = "Accept"
+	actionDecline = "Decline"
+	actionCounter = "Counter"
+	actionLeave   = "Leave"
+)
+
+// decide applies the rule to an offer of price for a listing asking asking.
+// It returns the action and, for counters, the counter price.
+func (r BestOfferRule) decide(price, asking float64) (string, float64) {
+	if asking <= 0 {
+		return actionLeave, 0
+	}
+	if r.Floor > 0 && price < r.Floor {
+		return actionDecline, 0
+	}
+	percent := price / asking * 100
+	switch {
+	case r.AcceptAt > 0 && percent >= r.AcceptAt:
+		return actionAccept, 0
+	case r.DeclineBelow > 0 && percent < r.DeclineBelow:
+		return actionDecline, 0
+	case r.CounterAt > 0:
+		counter := math.Max(math.Round(asking*r.CounterAt)/100, r.Floor)
+		if counter <= price {
+			return actionAccept, 0
+		}
+		return actionCounter, counter
+	}
+	return actionLeave, 0
+}
+
+// ### Trading Calls ###
+
+type getBestOffersRequest struct {
+	XMLName         xml.Name `xml:"urn:ebay:apis:eBLBaseComponents GetBestOffersRequest"`
+	BestOfferStatus string   `xml:"BestOfferStatus"`
+	DetailLevel     string   `xml:"DetailLevel"`
+}
+
+type getBestOffersResponse struct {
+	tradingAck
+	Items []struct {
+		Item struct {
+			ItemID        string         `xml:"ItemID"`
+			SKU           string         `xml:"SKU"`
+			Title         string         `xml:"Title"`
+			BuyItNowPrice *tradingAmount `xml:"BuyItNowPrice"`
+			SellingStatus struct {
+				CurrentPrice *tradingAmount `xml:"CurrentPrice"`
+			} `xml:"SellingStatus"`
+		} `xml:"Item"`
+		BestOffers []struct {
+			BestOfferID string        `xml:"BestOfferID"`
+			Price       tradingAmount `xml:"Price"`
+			Quantity    int           `xml:"Quantity"`
+			Status      string        `xml:"Status"`
+			Buyer       struct {
+				UserID string `xml:"UserID"`
+			} `xml:"Buyer"`
+		} `xml:"BestOfferArray>BestOffer"`
+	} `xml:"ItemBestOffersArray>ItemBestOffers"`
+}
+
+type respondToBestOfferRequest struct {
+	XMLName              xml.Name       `xml:"urn:ebay:apis:eBLBaseComponents RespondToBestOfferRequest"`
+	ItemID               string         `xml:"ItemID"`
+	BestOfferID          string         `xml:"BestOfferID"`
+	Action               string         `xml:"Action"`
+	CounterOfferPrice    *tradingAmount `xml:"CounterOfferPrice,omitempty"`
+	CounterOfferQuantity int            `xml:"CounterOfferQuantity,omitempty"`
+}
+
+type respondToBestOfferResponse struct {
+	tradingAck
+}
+
+// ### Engine ###
+
+// bestOfferDecision is one entry of the action log.
+type bestOfferDecision struct {
+	Account     string  `json:"account"`
+	ItemID      string  `json:"item_id"`
+	SKU         string  `json:"sku,omitempty"`
+	BestOfferID string  `json:"best_offer_id"`
+	Price       float64 `json:"price"`
+	Asking      float64 `json:"asking"`
+	Currency    string  `json:"currency"`
+	Action      string  `json:"action"`
+	Counter     float64 `json:"counter,omitempty"`
+	DryRun      bool    `json:"dry_run,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// bestOffers serializes passes of the engine.
+var bestOffers sync.Mutex
+
+// startBestOfferEngine polls for offers and subscribes to the trigger
+// topics. It does nothing when the policy names no accounts.
+func startBestOfferEngine(ctx context.Context) {
+	b := currentPolicy().BestOffers
+	if len(b.Accounts) == 0 {
+		return
+	}
+	if vault == nil {
+		log.Printf("Best Offer rules need VAULT_FILE for their accounts; not starting")
+		return
+	}
+
+	if len(b.TriggerTopics) > 0 {
+		notifications.Subscribe(func(n receivedNotification) {
+			if containsFold(currentPolicy().BestOffers.TriggerTopics, n.Topic) {
+				go runBestOfferPass(ctx)
+			}
+		})
+	}
+
+	interval := b.PollInterval
+	if interval == 0 {
+		interval = defaultBestOfferPollInterval
+	}
+	log.Printf("Best Offer rules: %d account(s), polling every %s", len(b.Accounts), interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			runBestOfferPass(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runBestOfferPass answers the active offers of every account. A pass that
+// starts while another runs returns at once and reports false.
+func runBestOfferPass(ctx context.Context) ([]bestOfferDecision, bool) {
+	if !bestOffers.TryLock() {
+		return nil, false
+	}
+	defer bestOffers.Unlock()
+
+	b := currentPolicy().BestOffers
+	var decisions []bestOfferDecision
+	for _, account := range b.Accounts {
+		d, err := answerBestOffers(ctx, &b, account)
+		if err != nil {
+			log.Printf("Best Offer rules for account %s: %v", account, err)
+		}
+		decisions = append(decisions, d...)
+	}
+	return decisions, true
+}
+
+// answerBestOffers applies the rules to the active offers of one account.
+func answerBestOffers(ctx context.Context, b *BestOfferPolicy, account string) ([]bestOfferDecision, error) {
+	token, entry, err := vaultAccessToken(ctx, vaultKeyPrefix+account)
+	if err != nil {
+		return nil, err
+	}
+	env := entry.environment()
+	marketplace := entry.Marketplace
+	if marketplace == "" {
+		marketplace = configuredMarketplace
+	}
+
+	var offers getBestOffersResponse
+	req := getBestOffersRequest{BestOfferStatus: "Active", DetailLevel: "ReturnAll"}
+	if err := tradingCall(ctx, env, token, marketplace, "GetBestOffers", req, &offers); err != nil {
+		return nil, err
+	}
+
+	var decisions []bestOfferDecision
+	for _, item := range offers.Items {
+		asking := item.Item.BuyItNowPrice
+		if asking == nil || asking.Value == 0 {
+			asking = item.Item.SellingStatus.CurrentPrice
+		}
+		if asking == nil {
+			continue
+		}
+		rule := b.ruleFor(item.Item.SKU, item.Item.ItemID)
+
+		for _, offer := range item.BestOffers {
+			if offer.Status != "" && offer.Status != "Active" {
+				continue
+			}
+			if _, done := bestOfferCache.Get(ctx, account, offer.BestOfferID); done {
+				continue
+			}
+			d := bestOfferDecision{
+				Account:     account,
+				ItemID:      item.Item.ItemID,
+				SKU:         item.Item.SKU,
+				BestOfferID: offer.BestOfferID,
+				Price:       offer.Price.Value,
+				Asking:      asking.Value,
+				Currency:    asking.Currency,
+				DryRun:      b.DryRun,
+			}
+			d.Action, d.Counter = rule.decide(offer.Price.Value, asking.Value)
+
+			if d.Action != actionLeave && !b.DryRun {
+				respond := respondToBestOfferRequest{ItemID: d.ItemID, BestOfferID: d.BestOfferID, Action: d.Action}
+				if d.Action == actionCounter {
+					respond.CounterOfferPrice = &tradingAmount{Currency: d.Currency, Value: d.Counter}
+					respond.CounterOfferQuantity = offer.Quantity
+				}
+				if err := tradingCall(ctx, env, token, marketplace, "RespondToBestOffer", respond, &respondToBestOfferResponse{}); err != nil {
+					d.Error = err.Error()
+				}
+			}
+			if d.Error == "" {
+				bestOfferCache.Set(ctx, account, offer.BestOfferID, []byte(d.Action), bestOfferMemory)
+			}
+			recordBestOfferDecision(d)
+			decisions = append(decisions, d)
+		}
+	}
+	return decisions, nil
+}
+
+// recordBestOfferDecision writes the decision to the audit log.
+func recordBestOfferDecision(d bestOfferDecision) {
+	fields := map[string]string{
+		"account":       d.Account,
+		"item_id":       d.ItemID,
+		"best_offer_id": d.BestOfferID,
+		"price":         strconv.FormatFloat(d.Price, 'f', 2, 64),
+		"asking":        strconv.FormatFloat(d.Asking, 'f', 2, 64),
+		"currency":      d.Currency,
+	}
+	if d.SKU != "" {
+		fields["sku"] = d.SKU
+	}
+	if d.Action == actionCounter {
+		fields["counter"] = strconv.FormatFloat(d.Counter, 'f', 2, 64)
+	}
+	if d.DryRun {
+		fields["dry_run"] = "true"
+	}
+	if d.Error != "" {
+		fields["error"] = d.Error
+	}
+	audit.Record("best_offer."+strings.ToLower(d.Action), fields)
+}
+
+// handleBestOfferRun runs a pass now and returns its decisions.
+// POST /admin/best-offers/run
+func handleBestOfferRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(currentPolicy().BestOffers.Accounts) == 0 || vault == nil {
+		http.Error(w, "Best Offer rules are not configured", http.StatusNotFound)
+		return
+	}
+	decisions, ran := runBestOfferPass(r.Context())
+	if !ran {
+		http.Error(w, "A pass is already running", http.StatusConflict)
+		return
+	}
+	if decisions == nil {
+		decisions = []bestOfferDecision{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"decisions": decisions})
+}
+
+// containsFold reports whether list holds s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
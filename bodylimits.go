@@ -0,0 +1,120 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// ### Body Size Limits #######################################################
+
+// Request bodies are capped at MAX_REQUEST_BODY_SIZE for every endpoint but
+// Feed API file uploads, which stream to eBay and are capped at
+// MAX_FEED_UPLOAD_SIZE instead, and image uploads, which are capped at the
+// Media API's limit. Responses stream from eBay to the client without buffering (so Feed API
+// downloads of any size pass through); only the responses the proxy has to
+// rewrite are buffered, up to MAX_RESPONSE_BUFFER_SIZE.
+
+const (
+	defaultMaxRequestBodySize    = 10 << 20
+	defaultMaxResponseBufferSize = 10 << 20
+	defaultMaxFeedUploadSize     = 100 << 20
+	errorBodyLogLimit            = 64 << 10 // bytes of an eBay error body that are logged
+)
+
+var (
+	maxRequestBodySize    int64 = defaultMaxRequestBodySize
+	maxResponseBufferSize int64 = defaultMaxResponseBufferSize
+	maxFeedUploadSize     int64 = defaultMaxFeedUploadSize
+)
+
+// errResponseTooLarge is returned when a response that must be buffered
+// exceeds maxResponseBufferSize.
+var errResponseTooLarge = errors.New("eBay response is too large to process")
+
+// bodyLimitsFromEnv reads MAX_REQUEST_BODY_SIZE, MAX_RESPONSE_BUFFER_SIZE
+// and MAX_FEED_UPLOAD_SIZE (all in bytes).
+func bodyLimitsFromEnv() error {
+	for name, limit := range map[string]*int64{
+		"MAX_REQUEST_BODY_SIZE":    &maxRequestBodySize,
+		"MAX_RESPONSE_BUFFER_SIZE": &maxResponseBufferSize,
+		"MAX_FEED_UPLOAD_SIZE":     &maxFeedUploadSize,
+	} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid %s %q", name, v)
+			}
+			*limit = n
+		}
+	}
+	return nil
+}
+
+// limitRequestBody rejects requests that declare a body over the limit and
+// caps the rest, so handlers fail with an *http.MaxBytesError instead of
+// reading without bound.
+func limitRequestBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := requestBodyLimit(r.URL.Path)
+		if r.ContentLength > limit {
+			writeBodyTooLarge(w, limit)
+			return
+		}
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestBodyLimit returns the body limit of requests to path.
+func requestBodyLimit(path string) int64 {
+	if isFeedUpload(path) {
+		return maxFeedUploadSize
+	}
+	if path == imagesPath {
+		return imageUploadBodyLimit
+	}
+	return maxRequestBodySize
+}
+
+// isBodyTooLarge reports whether err came from hitting the request limit.
+func isBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, limit int64) {
+	http.Error(w, fmt.Sprintf("Request body too large (limit %d bytes)", limit), http.StatusRequestEntityTooLarge)
+}
+
+// readLimited reads all of r, failing with errResponseTooLarge past limit.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errResponseTooLarge
+	}
+	return data, nil
+}
+
+// peekBody returns up to n bytes of resp.Body for logging and puts them back
+// in front of the unread rest, so the body still streams to the client.
+func peekBody(resp *http.Response, n int64) ([]byte, error) {
+	prefix, err := io.ReadAll(io.LimitReader(resp.Body, n))
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(prefix), resp.Body), resp.Body}
+	return prefix, nil
+}
@@ -0,0 +1,248 @@
+package ebaymcp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/store"
+)
+
+// ### Cache ##################################################################
+
+// Everything the proxy caches (eBay responses, minted access tokens,
+// notification public keys) goes through one store.Store, selected with
+// CACHE_BACKEND: memory, redis or memcached (see internal/store). The
+// backend keeps its internal request nonces in the same store.
+//
+// Redis and memcached let several replicas share one cache. Features use the
+// cache through a cacheNamespace, which gives them the same semantics on
+// every backend: values expire after their TTL, keys are hashed (so any
+// string is a valid key), a scope (e.g. one caller) or a whole namespace can
+// be invalidated at once, and backend failures are logged and treated as
+// misses, never failing the request. After a server can't be reached, calls
+// fail at once for store.RetryAfter instead of each waiting for a timeout;
+// features with process-local state (the rate limiter, the issued token
+// registry) fall back to it meanwhile. Generations are remembered locally
+// for cacheGenerationLocalTTL, so other replicas' invalidations show up
+// after at most that long; namespaces that promise callers read their own
+// writes (ownWrites) read scope generations from the store every time, so
+// invalidating a scope shows on every replica at once.
+
+const (
+	defaultCacheMaxBytes = 64 << 20
+
+	// cacheGenerationTTL keeps generation keys around far longer than any
+	// value they guard.
+	cacheGenerationTTL = 30 * 24 * time.Hour
+
+	// cacheGenerationLocalTTL is how long a generation read from the store
+	// is reused without asking it again: how long an invalidation made by
+	// another replica can take to show here.
+	cacheGenerationLocalTTL = 5 * time.Second
+)
+
+// cache is the process-wide cache, configured at startup.
+var cache store.Store = store.NewMemory(defaultCacheMaxBytes)
+
+// cacheKeyPrefix (CACHE_KEY_PREFIX) separates deployments sharing a server.
+var cacheKeyPrefix = store.KeyPrefix()
+
+// cacheFromEnv builds the cache selected by CACHE_BACKEND.
+func cacheFromEnv() (store.Store, error) {
+	cacheKeyPrefix = store.KeyPrefix()
+	return store.FromEnv()
+}
+
+// ### Namespaces ###
+
+// cacheNamespace is one feature's view of the cache. Keys are
+// "<prefix><name>:<scope>:<generation>:<sha256(key)>"; invalidating a scope or
+// the namespace replaces its generation, orphaning the old values until they
+// expire.
+type cacheNamespace struct {
+	name string
+
+	// ownWrites skips the local copy of scope generations, at the cost of
+	// a round trip per read, so a scope invalidated through one replica is
+	// never read stale through another.
+	ownWrites bool
+}
+
+var (
+	responseCache  = cacheNamespace{name: "responses", ownWrites: true}
+	tokenCache     = cacheNamespace{name: "tokens"}
+	publicKeyCache = cacheNamespace{name: "notification-keys"}
+	flagCache      = cacheNamespace{name: "flags"}
+	backendCache   = cacheNamespace{name: "backend"}
+	taxonomyCache  = cacheNamespace{name: "taxonomy"}
+	purchaseCache  = cacheNamespace{name: "purchases"}
+)
+
+// cacheGenerations keeps the generations read recently, so that a cache
+// read costs one round trip to the store rather than three.
+var cacheGenerations = struct {
+	sync.Mutex
+	entries map[string]cachedGeneration
+	sweptAt time.Time
+}{entries: make(map[string]cachedGeneration)}
+
+type cachedGeneration struct {
+	value     string
+	expiresAt time.Time
+}
+
+// rememberGeneration keeps gen as the generation of key for
+// cacheGenerationLocalTTL. Expired entries are dropped once per TTL.
+func rememberGeneration(key, gen string) {
+	now := time.Now()
+	cacheGenerations.Lock()
+	defer cacheGenerations.Unlock()
+	if now.Sub(cacheGenerations.sweptAt) > cacheGenerationLocalTTL {
+		for k, entry := range cacheGenerations.entries {
+			if now.After(entry.expiresAt) {
+				delete(cacheGenerations.entries, k)
+			}
+		}
+		cacheGenerations.sweptAt = now
+	}
+	cacheGenerations.entries[key] = cachedGeneration{gen, now.Add(cacheGenerationLocalTTL)}
+}
+
+// generation returns the current generation of key, creating one if needed.
+// Unless local is set, it asks the store even when a copy is remembered.
+func (n cacheNamespace) generation(ctx context.Context, key string, local bool) (string, error) {
+	if local {
+		cacheGenerations.Lock()
+		entry, ok := cacheGenerations.entries[key]
+		cacheGenerations.Unlock()
+		if ok && time.Now().Before(entry.expiresAt) {
+			return entry.value, nil
+		}
+	}
+
+	value, ok, err := cache.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	gen := string(value)
+	if !ok {
+		// Replicas racing to create the generation agree on the first one
+		gen = newCacheGeneration()
+		added, err := cache.Add(ctx, key, []byte(gen), cacheGenerationTTL)
+		if err != nil {
+			return "", err
+		}
+		if !added {
+			if value, ok, err = cache.Get(ctx, key); err != nil {
+				return "", err
+			}
+			if !ok {
+				return "", errors.New("cache generation expired while being created")
+			}
+			gen = string(value)
+		}
+	}
+	rememberGeneration(key, gen)
+	return gen, nil
+}
+
+// key returns the backend key of key in scope.
+func (n cacheNamespace) key(ctx context.Context, scope, key string) (string, error) {
+	base := cacheKeyPrefix + n.name
+	nsGen, err := n.generation(ctx, base+":gen", true)
+	if err != nil {
+		return "", err
+	}
+	scopeGen, err := n.generation(ctx, base+":"+scope+":gen", !n.ownWrites)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(key))
+	return base + ":" + scope + ":" + nsGen + "." + scopeGen + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// Get returns the value of key in scope, if cached.
+func (n cacheNamespace) Get(ctx context.Context, scope, key string) ([]byte, bool) {
+	k, err := n.key(ctx, scope, key)
+	if err == nil {
+		var value []byte
+		var ok bool
+		if value, ok, err = cache.Get(ctx, k); err == nil {
+			return value, ok
+		}
+	}
+	log.Printf("Cache read failed (%s): %v", n.name, err)
+	return nil, false
+}
+
+// Set caches value under key in scope for ttl.
+func (n cacheNamespace) Set(ctx context.Context, scope, key string, value []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	k, err := n.key(ctx, scope, key)
+	if err == nil {
+		err = cache.Set(ctx, k, value, ttl)
+	}
+	if err != nil {
+		log.Printf("Cache write failed (%s): %v", n.name, err)
+	}
+}
+
+// Claim sets key in scope for ttl unless it is set already, reporting
+// whether this call set it: across replicas sharing the cache, exactly one
+// claim of a key succeeds. When the cache fails Claim returns the error and
+// callers must refuse what the claim protects, since it may have been
+// claimed already.
+func (n cacheNamespace) Claim(ctx context.Context, scope, key string, ttl time.Duration) (bool, error) {
+	k, err := n.key(ctx, scope, key)
+	if err == nil {
+		var added bool
+		if added, err = cache.Add(ctx, k, []byte("1"), ttl); err == nil {
+			return added, nil
+		}
+	}
+	log.Printf("Cache claim failed (%s): %v", n.name, err)
+	return false, err
+}
+
+// Delete removes key from scope.
+func (n cacheNamespace) Delete(ctx context.Context, scope, key string) {
+	k, err := n.key(ctx, scope, key)
+	if err == nil {
+		err = cache.Delete(ctx, k)
+	}
+	if err != nil {
+		log.Printf("Cache delete failed (%s): %v", n.name, err)
+	}
+}
+
+// Invalidate drops every value in scope, or in the whole namespace when scope
+// is empty.
+func (n cacheNamespace) Invalidate(ctx context.Context, scope string) {
+	key := cacheKeyPrefix + n.name + ":gen"
+	if scope != "" {
+		key = cacheKeyPrefix + n.name + ":" + scope + ":gen"
+	}
+	gen := newCacheGeneration()
+	if err := cache.Set(ctx, key, []byte(gen), cacheGenerationTTL); err != nil {
+		log.Printf("Cache invalidation failed (%s): %v", n.name, err)
+		return
+	}
+	// This replica sees its own invalidation at once, others within
+	// cacheGenerationLocalTTL (at once for scopes of ownWrites namespaces)
+	rememberGeneration(key, gen)
+}
+
+// newCacheGeneration returns a random generation tag.
+func newCacheGeneration() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,374 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ### Request Capture ########################################################
+
+// Reports like "the GPT sent something weird" are hard to reproduce from
+// logs alone. With CAPTURE_DIR set, every /proxy call (of the callers the
+// `capture` flag is on for) is written to <id>.json in that directory: the
+// request and the response the client got, with their headers minus
+// credentials, bodies of up to captureMaxBody bytes passed through the
+// policy's redaction, and the time taken. Responses carry the capture ID in
+// X-Proxy-Capture-Id and each capture is audited as proxy.captured, so
+// /admin/audit?event=proxy.captured&token_hash=... finds a caller's.
+// Captures are deleted after CAPTURE_RETENTION (default 7 days).
+//
+// GET /admin/captures/{id} returns one, and `ebay-mcp replay <id>` sends its
+// request through the proxy again, against sandbox.
+
+const (
+	captureHeader           = "X-Proxy-Capture-Id"
+	captureMaxBody          = 256 << 10
+	defaultCaptureRetention = 7 * 24 * time.Hour
+)
+
+// capturedRequest is one captured /proxy call.
+type capturedRequest struct {
+	ID          string          `json:"id"`
+	Time        time.Time       `json:"time"`
+	Method      string          `json:"method"`
+	Path        string          `json:"path"` // without /proxy
+	Query       string          `json:"query,omitempty"`
+	Environment string          `json:"environment,omitempty"`
+	TokenHash   string          `json:"token_hash"`
+	Request     capturedMessage `json:"request"`
+	Response    capturedMessage `json:"response"`
+	DurationMS  int64           `json:"duration_ms"`
+}
+
+// capturedMessage is the headers and body of a request or response. Bodies
+// that aren't UTF-8 are kept in BodyBase64.
+type capturedMessage struct {
+	Status     int         `json:"status,omitempty"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"body_base64,omitempty"`
+	Truncated  bool        `json:"truncated,omitempty"`
+}
+
+// captureStore writes captures to a directory.
+type captureStore struct {
+	dir       string
+	retention time.Duration
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// captures is nil unless CAPTURE_DIR is set.
+var captures *captureStore
+
+// captureStoreFromEnv reads CAPTURE_DIR and CAPTURE_RETENTION.
+func captureStoreFromEnv() (*captureStore, error) {
+	dir := os.Getenv("CAPTURE_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+	s := &captureStore{dir: dir, retention: defaultCaptureRetention}
+	if v := os.Getenv("CAPTURE_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid CAPTURE_RETENTION %q", v)
+		}
+		s.retention = d
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+	return s, nil
+}
+
+// Put writes c to the store.
+func (s *captureStore) Put(c *capturedRequest) error {
+	s.prune(c.Time)
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, c.ID+".json"), data, 0600)
+}
+
+// Get reads the capture with id.
+func (s *captureStore) Get(id string) (*capturedRequest, error) {
+	if id == "" || strings.ContainsAny(id, "/\\.") {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var c capturedRequest
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// prune deletes captures older than the retention, at most hourly.
+func (s *captureStore) prune(now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastPrune) < time.Hour {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPrune = now
+	s.mu.Unlock()
+
+	files, _ := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil && now.Sub(info.ModTime()) > s.retention {
+			os.Remove(path)
+		}
+	}
+}
+
+// captureProxy captures the calls next (handleProxy) serves.
+func captureProxy(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := captures
+		parts := strings.Split(r.Header.Get("Authorization"), " ")
+		if store == nil || len(parts) != 2 {
+			next(w, r)
+			return
+		}
+		env, err := environmentFor(r)
+		if err != nil || !flags.IsEnabled(r.Context(), flagCapture, flagSubject{Tenant: env.key(), Key: tokenHash(parts[1])}) {
+			next(w, r)
+			return
+		}
+		id, err := randomID(12)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		c := &capturedRequest{
+			ID:          id,
+			Time:        time.Now().UTC(),
+			Method:      r.Method,
+			Path:        strings.TrimPrefix(r.URL.Path, "/proxy"),
+			Query:       r.URL.RawQuery,
+			Environment: env.Name,
+			TokenHash:   tokenHash(parts[1]),
+			Request:     capturedMessage{Header: sanitizedHeader(r.Header)},
+		}
+		reqBody := &captureBuffer{}
+		if r.Body != nil {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, reqBody), r.Body}
+		}
+		rec := &captureRecorder{ResponseWriter: w, status: http.StatusOK}
+		w.Header().Set(captureHeader, id)
+
+		start := time.Now()
+		next(rec, r)
+		c.DurationMS = time.Since(start).Milliseconds()
+
+		c.Request.setBody(reqBody, "")
+		c.Response.Status = rec.status
+		c.Response.Header = sanitizedHeader(w.Header())
+		c.Response.setBody(&rec.body, w.Header().Get("Content-Encoding"))
+		if err := store.Put(c); err != nil {
+			log.Printf("Failed to write capture %s: %v", id, err)
+			return
+		}
+		log.Printf("Captured %s %s as %s", c.Method, c.Path, id)
+		audit.Record("proxy.captured", map[string]string{
+			"capture_id": id,
+			"method":     c.Method,
+			"path":       c.Path,
+			"status":     strconv.Itoa(c.Response.Status),
+			"token_hash": c.TokenHash,
+		})
+	}
+}
+
+// captureBuffer keeps the first captureMaxBody bytes written to it.
+type captureBuffer struct {
+	bytes.Buffer
+	truncated bool
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	if room := captureMaxBody - b.Len(); len(p) > room {
+		b.Buffer.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// captureRecorder records the status and start of a response.
+type captureRecorder struct {
+	http.ResponseWriter
+	status int
+	body   captureBuffer
+}
+
+func (r *captureRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *captureRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush lets streamed proxy responses pass through the recorder.
+func (r *captureRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// setBody stores the redacted body in b, decoding it first if the client
+// got it compressed.
+func (m *capturedMessage) setBody(b *captureBuffer, encoding string) {
+	body := b.Bytes()
+	m.Truncated = b.truncated
+	if encoding != "" && !b.truncated {
+		resp := &http.Response{Header: http.Header{"Content-Encoding": {encoding}}, Body: io.NopCloser(bytes.NewReader(body))}
+		if err := decodeBody(resp); err == nil {
+			if decoded, err := io.ReadAll(resp.Body); err == nil {
+				body = decoded
+			}
+		}
+	}
+	if len(body) == 0 {
+		return
+	}
+	if !utf8.Valid(body) {
+		m.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+		return
+	}
+	m.Body = string(currentRedactor().Redact(body))
+}
+
+// sanitizedHeader returns h without credentials.
+func sanitizedHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		lower := strings.ToLower(name)
+		if strings.Contains(lower, "authorization") || strings.Contains(lower, "cookie") ||
+			strings.Contains(lower, "token") || strings.Contains(lower, "secret") ||
+			strings.Contains(lower, "signature") || strings.Contains(lower, "api-key") {
+			continue
+		}
+		out[name] = values
+	}
+	return out
+}
+
+// handleAdminCapture returns a capture.
+// GET /admin/captures/{id}
+func handleAdminCapture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if captures == nil {
+		http.Error(w, "CAPTURE_DIR is not set", http.StatusNotFound)
+		return
+	}
+	c, err := captures.Get(strings.TrimPrefix(r.URL.Path, "/admin/captures/"))
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "No such capture", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read capture: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// ### Replay #################################################################
+
+// replayHopHeaders are left out of a replayed request.
+var replayHopHeaders = []string{"Accept-Encoding", "Connection", "Content-Length", "Transfer-Encoding", envSelectorHeader}
+
+// runReplayCommand sends a captured request through the proxy at PROXY_URL
+// again, against the sandbox, with the sandbox access token in the second
+// argument or SANDBOX_ACCESS_TOKEN (see `ebay-mcp sandbox token`).
+func runReplayCommand(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage: ebay-mcp replay <capture-id> [sandbox-access-token]")
+	}
+	token := os.Getenv("SANDBOX_ACCESS_TOKEN")
+	if len(args) == 2 {
+		token = args[1]
+	}
+	if token == "" {
+		return errors.New("a sandbox access token is required: pass it or set SANDBOX_ACCESS_TOKEN")
+	}
+
+	var c capturedRequest
+	if err := adminRequest("GET", "/admin/captures/"+url.PathEscape(args[0]), &c); err != nil {
+		return err
+	}
+	if c.Request.Truncated {
+		return fmt.Errorf("capture %s has a truncated request body and can't be replayed", c.ID)
+	}
+	body := []byte(c.Request.Body)
+	if c.Request.BodyBase64 != "" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(c.Request.BodyBase64); err != nil {
+			return fmt.Errorf("capture %s has an invalid body: %w", c.ID, err)
+		}
+	}
+
+	query, err := url.ParseQuery(c.Query)
+	if err != nil {
+		return fmt.Errorf("capture %s has an invalid query: %w", c.ID, err)
+	}
+	query.Set(envSelectorParam, envSandbox)
+	target := strings.TrimRight(envOr("PROXY_URL", "https://localhost"), "/") + "/proxy" + c.Path + "?" + query.Encode()
+	req, err := http.NewRequest(c.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range c.Request.Header {
+		req.Header[name] = values
+	}
+	for _, name := range replayHopHeaders {
+		req.Header.Del(name)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Timeout: 2 * time.Minute}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the proxy: %w", err)
+	}
+	defer resp.Body.Close()
+	elapsed := time.Since(start)
+
+	fmt.Printf("%s %s\n", c.Method, c.Path)
+	fmt.Printf("captured: %d in %dms (%s, %s)\n", c.Response.Status, c.DurationMS, c.Environment, c.Time.Format(time.RFC3339))
+	fmt.Printf("replayed: %d in %dms (%s)\n\n", resp.StatusCode, elapsed.Milliseconds(), envSandbox)
+	_, err = io.Copy(os.Stdout, resp.Body)
+	fmt.Println()
+	return err
+}
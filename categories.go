@@ -0,0 +1,536 @@
+package ebaymcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/ebay"
+)
+
+// ### Category Trees #########################################################
+
+// Listings need a leaf categoryId and the item specifics (aspects) that
+// category requires, which assistants tend to guess. Two local tools answer
+// from the marketplace's category tree instead:
+//
+//	GET /categories/suggestions?q=iphone+13        get_category_suggestions
+//	GET /categories/{category_id}/aspects          get_item_aspects_for_category
+//
+// The whole tree of each environment and marketplace is downloaded once
+// (GetCategoryTree) and kept in CATEGORY_TREE_DIR, so suggestions come with
+// their full path and categories are checked to exist and be leaves before
+// eBay is asked for their aspects. Every CATEGORY_TREE_CHECK_INTERVAL
+// (default 24h) the tree's version is compared with eBay's, and a new
+// version is downloaded. Aspects are cached per tree version in the shared
+// cache.
+
+const (
+	categoriesPath                   = "/categories"
+	defaultCategoryTreeCheckInterval = 24 * time.Hour
+	categoryTreeDownloadTimeout      = 5 * time.Minute
+	categoryAspectsTTL               = 24 * time.Hour
+	defaultCategorySuggestions       = 10
+	maxCategorySuggestions           = 50
+	maxAspectValues                  = 25
+)
+
+// categoryNode is a category of a stored tree.
+type categoryNode struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ParentID string `json:"parent,omitempty"`
+	Leaf     bool   `json:"leaf,omitempty"`
+}
+
+// categoryTree is a marketplace's category tree as stored on disk.
+type categoryTree struct {
+	ID         string         `json:"tree_id"`
+	Version    string         `json:"version"`
+	Fetched    time.Time      `json:"fetched"`
+	Categories []categoryNode `json:"categories"`
+
+	byID    map[string]*categoryNode
+	checked time.Time // when the version was last compared with eBay's
+}
+
+// index builds t.byID.
+func (t *categoryTree) index() {
+	t.byID = make(map[string]*categoryNode, len(t.Categories))
+	for i := range t.Categories {
+		t.byID[t.Categories[i].ID] = &t.Categories[i]
+	}
+}
+
+// path returns the names from the root down to category id, e.g.
+// "Cell Phones & Accessories > Cell Phones & Smartphones".
+func (t *categoryTree) path(id string) string {
+	var names []string
+	for n := t.byID[id]; n != nil && len(names) < 16; n = t.byID[n.ParentID] {
+		if n.ParentID == "" {
+			break // the root has no name worth showing
+		}
+		names = append(names, n.Name)
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(names, " > ")
+}
+
+// leavesUnder returns the leaf categories under id, at most limit.
+func (t *categoryTree) leavesUnder(id string, limit int) []*categoryNode {
+	var leaves []*categoryNode
+	for i := range t.Categories {
+		n := &t.Categories[i]
+		if !n.Leaf {
+			continue
+		}
+		for p := t.byID[n.ParentID]; p != nil; p = t.byID[p.ParentID] {
+			if p.ID == id {
+				leaves = append(leaves, n)
+				break
+			}
+		}
+		if len(leaves) >= limit {
+			break
+		}
+	}
+	return leaves
+}
+
+// search returns the leaf categories whose names best match query, for
+// when eBay's suggestions are unavailable.
+func (t *categoryTree) search(query string, limit int) []*categoryNode {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil
+	}
+	type match struct {
+		node  *categoryNode
+		score int
+	}
+	var matches []match
+	for i := range t.Categories {
+		n := &t.Categories[i]
+		if !n.Leaf {
+			continue
+		}
+		name, path := strings.ToLower(n.Name), strings.ToLower(t.path(n.ID))
+		score := 0
+		for _, w := range words {
+			switch {
+			case strings.Contains(name, w):
+				score += 2
+			case strings.Contains(path, w):
+				score++
+			}
+		}
+		if score > 0 {
+			matches = append(matches, match{n, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	out := make([]*categoryNode, len(matches))
+	for i, m := range matches {
+		out[i] = m.node
+	}
+	return out
+}
+
+// flattenCategoryTree stores the nodes of eBay's tree under root.
+func flattenCategoryTree(root *ebay.CategoryTreeNode, parentID string, out []categoryNode) []categoryNode {
+	out = append(out, categoryNode{
+		ID:       root.Category.CategoryID,
+		Name:     root.Category.CategoryName,
+		ParentID: parentID,
+		Leaf:     root.LeafCategoryTreeNode,
+	})
+	for i := range root.ChildCategoryTreeNodes {
+		out = flattenCategoryTree(&root.ChildCategoryTreeNodes[i], root.Category.CategoryID, out)
+	}
+	return out
+}
+
+// categoryTreeStore keeps the category trees in memory and in dir.
+type categoryTreeStore struct {
+	dir      string
+	interval time.Duration
+
+	mu    sync.Mutex
+	trees map[string]*categoryTree // by environment and marketplace
+	locks map[string]*sync.Mutex   // held while checking or downloading a tree
+}
+
+// categoryTrees is set up at startup.
+var categoryTrees *categoryTreeStore
+
+// categoryTreeStoreFromEnv reads CATEGORY_TREE_DIR (default a directory under
+// the system temp dir) and CATEGORY_TREE_CHECK_INTERVAL.
+func categoryTreeStoreFromEnv() (*categoryTreeStore, error) {
+	s := &categoryTreeStore{
+		dir:      envOr("CATEGORY_TREE_DIR", filepath.Join(os.TempDir(), "ebay-mcp-category-trees")),
+		interval: defaultCategoryTreeCheckInterval,
+		trees:    make(map[string]*categoryTree),
+		locks:    make(map[string]*sync.Mutex),
+	}
+	if v := os.Getenv("CATEGORY_TREE_CHECK_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid CATEGORY_TREE_CHECK_INTERVAL %q", v)
+		}
+		s.interval = d
+	}
+	return s, nil
+}
+
+// lock returns the lock of key.
+func (s *categoryTreeStore) lock(key string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[key] = l
+	}
+	return l
+}
+
+// tree returns the category tree of the caller's environment and
+// marketplace, downloading it when eBay has a newer version than the one
+// stored. A tree that can't be checked is used as it is.
+func (s *categoryTreeStore) tree(ctx context.Context, caller *ebayCaller) (*categoryTree, error) {
+	client := caller.client()
+	key := caller.env.Name + "/" + client.Marketplace
+	l := s.lock(key)
+	l.Lock()
+	defer l.Unlock()
+
+	s.mu.Lock()
+	t := s.trees[key]
+	s.mu.Unlock()
+	if t != nil && time.Since(t.checked) < s.interval {
+		return t, nil
+	}
+
+	ref, err := client.GetDefaultCategoryTreeID(ctx)
+	if err != nil {
+		if t != nil {
+			log.Printf("Failed to check the version of category tree %s, using version %s: %v", t.ID, t.Version, err)
+			return t, nil
+		}
+		return nil, err
+	}
+	if t == nil || t.ID != ref.CategoryTreeID || t.Version != ref.CategoryTreeVersion {
+		current := t
+		if t = s.load(caller.env.Name, ref); t == nil {
+			if t, err = s.download(ctx, caller, ref); err != nil {
+				if current == nil {
+					return nil, err
+				}
+				log.Printf("Failed to download version %s of category tree %s, using version %s: %v",
+					ref.CategoryTreeVersion, ref.CategoryTreeID, current.Version, err)
+				return current, nil
+			}
+		}
+	}
+	t.checked = time.Now()
+	s.mu.Lock()
+	s.trees[key] = t
+	s.mu.Unlock()
+	return t, nil
+}
+
+// file is where the tree treeID of environment env is stored.
+func (s *categoryTreeStore) file(env, treeID string) string {
+	return filepath.Join(s.dir, env+"-"+treeID+".json")
+}
+
+// load returns the stored tree ref, or nil if it isn't stored in that
+// version.
+func (s *categoryTreeStore) load(env string, ref *ebay.CategoryTree) *categoryTree {
+	data, err := os.ReadFile(s.file(env, ref.CategoryTreeID))
+	if err != nil {
+		return nil
+	}
+	var t categoryTree
+	if err := json.Unmarshal(data, &t); err != nil {
+		log.Printf("Ignoring unreadable category tree %s: %v", s.file(env, ref.CategoryTreeID), err)
+		return nil
+	}
+	if t.ID != ref.CategoryTreeID || t.Version != ref.CategoryTreeVersion {
+		return nil
+	}
+	t.index()
+	return &t
+}
+
+// download fetches the tree ref and stores it.
+func (s *categoryTreeStore) download(ctx context.Context, caller *ebayCaller, ref *ebay.CategoryTree) (*categoryTree, error) {
+	client := caller.client()
+	client.HTTPClient = &http.Client{Timeout: categoryTreeDownloadTimeout, Transport: ebayTransport}
+	started := time.Now()
+	full, err := client.GetCategoryTree(ctx, ref.CategoryTreeID)
+	if err != nil {
+		return nil, err
+	}
+	t := &categoryTree{
+		ID:         full.CategoryTreeID,
+		Version:    full.CategoryTreeVersion,
+		Fetched:    time.Now().UTC(),
+		Categories: flattenCategoryTree(&full.RootCategoryNode, "", nil),
+	}
+	t.index()
+	log.Printf("Downloaded version %s of category tree %s (%s, %d categories) in %s",
+		t.Version, t.ID, caller.env.Name, len(t.Categories), time.Since(started).Round(time.Millisecond))
+
+	data, err := json.Marshal(t)
+	if err == nil {
+		if err = os.MkdirAll(s.dir, 0700); err == nil {
+			err = writeFileAtomic(s.file(caller.env.Name, t.ID), data)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to store category tree %s: %v", t.ID, err)
+	}
+	return t, nil
+}
+
+// categorySuggestion is a category suggested for a query.
+type categorySuggestion struct {
+	CategoryID string `json:"category_id"`
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+}
+
+// categoryAspect is an item specific of a category, slimmed.
+type categoryAspect struct {
+	Name        string   `json:"name"`
+	Required    bool     `json:"required,omitempty"`
+	Usage       string   `json:"usage,omitempty"` // RECOMMENDED or OPTIONAL
+	Mode        string   `json:"mode,omitempty"`  // FREE_TEXT or SELECTION_ONLY
+	DataType    string   `json:"data_type,omitempty"`
+	Multiple    bool     `json:"multiple,omitempty"`
+	Values      []string `json:"values,omitempty"`
+	ValuesTotal int      `json:"values_total,omitempty"`
+}
+
+// handleCategories serves the category tools under /categories.
+func handleCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, categoriesPath), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "suggestions":
+		handleCategorySuggestions(w, r)
+	case len(parts) == 2 && parts[1] == "aspects" && parts[0] != "":
+		handleCategoryAspects(w, r, parts[0])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// categoryCaller resolves the caller of a category tool and its category
+// tree, checking that the policy allows the Taxonomy API.
+func categoryCaller(w http.ResponseWriter, r *http.Request) (*ebayCaller, *categoryTree, bool) {
+	if err := currentPolicy().AllowPath(http.MethodGet, "/commerce/taxonomy/v1/get_default_category_tree_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, nil, false
+	}
+	caller, status, err := resolveCaller(w, r)
+	if err != nil {
+		log.Printf("Failed to resolve token for the category tools: %v", err)
+		http.Error(w, err.Error(), status)
+		return nil, nil, false
+	}
+	tree, err := categoryTrees.tree(r.Context(), caller)
+	if err != nil {
+		log.Printf("Failed to get the category tree: %v", err)
+		writeEbayError(w, r, caller, err)
+		return nil, nil, false
+	}
+	return caller, tree, true
+}
+
+// handleCategorySuggestions (get_category_suggestions) suggests leaf
+// categories for a product, with their paths. It falls back to searching
+// the stored tree's names when eBay has no suggestions to offer.
+// GET /categories/suggestions?q=...&limit=N
+func handleCategorySuggestions(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	limit, err := boundedParam(r, "limit", defaultCategorySuggestions, maxCategorySuggestions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	caller, tree, ok := categoryCaller(w, r)
+	if !ok {
+		return
+	}
+
+	source := "ebay"
+	var nodes []*categoryNode
+	path := "/commerce/taxonomy/v1/category_tree/" + tree.ID + "/get_category_suggestions"
+	if err := currentPolicy().AllowPath(http.MethodGet, path); err != nil {
+		source = "local"
+	} else if suggestions, err := caller.client().GetCategorySuggestions(r.Context(), tree.ID, query); err != nil {
+		var me *maintenanceError
+		if errors.As(err, &me) {
+			writeMaintenance(w, me)
+			return
+		}
+		log.Printf("Category suggestions failed, searching the category tree: %v", err)
+		source = "local"
+	} else {
+		for _, s := range suggestions {
+			if n := tree.byID[s.Category.CategoryID]; n != nil {
+				nodes = append(nodes, n)
+			}
+		}
+		if len(nodes) == 0 {
+			source = "local"
+		}
+	}
+	if source == "local" {
+		nodes = tree.search(query, limit)
+	}
+	if len(nodes) > limit {
+		nodes = nodes[:limit]
+	}
+
+	out := make([]categorySuggestion, len(nodes))
+	for i, n := range nodes {
+		out[i] = categorySuggestion{CategoryID: n.ID, Name: n.Name, Path: tree.path(n.ID)}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"marketplace_id":        caller.client().Marketplace,
+		"category_tree_id":      tree.ID,
+		"category_tree_version": tree.Version,
+		"source":                source,
+		"suggestions":           out,
+	})
+}
+
+// handleCategoryAspects (get_item_aspects_for_category) lists the item
+// specifics of a leaf category, required ones first.
+// GET /categories/{category_id}/aspects
+func handleCategoryAspects(w http.ResponseWriter, r *http.Request, categoryID string) {
+	caller, tree, ok := categoryCaller(w, r)
+	if !ok {
+		return
+	}
+	node := tree.byID[categoryID]
+	if node == nil {
+		http.Error(w, fmt.Sprintf("Category %s is not in category tree %s; get_category_suggestions finds valid ones", categoryID, tree.ID), http.StatusNotFound)
+		return
+	}
+	if !node.Leaf {
+		var examples []string
+		for _, leaf := range tree.leavesUnder(node.ID, 5) {
+			examples = append(examples, fmt.Sprintf("%s (%s)", leaf.ID, leaf.Name))
+		}
+		http.Error(w, fmt.Sprintf("Category %s (%s) is not a leaf category; listings need one of its subcategories, e.g. %s",
+			node.ID, node.Name, strings.Join(examples, ", ")), http.StatusBadRequest)
+		return
+	}
+	path := "/commerce/taxonomy/v1/category_tree/" + tree.ID + "/get_item_aspects_for_category"
+	if err := currentPolicy().AllowPath(http.MethodGet, path); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	aspects, err := categoryAspects(r.Context(), caller, tree, categoryID)
+	if err != nil {
+		log.Printf("get_item_aspects_for_category failed: %v", err)
+		writeEbayError(w, r, caller, err)
+		return
+	}
+
+	required := []string{}
+	for _, a := range aspects {
+		if a.Required {
+			required = append(required, a.Name)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"category_id":           node.ID,
+		"category_name":         node.Name,
+		"path":                  tree.path(node.ID),
+		"category_tree_version": tree.Version,
+		"required":              required,
+		"aspects":               aspects,
+	})
+}
+
+// categoryAspects returns the slimmed aspects of a leaf category, from the
+// cache while the tree's version is current.
+func categoryAspects(ctx context.Context, caller *ebayCaller, tree *categoryTree, categoryID string) ([]categoryAspect, error) {
+	key := strings.Join([]string{caller.env.Name, caller.marketplace, tree.ID, tree.Version, categoryID}, "\n")
+	var aspects []categoryAspect
+	if data, ok := taxonomyCache.Get(ctx, "aspects", key); ok && json.Unmarshal(data, &aspects) == nil {
+		return aspects, nil
+	}
+	raw, err := caller.client().GetItemAspectsForCategory(ctx, tree.ID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	aspects = slimAspects(raw)
+	if data, err := json.Marshal(aspects); err == nil {
+		taxonomyCache.Set(ctx, "aspects", key, data, categoryAspectsTTL)
+	}
+	return aspects, nil
+}
+
+// slimAspects slims eBay's aspects, required ones first, then recommended
+// ones, each with at most maxAspectValues values.
+func slimAspects(raw []ebay.Aspect) []categoryAspect {
+	out := make([]categoryAspect, 0, len(raw))
+	for _, a := range raw {
+		c := a.AspectConstraint
+		s := categoryAspect{
+			Name:        a.LocalizedAspectName,
+			Required:    c.AspectRequired,
+			Usage:       c.AspectUsage,
+			Mode:        c.AspectMode,
+			DataType:    c.AspectDataType,
+			Multiple:    c.ItemToAspectCardinality == "MULTI",
+			ValuesTotal: len(a.AspectValues),
+		}
+		for i, v := range a.AspectValues {
+			if i >= maxAspectValues {
+				break
+			}
+			s.Values = append(s.Values, v.LocalizedValue)
+		}
+		out = append(out, s)
+	}
+	rank := func(a categoryAspect) int {
+		switch {
+		case a.Required:
+			return 0
+		case a.Usage == "RECOMMENDED":
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(out, func(i, j int) bool { return rank(out[i]) < rank(out[j]) })
+	return out
+}
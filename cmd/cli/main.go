@@ -0,0 +1,527 @@
+// Command ebay-mcp-cli calls the proxy and the account backend from a
+// terminal, so operators can test them without going through ChatGPT.
+// Build it with `go build -o ebay-mcp-cli ./cmd/cli`.
+//
+//	ebay-mcp-cli login [scope...]                  sign in with the device flow and store the tokens
+//	ebay-mcp-cli logout                            forget the stored tokens
+//	ebay-mcp-cli call <method> <path> [body]       call eBay through the proxy, e.g. GET /sell/account/v1/privilege
+//	ebay-mcp-cli tools list                        list the tools the proxy offers
+//	ebay-mcp-cli client create [flags] <name> <redirect-uri>...
+//	                                               register an OAuth client with the backend
+//
+// It reads PROXY_URL (the proxy), BACKEND_URL (the account backend),
+// CLI_CLIENT_ID and CLI_CLIENT_SECRET (the backend client it signs in as),
+// EBAY_MCP_TOKEN (a bearer token to call with instead of the stored login,
+// e.g. a vault: key) and BACKEND_ADMIN_TOKEN (for client create; without it
+// the CLI's client must be a service client). Tokens are stored in
+// ebay-mcp/credentials.json under the user's config directory.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const usage = `usage: ebay-mcp-cli <command>
+  login [scope...]
+  logout
+  call <method> <path> [body | @file | -]
+  tools list
+  client create [-scopes s1,s2] [-service] [-trusted] <name> <redirect-uri>...`
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+var httpClient = &http.Client{Timeout: 2 * time.Minute}
+
+func main() {
+	log.SetFlags(0)
+	args := os.Args[1:]
+	if len(args) == 0 {
+		log.Fatal(usage)
+	}
+
+	var err error
+	switch args[0] {
+	case "login":
+		err = login(args[1:])
+	case "logout":
+		err = logout()
+	case "call":
+		err = call(args[1:])
+	case "tools":
+		if len(args) != 2 || args[1] != "list" {
+			log.Fatal(usage)
+		}
+		err = listTools()
+	case "client":
+		if len(args) < 2 || args[1] != "create" {
+			log.Fatal(usage)
+		}
+		err = createClient(args[2:])
+	default:
+		log.Fatal(usage)
+	}
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// envOr returns the environment variable name, or fallback when unset.
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func proxyURL() string {
+	return strings.TrimRight(envOr("PROXY_URL", "https://localhost"), "/")
+}
+
+func backendURL() string {
+	return strings.TrimRight(envOr("BACKEND_URL", "http://localhost:8081"), "/")
+}
+
+// ### Credentials ############################################################
+
+// credentials are the tokens stored by login.
+type credentials struct {
+	BackendURL   string    `json:"backend_url"`
+	ClientID     string    `json:"client_id"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// tokenResponse is the answer of the backend's token endpoint.
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	Interval         int    `json:"interval"`
+}
+
+func credentialsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ebay-mcp", "credentials.json"), nil
+}
+
+func loadCredentials() (*credentials, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.New("not signed in: run `ebay-mcp-cli login` or set EBAY_MCP_TOKEN")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var creds credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return &creds, nil
+}
+
+func saveCredentials(creds *credentials) error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// clientCredentials returns the form fields authenticating the CLI's client.
+func clientCredentials() (url.Values, error) {
+	id := os.Getenv("CLI_CLIENT_ID")
+	if id == "" {
+		return nil, errors.New("CLI_CLIENT_ID is not set: register a client with the backend (see `client create`)")
+	}
+	return url.Values{"client_id": {id}, "client_secret": {os.Getenv("CLI_CLIENT_SECRET")}}, nil
+}
+
+// postForm posts form to the backend and decodes its JSON answer into out.
+func postForm(path string, form url.Values, out interface{}) error {
+	resp, err := httpClient.PostForm(backendURL()+path, form)
+	if err != nil {
+		return fmt.Errorf("failed to reach the backend: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("POST %s returned status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// accessToken returns EBAY_MCP_TOKEN, or the stored access token, refreshed
+// first when it has expired.
+func accessToken() (string, error) {
+	if token := os.Getenv("EBAY_MCP_TOKEN"); token != "" {
+		return token, nil
+	}
+	creds, err := loadCredentials()
+	if err != nil {
+		return "", err
+	}
+	if time.Until(creds.ExpiresAt) > 30*time.Second {
+		return creds.AccessToken, nil
+	}
+	if creds.RefreshToken == "" {
+		return "", errors.New("the stored token has expired: run `ebay-mcp-cli login` again")
+	}
+
+	form, err := clientCredentials()
+	if err != nil {
+		return "", err
+	}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", creds.RefreshToken)
+	var token tokenResponse
+	if err := postForm("/oauth/token", form, &token); err != nil {
+		return "", err
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("refreshing the stored token failed (%s): run `ebay-mcp-cli login` again", token.Error)
+	}
+	creds.AccessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		creds.RefreshToken = token.RefreshToken
+	}
+	creds.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	if err := saveCredentials(creds); err != nil {
+		return "", err
+	}
+	return creds.AccessToken, nil
+}
+
+// ### Login ##################################################################
+
+// login runs the device authorization grant (RFC 8628) with the backend:
+// the user approves the code in a browser while the CLI polls for tokens.
+func login(scopes []string) error {
+	form, err := clientCredentials()
+	if err != nil {
+		return err
+	}
+	if len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+	var device struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+		Error                   string `json:"error"`
+		ErrorDescription        string `json:"error_description"`
+	}
+	if err := postForm("/oauth/device/code", form, &device); err != nil {
+		return err
+	}
+	if device.Error != "" {
+		return fmt.Errorf("the backend refused the device authorization: %s %s", device.Error, device.ErrorDescription)
+	}
+
+	fmt.Printf("Open %s and enter the code %s\n", device.VerificationURI, device.UserCode)
+	if openBrowser(device.VerificationURIComplete) == nil {
+		fmt.Println("(opened in your browser)")
+	}
+
+	interval := time.Duration(max(device.Interval, 1)) * time.Second
+	deadline := time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+	form.Set("grant_type", deviceCodeGrantType)
+	form.Set("device_code", device.DeviceCode)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+		var token tokenResponse
+		if err := postForm("/oauth/token", form, &token); err != nil {
+			return err
+		}
+		switch token.Error {
+		case "":
+			creds := &credentials{
+				BackendURL:   backendURL(),
+				ClientID:     form.Get("client_id"),
+				AccessToken:  token.AccessToken,
+				RefreshToken: token.RefreshToken,
+				Scope:        token.Scope,
+				ExpiresAt:    time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+			}
+			if err := saveCredentials(creds); err != nil {
+				return err
+			}
+			path, _ := credentialsPath()
+			fmt.Printf("Signed in (scope %q); tokens stored in %s\n", token.Scope, path)
+			return nil
+		case "authorization_pending":
+		case "slow_down":
+			interval = time.Duration(max(token.Interval, int(interval.Seconds())+5)) * time.Second
+		case "access_denied":
+			return errors.New("the sign-in was denied")
+		case "expired_token":
+			return errors.New("the code expired before it was approved")
+		default:
+			return fmt.Errorf("sign-in failed: %s %s", token.Error, token.ErrorDescription)
+		}
+	}
+	return errors.New("the code expired before it was approved")
+}
+
+// openBrowser opens u in the desktop's browser, if there is one.
+func openBrowser(u string) error {
+	if u == "" {
+		return errors.New("no URL")
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", u).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", u).Start()
+	default:
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return errors.New("no display")
+		}
+		return exec.Command("xdg-open", u).Start()
+	}
+}
+
+func logout() error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	fmt.Println("Signed out")
+	return nil
+}
+
+// ### Calls ##################################################################
+
+// call sends method path through the proxy's /proxy route. The body is the
+// argument itself, @file for a file's contents or - for stdin. The status
+// goes to stderr and the response, indented when it is JSON, to stdout.
+func call(args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New("usage: ebay-mcp-cli call <method> <path> [body | @file | -]")
+	}
+	method, path := strings.ToUpper(args[0]), args[1]
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	path = strings.TrimPrefix(path, "/proxy")
+
+	var body io.Reader
+	if len(args) == 3 {
+		switch arg := args[2]; {
+		case arg == "-":
+			body = os.Stdin
+		case strings.HasPrefix(arg, "@"):
+			data, err := os.ReadFile(arg[1:])
+			if err != nil {
+				return err
+			}
+			body = bytes.NewReader(data)
+		default:
+			body = strings.NewReader(arg)
+		}
+	}
+
+	token, err := accessToken()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, proxyURL()+"/proxy"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the proxy: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s %s: %s in %dms\n", method, path, resp.Status, time.Since(start).Milliseconds())
+	if id := resp.Header.Get("X-Proxy-Capture-Id"); id != "" {
+		fmt.Fprintf(os.Stderr, "capture %s\n", id)
+	}
+
+	var indented bytes.Buffer
+	if json.Indent(&indented, data, "", "  ") == nil {
+		data = indented.Bytes()
+	}
+	os.Stdout.Write(data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		fmt.Println()
+	}
+	if resp.StatusCode >= 400 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// listTools prints the operations of the proxy's /openapi.json: the tools
+// its TOOL_PROFILE offers.
+func listTools() error {
+	resp, err := httpClient.Get(proxyURL() + "/openapi.json")
+	if err != nil {
+		return fmt.Errorf("failed to reach the proxy: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET /openapi.json returned status %d", resp.StatusCode)
+	}
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		return fmt.Errorf("invalid /openapi.json: %w", err)
+	}
+
+	type tool struct{ name, method, path, summary string }
+	var tools []tool
+	for path, ops := range spec.Paths {
+		for method, raw := range ops {
+			var op struct {
+				OperationID string `json:"operationId"`
+				Summary     string `json:"summary"`
+			}
+			if json.Unmarshal(raw, &op) != nil || op.OperationID == "" {
+				continue
+			}
+			tools = append(tools, tool{op.OperationID, strings.ToUpper(method), path, op.Summary})
+		}
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].name < tools[j].name })
+	for _, t := range tools {
+		fmt.Printf("%-36s %-6s %-48s %s\n", t.name, t.method, t.path, t.summary)
+	}
+	return nil
+}
+
+// ### Backend Clients ########################################################
+
+// createClient registers an OAuth client with the backend's admin API and
+// prints it with its secret, which the backend never shows again.
+func createClient(args []string) error {
+	fs := flag.NewFlagSet("client create", flag.ContinueOnError)
+	scopes := fs.String("scopes", "", "comma-separated restricted scopes the client may request")
+	service := fs.Bool("service", false, "allow the client_credentials grant for the admin API")
+	trusted := fs.Bool("trusted", false, "skip the consent screen")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return errors.New("usage: ebay-mcp-cli client create [-scopes s1,s2] [-service] [-trusted] <name> <redirect-uri>...")
+	}
+
+	body := map[string]interface{}{
+		"name":          fs.Arg(0),
+		"redirect_uris": fs.Args()[1:],
+		"service":       *service,
+		"trusted":       *trusted,
+	}
+	if *scopes != "" {
+		body["allowed_scopes"] = strings.Split(*scopes, ",")
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	token, err := adminToken()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, backendURL()+"/api/admin/clients", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the backend: %w", err)
+	}
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("POST /api/admin/clients returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(out)))
+	}
+	var indented bytes.Buffer
+	if json.Indent(&indented, out, "", "  ") == nil {
+		out = indented.Bytes()
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// adminToken returns BACKEND_ADMIN_TOKEN, or a client_credentials token of
+// the CLI's client, which must then be a service client.
+func adminToken() (string, error) {
+	if token := os.Getenv("BACKEND_ADMIN_TOKEN"); token != "" {
+		return token, nil
+	}
+	form, err := clientCredentials()
+	if err != nil {
+		return "", errors.New("set BACKEND_ADMIN_TOKEN, or CLI_CLIENT_ID and CLI_CLIENT_SECRET of a service client")
+	}
+	form.Set("grant_type", "client_credentials")
+	form.Set("scope", "admin:manage_clients")
+	var token tokenResponse
+	if err := postForm("/oauth/token", form, &token); err != nil {
+		return "", err
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("the backend refused the client credentials (%s); set BACKEND_ADMIN_TOKEN", token.Error)
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,98 @@
+// Command ebay-mcp runs the eBay GPT Action proxy, the account backend
+// (the OAuth provider the proxy's users sign in with), or both in one
+// process. See the README at the root of the module for their
+// configuration.
+//
+//	ebay-mcp serve proxy        the proxy (the default without arguments)
+//	ebay-mcp serve auth         the account backend
+//	ebay-mcp serve all          both, the proxy using the backend in-process
+//	ebay-mcp mcp stdio          an MCP server on stdin and stdout
+//	ebay-mcp auth <command>     a backend command: config check, migrate,
+//	                            bootstrap or archive
+//
+// Other arguments are proxy commands, e.g. `ebay-mcp config check`.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ayouroukov/ebay-mcp/backend/app"
+
+	ebaymcp "github.com/ayouroukov/ebay-mcp"
+)
+
+const usage = "usage: ebay-mcp [serve proxy|auth|all | mcp stdio | auth <command> | <proxy command>]"
+
+func main() {
+	args := os.Args[1:]
+	switch {
+	case len(args) > 0 && args[0] == "auth":
+		if len(args) == 1 {
+			log.Fatal(usage)
+		}
+		app.Main(args[1:])
+		return
+	case len(args) == 2 && args[0] == "serve" && args[1] == "auth":
+		app.Main(nil)
+		return
+	}
+
+	if err := ebaymcp.LoadEnvironment(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	var err error
+	switch {
+	case len(args) == 0, len(args) == 2 && args[0] == "serve" && args[1] == "proxy":
+		err = ebaymcp.ListenAndServe()
+	case len(args) == 2 && args[0] == "serve" && args[1] == "all":
+		err = serveAll()
+	case len(args) == 2 && args[0] == "mcp" && args[1] == "stdio":
+		err = ebaymcp.RunCommand([]string{"mcp"})
+	case args[0] == "serve":
+		err = errors.New(usage)
+	default:
+		err = ebaymcp.RunCommand(args)
+	}
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// serveAll runs the account backend and the proxy in one process until
+// SIGINT or SIGTERM. The backend listens on PORT, 8081 unless set so that it
+// doesn't collide with a plain HTTP proxy on 8080, and the proxy reaches it
+// there unless BACKEND_URL says otherwise.
+func serveAll() error {
+	if os.Getenv("PORT") == "" {
+		os.Setenv("PORT", "8081")
+	}
+	if os.Getenv("BACKEND_URL") == "" {
+		os.Setenv("BACKEND_URL", "http://127.0.0.1:"+os.Getenv("PORT"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// The proxy may read its policy from the backend as it starts
+	listening := make(chan struct{})
+	authErr := make(chan error, 1)
+	go func() { authErr <- app.Run(ctx, listening) }()
+	select {
+	case <-listening:
+	case err := <-authErr:
+		return fmt.Errorf("account backend: %w", err)
+	}
+
+	err := ebaymcp.ListenAndServe()
+	stop()
+	if backendErr := <-authErr; backendErr != nil && err == nil {
+		err = fmt.Errorf("account backend: %w", backendErr)
+	}
+	return err
+}
@@ -0,0 +1,312 @@
+package ebaymcp
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ayouroukov/ebay-mcp/internal/telemetry"
+)
+
+// ### Compression ############################################################
+
+// The proxy always asks eBay for gzip. A compressed response the client also
+// accepts passes through untouched; otherwise it is decoded, either because
+// the proxy has to read it (PII stripping, error logging) or because the
+// client can't. Uncompressed bodies are then compressed toward the client
+// according to its Accept-Encoding. The policy's `compression` rules tune
+// this per eBay path: which media types and sizes are compressed, at what
+// level, or that responses go out uncompressed whatever the client accepts,
+// for clients whose payload limits apply to the compressed size.
+
+// Compression modes of a CompressionRule.
+const (
+	compressionAuto     = "auto"     // pass through eBay's encoding, compress the rest
+	compressionOff      = "off"      // pass through eBay's encoding, never compress
+	compressionIdentity = "identity" // always send uncompressed bodies
+)
+
+// defaultCompressMinSize is the smallest known-length body worth compressing.
+const defaultCompressMinSize = 1024
+
+// defaultCompressTypes are the media types compressed unless a rule says
+// otherwise: text, JSON and XML.
+var defaultCompressTypes = []string{"text/*", "*json", "*xml"}
+
+// CompressionRule tunes the encoding of responses for eBay paths under
+// Prefix. Zero fields take the defaults.
+type CompressionRule struct {
+	Prefix  string   `yaml:"prefix"`
+	Mode    string   `yaml:"mode,omitempty"`     // auto (default), off or identity
+	MinSize int      `yaml:"min_size,omitempty"` // bytes; default 1024
+	Level   int      `yaml:"level,omitempty"`    // 1 (fastest) to 9 (smallest); default 6
+	Types   []string `yaml:"types,omitempty"`    // e.g. "application/json", "text/*", "*+xml"
+}
+
+// validate checks the rule at index i of the policy.
+func (c *CompressionRule) validate(i int) []string {
+	var problems []string
+	if !strings.HasPrefix(c.Prefix, "/") {
+		problems = append(problems, fmt.Sprintf("compression[%d]: prefix %q must start with /", i, c.Prefix))
+	}
+	switch c.Mode {
+	case "", compressionAuto, compressionOff, compressionIdentity:
+	default:
+		problems = append(problems, fmt.Sprintf("compression[%d]: unknown mode %q (expected auto, off or identity)", i, c.Mode))
+	}
+	if c.MinSize < 0 {
+		problems = append(problems, fmt.Sprintf("compression[%d]: min_size must not be negative", i))
+	}
+	if c.Level < 0 || c.Level > gzip.BestCompression {
+		problems = append(problems, fmt.Sprintf("compression[%d]: level must be between 1 and 9", i))
+	}
+	for _, t := range c.Types {
+		if t == "" || strings.Count(t, "*") > 1 {
+			problems = append(problems, fmt.Sprintf("compression[%d]: invalid type %q", i, t))
+		}
+	}
+	return problems
+}
+
+// compressionRuleFor returns the most specific compression rule for path
+// with the defaults filled in.
+func (p *Policy) compressionRuleFor(path string) CompressionRule {
+	var best *CompressionRule
+	for i := range p.Compression {
+		rule := &p.Compression[i]
+		if strings.HasPrefix(path, rule.Prefix) && (best == nil || len(rule.Prefix) > len(best.Prefix)) {
+			best = rule
+		}
+	}
+	rule := CompressionRule{Prefix: "/"}
+	if best != nil {
+		rule = *best
+	}
+	if rule.Mode == "" {
+		rule.Mode = compressionAuto
+	}
+	if rule.MinSize == 0 {
+		rule.MinSize = defaultCompressMinSize
+	}
+	if rule.Level == 0 {
+		rule.Level = gzip.DefaultCompression
+	}
+	if len(rule.Types) == 0 {
+		rule.Types = defaultCompressTypes
+	}
+	return rule
+}
+
+// matchesMediaType reports whether mediaType matches one of patterns: exact,
+// "type/*" for a prefix or "*suffix" for a suffix.
+func matchesMediaType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		switch {
+		case pattern == "*":
+			return true
+		case strings.HasSuffix(pattern, "*"):
+			if strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		case strings.HasPrefix(pattern, "*"):
+			if strings.HasSuffix(mediaType, strings.TrimPrefix(pattern, "*")) {
+				return true
+			}
+		case pattern == mediaType:
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows coding.
+func acceptsEncoding(header, coding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != coding && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// decodeBody replaces a gzip or deflate encoded resp.Body with its decoded
+// stream. Bodies in other codings are left alone.
+func decodeBody(resp *http.Response) error {
+	var decoded io.ReadCloser
+	var err error
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip", "x-gzip":
+		decoded, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		decoded, err = zlib.NewReader(resp.Body)
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", resp.Header.Get("Content-Encoding"), err)
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{decoded, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// compressible reports whether rule has a response body compressed.
+func compressible(resp *http.Response, rule CompressionRule) bool {
+	if resp.Header.Get("Content-Encoding") != "" || resp.StatusCode == http.StatusNoContent ||
+		resp.StatusCode == http.StatusNotModified {
+		return false
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength < int64(rule.MinSize) {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return matchesMediaType(rule.Types, mediaType)
+}
+
+// negotiateEncoding makes resp's encoding one that acceptEncoding (the
+// client's header) and rule allow, decoding or compressing the body as
+// needed.
+func negotiateEncoding(resp *http.Response, acceptEncoding string, rule CompressionRule) error {
+	resp.Header.Add("Vary", "Accept-Encoding")
+
+	if coding := strings.ToLower(resp.Header.Get("Content-Encoding")); coding != "" {
+		if rule.Mode != compressionIdentity && acceptsEncoding(acceptEncoding, coding) {
+			compression.count("passthrough")
+			return nil
+		}
+		if err := decodeBody(resp); err != nil {
+			return err
+		}
+	}
+	if rule.Mode != compressionAuto || !compressible(resp, rule) {
+		compression.count("identity")
+		return nil
+	}
+
+	switch {
+	case acceptsEncoding(acceptEncoding, "gzip"):
+		compressBody(resp, "gzip", func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, rule.Level) })
+	case acceptsEncoding(acceptEncoding, "deflate"):
+		compressBody(resp, "deflate", func(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriterLevel(w, rule.Level) })
+	default:
+		compression.count("identity")
+	}
+	return nil
+}
+
+// compressBody streams resp.Body through a compressor, so large responses
+// are never held in memory.
+func compressBody(resp *http.Response, coding string, newWriter func(io.Writer) (io.WriteCloser, error)) {
+	body := resp.Body
+	pr, pw := io.Pipe()
+	go func() {
+		in := &countingReader{r: body}
+		out := &countingWriter{w: pw}
+		zw, err := newWriter(out)
+		if err == nil {
+			_, err = io.Copy(zw, in)
+			if cerr := zw.Close(); err == nil {
+				err = cerr
+			}
+		}
+		body.Close()
+		pw.CloseWithError(err)
+		compression.record(coding, in.n, out.n)
+	}()
+
+	resp.Body = pr
+	resp.Header.Set("Content-Encoding", coding)
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// compressionStats counts how responses were encoded toward clients and
+// the bytes the proxy compressed, so the savings can be watched.
+type compressionStats struct {
+	mu        sync.Mutex
+	responses map[string]uint64 // by outcome: compressed, passthrough, identity
+	input     map[string]uint64 // by coding: bytes before compression
+	output    map[string]uint64 // by coding: bytes after compression
+}
+
+// compression is the process-wide compression counters.
+var compression = &compressionStats{
+	responses: make(map[string]uint64),
+	input:     make(map[string]uint64),
+	output:    make(map[string]uint64),
+}
+
+// count records a response sent as outcome.
+func (s *compressionStats) count(outcome string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[outcome]++
+}
+
+// record counts a response the proxy compressed with coding.
+func (s *compressionStats) record(coding string, in, out int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses["compressed"]++
+	s.input[coding] += uint64(in)
+	s.output[coding] += uint64(out)
+}
+
+// writePrometheus appends the compression counters.
+func (s *compressionStats) writePrometheus(w *strings.Builder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	telemetry.Counter(w, "ebay_proxy_compression_responses_total",
+		"Proxied responses by encoding outcome: compressed by the proxy, eBay's encoding passed through, or sent uncompressed.",
+		"outcome", s.responses)
+	telemetry.Counter(w, "ebay_proxy_compression_input_bytes_total",
+		"Bytes of response bodies the proxy compressed, before compression.", "coding", s.input)
+	telemetry.Counter(w, "ebay_proxy_compression_output_bytes_total",
+		"Bytes of response bodies the proxy compressed, after compression.", "coding", s.output)
+}
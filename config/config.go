@@ -0,0 +1,396 @@
+// Package config reads the settings of the eBay proxy and the account
+// backend from one YAML file, checked against a typed schema.
+//
+// Both programs are configured through environment variables. The file is
+// another way of setting them: each setting has a dotted path in the file
+// and the variable it stands for, and Load copies the file's values into the
+// environment before the programs read it. A variable that is already set
+// wins over the file, so deployments can keep one file and override single
+// values per instance.
+//
+//	shared:
+//	  internal_signing_secrets: [current-secret, previous-secret]
+//	proxy:
+//	  ebay:
+//	    client_id: MyApp-PRD-1234
+//	    scopes: [https://api.ebay.com/oauth/api_scope]
+//	backend:
+//	  database:
+//	    driver: postgres
+//	    host: db.internal
+//
+// The top-level sections are shared (read by both programs), proxy and
+// backend; each program ignores the other's section.
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sections are the top-level keys of a configuration file.
+var Sections = []string{"shared", "proxy", "backend"}
+
+// Kind is the type of a setting's value.
+type Kind int
+
+const (
+	String   Kind = iota
+	Int           // non-negative integer
+	Float         // decimal number
+	Bool          // true or false
+	Duration      // Go duration such as 30s or 5m
+	URL           // absolute URL
+	List          // sequence in the file, Sep-separated in the environment
+	Key           // 32 base64-encoded bytes
+)
+
+// Setting describes one value of the configuration.
+type Setting struct {
+	Path     string // dotted path in the file, e.g. "backend.database.host"
+	Env      string // environment variable it sets, e.g. "DB_HOST"
+	Kind     Kind
+	Choices  []string // allowed values, if limited
+	Sep      string   // separator of a List in the environment, "," if empty
+	Required bool     // must be set, in the file or the environment
+	Secret   bool     // never shown in messages
+}
+
+// Schema is the settings a program reads.
+type Schema []Setting
+
+// With returns s followed by more, leaving s unchanged.
+func (s Schema) With(more ...Setting) Schema {
+	out := make(Schema, 0, len(s)+len(more))
+	return append(append(out, s...), more...)
+}
+
+// Public returns the settings of s that are not secrets: those that can be
+// validated before a secrets backend has filled in the others.
+func (s Schema) Public() Schema {
+	var out Schema
+	for _, setting := range s {
+		if !setting.Secret {
+			out = append(out, setting)
+		}
+	}
+	return out
+}
+
+// Problem is one missing, unknown or invalid setting.
+type Problem struct {
+	Where   string // "file:line: path" or "path (ENV)"
+	Message string
+}
+
+// Problems are all the problems found in a configuration; Load and
+// Validate return them as their error.
+type Problems []Problem
+
+func (ps Problems) Error() string {
+	var b strings.Builder
+	if len(ps) == 1 {
+		b.WriteString("invalid configuration:")
+	} else {
+		fmt.Fprintf(&b, "invalid configuration, %d problems:", len(ps))
+	}
+	for _, p := range ps {
+		fmt.Fprintf(&b, "\n  %s: %s", p.Where, p.Message)
+	}
+	return b.String()
+}
+
+// fromFile are the variables Load has set, with their values. Loading
+// again with the same schema replaces them, or unsets those no longer in the
+// file, unless something else has changed them since. Schemas of programs
+// sharing a process leave each other's variables alone.
+var fromFile = struct {
+	sync.Mutex
+	values map[string]string
+}{values: make(map[string]string)}
+
+// Load reads the configuration file at path and sets the environment
+// variables of its values, except those already set. It returns how many it
+// set. The whole file is checked before anything is set: unknown settings,
+// values of the wrong shape and sections other than Sections are reported
+// together, as are values of the wrong kind. The section of another program
+// is skipped.
+//
+// Loading a file again, e.g. after it changed, replaces the values the
+// earlier Load set.
+func (s Schema) Load(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return 0, nil
+	}
+
+	l := &loader{file: path, byPath: make(map[string]*Setting), values: make(map[string]string)}
+	owned := make(map[string]bool)
+	envs := make(map[string]bool)
+	for i := range s {
+		l.byPath[s[i].Path] = &s[i]
+		owned[strings.SplitN(s[i].Path, ".", 2)[0]] = true
+		envs[s[i].Env] = true
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return 0, fmt.Errorf("%s:%d: expected a mapping of sections (%s)", path, root.Line, strings.Join(Sections, ", "))
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch {
+		case owned[key.Value]:
+			l.walk(key.Value, value)
+		case !contains(Sections, key.Value):
+			l.problem(key, key.Value, "unknown section"+suggest(key.Value, Sections))
+		}
+	}
+	if len(l.problems) > 0 {
+		return 0, l.problems
+	}
+
+	fromFile.Lock()
+	defer fromFile.Unlock()
+	for env, value := range fromFile.values {
+		if _, ok := l.values[env]; envs[env] && !ok && os.Getenv(env) == value {
+			os.Unsetenv(env)
+			delete(fromFile.values, env)
+		}
+	}
+	set := 0
+	for env, value := range l.values {
+		if current := os.Getenv(env); current != "" && current != fromFile.values[env] {
+			continue
+		}
+		if err := os.Setenv(env, value); err != nil {
+			return set, err
+		}
+		fromFile.values[env] = value
+		set++
+	}
+	return set, nil
+}
+
+// loader collects the values of a file, and what is wrong with it.
+type loader struct {
+	file     string
+	byPath   map[string]*Setting
+	values   map[string]string // by environment variable
+	problems Problems
+}
+
+func (l *loader) problem(n *yaml.Node, path, message string) {
+	l.problems = append(l.problems, Problem{Where: fmt.Sprintf("%s:%d: %s", l.file, n.Line, path), Message: message})
+}
+
+// walk records the values under path.
+func (l *loader) walk(path string, n *yaml.Node) {
+	if setting, ok := l.byPath[path]; ok {
+		l.leaf(setting, n)
+		return
+	}
+	if n.Kind != yaml.MappingNode {
+		if n.Tag == "!!null" {
+			return
+		}
+		l.problem(n, path, "unknown setting"+suggest(path, l.paths()))
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		child := path + "." + key.Value
+		if !l.known(child) {
+			l.problem(key, child, "unknown setting"+suggest(child, l.paths()))
+			continue
+		}
+		l.walk(child, value)
+	}
+}
+
+// leaf records the value of setting.
+func (l *loader) leaf(setting *Setting, n *yaml.Node) {
+	switch {
+	case n.Kind == yaml.ScalarNode && n.Tag == "!!null":
+		return
+	case n.Kind == yaml.ScalarNode:
+		l.value(setting, n, n.Value)
+	case n.Kind == yaml.SequenceNode && setting.Kind == List:
+		items := make([]string, 0, len(n.Content))
+		for _, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				l.problem(item, setting.Path, "expected a list of plain values")
+				return
+			}
+			items = append(items, item.Value)
+		}
+		l.value(setting, n, strings.Join(items, setting.sep()))
+	case setting.Kind == List:
+		l.problem(n, setting.Path, "expected a list or a value")
+	default:
+		l.problem(n, setting.Path, "expected a single value")
+	}
+}
+
+// value records value for setting, if it has the setting's kind.
+func (l *loader) value(setting *Setting, n *yaml.Node, value string) {
+	if message := setting.check(value); message != "" {
+		if !setting.Secret {
+			message = fmt.Sprintf("%s, got %q", message, value)
+		}
+		l.problem(n, setting.Path, message)
+		return
+	}
+	l.values[setting.Env] = value
+}
+
+// known reports whether path is a setting or contains one.
+func (l *loader) known(path string) bool {
+	if _, ok := l.byPath[path]; ok {
+		return true
+	}
+	for p := range l.byPath {
+		if strings.HasPrefix(p, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *loader) paths() []string {
+	paths := make([]string, 0, len(l.byPath))
+	for p := range l.byPath {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (s Setting) sep() string {
+	if s.Sep == "" {
+		return ","
+	}
+	return s.Sep
+}
+
+// Validate checks the environment, and so the values Load set, against the
+// schema: every required setting is set and every value has its kind. All
+// problems are reported together.
+func (s Schema) Validate() error {
+	var problems Problems
+	for _, setting := range s {
+		where := fmt.Sprintf("%s (%s)", setting.Path, setting.Env)
+		value := os.Getenv(setting.Env)
+		if value == "" {
+			if setting.Required {
+				problems = append(problems, Problem{Where: where, Message: "required, set it in the file or the environment"})
+			}
+			continue
+		}
+		if message := setting.check(value); message != "" {
+			if !setting.Secret {
+				message = fmt.Sprintf("%s, got %q", message, value)
+			}
+			problems = append(problems, Problem{Where: where, Message: message})
+		}
+	}
+	if len(problems) > 0 {
+		sort.Slice(problems, func(i, j int) bool { return problems[i].Where < problems[j].Where })
+		return problems
+	}
+	return nil
+}
+
+// check returns what is wrong with value, if anything.
+func (s Setting) check(value string) string {
+	if len(s.Choices) > 0 && !contains(s.Choices, value) {
+		return "expected one of " + strings.Join(s.Choices, ", ")
+	}
+	switch s.Kind {
+	case Int:
+		if n, err := strconv.ParseInt(value, 10, 64); err != nil || n < 0 {
+			return "expected a non-negative integer"
+		}
+	case Float:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "expected a number"
+		}
+	case Bool:
+		if value != "true" && value != "false" {
+			return "expected true or false"
+		}
+	case Duration:
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return "expected a duration such as 30s or 5m"
+		}
+	case URL:
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return "expected an absolute URL"
+		}
+	case Key:
+		if key, err := base64.StdEncoding.DecodeString(value); err != nil || len(key) != 32 {
+			return "expected 32 base64-encoded bytes"
+		}
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest returns " (did you mean ...?)" for the candidate closest to s,
+// if one is a likely typo of it.
+func suggest(s string, candidates []string) string {
+	best, bestDistance := "", 3
+	for _, c := range candidates {
+		if d := distance(s, c); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %s?)", best)
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
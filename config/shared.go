@@ -0,0 +1,34 @@
+package config
+
+// Shared are the settings both programs read: where secrets come from, the
+// secrets signing the internal API between them and the store they keep
+// shared state in.
+var Shared = Schema{
+	{Path: "shared.internal_signing_secrets", Env: "INTERNAL_SIGNING_SECRETS", Kind: List, Secret: true},
+
+	{Path: "shared.cache.backend", Env: "CACHE_BACKEND", Choices: []string{"memory", "redis", "memcached"}},
+	{Path: "shared.cache.url", Env: "CACHE_URL"},
+	{Path: "shared.cache.key_prefix", Env: "CACHE_KEY_PREFIX"},
+	{Path: "shared.cache.max_bytes", Env: "CACHE_MAX_BYTES", Kind: Int},
+	{Path: "shared.cache.pool_size", Env: "CACHE_POOL_SIZE", Kind: Int},
+	{Path: "shared.cache.timeout", Env: "CACHE_TIMEOUT", Kind: Duration},
+
+	{Path: "shared.secrets.backend", Env: "SECRETS_BACKEND", Choices: []string{"env", "file", "vault", "aws", "gcp"}},
+	{Path: "shared.secrets.refresh_interval", Env: "SECRETS_REFRESH_INTERVAL", Kind: Duration},
+	{Path: "shared.secrets.dir", Env: "SECRETS_DIR"},
+	{Path: "shared.secrets.vault.addr", Env: "SECRETS_VAULT_ADDR", Kind: URL},
+	{Path: "shared.secrets.vault.token", Env: "SECRETS_VAULT_TOKEN", Secret: true},
+	{Path: "shared.secrets.vault.mount", Env: "SECRETS_VAULT_MOUNT"},
+	{Path: "shared.secrets.vault.path", Env: "SECRETS_VAULT_PATH"},
+	{Path: "shared.secrets.vault.namespace", Env: "SECRETS_VAULT_NAMESPACE"},
+	{Path: "shared.secrets.aws.secret_id", Env: "SECRETS_AWS_SECRET_ID"},
+	{Path: "shared.secrets.aws.endpoint", Env: "SECRETS_AWS_ENDPOINT", Kind: URL},
+	{Path: "shared.secrets.aws.region", Env: "AWS_REGION"},
+	{Path: "shared.secrets.aws.access_key_id", Env: "AWS_ACCESS_KEY_ID"},
+	{Path: "shared.secrets.aws.secret_access_key", Env: "AWS_SECRET_ACCESS_KEY", Secret: true},
+	{Path: "shared.secrets.aws.session_token", Env: "AWS_SESSION_TOKEN", Secret: true},
+	{Path: "shared.secrets.aws.profile", Env: "AWS_PROFILE"},
+	{Path: "shared.secrets.gcp.project", Env: "SECRETS_GCP_PROJECT"},
+	{Path: "shared.secrets.gcp.token", Env: "SECRETS_GCP_TOKEN", Secret: true},
+	{Path: "shared.secrets.gcp.credentials", Env: "GOOGLE_APPLICATION_CREDENTIALS"},
+}
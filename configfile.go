@@ -0,0 +1,204 @@
+package ebaymcp
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ayouroukov/ebay-mcp/config"
+)
+
+// ### Configuration File #####################################################
+
+// CONFIG_FILE names a YAML file with the settings below, an alternative to
+// setting each environment variable (see the config package). Variables
+// that are set win over the file. `ebay-mcp config check` validates the
+// file and the environment without starting the server.
+
+// proxySettings is the schema of the proxy's section of the file.
+var proxySettings = config.Shared.With(
+	config.Setting{Path: "proxy.ebay.client_id", Env: "EBAY_CLIENT_ID", Required: true},
+	config.Setting{Path: "proxy.ebay.client_secret", Env: "EBAY_CLIENT_SECRET", Required: true, Secret: true},
+	config.Setting{Path: "proxy.ebay.scopes", Env: "EBAY_SCOPES", Kind: config.List, Sep: " ", Required: true},
+	config.Setting{Path: "proxy.ebay.api_host", Env: "EBAY_API_HOST", Required: true},
+	config.Setting{Path: "proxy.ebay.auth_url", Env: "EBAY_AUTH_URL", Kind: config.URL, Required: true},
+	config.Setting{Path: "proxy.ebay.token_url", Env: "EBAY_TOKEN_URL", Kind: config.URL, Required: true},
+	config.Setting{Path: "proxy.ebay.marketplace_id", Env: "EBAY_MARKETPLACE_ID"},
+	config.Setting{Path: "proxy.ebay.signing_key_file", Env: "EBAY_SIGNING_KEY_FILE"},
+	config.Setting{Path: "proxy.ebay.sandbox.client_id", Env: "EBAY_SANDBOX_CLIENT_ID"},
+	config.Setting{Path: "proxy.ebay.sandbox.client_secret", Env: "EBAY_SANDBOX_CLIENT_SECRET", Secret: true},
+	config.Setting{Path: "proxy.ebay.sandbox.scopes", Env: "EBAY_SANDBOX_SCOPES", Kind: config.List, Sep: " "},
+	config.Setting{Path: "proxy.ebay.sandbox.api_host", Env: "EBAY_SANDBOX_API_HOST"},
+	config.Setting{Path: "proxy.ebay.sandbox.auth_url", Env: "EBAY_SANDBOX_AUTH_URL", Kind: config.URL},
+	config.Setting{Path: "proxy.ebay.sandbox.token_url", Env: "EBAY_SANDBOX_TOKEN_URL", Kind: config.URL},
+	config.Setting{Path: "proxy.ebay.production.client_id", Env: "EBAY_PRODUCTION_CLIENT_ID"},
+	config.Setting{Path: "proxy.ebay.production.client_secret", Env: "EBAY_PRODUCTION_CLIENT_SECRET", Secret: true},
+	config.Setting{Path: "proxy.ebay.production.scopes", Env: "EBAY_PRODUCTION_SCOPES", Kind: config.List, Sep: " "},
+	config.Setting{Path: "proxy.ebay.production.api_host", Env: "EBAY_PRODUCTION_API_HOST"},
+	config.Setting{Path: "proxy.ebay.production.auth_url", Env: "EBAY_PRODUCTION_AUTH_URL", Kind: config.URL},
+	config.Setting{Path: "proxy.ebay.production.token_url", Env: "EBAY_PRODUCTION_TOKEN_URL", Kind: config.URL},
+	config.Setting{Path: "proxy.ebay.maintenance.windows", Env: "EBAY_MAINTENANCE_WINDOWS", Kind: config.List},
+	config.Setting{Path: "proxy.ebay.maintenance.hold", Env: "EBAY_MAINTENANCE_HOLD", Kind: config.Duration},
+	config.Setting{Path: "proxy.ebay.maintenance.pattern", Env: "EBAY_MAINTENANCE_PATTERN"},
+	config.Setting{Path: "proxy.ebay.deletion.endpoint", Env: "EBAY_DELETION_ENDPOINT", Kind: config.URL},
+	config.Setting{Path: "proxy.ebay.deletion.verification_token", Env: "EBAY_DELETION_VERIFICATION_TOKEN", Secret: true},
+	config.Setting{Path: "proxy.ebay.webhooks.endpoint", Env: "EBAY_WEBHOOK_ENDPOINT", Kind: config.URL},
+	config.Setting{Path: "proxy.ebay.webhooks.verification_token", Env: "EBAY_WEBHOOK_VERIFICATION_TOKEN", Secret: true},
+	config.Setting{Path: "proxy.ebay.webhooks.forward_urls", Env: "WEBHOOK_FORWARD_URLS", Kind: config.List},
+
+	config.Setting{Path: "proxy.oauth.redirect_urls", Env: "APP_REDIRECT_URL", Kind: config.List, Required: true},
+	config.Setting{Path: "proxy.oauth.allowed_domains", Env: "APP_ALLOWED_DOMAINS", Kind: config.List},
+	config.Setting{Path: "proxy.oauth.redirect_allowlist", Env: "OAUTH_REDIRECT_ALLOWLIST", Kind: config.List},
+	config.Setting{Path: "proxy.oauth.clients", Env: "OAUTH_CLIENTS", Kind: config.List, Secret: true},
+	config.Setting{Path: "proxy.oauth.state_key", Env: "OAUTH_STATE_KEY", Secret: true},
+	config.Setting{Path: "proxy.oauth.state_ttl", Env: "OAUTH_STATE_TTL", Kind: config.Duration},
+
+	config.Setting{Path: "proxy.server.url", Env: "PROXY_URL", Kind: config.URL},
+	config.Setting{Path: "proxy.server.listen_addr", Env: "LISTEN_ADDR"},
+	config.Setting{Path: "proxy.server.tls_mode", Env: "TLS_MODE", Choices: []string{tlsModeFiles, tlsModeAutocert, tlsModeOff}},
+	config.Setting{Path: "proxy.server.ssl_certfile", Env: "SSL_CERTFILE"},
+	config.Setting{Path: "proxy.server.ssl_keyfile", Env: "SSL_KEYFILE"},
+	config.Setting{Path: "proxy.server.autocert.domains", Env: "AUTOCERT_DOMAINS", Kind: config.List},
+	config.Setting{Path: "proxy.server.autocert.email", Env: "AUTOCERT_EMAIL"},
+	config.Setting{Path: "proxy.server.autocert.cache_dir", Env: "AUTOCERT_CACHE_DIR"},
+	config.Setting{Path: "proxy.server.autocert.http_addr", Env: "AUTOCERT_HTTP_ADDR"},
+	config.Setting{Path: "proxy.server.shutdown_timeout", Env: "SHUTDOWN_TIMEOUT", Kind: config.Duration},
+	config.Setting{Path: "proxy.server.trust_forwarded_headers", Env: "TRUST_FORWARDED_HEADERS", Kind: config.Bool},
+	config.Setting{Path: "proxy.server.admin_token", Env: "PROXY_ADMIN_TOKEN", Secret: true},
+	config.Setting{Path: "proxy.server.max_request_body_size", Env: "MAX_REQUEST_BODY_SIZE", Kind: config.Int},
+	config.Setting{Path: "proxy.server.max_response_buffer_size", Env: "MAX_RESPONSE_BUFFER_SIZE", Kind: config.Int},
+	config.Setting{Path: "proxy.server.max_feed_upload_size", Env: "MAX_FEED_UPLOAD_SIZE", Kind: config.Int},
+	config.Setting{Path: "proxy.server.max_retries", Env: "PROXY_MAX_RETRIES", Kind: config.Int},
+	config.Setting{Path: "proxy.server.max_aggregate_pages", Env: "MAX_AGGREGATE_PAGES", Kind: config.Int},
+	config.Setting{Path: "proxy.server.slow_request_threshold", Env: "SLOW_REQUEST_THRESHOLD", Kind: config.Duration},
+	config.Setting{Path: "proxy.server.large_response_bytes", Env: "LARGE_RESPONSE_BYTES", Kind: config.Int},
+
+	config.Setting{Path: "proxy.policy_file", Env: "POLICY_FILE"},
+	config.Setting{Path: "proxy.reload_interval", Env: "CONFIG_RELOAD_INTERVAL", Kind: config.Duration},
+	config.Setting{Path: "proxy.backend_policy", Env: "BACKEND_POLICY"},
+	config.Setting{Path: "proxy.tenants_file", Env: "TENANTS_FILE"},
+	config.Setting{Path: "proxy.secret_names", Env: "SECRETS_NAMES", Kind: config.List},
+	config.Setting{Path: "proxy.minimize_buyer_pii", Env: "MINIMIZE_BUYER_PII", Kind: config.Bool},
+
+	config.Setting{Path: "proxy.backend.url", Env: "BACKEND_URL", Kind: config.URL},
+	config.Setting{Path: "proxy.backend.cache_ttl", Env: "BACKEND_CACHE_TTL", Kind: config.Duration},
+	config.Setting{Path: "proxy.backend.stale_ttl", Env: "BACKEND_STALE_TTL", Kind: config.Duration},
+
+	config.Setting{Path: "proxy.vault.file", Env: "VAULT_FILE"},
+	config.Setting{Path: "proxy.vault.key", Env: "VAULT_KEY", Secret: true},
+
+	config.Setting{Path: "proxy.audit.log_file", Env: "AUDIT_LOG_FILE"},
+	config.Setting{Path: "proxy.audit.proxy_calls", Env: "AUDIT_PROXY_CALLS", Kind: config.Bool},
+	config.Setting{Path: "proxy.notifications.file", Env: "NOTIFICATIONS_FILE"},
+	config.Setting{Path: "proxy.notifications.dedupe_file", Env: "NOTIFICATION_DEDUPE_FILE"},
+	config.Setting{Path: "proxy.notifications.dedupe_ttl", Env: "NOTIFICATION_DEDUPE_TTL", Kind: config.Duration},
+	config.Setting{Path: "proxy.archive.dir", Env: "ARCHIVE_DIR"},
+	config.Setting{Path: "proxy.archive.keep_months", Env: "ARCHIVE_KEEP_MONTHS", Kind: config.Int},
+
+	config.Setting{Path: "proxy.attachments.dir", Env: "ATTACHMENTS_DIR"},
+	config.Setting{Path: "proxy.attachments.signing_key", Env: "ATTACHMENT_SIGNING_KEY", Secret: true},
+	config.Setting{Path: "proxy.attachments.ttl", Env: "ATTACHMENT_TTL", Kind: config.Duration},
+	config.Setting{Path: "proxy.attachments.max_size", Env: "MAX_ATTACHMENT_SIZE", Kind: config.Int},
+
+	config.Setting{Path: "proxy.taxonomy.category_tree_dir", Env: "CATEGORY_TREE_DIR"},
+	config.Setting{Path: "proxy.taxonomy.check_interval", Env: "CATEGORY_TREE_CHECK_INTERVAL", Kind: config.Duration},
+
+	config.Setting{Path: "proxy.validation.schema_dir", Env: "REQUEST_SCHEMA_DIR"},
+
+	config.Setting{Path: "proxy.capture.dir", Env: "CAPTURE_DIR"},
+	config.Setting{Path: "proxy.capture.retention", Env: "CAPTURE_RETENTION", Kind: config.Duration},
+
+	config.Setting{Path: "proxy.feature_flags.overrides", Env: "FEATURE_FLAGS", Kind: config.List},
+	config.Setting{Path: "proxy.feature_flags.url", Env: "FEATURE_FLAGS_URL", Kind: config.URL},
+	config.Setting{Path: "proxy.feature_flags.token", Env: "FEATURE_FLAGS_TOKEN", Secret: true},
+	config.Setting{Path: "proxy.feature_flags.cache_ttl", Env: "FEATURE_FLAGS_CACHE_TTL", Kind: config.Duration},
+
+	config.Setting{Path: "proxy.mcp.api_key", Env: "PROXY_API_KEY", Secret: true},
+	config.Setting{Path: "proxy.mcp.tool_profile", Env: "TOOL_PROFILE"},
+	config.Setting{Path: "proxy.mcp.task_timeout", Env: "MCP_TASK_TIMEOUT", Kind: config.Duration},
+	config.Setting{Path: "proxy.mcp.resource_poll_interval", Env: "MCP_RESOURCE_POLL_INTERVAL", Kind: config.Duration},
+	config.Setting{Path: "proxy.mcp.result_page_size", Env: "MCP_RESULT_PAGE_SIZE", Kind: config.Int},
+	config.Setting{Path: "proxy.mcp.result_ttl", Env: "MCP_RESULT_TTL", Kind: config.Duration},
+	config.Setting{Path: "proxy.mcp.authorization_server", Env: "MCP_AUTHORIZATION_SERVER", Kind: config.URL},
+	config.Setting{Path: "proxy.mcp.session_ttl", Env: "MCP_SESSION_TTL", Kind: config.Duration},
+	config.Setting{Path: "proxy.mcp.max_sessions", Env: "MCP_MAX_SESSIONS", Kind: config.Int},
+	config.Setting{Path: "proxy.mcp.max_total_sessions", Env: "MCP_MAX_TOTAL_SESSIONS", Kind: config.Int},
+	config.Setting{Path: "proxy.mcp.allowed_origins", Env: "MCP_ALLOWED_ORIGINS", Kind: config.List},
+	config.Setting{Path: "proxy.push.buffer_size", Env: "PUSH_BUFFER_SIZE", Kind: config.Int},
+	config.Setting{Path: "proxy.push.overflow_policy", Env: "PUSH_OVERFLOW_POLICY", Choices: []string{string(overflowDropOldest), string(overflowDropNewest), string(overflowDisconnect)}},
+	config.Setting{Path: "proxy.push.write_timeout", Env: "PUSH_WRITE_TIMEOUT", Kind: config.Duration},
+
+	config.Setting{Path: "proxy.usage.export_epsilon", Env: "USAGE_EXPORT_EPSILON", Kind: config.Float},
+	config.Setting{Path: "proxy.usage.export_max_calls", Env: "USAGE_EXPORT_MAX_CALLS", Kind: config.Int},
+	config.Setting{Path: "proxy.usage.export_min_callers", Env: "USAGE_EXPORT_MIN_CALLERS", Kind: config.Int},
+	config.Setting{Path: "proxy.usage.retention_days", Env: "USAGE_RETENTION_DAYS", Kind: config.Int},
+
+	config.Setting{Path: "proxy.warehouse.url", Env: "WAREHOUSE_URL"},
+	config.Setting{Path: "proxy.warehouse.credentials_file", Env: "WAREHOUSE_CREDENTIALS_FILE"},
+	config.Setting{Path: "proxy.warehouse.instance", Env: "WAREHOUSE_INSTANCE"},
+	config.Setting{Path: "proxy.warehouse.interval", Env: "WAREHOUSE_INTERVAL", Kind: config.Duration},
+	config.Setting{Path: "proxy.warehouse.sales_accounts", Env: "WAREHOUSE_SALES_ACCOUNTS", Kind: config.List},
+	config.Setting{Path: "proxy.warehouse.table_prefix", Env: "WAREHOUSE_TABLE_PREFIX"},
+
+	config.Setting{Path: "proxy.plugin.service_name", Env: "SERVICE_NAME"},
+	config.Setting{Path: "proxy.plugin.logo_url", Env: "SERVICE_LOGO_URL", Kind: config.URL},
+	config.Setting{Path: "proxy.plugin.openapi_url", Env: "PLUGIN_OPENAPI_URL", Kind: config.URL},
+	config.Setting{Path: "proxy.plugin.verification_token", Env: "PLUGIN_VERIFICATION_TOKEN", Secret: true},
+	config.Setting{Path: "proxy.legal.operator_name", Env: "LEGAL_OPERATOR_NAME"},
+	config.Setting{Path: "proxy.legal.contact_email", Env: "LEGAL_CONTACT_EMAIL"},
+	config.Setting{Path: "proxy.legal.jurisdiction", Env: "LEGAL_JURISDICTION"},
+	config.Setting{Path: "proxy.legal.effective_date", Env: "LEGAL_EFFECTIVE_DATE"},
+	config.Setting{Path: "proxy.legal.template_dir", Env: "LEGAL_TEMPLATE_DIR"},
+)
+
+// loadedConfigFile is the CONFIG_FILE already loaded, so the binary and New
+// don't load it twice.
+var loadedConfigFile string
+
+// loadConfigFile sets the environment variables of CONFIG_FILE, if any.
+func loadConfigFile() error {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" || path == loadedConfigFile {
+		return nil
+	}
+	n, err := proxySettings.Load(path)
+	if err != nil {
+		return err
+	}
+	loadedConfigFile = path
+	log.Printf("Loaded %d settings from %s", n, path)
+	return nil
+}
+
+// runConfigCheck validates the configuration file (file, or CONFIG_FILE)
+// and the environment as the server would read them, the TLS settings and
+// the policy, and reports every problem found.
+// ebay-mcp config check [file]
+func runConfigCheck(args []string) error {
+	if len(args) > 0 {
+		n, err := proxySettings.Load(args[0])
+		if err != nil {
+			return err
+		}
+		log.Printf("Loaded %d settings from %s", n, args[0])
+	}
+	if err := proxySettings.Public().Validate(); err != nil {
+		return err
+	}
+	if _, _, err := loadSecretsFromEnv(); err != nil {
+		return err
+	}
+	if err := proxySettings.Validate(); err != nil {
+		return err
+	}
+	if _, err := tlsModeFromEnv(); err != nil {
+		return err
+	}
+	if os.Getenv("BACKEND_POLICY") == "" {
+		if _, err := loadPolicy(os.Getenv("POLICY_FILE")); err != nil {
+			return fmt.Errorf("policy: %w", err)
+		}
+	}
+	fmt.Println("Configuration OK")
+	return nil
+}
@@ -0,0 +1,163 @@
+package ebaymcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ### Notification Replay Protection #########################################
+
+// eBay redelivers a notification until it gets a 2xx, and may deliver the
+// same one more than once. Every notification is processed at most once per
+// notificationId: IDs are claimed while a delivery is handled, remembered
+// once it succeeded, and released on failure so eBay's redelivery is
+// processed. Remembered IDs are appended to NOTIFICATION_DEDUPE_FILE (JSON
+// lines) so duplicates are also caught across restarts, and forgotten after
+// NOTIFICATION_DEDUPE_TTL.
+
+const defaultNotificationDedupeTTL = 72 * time.Hour
+
+// seenNotification is one line of the dedupe file.
+type seenNotification struct {
+	ID     string    `json:"id"`
+	SeenAt time.Time `json:"seen_at"`
+}
+
+// notificationDedupe tracks processed and in-flight notification IDs.
+type notificationDedupe struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	file      *os.File
+	seen      map[string]time.Time
+	inFlight  map[string]bool
+	lastPrune time.Time
+}
+
+// seenNotifications is shared by every notification endpoint.
+var seenNotifications = newNotificationDedupe(defaultNotificationDedupeTTL)
+
+func newNotificationDedupe(ttl time.Duration) *notificationDedupe {
+	return &notificationDedupe{
+		ttl:      ttl,
+		seen:     make(map[string]time.Time),
+		inFlight: make(map[string]bool),
+	}
+}
+
+// openNotificationDedupe loads path, dropping expired IDs, and keeps it open
+// for appending. An empty path keeps IDs in memory only.
+func openNotificationDedupe(path string, ttl time.Duration) (*notificationDedupe, error) {
+	d := newNotificationDedupe(ttl)
+	if path == "" {
+		return d, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read notification dedupe file: %w", err)
+	}
+	now := time.Now()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var s seenNotification
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			log.Printf("Skipping corrupt line in %s: %v", path, err)
+			continue
+		}
+		if now.Sub(s.SeenAt) < ttl {
+			d.seen[s.ID] = s.SeenAt
+		}
+	}
+
+	// Compact the file to the IDs still within the TTL
+	var compacted bytes.Buffer
+	for id, at := range d.seen {
+		line, _ := json.Marshal(seenNotification{ID: id, SeenAt: at})
+		compacted.Write(append(line, '\n'))
+	}
+	if err := writeFileAtomic(path, compacted.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to compact notification dedupe file: %w", err)
+	}
+
+	if d.file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// notificationDedupeTTLFromEnv reads NOTIFICATION_DEDUPE_TTL (a Go duration).
+func notificationDedupeTTLFromEnv() (time.Duration, error) {
+	if v := os.Getenv("NOTIFICATION_DEDUPE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return 0, fmt.Errorf("invalid NOTIFICATION_DEDUPE_TTL %q", v)
+		}
+		return ttl, nil
+	}
+	return defaultNotificationDedupeTTL, nil
+}
+
+// Begin claims id for processing. It returns false when the notification was
+// already processed or is being processed by a concurrent delivery. An empty
+// id can't be deduplicated and is always claimed.
+func (d *notificationDedupe) Begin(id string, now time.Time) bool {
+	if id == "" {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if at, ok := d.seen[id]; ok {
+		if now.Sub(at) < d.ttl {
+			return false
+		}
+		delete(d.seen, id)
+	}
+	if d.inFlight[id] {
+		return false
+	}
+	d.inFlight[id] = true
+	return true
+}
+
+// Finish releases a claim. When processing succeeded the ID is remembered,
+// so later redeliveries are ignored; otherwise the next delivery is handled.
+func (d *notificationDedupe) Finish(id string, succeeded bool, now time.Time) error {
+	if id == "" {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.inFlight, id)
+	if !succeeded {
+		return nil
+	}
+	d.seen[id] = now
+	if now.Sub(d.lastPrune) > time.Hour {
+		for seenID, at := range d.seen {
+			if now.Sub(at) >= d.ttl {
+				delete(d.seen, seenID)
+			}
+		}
+		d.lastPrune = now
+	}
+	if d.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(seenNotification{ID: id, SeenAt: now})
+	if err != nil {
+		return err
+	}
+	if _, err := d.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to persist notification ID: %w", err)
+	}
+	return nil
+}
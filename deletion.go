@@ -0,0 +1,125 @@
+package ebaymcp
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ### Account Deletion ######################################################
+
+// eBay requires production apps to subscribe to marketplace account deletion
+// notifications. Register EBAY_DELETION_ENDPOINT (this handler's public URL)
+// and EBAY_DELETION_VERIFICATION_TOKEN in the developer portal.
+
+// accountDeletionPath is where eBay sends deletion notifications.
+const accountDeletionPath = "/notifications/account-deletion"
+
+// accountDeletionTopic is the only topic this endpoint accepts.
+const accountDeletionTopic = "MARKETPLACE_ACCOUNT_DELETION"
+
+// accountDeletionBodyLimit caps notification bodies, which are a few
+// hundred bytes, well below the proxy-wide request limit.
+const accountDeletionBodyLimit = 64 << 10
+
+// accountDeletionNotification is the MARKETPLACE_ACCOUNT_DELETION payload.
+type accountDeletionNotification struct {
+	Metadata struct {
+		Topic string `json:"topic"`
+	} `json:"metadata"`
+	Notification struct {
+		NotificationID string `json:"notificationId"`
+		EventDate      string `json:"eventDate"`
+		Data           struct {
+			Username  string `json:"username"`
+			UserID    string `json:"userId"`
+			EIASToken string `json:"eiasToken"`
+		} `json:"data"`
+	} `json:"notification"`
+}
+
+// handleAccountDeletion answers eBay's challenge (GET ?challenge_code=...)
+// and processes signed deletion notifications (POST).
+func handleAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	verificationToken := os.Getenv("EBAY_DELETION_VERIFICATION_TOKEN")
+	if verificationToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		answerChallenge(w, r, verificationToken, envOr("EBAY_DELETION_ENDPOINT", externalBaseURL(r)+accountDeletionPath))
+
+	case "POST":
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, accountDeletionBodyLimit))
+		if isBodyTooLarge(err) {
+			writeBodyTooLarge(w, accountDeletionBodyLimit)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		// eBay expects 412 when the signature can't be verified
+		if err := verifyNotification(r.Context(), r.Header.Get(notificationSignatureHeader), body); err != nil {
+			log.Printf("Rejected account deletion notification: %v", err)
+			http.Error(w, "Signature verification failed", http.StatusPreconditionFailed)
+			return
+		}
+
+		var n accountDeletionNotification
+		if err := json.Unmarshal(body, &n); err != nil {
+			http.Error(w, "Invalid notification body", http.StatusBadRequest)
+			return
+		}
+		// A signed notification for another topic must not delete anything
+		if n.Metadata.Topic != accountDeletionTopic {
+			log.Printf("Rejected notification with topic %q on the account deletion endpoint", n.Metadata.Topic)
+			http.Error(w, "Unexpected notification topic", http.StatusBadRequest)
+			return
+		}
+
+		// Acknowledge redeliveries without processing them again
+		id := n.Notification.NotificationID
+		if !seenNotifications.Begin(id, time.Now()) {
+			log.Printf("Ignoring duplicate account deletion notification %s", id)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		deleted, unlinked := 0, 0
+		if vault != nil {
+			deleted, err = vault.DeleteUser(n.Notification.Data.UserID, n.Notification.Data.Username)
+		}
+		if backend != nil && err == nil {
+			unlinked, err = backend.DeleteEbayUser(r.Context(), n.Notification.Data.UserID, n.Notification.Data.Username)
+		}
+		if ferr := seenNotifications.Finish(id, err == nil, time.Now()); ferr != nil {
+			log.Printf("%v", ferr)
+		}
+		if err != nil {
+			// A 5xx makes eBay redeliver, which is what we want
+			log.Printf("Failed to delete linked accounts: %v", err)
+			http.Error(w, "Failed to delete user data", http.StatusInternalServerError)
+			return
+		}
+
+		audit.Record("ebay.account_deleted", map[string]string{
+			"notification_id": n.Notification.NotificationID,
+			"event_date":      n.Notification.EventDate,
+			"ebay_user_id":    n.Notification.Data.UserID,
+			"vault_entries":   strconv.Itoa(deleted),
+			"backend_links":   strconv.Itoa(unlinked),
+		})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,179 @@
+package ebaymcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/ebay"
+)
+
+// ### eBay API Client ########################################################
+
+// Calls the proxy makes to eBay itself, rather than forwards, go through the
+// typed client of internal/ebay, over ebayTransport so that they honour
+// eBay's maintenance windows like proxied calls do.
+
+// ebayClientTimeout bounds each call of the typed client.
+const ebayClientTimeout = 30 * time.Second
+
+// ebayClient returns a client calling env's API host as token for
+// marketplace, in its language as setMarketplaceHeaders does.
+func ebayClient(env *ebayEnvironment, token, marketplace string) *ebay.Client {
+	return &ebay.Client{
+		Host:        env.APIHost,
+		Token:       token,
+		Marketplace: marketplace,
+		Language:    marketplaceLanguages[marketplace],
+		HTTPClient:  &http.Client{Timeout: ebayClientTimeout, Transport: ebayTransport},
+	}
+}
+
+// getEbayJSON GETs path from the environment's API host and decodes the
+// JSON response into out, for the APIs the typed client has no methods for.
+func getEbayJSON(ctx context.Context, env *ebayEnvironment, token, marketplace, path string, query url.Values, out interface{}) error {
+	return ebayClient(env, token, marketplace).Get(ctx, path, query, out)
+}
+
+// ebayCaller is the eBay account a request to one of the proxy's own tools
+// acts as.
+type ebayCaller struct {
+	env         *ebayEnvironment
+	bearer      string // token as the client sent it, e.g. a vault reference
+	token       string // eBay access token
+	marketplace string
+	language    string    // preferred language of a linked account, if any
+	user        *ebayUser // linked account, if known
+	// scopes are the scope sets that must each cover a call, as /proxy
+	// checks them: what eBay granted the account or /token issued, and a
+	// backend token's own scopes. Empty when neither is known.
+	scopes [][]string
+}
+
+// client returns a client calling eBay as c.
+func (c *ebayCaller) client() *ebay.Client {
+	client := ebayClient(c.env, c.token, c.marketplace)
+	if len(c.scopes) > 0 {
+		client.HTTPClient.Transport = &scopedTransport{base: ebayTransport, scopes: c.scopes}
+	}
+	return client
+}
+
+// allow checks c's scopes for calls that don't go through client.
+func (c *ebayCaller) allow(method, path string) error {
+	required := currentPolicy().RequiredScopes(method, path)
+	for _, granted := range c.scopes {
+		if checkScopes(granted, required) != nil {
+			return &scopeError{method: method, path: path, required: required}
+		}
+	}
+	return nil
+}
+
+// wrote lets the caller read their own writes, as /proxy does: it drops the
+// responses cached for them.
+func (c *ebayCaller) wrote(ctx context.Context) {
+	responseCache.Invalidate(context.WithoutCancel(ctx), tokenHash(c.bearer))
+}
+
+// resolveCaller finds the eBay account of the request's bearer token as
+// /proxy does: vault references and backend tokens stand for the linked
+// account. Like /proxy it takes the request from the policy's rate limits,
+// writing the X-RateLimit-* headers to w, refuses tokens /token issued for
+// another tenant, and limits the caller to the scopes its token was
+// granted. It returns the status to answer with when that fails.
+func resolveCaller(w http.ResponseWriter, r *http.Request) (*ebayCaller, int, error) {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return nil, http.StatusUnauthorized, errors.New("Invalid Authorization header: must be 'Bearer {token}'")
+	}
+	accessToken := parts[1]
+	env, err := environmentFor(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if state := takeRateLimit(r.Context(), accessToken); state != nil {
+		setRateLimitHeaders(w.Header(), *state)
+		if !state.Allowed {
+			return nil, http.StatusTooManyRequests, errors.New(localizerFor(r, "", "").T("ratelimit.exceeded"))
+		}
+	}
+
+	var entry *vaultEntry
+	var identity *backendToken
+	var grantedScopes []string
+	if isVaultReference(accessToken) {
+		accessToken, entry, err = vaultAccessToken(r.Context(), accessToken)
+	} else if backend != nil && !isEbayToken(accessToken) {
+		accessToken, entry, identity, err = backend.AccessToken(r.Context(), accessToken, env.Name)
+	} else {
+		grantedScopes, err = issuedTokenScopes(r.Context(), env, accessToken)
+	}
+	if err == nil && entry != nil && !tenantFor(r).has(entry.environment()) {
+		err = errOtherTenant
+	}
+	if err != nil {
+		if errors.Is(err, errBackendUnavailable) {
+			return nil, http.StatusServiceUnavailable, err
+		}
+		return nil, http.StatusUnauthorized, err
+	}
+
+	caller := &ebayCaller{env: env, bearer: parts[1], token: accessToken}
+	preferredMarketplace := ""
+	if entry != nil {
+		caller.env = entry.environment()
+		caller.language = entry.Language
+		caller.user = entry.ebayUser()
+		preferredMarketplace = entry.Marketplace
+		grantedScopes = entry.Scopes
+	}
+	if grantedScopes != nil {
+		caller.scopes = append(caller.scopes, grantedScopes)
+	}
+	if identity != nil {
+		caller.scopes = append(caller.scopes, backendScopes(identity))
+	}
+	if caller.marketplace, err = marketplaceFor(r, preferredMarketplace); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return caller, http.StatusOK, nil
+}
+
+// writeEbayError answers a failed call to eBay: calls the token has no scope
+// for and maintenance windows as /proxy does, eBay's own errors with their status and hints, and anything
+// else as 502.
+func writeEbayError(w http.ResponseWriter, r *http.Request, caller *ebayCaller, err error) {
+	var se *scopeError
+	if errors.As(err, &se) {
+		writeInsufficientScope(w, localizerFor(r, caller.language, caller.marketplace), se.method, se.path, se.required)
+		return
+	}
+	var me *maintenanceError
+	if errors.As(err, &me) {
+		writeMaintenance(w, me)
+		return
+	}
+	var apiErr *ebay.Error
+	if errors.As(err, &apiErr) && len(apiErr.Errors) > 0 {
+		writeJSON(w, apiErr.StatusCode, ebayErrorBody(apiErr, localizerFor(r, caller.language, caller.marketplace)))
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
+
+// ebayErrorBody returns eBay's error document of apiErr with hints, for
+// responses that add to it.
+func ebayErrorBody(apiErr *ebay.Error, loc localizer) map[string]interface{} {
+	body, _ := json.Marshal(map[string]interface{}{"errors": apiErr.Errors})
+	if hinted, ok := hintErrors(body, apiErr.StatusCode, loc); ok {
+		body = hinted
+	}
+	var doc map[string]interface{}
+	json.Unmarshal(body, &doc)
+	return doc
+}
@@ -0,0 +1,195 @@
+package ebaymcp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ### Embedding ##############################################################
+
+// The proxy can run inside another Go service instead of as the standalone
+// binary: New returns its routes as an http.Handler for the host's own mux,
+// listener and TLS termination. Configuration is the same environment the
+// binary reads (Options.Env can supply it), and is process-wide, so a
+// process runs one Server at a time.
+//
+//	srv, err := ebaymcp.New(ebaymcp.Options{PathPrefix: "/ebay"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer srv.Close(context.Background())
+//	mux.Handle("/ebay/", srv)
+
+// Options adjust New. The zero value behaves like the standalone binary.
+type Options struct {
+	// Env is set in the process environment before the configuration is
+	// read, e.g. {"EBAY_CLIENT_ID": ..., "POLICY_FILE": ...}.
+	Env map[string]string
+
+	// PathPrefix mounts the routes under a path, e.g. "/ebay" serves
+	// /ebay/authorize and /ebay/proxy/...; APP_REDIRECT_URL must then end
+	// in /ebay/callback.
+	PathPrefix string
+
+	// NoBackgroundJobs skips the Best Offer engine, unsold listing triage,
+	// warehouse export, secret refresh and usage reports to the backend.
+	NoBackgroundJobs bool
+}
+
+// Server is the proxy: its routes, the eBay proxy and the MCP tools.
+type Server struct {
+	handler     http.Handler
+	prefix      string
+	stop        context.CancelFunc
+	mcpSettings mcpSettings
+}
+
+// mountPrefix is Options.PathPrefix of the running Server, part of every
+// external URL.
+var mountPrefix string
+
+// running is the Server New returned until it is closed.
+var running struct {
+	sync.Mutex
+	server *Server
+}
+
+// New reads the configuration, starts the background jobs and returns the
+// routes. It fails if another Server is running.
+func New(opts Options) (*Server, error) {
+	running.Lock()
+	defer running.Unlock()
+	if running.server != nil {
+		return nil, errors.New("ebaymcp: a Server is already running in this process")
+	}
+
+	prefix := opts.PathPrefix
+	if prefix != "" && (!strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/")) {
+		return nil, fmt.Errorf("ebaymcp: PathPrefix %q must start and not end with /", prefix)
+	}
+	for name, value := range opts.Env {
+		if err := os.Setenv(name, value); err != nil {
+			return nil, err
+		}
+	}
+	mountPrefix = prefix
+	if err := loadConfigFile(); err != nil {
+		return nil, err
+	}
+	if err := proxySettings.Public().Validate(); err != nil {
+		return nil, err
+	}
+
+	// Secrets from SECRETS_BACKEND land in the environment before anything
+	// reads it
+	secretsProvider, loadedSecrets, err := loadSecretsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if err := proxySettings.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	handler, err := configure(ctx, opts, secretsProvider, loadedSecrets)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	settings, err := mcpSettingsFromEnv()
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	running.server = &Server{handler: handler, prefix: prefix, stop: stop, mcpSettings: settings}
+	return running.server, nil
+}
+
+// ServeHTTP serves the routes, under PathPrefix if set.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.prefix != "" {
+		rest, ok := strings.CutPrefix(r.URL.Path, s.prefix)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			http.NotFound(w, r)
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = "/" + strings.TrimPrefix(rest, "/")
+		r2.URL.RawPath = ""
+		r = r2
+	}
+	s.handler.ServeHTTP(w, r)
+}
+
+// ServeMCP runs an MCP session on in and out, like `ebay-mcp mcp`, with
+// the tools calling s in-process as apiKey (an access token or vault: key).
+// Links in tool results use PROXY_URL, which should include PathPrefix.
+func (s *Server) ServeMCP(ctx context.Context, apiKey string, in io.Reader, out io.Writer) error {
+	baseURL := strings.TrimRight(envOr("PROXY_URL", "http://localhost"+s.prefix), "/")
+	client := &http.Client{Transport: handlerTransport{s}, Timeout: 2 * time.Minute}
+	session, err := newMCPServer(ctx, currentPolicy(), s.mcpSettings, apiKey, baseURL, client, out)
+	if err != nil {
+		return err
+	}
+	return session.serve(ctx, in)
+}
+
+// Reload re-reads CONFIG_FILE, the policy and the redirect allowlist and
+// applies them to the requests that follow, like SIGHUP does for the
+// binary. On error the running configuration stays in effect.
+func (s *Server) Reload(ctx context.Context) error {
+	return logReload(ctx, "Server.Reload")
+}
+
+// Close stops the background jobs and reports the calls counted since the
+// last report to the backend. In-flight requests are the caller's to drain.
+func (s *Server) Close(ctx context.Context) error {
+	running.Lock()
+	defer running.Unlock()
+	if running.server != s {
+		return nil
+	}
+	running.server = nil
+	s.stop()
+	if backend != nil {
+		if err := backend.FlushUsage(ctx); err != nil {
+			return fmt.Errorf("failed to report usage to the backend: %w", err)
+		}
+	}
+	return nil
+}
+
+// handlerTransport answers requests by calling a handler directly.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.RequestURI = req.URL.RequestURI()
+	r.RemoteAddr = "127.0.0.1:0"
+	if req.URL.Scheme == "https" {
+		r.TLS = &tls.ConnectionState{}
+	}
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, r)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
@@ -0,0 +1,194 @@
+package ebaymcp
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// ### eBay Environments ######################################################
+
+// Names of the eBay environments.
+const (
+	envProduction = "production"
+	envSandbox    = "sandbox"
+)
+
+// envSelectorParam and envSelectorHeader let a request pick an environment,
+// e.g. /proxy/buy/browse/v1/item_summary/search?q=x&ebay_env=sandbox. The
+// query parameter is stripped before the request is forwarded to eBay.
+const (
+	envSelectorParam  = "ebay_env"
+	envSelectorHeader = "X-Ebay-Environment"
+)
+
+// ebayEnvironment is everything needed to talk to one eBay environment.
+// Sandbox and production use different keysets as well as different hosts.
+type ebayEnvironment struct {
+	Name     string
+	Tenant   string // "" for the default tenant
+	ClientID string
+	APIHost  string
+	// OAuth builds authorize URLs; token requests go through
+	// postTokenRequest with clientSecret, which may rotate.
+	OAuth *oauth2.Config
+
+	mu     sync.RWMutex
+	secret string
+}
+
+// clientSecret returns the environment's current client secret.
+func (e *ebayEnvironment) clientSecret() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.secret
+}
+
+// setClientSecret replaces the client secret, e.g. after a rotation.
+func (e *ebayEnvironment) setClientSecret(secret string) {
+	e.mu.Lock()
+	e.secret = secret
+	e.mu.Unlock()
+}
+
+// secretName is the variable holding the environment's client secret:
+// EBAY_CLIENT_SECRET for the default keyset, EBAY_SANDBOX_CLIENT_SECRET or
+// EBAY_PRODUCTION_CLIENT_SECRET for the other, and
+// EBAY_<TENANT>_<ENVIRONMENT>_CLIENT_SECRET for other tenants.
+func (e *ebayEnvironment) secretName() string {
+	if e.Tenant != "" {
+		return "EBAY_" + strings.ToUpper(strings.ReplaceAll(e.Tenant, "-", "_")+"_"+e.Name) + "_CLIENT_SECRET"
+	}
+	if e.Name == defaultEnvironment {
+		return "EBAY_CLIENT_SECRET"
+	}
+	return "EBAY_" + strings.ToUpper(e.Name) + "_CLIENT_SECRET"
+}
+
+// key identifies the environment across tenants, for what is stored per
+// application: its name in the default tenant, "<tenant>/<name>" otherwise.
+func (e *ebayEnvironment) key() string {
+	if e.Tenant == "" {
+		return e.Name
+	}
+	return e.Tenant + "/" + e.Name
+}
+
+// defaultEndpoints are the well-known hosts of each environment, used when a
+// secondary environment is configured with credentials only.
+var defaultEndpoints = map[string]struct{ APIHost, AuthURL, TokenURL string }{
+	envProduction: {"api.ebay.com", "https://auth.ebay.com/oauth2/authorize", "https://api.ebay.com/identity/v1/oauth2/token"},
+	envSandbox:    {"api.sandbox.ebay.com", "https://auth.sandbox.ebay.com/oauth2/authorize", "https://api.sandbox.ebay.com/identity/v1/oauth2/token"},
+}
+
+// environments holds the configured eBay environments keyed by name, and
+// defaultEnvironment names the one used when a request doesn't choose.
+var (
+	environments       = make(map[string]*ebayEnvironment)
+	defaultEnvironment string
+)
+
+// newEnvironment builds an environment from explicit settings.
+func newEnvironment(name, clientID, clientSecret, scopes, apiHost, authURL, tokenURL string) *ebayEnvironment {
+	return &ebayEnvironment{
+		Name:     name,
+		ClientID: clientID,
+		APIHost:  apiHost,
+		secret:   clientSecret,
+		OAuth: &oauth2.Config{
+			ClientID:    clientID,
+			RedirectURL: appRedirectURLs[0].String(), // This is YOUR /callback endpoint (default domain)
+			Scopes:      strings.Split(scopes, " "),
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  authURL,
+				TokenURL: tokenURL,
+			},
+		},
+	}
+}
+
+// environmentNameForHost guesses the environment of the primary EBAY_* keyset
+// from its API host.
+func environmentNameForHost(apiHost string) string {
+	if strings.Contains(apiHost, "sandbox") {
+		return envSandbox
+	}
+	return envProduction
+}
+
+// loadSecondaryEnvironment loads the other environment's profile, if one is
+// configured. When the primary keyset is production this reads
+// EBAY_SANDBOX_CLIENT_ID, EBAY_SANDBOX_CLIENT_SECRET and optionally
+// EBAY_SANDBOX_SCOPES / _API_HOST / _AUTH_URL / _TOKEN_URL (and vice versa
+// with EBAY_PRODUCTION_*). Unset hosts default to eBay's well-known ones.
+func loadSecondaryEnvironment(primary, primaryScopes string) *ebayEnvironment {
+	name := envSandbox
+	if primary == envSandbox {
+		name = envProduction
+	}
+	prefix := "EBAY_" + strings.ToUpper(name) + "_"
+
+	clientID := os.Getenv(prefix + "CLIENT_ID")
+	clientSecret := os.Getenv(prefix + "CLIENT_SECRET")
+	if clientID == "" || clientSecret == "" {
+		return nil
+	}
+
+	defaults := defaultEndpoints[name]
+	return newEnvironment(name, clientID, clientSecret,
+		envOr(prefix+"SCOPES", primaryScopes),
+		envOr(prefix+"API_HOST", defaults.APIHost),
+		envOr(prefix+"AUTH_URL", defaults.AuthURL),
+		envOr(prefix+"TOKEN_URL", defaults.TokenURL))
+}
+
+// environmentFor returns the environment of the request's tenant selected
+// via the ebay_env query parameter or X-Ebay-Environment header, or the
+// tenant's default.
+func environmentFor(r *http.Request) (*ebayEnvironment, error) {
+	t := tenantFor(r)
+	name := r.URL.Query().Get(envSelectorParam)
+	if name == "" {
+		name = r.Header.Get(envSelectorHeader)
+	}
+	if name == "" {
+		return t.Environments[t.DefaultEnvironment], nil
+	}
+
+	env, ok := t.Environments[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown or unconfigured eBay environment %q (available: %s)",
+			name, strings.Join(t.environmentNames(), ", "))
+	}
+	return env, nil
+}
+
+// defaultEnvironmentFor returns the default environment of the request's
+// tenant.
+func defaultEnvironmentFor(r *http.Request) *ebayEnvironment {
+	t := tenantFor(r)
+	return t.Environments[t.DefaultEnvironment]
+}
+
+// environmentNames lists the configured environments.
+func environmentNames() []string {
+	names := make([]string, 0, len(environments))
+	for name := range environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// envOr returns the environment variable key, or fallback when it is unset.
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
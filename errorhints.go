@@ -0,0 +1,184 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ayouroukov/ebay-mcp/internal/ebay"
+)
+
+// ### eBay Error Hints #######################################################
+
+// eBay answers failed calls with {"errors": [{errorId, domain, message,
+// longMessage, parameters}]}, which assistants often misread: "Invalid
+// Return policy" doesn't say that the seller has none and should create one
+// first. The proxy adds a hint to each error it recognizes, by errorId or
+// else by status, leaving eBay's fields as they are:
+//
+//	{"errors": [{"errorId": 25009, "message": "Invalid Return policy.", ...,
+//	  "hint": {"code": "missing_return_policy", "operation": "createReturnPolicy",
+//	           "message": "The offer has no valid return policy. ..."}}],
+//	 "summary": "The offer has no valid return policy. ..."}
+//
+// code is stable for programs to branch on; message is localized like the
+// proxy's other messages; operation names the eBay operation (the tool) that
+// resolves the error, if there is one; retryable says the same call may
+// succeed later.
+
+// errorHint is the hint added to one eBay error.
+type errorHint struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Operation string `json:"operation,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+}
+
+// errorHintRule describes the hint of one error: its code, message key and
+// the operation resolving it.
+type errorHintRule struct {
+	code, key, operation string
+	retryable            bool
+}
+
+// errorHintsByID are the hints of eBay errorIds. The IDs are those of the
+// common OAuth errors and of the Inventory API's listing errors, which
+// assistants run into the most.
+var errorHintsByID = map[int]errorHintRule{
+	1001:  {code: "invalid_token", key: "hint.invalid_token"},
+	1002:  {code: "invalid_token", key: "hint.invalid_token"},
+	1100:  {code: "missing_scope", key: "hint.missing_scope", operation: "get_connection_status"},
+	2001:  {code: "rate_limited", key: "hint.rate_limited", operation: "get_connection_status", retryable: true},
+	25001: {code: "ebay_system_error", key: "hint.system_error", retryable: true},
+	25005: {code: "invalid_category", key: "hint.invalid_category", operation: "get_category_suggestions"},
+	25007: {code: "missing_fulfillment_policy", key: "hint.fulfillment_policy", operation: "createFulfillmentPolicy"},
+	25008: {code: "missing_payment_policy", key: "hint.payment_policy", operation: "createPaymentPolicy"},
+	25009: {code: "missing_return_policy", key: "hint.return_policy", operation: "createReturnPolicy"},
+	25013: {code: "missing_inventory_location", key: "hint.inventory_location", operation: "createInventoryLocation"},
+	25017: {code: "missing_field", key: "hint.missing_field"},
+	25018: {code: "incomplete_seller_account", key: "hint.incomplete_account", operation: "getPrivileges"},
+	25021: {code: "invalid_condition", key: "hint.invalid_condition", operation: "getItemConditionPolicies"},
+	25026: {code: "selling_limit_reached", key: "hint.selling_limit", operation: "getPrivileges"},
+	25702: {code: "unknown_sku", key: "hint.unknown_sku", operation: "createOrReplaceInventoryItem"},
+	25710: {code: "not_found", key: "hint.not_found"},
+}
+
+// errorHintForStatus is the hint of errors with an unknown errorId.
+func errorHintForStatus(status int) (errorHintRule, bool) {
+	switch {
+	case status == http.StatusUnauthorized:
+		return errorHintsByID[1001], true
+	case status == http.StatusForbidden:
+		return errorHintsByID[1100], true
+	case status == http.StatusTooManyRequests:
+		return errorHintsByID[2001], true
+	case status >= 500:
+		return errorHintsByID[25001], true
+	}
+	return errorHintRule{}, false
+}
+
+// hintFor returns the hint of one error of a response with status.
+func hintFor(loc localizer, status int, e ebay.ErrorDetail) (*errorHint, bool) {
+	rule, ok := errorHintsByID[e.ErrorID]
+	if !ok {
+		if rule, ok = errorHintForStatus(status); !ok {
+			return nil, false
+		}
+	}
+	var message string
+	switch rule.code {
+	case "missing_field":
+		field := errorParameter(e, "fieldName")
+		if field == "" {
+			field = e.Message
+		}
+		message = loc.T(rule.key, field)
+	default:
+		message = loc.T(rule.key)
+	}
+	return &errorHint{Code: rule.code, Message: message, Operation: rule.operation, Retryable: rule.retryable}, true
+}
+
+// errorParameter returns the value of e's parameter name.
+func errorParameter(e ebay.ErrorDetail, name string) string {
+	for _, p := range e.Parameters {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// addErrorHints adds hints to the eBay errors in the (decoded) body of resp.
+// Bodies that aren't eBay's error document pass unchanged.
+func addErrorHints(resp *http.Response, loc localizer) error {
+	body, err := readLimited(resp.Body, maxResponseBufferSize)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if out, ok := hintErrors(body, resp.StatusCode, loc); ok {
+		body = out
+		resp.Header.Set("Content-Type", "application/json")
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// hintErrors returns body with hints, and whether it added any.
+func hintErrors(body []byte, status int, loc localizer) ([]byte, bool) {
+	apiErr := ebay.DecodeError("", status, body)
+	if len(apiErr.Errors) == 0 {
+		return nil, false
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, false
+	}
+	entries, _ := doc["errors"].([]interface{})
+
+	var summary []string
+	for i, e := range apiErr.Errors {
+		if i >= len(entries) {
+			break
+		}
+		entry, ok := entries[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		hint, ok := hintFor(loc, status, e)
+		if !ok {
+			continue
+		}
+		entry["hint"] = hint
+		summary = append(summary, hint.Message)
+	}
+	if len(summary) == 0 {
+		return nil, false
+	}
+	doc["summary"] = strings.Join(dedupeStrings(summary), " ")
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// dedupeStrings returns list without repeats, in order.
+func dedupeStrings(list []string) []string {
+	seen := make(map[string]bool, len(list))
+	out := list[:0]
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
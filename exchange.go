@@ -0,0 +1,305 @@
+package ebaymcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ### Manual Token Linking ###################################################
+
+// ebayTokenResponse is the subset of eBay's token endpoint response we use.
+type ebayTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// accessTokenRefreshMargin is how long before expiry a cached access token is
+// considered stale, so a token is never forwarded to eBay just as it expires.
+const accessTokenRefreshMargin = 2 * time.Minute
+
+// mintAccessToken exchanges an eBay refresh token issued in env for a new
+// access token.
+func mintAccessToken(ctx context.Context, env *ebayEnvironment, refreshToken string) (*ebayTokenResponse, error) {
+	formData := url.Values{}
+	formData.Set("grant_type", "refresh_token")
+	formData.Set("refresh_token", refreshToken)
+	formData.Set("scope", strings.Join(env.OAuth.Scopes, " "))
+
+	resp, body, err := postTokenRequest(ctx, env, formData)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("eBay rejected the refresh token (status %d): %s", resp.StatusCode, body)
+	}
+
+	var token ebayTokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("failed to parse eBay token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("eBay token response did not contain an access token")
+	}
+	return &token, nil
+}
+
+// handleTokenExchange: An escape hatch for power users whose ChatGPT
+// workspace blocks the three-legged OAuth flow.
+//
+// The user pastes an eBay refresh token (obtained e.g. from the eBay developer
+// portal's "User Tokens" page). We validate it by minting an access token and
+// store it in the vault. The returned vault reference ("vault:...") can then
+// be configured as the GPT Action's API key: handleProxy resolves it to a
+// fresh eBay access token on every call.
+//
+// With BACKEND_URL, a request carrying an access token of the backend's
+// OAuth server stores the refresh token with that user in the backend
+// instead, and the access token itself works as the API key. The token
+// needs the link_account scope.
+//
+// POST /token/exchange  (form or JSON body with "refresh_token" and an
+// optional "language" for proxy messages; add ?ebay_env=sandbox for sandbox
+// tokens)
+func handleTokenExchange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Users of the backend link the account to themselves: the backend
+	// stores the refresh token and their access token is the API key
+	var owner *backendToken
+	if parts := strings.Fields(r.Header.Get("Authorization")); backend != nil && len(parts) == 2 && strings.EqualFold(parts[0], "bearer") {
+		identity, err := backend.Introspect(r.Context(), parts[1])
+		if err != nil {
+			log.Printf("Failed to check backend token: %v", err)
+			http.Error(w, "Failed to check the access token", http.StatusServiceUnavailable)
+			return
+		}
+		if !identity.Active || identity.UserID == nil {
+			http.Error(w, "Invalid or expired access token", http.StatusUnauthorized)
+			return
+		}
+		if !identity.hasScope(linkAccountScope) {
+			writeInsufficientScope(w, localizerFor(r, "", ""), r.Method, r.URL.Path, []string{linkAccountScope})
+			return
+		}
+		owner = identity
+	}
+
+	if owner == nil && vault == nil {
+		http.Error(w, "Token vault is not configured on this server", http.StatusServiceUnavailable)
+		return
+	}
+
+	var refreshToken, language string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+			Language     string `json:"language"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		refreshToken, language = body.RefreshToken, body.Language
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+			return
+		}
+		refreshToken, language = r.Form.Get("refresh_token"), r.Form.Get("language")
+	}
+	if language != "" && supportedLanguage(language) == "" {
+		http.Error(w, "Unsupported language: "+language, http.StatusBadRequest)
+		return
+	}
+
+	env, err := environmentFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Remember the user's marketplace so later calls default to it
+	marketplace, err := marketplaceFor(r, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	refreshToken = strings.TrimSpace(refreshToken)
+	if refreshToken == "" {
+		http.Error(w, "Missing required parameter: refresh_token", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the refresh token by actually minting an access token
+	token, err := mintAccessToken(r.Context(), env, refreshToken)
+	if err != nil {
+		log.Printf("Token exchange validation failed: %v", err)
+		http.Error(w, "The refresh token was rejected by eBay", http.StatusBadRequest)
+		return
+	}
+
+	// Record whose account this is, so eBay account deletion notifications
+	// can find it and users can see which account they linked. Needs the
+	// commerce.identity.readonly scope.
+	user, err := fetchEbayUser(r.Context(), env, token.AccessToken)
+	if err != nil {
+		log.Printf("Could not identify the linked eBay account: %v", err)
+		user = &ebayUser{}
+	}
+
+	entry := &vaultEntry{
+		RefreshToken:                refreshToken,
+		Environment:                 env.Name,
+		Tenant:                      env.Tenant,
+		Marketplace:                 marketplace,
+		Language:                    supportedLanguage(language),
+		EbayUserID:                  user.UserID,
+		EbayUsername:                user.Username,
+		EbayAccountType:             user.AccountType,
+		EbayRegistrationMarketplace: user.RegistrationMarketplaceID,
+		Scopes:                      env.OAuth.Scopes,
+		CreatedAt:                   time.Now().UTC(),
+		accessToken:                 token.AccessToken,
+		expiresAt:                   time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}
+	if owner != nil {
+		if err := backend.PutEbayCredential(r.Context(), *owner.UserID, entry); err != nil {
+			log.Printf("Failed to store token in the backend: %v", err)
+			http.Error(w, "Failed to store token", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Stored manually linked eBay refresh token in the backend")
+		audit.Record("backend.linked", map[string]string{
+			"environment":  env.Name,
+			"ebay_user_id": user.UserID,
+			"user_id":      strconv.FormatUint(uint64(*owner.UserID), 10),
+		})
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": token.AccessToken,
+			"token_type":   "Bearer",
+			"expires_in":   token.ExpiresIn,
+		})
+		return
+	}
+
+	id, err := vault.Put(entry)
+	if err != nil {
+		log.Printf("Failed to store token in vault: %v", err)
+		http.Error(w, "Failed to store token", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Stored manually linked eBay refresh token in vault")
+	audit.Record("vault.linked", map[string]string{"environment": env.Name, "ebay_user_id": user.UserID})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"api_key":      vaultKeyPrefix + id,
+		"access_token": token.AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   token.ExpiresIn,
+	})
+}
+
+// vaultAccessToken resolves a "vault:<id>" reference to a valid eBay access
+// token and its vault entry, minting a new token from the stored refresh
+// token when needed.
+func vaultAccessToken(ctx context.Context, reference string) (string, *vaultEntry, error) {
+	if vault == nil {
+		return "", nil, errors.New("token vault is not configured")
+	}
+
+	entry, ok := vault.Get(strings.TrimPrefix(reference, vaultKeyPrefix))
+	if !ok {
+		return "", nil, errors.New("unknown vault reference")
+	}
+
+	env := entry.environment()
+	if env == nil {
+		return "", nil, fmt.Errorf("linked account belongs to unconfigured environment %q", entry.Environment)
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.accessToken != "" && time.Until(entry.expiresAt) > accessTokenRefreshMargin {
+		return entry.accessToken, entry, nil
+	}
+
+	// Another replica may already have minted one
+	if data, ok := tokenCache.Get(ctx, "vault", reference); ok {
+		var cached cachedAccessToken
+		if plaintext, err := vault.open(data); err == nil && json.Unmarshal(plaintext, &cached) == nil &&
+			time.Until(cached.ExpiresAt) > accessTokenRefreshMargin {
+			entry.accessToken, entry.expiresAt = cached.AccessToken, cached.ExpiresAt
+			return entry.accessToken, entry, nil
+		}
+	}
+
+	token, err := mintAccessToken(ctx, env, entry.RefreshToken)
+	if err != nil {
+		return "", nil, err
+	}
+	entry.accessToken = token.AccessToken
+	entry.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	// Cached tokens are sealed with the vault key like the refresh tokens
+	plaintext, _ := json.Marshal(cachedAccessToken{AccessToken: entry.accessToken, ExpiresAt: entry.expiresAt})
+	if sealed, err := vault.seal(plaintext); err == nil {
+		tokenCache.Set(ctx, "vault", reference, sealed, time.Until(entry.expiresAt)-accessTokenRefreshMargin)
+	}
+	return entry.accessToken, entry, nil
+}
+
+// cachedAccessToken is a minted access token as kept in tokenCache.
+type cachedAccessToken struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// ebayUser is the subset of the Identity API's getUser response we keep.
+type ebayUser struct {
+	UserID                    string `json:"userId"`
+	Username                  string `json:"username"`
+	AccountType               string `json:"accountType"`               // INDIVIDUAL or BUSINESS
+	RegistrationMarketplaceID string `json:"registrationMarketplaceId"` // e.g. EBAY_US
+}
+
+// fetchEbayUser identifies the account an access token belongs to.
+func fetchEbayUser(ctx context.Context, env *ebayEnvironment, accessToken string) (*ebayUser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://"+apizHost(env.APIHost)+"/commerce/identity/v1/user/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getUser returned status %d", resp.StatusCode)
+	}
+
+	var user ebayUser
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to parse getUser response: %w", err)
+	}
+	return &user, nil
+}
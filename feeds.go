@@ -0,0 +1,242 @@
+package ebaymcp
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ayouroukov/ebay-mcp/internal/ebay"
+)
+
+// ### Feed Files #############################################################
+
+// Feed API tasks move whole inventories and order histories as files, far
+// too large for a tool result. createFeedTask, createInventoryTask and
+// createOrderTask start them through /proxy; the rest works on the task by
+// ID under /feeds/tasks:
+//
+//	GET  /feeds/tasks/{task_id}?task_type=task|inventory_task|order_task
+//	     (getFeedTaskStatus) the status, progress and what to do next;
+//	GET  /feeds/tasks/{task_id}/result[?decompress=true]
+//	     streams the result file from eBay, gunzipped on the fly if asked;
+//	POST /feeds/tasks/{task_id}/upload?file_name=items.xml
+//	     streams the raw request body to eBay as the task's input file.
+//
+// Neither file is held in memory, and uploads may be up to
+// MAX_FEED_UPLOAD_SIZE. /proxy passes multipart upload_file calls through
+// the same way.
+
+const feedTasksPath = "/feeds/tasks"
+
+// isFeedUpload reports whether path uploads a feed file, directly or
+// through /proxy.
+func isFeedUpload(path string) bool {
+	return strings.Contains(path, "/sell/feed/") && strings.HasSuffix(path, "/upload_file") ||
+		strings.Contains(path, feedTasksPath+"/") && strings.HasSuffix(path, "/upload")
+}
+
+// handleFeedTasks routes the /feeds/tasks endpoints.
+func handleFeedTasks(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, feedTasksPath), "/")
+	parts := strings.Split(rest, "/")
+	switch {
+	case rest == "":
+		http.NotFound(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		handleFeedTaskStatus(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "result" && r.Method == http.MethodGet:
+		handleFeedResult(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "upload" && r.Method == http.MethodPost:
+		handleFeedUpload(w, r, parts[0])
+	case len(parts) == 1 || len(parts) == 2 && (parts[1] == "result" || parts[1] == "upload"):
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// feedCaller resolves the caller of a feed endpoint, checks that the
+// policy allows the Feed API call it makes, and returns a client for it
+// without the typed client's overall timeout, since files can take longer
+// than that to stream; the request's context bounds the call instead.
+func feedCaller(w http.ResponseWriter, r *http.Request, method, path string) (*ebayCaller, *ebay.Client, bool) {
+	if err := currentPolicy().AllowPath(method, path); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, nil, false
+	}
+	caller, status, err := resolveCaller(w, r)
+	if err != nil {
+		log.Printf("Failed to resolve token for the feed endpoints: %v", err)
+		http.Error(w, err.Error(), status)
+		return nil, nil, false
+	}
+	client := caller.client()
+	client.HTTPClient = &http.Client{Transport: ebayTransport}
+	return caller, client, true
+}
+
+// handleFeedTaskStatus (getFeedTaskStatus) reports a task's status.
+// GET /feeds/tasks/{task_id}?task_type=task|inventory_task|order_task
+func handleFeedTaskStatus(w http.ResponseWriter, r *http.Request, taskID string) {
+	taskType := ebay.TaskType(r.URL.Query().Get("task_type"))
+	switch taskType {
+	case "":
+		taskType = ebay.FeedTask
+	case ebay.FeedTask, ebay.InventoryTask, ebay.OrderTask:
+	default:
+		http.Error(w, "task_type must be task, inventory_task or order_task", http.StatusBadRequest)
+		return
+	}
+	caller, _, ok := feedCaller(w, r, http.MethodGet, "/sell/feed/v1/"+string(taskType)+"/"+taskID)
+	if !ok {
+		return
+	}
+	task, err := caller.client().GetTask(r.Context(), taskType, taskID)
+	if err != nil {
+		writeEbayError(w, r, caller, err)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"task_id":   task.TaskID,
+		"task_type": taskType,
+		"feed_type": task.FeedType,
+		"status":    task.Status,
+	}
+	if task.CreationDate != "" {
+		resp["creation_date"] = task.CreationDate
+	}
+	if task.CompletionDate != "" {
+		resp["completion_date"] = task.CompletionDate
+	}
+	if task.UploadSummary != nil {
+		resp["upload_summary"] = task.UploadSummary
+	}
+	base := strings.TrimRight(externalBaseURL(r), "/") + feedTasksPath + "/" + task.TaskID
+	progress, pending := feedTaskPolling.Stages[task.Status]
+	switch {
+	case task.Status == "CREATED" && taskType == ebay.FeedTask:
+		resp["upload_url"] = base + "/upload"
+		resp["next"] = "If this is an upload feed, upload its input file (POST the file to upload_url); a download feed is queued shortly. Check again later."
+	case pending:
+		resp["next"] = "The task is still running. Check again later."
+	case task.Status == "FAILED":
+		progress = 100
+		resp["next"] = "The task failed. Check its feed_type and filter criteria, and create a new task."
+	default:
+		progress = 100
+		resp["result_url"] = base + "/result"
+		resp["next"] = "The task is done. Get its result file with getFeedResultFile, or download it from result_url with the same Authorization header."
+	}
+	resp["progress"] = progress
+	resp["done"] = !pending
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleFeedResult streams a task's result file.
+// GET /feeds/tasks/{task_id}/result[?decompress=true]
+func handleFeedResult(w http.ResponseWriter, r *http.Request, taskID string) {
+	decompress, err := strconv.ParseBool(r.URL.Query().Get("decompress"))
+	if err != nil && r.URL.Query().Get("decompress") != "" {
+		http.Error(w, "decompress must be true or false", http.StatusBadRequest)
+		return
+	}
+	caller, client, ok := feedCaller(w, r, http.MethodGet, "/sell/feed/v1/task/"+taskID+"/download_result_file")
+	if !ok {
+		return
+	}
+	file, err := client.GetResultFile(r.Context(), taskID)
+	if err != nil {
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	defer file.Body.Close()
+
+	var body io.Reader = file.Body
+	name, contentType := file.Name, file.ContentType
+	if decompress {
+		// Only gzip streams; zip archives need the whole file and pass
+		// through as they are.
+		buffered := bufio.NewReader(file.Body)
+		body = buffered
+		if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+			gz, err := gzip.NewReader(buffered)
+			if err != nil {
+				http.Error(w, "Failed to decompress the result file", http.StatusBadGateway)
+				return
+			}
+			defer gz.Close()
+			body = gz
+			name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".gzip")
+			contentType = mime.TypeByExtension(filepath.Ext(name))
+			file.Size = -1
+		}
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Header().Set("Cache-Control", "private, no-store")
+	if file.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	}
+	n, err := io.Copy(w, body)
+	if err != nil {
+		// Too late for an error status: the client sees a truncated file
+		log.Printf("Streaming the result file of feed task %s failed after %d bytes: %v", taskID, n, err)
+		return
+	}
+	log.Printf("Streamed the result file of feed task %s (%d bytes)", taskID, n)
+}
+
+// handleFeedUpload streams the request body to eBay as a task's input file.
+// POST /feeds/tasks/{task_id}/upload?file_name=...
+func handleFeedUpload(w http.ResponseWriter, r *http.Request, taskID string) {
+	name := r.URL.Query().Get("file_name")
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); name == "" && err == nil {
+		name = params["filename"]
+	}
+	name = filepath.Base(name)
+	if name == "" || name == "." || name == "/" {
+		http.Error(w, "file_name is required", http.StatusBadRequest)
+		return
+	}
+	caller, client, ok := feedCaller(w, r, http.MethodPost, "/sell/feed/v1/task/"+taskID+"/upload_file")
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	counted := &countingReader{r: r.Body}
+	if err := client.UploadFile(ctx, taskID, name, counted); err != nil {
+		if isBodyTooLarge(err) {
+			writeBodyTooLarge(w, maxFeedUploadSize)
+			return
+		}
+		log.Printf("Uploading %s to feed task %s failed: %v", name, taskID, err)
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	log.Printf("Uploaded %s (%d bytes) to feed task %s", name, counted.n, taskID)
+	audit.Record("feed.uploaded", map[string]string{
+		"task_id":    taskID,
+		"file_name":  name,
+		"size":       strconv.FormatInt(counted.n, 10),
+		"token_hash": tokenHash(caller.bearer),
+	})
+	caller.wrote(ctx)
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"task_id":    taskID,
+		"file_name":  name,
+		"size":       counted.n,
+		"status_url": strings.TrimRight(externalBaseURL(r), "/") + feedTasksPath + "/" + taskID,
+		"next":       "eBay processes the file in the background. Follow the task with getFeedTaskStatus.",
+	})
+}
@@ -0,0 +1,294 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ### Feature Flags ##########################################################
+
+// Big subsystems can be rolled out gradually: each is gated by a flag that
+// code checks with flags.IsEnabled, for a subject made of the tenant (today
+// the eBay environment) and a caller key used to bucket percentages. A flag
+// is decided by the first source that knows it:
+//
+//	FEATURE_FLAGS      env overrides, e.g. response_cache=off,ebay_signatures=25%
+//	FEATURE_FLAGS_URL  an OpenFeature remote evaluation (OFREP) service
+//	POLICY_FILE        the policy's `flags` section
+//
+// and is on when none does, so an unconfigured deployment behaves as before.
+
+// Flags gating subsystems.
+const (
+	flagResponseCache = "response_cache"  // serving GETs from the response cache
+	flagSignatures    = "ebay_signatures" // RFC 9421 signing of calls that need it
+	flagMCP           = "mcp"             // the MCP server
+	flagCapture       = "capture"         // capturing /proxy calls to CAPTURE_DIR
+)
+
+// knownFlags lists every flag, so rules naming anything else are rejected.
+var knownFlags = []string{flagResponseCache, flagSignatures, flagMCP, flagCapture}
+
+const defaultFlagCacheTTL = 30 * time.Second
+
+// flagSubject is who a flag is evaluated for.
+type flagSubject struct {
+	Tenant string
+	Key    string // stable per caller, e.g. a token hash; empty for none
+}
+
+// FlagRule decides a flag in the policy. Listed tenants always get it;
+// otherwise it is off unless Enabled, and then on for Percentage percent of
+// callers (all of them when unset).
+type FlagRule struct {
+	Name       string   `yaml:"name"`
+	Enabled    bool     `yaml:"enabled"`
+	Percentage *int     `yaml:"percentage,omitempty"`
+	Tenants    []string `yaml:"tenants,omitempty"`
+}
+
+// validate checks the rule at index i of the policy.
+func (f *FlagRule) validate(i int) []string {
+	var problems []string
+	if !isKnownFlag(f.Name) {
+		problems = append(problems, fmt.Sprintf("flags[%d]: unknown flag %q (expected one of %s)", i, f.Name, strings.Join(knownFlags, ", ")))
+	}
+	if f.Percentage != nil && (*f.Percentage < 0 || *f.Percentage > 100) {
+		problems = append(problems, fmt.Sprintf("flags[%d]: percentage must be between 0 and 100", i))
+	}
+	return problems
+}
+
+// evaluate applies the rule to s.
+func (f *FlagRule) evaluate(s flagSubject) bool {
+	for _, t := range f.Tenants {
+		if t == s.Tenant {
+			return true
+		}
+	}
+	if !f.Enabled {
+		return false
+	}
+	return f.Percentage == nil || inRollout(f.Name, s.Key, *f.Percentage)
+}
+
+func isKnownFlag(name string) bool {
+	for _, known := range knownFlags {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// inRollout reports whether key falls into the first percent of buckets of
+// flag. Buckets differ per flag, so the same callers don't get every
+// experiment; callers without a key only get full rollouts.
+func inRollout(flag, key string, percent int) bool {
+	if percent >= 100 {
+		return true
+	}
+	if key == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(flag + ":" + key))
+	return int(binary.BigEndian.Uint32(sum[:4])%100) < percent
+}
+
+// flagSource decides flags; ok=false means it has no opinion on name.
+type flagSource interface {
+	Evaluate(ctx context.Context, name string, s flagSubject) (enabled, ok bool)
+}
+
+// featureFlags asks its sources in order.
+type featureFlags struct {
+	sources []flagSource
+}
+
+// flags is the process-wide flag set, configured at startup.
+var flags = &featureFlags{}
+
+// IsEnabled reports whether flag name is on for s.
+func (f *featureFlags) IsEnabled(ctx context.Context, name string, s flagSubject) bool {
+	for _, source := range f.sources {
+		if enabled, ok := source.Evaluate(ctx, name, s); ok {
+			return enabled
+		}
+	}
+	return true
+}
+
+// featureFlagsFromEnv builds the flag set from FEATURE_FLAGS,
+// FEATURE_FLAGS_URL and the policy rules returned by rules.
+func featureFlagsFromEnv(rules func() []FlagRule) (*featureFlags, error) {
+	f := &featureFlags{}
+
+	if v := os.Getenv("FEATURE_FLAGS"); v != "" {
+		overrides, err := parseFlagOverrides(v)
+		if err != nil {
+			return nil, err
+		}
+		f.sources = append(f.sources, overrides)
+	}
+
+	if v := os.Getenv("FEATURE_FLAGS_URL"); v != "" {
+		base, err := url.Parse(v)
+		if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" {
+			return nil, fmt.Errorf("invalid FEATURE_FLAGS_URL %q", v)
+		}
+		ttl := defaultFlagCacheTTL
+		if v := os.Getenv("FEATURE_FLAGS_CACHE_TTL"); v != "" {
+			if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 {
+				return nil, fmt.Errorf("invalid FEATURE_FLAGS_CACHE_TTL %q", v)
+			}
+		}
+		f.sources = append(f.sources, &ofrepFlags{
+			baseURL: strings.TrimRight(base.String(), "/"),
+			token:   os.Getenv("FEATURE_FLAGS_TOKEN"),
+			http:    &http.Client{Timeout: 2 * time.Second},
+			ttl:     ttl,
+		})
+	}
+
+	f.sources = append(f.sources, policyFlags(rules))
+	return f, nil
+}
+
+// ### Sources ###
+
+// flagOverrides are the FEATURE_FLAGS rules.
+type flagOverrides map[string]FlagRule
+
+// parseFlagOverrides parses "name=on|off|N%" pairs separated by commas.
+func parseFlagOverrides(s string) (flagOverrides, error) {
+	overrides := make(flagOverrides)
+	for _, item := range splitList(s) {
+		name, value, _ := strings.Cut(item, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !isKnownFlag(name) {
+			return nil, fmt.Errorf("FEATURE_FLAGS: unknown flag %q (expected one of %s)", name, strings.Join(knownFlags, ", "))
+		}
+		rule := FlagRule{Name: name}
+		switch {
+		case value == "on":
+			rule.Enabled = true
+		case value == "off":
+		case strings.HasSuffix(value, "%"):
+			n, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+			if err != nil || n < 0 || n > 100 {
+				return nil, fmt.Errorf("FEATURE_FLAGS: invalid percentage %q for %s", value, name)
+			}
+			rule.Enabled, rule.Percentage = true, &n
+		default:
+			return nil, fmt.Errorf("FEATURE_FLAGS: %s must be on, off or a percentage such as 25%%", name)
+		}
+		overrides[name] = rule
+	}
+	return overrides, nil
+}
+
+func (o flagOverrides) Evaluate(_ context.Context, name string, s flagSubject) (bool, bool) {
+	rule, ok := o[name]
+	if !ok {
+		return false, false
+	}
+	return rule.evaluate(s), true
+}
+
+// policyFlags are the rules of the policy's `flags` section.
+type policyFlags func() []FlagRule
+
+func (p policyFlags) Evaluate(_ context.Context, name string, s flagSubject) (bool, bool) {
+	for _, rule := range p() {
+		if rule.Name == name {
+			return rule.evaluate(s), true
+		}
+	}
+	return false, false
+}
+
+// ofrepFlags evaluates flags with an OpenFeature Remote Evaluation Protocol
+// service (flagd, GO Feature Flag, ...), remembering decisions in flagCache
+// for FEATURE_FLAGS_CACHE_TTL. Unknown flags and unreachable services fall
+// through to the next source.
+type ofrepFlags struct {
+	baseURL string
+	token   string
+	http    *http.Client
+	ttl     time.Duration
+}
+
+func (o *ofrepFlags) Evaluate(ctx context.Context, name string, s flagSubject) (bool, bool) {
+	key := s.Tenant + "\n" + s.Key
+	if cached, ok := flagCache.Get(ctx, name, key); ok {
+		return string(cached) == "1", true
+	}
+
+	enabled, ok, err := o.fetch(ctx, name, s)
+	if err != nil {
+		log.Printf("Feature flag service failed for %s: %v", name, err)
+		return false, false
+	}
+	if !ok {
+		return false, false
+	}
+	value := []byte("0")
+	if enabled {
+		value = []byte("1")
+	}
+	flagCache.Set(ctx, name, key, value, o.ttl)
+	return enabled, true
+}
+
+// fetch asks the service for flag name; ok=false when it doesn't know it.
+func (o *ofrepFlags) fetch(ctx context.Context, name string, s flagSubject) (enabled, ok bool, err error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"context": map[string]string{"targetingKey": s.Key, "tenant": s.Tenant},
+	})
+	if err != nil {
+		return false, false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/ofrep/v1/evaluate/flags/"+url.PathEscape(name), bytes.NewReader(body))
+	if err != nil {
+		return false, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.token != "" {
+		req.Header.Set("Authorization", "Bearer "+o.token)
+	}
+
+	resp, err := o.http.Do(req)
+	if err != nil {
+		return false, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Value interface{} `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, false, err
+	}
+	value, isBool := result.Value.(bool)
+	if !isBool {
+		return false, false, fmt.Errorf("flag is not a boolean")
+	}
+	return value, true, nil
+}
@@ -6,6 +6,7 @@ import { Login } from './pages/Login';
 import { Register } from './pages/Register';
 import { Dashboard } from './pages/Dashboard';
 import { OAuthConsent } from './pages/OAuthConsent';
+import { DeviceAuthorization } from './pages/DeviceAuthorization';
 
 // Protected route wrapper
 const ProtectedRoute: React.FC<{ children: React.ReactElement }> = ({ children }) => {
@@ -30,6 +31,7 @@ function App() {
             }
           />
           <Route path="/oauth/consent" element={<OAuthConsent />} />
+          <Route path="/device" element={<DeviceAuthorization />} />
         </Routes>
       </Router>
     </AuthProvider>
@@ -15,6 +15,13 @@ export interface AuthResponse {
   user: User;
 }
 
+// Returned by login instead of a token when the account has two-factor
+// authentication; the challenge is exchanged with a code at verifyTwoFactor
+export interface TwoFactorChallenge {
+  two_factor_required: true;
+  challenge: string;
+}
+
 export interface RegisterData {
   email: string;
   password: string;
@@ -32,11 +39,16 @@ export const authApi = {
     return response.data;
   },
 
-  login: async (data: LoginData): Promise<AuthResponse> => {
+  login: async (data: LoginData): Promise<AuthResponse | TwoFactorChallenge> => {
     const response = await axios.post(`${API_URL}/api/auth/login`, data);
     return response.data;
   },
 
+  verifyTwoFactor: async (challenge: string, code: string): Promise<AuthResponse> => {
+    const response = await axios.post(`${API_URL}/api/auth/2fa/verify`, { challenge, code });
+    return response.data;
+  },
+
   getProfile: async (token: string): Promise<User> => {
     const response = await axios.get(`${API_URL}/api/auth/profile`, {
       headers: {
@@ -0,0 +1,151 @@
+import React, { useCallback, useEffect, useState } from 'react';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+import axios from 'axios';
+import { useAuth } from '../context/AuthContext';
+
+const API_URL = process.env.REACT_APP_API_URL || 'http://localhost:8080';
+
+// Approves a device authorization (RFC 8628): the user types the code shown
+// by a CLI or headless MCP server, checks the request and decides.
+export const DeviceAuthorization: React.FC = () => {
+  const [searchParams] = useSearchParams();
+  const navigate = useNavigate();
+  const { token, isAuthenticated } = useAuth();
+  const [userCode, setUserCode] = useState(searchParams.get('user_code') || '');
+  const [request, setRequest] = useState<any>(null);
+  const [result, setResult] = useState('');
+  const [error, setError] = useState('');
+  const [loading, setLoading] = useState(false);
+
+  const lookup = useCallback(async (code: string) => {
+    setLoading(true);
+    setError('');
+    try {
+      const response = await axios.get(`${API_URL}/oauth/device`, {
+        params: { user_code: code },
+        headers: { Authorization: `Bearer ${token}` },
+      });
+      setRequest(response.data);
+    } catch (err: any) {
+      setError(err.response?.data?.error || 'Failed to look up the code');
+    } finally {
+      setLoading(false);
+    }
+  }, [token]);
+
+  useEffect(() => {
+    if (!isAuthenticated) {
+      const returnUrl = `/device?${searchParams.toString()}`;
+      navigate(`/login?return=${encodeURIComponent(returnUrl)}`);
+      return;
+    }
+    const code = searchParams.get('user_code');
+    if (code) {
+      lookup(code);
+    }
+  }, [isAuthenticated, searchParams, navigate, lookup]);
+
+  const decide = async (approved: boolean) => {
+    setLoading(true);
+    setError('');
+    try {
+      await axios.post(
+        `${API_URL}/oauth/device/consent`,
+        { user_code: request.user_code, approved },
+        { headers: { Authorization: `Bearer ${token}` } }
+      );
+      setResult(approved ? 'Device connected. You can return to it now.' : 'Request denied.');
+    } catch (err: any) {
+      setError(err.response?.data?.error || 'Failed to process your decision');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
+      <div className="max-w-md w-full">
+        <div className="bg-white shadow-md rounded-lg overflow-hidden">
+          <div className="bg-indigo-600 px-6 py-4">
+            <h2 className="text-2xl font-bold text-white text-center">Connect a Device</h2>
+          </div>
+
+          <div className="px-6 py-8">
+            {error && <p className="mb-4 text-sm text-red-600">{error}</p>}
+
+            {result ? (
+              <p className="text-center text-gray-700">{result}</p>
+            ) : !request ? (
+              <form
+                onSubmit={(e) => {
+                  e.preventDefault();
+                  lookup(userCode);
+                }}
+              >
+                <label htmlFor="user_code" className="block text-sm font-medium text-gray-700 mb-2">
+                  Enter the code shown on your device
+                </label>
+                <input
+                  id="user_code"
+                  value={userCode}
+                  onChange={(e) => setUserCode(e.target.value)}
+                  placeholder="XXXX-XXXX"
+                  autoComplete="off"
+                  className="w-full px-3 py-2 border border-gray-300 rounded-md text-center text-lg tracking-widest uppercase focus:outline-none focus:ring-indigo-500 focus:border-indigo-500"
+                />
+                <button
+                  type="submit"
+                  disabled={loading || !userCode}
+                  className="mt-4 w-full py-2 px-4 border border-transparent rounded-md text-sm font-medium text-white bg-indigo-600 hover:bg-indigo-700 disabled:opacity-50"
+                >
+                  Continue
+                </button>
+              </form>
+            ) : (
+              <>
+                <p className="text-lg text-gray-700 text-center mb-6">
+                  <span className="font-semibold">{request.client_name}</span> wants to connect to your account
+                  with code <span className="font-mono">{request.user_code}</span>.
+                </p>
+
+                {request.scopes?.length > 0 && (
+                  <div className="mb-6">
+                    <h3 className="text-sm font-medium text-gray-700 mb-2">It will be able to:</h3>
+                    <ul className="list-disc list-inside text-sm text-gray-600 space-y-1">
+                      {request.scopes.map((s: { name: string; description?: string }) => (
+                        <li key={s.name}>{s.description || s.name}</li>
+                      ))}
+                    </ul>
+                  </div>
+                )}
+
+                <div className="bg-gray-50 rounded-md p-4 mb-6">
+                  <p className="text-xs text-gray-600">
+                    Only approve if you started this on your own device and the code matches.
+                  </p>
+                </div>
+
+                <div className="flex space-x-4">
+                  <button
+                    onClick={() => decide(false)}
+                    disabled={loading}
+                    className="flex-1 py-2 px-4 border border-gray-300 rounded-md text-sm font-medium text-gray-700 bg-white hover:bg-gray-50 disabled:opacity-50"
+                  >
+                    Deny
+                  </button>
+                  <button
+                    onClick={() => decide(true)}
+                    disabled={loading}
+                    className="flex-1 py-2 px-4 border border-transparent rounded-md text-sm font-medium text-white bg-indigo-600 hover:bg-indigo-700 disabled:opacity-50"
+                  >
+                    Approve
+                  </button>
+                </div>
+              </>
+            )}
+          </div>
+        </div>
+      </div>
+    </div>
+  );
+};
@@ -37,16 +37,21 @@ export const OAuthConsent: React.FC = () => {
     const fetchConsentData = async () => {
       try {
         const response = await axios.get(
-          `${API_URL}/oauth/authorize?client_id=${clientId}&redirect_uri=${redirectUri}&response_type=${responseType}&scope=${scope || ''}&state=${state || ''}`,
+          `${API_URL}/oauth/authorize?${searchParams.toString()}`,
           {
             headers: {
               Authorization: `Bearer ${token}`,
             },
           }
         );
+        if (response.data.auto_approved) {
+          // Trusted client or scopes approved before: no consent needed
+          window.location.href = response.data.redirect_url;
+          return;
+        }
         setConsentData(response.data);
       } catch (err: any) {
-        setError(err.response?.data?.error || 'Failed to load consent information');
+        setError(err.response?.data?.error_description || err.response?.data?.error || 'Failed to load consent information');
       } finally {
         setLoading(false);
       }
@@ -65,8 +70,11 @@ export const OAuthConsent: React.FC = () => {
         {
           client_id: clientId,
           redirect_uri: redirectUri,
-          scope: scope || '',
+          scope: consentData?.scope ?? scope ?? '',
           state: state || '',
+          code_challenge: searchParams.get('code_challenge') || '',
+          code_challenge_method: searchParams.get('code_challenge_method') || '',
+          resource: searchParams.get('resource') || '',
           approved,
         },
         {
@@ -132,12 +140,12 @@ export const OAuthConsent: React.FC = () => {
               </p>
             </div>
 
-            {scope && (
+            {consentData?.scopes?.length > 0 && (
               <div className="mb-6">
                 <h3 className="text-sm font-medium text-gray-700 mb-2">This application will be able to:</h3>
                 <ul className="list-disc list-inside text-sm text-gray-600 space-y-1">
-                  {scope.split(' ').map((s, i) => (
-                    <li key={i}>{s}</li>
+                  {consentData.scopes.map((s: { name: string; description?: string }) => (
+                    <li key={s.name}>{s.description || s.name}</li>
                   ))}
                 </ul>
               </div>
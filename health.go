@@ -0,0 +1,281 @@
+package ebaymcp
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/store"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ### Health Checks ##########################################################
+
+// GET /healthz answers as long as the process serves requests (liveness).
+// GET /readyz checks what serving needs (readiness): the cache server, the
+// account backend, the served certificates and eBay's token endpoints, and
+// answers 503 while any of them is down. Results are reused for a few
+// seconds so frequent probes don't turn into traffic to eBay.
+
+const (
+	readinessTimeout      = 5 * time.Second
+	readinessCacheTTL     = 10 * time.Second
+	certificateWarnBefore = 14 * 24 * time.Hour
+)
+
+// Check outcomes. A degraded dependency is worth an alert but the proxy
+// still serves, e.g. without the shared cache, so only "down" fails /readyz.
+const (
+	checkOK       = "ok"
+	checkDegraded = "degraded"
+	checkDown     = "down"
+)
+
+// dependencyStatus is the outcome of one check.
+type dependencyStatus struct {
+	Status    string     `json:"status"`
+	LatencyMS float64    `json:"latency_ms,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// readiness is the answer of /readyz: the worst status of all checks.
+type readiness struct {
+	Status    string                      `json:"status"`
+	CheckedAt time.Time                   `json:"checked_at"`
+	Checks    map[string]dependencyStatus `json:"checks"`
+}
+
+// servedCertificates returns the leaf certificates the server presents, by
+// name, or is nil when TLS is terminated elsewhere.
+var servedCertificates func(ctx context.Context) (map[string]*x509.Certificate, error)
+
+// lastReadiness is the most recent /readyz result.
+var lastReadiness struct {
+	sync.Mutex
+	result *readiness
+}
+
+// handleHealthz reports that the process is alive.
+// GET /healthz
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": checkOK})
+}
+
+// handleReadyz reports each dependency: 503 while any is down.
+// GET /readyz
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	result := checkReadiness(r.Context(), time.Now())
+	status := http.StatusOK
+	if result.Status == checkDown {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, result)
+}
+
+// checkReadiness runs the checks concurrently, or returns the last result
+// while it is fresh. A probe that gives up does not cut the checks short.
+func checkReadiness(ctx context.Context, now time.Time) *readiness {
+	lastReadiness.Lock()
+	defer lastReadiness.Unlock()
+	if r := lastReadiness.result; r != nil && now.Sub(r.CheckedAt) < readinessCacheTTL {
+		return r
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), readinessTimeout)
+	defer cancel()
+
+	checks := readinessChecks(ctx)
+	result := &readiness{Status: checkOK, CheckedAt: now.UTC(), Checks: make(map[string]dependencyStatus, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) dependencyStatus) {
+			defer wg.Done()
+			start := time.Now()
+			s := check(ctx)
+			if s.LatencyMS == 0 && s.ExpiresAt == nil {
+				s.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			result.Checks[name] = s
+			if s.Status == checkDown || (s.Status == checkDegraded && result.Status == checkOK) {
+				result.Status = s.Status
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	lastReadiness.result = result
+	return result
+}
+
+// readinessChecks lists the checks of what is configured.
+func readinessChecks(ctx context.Context) map[string]func(context.Context) dependencyStatus {
+	checks := make(map[string]func(context.Context) dependencyStatus)
+	if !store.Local(cache) {
+		checks["cache"] = checkCache
+	}
+	if backend != nil {
+		checks["backend"] = backend.checkReady
+	}
+	for _, env := range tokenEndpoints() {
+		env := env
+		checks["ebay_token:"+env.key()] = func(ctx context.Context) dependencyStatus {
+			return checkTokenEndpoint(ctx, env)
+		}
+	}
+	if servedCertificates != nil {
+		certs, err := servedCertificates(ctx)
+		if err != nil {
+			checks["certificate"] = func(context.Context) dependencyStatus {
+				return dependencyStatus{Status: checkDegraded, Error: err.Error()}
+			}
+		}
+		for name, cert := range certs {
+			cert := cert
+			checks["certificate:"+name] = func(context.Context) dependencyStatus {
+				return checkCertificate(cert, time.Now())
+			}
+		}
+	}
+	return checks
+}
+
+// checkCache reads a key from the cache server. Without it the proxy keeps
+// OAuth state, tokens and rate limits per instance, so it is only degraded.
+func checkCache(ctx context.Context) dependencyStatus {
+	if _, _, err := cache.Get(ctx, cacheKeyPrefix+"readyz"); err != nil {
+		return dependencyStatus{Status: checkDegraded, Error: err.Error()}
+	}
+	return dependencyStatus{Status: checkOK}
+}
+
+// checkReady asks the backend whether it, and its database, are ready.
+func (b *backendClient) checkReady(ctx context.Context) dependencyStatus {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.baseURL+"/readyz", nil)
+	if err != nil {
+		return dependencyStatus{Status: checkDown, Error: err.Error()}
+	}
+	resp, err := b.http.Do(req)
+	if err != nil {
+		return dependencyStatus{Status: checkDown, Error: err.Error()}
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return dependencyStatus{Status: checkDown, Error: fmt.Sprintf("backend /readyz returned status %d", resp.StatusCode)}
+	}
+	return dependencyStatus{Status: checkOK}
+}
+
+// tokenEndpoints returns the first environment of every tenant using each
+// distinct token URL, so shared endpoints are checked once.
+func tokenEndpoints() []*ebayEnvironment {
+	seen := make(map[string]bool)
+	var envs []*ebayEnvironment
+	for _, env := range allEnvironments() {
+		if url := env.OAuth.Endpoint.TokenURL; !seen[url] {
+			seen[url] = true
+			envs = append(envs, env)
+		}
+	}
+	return envs
+}
+
+// checkTokenEndpoint checks that eBay's token endpoint answers at all: a
+// GET without credentials is refused, which is fine. During maintenance of
+// the environment it is degraded rather than down.
+func checkTokenEndpoint(ctx context.Context, env *ebayEnvironment) dependencyStatus {
+	var me *maintenanceError
+	if errors.As(maintenance.Check(env.Name, time.Now()), &me) {
+		return dependencyStatus{Status: checkDegraded, Error: me.Error()}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, env.OAuth.Endpoint.TokenURL, nil)
+	if err != nil {
+		return dependencyStatus{Status: checkDown, Error: err.Error()}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return dependencyStatus{Status: checkDown, Error: err.Error()}
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return dependencyStatus{Status: checkDown, Error: fmt.Sprintf("token endpoint returned status %d", resp.StatusCode)}
+	}
+	return dependencyStatus{Status: checkOK}
+}
+
+// checkCertificate is down once cert has expired and degraded in the two
+// weeks before.
+func checkCertificate(cert *x509.Certificate, now time.Time) dependencyStatus {
+	expires := cert.NotAfter.UTC()
+	s := dependencyStatus{Status: checkOK, ExpiresAt: &expires}
+	switch left := cert.NotAfter.Sub(now); {
+	case left <= 0:
+		s.Status, s.Error = checkDown, "certificate has expired"
+	case left < certificateWarnBefore:
+		s.Status, s.Error = checkDegraded, fmt.Sprintf("certificate expires in %d days", int(left.Hours()/24))
+	}
+	return s
+}
+
+// fileCertificates parses the leaf certificate of SSL_CERTFILE once: the
+// server keeps serving what it loaded at startup.
+func fileCertificates(path string) (func(ctx context.Context) (map[string]*x509.Certificate, error), error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := parseLeafCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	certs := map[string]*x509.Certificate{cert.Subject.CommonName: cert}
+	return func(context.Context) (map[string]*x509.Certificate, error) {
+		return certs, nil
+	}, nil
+}
+
+// autocertCertificates reads the certificates of domains from the autocert
+// cache, which holds the latest issued.
+func autocertCertificates(c autocert.Cache, domains []string) func(ctx context.Context) (map[string]*x509.Certificate, error) {
+	return func(ctx context.Context) (map[string]*x509.Certificate, error) {
+		certs := make(map[string]*x509.Certificate, len(domains))
+		var missing []error
+		for _, domain := range domains {
+			data, err := c.Get(ctx, domain)
+			if err != nil {
+				missing = append(missing, fmt.Errorf("%s: %w", domain, err))
+				continue
+			}
+			cert, err := parseLeafCertificate(data)
+			if err != nil {
+				missing = append(missing, fmt.Errorf("%s: %w", domain, err))
+				continue
+			}
+			certs[domain] = cert
+		}
+		return certs, errors.Join(missing...)
+	}
+}
+
+// parseLeafCertificate returns the first certificate in PEM data.
+func parseLeafCertificate(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return nil, errors.New("no certificate found")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package ebaymcp
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ### Localized Messages #####################################################
+
+// Human-readable text the proxy writes itself (connection summaries, error
+// hints) is localized. The language is, in order: the linked account's
+// preference (vault entries, set with "language" on /token/exchange), the
+// request's Accept-Language, the language of the account's marketplace, and
+// English. Message keys missing from a catalog fall back to English.
+
+const defaultLanguage = "en"
+
+// messageCatalogs holds the format strings of each supported language.
+var messageCatalogs = map[string]map[string]string{
+	"en": {
+		"status.no_token":      "No eBay account is linked: the request carried no bearer token",
+		"status.restart_note":  "Token was issued before the last server restart; scopes are the configured defaults and expiry is unknown",
+		"status.summary":       "Linked to eBay account %s (%s).",
+		"status.summary_anon":  "An eBay account is linked (%s), but it could not be identified.",
+		"status.expires":       "The token expires at %s.",
+		"scope.insufficient":   "The linked eBay account did not grant a scope needed for %s %s. Re-link the account with one of: %s",
+		"ratelimit.exceeded":   "Rate limit exceeded",
+		"concurrency.exceeded": "Too many calls in progress for this account, retry shortly",
+		"vault.invalid":        "Invalid or expired linked account",
+		"backend.unavailable":  "No backend is available to check the access token, try again shortly",
+		"backend.unlinked":     "No eBay account is linked to this account in %s",
+		"promotion.invalid":    "eBay would reject this promotion: %s",
+		"schema.invalid":       "The request body doesn't match eBay's schema: %s",
+
+		"hint.invalid_token":      "The eBay access token is invalid or has expired. Ask the user to link their eBay account again.",
+		"hint.missing_scope":      "The linked eBay account did not grant the permission this call needs. Ask the user to link the account again and grant it; get_connection_status lists the granted scopes.",
+		"hint.rate_limited":       "eBay's call limit for this operation is used up. Wait before retrying; get_connection_status shows the remaining quota.",
+		"hint.system_error":       "eBay failed internally; the request was not at fault. Retry the same call in a little while.",
+		"hint.invalid_category":   "The category ID is not a leaf category of this marketplace. Call get_category_suggestions with a short description of the item to find one.",
+		"hint.fulfillment_policy": "The offer has no valid fulfillment (shipping) policy. Call getFulfillmentPolicies to pick one of this marketplace, or createFulfillmentPolicy first, and set its ID as listingPolicies.fulfillmentPolicyId.",
+		"hint.payment_policy":     "The offer has no valid payment policy. Call getPaymentPolicies to pick one of this marketplace, or createPaymentPolicy first, and set its ID as listingPolicies.paymentPolicyId.",
+		"hint.return_policy":      "The offer has no valid return policy. Call getReturnPolicies to pick one of this marketplace, or createReturnPolicy first, and set its ID as listingPolicies.returnPolicyId.",
+		"hint.inventory_location": "The offer has no valid inventory location. Call createInventoryLocation first and set its key as merchantLocationKey.",
+		"hint.missing_field":      "A required field is missing: %s. Add it and retry.",
+		"hint.incomplete_account": "The seller's eBay account is not set up for selling yet, e.g. it lacks a payment method or address. The user has to complete it on eBay; getPrivileges shows the status.",
+		"hint.invalid_condition":  "The item condition is not allowed in this category. Call getItemConditionPolicies for the category's conditions.",
+		"hint.selling_limit":      "The seller has reached their eBay selling limit; getPrivileges shows it. The user has to ask eBay to raise it.",
+		"hint.unknown_sku":        "No inventory item has this SKU. Call createOrReplaceInventoryItem first.",
+		"hint.not_found":          "eBay has nothing with this ID. Check the ID, e.g. by listing the resources first.",
+	},
+	"de": {
+		"status.no_token":      "Kein eBay-Konto verknüpft: Die Anfrage enthielt kein Bearer-Token",
+		"status.restart_note":  "Das Token wurde vor dem letzten Neustart ausgestellt; die Scopes sind die konfigurierten Standardwerte, der Ablauf ist unbekannt",
+		"status.summary":       "Verknüpft mit dem eBay-Konto %s (%s).",
+		"status.summary_anon":  "Ein eBay-Konto ist verknüpft (%s), konnte aber nicht identifiziert werden.",
+		"status.expires":       "Das Token läuft am %s ab.",
+		"scope.insufficient":   "Das verknüpfte eBay-Konto hat keinen für %s %s nötigen Scope gewährt. Verknüpfen Sie das Konto erneut mit einem von: %s",
+		"ratelimit.exceeded":   "Anfragelimit überschritten",
+		"concurrency.exceeded": "Zu viele laufende Aufrufe für dieses Konto, bitte gleich erneut versuchen",
+		"vault.invalid":        "Ungültiges oder abgelaufenes verknüpftes Konto",
+		"backend.unavailable":  "Kein Backend erreichbar, um das Zugriffstoken zu prüfen; bitte gleich erneut versuchen",
+		"backend.unlinked":     "Mit diesem Konto ist in %s kein eBay-Konto verknüpft",
+		"promotion.invalid":    "eBay würde diese Aktion ablehnen: %s",
+		"schema.invalid":       "Der Request-Body entspricht nicht dem Schema von eBay: %s",
+	},
+	"fr": {
+		"status.no_token":      "Aucun compte eBay n'est associé : la requête ne contenait pas de jeton bearer",
+		"status.restart_note":  "Le jeton a été émis avant le dernier redémarrage ; les scopes sont ceux configurés par défaut et l'expiration est inconnue",
+		"status.summary":       "Associé au compte eBay %s (%s).",
+		"status.summary_anon":  "Un compte eBay est associé (%s), mais il n'a pas pu être identifié.",
+		"status.expires":       "Le jeton expire le %s.",
+		"scope.insufficient":   "Le compte eBay associé n'a pas accordé de scope nécessaire pour %s %s. Associez à nouveau le compte avec l'un de : %s",
+		"ratelimit.exceeded":   "Limite de requêtes dépassée",
+		"concurrency.exceeded": "Trop d'appels en cours pour ce compte, réessayez dans un instant",
+		"vault.invalid":        "Compte associé invalide ou expiré",
+		"backend.unavailable":  "Aucun backend n'est disponible pour vérifier le jeton d'accès, réessayez dans un instant",
+		"backend.unlinked":     "Aucun compte eBay n'est associé à ce compte dans %s",
+		"promotion.invalid":    "eBay refuserait cette promotion : %s",
+		"schema.invalid":       "Le corps de la requête ne respecte pas le schéma d'eBay : %s",
+	},
+	"es": {
+		"status.no_token":      "No hay ninguna cuenta de eBay vinculada: la solicitud no incluía un token bearer",
+		"status.restart_note":  "El token se emitió antes del último reinicio; los scopes son los predeterminados y se desconoce la caducidad",
+		"status.summary":       "Vinculado a la cuenta de eBay %s (%s).",
+		"status.summary_anon":  "Hay una cuenta de eBay vinculada (%s), pero no se pudo identificar.",
+		"status.expires":       "El token caduca el %s.",
+		"scope.insufficient":   "La cuenta de eBay vinculada no concedió un scope necesario para %s %s. Vuelva a vincular la cuenta con uno de: %s",
+		"ratelimit.exceeded":   "Límite de solicitudes superado",
+		"concurrency.exceeded": "Demasiadas llamadas en curso para esta cuenta, inténtelo de nuevo en breve",
+		"vault.invalid":        "Cuenta vinculada no válida o caducada",
+		"backend.unavailable":  "No hay ningún backend disponible para comprobar el token de acceso, inténtelo de nuevo en breve",
+		"backend.unlinked":     "No hay ninguna cuenta de eBay vinculada a esta cuenta en %s",
+		"promotion.invalid":    "eBay rechazaría esta promoción: %s",
+		"schema.invalid":       "El cuerpo de la solicitud no se ajusta al esquema de eBay: %s",
+	},
+	"it": {
+		"status.no_token":      "Nessun account eBay collegato: la richiesta non conteneva un token bearer",
+		"status.restart_note":  "Il token è stato emesso prima dell'ultimo riavvio; gli scope sono quelli predefiniti e la scadenza è sconosciuta",
+		"status.summary":       "Collegato all'account eBay %s (%s).",
+		"status.summary_anon":  "Un account eBay è collegato (%s), ma non è stato possibile identificarlo.",
+		"status.expires":       "Il token scade il %s.",
+		"scope.insufficient":   "L'account eBay collegato non ha concesso uno scope necessario per %s %s. Ricollega l'account con uno tra: %s",
+		"ratelimit.exceeded":   "Limite di richieste superato",
+		"concurrency.exceeded": "Troppe chiamate in corso per questo account, riprova tra poco",
+		"vault.invalid":        "Account collegato non valido o scaduto",
+		"backend.unavailable":  "Nessun backend disponibile per verificare il token di accesso, riprova tra poco",
+		"backend.unlinked":     "Nessun account eBay collegato a questo account in %s",
+		"promotion.invalid":    "eBay rifiuterebbe questa promozione: %s",
+		"schema.invalid":       "Il corpo della richiesta non rispetta lo schema di eBay: %s",
+	},
+}
+
+// localizer renders messages in one language.
+type localizer struct {
+	lang string
+}
+
+// T formats the message key with args.
+func (l localizer) T(key string, args ...interface{}) string {
+	format, ok := messageCatalogs[l.lang][key]
+	if !ok {
+		format = messageCatalogs[defaultLanguage][key]
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// setContentLanguage labels a localized response.
+func (l localizer) setContentLanguage(w http.ResponseWriter) {
+	w.Header().Set("Content-Language", l.lang)
+}
+
+// supportedLanguage returns the catalog language for a language tag such as
+// "de-AT", or "" if there is none.
+func supportedLanguage(tag string) string {
+	primary := strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(primary, "-_"); i >= 0 {
+		primary = primary[:i]
+	}
+	if _, ok := messageCatalogs[primary]; ok {
+		return primary
+	}
+	return ""
+}
+
+// localizerFor picks the language for a request from the account's
+// preference, Accept-Language and the account's marketplace.
+func localizerFor(r *http.Request, preferred, marketplace string) localizer {
+	if lang := supportedLanguage(preferred); lang != "" {
+		return localizer{lang}
+	}
+	for _, tag := range acceptedLanguages(r.Header.Get("Accept-Language")) {
+		if lang := supportedLanguage(tag); lang != "" {
+			return localizer{lang}
+		}
+	}
+	if lang := supportedLanguage(marketplaceLanguages[marketplace]); lang != "" {
+		return localizer{lang}
+	}
+	return localizer{defaultLanguage}
+}
+
+// acceptedLanguages parses an Accept-Language header into its language
+// tags, most preferred first. Tags with q=0 and the "*" wildcard are dropped.
+func acceptedLanguages(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if tag == "" || tag == "*" || q <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{tag, q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
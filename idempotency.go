@@ -0,0 +1,191 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ### Idempotency Keys #######################################################
+
+// ChatGPT retries tool calls that time out, and a retried createOffer or
+// createShippingFulfillment creates a second offer or fulfillment. A
+// proxied POST, PUT or PATCH carrying an Idempotency-Key header is run
+// once: its response is kept for the policy's idempotency.ttl (default
+// 24h) and replayed, with Idempotent-Replayed: true, to later requests with
+// the same key from the same caller. A retry arriving while the first call
+// is still running gets 409; a key reused for a different request gets 422.
+//
+// The first call runs to completion even if the client gives up on it, so
+// its response is there for the retry. Responses eBay fails with 5xx or 429
+// are not kept, so those can be retried.
+
+const (
+	idempotencyKeyHeader   = "Idempotency-Key"
+	maxIdempotencyKeyLen   = 255
+	defaultIdempotencyTTL  = 24 * time.Hour
+	idempotencyLockTTL     = 2 * time.Minute
+	idempotentCallTimeout  = time.Minute
+	idempotencyRetryAfter  = "1"
+	idempotencyReplayedHdr = "Idempotent-Replayed"
+)
+
+// IdempotencyPolicy configures how long responses to requests with an
+// Idempotency-Key are kept.
+type IdempotencyPolicy struct {
+	TTL time.Duration `yaml:"ttl,omitempty"`
+}
+
+func (p *IdempotencyPolicy) validate() []string {
+	if p.TTL < 0 {
+		return []string{"idempotency: ttl must not be negative"}
+	}
+	return nil
+}
+
+func (p *IdempotencyPolicy) ttl() time.Duration {
+	if p.TTL == 0 {
+		return defaultIdempotencyTTL
+	}
+	return p.TTL
+}
+
+var idempotencyCache = cacheNamespace{name: "idempotency"}
+
+// idempotentResponseHeaders are the response headers replayed for a key;
+// Location carries the IDs of some created resources.
+var idempotentResponseHeaders = append([]string{"Location"}, cachedResponseHeaders...)
+
+// idempotentResponse is the stored outcome of a request with a key.
+type idempotentResponse struct {
+	Fingerprint string         `json:"fingerprint"`
+	Response    cachedResponse `json:"response"`
+}
+
+// idempotentCall is a request with an Idempotency-Key that is going to eBay.
+type idempotentCall struct {
+	scope, key  string
+	fingerprint string
+	ttl         time.Duration
+}
+
+// beginIdempotentCall handles the Idempotency-Key of a proxied write. It
+// returns nil, false when it has answered the request (a replay or an
+// error), and nil, true when the request has no key or isn't a write.
+// Otherwise the caller must pass the returned call's store to the
+// response and call finish when done.
+func beginIdempotentCall(w http.ResponseWriter, r *http.Request, pol *Policy, callerToken, envKey, path string, rateState *rateLimitState, rule CompressionRule) (*idempotentCall, bool) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch) {
+		return nil, true
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		http.Error(w, fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLen), http.StatusBadRequest)
+		return nil, false
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			writeBodyTooLarge(w, requestBodyLimit(r.URL.Path))
+			return nil, false
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return nil, false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n%s\n%s\n", r.Method, path, r.URL.RawQuery)
+	sum.Write(body)
+	call := &idempotentCall{
+		scope:       tokenHash(callerToken),
+		key:         envKey + "\n" + key,
+		fingerprint: hex.EncodeToString(sum.Sum(nil)),
+		ttl:         pol.Idempotency.ttl(),
+	}
+
+	ctx := r.Context()
+	if data, ok := idempotencyCache.Get(ctx, call.scope, call.key); ok {
+		var stored idempotentResponse
+		if err := json.Unmarshal(data, &stored); err != nil {
+			log.Printf("Ignoring undecodable idempotent response: %v", err)
+		} else if stored.Fingerprint != call.fingerprint {
+			http.Error(w, idempotencyKeyHeader+" was already used for a different request", http.StatusUnprocessableEntity)
+			return nil, false
+		} else {
+			log.Printf("Replaying the response to %s %s for its %s", r.Method, path, idempotencyKeyHeader)
+			w.Header().Set(idempotencyReplayedHdr, "true")
+			if err := serveCachedResponse(w, r, &stored.Response, rateState, rule); err != nil {
+				log.Printf("Failed to write idempotent response: %v", err)
+			}
+			return nil, false
+		}
+	}
+	claimed, err := idempotencyCache.Claim(ctx, call.scope, "lock\n"+call.key, idempotencyLockTTL)
+	if err != nil {
+		w.Header().Set("Retry-After", idempotencyRetryAfter)
+		http.Error(w, "Can't lock the "+idempotencyKeyHeader+" right now", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	if !claimed {
+		w.Header().Set("Retry-After", idempotencyRetryAfter)
+		http.Error(w, "A request with this "+idempotencyKeyHeader+" is still in progress", http.StatusConflict)
+		return nil, false
+	}
+	return call, true
+}
+
+// detach returns r with a context that outlives the client, so the eBay
+// call completes and its response is stored for the client's retry.
+func (c *idempotentCall) detach(r *http.Request) (*http.Request, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), idempotentCallTimeout)
+	return r.WithContext(ctx), cancel
+}
+
+// store keeps eBay's response for the key, unless it is worth retrying or
+// too large to keep. The body is decoded in the process.
+func (c *idempotentCall) store(resp *http.Response) error {
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil
+	}
+	if err := decodeBody(resp); err != nil {
+		return err
+	}
+	body, err := peekBody(resp, maxCachedResponseSize+1)
+	if err != nil {
+		return err
+	}
+	if len(body) > maxCachedResponseSize {
+		log.Printf("Not keeping the response for an %s: larger than %d bytes", idempotencyKeyHeader, maxCachedResponseSize)
+		return nil
+	}
+
+	stored := idempotentResponse{
+		Fingerprint: c.fingerprint,
+		Response:    cachedResponse{Status: resp.StatusCode, Header: map[string]string{}, Body: body, StoredAt: time.Now().UTC()},
+	}
+	for _, name := range idempotentResponseHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			stored.Response.Header[name] = v
+		}
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	idempotencyCache.Set(resp.Request.Context(), c.scope, c.key, data, c.ttl)
+	return nil
+}
+
+// finish releases the key, letting retries through to the stored response
+// or, when none was stored, to eBay.
+func (c *idempotentCall) finish(ctx context.Context) {
+	idempotencyCache.Delete(context.WithoutCancel(ctx), c.scope, "lock\n"+c.key)
+}
@@ -0,0 +1,326 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // image.DecodeConfig formats
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ### Image Uploads ##########################################################
+
+// Listings need their photos hosted where eBay can fetch them, but an
+// assistant can only hand over a URL or base64 data. The local uploadImage
+// tool relays the image to eBay Picture Services through the Media API and
+// returns its EPS URL for an inventory item's imageUrls:
+//
+//	POST /images {"image_url": "https://example.com/front.jpg"}
+//	POST /images {"image_base64": "/9j/4AAQ...", "file_name": "front.jpg"}
+//	POST /images (multipart/form-data with an "image" file part)
+//
+// Every image is checked before it is sent: at most maxImageSize bytes, one
+// of the formats eBay hosts, and for JPEG, PNG and GIF at least
+// minImageEdge pixels on its longest side. Remote URLs are fetched by the
+// proxy itself, from public addresses only.
+
+const (
+	imagesPath        = "/images"
+	maxImageSize      = 12 << 20 // the Media API's limit
+	minImageEdge      = 500      // pixels on the longest side eBay requires
+	imageFetchTimeout = 30 * time.Second
+	imageUploadPath   = "/commerce/media/v1_beta/image/create_image_from_file"
+)
+
+// imageUploadBodyLimit caps requests to imagesPath: a maxImageSize image
+// in base64, and room for the rest of the JSON or multipart body.
+const imageUploadBodyLimit = maxImageSize/3*4 + 64<<10
+
+// imageFetchClient fetches remote images. Its dialer refuses private,
+// loopback and link-local addresses, so image_url can't reach the proxy's
+// own network.
+var imageFetchClient = &http.Client{
+	Timeout: imageFetchTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+					return fmt.Errorf("%s is not a public address", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: imageFetchTimeout,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+// isPublicIP reports whether ip is routable on the internet.
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// imageUpload is the JSON body of POST /images.
+type imageUpload struct {
+	ImageURL    string `json:"image_url"`
+	ImageBase64 string `json:"image_base64"`
+	FileName    string `json:"file_name"`
+}
+
+// imageError is an image that fails validation, or can't be read.
+type imageError struct{ msg string }
+
+func (e *imageError) Error() string { return e.msg }
+
+// handleImageUpload (uploadImage) uploads an image to EPS.
+// POST /images with a JSON or multipart/form-data body
+func handleImageUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := currentPolicy().AllowPath(http.MethodPost, imageUploadPath); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	caller, status, err := resolveCaller(w, r)
+	if err != nil {
+		log.Printf("Failed to resolve token for the image upload: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	ctx := r.Context()
+	data, name, source, err := readImageUpload(ctx, r)
+	if err != nil {
+		var ie *imageError
+		switch {
+		case isBodyTooLarge(err):
+			writeBodyTooLarge(w, imageUploadBodyLimit)
+		case errors.As(err, &ie):
+			http.Error(w, ie.msg, http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to read the image: "+err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	contentType, width, height, err := checkImage(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if exts, _ := mime.ExtensionsByType(contentType); filepath.Ext(name) == "" && len(exts) > 0 {
+		name += exts[0]
+	}
+
+	client := caller.client()
+	client.Host = apiHostFor(caller.env, imageUploadPath)
+	id, hosted, err := client.CreateImageFromFile(ctx, name, contentType, bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Uploading image %s failed: %v", name, err)
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	log.Printf("Uploaded image %s (%d bytes) to EPS as %s", name, len(data), id)
+	audit.Record("image.uploaded", map[string]string{
+		"image_id":   id,
+		"source":     source,
+		"size":       strconv.Itoa(len(data)),
+		"token_hash": tokenHash(caller.bearer),
+	})
+
+	resp := map[string]interface{}{
+		"image_id":     id,
+		"image_url":    hosted.ImageURL,
+		"content_type": contentType,
+		"size":         len(data),
+		"source":       source,
+		"next":         "Put image_url in the inventory item's product.imageUrls, or in createListing's image_urls.",
+	}
+	if hosted.ExpirationDate != "" {
+		resp["expiration_date"] = hosted.ExpirationDate
+	}
+	if width > 0 {
+		resp["width"], resp["height"] = width, height
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// readImageUpload returns the image of a request, its file name and where
+// it came from: "multipart", "base64" or "url".
+func readImageUpload(ctx context.Context, r *http.Request) ([]byte, string, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		file, header, err := r.FormFile("image")
+		if err != nil {
+			if isBodyTooLarge(err) {
+				return nil, "", "", err
+			}
+			return nil, "", "", &imageError{"the multipart body needs an \"image\" file part"}
+		}
+		defer file.Close()
+		data, err := readImage(file)
+		return data, filepath.Base(header.Filename), "multipart", err
+	}
+
+	var in imageUpload
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		if isBodyTooLarge(err) {
+			return nil, "", "", err
+		}
+		return nil, "", "", &imageError{"invalid JSON body: " + err.Error()}
+	}
+	switch {
+	case in.ImageURL != "" && in.ImageBase64 != "":
+		return nil, "", "", &imageError{"give image_url or image_base64, not both"}
+	case in.ImageBase64 != "":
+		encoded := in.ImageBase64
+		if i := strings.Index(encoded, ";base64,"); strings.HasPrefix(encoded, "data:") && i >= 0 {
+			encoded = encoded[i+len(";base64,"):]
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+		if err != nil {
+			return nil, "", "", &imageError{"image_base64 is not valid base64"}
+		}
+		if len(data) > maxImageSize {
+			return nil, "", "", imageTooLarge()
+		}
+		return data, imageFileName(in.FileName, "image"), "base64", nil
+	case in.ImageURL != "":
+		data, err := fetchImage(ctx, in.ImageURL)
+		if err != nil {
+			return nil, "", "", err
+		}
+		name := in.FileName
+		if u, err := url.Parse(in.ImageURL); err == nil && name == "" {
+			name = filepath.Base(u.Path)
+		}
+		return data, imageFileName(name, "image"), "url", nil
+	default:
+		return nil, "", "", &imageError{"image_url or image_base64 is required"}
+	}
+}
+
+// fetchImage downloads a remote image.
+func fetchImage(ctx context.Context, imageURL string) ([]byte, error) {
+	u, err := url.Parse(imageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, &imageError{"image_url must be an http or https URL"}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, &imageError{"image_url is invalid: " + err.Error()}
+	}
+	req.Header.Set("Accept", "image/*")
+	resp, err := imageFetchClient.Do(req)
+	if err != nil {
+		return nil, &imageError{"failed to fetch image_url: " + err.Error()}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &imageError{fmt.Sprintf("fetching image_url returned status %d", resp.StatusCode)}
+	}
+	if resp.ContentLength > maxImageSize {
+		return nil, imageTooLarge()
+	}
+	return readImage(resp.Body)
+}
+
+// readImage reads an image of at most maxImageSize bytes.
+func readImage(r io.Reader) ([]byte, error) {
+	data, err := readLimited(r, maxImageSize)
+	if errors.Is(err, errResponseTooLarge) {
+		return nil, imageTooLarge()
+	}
+	return data, err
+}
+
+func imageTooLarge() error {
+	return &imageError{fmt.Sprintf("the image is larger than %d MB", maxImageSize>>20)}
+}
+
+// imageFileName returns the base name of name, or fallback.
+func imageFileName(name, fallback string) string {
+	name = filepath.Base(name)
+	if name == "" || name == "." || name == "/" {
+		return fallback
+	}
+	return name
+}
+
+// checkImage sniffs the format of data, which must be one eBay hosts, and
+// checks the size of the formats the standard library can read.
+func checkImage(data []byte) (contentType string, width, height int, err error) {
+	if len(data) == 0 {
+		return "", 0, 0, errors.New("the image is empty")
+	}
+	contentType = sniffImageType(data)
+	if contentType == "" {
+		return "", 0, 0, errors.New("unsupported image format: eBay hosts JPEG, PNG, GIF, BMP, TIFF, WEBP, HEIC and AVIF images")
+	}
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("the image is not a valid %s: %v", strings.TrimPrefix(contentType, "image/"), err)
+		}
+		if max(cfg.Width, cfg.Height) < minImageEdge {
+			return "", 0, 0, fmt.Errorf("the image is %dx%d pixels; eBay needs at least %d pixels on the longest side", cfg.Width, cfg.Height, minImageEdge)
+		}
+		return contentType, cfg.Width, cfg.Height, nil
+	}
+	return contentType, 0, 0, nil
+}
+
+// sniffImageType returns the media type of the image formats eBay hosts,
+// or "" for anything else.
+func sniffImageType(data []byte) string {
+	switch t := http.DetectContentType(data); t {
+	case "image/jpeg", "image/png", "image/gif", "image/bmp", "image/webp":
+		return t
+	}
+	if bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")) {
+		return "image/tiff"
+	}
+	// HEIC and AVIF are ISO base media files whose ftyp box names the brand
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		switch string(data[8:12]) {
+		case "heic", "heix", "heim", "heis", "mif1", "msf1":
+			return "image/heic"
+		case "avif", "avis":
+			return "image/avif"
+		}
+	}
+	return ""
+}
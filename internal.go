@@ -0,0 +1,490 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/signing"
+)
+
+// ### Backend Internal API ###################################################
+
+// When the proxy and the account backend run as separate services, the
+// proxy calls the backend's /internal API (BACKEND_URL). Every request is
+// signed with the first of INTERNAL_SIGNING_SECRETS, shared with the
+// backend, so nothing else on the network can make internal calls: the
+// signature (internal/signing) covers the method, the request URI, a timestamp (the backend
+// rejects anything more than 5 minutes off), a one-time nonce and the body.
+//
+// Through it the proxy accepts access tokens of the backend's OAuth server
+// as well as eBay's: it asks the backend whether such a token is active and
+// for which user, fetches the eBay account the user linked (the backend is
+// then the token vault) and reports the calls it made for them. Answers are
+// cached for BACKEND_CACHE_TTL; while the backend is unreachable, cached
+// answers up to BACKEND_STALE_TTL older still stand in, so a backend restart
+// doesn't interrupt callers already seen.
+
+const (
+	defaultBackendCacheTTL = 30 * time.Second
+	defaultBackendStaleTTL = 5 * time.Minute
+
+	// backendUsageInterval is how often call counts are reported.
+	backendUsageInterval = 30 * time.Second
+	// maxBackendUsageKeys bounds the counts kept while the backend is down.
+	maxBackendUsageKeys = 10000
+)
+
+var (
+	// errBackendUnavailable wraps failures to get any answer from the
+	// backend, which cached answers may paper over.
+	errBackendUnavailable = errors.New("backend unavailable")
+	errBackendNotFound    = errors.New("not found")
+
+	errBackendTokenInactive = errors.New("the access token is not active")
+	errNoLinkedAccount      = errors.New("no eBay account is linked")
+)
+
+// backendClient calls the backend's internal API.
+type backendClient struct {
+	baseURL  string
+	secret   string
+	http     *http.Client
+	cacheTTL time.Duration // how long answers are used without asking again
+	staleTTL time.Duration // how much longer they stand in for an unreachable backend
+
+	mu          sync.Mutex
+	credentials map[string]*backendCredential // by user ID and environment
+
+	usageMu sync.Mutex
+	usage   map[backendUsageKey]*backendUsageCounts
+}
+
+// backend is the internal API client, or nil when BACKEND_URL is unset.
+var backend *backendClient
+
+// backendClientFromEnv configures the client from BACKEND_URL and
+// INTERNAL_SIGNING_SECRETS.
+func backendClientFromEnv() (*backendClient, error) {
+	rawURL := os.Getenv("BACKEND_URL")
+	if rawURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid BACKEND_URL %q", rawURL)
+	}
+	secrets := splitList(os.Getenv("INTERNAL_SIGNING_SECRETS"))
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("BACKEND_URL requires INTERNAL_SIGNING_SECRETS")
+	}
+	b := &backendClient{
+		baseURL:     strings.TrimRight(u.String(), "/"),
+		secret:      secrets[0],
+		http:        &http.Client{Timeout: 10 * time.Second},
+		cacheTTL:    defaultBackendCacheTTL,
+		staleTTL:    defaultBackendStaleTTL,
+		credentials: make(map[string]*backendCredential),
+		usage:       make(map[backendUsageKey]*backendUsageCounts),
+	}
+	for name, ttl := range map[string]*time.Duration{"BACKEND_CACHE_TTL": &b.cacheTTL, "BACKEND_STALE_TTL": &b.staleTTL} {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*ttl = d
+		}
+	}
+	return b, nil
+}
+
+// do sends a signed request and decodes a JSON response into out.
+func (b *backendClient) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := signing.Sign(req, b.secret, body, time.Now()); err != nil {
+		return err
+	}
+
+	resp, err := b.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errBackendUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("backend %s %s: %d %s", method, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+		switch {
+		case resp.StatusCode >= 500:
+			return fmt.Errorf("%w: %v", errBackendUnavailable, err)
+		case resp.StatusCode == http.StatusNotFound:
+			return fmt.Errorf("%w: %v", errBackendNotFound, err)
+		}
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Policy fetches and validates the policy the backend stores as name.
+func (b *backendClient) Policy(ctx context.Context, name string) (*Policy, error) {
+	var stored struct {
+		Document string `json:"document"`
+	}
+	if err := b.do(ctx, http.MethodGet, "/internal/policies/"+url.PathEscape(name), nil, &stored); err != nil {
+		return nil, fmt.Errorf("failed to fetch policy %q: %w", name, err)
+	}
+	return parsePolicy([]byte(stored.Document))
+}
+
+// isEbayToken reports whether a bearer token looks like one eBay issued
+// ("v^1.1#i^1#..."); anything else may be one of the backend's.
+func isEbayToken(token string) bool {
+	return strings.HasPrefix(token, "v^1.")
+}
+
+// ### Tokens ###
+
+// backendToken is the backend's answer about one of its access tokens.
+type backendToken struct {
+	Active    bool      `json:"active"`
+	UserID    *uint     `json:"user_id"` // nil for client_credentials tokens
+	ClientID  string    `json:"client_id"`
+	Scope     string    `json:"scope"`
+	Audience  string    `json:"aud"` // resource the token is for, "" for any
+	ExpiresAt time.Time `json:"expires_at"`
+	CheckedAt time.Time `json:"checked_at"` // when the backend gave the answer
+}
+
+// Introspect asks the backend about an access token, caching the answer in
+// backendCache.
+func (b *backendClient) Introspect(ctx context.Context, token string) (*backendToken, error) {
+	var cached *backendToken
+	if data, ok := backendCache.Get(ctx, "introspect", token); ok {
+		var t backendToken
+		if json.Unmarshal(data, &t) == nil {
+			if time.Since(t.CheckedAt) < b.cacheTTL {
+				return &t, nil
+			}
+			cached = &t
+		}
+	}
+
+	body, err := json.Marshal(map[string]string{"token": token})
+	if err != nil {
+		return nil, err
+	}
+	var t backendToken
+	if err := b.do(ctx, http.MethodPost, "/internal/tokens/introspect", body, &t); err != nil {
+		if cached != nil && errors.Is(err, errBackendUnavailable) {
+			log.Printf("Using the token check from %s: %v", cached.CheckedAt.Format(time.RFC3339), err)
+			return cached, nil
+		}
+		return nil, err
+	}
+	t.CheckedAt = time.Now()
+
+	// Kept past cacheTTL to stand in for an unreachable backend, but never
+	// past the token's expiry
+	ttl := b.cacheTTL + b.staleTTL
+	if t.Active && time.Until(t.ExpiresAt) < ttl {
+		ttl = time.Until(t.ExpiresAt)
+	}
+	if data, err := json.Marshal(t); err == nil && ttl > 0 {
+		backendCache.Set(ctx, "introspect", token, data, ttl)
+	}
+	return &t, nil
+}
+
+// ### Linked Accounts ###
+
+// backendCredential is a linked eBay account fetched from the backend. It
+// holds a refresh token, so it is only cached in process.
+type backendCredential struct {
+	entry     *vaultEntry
+	fetchedAt time.Time
+}
+
+func backendCredentialKey(userID uint, environment string) string {
+	return strconv.FormatUint(uint64(userID), 10) + "/" + environment
+}
+
+// EbayCredential returns the eBay account the user linked in environment,
+// or errNoLinkedAccount.
+func (b *backendClient) EbayCredential(ctx context.Context, userID uint, environment string) (*vaultEntry, error) {
+	key := backendCredentialKey(userID, environment)
+	b.mu.Lock()
+	cached := b.credentials[key]
+	b.mu.Unlock()
+	if cached != nil && time.Since(cached.fetchedAt) < b.cacheTTL {
+		return cached.entry, nil
+	}
+
+	entry := &vaultEntry{}
+	path := fmt.Sprintf("/internal/users/%d/ebay-credentials/%s", userID, url.PathEscape(environment))
+	if err := b.do(ctx, http.MethodGet, path, nil, entry); err != nil {
+		if cached != nil && errors.Is(err, errBackendUnavailable) && time.Since(cached.fetchedAt) < b.cacheTTL+b.staleTTL {
+			log.Printf("Using the linked account fetched at %s: %v", cached.fetchedAt.Format(time.RFC3339), err)
+			return cached.entry, nil
+		}
+		if errors.Is(err, errBackendNotFound) {
+			b.forgetCredential(key)
+			return nil, errNoLinkedAccount
+		}
+		return nil, err
+	}
+
+	// Keep using the access token minted from an unchanged refresh token
+	if cached != nil && cached.entry.RefreshToken == entry.RefreshToken {
+		cached.entry.mu.Lock()
+		entry.accessToken, entry.expiresAt = cached.entry.accessToken, cached.entry.expiresAt
+		cached.entry.mu.Unlock()
+	}
+
+	now := time.Now()
+	b.mu.Lock()
+	for k, c := range b.credentials {
+		if now.Sub(c.fetchedAt) > b.cacheTTL+b.staleTTL {
+			delete(b.credentials, k)
+		}
+	}
+	b.credentials[key] = &backendCredential{entry: entry, fetchedAt: now}
+	b.mu.Unlock()
+	return entry, nil
+}
+
+func (b *backendClient) forgetCredential(key string) {
+	b.mu.Lock()
+	delete(b.credentials, key)
+	b.mu.Unlock()
+}
+
+// PutEbayCredential links entry's eBay account to the user, replacing the
+// one linked in the same environment.
+func (b *backendClient) PutEbayCredential(ctx context.Context, userID uint, entry *vaultEntry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/internal/users/%d/ebay-credentials/%s", userID, url.PathEscape(entry.environmentName()))
+	if err := b.do(ctx, http.MethodPut, path, body, &struct{}{}); err != nil {
+		return err
+	}
+	b.forgetCredential(backendCredentialKey(userID, entry.environmentName()))
+	return nil
+}
+
+// DeleteEbayUser unlinks an eBay user (matched by immutable user ID, or by
+// username) from every backend user and returns how many links it removed.
+func (b *backendClient) DeleteEbayUser(ctx context.Context, ebayUserID, username string) (int, error) {
+	q := url.Values{}
+	if ebayUserID != "" {
+		q.Set("ebay_user_id", ebayUserID)
+	}
+	if username != "" {
+		q.Set("ebay_username", username)
+	}
+	var result struct {
+		Deleted int `json:"deleted"`
+	}
+	if err := b.do(ctx, http.MethodDelete, "/internal/ebay-credentials?"+q.Encode(), nil, &result); err != nil {
+		return 0, err
+	}
+
+	// The process cache would keep using the account until it goes stale
+	b.mu.Lock()
+	for k, c := range b.credentials {
+		if (ebayUserID != "" && c.entry.EbayUserID == ebayUserID) || (username != "" && c.entry.EbayUsername == username) {
+			delete(b.credentials, k)
+		}
+	}
+	b.mu.Unlock()
+	return result.Deleted, nil
+}
+
+// AccessToken resolves an access token of the backend to a valid eBay
+// access token of the account its user linked in environment, minting one
+// from the stored refresh token when needed. It also returns the linked
+// account and the backend's answer about the token.
+func (b *backendClient) AccessToken(ctx context.Context, token, environment string) (string, *vaultEntry, *backendToken, error) {
+	identity, err := b.Introspect(ctx, token)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if !identity.Active {
+		return "", nil, nil, errBackendTokenInactive
+	}
+	if identity.UserID == nil {
+		return "", nil, nil, errNoLinkedAccount
+	}
+
+	entry, err := b.EbayCredential(ctx, *identity.UserID, environment)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	env := entry.environment()
+	if env == nil {
+		return "", nil, nil, fmt.Errorf("linked account belongs to unconfigured environment %q", entry.Environment)
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.accessToken == "" || time.Until(entry.expiresAt) <= accessTokenRefreshMargin {
+		minted, err := mintAccessToken(ctx, env, entry.RefreshToken)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		entry.accessToken = minted.AccessToken
+		entry.expiresAt = time.Now().Add(time.Duration(minted.ExpiresIn) * time.Second)
+	}
+	return entry.accessToken, entry, identity, nil
+}
+
+// ### Usage ###
+
+// backendUsageKey identifies a usage record of the backend.
+type backendUsageKey struct {
+	UserID    uint
+	ClientID  string
+	Day       string // 2006-01-02, UTC
+	Operation string
+}
+
+type backendUsageCounts struct {
+	Calls  int64
+	Errors int64
+}
+
+// RecordUsage counts a call made for identity; counts are reported in
+// batches by reportUsage.
+func (b *backendClient) RecordUsage(identity *backendToken, operation string, status int, now time.Time) {
+	key := backendUsageKey{ClientID: identity.ClientID, Day: now.UTC().Format("2006-01-02"), Operation: operation}
+	if identity.UserID != nil {
+		key.UserID = *identity.UserID
+	}
+
+	b.usageMu.Lock()
+	defer b.usageMu.Unlock()
+	counts := b.usage[key]
+	if counts == nil {
+		if len(b.usage) >= maxBackendUsageKeys {
+			return
+		}
+		counts = &backendUsageCounts{}
+		b.usage[key] = counts
+	}
+	counts.Calls++
+	if status >= 400 {
+		counts.Errors++
+	}
+}
+
+// FlushUsage reports the counts gathered so far. Counts the backend didn't
+// take are kept for the next report.
+func (b *backendClient) FlushUsage(ctx context.Context) error {
+	b.usageMu.Lock()
+	pending := b.usage
+	b.usage = make(map[backendUsageKey]*backendUsageCounts)
+	b.usageMu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	type record struct {
+		UserID    uint   `json:"user_id"`
+		ClientID  string `json:"client_id"`
+		Day       string `json:"day"`
+		Operation string `json:"operation"`
+		Calls     int64  `json:"calls"`
+		Errors    int64  `json:"errors"`
+	}
+	records := make([]record, 0, len(pending))
+	for k, c := range pending {
+		records = append(records, record{k.UserID, k.ClientID, k.Day, k.Operation, c.Calls, c.Errors})
+	}
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return err
+	}
+	if err := b.do(ctx, http.MethodPost, "/internal/usage", body, &struct{}{}); err != nil {
+		b.usageMu.Lock()
+		for k, c := range pending {
+			if counts := b.usage[k]; counts != nil {
+				counts.Calls += c.Calls
+				counts.Errors += c.Errors
+			} else if len(b.usage) < maxBackendUsageKeys {
+				b.usage[k] = c
+			}
+		}
+		b.usageMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// reportUsage flushes the counts every backendUsageInterval until ctx is
+// done.
+func (b *backendClient) reportUsage(ctx context.Context) {
+	ticker := time.NewTicker(backendUsageInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		flushCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		if err := b.FlushUsage(flushCtx); err != nil {
+			log.Printf("Failed to report usage to the backend: %v", err)
+		}
+		cancel()
+	}
+}
+
+// Spent returns what account spent on day in currency, in cents.
+func (b *backendClient) Spent(ctx context.Context, account, day, currency string) (int64, error) {
+	q := url.Values{"account": {account}, "day": {day}, "currency": {currency}}
+	var result struct {
+		Spent int64 `json:"spent"`
+	}
+	if err := b.do(ctx, http.MethodGet, "/internal/spend?"+q.Encode(), nil, &result); err != nil {
+		return 0, err
+	}
+	return result.Spent, nil
+}
+
+// RecordSpend adds amount cents to what account spent on day unless the
+// total would exceed limit, or takes -amount back when amount is negative.
+// It returns the total and whether the amount was added.
+func (b *backendClient) RecordSpend(ctx context.Context, account, day, currency string, amount, limit int64) (int64, bool, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"account": account, "day": day, "currency": currency, "amount": amount, "limit": limit,
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	var result struct {
+		Spent    int64 `json:"spent"`
+		Reserved bool  `json:"reserved"`
+	}
+	if err := b.do(ctx, http.MethodPost, "/internal/spend", body, &result); err != nil {
+		return 0, false, err
+	}
+	return result.Spent, result.Reserved, nil
+}
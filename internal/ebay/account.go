@@ -0,0 +1,198 @@
+package ebay
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ### Account API ###
+
+const accountPath = "/sell/account/v1"
+
+// CategoryType is the kind of listings a business policy applies to.
+type CategoryType struct {
+	Name    string `json:"name"` // ALL_EXCLUDING_MOTORS_VEHICLES or MOTORS_VEHICLES
+	Default bool   `json:"default,omitempty"`
+}
+
+// FulfillmentPolicy says how the seller ships.
+type FulfillmentPolicy struct {
+	FulfillmentPolicyID string           `json:"fulfillmentPolicyId,omitempty"`
+	Name                string           `json:"name"`
+	Description         string           `json:"description,omitempty"`
+	MarketplaceID       string           `json:"marketplaceId"`
+	CategoryTypes       []CategoryType   `json:"categoryTypes"`
+	HandlingTime        *TimeDuration    `json:"handlingTime,omitempty"`
+	LocalPickup         bool             `json:"localPickup,omitempty"`
+	FreightShipping     bool             `json:"freightShipping,omitempty"`
+	ShippingOptions     []ShippingOption `json:"shippingOptions,omitempty"`
+}
+
+// ShippingOption is the domestic or international shipping of a
+// fulfillment policy.
+type ShippingOption struct {
+	CostType         string            `json:"costType"`   // FLAT_RATE, CALCULATED or NOT_SPECIFIED
+	OptionType       string            `json:"optionType"` // DOMESTIC or INTERNATIONAL
+	ShippingServices []ShippingService `json:"shippingServices,omitempty"`
+}
+
+// ShippingService is a shipping service buyers may choose, e.g.
+// USPSPriority.
+type ShippingService struct {
+	ShippingCarrierCode string  `json:"shippingCarrierCode,omitempty"`
+	ShippingServiceCode string  `json:"shippingServiceCode"`
+	ShippingCost        *Amount `json:"shippingCost,omitempty"`
+	FreeShipping        bool    `json:"freeShipping,omitempty"`
+	SortOrder           int     `json:"sortOrder,omitempty"`
+}
+
+// PaymentPolicy says how buyers pay.
+type PaymentPolicy struct {
+	PaymentPolicyID     string         `json:"paymentPolicyId,omitempty"`
+	Name                string         `json:"name"`
+	Description         string         `json:"description,omitempty"`
+	MarketplaceID       string         `json:"marketplaceId"`
+	CategoryTypes       []CategoryType `json:"categoryTypes"`
+	ImmediatePay        bool           `json:"immediatePay,omitempty"`
+	PaymentInstructions string         `json:"paymentInstructions,omitempty"`
+}
+
+// ReturnPolicy says whether and how buyers may return items.
+type ReturnPolicy struct {
+	ReturnPolicyID          string         `json:"returnPolicyId,omitempty"`
+	Name                    string         `json:"name"`
+	Description             string         `json:"description,omitempty"`
+	MarketplaceID           string         `json:"marketplaceId"`
+	CategoryTypes           []CategoryType `json:"categoryTypes"`
+	ReturnsAccepted         bool           `json:"returnsAccepted"`
+	ReturnPeriod            *TimeDuration  `json:"returnPeriod,omitempty"`
+	ReturnShippingCostPayer string         `json:"returnShippingCostPayer,omitempty"` // BUYER or SELLER
+	RefundMethod            string         `json:"refundMethod,omitempty"`
+}
+
+// TimeDuration is a period as the Account API states it, e.g. 30 DAY.
+type TimeDuration struct {
+	Value int    `json:"value"`
+	Unit  string `json:"unit"` // e.g. DAY or BUSINESS_DAY
+}
+
+// Privileges are what the seller may sell.
+type Privileges struct {
+	SellerRegistrationCompleted bool `json:"sellerRegistrationCompleted"`
+	SellingLimit                *struct {
+		Amount   *Amount `json:"amount,omitempty"`
+		Quantity int     `json:"quantity,omitempty"`
+	} `json:"sellingLimit,omitempty"`
+}
+
+// Program is a seller program, e.g. SELLING_POLICY_MANAGEMENT, which
+// business policies need.
+type Program struct {
+	ProgramType string `json:"programType"`
+}
+
+// GetFulfillmentPolicies returns the seller's fulfillment policies on the
+// client's marketplace.
+func (c *Client) GetFulfillmentPolicies(ctx context.Context) ([]FulfillmentPolicy, error) {
+	var out struct {
+		FulfillmentPolicies []FulfillmentPolicy `json:"fulfillmentPolicies"`
+	}
+	if err := c.Get(ctx, accountPath+"/fulfillment_policy", c.marketplaceQuery(), &out); err != nil {
+		return nil, err
+	}
+	return out.FulfillmentPolicies, nil
+}
+
+// GetPaymentPolicies returns the seller's payment policies on the client's
+// marketplace.
+func (c *Client) GetPaymentPolicies(ctx context.Context) ([]PaymentPolicy, error) {
+	var out struct {
+		PaymentPolicies []PaymentPolicy `json:"paymentPolicies"`
+	}
+	if err := c.Get(ctx, accountPath+"/payment_policy", c.marketplaceQuery(), &out); err != nil {
+		return nil, err
+	}
+	return out.PaymentPolicies, nil
+}
+
+// GetReturnPolicies returns the seller's return policies on the client's
+// marketplace.
+func (c *Client) GetReturnPolicies(ctx context.Context) ([]ReturnPolicy, error) {
+	var out struct {
+		ReturnPolicies []ReturnPolicy `json:"returnPolicies"`
+	}
+	if err := c.Get(ctx, accountPath+"/return_policy", c.marketplaceQuery(), &out); err != nil {
+		return nil, err
+	}
+	return out.ReturnPolicies, nil
+}
+
+// CreateFulfillmentPolicy creates a fulfillment policy and returns its ID.
+func (c *Client) CreateFulfillmentPolicy(ctx context.Context, p *FulfillmentPolicy) (string, error) {
+	var out FulfillmentPolicy
+	if _, err := c.Do(ctx, http.MethodPost, accountPath+"/fulfillment_policy", nil, p, &out); err != nil {
+		return "", err
+	}
+	return out.FulfillmentPolicyID, nil
+}
+
+// CreatePaymentPolicy creates a payment policy and returns its ID.
+func (c *Client) CreatePaymentPolicy(ctx context.Context, p *PaymentPolicy) (string, error) {
+	var out PaymentPolicy
+	if _, err := c.Do(ctx, http.MethodPost, accountPath+"/payment_policy", nil, p, &out); err != nil {
+		return "", err
+	}
+	return out.PaymentPolicyID, nil
+}
+
+// CreateReturnPolicy creates a return policy and returns its ID.
+func (c *Client) CreateReturnPolicy(ctx context.Context, p *ReturnPolicy) (string, error) {
+	var out ReturnPolicy
+	if _, err := c.Do(ctx, http.MethodPost, accountPath+"/return_policy", nil, p, &out); err != nil {
+		return "", err
+	}
+	return out.ReturnPolicyID, nil
+}
+
+// GetPrivileges returns the seller's registration status and selling limit.
+func (c *Client) GetPrivileges(ctx context.Context) (*Privileges, error) {
+	var out Privileges
+	if err := c.Get(ctx, accountPath+"/privilege", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetOptedInPrograms returns the seller programs the seller joined.
+func (c *Client) GetOptedInPrograms(ctx context.Context) ([]Program, error) {
+	var out struct {
+		Programs []Program `json:"programs"`
+	}
+	if err := c.Get(ctx, accountPath+"/program/get_opted_in_programs", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Programs, nil
+}
+
+// OptInToProgram joins the seller program programType. eBay may take a
+// while to process it.
+func (c *Client) OptInToProgram(ctx context.Context, programType string) error {
+	_, err := c.Do(ctx, http.MethodPost, accountPath+"/program/opt_in", nil, Program{ProgramType: programType}, nil)
+	return err
+}
+
+// marketplaceQuery is the marketplace_id parameter the policy lists take,
+// defaulting to EBAY_US like eBay's header.
+func (c *Client) marketplaceQuery() url.Values {
+	q := url.Values{}
+	q.Set("marketplace_id", c.marketplaceID())
+	return q
+}
+
+func (c *Client) marketplaceID() string {
+	if c.Marketplace == "" {
+		return "EBAY_US"
+	}
+	return c.Marketplace
+}
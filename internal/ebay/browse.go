@@ -0,0 +1,130 @@
+package ebay
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// ### Browse API ###
+
+const browsePath = "/buy/browse/v1"
+
+// SearchParams are the parameters of SearchItems. Query or CategoryIDs is
+// required.
+type SearchParams struct {
+	Query       string
+	CategoryIDs []string
+	Filter      []string // e.g. "buyingOptions:{FIXED_PRICE}", "price:[10..50]"
+	Sort        string   // e.g. "price" or "-price"; best match when empty
+	Limit       int      // at most 200
+	Offset      int
+}
+
+// SearchResult is a page of SearchItems.
+type SearchResult struct {
+	Page
+	ItemSummaries []ItemSummary `json:"itemSummaries"`
+}
+
+// ItemSummary is a listing as searches return it.
+type ItemSummary struct {
+	ItemID        string   `json:"itemId"`
+	LegacyItemID  string   `json:"legacyItemId,omitempty"`
+	Title         string   `json:"title"`
+	Price         Amount   `json:"price"`
+	Condition     string   `json:"condition,omitempty"`
+	ConditionID   string   `json:"conditionId,omitempty"`
+	BuyingOptions []string `json:"buyingOptions,omitempty"`
+	CurrentBid    *Amount  `json:"currentBidPrice,omitempty"` // auctions
+	BidCount      int      `json:"bidCount,omitempty"`
+	ItemEndDate   string   `json:"itemEndDate,omitempty"`
+	ItemWebURL    string   `json:"itemWebUrl,omitempty"`
+	Image         *Image   `json:"image,omitempty"`
+	Seller        *Seller  `json:"seller,omitempty"`
+	Categories    []struct {
+		CategoryID string `json:"categoryId"`
+	} `json:"categories,omitempty"`
+}
+
+// Image is a listing picture.
+type Image struct {
+	ImageURL string `json:"imageUrl"`
+}
+
+// Seller is the seller of a listing.
+type Seller struct {
+	Username           string `json:"username"`
+	FeedbackPercentage string `json:"feedbackPercentage,omitempty"`
+	FeedbackScore      int    `json:"feedbackScore,omitempty"`
+}
+
+// Item is a listing as GetItem returns it.
+type Item struct {
+	ItemSummary
+	Description             string            `json:"description,omitempty"`
+	ShortDescription        string            `json:"shortDescription,omitempty"`
+	CategoryID              string            `json:"categoryId,omitempty"`
+	CategoryPath            string            `json:"categoryPath,omitempty"`
+	Brand                   string            `json:"brand,omitempty"`
+	LocalizedAspects        []LocalizedAspect `json:"localizedAspects,omitempty"`
+	EnabledForGuestCheckout bool              `json:"enabledForGuestCheckout,omitempty"`
+	AdultOnly               bool              `json:"adultOnly,omitempty"`
+	EstimatedAvailabilities []struct {
+		AvailabilityThreshold       int    `json:"availabilityThreshold,omitempty"`
+		EstimatedAvailableQuantity  int    `json:"estimatedAvailableQuantity,omitempty"`
+		EstimatedAvailabilityStatus string `json:"estimatedAvailabilityStatus,omitempty"`
+	} `json:"estimatedAvailabilities,omitempty"`
+}
+
+// LocalizedAspect is an item specific of a listing, e.g. Brand: Apple.
+type LocalizedAspect struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SearchItems searches the marketplace's active listings.
+func (c *Client) SearchItems(ctx context.Context, p SearchParams) (*SearchResult, error) {
+	q := url.Values{}
+	if p.Query != "" {
+		q.Set("q", p.Query)
+	}
+	if len(p.CategoryIDs) > 0 {
+		q.Set("category_ids", strings.Join(p.CategoryIDs, ","))
+	}
+	if len(p.Filter) > 0 {
+		q.Set("filter", strings.Join(p.Filter, ","))
+	}
+	if p.Sort != "" {
+		q.Set("sort", p.Sort)
+	}
+	paging(q, p.Limit, p.Offset)
+
+	var out SearchResult
+	if err := c.Get(ctx, browsePath+"/item_summary/search", q, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetItem returns the listing with the RESTful itemId, e.g.
+// v1|110012345678|0.
+func (c *Client) GetItem(ctx context.Context, itemID string) (*Item, error) {
+	var out Item
+	if err := c.Get(ctx, browsePath+"/item/"+pathEscape(itemID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetItemByLegacyID returns the listing with the item number sellers and
+// the Trading API know it by.
+func (c *Client) GetItemByLegacyID(ctx context.Context, legacyItemID string) (*Item, error) {
+	q := url.Values{}
+	q.Set("legacy_item_id", legacyItemID)
+	var out Item
+	if err := c.Get(ctx, browsePath+"/item/get_item_by_legacy_id", q, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,104 @@
+package ebay
+
+import (
+	"context"
+	"net/http"
+)
+
+// ### Buy Offer and Order APIs ###
+
+const (
+	offerPath = "/buy/offer/v1_beta"
+	orderPath = "/buy/order/v2"
+)
+
+// ProxyBid is the highest amount eBay may bid on the buyer's behalf.
+type ProxyBid struct {
+	MaxAmount   Amount `json:"maxAmount"`
+	UserConsent struct {
+		AdultOnlyItem bool `json:"adultOnlyItem,omitempty"`
+	} `json:"userConsent"`
+}
+
+// Address is a shipping address.
+type Address struct {
+	Recipient       string `json:"recipient"`
+	PhoneNumber     string `json:"phoneNumber,omitempty"`
+	AddressLine1    string `json:"addressLine1"`
+	AddressLine2    string `json:"addressLine2,omitempty"`
+	City            string `json:"city"`
+	StateOrProvince string `json:"stateOrProvince,omitempty"`
+	PostalCode      string `json:"postalCode"`
+	Country         string `json:"country"` // e.g. US
+}
+
+// GuestCheckout is what InitiateGuestCheckoutSession needs to price an
+// order.
+type GuestCheckout struct {
+	ContactEmail     string          `json:"contactEmail"`
+	ContactFirstName string          `json:"contactFirstName,omitempty"`
+	ContactLastName  string          `json:"contactLastName,omitempty"`
+	LineItemInputs   []LineItemInput `json:"lineItemInputs"`
+	ShippingAddress  Address         `json:"shippingAddress"`
+}
+
+// LineItemInput is an item to buy and how many.
+type LineItemInput struct {
+	ItemID   string `json:"itemId"`
+	Quantity int    `json:"quantity"`
+}
+
+// CheckoutSession is a guest checkout eBay priced.
+type CheckoutSession struct {
+	CheckoutSessionID string `json:"checkoutSessionId"`
+	ExpirationDate    string `json:"expirationDate,omitempty"`
+	PricingSummary    struct {
+		Total             Amount  `json:"total"`
+		PriceSubtotal     *Amount `json:"priceSubtotal,omitempty"`
+		DeliveryCost      *Amount `json:"deliveryCost,omitempty"`
+		Tax               *Amount `json:"tax,omitempty"`
+		PriceDiscount     *Amount `json:"priceDiscount,omitempty"`
+		ImportCharges     *Amount `json:"importCharges,omitempty"`
+		AdditionalSavings *Amount `json:"additionalSavings,omitempty"`
+	} `json:"pricingSummary"`
+	Warnings []ErrorDetail `json:"warnings,omitempty"`
+}
+
+// PurchaseOrder is an order a guest checkout placed.
+type PurchaseOrder struct {
+	PurchaseOrderID            string        `json:"purchaseOrderId"`
+	PurchaseOrderPaymentStatus string        `json:"purchaseOrderPaymentStatus,omitempty"`
+	PurchaseOrderHref          string        `json:"purchaseOrderHref,omitempty"`
+	Warnings                   []ErrorDetail `json:"warnings,omitempty"`
+}
+
+// PlaceProxyBid bids on the auction itemID up to bid.MaxAmount and returns
+// the ID of the proxy bid.
+func (c *Client) PlaceProxyBid(ctx context.Context, itemID string, bid *ProxyBid) (string, error) {
+	var out struct {
+		ProxyBidID string `json:"proxyBidId"`
+	}
+	if _, err := c.Do(ctx, http.MethodPost, offerPath+"/bidding/"+pathEscape(itemID)+"/place_proxy_bid", nil, bid, &out); err != nil {
+		return "", err
+	}
+	return out.ProxyBidID, nil
+}
+
+// InitiateGuestCheckoutSession prices a guest checkout. Nothing is bought
+// until PlaceGuestOrder.
+func (c *Client) InitiateGuestCheckoutSession(ctx context.Context, checkout *GuestCheckout) (*CheckoutSession, error) {
+	var out CheckoutSession
+	if _, err := c.Do(ctx, http.MethodPost, orderPath+"/guest_checkout_session/initiate", nil, checkout, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PlaceGuestOrder buys what the checkout session holds.
+func (c *Client) PlaceGuestOrder(ctx context.Context, checkoutSessionID string) (*PurchaseOrder, error) {
+	var out PurchaseOrder
+	if _, err := c.Do(ctx, http.MethodPost, orderPath+"/guest_checkout_session/"+pathEscape(checkoutSessionID)+"/place_order", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,185 @@
+// Package ebay is a typed client of the eBay REST APIs the proxy's
+// convenience routes and MCP tools build on: Browse, Buy Offer and Order,
+// Marketplace Insights, Inventory, Fulfillment, Account, Taxonomy, Feed and
+// Media.
+//
+// A Client calls one API host with one access token, for one marketplace:
+//
+//	c := &ebay.Client{Host: "api.ebay.com", Token: token, Marketplace: "EBAY_DE"}
+//	orders, err := c.GetOrders(ctx, ebay.OrderSearch{Limit: 50})
+//
+// Failed calls return an *Error holding the errors array of eBay's
+// response, so callers can tell e.g. a missing business policy from an
+// expired token without parsing messages.
+package ebay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MarketplaceHeader is the header naming the marketplace of a call.
+const MarketplaceHeader = "X-EBAY-C-MARKETPLACE-ID"
+
+// maxResponseSize bounds the responses the client reads.
+const maxResponseSize = 16 << 20
+
+// Client calls the eBay REST APIs. The zero value is not usable: Host and
+// Token are required. A Client may be used concurrently.
+type Client struct {
+	Host        string       // API host, e.g. api.ebay.com or api.sandbox.ebay.com
+	Token       string       // OAuth access token of the user or application
+	Marketplace string       // sent as X-EBAY-C-MARKETPLACE-ID, e.g. EBAY_US; eBay's default when empty
+	Language    string       // sent as Accept-Language and Content-Language, e.g. en-US; optional
+	HTTPClient  *http.Client // http.DefaultClient when nil
+}
+
+// WithMarketplace returns a copy of c calling for marketplace.
+func (c *Client) WithMarketplace(marketplace string) *Client {
+	out := *c
+	out.Marketplace = marketplace
+	return &out
+}
+
+// Get calls GET path with query and decodes the JSON response into out.
+// It is the way to APIs the client has no typed methods for.
+func (c *Client) Get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	_, err := c.Do(ctx, http.MethodGet, path, query, nil, out)
+	return err
+}
+
+// Do calls method path with query and, unless in is nil, in as the JSON
+// body. A 2xx response is decoded into out unless out is nil or the
+// response has no body; other responses are returned as an *Error. The
+// response headers are returned for the calls that answer with a Location.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, in, out interface{}) (http.Header, error) {
+	resp, err := c.send(ctx, method, path, query, in)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxResponseSize {
+		return nil, fmt.Errorf("%s %s: response larger than %d bytes", method, path, maxResponseSize)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.Header, DecodeError(method+" "+path, resp.StatusCode, data)
+	}
+	if out != nil && len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.Header, fmt.Errorf("%s %s: failed to parse response: %w", method, path, err)
+		}
+	}
+	return resp.Header, nil
+}
+
+// open calls GET path with query and returns the body of a 2xx response
+// unread, for responses too large for Do. The caller closes it.
+func (c *Client) open(ctx context.Context, path string, query url.Values) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errorResponse("GET "+path, resp)
+	}
+	return resp.Body, nil
+}
+
+// errorResponse reads and closes a response that failed, and returns its
+// *Error.
+func errorResponse(call string, resp *http.Response) error {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	return DecodeError(call, resp.StatusCode, data)
+}
+
+// send makes the request of Do and open.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in interface{}) (*http.Response, error) {
+	if in == nil {
+		return c.sendBody(ctx, method, path, query, "", nil)
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendBody(ctx, method, path, query, "application/json", bytes.NewReader(data))
+}
+
+// sendBody makes a request with a body of contentType, which is streamed
+// rather than read first.
+func (c *Client) sendBody(ctx context.Context, method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	target := "https://" + c.Host + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Accept", "application/json")
+	if c.Marketplace != "" {
+		req.Header.Set(MarketplaceHeader, c.Marketplace)
+	}
+	if c.Language != "" {
+		req.Header.Set("Accept-Language", c.Language)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+		if c.Language != "" {
+			req.Header.Set("Content-Language", c.Language)
+		}
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// Page is the paging information of eBay's list responses.
+type Page struct {
+	Href   string `json:"href,omitempty"`
+	Next   string `json:"next,omitempty"`
+	Prev   string `json:"prev,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	Total  int    `json:"total"`
+}
+
+// Amount is a monetary value as eBay sends it: a decimal string and an ISO
+// 4217 currency code.
+type Amount struct {
+	Value    string `json:"value"`
+	Currency string `json:"currency"`
+}
+
+// pathEscape escapes an ID for use as a path segment.
+func pathEscape(id string) string {
+	return url.PathEscape(strings.TrimSpace(id))
+}
+
+// paging sets limit and offset on q when they are set.
+func paging(q url.Values, limit, offset int) {
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		q.Set("offset", strconv.Itoa(offset))
+	}
+}
@@ -0,0 +1,91 @@
+package ebay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrorDetail is one entry of the errors (or warnings) array of eBay's REST
+// responses.
+type ErrorDetail struct {
+	ErrorID     int              `json:"errorId"`
+	Domain      string           `json:"domain,omitempty"`
+	Subdomain   string           `json:"subdomain,omitempty"`
+	Category    string           `json:"category,omitempty"` // APPLICATION, BUSINESS or REQUEST
+	Message     string           `json:"message,omitempty"`
+	LongMessage string           `json:"longMessage,omitempty"`
+	InputRefIDs []string         `json:"inputRefIds,omitempty"`
+	Parameters  []ErrorParameter `json:"parameters,omitempty"`
+}
+
+// ErrorParameter is a value an ErrorDetail refers to, e.g. the field that
+// was missing.
+type ErrorParameter struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Error is a call eBay answered with a status other than 2xx.
+type Error struct {
+	Call       string // method and path, e.g. "GET /sell/fulfillment/v1/order"
+	StatusCode int
+	Errors     []ErrorDetail // empty when the body wasn't eBay's error document
+	Body       []byte        // the response body, when Errors is empty
+}
+
+// DecodeError returns the *Error of a response to call with status and
+// body.
+func DecodeError(call string, status int, body []byte) *Error {
+	e := &Error{Call: call, StatusCode: status}
+	var doc struct {
+		Errors []ErrorDetail `json:"errors"`
+	}
+	if json.Unmarshal(body, &doc) == nil && len(doc.Errors) > 0 {
+		e.Errors = doc.Errors
+	} else {
+		e.Body = body
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s returned status %d", e.Call, e.StatusCode)
+	for i, d := range e.Errors {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "%d %s", d.ErrorID, d.Message)
+	}
+	return b.String()
+}
+
+// Has reports whether eBay returned the error with ID id.
+func (e *Error) Has(id int) bool {
+	for _, d := range e.Errors {
+		if d.ErrorID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusCode returns the HTTP status of err if it is an *Error, and 0
+// otherwise.
+func StatusCode(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is eBay answering 404 Not Found.
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
@@ -0,0 +1,117 @@
+package ebay
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+)
+
+// ### Feed API ###
+
+const feedPath = "/sell/feed/v1"
+
+// TaskType is the Feed API resource a task was created with.
+type TaskType string
+
+const (
+	FeedTask      TaskType = "task"           // createTask: LMS uploads and order reports
+	InventoryTask TaskType = "inventory_task" // createInventoryTask: active inventory reports
+	OrderTask     TaskType = "order_task"     // createOrderTask: order reports
+)
+
+// Task is a Feed API task.
+type Task struct {
+	TaskID         string         `json:"taskId"`
+	Status         string         `json:"status"` // CREATED, QUEUED, IN_PROCESS, COMPLETED, COMPLETED_WITH_ERROR, FAILED or PARTIALLY_PROCESSED
+	FeedType       string         `json:"feedType"`
+	SchemaVersion  string         `json:"schemaVersion,omitempty"`
+	CreationDate   string         `json:"creationDate,omitempty"`
+	CompletionDate string         `json:"completionDate,omitempty"`
+	DetailHref     string         `json:"detailHref,omitempty"`
+	UploadSummary  *UploadSummary `json:"uploadSummary,omitempty"`
+}
+
+// UploadSummary counts the records of an upload feed eBay processed.
+type UploadSummary struct {
+	SuccessCount int `json:"successCount"`
+	FailureCount int `json:"failureCount"`
+}
+
+// File is a file the Feed API returned. Body streams from eBay; the caller
+// closes it.
+type File struct {
+	Name        string
+	ContentType string
+	Size        int64 // -1 when unknown
+	Body        io.ReadCloser
+}
+
+// GetTask returns the task taskID of type t.
+func (c *Client) GetTask(ctx context.Context, t TaskType, taskID string) (*Task, error) {
+	var out Task
+	if err := c.Get(ctx, feedPath+"/"+string(t)+"/"+pathEscape(taskID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetResultFile opens the result file of a finished task: the report of a
+// download feed or the processing results of an upload, usually gzipped
+// or zipped. The file is not read into memory, so the client's HTTPClient
+// should allow for a slow download.
+func (c *Client) GetResultFile(ctx context.Context, taskID string) (*File, error) {
+	path := feedPath + "/task/" + pathEscape(taskID) + "/download_result_file"
+	resp, err := c.sendBody(ctx, http.MethodGet, path, nil, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errorResponse("GET "+path, resp)
+	}
+	file := &File{Name: taskID, ContentType: resp.Header.Get("Content-Type"), Size: resp.ContentLength, Body: resp.Body}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		file.Name = filepath.Base(params["filename"])
+	}
+	return file, nil
+}
+
+// UploadFile uploads the input file of the upload task taskID, streaming
+// file into the multipart request eBay expects.
+func (c *Client) UploadFile(ctx context.Context, taskID, name string, file io.Reader) error {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		var err error
+		for _, field := range [][2]string{{"fileName", name}, {"name", "file"}, {"type", "form-data"}} {
+			if err == nil {
+				err = form.WriteField(field[0], field[1])
+			}
+		}
+		if err == nil {
+			var part io.Writer
+			if part, err = form.CreateFormFile("file", name); err == nil {
+				_, err = io.Copy(part, file)
+			}
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	path := feedPath + "/task/" + pathEscape(taskID) + "/upload_file"
+	resp, err := c.sendBody(ctx, http.MethodPost, path, nil, form.FormDataContentType(), pr)
+	// Unblock the writer if the request ended before reading all of it
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errorResponse("POST "+path, resp)
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,135 @@
+package ebay
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// ### Fulfillment API ###
+
+const fulfillmentPath = "/sell/fulfillment/v1"
+
+// OrderSearch are the parameters of GetOrders. With OrderIDs the others
+// except Limit are ignored.
+type OrderSearch struct {
+	OrderIDs []string // at most 50
+	Filter   string   // e.g. "orderfulfillmentstatus:{NOT_STARTED|IN_PROGRESS}"
+	Limit    int      // at most 200
+	Offset   int
+}
+
+// Orders is a page of GetOrders.
+type Orders struct {
+	Page
+	Orders   []Order       `json:"orders"`
+	Warnings []ErrorDetail `json:"warnings,omitempty"`
+}
+
+// Order is a buyer's order of the seller's items.
+type Order struct {
+	OrderID                string    `json:"orderId"`
+	LegacyOrderID          string    `json:"legacyOrderId,omitempty"`
+	CreationDate           time.Time `json:"creationDate"`
+	LastModifiedDate       time.Time `json:"lastModifiedDate"`
+	OrderFulfillmentStatus string    `json:"orderFulfillmentStatus"` // NOT_STARTED, IN_PROGRESS or FULFILLED
+	OrderPaymentStatus     string    `json:"orderPaymentStatus"`
+	Buyer                  struct {
+		Username string `json:"username"`
+	} `json:"buyer"`
+	PricingSummary struct {
+		PriceSubtotal Amount `json:"priceSubtotal"`
+		DeliveryCost  Amount `json:"deliveryCost"`
+		Total         Amount `json:"total"`
+	} `json:"pricingSummary"`
+	CancelStatus struct {
+		CancelState string `json:"cancelState"` // NONE_REQUESTED, IN_PROGRESS or CANCELED
+	} `json:"cancelStatus"`
+	LineItems                    []LineItem                    `json:"lineItems"`
+	FulfillmentStartInstructions []FulfillmentStartInstruction `json:"fulfillmentStartInstructions,omitempty"`
+	FulfillmentHrefs             []string                      `json:"fulfillmentHrefs,omitempty"`
+}
+
+// LineItem is one listing bought in an order.
+type LineItem struct {
+	LineItemID                string `json:"lineItemId"`
+	LegacyItemID              string `json:"legacyItemId,omitempty"`
+	SKU                       string `json:"sku,omitempty"`
+	Title                     string `json:"title"`
+	Quantity                  int    `json:"quantity"`
+	LineItemCost              Amount `json:"lineItemCost"`
+	LineItemFulfillmentStatus string `json:"lineItemFulfillmentStatus"`
+}
+
+// FulfillmentStartInstruction says how an order is to be delivered.
+type FulfillmentStartInstruction struct {
+	FulfillmentInstructionsType string `json:"fulfillmentInstructionsType,omitempty"`
+	ShippingStep                *struct {
+		ShippingCarrierCode string `json:"shippingCarrierCode,omitempty"`
+		ShippingServiceCode string `json:"shippingServiceCode,omitempty"`
+		ShipTo              struct {
+			FullName       string `json:"fullName,omitempty"`
+			ContactAddress struct {
+				AddressLine1    string `json:"addressLine1,omitempty"`
+				AddressLine2    string `json:"addressLine2,omitempty"`
+				City            string `json:"city,omitempty"`
+				StateOrProvince string `json:"stateOrProvince,omitempty"`
+				PostalCode      string `json:"postalCode,omitempty"`
+				CountryCode     string `json:"countryCode,omitempty"`
+			} `json:"contactAddress"`
+		} `json:"shipTo"`
+	} `json:"shippingStep,omitempty"`
+}
+
+// ShippingFulfillment marks line items of an order shipped.
+type ShippingFulfillment struct {
+	LineItems           []LineItemReference `json:"lineItems"`
+	ShippedDate         *time.Time          `json:"shippedDate,omitempty"` // now when nil
+	ShippingCarrierCode string              `json:"shippingCarrierCode,omitempty"`
+	TrackingNumber      string              `json:"trackingNumber,omitempty"`
+}
+
+// LineItemReference is a quantity of one line item.
+type LineItemReference struct {
+	LineItemID string `json:"lineItemId"`
+	Quantity   int    `json:"quantity"`
+}
+
+// GetOrders returns a page of the seller's orders, newest first.
+func (c *Client) GetOrders(ctx context.Context, s OrderSearch) (*Orders, error) {
+	q := url.Values{}
+	if len(s.OrderIDs) > 0 {
+		q.Set("orderIds", strings.Join(s.OrderIDs, ","))
+	} else if s.Filter != "" {
+		q.Set("filter", s.Filter)
+	}
+	paging(q, s.Limit, s.Offset)
+	var out Orders
+	if err := c.Get(ctx, fulfillmentPath+"/order", q, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetOrder returns the order with orderID.
+func (c *Client) GetOrder(ctx context.Context, orderID string) (*Order, error) {
+	var out Order
+	if err := c.Get(ctx, fulfillmentPath+"/order/"+pathEscape(orderID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateShippingFulfillment marks line items of the order shipped and
+// returns the ID of the fulfillment.
+func (c *Client) CreateShippingFulfillment(ctx context.Context, orderID string, f *ShippingFulfillment) (string, error) {
+	header, err := c.Do(ctx, http.MethodPost, fulfillmentPath+"/order/"+pathEscape(orderID)+"/shipping_fulfillment", nil, f, nil)
+	if err != nil {
+		return "", err
+	}
+	// eBay answers 201 with the fulfillment's URL in Location
+	return path.Base(header.Get("Location")), nil
+}
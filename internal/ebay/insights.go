@@ -0,0 +1,59 @@
+package ebay
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// ### Marketplace Insights API ###
+
+// The Marketplace Insights API is a limited release: only applications eBay
+// approved for the buy.marketplace.insights scope may call it, with an
+// application token.
+
+const insightsPath = "/buy/marketplace_insights/v1_beta"
+
+// ItemSalesResult is a page of SearchItemSales.
+type ItemSalesResult struct {
+	Page
+	ItemSales []ItemSale `json:"itemSales"`
+}
+
+// ItemSale is a listing that sold in the last 90 days.
+type ItemSale struct {
+	ItemID            string `json:"itemId"`
+	Title             string `json:"title"`
+	LastSoldDate      string `json:"lastSoldDate"`
+	LastSoldPrice     Amount `json:"lastSoldPrice"`
+	TotalSoldQuantity int    `json:"totalSoldQuantity"`
+	Condition         string `json:"condition,omitempty"`
+	ConditionID       string `json:"conditionId,omitempty"`
+	ItemWebURL        string `json:"itemWebUrl,omitempty"`
+}
+
+// SearchItemSales searches the sales of the last 90 days. The parameters
+// are those of SearchItems; Filter takes e.g.
+// "lastSoldDate:[2024-01-01T00:00:00Z..]".
+func (c *Client) SearchItemSales(ctx context.Context, p SearchParams) (*ItemSalesResult, error) {
+	q := url.Values{}
+	if p.Query != "" {
+		q.Set("q", p.Query)
+	}
+	if len(p.CategoryIDs) > 0 {
+		q.Set("category_ids", strings.Join(p.CategoryIDs, ","))
+	}
+	if len(p.Filter) > 0 {
+		q.Set("filter", strings.Join(p.Filter, ","))
+	}
+	if p.Sort != "" {
+		q.Set("sort", p.Sort)
+	}
+	paging(q, p.Limit, p.Offset)
+
+	var out ItemSalesResult
+	if err := c.Get(ctx, insightsPath+"/item_sales/search", q, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
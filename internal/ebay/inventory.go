@@ -0,0 +1,212 @@
+package ebay
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ### Inventory API ###
+
+const inventoryPath = "/sell/inventory/v1"
+
+// InventoryItem is a product in the seller's inventory, by SKU. Calls that
+// write it need Client.Language set, e.g. en-US.
+type InventoryItem struct {
+	SKU                  string        `json:"sku,omitempty"` // set by eBay in responses
+	Locale               string        `json:"locale,omitempty"`
+	Product              *Product      `json:"product,omitempty"`
+	Condition            string        `json:"condition,omitempty"` // e.g. NEW, USED_EXCELLENT
+	ConditionDescription string        `json:"conditionDescription,omitempty"`
+	Availability         *Availability `json:"availability,omitempty"`
+}
+
+// Product describes an inventory item.
+type Product struct {
+	Title       string              `json:"title,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Aspects     map[string][]string `json:"aspects,omitempty"`
+	Brand       string              `json:"brand,omitempty"`
+	MPN         string              `json:"mpn,omitempty"`
+	EAN         []string            `json:"ean,omitempty"`
+	UPC         []string            `json:"upc,omitempty"`
+	ISBN        []string            `json:"isbn,omitempty"`
+	ImageURLs   []string            `json:"imageUrls,omitempty"`
+}
+
+// Availability is how many of an item can be sold.
+type Availability struct {
+	ShipToLocationAvailability struct {
+		Quantity int `json:"quantity"`
+	} `json:"shipToLocationAvailability"`
+}
+
+// InventoryLocation is a place the seller ships from, by merchant location
+// key.
+type InventoryLocation struct {
+	MerchantLocationKey    string   `json:"merchantLocationKey,omitempty"` // set by eBay in responses
+	Name                   string   `json:"name,omitempty"`
+	Location               Location `json:"location"`
+	LocationTypes          []string `json:"locationTypes,omitempty"`          // e.g. WAREHOUSE or STORE
+	MerchantLocationStatus string   `json:"merchantLocationStatus,omitempty"` // ENABLED or DISABLED
+}
+
+// Location is the address of an inventory location. Country and either a
+// postal code or a city and state are required.
+type Location struct {
+	Address struct {
+		AddressLine1    string `json:"addressLine1,omitempty"`
+		City            string `json:"city,omitempty"`
+		StateOrProvince string `json:"stateOrProvince,omitempty"`
+		PostalCode      string `json:"postalCode,omitempty"`
+		Country         string `json:"country"`
+	} `json:"address"`
+}
+
+// InventoryItems is a page of GetInventoryItems.
+type InventoryItems struct {
+	Page
+	InventoryItems []InventoryItem `json:"inventoryItems"`
+}
+
+// Offer is an inventory item offered on one marketplace.
+type Offer struct {
+	OfferID             string           `json:"offerId,omitempty"`
+	SKU                 string           `json:"sku"`
+	MarketplaceID       string           `json:"marketplaceId"`
+	Format              string           `json:"format"` // FIXED_PRICE or AUCTION
+	AvailableQuantity   int              `json:"availableQuantity,omitempty"`
+	CategoryID          string           `json:"categoryId,omitempty"`
+	ListingDescription  string           `json:"listingDescription,omitempty"`
+	ListingDuration     string           `json:"listingDuration,omitempty"` // e.g. GTC
+	ListingPolicies     *ListingPolicies `json:"listingPolicies,omitempty"`
+	PricingSummary      *PricingSummary  `json:"pricingSummary,omitempty"`
+	MerchantLocationKey string           `json:"merchantLocationKey,omitempty"`
+	Status              string           `json:"status,omitempty"` // PUBLISHED or UNPUBLISHED
+	Listing             *struct {
+		ListingID     string `json:"listingId"`
+		ListingStatus string `json:"listingStatus,omitempty"`
+	} `json:"listing,omitempty"`
+}
+
+// ListingPolicies are the business policies an offer is listed with.
+type ListingPolicies struct {
+	FulfillmentPolicyID string `json:"fulfillmentPolicyId,omitempty"`
+	PaymentPolicyID     string `json:"paymentPolicyId,omitempty"`
+	ReturnPolicyID      string `json:"returnPolicyId,omitempty"`
+}
+
+// PricingSummary is the price of an offer.
+type PricingSummary struct {
+	Price Amount `json:"price"`
+}
+
+// Offers is a page of GetOffers.
+type Offers struct {
+	Page
+	Offers []Offer `json:"offers"`
+}
+
+// GetInventoryItem returns the inventory item with sku.
+func (c *Client) GetInventoryItem(ctx context.Context, sku string) (*InventoryItem, error) {
+	var out InventoryItem
+	if err := c.Get(ctx, inventoryPath+"/inventory_item/"+pathEscape(sku), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetInventoryItems returns a page of the seller's inventory items.
+func (c *Client) GetInventoryItems(ctx context.Context, limit, offset int) (*InventoryItems, error) {
+	q := url.Values{}
+	paging(q, limit, offset)
+	var out InventoryItems
+	if err := c.Get(ctx, inventoryPath+"/inventory_item", q, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateOrReplaceInventoryItem creates the inventory item with sku, or
+// replaces it.
+func (c *Client) CreateOrReplaceInventoryItem(ctx context.Context, sku string, item *InventoryItem) error {
+	_, err := c.Do(ctx, http.MethodPut, inventoryPath+"/inventory_item/"+pathEscape(sku), nil, item, nil)
+	return err
+}
+
+// DeleteInventoryItem deletes the inventory item with sku and its offers,
+// ending their listings.
+func (c *Client) DeleteInventoryItem(ctx context.Context, sku string) error {
+	_, err := c.Do(ctx, http.MethodDelete, inventoryPath+"/inventory_item/"+pathEscape(sku), nil, nil, nil)
+	return err
+}
+
+// GetOffers returns the offers of sku, on the client's marketplace when it
+// has one.
+func (c *Client) GetOffers(ctx context.Context, sku string) (*Offers, error) {
+	q := url.Values{}
+	q.Set("sku", sku)
+	if c.Marketplace != "" {
+		q.Set("marketplace_id", c.Marketplace)
+	}
+	var out Offers
+	if err := c.Get(ctx, inventoryPath+"/offer", q, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateOffer creates an unpublished offer and returns its ID.
+func (c *Client) CreateOffer(ctx context.Context, offer *Offer) (string, error) {
+	var out struct {
+		OfferID string `json:"offerId"`
+	}
+	if _, err := c.Do(ctx, http.MethodPost, inventoryPath+"/offer", nil, offer, &out); err != nil {
+		return "", err
+	}
+	return out.OfferID, nil
+}
+
+// PublishOffer lists an offer and returns the ID of the listing.
+func (c *Client) PublishOffer(ctx context.Context, offerID string) (string, error) {
+	var out struct {
+		ListingID string `json:"listingId"`
+	}
+	if _, err := c.Do(ctx, http.MethodPost, inventoryPath+"/offer/"+pathEscape(offerID)+"/publish", nil, nil, &out); err != nil {
+		return "", err
+	}
+	return out.ListingID, nil
+}
+
+// DeleteOffer deletes an offer, ending its listing if it is published.
+func (c *Client) DeleteOffer(ctx context.Context, offerID string) error {
+	_, err := c.Do(ctx, http.MethodDelete, inventoryPath+"/offer/"+pathEscape(offerID), nil, nil, nil)
+	return err
+}
+
+// GetInventoryLocations returns the seller's inventory locations, at most
+// limit.
+func (c *Client) GetInventoryLocations(ctx context.Context, limit int) ([]InventoryLocation, error) {
+	q := url.Values{}
+	paging(q, limit, 0)
+	var out struct {
+		Page
+		Locations []InventoryLocation `json:"locations"`
+	}
+	if err := c.Get(ctx, inventoryPath+"/location", q, &out); err != nil {
+		return nil, err
+	}
+	return out.Locations, nil
+}
+
+// CreateInventoryLocation creates the inventory location with key.
+func (c *Client) CreateInventoryLocation(ctx context.Context, key string, location *InventoryLocation) error {
+	_, err := c.Do(ctx, http.MethodPost, inventoryPath+"/location/"+pathEscape(key), nil, location, nil)
+	return err
+}
+
+// DeleteInventoryLocation deletes the inventory location with key.
+func (c *Client) DeleteInventoryLocation(ctx context.Context, key string) error {
+	_, err := c.Do(ctx, http.MethodDelete, inventoryPath+"/location/"+pathEscape(key), nil, nil, nil)
+	return err
+}
@@ -0,0 +1,90 @@
+package ebay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path"
+	"strings"
+)
+
+// ### Media API ###
+
+// The Media API is served from the apim host (apim.ebay.com), not the
+// client's usual API host; callers set Host accordingly.
+
+const mediaPath = "/commerce/media/v1_beta"
+
+// HostedImage is an image hosted on eBay Picture Services (EPS).
+type HostedImage struct {
+	ImageURL       string `json:"imageUrl"`
+	ExpirationDate string `json:"expirationDate,omitempty"`
+}
+
+// CreateImageFromFile uploads an image file to EPS, streaming it into the
+// multipart request eBay expects, and returns its ID and the hosted image.
+func (c *Client) CreateImageFromFile(ctx context.Context, name, contentType string, file io.Reader) (string, *HostedImage, error) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", `form-data; name="image"; filename="`+strings.NewReplacer(`"`, "", "\\", "").Replace(name)+`"`)
+		header.Set("Content-Type", contentType)
+		part, err := form.CreatePart(header)
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	call := mediaPath + "/image/create_image_from_file"
+	resp, err := c.sendBody(ctx, http.MethodPost, call, nil, form.FormDataContentType(), pr)
+	// Unblock the writer if the request ended before reading all of it
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return "", nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", nil, errorResponse("POST "+call, resp)
+	}
+	resp.Body.Close()
+	return c.createdImage(ctx, resp.Header)
+}
+
+// CreateImageFromURL has EPS fetch and host the image at imageURL.
+func (c *Client) CreateImageFromURL(ctx context.Context, imageURL string) (string, *HostedImage, error) {
+	header, err := c.Do(ctx, http.MethodPost, mediaPath+"/image/create_image_from_url", nil,
+		map[string]string{"imageUrl": imageURL}, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return c.createdImage(ctx, header)
+}
+
+// createdImage gets the image a create call's Location header points at.
+func (c *Client) createdImage(ctx context.Context, header http.Header) (string, *HostedImage, error) {
+	id := path.Base(header.Get("Location"))
+	if id == "" || id == "." || id == "/" {
+		return "", nil, errors.New("eBay did not return the location of the created image")
+	}
+	image, err := c.GetImage(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	return id, image, nil
+}
+
+// GetImage returns the EPS URL of an uploaded image and when it expires.
+func (c *Client) GetImage(ctx context.Context, imageID string) (*HostedImage, error) {
+	var out HostedImage
+	if err := c.Get(ctx, mediaPath+"/image/"+pathEscape(imageID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,126 @@
+package ebay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// ### Taxonomy API ###
+
+const taxonomyPath = "/commerce/taxonomy/v1"
+
+// CategoryTree identifies the category tree of a marketplace. The version
+// changes whenever eBay changes the tree.
+type CategoryTree struct {
+	CategoryTreeID      string `json:"categoryTreeId"`
+	CategoryTreeVersion string `json:"categoryTreeVersion"`
+}
+
+// Category is a node of a category tree.
+type Category struct {
+	CategoryID   string `json:"categoryId"`
+	CategoryName string `json:"categoryName"`
+}
+
+// CategorySuggestion is a leaf category matching a query, with the path
+// down to it.
+type CategorySuggestion struct {
+	Category                  Category `json:"category"`
+	CategoryTreeNodeAncestors []struct {
+		CategoryID            string `json:"categoryId"`
+		CategoryName          string `json:"categoryName"`
+		CategoryTreeNodeLevel int    `json:"categoryTreeNodeLevel"`
+	} `json:"categoryTreeNodeAncestors,omitempty"`
+	CategoryTreeNodeLevel int    `json:"categoryTreeNodeLevel"`
+	Relevancy             string `json:"relevancy,omitempty"`
+}
+
+// Aspect is an item specific of a category, e.g. Brand, with the
+// constraints listings must meet.
+type Aspect struct {
+	LocalizedAspectName string `json:"localizedAspectName"`
+	AspectConstraint    struct {
+		AspectDataType          string `json:"aspectDataType,omitempty"` // STRING, NUMBER, DATE
+		AspectMode              string `json:"aspectMode,omitempty"`     // FREE_TEXT or SELECTION_ONLY
+		AspectRequired          bool   `json:"aspectRequired,omitempty"`
+		AspectUsage             string `json:"aspectUsage,omitempty"`             // RECOMMENDED or OPTIONAL
+		ItemToAspectCardinality string `json:"itemToAspectCardinality,omitempty"` // SINGLE or MULTI
+	} `json:"aspectConstraint"`
+	AspectValues []struct {
+		LocalizedValue string `json:"localizedValue"`
+	} `json:"aspectValues,omitempty"`
+}
+
+// GetDefaultCategoryTreeID returns the category tree of the client's
+// marketplace.
+func (c *Client) GetDefaultCategoryTreeID(ctx context.Context) (*CategoryTree, error) {
+	q := url.Values{}
+	q.Set("marketplace_id", c.marketplaceID())
+	var out CategoryTree
+	if err := c.Get(ctx, taxonomyPath+"/get_default_category_tree_id", q, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CategoryTreeNode is a category with its subcategories, as
+// GetCategoryTree returns it.
+type CategoryTreeNode struct {
+	Category               Category           `json:"category"`
+	CategoryTreeNodeLevel  int                `json:"categoryTreeNodeLevel"`
+	LeafCategoryTreeNode   bool               `json:"leafCategoryTreeNode,omitempty"`
+	ChildCategoryTreeNodes []CategoryTreeNode `json:"childCategoryTreeNodes,omitempty"`
+}
+
+// FullCategoryTree is a whole category tree.
+type FullCategoryTree struct {
+	CategoryTree
+	RootCategoryNode CategoryTreeNode `json:"rootCategoryNode"`
+}
+
+// GetCategoryTree downloads the whole tree treeID. Trees of large
+// marketplaces run to tens of megabytes, so the response is decoded as it
+// streams in and the client's HTTPClient should allow for a slow download.
+func (c *Client) GetCategoryTree(ctx context.Context, treeID string) (*FullCategoryTree, error) {
+	path := taxonomyPath + "/category_tree/" + pathEscape(treeID)
+	body, err := c.open(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var out FullCategoryTree
+	if err := json.NewDecoder(body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("GET %s: failed to parse response: %w", path, err)
+	}
+	return &out, nil
+}
+
+// GetCategorySuggestions returns the leaf categories of the tree best
+// matching query, most relevant first.
+func (c *Client) GetCategorySuggestions(ctx context.Context, treeID, query string) ([]CategorySuggestion, error) {
+	q := url.Values{}
+	q.Set("q", query)
+	var out struct {
+		CategorySuggestions []CategorySuggestion `json:"categorySuggestions"`
+	}
+	if err := c.Get(ctx, taxonomyPath+"/category_tree/"+pathEscape(treeID)+"/get_category_suggestions", q, &out); err != nil {
+		return nil, err
+	}
+	return out.CategorySuggestions, nil
+}
+
+// GetItemAspectsForCategory returns the aspects listings in the leaf
+// category have or must have.
+func (c *Client) GetItemAspectsForCategory(ctx context.Context, treeID, categoryID string) ([]Aspect, error) {
+	q := url.Values{}
+	q.Set("category_id", categoryID)
+	var out struct {
+		Aspects []Aspect `json:"aspects"`
+	}
+	if err := c.Get(ctx, taxonomyPath+"/category_tree/"+pathEscape(treeID)+"/get_item_aspects_for_category", q, &out); err != nil {
+		return nil, err
+	}
+	return out.Aspects, nil
+}
@@ -0,0 +1,49 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// awsFromEnv reads the AWS Secrets Manager secret SECRETS_AWS_SECRET_ID, a
+// JSON object whose keys are the secret names. Region and credentials come
+// from the SDK's default chain: AWS_REGION and AWS_ACCESS_KEY_ID and the
+// like, AWS_PROFILE and the shared config files, web identity (EKS), the
+// ECS task role or the EC2 instance role. SECRETS_AWS_ENDPOINT replaces the
+// regional endpoint, e.g. for a VPC endpoint.
+func awsFromEnv(ctx context.Context) (Provider, error) {
+	secretID := getEnv("SECRETS_AWS_SECRET_ID")
+	if secretID == "" {
+		return nil, errors.New("SECRETS_BACKEND=aws needs SECRETS_AWS_SECRET_ID")
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the AWS configuration: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("SECRETS_BACKEND=aws needs a region, e.g. AWS_REGION")
+	}
+	client := secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+		if endpoint := getEnv("SECRETS_AWS_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+
+	return &document{fetch: func(ctx context.Context) (map[string]string, error) {
+		out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretID)})
+		if err != nil {
+			return nil, err
+		}
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(aws.ToString(out.SecretString)), &object); err != nil {
+			return nil, fmt.Errorf("secret %s is not a JSON object", secretID)
+		}
+		return stringValues(object), nil
+	}}, nil
+}
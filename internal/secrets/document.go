@@ -0,0 +1,40 @@
+package secrets
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// documentTTL is how long a fetched document answers Get, so Load and each
+// Watch tick read it once rather than once per name.
+const documentTTL = 10 * time.Second
+
+// document caches a key/value secret fetched as a whole, as Vault and AWS
+// store them.
+type document struct {
+	fetch func(ctx context.Context) (map[string]string, error)
+
+	mu        sync.Mutex
+	values    map[string]string
+	fetchedAt time.Time
+}
+
+func (d *document) Get(ctx context.Context, name string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.values == nil || time.Since(d.fetchedAt) > documentTTL {
+		values, err := d.fetch(ctx)
+		if err != nil {
+			return "", err
+		}
+		d.values, d.fetchedAt = values, time.Now()
+	}
+
+	value, ok := d.values[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
@@ -0,0 +1,56 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// gcpFromEnv reads the latest version of the Secret Manager secret named
+// like each variable in project SECRETS_GCP_PROJECT (or
+// GOOGLE_CLOUD_PROJECT). It authenticates with Application Default
+// Credentials: GOOGLE_APPLICATION_CREDENTIALS, the gcloud login, workload
+// identity or the instance's service account. SECRETS_GCP_TOKEN, an access
+// token, replaces them.
+func gcpFromEnv(ctx context.Context) (Provider, error) {
+	project := getEnv("SECRETS_GCP_PROJECT", "GOOGLE_CLOUD_PROJECT")
+	if project == "" {
+		return nil, errors.New("SECRETS_BACKEND=gcp needs SECRETS_GCP_PROJECT")
+	}
+	var opts []option.ClientOption
+	if token := getEnv("SECRETS_GCP_TOKEN"); token != "" {
+		opts = append(opts, option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})))
+	}
+	// The client keeps the context for refreshing its credentials, so it
+	// must outlive the deadline of loading the secrets
+	client, err := secretmanager.NewClient(context.WithoutCancel(ctx), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the Secret Manager client: %w", err)
+	}
+	return &gcpSecretManager{project: project, client: client}, nil
+}
+
+type gcpSecretManager struct {
+	project string
+	client  *secretmanager.Client
+}
+
+func (g *gcpSecretManager) Get(ctx context.Context, name string) (string, error) {
+	resp, err := g.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+		Name: "projects/" + g.project + "/secrets/" + name + "/versions/latest",
+	})
+	if status.Code(err) == codes.NotFound {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(resp.Payload.Data), nil
+}
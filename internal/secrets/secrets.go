@@ -0,0 +1,152 @@
+// Package secrets reads the secrets of the proxy and the backend, such as
+// EBAY_CLIENT_SECRET and DB_PASSWORD, from a secret manager instead of the
+// environment. SECRETS_BACKEND picks the Provider:
+//
+//	env    the environment itself (default)
+//	file   one file per secret in SECRETS_DIR, e.g. Docker/Kubernetes secrets
+//	vault  a HashiCorp Vault KV v2 secret
+//	aws    an AWS Secrets Manager secret holding a JSON object
+//	gcp    Google Cloud Secret Manager, one secret per name
+//
+// The cloud providers use their official SDKs and credential chains, so
+// anything that works for the vault, aws or gcloud CLIs (environment,
+// config files, instance roles, workload identity) works here too.
+//
+// At startup Load copies the values into the environment, where each
+// program reads them as usual. With SECRETS_REFRESH_INTERVAL, Watch
+// re-reads them and reports rotated values; what to do with them is up to
+// the program.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by providers that don't have the secret.
+var ErrNotFound = errors.New("secret not found")
+
+// Provider reads secrets by their environment variable name.
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// FromEnv returns the provider selected by SECRETS_BACKEND.
+func FromEnv(ctx context.Context) (Provider, error) {
+	switch backend := os.Getenv("SECRETS_BACKEND"); backend {
+	case "", "env":
+		return envProvider{}, nil
+	case "file":
+		dir := os.Getenv("SECRETS_DIR")
+		if dir == "" {
+			dir = "/run/secrets"
+		}
+		return fileProvider{dir: dir}, nil
+	case "vault":
+		return vaultFromEnv()
+	case "aws":
+		return awsFromEnv(ctx)
+	case "gcp":
+		return gcpFromEnv(ctx)
+	default:
+		return nil, fmt.Errorf("invalid SECRETS_BACKEND %q (expected env, file, vault, aws or gcp)", backend)
+	}
+}
+
+// Load reads names from p into the environment and returns the values it
+// found. Names p doesn't have keep their environment value, if any.
+func Load(ctx context.Context, p Provider, names []string) (map[string]string, error) {
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		value, err := p.Get(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s: %w", name, err)
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// Watch re-reads the secrets names returns from p every interval until ctx
+// is done, copies the ones that changed into the environment and calls
+// changed with them. seen starts as the values returned by Load. Failed
+// reads are logged and retried at the next tick.
+func Watch(ctx context.Context, p Provider, names func() []string, interval time.Duration, seen map[string]string, changed func(name, value string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		readCtx, cancel := context.WithTimeout(ctx, interval)
+		for _, name := range names() {
+			value, err := p.Get(readCtx, name)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				log.Printf("Failed to refresh secret %s: %v", name, err)
+				continue
+			}
+			if previous, ok := seen[name]; ok && previous == value {
+				continue
+			}
+			seen[name] = value
+			os.Setenv(name, value)
+			changed(name, value)
+		}
+		cancel()
+	}
+}
+
+// envProvider reads the environment, so Load leaves it as it is.
+type envProvider struct{}
+
+func (envProvider) Get(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// fileProvider reads dir/NAME, trimming the trailing newline editors and
+// `echo` leave behind.
+type fileProvider struct {
+	dir string
+}
+
+func (f fileProvider) Get(_ context.Context, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(f.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// getEnv returns the first of keys that is set.
+func getEnv(keys ...string) string {
+	for _, key := range keys {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// vaultFromEnv reads the KV v2 secret SECRETS_VAULT_PATH (e.g. "ebay-mcp")
+// of the SECRETS_VAULT_MOUNT engine, "secret" by default, whose keys are
+// the secret names. The client is configured like the vault CLI, from
+// VAULT_ADDR, VAULT_TOKEN, VAULT_NAMESPACE, VAULT_CACERT and the rest;
+// SECRETS_VAULT_ADDR, SECRETS_VAULT_TOKEN and SECRETS_VAULT_NAMESPACE win
+// over them.
+func vaultFromEnv() (Provider, error) {
+	path := strings.Trim(getEnv("SECRETS_VAULT_PATH"), "/")
+	if path == "" {
+		return nil, errors.New("SECRETS_BACKEND=vault needs SECRETS_VAULT_PATH")
+	}
+	mount := strings.Trim(getEnv("SECRETS_VAULT_MOUNT"), "/")
+	if mount == "" {
+		mount = "secret"
+	}
+
+	config := vault.DefaultConfig()
+	if config.Error != nil {
+		return nil, config.Error
+	}
+	config.Timeout = 10 * time.Second
+	if addr := getEnv("SECRETS_VAULT_ADDR"); addr != "" {
+		config.Address = addr
+	}
+	client, err := vault.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	if token := getEnv("SECRETS_VAULT_TOKEN"); token != "" {
+		client.SetToken(token)
+	}
+	if namespace := getEnv("SECRETS_VAULT_NAMESPACE"); namespace != "" {
+		client.SetNamespace(namespace)
+	}
+
+	kv := client.KVv2(mount)
+	return &document{fetch: func(ctx context.Context) (map[string]string, error) {
+		secret, err := kv.Get(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		return stringValues(secret.Data), nil
+	}}, nil
+}
+
+// stringValues keeps the string values of a JSON object.
+func stringValues(object map[string]interface{}) map[string]string {
+	values := make(map[string]string, len(object))
+	for key, value := range object {
+		if s, ok := value.(string); ok {
+			values[key] = s
+		}
+	}
+	return values
+}
@@ -0,0 +1,89 @@
+// Package signing signs the requests the proxy makes to the backend's
+// /internal API, and verifies them on the backend's side, with the secrets
+// of INTERNAL_SIGNING_SECRETS. The signature is
+// hex(HMAC-SHA256(secret, canonical request)), where the canonical request
+// is the method, the request URI (path and query), the timestamp (Unix
+// seconds), the nonce and hex(SHA-256(body)), separated by newlines:
+//
+//	err := signing.Sign(req, secrets[0], body, time.Now())
+//	...
+//	nonce, err := signing.Verify(req, secrets, body, time.Now())
+//
+// Verify checks the signature and the timestamp; remembering nonces for
+// ReplayWindow to refuse a replayed request is up to the caller.
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of signed internal requests.
+const (
+	TimestampHeader = "X-Internal-Timestamp"
+	NonceHeader     = "X-Internal-Nonce"
+	SignatureHeader = "X-Internal-Signature"
+)
+
+// ReplayWindow is how far a signed request's timestamp may be from now.
+const ReplayWindow = 5 * time.Minute
+
+var (
+	ErrMissing = errors.New("missing request signature")
+	ErrExpired = errors.New("request timestamp is outside the replay window")
+	ErrInvalid = errors.New("invalid request signature")
+)
+
+// Signature signs a request with secret.
+func Signature(secret, method, requestURI, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{method, requestURI, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign adds the timestamp, nonce and signature headers to req, whose body
+// is body.
+func Sign(req *http.Request, secret string, body []byte, now time.Time) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(NonceHeader, nonceHex)
+	req.Header.Set(SignatureHeader, Signature(secret, req.Method, req.URL.RequestURI(), timestamp, nonceHex, body))
+	return nil
+}
+
+// Verify checks that req, whose body is body, was signed with one of
+// secrets within ReplayWindow of now, and returns its nonce. Any of the
+// secrets verifies, so they can be rotated without restarting both programs
+// at once.
+func Verify(req *http.Request, secrets []string, body []byte, now time.Time) (string, error) {
+	timestamp := req.Header.Get(TimestampHeader)
+	nonce := req.Header.Get(NonceHeader)
+	signature := req.Header.Get(SignatureHeader)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return "", ErrMissing
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || now.Sub(time.Unix(seconds, 0)).Abs() > ReplayWindow {
+		return "", ErrExpired
+	}
+	for _, secret := range secrets {
+		expected := Signature(secret, req.Method, req.URL.RequestURI(), timestamp, nonce, body)
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			return nonce, nil
+		}
+	}
+	return "", ErrInvalid
+}
@@ -0,0 +1,268 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/redis/go-redis/v9"
+)
+
+// The Redis and memcached stores wrap go-redis and gomemcache, which pool
+// connections per server. When a server can't be reached, a breaker makes
+// calls fail fast for RetryAfter instead of each waiting for a timeout.
+
+// RetryAfter is how long a store fails fast after a connection error.
+const RetryAfter = 5 * time.Second
+
+// ErrUnavailable is returned while a store fails fast.
+var ErrUnavailable = errors.New("cache server unavailable")
+
+// breaker trips on connection errors; errors the server answered with,
+// such as a cache miss, and the caller's own deadline leave it closed.
+type breaker struct {
+	downUntil atomic.Int64 // Unix nanoseconds; calls fail fast until then
+}
+
+// do runs fn unless the breaker is open, opening it when fn fails to talk
+// to the server.
+func (b *breaker) do(fn func() error) error {
+	if time.Now().UnixNano() < b.downUntil.Load() {
+		return ErrUnavailable
+	}
+	err := fn()
+	var netErr net.Error
+	var timeoutErr *memcache.ConnectTimeoutError
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	if errors.As(err, &netErr) || errors.As(err, &timeoutErr) {
+		b.downUntil.Store(time.Now().Add(RetryAfter).UnixNano())
+	}
+	return err
+}
+
+// ### Redis ###
+
+// redisStore keeps values in Redis with SET PX.
+type redisStore struct {
+	addr    string
+	client  *redis.Client
+	breaker breaker
+}
+
+// newRedis connects to a redis:// or rediss:// URL; the path selects
+// the database.
+func newRedis(rawURL string, poolSize int, timeout time.Duration) (*redisStore, error) {
+	if rawURL == "" {
+		return nil, errors.New("CACHE_URL is required for the redis cache")
+	}
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis CACHE_URL %q: %w", rawURL, err)
+	}
+	opts.PoolSize = poolSize
+	opts.DialTimeout = timeout
+	opts.ReadTimeout = timeout
+	opts.WriteTimeout = timeout
+	opts.PoolTimeout = timeout
+	opts.MaxRetries = -1 // the breaker, not the client, decides when to retry
+	return &redisStore{addr: opts.Addr, client: redis.NewClient(opts)}, nil
+}
+
+func (c *redisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var value []byte
+	err := c.breaker.do(func() error {
+		var err error
+		value, err = c.client.Get(ctx, key).Bytes()
+		return err
+	})
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	return value, err == nil, err
+}
+
+func (c *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("cache TTL must be positive")
+	}
+	return c.breaker.do(func() error {
+		return c.client.Set(ctx, key, value, max(ttl, time.Millisecond)).Err()
+	})
+}
+
+func (c *redisStore) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		return false, errors.New("cache TTL must be positive")
+	}
+	var added bool
+	err := c.breaker.do(func() error {
+		var err error
+		added, err = c.client.SetNX(ctx, key, value, max(ttl, time.Millisecond)).Result()
+		return err
+	})
+	return added && err == nil, err
+}
+
+// takeTokenScript runs a token bucket in Redis: the hash at KEYS[1] holds
+// the tokens left and the time of the last refill. ARGV are the refill rate
+// per second, the burst and the current Unix time in seconds. It returns
+// "<allowed 0|1> <tokens left>".
+var takeTokenScript = redis.NewScript(`
+local rate, burst, now = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 't', 'l')
+local tokens = tonumber(state[1]) or burst
+local last = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 't', tostring(tokens), 'l', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return allowed .. ' ' .. tostring(tokens)
+`)
+
+// TakeToken takes one token from the bucket at key, shared by every
+// replica, and returns the tokens left.
+func (c *redisStore) TakeToken(ctx context.Context, key string, rate, burst float64, now time.Time) (float64, bool, error) {
+	var reply string
+	err := c.breaker.do(func() error {
+		var err error
+		reply, err = takeTokenScript.Run(ctx, c.client, []string{key},
+			strconv.FormatFloat(rate, 'f', -1, 64),
+			strconv.FormatFloat(burst, 'f', -1, 64),
+			strconv.FormatFloat(float64(now.UnixMilli())/1000, 'f', 3, 64)).Text()
+		return err
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	allowed, tokens, ok := strings.Cut(reply, " ")
+	left, perr := strconv.ParseFloat(tokens, 64)
+	if !ok || perr != nil {
+		return 0, false, fmt.Errorf("unexpected token bucket reply %q", reply)
+	}
+	return left, allowed == "1", nil
+}
+
+func (c *redisStore) Delete(ctx context.Context, key string) error {
+	return c.breaker.do(func() error {
+		return c.client.Del(ctx, key).Err()
+	})
+}
+
+// ### memcached ###
+
+// memcachedRelativeTTLLimit is the longest expiry memcached accepts in
+// seconds; longer ones must be given as a Unix time.
+const memcachedRelativeTTLLimit = 30 * 24 * 60 * 60
+
+// memcachedStore spreads keys over one or more memcached servers, each
+// with its own breaker. The client doesn't take a context; calls are
+// bounded by CACHE_TIMEOUT.
+type memcachedStore struct {
+	servers  []string
+	list     memcache.ServerList
+	client   *memcache.Client
+	breakers map[string]*breaker
+}
+
+// newMemcached connects to a comma-separated list of host:port servers.
+func newMemcached(servers string, poolSize int, timeout time.Duration) (*memcachedStore, error) {
+	if servers == "" {
+		return nil, errors.New("CACHE_URL is required for the memcached cache")
+	}
+	c := &memcachedStore{breakers: make(map[string]*breaker)}
+	for _, server := range strings.Split(servers, ",") {
+		server = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(server), "memcached://"))
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "11211")
+		}
+		c.servers = append(c.servers, server)
+	}
+	if err := c.list.SetServers(c.servers...); err != nil {
+		return nil, fmt.Errorf("invalid memcached CACHE_URL %q: %w", servers, err)
+	}
+	c.list.Each(func(addr net.Addr) error {
+		c.breakers[addr.String()] = &breaker{}
+		return nil
+	})
+	c.client = memcache.NewFromSelector(&c.list)
+	c.client.Timeout = timeout
+	c.client.MaxIdleConns = poolSize
+	return c, nil
+}
+
+// breakerFor returns the breaker of the server responsible for key.
+func (c *memcachedStore) breakerFor(key string) *breaker {
+	addr, err := c.list.PickServer(key)
+	if err != nil {
+		return &breaker{} // the client reports the error
+	}
+	return c.breakers[addr.String()]
+}
+
+func (c *memcachedStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	var item *memcache.Item
+	err := c.breakerFor(key).do(func() error {
+		var err error
+		item, err = c.client.Get(key)
+		return err
+	})
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return item.Value, true, nil
+}
+
+func (c *memcachedStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	item, err := memcachedItem(key, value, ttl)
+	if err != nil {
+		return err
+	}
+	return c.breakerFor(key).do(func() error { return c.client.Set(item) })
+}
+
+func (c *memcachedStore) Add(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	item, err := memcachedItem(key, value, ttl)
+	if err != nil {
+		return false, err
+	}
+	err = c.breakerFor(key).do(func() error { return c.client.Add(item) })
+	if errors.Is(err, memcache.ErrNotStored) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// memcachedItem builds the item storing value under key for ttl.
+func memcachedItem(key string, value []byte, ttl time.Duration) (*memcache.Item, error) {
+	if ttl <= 0 {
+		return nil, errors.New("cache TTL must be positive")
+	}
+	exptime := int64(max(ttl.Seconds(), 1))
+	if exptime > memcachedRelativeTTLLimit {
+		exptime = time.Now().Add(ttl).Unix()
+	}
+	return &memcache.Item{Key: key, Value: value, Expiration: int32(exptime)}, nil
+}
+
+func (c *memcachedStore) Delete(_ context.Context, key string) error {
+	err := c.breakerFor(key).do(func() error { return c.client.Delete(key) })
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,221 @@
+// Package store is the key-value store with per-value expiry both programs
+// keep shared state in: the proxy's caches and rate limits, and the
+// backend's record of internal request nonces. FromEnv picks it with
+// CACHE_BACKEND:
+//
+//	memory     in-process LRU bounded by CACHE_MAX_BYTES (default 64 MiB)
+//	redis      CACHE_URL=redis://[user:password@]host:6379/0 (rediss:// for TLS)
+//	memcached  CACHE_URL=host:11211[,host:11211...]
+//
+// Redis and memcached, through go-redis and gomemcache, let several
+// replicas share one store. After a server can't be reached, calls fail
+// with ErrUnavailable for RetryAfter instead of each waiting for a timeout.
+package store
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxBytes = 64 << 20
+	defaultPoolSize = 10
+	defaultTimeout  = time.Second
+)
+
+// Store is a key-value store with per-value expiry.
+type Store interface {
+	// Get returns the value stored under key, or ok=false if there is none
+	// or it has expired.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set stores value under key for ttl, which must be positive.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Add stores value under key for ttl only if key has no value, reporting
+	// whether it did. Replicas racing to add the same key see one winner.
+	Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Delete removes key; a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Buckets is implemented by stores that can run token buckets shared by
+// every replica.
+type Buckets interface {
+	// TakeToken takes one token from the bucket at key, refilled at rate
+	// per second up to burst, and returns the tokens left.
+	TakeToken(ctx context.Context, key string, rate, burst float64, now time.Time) (tokens float64, allowed bool, err error)
+}
+
+// FromEnv builds the store selected by CACHE_BACKEND.
+func FromEnv() (Store, error) {
+	poolSize := defaultPoolSize
+	if v := os.Getenv("CACHE_POOL_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid CACHE_POOL_SIZE %q", v)
+		}
+		poolSize = n
+	}
+	timeout := defaultTimeout
+	if v := os.Getenv("CACHE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid CACHE_TIMEOUT %q", v)
+		}
+		timeout = d
+	}
+
+	backend := os.Getenv("CACHE_BACKEND")
+	if backend == "" {
+		backend = "memory"
+	}
+	switch backend {
+	case "memory":
+		maxBytes := int64(defaultMaxBytes)
+		if v := os.Getenv("CACHE_MAX_BYTES"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid CACHE_MAX_BYTES %q", v)
+			}
+			maxBytes = n
+		}
+		return NewMemory(maxBytes), nil
+	case "redis":
+		return newRedis(os.Getenv("CACHE_URL"), poolSize, timeout)
+	case "memcached":
+		return newMemcached(os.Getenv("CACHE_URL"), poolSize, timeout)
+	default:
+		return nil, fmt.Errorf("unknown CACHE_BACKEND %q (expected memory, redis or memcached)", backend)
+	}
+}
+
+// KeyPrefix returns CACHE_KEY_PREFIX, which separates deployments sharing
+// a server; "ebay-mcp:" by default.
+func KeyPrefix() string {
+	if prefix := os.Getenv("CACHE_KEY_PREFIX"); prefix != "" {
+		return prefix
+	}
+	return "ebay-mcp:"
+}
+
+// Local reports whether s lives in this process, unseen by other replicas.
+func Local(s Store) bool {
+	_, ok := s.(*Memory)
+	return ok
+}
+
+// Describe describes s for logs.
+func Describe(s Store) string {
+	switch s := s.(type) {
+	case *Memory:
+		return fmt.Sprintf("memory (%d MiB)", s.maxBytes>>20)
+	case *redisStore:
+		return "redis " + s.addr
+	case *memcachedStore:
+		return "memcached " + strings.Join(s.servers, ",")
+	default:
+		return fmt.Sprintf("%T", s)
+	}
+}
+
+// ### In-memory LRU ###
+
+// Memory is a size-bounded LRU store local to the process.
+type Memory struct {
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List // of *memoryItem, most recently used first
+	entries map[string]*list.Element
+}
+
+type memoryItem struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemory returns an empty store holding up to maxBytes of keys and
+// values.
+func NewMemory(maxBytes int64) *Memory {
+	return &Memory{maxBytes: maxBytes, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *Memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := el.Value.(*memoryItem)
+	if time.Now().After(item.expiresAt) {
+		c.remove(el)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(el)
+	return item.value, true, nil
+}
+
+func (c *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("cache TTL must be positive")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, value, ttl)
+	return nil
+}
+
+func (c *Memory) Add(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		return false, errors.New("cache TTL must be positive")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok && !time.Now().After(el.Value.(*memoryItem).expiresAt) {
+		return false, nil
+	}
+	c.set(key, value, ttl)
+	return true, nil
+}
+
+// set stores a value, evicting the least recently used ones to make room.
+// Callers must hold c.mu.
+func (c *Memory) set(key string, value []byte, ttl time.Duration) {
+	size := int64(len(key) + len(value))
+	if size > c.maxBytes {
+		return // never fits; behave like an immediate eviction
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&memoryItem{key: key, value: value, expiresAt: time.Now().Add(ttl)})
+	c.size += size
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *Memory) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	return nil
+}
+
+// remove drops an element. Callers must hold c.mu.
+func (c *Memory) remove(el *list.Element) {
+	item := c.order.Remove(el).(*memoryItem)
+	delete(c.entries, item.key)
+	c.size -= int64(len(item.key) + len(item.value))
+}
@@ -0,0 +1,57 @@
+// Package telemetry writes metrics in the Prometheus text exposition format
+// for the /metrics endpoints of the proxy and the backend. Each subsystem
+// appends its metrics to one strings.Builder, and Serve sends them:
+//
+//	telemetry.Serve(w, metrics.writePrometheus, upstream.writePrometheus)
+//
+// Series are written sorted by label value, so scrapes diff cleanly.
+package telemetry
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4"
+
+// Header writes the HELP and TYPE lines of the metric name, whose kind is
+// counter, gauge or histogram.
+func Header(w *strings.Builder, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Counter writes a counter with a single label.
+func Counter(w *strings.Builder, name, help, label string, values map[string]uint64) {
+	Header(w, name, help, "counter")
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, k, values[k])
+	}
+}
+
+// Gauge writes a gauge without labels.
+func Gauge(w *strings.Builder, name, help string, value float64) {
+	Header(w, name, help, "gauge")
+	fmt.Fprintf(w, "%s %g\n", name, value)
+}
+
+// Serve answers a scrape with what writers append.
+func Serve(w http.ResponseWriter, writers ...func(w *strings.Builder)) {
+	var b strings.Builder
+	for _, write := range writers {
+		write(&b)
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Write([]byte(b.String()))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
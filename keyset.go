@@ -0,0 +1,194 @@
+package ebaymcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ### Keyset Validation ######################################################
+
+// keysetCheck is the outcome of one validation step. Fix tells the operator
+// what to change when the check fails.
+type keysetCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// handleValidateKeyset tests every configured eBay keyset and reports
+// actionable failures instead of leaving operators to guess which
+// environment variable is wrong.
+//
+// GET or POST /api/admin/keyset/validate
+func handleValidateKeyset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	allOK := true
+	var results []map[string]interface{}
+	t := tenantFor(r)
+	for _, name := range t.environmentNames() {
+		env := t.Environments[name]
+		checks := validateKeyset(r.Context(), env)
+		for _, c := range checks {
+			allOK = allOK && c.OK
+		}
+		results = append(results, map[string]interface{}{
+			"tenant":      t.Name,
+			"environment": name,
+			"client_id":   env.ClientID,
+			"checks":      checks,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":           allOK,
+		"environments": results,
+	})
+}
+
+// validateKeyset runs all checks for one environment.
+func validateKeyset(ctx context.Context, env *ebayEnvironment) []keysetCheck {
+	checks := []keysetCheck{checkKeysetEnvironment(env)}
+	checks = append(checks, checkClientCredentials(ctx, env))
+	checks = append(checks, checkScopeCoverage(env))
+	for _, u := range appRedirectURLs {
+		checks = append(checks, checkRedirect(ctx, env, u.String()))
+	}
+	return checks
+}
+
+// checkKeysetEnvironment catches sandbox keys configured for production and
+// vice versa. eBay App IDs embed "-SBX-" or "-PRD-".
+func checkKeysetEnvironment(env *ebayEnvironment) keysetCheck {
+	c := keysetCheck{Name: "keyset_environment", OK: true}
+	switch {
+	case env.Name == envProduction && strings.Contains(env.ClientID, "-SBX-"):
+		c.OK = false
+		c.Detail = "the client ID is a sandbox App ID but is configured for production"
+		c.Fix = "use the Production keyset from the eBay developer portal, or move these keys to EBAY_SANDBOX_CLIENT_ID/SECRET"
+	case env.Name == envSandbox && strings.Contains(env.ClientID, "-PRD-"):
+		c.OK = false
+		c.Detail = "the client ID is a production App ID but is configured for the sandbox"
+		c.Fix = "use the Sandbox keyset from the eBay developer portal, or move these keys to EBAY_PRODUCTION_CLIENT_ID/SECRET"
+	default:
+		c.Detail = "client ID matches the " + env.Name + " environment"
+	}
+	return c
+}
+
+// checkClientCredentials mints an application token, which proves the
+// client ID and secret belong together and to this environment.
+func checkClientCredentials(ctx context.Context, env *ebayEnvironment) keysetCheck {
+	c := keysetCheck{Name: "client_credentials"}
+	if _, err := applicationToken(ctx, env, signingScope); err != nil {
+		c.Detail = err.Error()
+		switch {
+		case strings.Contains(err.Error(), "invalid_client"):
+			c.Fix = "the client ID and secret don't match; copy both again from the same keyset (Cert ID is the secret)"
+		case strings.Contains(err.Error(), "invalid_scope"):
+			c.Fix = "the keyset isn't allowed the base api_scope; check the application's OAuth scopes in the developer portal"
+		default:
+			c.Fix = "check that " + env.OAuth.Endpoint.TokenURL + " is reachable and is the " + env.Name + " token URL"
+		}
+		return c
+	}
+	c.OK = true
+	c.Detail = "minted an application token"
+	return c
+}
+
+// checkScopeCoverage verifies that the requested user scopes are well formed
+// and include every scope the policy requires for an allowed route.
+func checkScopeCoverage(env *ebayEnvironment) keysetCheck {
+	c := keysetCheck{Name: "scope_coverage"}
+
+	configured := make(map[string]bool)
+	var malformed []string
+	for _, s := range env.OAuth.Scopes {
+		if s == "" {
+			continue
+		}
+		configured[s] = true
+		if !strings.HasPrefix(s, "https://api.ebay.com/oauth/") {
+			malformed = append(malformed, s)
+		}
+	}
+	if len(configured) == 0 {
+		c.Detail = "no OAuth scopes are configured"
+		c.Fix = "set EBAY_SCOPES to the space-separated scopes your application was granted"
+		return c
+	}
+	if len(malformed) > 0 {
+		c.Detail = "malformed scopes: " + strings.Join(malformed, ", ")
+		c.Fix = "scopes must be full URLs such as https://api.ebay.com/oauth/api_scope/sell.inventory, separated by spaces"
+		return c
+	}
+
+	var missing []string
+	for _, m := range currentPolicy().Scopes {
+		if err := checkScopes(env.OAuth.Scopes, m.Scopes); err != nil {
+			missing = append(missing, fmt.Sprintf("%s (for %s)", strings.Join(m.Scopes, " or "), m.Prefix))
+		}
+	}
+	if len(missing) > 0 {
+		c.Detail = "the policy requires scopes that are not requested: " + strings.Join(missing, ", ")
+		c.Fix = "add the missing scopes to EBAY_SCOPES, or remove those routes from the policy"
+		return c
+	}
+
+	c.OK = true
+	c.Detail = fmt.Sprintf("%d scopes requested, covering all policy routes", len(configured))
+	return c
+}
+
+// checkRedirect asks eBay's authorize endpoint to start a consent flow with
+// redirectURI. eBay answers with an error when the redirect (RuName) isn't
+// registered for the keyset, and with its sign-in page otherwise.
+func checkRedirect(ctx context.Context, env *ebayEnvironment, redirectURI string) keysetCheck {
+	c := keysetCheck{Name: "redirect " + redirectURI}
+
+	conf := *env.OAuth
+	conf.RedirectURL = redirectURI
+	req, err := http.NewRequestWithContext(ctx, "GET", conf.AuthCodeURL("keyset-validate"), nil)
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		c.Detail = err.Error()
+		c.Fix = "check that " + env.OAuth.Endpoint.AuthURL + " is reachable and is the " + env.Name + " authorize URL"
+		return c
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	location := resp.Header.Get("Location")
+	if loc, err := url.Parse(location); err == nil && loc.Query().Get("error") != "" {
+		c.Detail = "eBay rejected the request: " + loc.Query().Get("error") + " " + loc.Query().Get("error_description")
+	} else if resp.StatusCode >= 400 || strings.Contains(string(body), "invalid_request") {
+		c.Detail = fmt.Sprintf("eBay's authorize endpoint returned status %d", resp.StatusCode)
+	} else {
+		c.OK = true
+		c.Detail = "eBay accepted the redirect and would show its sign-in page"
+		return c
+	}
+	c.Fix = "register this URL as the auth accepted URL of the RuName in the developer portal (User Tokens > Get a Token from eBay via Your Application), or fix APP_REDIRECT_URL"
+	return c
+}
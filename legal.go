@@ -0,0 +1,124 @@
+package ebaymcp
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ### Legal Pages ############################################################
+
+// The GPT Action builder and eBay's app review both need a reachable privacy
+// policy and terms of service. These are rendered from built-in templates
+// with the operator's details from the environment. Operators with their own
+// wording put privacy.html and/or terms.html in LEGAL_TEMPLATE_DIR; those
+// replace the built-in page of the same name and get the same details.
+
+//go:embed templates/*.html
+var legalTemplateFS embed.FS
+
+var legalTemplates = template.Must(template.ParseFS(legalTemplateFS, "templates/*.html"))
+
+// loadLegalTemplates returns the built-in templates with those in dir (if
+// any) taking precedence.
+func loadLegalTemplates(dir string) (*template.Template, error) {
+	if dir == "" {
+		return legalTemplates, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("LEGAL_TEMPLATE_DIR %s contains no .html templates", dir)
+	}
+	t, err := template.Must(legalTemplates.Clone()).ParseFiles(matches...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse legal templates: %w", err)
+	}
+	return t, nil
+}
+
+// checkLegalDetails warns about details the GPT store and eBay's review
+// expect on the legal pages.
+func checkLegalDetails() {
+	if os.Getenv("LEGAL_CONTACT_EMAIL") == "" {
+		log.Println("Warning: LEGAL_CONTACT_EMAIL is not set; /privacy and /terms will have no contact address")
+	}
+	if os.Getenv("LEGAL_JURISDICTION") == "" {
+		log.Println("Warning: LEGAL_JURISDICTION is not set; /terms will name no governing law")
+	}
+}
+
+// legalDetails are the deployment-specific values injected into the pages.
+type legalDetails struct {
+	ServiceName   string
+	OperatorName  string
+	ContactEmail  string
+	EffectiveDate string
+	Jurisdiction  string
+	LogoURL       string
+	BaseURL       string
+}
+
+// legalDetailsFor reads the operator details from the environment.
+func legalDetailsFor(r *http.Request) legalDetails {
+	name := envOr("SERVICE_NAME", "eBay Assistant")
+	return legalDetails{
+		ServiceName:   name,
+		OperatorName:  envOr("LEGAL_OPERATOR_NAME", name),
+		ContactEmail:  os.Getenv("LEGAL_CONTACT_EMAIL"),
+		EffectiveDate: envOr("LEGAL_EFFECTIVE_DATE", "2025-01-01"),
+		Jurisdiction:  os.Getenv("LEGAL_JURISDICTION"),
+		LogoURL:       os.Getenv("SERVICE_LOGO_URL"),
+		BaseURL:       externalBaseURL(r),
+	}
+}
+
+// handleLegalPage serves /privacy and /terms.
+func handleLegalPage(page string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := legalTemplates.ExecuteTemplate(w, page+".html", legalDetailsFor(r)); err != nil {
+			log.Printf("Failed to render %s page: %v", page, err)
+		}
+	}
+}
+
+// handlePluginManifest serves /.well-known/ai-plugin.json for legacy plugin
+// clients. Authentication points at our own OAuth endpoints.
+func handlePluginManifest(w http.ResponseWriter, r *http.Request) {
+	d := legalDetailsFor(r)
+
+	auth := map[string]interface{}{
+		"type":                       "oauth",
+		"client_url":                 d.BaseURL + "/authorize",
+		"authorization_url":          d.BaseURL + "/token",
+		"authorization_content_type": "application/x-www-form-urlencoded",
+		"scope":                      strings.Join(defaultEnvironmentFor(r).OAuth.Scopes, " "),
+	}
+	if token := os.Getenv("PLUGIN_VERIFICATION_TOKEN"); token != "" {
+		auth["verification_tokens"] = map[string]string{"openai": token}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"schema_version":        "v1",
+		"name_for_human":        d.ServiceName,
+		"name_for_model":        "ebay",
+		"description_for_human": "Search, list and manage your eBay sales.",
+		"description_for_model": "Calls eBay REST APIs on behalf of the user through /proxy/{path}.",
+		"auth":                  auth,
+		"api": map[string]string{
+			"type": "openapi",
+			"url":  envOr("PLUGIN_OPENAPI_URL", d.BaseURL+"/openapi.json"),
+		},
+		"logo_url":       d.LogoURL,
+		"contact_email":  d.ContactEmail,
+		"legal_info_url": d.BaseURL + "/terms",
+	})
+}
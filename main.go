@@ -1,9 +1,11 @@
-package main
+package ebaymcp
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,34 +13,41 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ayouroukov/ebay-mcp/internal/secrets"
+	"github.com/ayouroukov/ebay-mcp/internal/store"
 	"github.com/joho/godotenv"
 	"golang.org/x/oauth2"
 )
 
-var (
-	// oauthConf is the global OAuth2 configuration for eBay.
-	oauthConf *oauth2.Config
-
-	// ebayClientID is your eBay App's Client ID.
-	ebayClientID string
-
-	// ebayClientSecret is your eBay App's Client Secret.
-	ebayClientSecret string
+// ### Main Server Setup (with Autocert) ####################################
 
-	// ebayAPIHost is the target eBay API host (e.g., "api.ebay.com").
-	ebayAPIHost string
+// Main runs the standalone server, or the subcommand named on the command
+// line (e.g. `ebay-mcp config export`) instead.
+func Main() {
+	if err := LoadEnvironment(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
 
-	// stateStore links the 'state' string to OpenAI's 'redirect_uri'.
-	// For production, use a proper store (e.g., Redis) with a short TTL.
-	stateStore = make(map[string]string)
-)
+	// Subcommands (e.g. `ebay-mcp config export`) run instead of the server
+	if len(os.Args) > 1 {
+		if err := RunCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-// ### Main Server Setup (with Autocert) ####################################
+	if err := ListenAndServe(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
 
-func main() {
+// LoadEnvironment adds the variables of ../.env, if it exists, and then
+// the settings of CONFIG_FILE to those already in the environment.
+func LoadEnvironment() error {
 	// 0. Load .env file (if it exists)
 	// This will load variables from .env file into the environment.
 	// If the file doesn't exist, it will silently continue (good for production).
@@ -48,73 +57,378 @@ func main() {
 
 	log.Println("Loaded Env")
 
+	// Settings from CONFIG_FILE, under those already in the environment
+	return loadConfigFile()
+}
+
+// ListenAndServe configures the proxy from the environment and serves it on
+// LISTEN_ADDR until SIGINT or SIGTERM, then drains in-flight requests and
+// stops the background jobs.
+func ListenAndServe() error {
+	sslCertFile := os.Getenv("SSL_CERTFILE") // Path to SSL certificate file
+	sslKeyFile := os.Getenv("SSL_KEYFILE")   // Path to SSL key file
+	listenAddr := os.Getenv("LISTEN_ADDR")   // e.g. ":443" (default) or ":8080" behind a reverse proxy
+
+	// Validate TLS configuration
+	tlsMode, err := tlsModeFromEnv()
+	if err != nil {
+		return err
+	}
+	if tlsMode == tlsModeOff {
+		log.Println("TLS_MODE=off: serving plain HTTP, TLS must be terminated by a reverse proxy")
+	}
+
+	if listenAddr == "" {
+		listenAddr = ":443"
+		if tlsMode == tlsModeOff {
+			listenAddr = ":8080"
+		}
+	}
+
+	// 1.-3. Configuration, background jobs and routes
+	proxyServer, err := New(Options{})
+	if err != nil {
+		return err
+	}
+
+	// 4. Configure the main server
+	server := &http.Server{
+		Addr:    listenAddr,  // Listen on LISTEN_ADDR (port 443 by default)
+		Handler: proxyServer, // The routes wrapped with logging, tenant selection and body limits
+	}
+
+	// 5. Start the main server, either with existing Let's Encrypt
+	// certificates, with certificates obtained on demand via ACME, or as
+	// plain HTTP behind a reverse proxy
+	log.Printf("Starting eBay GPT proxy server on %s (TLS mode: %s)...", listenAddr, tlsMode)
+	switch tlsMode {
+	case tlsModeAutocert:
+		enableAutocert(server, autocertDomains())
+		sslCertFile, sslKeyFile = "", ""
+	case tlsModeFiles:
+		log.Printf("Using SSL certificate: %s", sslCertFile)
+		log.Printf("Using SSL key: %s", sslKeyFile)
+		if servedCertificates, err = fileCertificates(sslCertFile); err != nil {
+			return fmt.Errorf("failed to read SSL certificate: %w", err)
+		}
+	}
+	// Reload the policy and redirect allowlist on SIGHUP while serving
+	reloadCtx, stopReloads := context.WithCancel(context.Background())
+	go reloadOnSignal(reloadCtx)
+	err = serve(server, tlsMode != tlsModeOff, sslCertFile, sslKeyFile)
+	stopReloads()
+
+	// Stop the background jobs and report the calls counted since the last
+	// report
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	proxyServer.Close(ctx)
+	cancel()
+	if err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("server error: %w", err)
+	}
+	return nil
+}
+
+// configure reads the configuration from the environment into the
+// process-wide state, starts the background jobs unless opts disables them,
+// and returns the routes. The jobs run until ctx is done.
+func configure(ctx context.Context, opts Options, secretsProvider secrets.Provider, loadedSecrets map[string]string) (http.Handler, error) {
 	// 1. Load configuration from Environment Variables
-	ebayClientID = os.Getenv("EBAY_CLIENT_ID")
-	ebayClientSecret = os.Getenv("EBAY_CLIENT_SECRET")
-	appRedirectURL := os.Getenv("APP_REDIRECT_URL") // <-- MUST be "https://ebayai.dev/callback"
+	ebayClientID := os.Getenv("EBAY_CLIENT_ID")
+	ebayClientSecret := os.Getenv("EBAY_CLIENT_SECRET")
+	appRedirectURL := os.Getenv("APP_REDIRECT_URL") // Comma-separated https://<domain>/callback URLs
 	ebayScopes := os.Getenv("EBAY_SCOPES")          // Space-separated list of scopes
-	ebayAPIHost = os.Getenv("EBAY_API_HOST")        // "api.ebay.com" or "api.sandbox.ebay.com"
+	ebayAPIHost := os.Getenv("EBAY_API_HOST")       // "api.ebay.com" or "api.sandbox.ebay.com"
 	ebayAuthURL := os.Getenv("EBAY_AUTH_URL")       // "https://auth.ebay.com/oauth2/authorize"
 	ebayTokenURL := os.Getenv("EBAY_TOKEN_URL")     // "https://api.ebay.com/identity/v1/oauth2/token"
-	sslCertFile := os.Getenv("SSL_CERTFILE")        // Path to SSL certificate file
-	sslKeyFile := os.Getenv("SSL_KEYFILE")          // Path to SSL key file
 
 	// !! CRITICAL !!
-	// Validate the APP_REDIRECT_URL for production
-	if appRedirectURL != "https://ebayai.dev/callback" {
-		log.Fatalf("FATAL: APP_REDIRECT_URL must be set to 'https://ebayai.dev/callback' for production. Found: %s", appRedirectURL)
+	// Validate the APP_REDIRECT_URL(s): https, pointing at /callback, and on a
+	// domain listed in APP_ALLOWED_DOMAINS (when set)
+	var err error
+	if appRedirectURLs, err = parseRedirectURLs(appRedirectURL, os.Getenv("APP_ALLOWED_DOMAINS")); err != nil {
+		return nil, err
 	}
 
 	// Basic validation
 	if ebayClientID == "" || ebayClientSecret == "" || ebayScopes == "" || ebayAPIHost == "" || ebayAuthURL == "" || ebayTokenURL == "" {
-		log.Fatal("Error: Missing required environment variables. \n" +
+		return nil, errors.New("missing required environment variables. \n" +
 			"Please set: EBAY_CLIENT_ID, EBAY_CLIENT_SECRET, APP_REDIRECT_URL, EBAY_SCOPES, EBAY_API_HOST, EBAY_AUTH_URL, EBAY_TOKEN_URL")
 	}
 
-	// Validate SSL certificate paths
-	if sslCertFile == "" || sslKeyFile == "" {
-		log.Fatal("Error: Missing SSL certificate configuration. \n" +
-			"Please set: SSL_CERTFILE, SSL_KEYFILE")
+	// Where /callback may send the browser back to
+	redirects, err := redirectAllowlistFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	clientRedirects.Store(&redirects)
+
+	// Clients allowed to redeem codes at /token (optional)
+	if tokenClients, err = tokenClientsFromEnv(); err != nil {
+		return nil, err
+	}
+
+	// Key sealing the OAuth state across /authorize and /callback
+	if states, err = stateSealerFromEnv(); err != nil {
+		return nil, err
+	}
+
+	// Signed internal API of the account backend (optional)
+	if backend, err = backendClientFromEnv(); err != nil {
+		return nil, err
+	}
+	if backend != nil && !opts.NoBackgroundJobs {
+		go backend.reportUsage(ctx)
+	}
+
+	// Load the proxy policy (path rules, tools, rate limits, scope mappings),
+	// from the backend when BACKEND_POLICY names one stored there
+	p, err := loadActivePolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := defaultToolProfile(); err != nil {
+		return nil, err
+	}
+	if err := applyPolicy(p); err != nil {
+		return nil, err
+	}
+
+	// Open the token vault used for manually linked accounts (optional)
+	if vaultFile := os.Getenv("VAULT_FILE"); vaultFile != "" {
+		if vault, err = openVault(vaultFile, os.Getenv("VAULT_KEY")); err != nil {
+			return nil, fmt.Errorf("failed to open token vault: %w", err)
+		}
+	}
+
+	// eBay signing keys for routes that require digital signatures
+	if signingKeys, err = loadSigningKeys(envOr("EBAY_SIGNING_KEY_FILE", "signing-keys.json")); err != nil {
+		return nil, err
+	}
+
+	// Audit trail (account deletions, manual linking)
+	if audit, err = openAuditLog(os.Getenv("AUDIT_LOG_FILE")); err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	auditProxyCalls = os.Getenv("AUDIT_PROXY_CALLS") == "true"
+
+	// eBay Notification API deliveries
+	dedupeTTL, err := notificationDedupeTTLFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if seenNotifications, err = openNotificationDedupe(os.Getenv("NOTIFICATION_DEDUPE_FILE"), dedupeTTL); err != nil {
+		return nil, fmt.Errorf("failed to open notification dedupe file: %w", err)
+	}
+	if notifications, err = openNotificationStore(os.Getenv("NOTIFICATIONS_FILE")); err != nil {
+		return nil, fmt.Errorf("failed to open notifications file: %w", err)
+	}
+	if urls := splitList(os.Getenv("WEBHOOK_FORWARD_URLS")); len(urls) > 0 {
+		notifications.Subscribe(forwardNotifications(urls))
+	}
+
+	// Keep buyer names, addresses and phones out of LLM conversations
+	minimizeBuyerPII = os.Getenv("MINIMIZE_BUYER_PII") == "true"
+
+	// Default eBay marketplace for proxied calls
+	if configuredMarketplace, err = marketplaceFromEnv(); err != nil {
+		return nil, err
+	}
+
+	// Retries and circuit breaking for eBay calls
+	if upstream, err = upstreamGuardFromEnv(); err != nil {
+		return nil, err
+	}
+	if maintenance, err = maintenanceFromEnv(); err != nil {
+		return nil, err
+	}
+
+	// Per-connection buffers of pushed messages
+	if err := pushSettingsFromEnv(); err != nil {
+		return nil, err
+	}
+
+	// Cache for eBay responses, access tokens and notification keys
+	if cache, err = cacheFromEnv(); err != nil {
+		return nil, err
+	}
+	log.Printf("Cache: %s", store.Describe(cache))
+
+	// Gradual rollout of subsystems (policy `flags`, FEATURE_FLAGS, FEATURE_FLAGS_URL)
+	if flags, err = featureFlagsFromEnv(func() []FlagRule { return currentPolicy().Flags }); err != nil {
+		return nil, err
+	}
+
+	// Thresholds for slow request / large response warnings
+	slowRequests = slowTrackerFromEnv()
+
+	// Anonymized usage statistics for /admin/usage-export
+	if usage, err = usageStatsFromEnv(); err != nil {
+		return nil, err
+	}
+
+	// Scheduled export of usage and sales to a warehouse (WAREHOUSE_URL)
+	if warehouse, err = warehouseFromEnv(); err != nil {
+		return nil, err
 	}
 
-	// 2. Initialize the oauth2.Config
-	// This config is for the flow between YOUR server and EBAY.
-	oauthConf = &oauth2.Config{
-		ClientID:     ebayClientID,
-		ClientSecret: ebayClientSecret,
-		RedirectURL:  appRedirectURL, // This is YOUR /callback endpoint
-		Scopes:       strings.Split(ebayScopes, " "),
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  ebayAuthURL,
-			TokenURL: ebayTokenURL,
-		},
+	// Request and buffered response size limits
+	if err := bodyLimitsFromEnv(); err != nil {
+		return nil, err
+	}
+	if maxAggregatePages, err = maxAggregatePagesFromEnv(); err != nil {
+		return nil, err
+	}
+
+	// Privacy policy and terms pages
+	if legalTemplates, err = loadLegalTemplates(os.Getenv("LEGAL_TEMPLATE_DIR")); err != nil {
+		return nil, err
+	}
+	checkLegalDetails()
+
+	// Generated files returned as signed download links
+	if attachments, err = attachmentStoreFromEnv(); err != nil {
+		return nil, err
+	}
+
+	// Captured /proxy calls for `ebay-mcp replay` (CAPTURE_DIR)
+	if captures, err = captureStoreFromEnv(); err != nil {
+		return nil, err
+	}
+
+	// MCP sessions of remote clients on /mcp
+	mcpHTTP, err := mcpEndpointFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if !opts.NoBackgroundJobs {
+		go mcpHTTP.reap(ctx)
+	}
+
+	// Category trees behind the category tools
+	if categoryTrees, err = categoryTreeStoreFromEnv(); err != nil {
+		return nil, err
+	}
+
+	// Request body schemas for the policy's validation section
+	if requestSchemas, err = requestSchemasFromEnv(); err != nil {
+		return nil, err
+	}
+
+	// 2. Initialize the eBay environments
+	// Each environment has its own oauth2.Config for the flow between YOUR
+	// server and EBAY. The EBAY_* keyset is the default; the other
+	// environment (sandbox or production) can be added with its own keyset.
+	primary := newEnvironment(environmentNameForHost(ebayAPIHost), ebayClientID, ebayClientSecret,
+		ebayScopes, ebayAPIHost, ebayAuthURL, ebayTokenURL)
+	environments[primary.Name] = primary
+	defaultEnvironment = primary.Name
+	if secondary := loadSecondaryEnvironment(primary.Name, ebayScopes); secondary != nil {
+		environments[secondary.Name] = secondary
+	}
+	log.Printf("eBay environments: %s (default: %s)", strings.Join(environmentNames(), ", "), defaultEnvironment)
+
+	// Further eBay applications served by this deployment (TENANTS_FILE)
+	registerDefaultTenant()
+	if err := loadTenants(os.Getenv("TENANTS_FILE"), ebayScopes); err != nil {
+		return nil, err
+	}
+	if len(tenants) > 1 {
+		log.Printf("Tenants: %s", strings.Join(tenantNames(), ", "))
+	}
+
+	// Pick up rotated secrets (SECRETS_REFRESH_INTERVAL)
+	var refreshInterval time.Duration
+	if v := os.Getenv("SECRETS_REFRESH_INTERVAL"); v != "" {
+		if refreshInterval, err = time.ParseDuration(v); err != nil || refreshInterval <= 0 {
+			return nil, fmt.Errorf("invalid SECRETS_REFRESH_INTERVAL %q", v)
+		}
+	}
+
+	// Check for configuration changes (CONFIG_RELOAD_INTERVAL)
+	reloadInterval, err := configReloadIntervalFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.NoBackgroundJobs {
+		if refreshInterval > 0 {
+			go watchSecrets(ctx, secretsProvider, refreshInterval, loadedSecrets)
+		}
+		if reloadInterval > 0 {
+			go watchConfig(ctx, reloadInterval)
+		}
+
+		// Answer Best Offers of linked accounts (policy `best_offers`)
+		startBestOfferEngine(ctx)
+
+		// Digest of listings that ended unsold (policy `unsold_triage`)
+		startUnsoldTriage(ctx)
+		if warehouse != nil {
+			warehouse.start(ctx)
+		}
 	}
 
 	// 3. Define HTTP handlers
 	// We create a router (mux) to hold all our handlers.
 	mux := http.NewServeMux()
-	mux.HandleFunc("/authorize", handleAuthorize) // OpenAI starts here
-	mux.HandleFunc("/callback", handleCallback)   // eBay redirects user here
-	mux.HandleFunc("/token", handleToken)         // OpenAI calls this to get token
-	mux.HandleFunc("/proxy/", handleProxy)        // OpenAI calls this for API requests
+	mux.HandleFunc("/authorize", handleAuthorize)                // OpenAI starts here
+	mux.HandleFunc("/callback", handleCallback)                  // eBay redirects user here
+	mux.HandleFunc("/token", handleToken)                        // OpenAI calls this to get token
+	mux.HandleFunc("/token/exchange", handleTokenExchange)       // Manual linking with a pasted refresh token
+	mux.HandleFunc("/proxy/", captureProxy(handleProxy))         // OpenAI calls this for API requests
+	mux.HandleFunc("/connection-status", handleConnectionStatus) // get_connection_status
+	mux.HandleFunc(unsoldReportPath, handleUnsoldReport)         // getUnsoldListingReport
+	mux.HandleFunc(ordersPath, handleOrders)                     // listOrders
+	mux.HandleFunc(ordersPath+"/", handleOrders)                 // getOrderSummary, markOrderShipped
+	mux.HandleFunc(sellerSetupPath, handleSellerSetup)           // setupSellerAccount
+	mux.HandleFunc(categoriesPath+"/", handleCategories)         // get_category_suggestions, get_item_aspects_for_category
+	mux.HandleFunc(createListingPath, handleCreateListing)       // createListing
+	mux.HandleFunc(imagesPath, handleImageUpload)                // uploadImage
+	mux.HandleFunc(purchasePreparePath, handlePurchasePrepare)   // preparePurchase
+	mux.HandleFunc(purchaseConfirmPath, handlePurchaseConfirm)   // confirmPurchase
+	mux.HandleFunc(feedTasksPath+"/", handleFeedTasks)           // getFeedTaskStatus
+	mux.HandleFunc(tradingBridgePath+"/", handleTradingBridge)   // trading*
+	mux.HandleFunc(soldPricesPath, handleSoldPrices)             // research_sold_prices
+	mux.HandleFunc("/health/upstream", handleUpstreamHealth)
+	mux.HandleFunc("/healthz", handleHealthz) // Liveness probe
+	mux.HandleFunc("/readyz", handleReadyz)   // Readiness probe, per-dependency status
+	mux.HandleFunc("/metrics", handleMetrics) // Prometheus metrics
+	mux.HandleFunc("/privacy", handleLegalPage("privacy"))
+	mux.HandleFunc("/terms", handleLegalPage("terms"))
+	mux.HandleFunc("/.well-known/ai-plugin.json", handlePluginManifest)
+	mux.HandleFunc("/openapi.json", handleOpenAPI)    // GPT Actions schema
+	mux.HandleFunc("/attachments/", handleAttachment) // Signed download links for generated files
+	mux.HandleFunc(accountDeletionPath, handleAccountDeletion)
+	mux.HandleFunc(webhookPath, handleEbayWebhook)
+	mux.Handle("/mcp", mcpHTTP) // MCP clients over Streamable HTTP
+	mux.HandleFunc(mcpResourcePath, mcpHTTP.handleProtectedResource)
+	mux.HandleFunc(mcpResourcePath+"/mcp", mcpHTTP.handleProtectedResource)
+	mux.HandleFunc("/admin/slow-operations", requireAdmin(handleSlowOperations))
+	mux.HandleFunc("/admin/audit", requireAdmin(handleAuditLog))
+	mux.HandleFunc("/admin/captures/", requireAdmin(handleAdminCapture))
+	mux.HandleFunc("/admin/usage-export", requireAdmin(handleUsageExport))
+	mux.HandleFunc("/admin/cache", requireAdmin(handleAdminCache))
+	mux.HandleFunc("/admin/action-bundle", requireAdmin(handleActionBundle))
+	mux.HandleFunc("/admin/notifications/subscriptions", requireAdmin(handleAdminSubscriptions))
+	mux.HandleFunc("/admin/notifications/subscriptions/", requireAdmin(handleAdminSubscriptions))
+	mux.HandleFunc("/admin/notifications/recent", requireAdmin(handleRecentNotifications))
+	mux.HandleFunc("/admin/notifications/stream", requireAdmin(handleNotificationStream))
+	mux.HandleFunc("/api/admin/keyset/validate", requireAdmin(handleValidateKeyset))
+	mux.HandleFunc("/admin/best-offers/run", requireAdmin(handleBestOfferRun))
+	mux.HandleFunc("/admin/unsold-triage/run", requireAdmin(handleUnsoldTriageRun))
+	mux.HandleFunc("/admin/warehouse/run", requireAdmin(handleWarehouseRun))
+	mux.HandleFunc("/admin/reload", requireAdmin(handleAdminReload))
+	mux.HandleFunc("/admin/sandbox-users", requireAdmin(handleSandboxUsers))
+	mux.HandleFunc("/admin/sandbox-users/", requireAdmin(handleSandboxUsers))
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintln(w, "eBay GPT Action Proxy is running securely on https://ebayai.dev")
+		fmt.Fprintf(w, "eBay GPT Action Proxy is running on %s\n", externalBaseURL(r))
 	})
 
-	// 4. Configure the main HTTPS server using existing certificates
 	// Wrap the mux with logging middleware to log all requests
-	server := &http.Server{
-		Addr:    ":443",                 // Listen on port 443
-		Handler: loggingMiddleware(mux), // Use the router wrapped with logging
-	}
-
-	// 5. Start the main HTTPS server with existing Let's Encrypt certificates
-	log.Println("Starting eBay GPT proxy server on https://ebayai.dev (port 443)...")
-	log.Printf("Using SSL certificate: %s", sslCertFile)
-	log.Printf("Using SSL key: %s", sslKeyFile)
-	if err := server.ListenAndServeTLS(sslCertFile, sslKeyFile); err != nil {
-		log.Fatalf("HTTPS server error: %v", err)
-	}
+	handler := loggingMiddleware(selectTenant(limitRequestBody(limitConcurrency(mux))))
+	mcpHTTP.proxy = handler
+	return handler, nil
 }
 
 // ### OAuth Handlers (OpenAI Flow) ###########################################
@@ -130,14 +444,34 @@ func handleAuthorize(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing required parameters: redirect_uri and state", http.StatusBadRequest)
 		return
 	}
+	if !redirectAllowed(openAIRedirectURI, currentRedirects()) {
+		log.Printf("Rejected authorization with redirect_uri %q (not in OAUTH_REDIRECT_ALLOWLIST)", openAIRedirectURI)
+		http.Error(w, "redirect_uri is not allowed", http.StatusBadRequest)
+		return
+	}
+
+	// Pick the eBay environment (production by default, or ?ebay_env=sandbox)
+	env, err := environmentFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// 2. Store OpenAI's redirect_uri, keyed by state
-	log.Printf("Storing state: %s -> %s", state, openAIRedirectURI)
-	stateStore[state] = openAIRedirectURI
+	// 2. Seal OpenAI's redirect_uri and state into the state we give eBay
+	sealed, err := states.Seal(openAIRedirectURI, state, time.Now())
+	if err != nil {
+		log.Printf("Failed to seal OAuth state: %v", err)
+		http.Error(w, "Failed to start authorization", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Starting authorization for redirect_uri %s", openAIRedirectURI)
 
 	// 3. Generate the eBay auth URL and redirect the user's browser
 	// We use AccessTypeOffline to request a refresh token
-	url := oauthConf.AuthCodeURL(state, oauth2.AccessTypeOffline)
+	// The callback must be on the same domain the user started on
+	conf := *env.OAuth
+	conf.RedirectURL = redirectURLFor(r)
+	url := conf.AuthCodeURL(sealed, oauth2.AccessTypeOffline)
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
@@ -152,18 +486,21 @@ func handleCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 2. Retrieve the original OpenAI redirect_uri from our store
-	openAIRedirectURI, ok := stateStore[state]
-	if !ok {
-		log.Println("Invalid or expired OAuth state received")
-		http.Error(w, "Invalid state", http.StatusBadRequest)
+	// 2. Recover OpenAI's redirect_uri and state from the sealed state
+	st, err := states.Open(r.Context(), state, time.Now())
+	if err != nil {
+		log.Printf("Rejected OAuth callback: %v", err)
+		if errors.Is(err, errStateInvalid) || errors.Is(err, errStateExpired) || errors.Is(err, errStateReused) {
+			http.Error(w, "Invalid state", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Can't verify the state right now", http.StatusServiceUnavailable)
+		}
 		return
 	}
-	delete(stateStore, state) // State is single-use
 
 	// 3. Redirect back to OpenAI's callback URL, passing along the code.
 	// OpenAI will then call our /token endpoint.
-	redirectURL, err := url.Parse(openAIRedirectURI)
+	redirectURL, err := url.Parse(st.RedirectURI)
 	if err != nil {
 		log.Printf("Invalid OpenAI redirect_uri: %v", err)
 		http.Error(w, "Invalid redirect_uri", http.StatusInternalServerError)
@@ -172,13 +509,17 @@ func handleCallback(w http.ResponseWriter, r *http.Request) {
 
 	q := redirectURL.Query()
 	q.Set("code", code)
-	q.Set("state", state)
+	q.Set("state", st.State)
 	redirectURL.RawQuery = q.Encode()
 
 	log.Printf("Redirecting back to OpenAI: %s", redirectURL.String())
 	http.Redirect(w, r, redirectURL.String(), http.StatusTemporaryRedirect)
 }
 
+// authorizationCodeTTL is how long redeemed authorization codes are
+// remembered; eBay's codes expire after five minutes.
+const authorizationCodeTTL = 10 * time.Minute
+
 // handleToken: Called by OpenAI's backend to exchange the code for a token
 // or to refresh an existing token.
 // This endpoint is *not* called by a user's browser.
@@ -191,10 +532,23 @@ func handleToken(w http.ResponseWriter, r *http.Request) {
 	// Parse the form data from OpenAI
 	if err := r.ParseForm(); err != nil {
 		log.Printf("Failed to parse form: %v", err)
+		if isBodyTooLarge(err) {
+			writeBodyTooLarge(w, maxRequestBodySize)
+			return
+		}
 		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
 		return
 	}
 
+	// Only the clients in OAUTH_CLIENTS may redeem codes, when it is set
+	clientID, ok := authenticateTokenClient(r)
+	if !ok {
+		log.Printf("Rejected token request: unknown client or wrong secret")
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
 	// Extract parameters from OpenAI's request
 	code := r.Form.Get("code")
 	grantType := r.Form.Get("grant_type")
@@ -204,6 +558,13 @@ func handleToken(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Token request - grant_type: %s, has_code: %v, has_refresh_token: %v, redirect_uri: %s",
 		grantType, code != "", refreshToken != "", redirectURI)
 
+	// The code or refresh token must be redeemed in the environment that issued it
+	env, err := environmentFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Build the form data to send to eBay with correct parameters
 	formData := url.Values{}
 
@@ -212,73 +573,75 @@ func handleToken(w http.ResponseWriter, r *http.Request) {
 		// eBay requires the redirect_uri and scope even for refresh tokens
 		formData.Set("grant_type", "refresh_token")
 		formData.Set("refresh_token", refreshToken)
-		formData.Set("redirect_uri", oauthConf.RedirectURL)
+		formData.Set("redirect_uri", redirectURLFor(r))
 		// Include the same scopes that were used in the original authorization
-		formData.Set("scope", strings.Join(oauthConf.Scopes, " "))
+		formData.Set("scope", strings.Join(env.OAuth.Scopes, " "))
 	} else if code != "" {
 		// Handle authorization code flow
 		formData.Set("grant_type", "authorization_code")
 		formData.Set("code", code)
 		// IMPORTANT: Must use OUR redirect_uri (not OpenAI's) because that's what
 		// we used in the authorization request and what's registered with eBay
-		formData.Set("redirect_uri", oauthConf.RedirectURL)
+		formData.Set("redirect_uri", redirectURLFor(r))
 	} else {
 		log.Printf("Invalid token request: missing code or refresh_token")
 		http.Error(w, "Missing required parameters", http.StatusBadRequest)
 		return
 	}
 
-	// Log what we're sending to eBay
-	log.Printf("Sending to eBay token endpoint: %s", formData.Encode())
-
-	// Create a new request to eBay's token endpoint
-	proxyReq, err := http.NewRequestWithContext(context.Background(), "POST",
-		oauthConf.Endpoint.TokenURL, strings.NewReader(formData.Encode()))
-	if err != nil {
-		log.Printf("Failed to create proxy request: %v", err)
-		http.Error(w, "Failed to create proxy request", http.StatusInternalServerError)
-		return
+	// A code is redeemed once: when a client retries against several replicas
+	// at the same time, only one of them asks eBay
+	codeClaimed := false
+	if formData.Get("grant_type") == "authorization_code" {
+		claimed, err := stateCache.Claim(r.Context(), "code", tokenHash(code), authorizationCodeTTL)
+		if err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+				"error":             "temporarily_unavailable",
+				"error_description": "can't redeem authorization codes right now",
+			})
+			return
+		}
+		if !claimed {
+			log.Printf("Authorization code is already being redeemed")
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error":             "invalid_grant",
+				"error_description": "authorization code already used",
+			})
+			return
+		}
+		codeClaimed = true
 	}
 
-	// --- This is the critical part ---
-	// Add the Basic Auth header using the server's *secret* credentials
-	auth := base64.StdEncoding.EncodeToString([]byte(ebayClientID + ":" + ebayClientSecret))
-	proxyReq.Header.Set("Authorization", "Basic "+auth)
-
-	// Set the Content-Type header
-	proxyReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	// Send the request to eBay
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(proxyReq)
+	// Log what we're sending to eBay
+	log.Printf("Sending to eBay token endpoint: grant_type=%s", formData.Get("grant_type"))
+
+	// Send the request to eBay's token endpoint using the server's credentials
+	resp, bodyBytes, err := postTokenRequest(r.Context(), env, formData)
+	if err != nil || resp.StatusCode >= 500 {
+		// eBay never saw the code or failed on it: let the client retry
+		if codeClaimed {
+			stateCache.Delete(r.Context(), "code", tokenHash(code))
+		}
+	}
 	if err != nil {
-		log.Printf("Failed to send request to eBay token endpoint: %v", err)
+		log.Printf("Failed to call eBay token endpoint: %v", err)
 		http.Error(w, "Failed to send request to token endpoint", http.StatusBadGateway)
 		return
 	}
-	defer resp.Body.Close()
 
 	// Log the response status from eBay
 	log.Printf("eBay token endpoint response: %d", resp.StatusCode)
 
-	// Read the response body from eBay
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Failed to read eBay response: %v", err)
-		http.Error(w, "Failed to read token response", http.StatusInternalServerError)
-		return
-	}
-
 	// If there was an error, log and return it
 	if resp.StatusCode >= 400 {
-		log.Printf("eBay error response: %s", string(bodyBytes))
+		log.Printf("eBay error response: %s", currentRedactor().Redact(bodyBytes))
 		copyHeaders(w.Header(), resp.Header)
 		w.WriteHeader(resp.StatusCode)
 		w.Write(bodyBytes)
 		return
 	}
 
-	// Parse the successful token response to modify token_type
+	// Parse the successful token response to rewrite it
 	var tokenResponse map[string]interface{}
 	if err := json.Unmarshal(bodyBytes, &tokenResponse); err != nil {
 		log.Printf("Failed to parse eBay token response: %v", err)
@@ -289,13 +652,22 @@ func handleToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// eBay returns "token_type": "User Access Token" but OAuth 2.0 standard expects "Bearer"
-	// Normalize the token_type to "Bearer" for compatibility with ChatGPT
-	if _, ok := tokenResponse["token_type"]; ok {
-		log.Printf("Original token_type from eBay: %v", tokenResponse["token_type"])
-		tokenResponse["token_type"] = "Bearer"
+	// Remember what the access token was issued for (see tokens.go)
+	if accessToken, _ := tokenResponse["access_token"].(string); accessToken != "" {
+		expiresIn, _ := tokenResponse["expires_in"].(float64)
+		issuedTokens.Record(r.Context(), accessToken, tokenInfo{
+			Tenant:      env.Tenant,
+			Environment: env.Name,
+			Scopes:      env.OAuth.Scopes,
+			IssuedAt:    time.Now(),
+			ExpiresAt:   time.Now().Add(time.Duration(expiresIn) * time.Second),
+		})
 	}
 
+	// eBay returns "token_type": "User Access Token" but OAuth 2.0 standard expects "Bearer";
+	// the policy's token_response rules fix this and other fields clients choke on
+	rewriteTokenResponse(currentPolicy(), tokenResponse, clientID)
+
 	// Re-encode the modified response
 	modifiedBody, err := json.Marshal(tokenResponse)
 	if err != nil {
@@ -307,7 +679,7 @@ func handleToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Modified token response: %s", string(modifiedBody))
+	log.Printf("Modified token response: %s", currentRedactor().Redact(modifiedBody))
 
 	// Send the modified response to OpenAI
 	copyHeaders(w.Header(), resp.Header)
@@ -317,6 +689,42 @@ func handleToken(w http.ResponseWriter, r *http.Request) {
 	w.Write(modifiedBody)
 }
 
+// postTokenRequest sends formData to env's token endpoint, authenticating
+// with the server's client credentials, and returns the response and its
+// fully-read body.
+func postTokenRequest(ctx context.Context, env *ebayEnvironment, formData url.Values) (*http.Response, []byte, error) {
+	// Create a new request to eBay's token endpoint
+	proxyReq, err := http.NewRequestWithContext(ctx, "POST",
+		env.OAuth.Endpoint.TokenURL, strings.NewReader(formData.Encode()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+
+	// --- This is the critical part ---
+	// Add the Basic Auth header using the server's *secret* credentials
+	auth := base64.StdEncoding.EncodeToString([]byte(env.ClientID + ":" + env.clientSecret()))
+	proxyReq.Header.Set("Authorization", "Basic "+auth)
+
+	// Set the Content-Type header
+	proxyReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Send the request to eBay
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(proxyReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read the response body from eBay
+	bodyBytes, err := readLimited(resp.Body, maxResponseBufferSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	return resp, bodyBytes, nil
+}
+
 // ### API Proxy Handler (OpenAI Flow) ########################################
 
 // handleProxy: Called by OpenAI for all API requests.
@@ -335,28 +743,239 @@ func handleProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	accessToken := parts[1]
+	callerToken := accessToken
 
-	// 2. Create the reverse proxy to eBay
-	targetURL, _ := url.Parse("https://" + ebayAPIHost)
-	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	// Pick the eBay environment (production by default, or ?ebay_env=sandbox)
+	env, err := environmentFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Enable HTTP/2 properly for eBay API
-	// eBay requires HTTP/2, so we need to enable it with proper configuration
-	proxy.Transport = &http.Transport{
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		ResponseHeaderTimeout: 45 * time.Second, // Increased timeout for eBay API
-		IdleConnTimeout:       90 * time.Second, // Keep idle connections for 90 seconds
-		MaxIdleConns:          100,              // Maximum idle connections
-		MaxIdleConnsPerHost:   10,               // Maximum idle connections per host
-		MaxConnsPerHost:       50,               // Maximum total connections per host
-		DisableKeepAlives:     false,            // Enable keep-alives for better performance
-		ForceAttemptHTTP2:     true,             // Enable HTTP/2
+	// Per-token rate limit from the policy, reported on every response
+	rateState := takeRateLimit(r.Context(), accessToken)
+	if rateState != nil && !rateState.Allowed {
+		setRateLimitHeaders(w.Header(), *rateState)
+		loc := localizerFor(r, "", "")
+		loc.setContentLanguage(w)
+		http.Error(w, loc.T("ratelimit.exceeded"), http.StatusTooManyRequests)
+		return
 	}
 
+	// Resolve manually linked accounts ("vault:<id>" API keys) and tokens of
+	// the backend's users to a real token; the linked account determines the
+	// environment
+	preferredMarketplace, preferredLanguage := "", ""
+	var grantedScopes []string // nil when we don't know what the token was granted
+	var identity *backendToken // set for tokens of the backend
+	if isVaultReference(accessToken) {
+		token, entry, err := vaultAccessToken(r.Context(), accessToken)
+		if err == nil && !tenantFor(r).has(entry.environment()) {
+			err = errOtherTenant
+		}
+		if err != nil {
+			log.Printf("Failed to resolve vault reference: %v", err)
+			loc := localizerFor(r, "", "")
+			loc.setContentLanguage(w)
+			http.Error(w, loc.T("vault.invalid"), http.StatusUnauthorized)
+			return
+		}
+		accessToken = token
+		env = entry.environment()
+		preferredMarketplace = entry.Marketplace
+		preferredLanguage = entry.Language
+		grantedScopes = entry.Scopes
+	} else if backend != nil && !isEbayToken(accessToken) {
+		token, entry, id, err := backend.AccessToken(r.Context(), accessToken, env.Name)
+		if err == nil && !tenantFor(r).has(entry.environment()) {
+			err = errOtherTenant
+		}
+		if err != nil {
+			log.Printf("Failed to resolve backend token: %v", err)
+			loc := localizerFor(r, "", "")
+			loc.setContentLanguage(w)
+			switch {
+			case errors.Is(err, errBackendUnavailable):
+				http.Error(w, loc.T("backend.unavailable"), http.StatusServiceUnavailable)
+			case errors.Is(err, errNoLinkedAccount):
+				http.Error(w, loc.T("backend.unlinked", env.Name), http.StatusUnauthorized)
+			default:
+				http.Error(w, loc.T("vault.invalid"), http.StatusUnauthorized)
+			}
+			return
+		}
+		accessToken = token
+		env = entry.environment()
+		preferredMarketplace = entry.Marketplace
+		preferredLanguage = entry.Language
+		grantedScopes = entry.Scopes
+		identity = id
+	} else if grantedScopes, err = issuedTokenScopes(r.Context(), env, accessToken); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Pick the eBay marketplace (EBAY_US unless the request or account says otherwise)
+	marketplace, err := marketplaceFor(r, preferredMarketplace)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	loc := localizerFor(r, preferredLanguage, marketplace)
+
 	// Store the path we'll actually send to eBay for logging
 	strippedPath := strings.TrimPrefix(r.URL.Path, "/proxy")
 
+	// The policy for this request, even if it is reloaded meanwhile
+	pol := currentPolicy()
+
+	// Don't forward our own selector parameters to eBay
+	rawQuery := r.URL.RawQuery
+	ownParams := []string{envSelectorParam, fieldsParam, aggregatePagesParam, attachmentParam}
+	if !forwardsMarketplaceParam(strippedPath) {
+		ownParams = append(ownParams, marketplaceParam)
+	}
+	if q := r.URL.Query(); hasAny(q, ownParams) {
+		for _, name := range ownParams {
+			q.Del(name)
+		}
+		rawQuery = q.Encode()
+	}
+	stripPII := stripsBuyerPII(strippedPath)
+	transform := transformFor(pol, r.Method, strippedPath, r.URL.Query().Get(fieldsParam))
+	aggregation, err := aggregationFor(r.Method, strippedPath, r.URL.Query().Get(aggregatePagesParam))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	compressionRule := pol.compressionRuleFor(strippedPath)
+	attachmentMode := r.URL.Query().Get(attachmentParam)
+	if attachmentMode != "" && attachmentMode != "true" && attachmentMode != "false" {
+		http.Error(w, attachmentParam+" must be true or false", http.StatusBadRequest)
+		return
+	}
+	baseURL := externalBaseURL(r)
+
+	// Deny anything the operator's policy doesn't allow before touching eBay
+	if err := pol.AllowPath(r.Method, strippedPath); err != nil {
+		log.Printf("Policy denied request: %v", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Purchases need the confirmation step of the purchase tools
+	if isPurchaseCommit(r.Method, strippedPath) {
+		http.Error(w, "Bids and orders can only be placed with preparePurchase and confirmPurchase", http.StatusForbidden)
+		return
+	}
+
+	// Fail fast with the missing scope instead of eBay's generic 403
+	required := pol.RequiredScopes(r.Method, strippedPath)
+	if grantedScopes != nil {
+		if err := checkScopes(grantedScopes, required); err != nil {
+			log.Printf("Scope check failed for %s %s: %v", r.Method, strippedPath, err)
+			writeInsufficientScope(w, loc, r.Method, strippedPath, required)
+			return
+		}
+	}
+
+	// Tokens of the backend only reach the routes their own scopes cover
+	if identity != nil {
+		if err := checkScopes(backendScopes(identity), required); err != nil {
+			log.Printf("Backend token scope check failed for %s %s: %v", r.Method, strippedPath, err)
+			writeInsufficientScope(w, loc, r.Method, strippedPath, required)
+			return
+		}
+	}
+
+	// Catch promotions eBay would reject before spending a call on them
+	if !checkPromotion(w, r, strippedPath, loc) {
+		return
+	}
+
+	// Check bodies against eBay's schemas when the policy asks for it
+	if !checkRequestSchema(w, r, pol, strippedPath, loc) {
+		return
+	}
+
+	// Run writes with an Idempotency-Key once, replaying their response to
+	// retries
+	idempotent, ok := beginIdempotentCall(w, r, pol, callerToken, env.key(), strippedPath, rateState, compressionRule)
+	if !ok {
+		return
+	}
+	if idempotent != nil {
+		defer idempotent.finish(r.Context())
+		var cancel context.CancelFunc
+		r, cancel = idempotent.detach(r)
+		defer cancel()
+	}
+
+	// Bound the eBay call by the route's timeout; the client going away
+	// cancels it as well
+	if timeout := pol.upstreamTimeoutFor(strippedPath); timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	// Feature flags are decided per environment and caller
+	flagSubj := flagSubject{Tenant: env.key(), Key: tokenHash(callerToken)}
+
+	// Replay cacheable reads from the response cache
+	var cacheRule *CacheRule
+	var cacheScope, cacheKey string
+	if r.Method == http.MethodGet && attachmentMode != "true" && flags.IsEnabled(r.Context(), flagResponseCache, flagSubj) {
+		if cacheRule = pol.cacheRuleFor(strippedPath); cacheRule != nil {
+			cacheScope = cacheScopeFor(cacheRule, callerToken)
+			cacheKey = responseCacheKey(r, env.key(), marketplace, strippedPath)
+			if wantsCachedResponse(r) {
+				if cached, ok := lookupCachedResponse(r.Context(), cacheScope, cacheKey); ok {
+					log.Printf("Serving %s %s from the response cache", r.Method, strippedPath)
+					if err := serveCachedResponse(w, r, cached, rateState, compressionRule); err != nil {
+						log.Printf("Failed to write cached response: %v", err)
+					}
+					return
+				}
+			}
+		}
+	}
+
+	// Routes that need an RFC 9421 signature: fetch the key and buffer the
+	// body up front, since the Director can't fail
+	var signKey *signingKey
+	var signBody []byte
+	if requiresSignature(strippedPath) && flags.IsEnabled(r.Context(), flagSignatures, flagSubj) {
+		if signKey, err = signingKeys.Key(r.Context(), env); err != nil {
+			log.Printf("Failed to get eBay signing key: %v", err)
+			http.Error(w, "Request signing is unavailable", http.StatusBadGateway)
+			return
+		}
+		if signBody, err = io.ReadAll(r.Body); err != nil {
+			if isBodyTooLarge(err) {
+				writeBodyTooLarge(w, requestBodyLimit(r.URL.Path))
+				return
+			}
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(signBody))
+	}
+
+	// 2. Create the reverse proxy to eBay
+	targetURL, _ := url.Parse("https://" + apiHostFor(env, strippedPath))
+	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+
+	// Retry transient eBay failures and fail fast while eBay is down or in
+	// maintenance
+	proxy.Transport = &maintenanceTransport{base: &retryTransport{base: proxyTransport, guard: upstream}}
+
+	// Stream responses (e.g. Feed API downloads) as they arrive
+	proxy.FlushInterval = -1
+
+	// The client's encodings, since the Director replaces Accept-Encoding
+	clientEncoding := r.Header.Get("Accept-Encoding")
+
 	// 3. Set the Director to modify the request *before* it's sent to eBay
 	proxy.Director = func(req *http.Request) {
 		// Set the target host and scheme
@@ -367,7 +986,7 @@ func handleProxy(w http.ResponseWriter, r *http.Request) {
 		// Set the correct API path by stripping our /proxy prefix
 		// e.g., /proxy/sell/inventory/v1/item_summary/search -> /sell/inventory/v1/item_summary/search
 		req.URL.Path = strippedPath
-		req.URL.RawQuery = r.URL.RawQuery // Preserve query parameters
+		req.URL.RawQuery = rawQuery // Preserve query parameters
 
 		log.Printf("Proxying to eBay: %s %s%s?%s", req.Method, req.URL.Host, req.URL.Path, req.URL.RawQuery)
 
@@ -377,11 +996,19 @@ func handleProxy(w http.ResponseWriter, r *http.Request) {
 
 		// Set required headers for eBay API
 		req.Header.Set("Accept", "application/json")
-		req.Header.Set("Content-Type", "application/json")
+		if !isFeedUpload(req.URL.Path) {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		setMarketplaceHeaders(req, marketplace)
+
+		// Always ask for gzip; ModifyResponse re-encodes for the client
+		req.Header.Set("Accept-Encoding", "gzip")
 
 		// Clean up headers not meant for eBay
 		// Remove all OpenAI/ChatGPT specific headers that might confuse eBay
 		req.Header.Del("Cookie")
+		req.Header.Del(envSelectorHeader)
+		req.Header.Del(idempotencyKeyHeader)
 		req.Header.Del("Openai-Conversation-Id")
 		req.Header.Del("Openai-Ephemeral-User-Id")
 		req.Header.Del("Openai-Gpt-Id")
@@ -396,6 +1023,13 @@ func handleProxy(w http.ResponseWriter, r *http.Request) {
 		// Set a clean User-Agent
 		req.Header.Set("User-Agent", "eBay-Proxy/1.0")
 
+		if signKey != nil {
+			if env.Name == envSandbox {
+				req.Header.Set("x-ebay-enforce-signature", "true")
+			}
+			signRequest(req, signKey, signBody, time.Now())
+		}
+
 		// Log the outgoing headers (mask the token for security)
 		maskedHeaders := make(map[string][]string)
 		for k, v := range req.Header {
@@ -413,47 +1047,193 @@ func handleProxy(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Received response from eBay: Status %d %s", resp.StatusCode, resp.Status)
 		log.Printf("Response headers from eBay: %v", resp.Header)
 
-		// If there's an error status, log the response body
+		// eBay's own rate-limit headers (and Retry-After on 429) pass through
+		// untouched; ours describe the proxy's limiter
+		if rateState != nil {
+			setRateLimitHeaders(resp.Header, *rateState)
+		}
+
+		// Files become signed download links instead of inline content
+		if wantsAttachment(resp, attachmentMode) {
+			if err := decodeBody(resp); err != nil {
+				return err
+			}
+			if err := storeAttachment(resp, baseURL); err != nil {
+				return err
+			}
+			return negotiateEncoding(resp, clientEncoding, compressionRule)
+		}
+
+		// Bodies the proxy reads must be decoded first
+		if resp.StatusCode >= 400 || stripPII || transform != nil || aggregation != nil {
+			if err := decodeBody(resp); err != nil {
+				return err
+			}
+		}
+
+		// If there's an error status, log the start of the response body;
+		// the whole body still streams to the client
 		if resp.StatusCode >= 400 {
-			bodyBytes, err := io.ReadAll(resp.Body)
+			bodyBytes, err := peekBody(resp, errorBodyLogLimit)
 			if err != nil {
 				log.Printf("Failed to read error response body: %v", err)
 				return err
 			}
-			log.Printf("eBay API error response body: %s", string(bodyBytes))
-
-			// Restore the body for the client
-			resp.Body = io.NopCloser(strings.NewReader(string(bodyBytes)))
+			log.Printf("eBay API error response body: %s", currentRedactor().Redact(bodyBytes))
+			if err := addErrorHints(resp, loc); err != nil {
+				return err
+			}
+		} else {
+			if aggregation != nil && resp.StatusCode == http.StatusOK {
+				if err := aggregation.apply(resp, proxy.Transport); err != nil {
+					return err
+				}
+			}
+			if stripPII {
+				if err := stripBuyerPII(resp); err != nil {
+					return err
+				}
+			}
+			if transform != nil {
+				if err := transformResponse(resp, transform); err != nil {
+					return err
+				}
+			}
+			if cacheRule != nil && resp.StatusCode == http.StatusOK {
+				if err := storeCachedResponse(resp, cacheScope, cacheKey, cacheRule.TTL); err != nil {
+					return err
+				}
+			}
+		}
+		if idempotent != nil {
+			if err := idempotent.store(resp); err != nil {
+				return err
+			}
 		}
 
-		return nil
+		return negotiateEncoding(resp, clientEncoding, compressionRule)
 	}
 
 	// 5. Add error handler to log proxy errors
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			log.Printf("Timed out waiting for %s %s%s", r.Method, targetURL.Host, strippedPath)
+			http.Error(w, "eBay did not answer in time", http.StatusGatewayTimeout)
+			return
+		}
+		if r.Context().Err() != nil {
+			// The client went away; its context already aborted the eBay call
+			log.Printf("Client disconnected, cancelled %s %s%s", r.Method, targetURL.Host, strippedPath)
+			w.WriteHeader(statusClientClosedRequest)
+			return
+		}
 		log.Printf("PROXY ERROR: %v", err)
 		log.Printf("Failed request: %s %s", r.Method, r.URL.String())
 		log.Printf("Target was: %s%s", targetURL.Host, strippedPath)
+		if isBodyTooLarge(err) {
+			writeBodyTooLarge(w, requestBodyLimit(r.URL.Path))
+			return
+		}
+		if errors.Is(err, errResponseTooLarge) {
+			http.Error(w, "eBay response too large to process", http.StatusBadGateway)
+			return
+		}
+		var me *maintenanceError
+		if errors.As(err, &me) {
+			writeMaintenance(w, me)
+			return
+		}
+		if errors.Is(err, errCircuitOpen) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(breakerCooldown.Seconds())))
+			http.Error(w, "eBay is currently unavailable, try again shortly", http.StatusServiceUnavailable)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Proxy error: %v", err), http.StatusBadGateway)
 	}
 
-	// 6. Serve the request with timing
-	log.Printf("Proxying %s request to %s%s", r.Method, targetURL.Host, strippedPath)
+	// 6. Serve the request with timing, recording per-operation metrics
+	operation := operationFor(strippedPath)
+	log.Printf("Proxying %s request to %s%s (operation %s)", r.Method, targetURL.Host, strippedPath, operation)
 	startTime := time.Now()
-	proxy.ServeHTTP(w, r)
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	proxy.ServeHTTP(rec, r)
 	elapsed := time.Since(startTime)
+	metrics.ObserveProxy(operation, r.Method, rec.status, elapsed)
+	slowRequests.Observe(operation, elapsed, rec.bytes)
+	usage.Observe(operation, r.Method, tokenHash(callerToken), rec.status, elapsed, time.Now())
+	if identity != nil {
+		backend.RecordUsage(identity, operation, rec.status, time.Now())
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && rec.status < 400 {
+		// Let the caller read their own writes
+		responseCache.Invalidate(context.WithoutCancel(r.Context()), tokenHash(callerToken))
+	}
+	if auditProxyCalls {
+		audit.Record("proxy.call", map[string]string{
+			"method":      r.Method,
+			"path":        strippedPath,
+			"operation":   operation,
+			"status":      strconv.Itoa(rec.status),
+			"environment": env.Name,
+			"marketplace": marketplace,
+			"token_hash":  tokenHash(callerToken),
+		})
+	}
 	log.Printf("eBay API request completed in %v", elapsed)
 }
 
 // ### Helper Functions #######################################################
 
+// RunCommand runs the command-line subcommand in args, e.g.
+// `config export` or `mcp`.
+func RunCommand(args []string) error {
+	// `config check` loads the secrets itself, once the settings saying
+	// where they are are known to be valid. The others run with the secrets
+	// from SECRETS_BACKEND in the environment.
+	if len(args) > 1 && args[0] == "config" && args[1] == "check" {
+		return runConfigCheck(args[2:])
+	}
+	if _, _, err := loadSecretsFromEnv(); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "config":
+		return runConfigCommand(args[1:])
+	case "sandbox":
+		return runSandboxCommand(args[1:])
+	case "gen-openapi":
+		return runGenOpenAPICommand(args[1:])
+	case "action-bundle":
+		return runActionBundleCommand(args[1:])
+	case "mcp":
+		return runMCPCommand(args[1:])
+	case "archive":
+		return runArchiveCommand(args[1:])
+	case "replay":
+		return runReplayCommand(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// hasAny reports whether q has any of the named parameters.
+func hasAny(q url.Values, names []string) bool {
+	for _, name := range names {
+		if q.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
 // loggingMiddleware logs all incoming HTTP requests
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
 		// Log request details
-		log.Printf("[REQUEST] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		log.Printf("[REQUEST] %s %s from %s", r.Method, r.URL.Path, clientIP(r))
 		log.Printf("[REQUEST] Headers: %v", r.Header)
 		log.Printf("[REQUEST] Query: %v", r.URL.RawQuery)
 
@@ -0,0 +1,260 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ### eBay Maintenance #######################################################
+
+// eBay takes its APIs down for scheduled maintenance. Windows announced in
+// advance are configured with EBAY_MAINTENANCE_WINDOWS; unannounced ones are
+// detected from eBay's own 5xx answers that mention maintenance. During a
+// window calls to that environment are not sent at all: proxied requests get
+// a 503 saying when to come back, and background jobs skip the affected
+// accounts until their next run after it.
+
+const (
+	defaultMaintenanceHold    = 10 * time.Minute
+	defaultMaintenancePattern = `(?i)maintenance`
+	maintenancePeekSize       = 64 << 10
+)
+
+// maintenanceWindow is a scheduled window; Environment "" applies to all.
+type maintenanceWindow struct {
+	Environment string
+	Start, End  time.Time
+}
+
+// maintenanceError is returned instead of calling eBay during a window.
+type maintenanceError struct {
+	Environment string
+	Until       time.Time
+	Scheduled   bool // configured, rather than detected from eBay's answers
+}
+
+func (e *maintenanceError) Error() string {
+	if e.Scheduled {
+		return fmt.Sprintf("eBay %s is in scheduled maintenance until %s", e.Environment, e.Until.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("eBay %s reported maintenance, calls resume at %s", e.Environment, e.Until.UTC().Format(time.RFC3339))
+}
+
+// retryAfter is the Retry-After value for the rest of the window.
+func (e *maintenanceError) retryAfter(now time.Time) string {
+	seconds := math.Ceil(e.Until.Sub(now).Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(int(seconds))
+}
+
+// maintenanceTracker knows the configured windows and the detected ones.
+type maintenanceTracker struct {
+	windows []maintenanceWindow
+	hold    time.Duration  // how long a detected window lasts without Retry-After
+	pattern *regexp.Regexp // matched against the body of eBay's 5xx answers
+
+	mu       sync.Mutex
+	detected map[string]time.Time // environment name -> end of the detected window
+}
+
+// maintenance is consulted by every call to eBay.
+var maintenance = newMaintenanceTracker(nil, defaultMaintenanceHold, regexp.MustCompile(defaultMaintenancePattern))
+
+func newMaintenanceTracker(windows []maintenanceWindow, hold time.Duration, pattern *regexp.Regexp) *maintenanceTracker {
+	return &maintenanceTracker{
+		windows:  windows,
+		hold:     hold,
+		pattern:  pattern,
+		detected: make(map[string]time.Time),
+	}
+}
+
+// maintenanceFromEnv reads EBAY_MAINTENANCE_WINDOWS, a comma-separated list
+// of [<environment>=]<start>/<end> RFC 3339 intervals, EBAY_MAINTENANCE_HOLD
+// (default 10m) and EBAY_MAINTENANCE_PATTERN (default "(?i)maintenance").
+func maintenanceFromEnv() (*maintenanceTracker, error) {
+	var windows []maintenanceWindow
+	for _, item := range splitList(os.Getenv("EBAY_MAINTENANCE_WINDOWS")) {
+		w, err := parseMaintenanceWindow(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EBAY_MAINTENANCE_WINDOWS entry %q: %w", item, err)
+		}
+		windows = append(windows, w)
+	}
+
+	hold := defaultMaintenanceHold
+	if v := os.Getenv("EBAY_MAINTENANCE_HOLD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid EBAY_MAINTENANCE_HOLD %q", v)
+		}
+		hold = d
+	}
+
+	pattern, err := regexp.Compile(envOr("EBAY_MAINTENANCE_PATTERN", defaultMaintenancePattern))
+	if err != nil {
+		return nil, fmt.Errorf("invalid EBAY_MAINTENANCE_PATTERN: %w", err)
+	}
+
+	m := newMaintenanceTracker(windows, hold, pattern)
+	for _, w := range windows {
+		if w.End.After(time.Now()) {
+			log.Printf("eBay maintenance window for %s: %s to %s", firstNonEmpty(w.Environment, "all environments"),
+				w.Start.UTC().Format(time.RFC3339), w.End.UTC().Format(time.RFC3339))
+		}
+	}
+	return m, nil
+}
+
+// parseMaintenanceWindow parses [<environment>=]<start>/<end>.
+func parseMaintenanceWindow(s string) (maintenanceWindow, error) {
+	var w maintenanceWindow
+	if name, interval, ok := strings.Cut(s, "="); ok {
+		if name != envProduction && name != envSandbox {
+			return w, fmt.Errorf("unknown environment %q", name)
+		}
+		w.Environment, s = name, interval
+	}
+	start, end, ok := strings.Cut(s, "/")
+	if !ok {
+		return w, errors.New("expected <start>/<end>")
+	}
+	var err error
+	if w.Start, err = time.Parse(time.RFC3339, start); err != nil {
+		return w, err
+	}
+	if w.End, err = time.Parse(time.RFC3339, end); err != nil {
+		return w, err
+	}
+	if !w.End.After(w.Start) {
+		return w, errors.New("end must be after start")
+	}
+	return w, nil
+}
+
+// Check returns a *maintenanceError while environment is in maintenance.
+// Adjacent and overlapping windows are merged, so the error says when calls
+// really resume.
+func (m *maintenanceTracker) Check(environment string, now time.Time) error {
+	var until time.Time
+	scheduled := false
+	for extended := true; extended; {
+		extended = false
+		for _, w := range m.windows {
+			if w.Environment != "" && w.Environment != environment {
+				continue
+			}
+			at := now
+			if !until.IsZero() {
+				at = until
+			}
+			if !at.Before(w.Start) && at.Before(w.End) && w.End.After(until) {
+				until, scheduled, extended = w.End, true, true
+			}
+		}
+	}
+
+	m.mu.Lock()
+	detected := m.detected[environment]
+	m.mu.Unlock()
+	if detected.After(now) && detected.After(until) {
+		until, scheduled = detected, false
+	}
+
+	if until.IsZero() {
+		return nil
+	}
+	return &maintenanceError{Environment: environment, Until: until, Scheduled: scheduled}
+}
+
+// Active returns when each environment in maintenance resumes.
+func (m *maintenanceTracker) Active(now time.Time) map[string]time.Time {
+	active := make(map[string]time.Time)
+	for _, name := range []string{envProduction, envSandbox} {
+		var me *maintenanceError
+		if errors.As(m.Check(name, now), &me) {
+			active[name] = me.Until.UTC()
+		}
+	}
+	return active
+}
+
+// observe starts a detected window when resp, a 5xx answer from eBay,
+// mentions maintenance. The body is restored for the caller.
+func (m *maintenanceTracker) observe(environment string, resp *http.Response, now time.Time) {
+	if resp.StatusCode < 500 || resp.StatusCode == http.StatusNotImplemented {
+		return
+	}
+	peek, err := io.ReadAll(io.LimitReader(resp.Body, maintenancePeekSize))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peek), resp.Body), resp.Body}
+	if err != nil || !m.pattern.Match(peek) {
+		return
+	}
+
+	hold := m.hold
+	if after, ok := retryAfter(resp.Header.Get("Retry-After"), now); ok && after > 0 {
+		hold = after
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if until := now.Add(hold).Truncate(time.Second); until.After(m.detected[environment]) {
+		if !m.detected[environment].After(now) {
+			log.Printf("eBay %s reported maintenance (status %d), pausing calls for %s", environment, resp.StatusCode, hold)
+		}
+		m.detected[environment] = until
+	}
+}
+
+// maintenanceTransport refuses calls during maintenance and watches eBay's
+// answers for the start of unannounced maintenance.
+type maintenanceTransport struct {
+	base http.RoundTripper
+}
+
+func (t *maintenanceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	environment := environmentNameForHost(req.URL.Host)
+	if err := maintenance.Check(environment, time.Now()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		maintenance.observe(environment, resp, time.Now())
+	}
+	return resp, err
+}
+
+// ebayTransport is the transport of calls to eBay made outside the proxy,
+// such as the background jobs'.
+var ebayTransport http.RoundTripper = &maintenanceTransport{base: http.DefaultTransport}
+
+// writeMaintenance answers a request that reached eBay during maintenance
+// with a 503 saying when to retry.
+func writeMaintenance(w http.ResponseWriter, me *maintenanceError) {
+	w.Header().Set("Retry-After", me.retryAfter(time.Now()))
+	writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+		"error":       "ebay_maintenance",
+		"message":     me.Error(),
+		"environment": me.Environment,
+		"resume_at":   me.Until.UTC(),
+		"scheduled":   me.Scheduled,
+	})
+}
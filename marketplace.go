@@ -0,0 +1,127 @@
+package ebaymcp
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ### Marketplaces ###########################################################
+
+// marketplaceParam lets a request choose the eBay marketplace, e.g.
+// ?marketplace_id=EBAY_DE. It is stripped before forwarding, except for the
+// operations in marketplaceQueryPaths. Clients may instead send the
+// X-EBAY-C-MARKETPLACE-ID header themselves.
+const (
+	marketplaceParam  = "marketplace_id"
+	marketplaceHeader = "X-EBAY-C-MARKETPLACE-ID"
+)
+
+// marketplaceQueryPaths are eBay operations that take marketplace_id as a
+// query parameter of their own, so it is forwarded to them.
+var marketplaceQueryPaths = []string{
+	"/sell/account/v1/fulfillment_policy",
+	"/sell/account/v1/payment_policy",
+	"/sell/account/v1/return_policy",
+	"/commerce/taxonomy/v1/get_default_category_tree_id",
+}
+
+// forwardsMarketplaceParam reports whether path keeps marketplace_id.
+func forwardsMarketplaceParam(path string) bool {
+	for _, p := range marketplaceQueryPaths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultMarketplace is eBay's own default when no header is sent.
+const defaultMarketplace = "EBAY_US"
+
+// marketplaceLanguages maps each supported marketplace to the language eBay
+// expects in Accept-Language / Content-Language for it.
+var marketplaceLanguages = map[string]string{
+	"EBAY_US":        "en-US",
+	"EBAY_MOTORS_US": "en-US",
+	"EBAY_CA":        "en-CA",
+	"EBAY_GB":        "en-GB",
+	"EBAY_IE":        "en-IE",
+	"EBAY_AU":        "en-AU",
+	"EBAY_DE":        "de-DE",
+	"EBAY_AT":        "de-AT",
+	"EBAY_CH":        "de-CH",
+	"EBAY_FR":        "fr-FR",
+	"EBAY_BE":        "fr-BE",
+	"EBAY_IT":        "it-IT",
+	"EBAY_ES":        "es-ES",
+	"EBAY_NL":        "nl-NL",
+	"EBAY_PL":        "pl-PL",
+	"EBAY_HK":        "zh-HK",
+	"EBAY_SG":        "en-SG",
+	"EBAY_MY":        "en-MY",
+	"EBAY_PH":        "en-PH",
+}
+
+// marketplaceFromEnv returns EBAY_MARKETPLACE_ID, validated, or EBAY_US.
+func marketplaceFromEnv() (string, error) {
+	id := strings.ToUpper(os.Getenv("EBAY_MARKETPLACE_ID"))
+	if id == "" {
+		return defaultMarketplace, nil
+	}
+	if _, ok := marketplaceLanguages[id]; !ok {
+		return "", fmt.Errorf("EBAY_MARKETPLACE_ID %q is not a supported marketplace", id)
+	}
+	return id, nil
+}
+
+// configuredMarketplace is the deployment-wide default marketplace.
+var configuredMarketplace = defaultMarketplace
+
+// marketplaceFor resolves the marketplace for a proxied request, in order of
+// precedence: the marketplace_id query parameter, the client's
+// X-EBAY-C-MARKETPLACE-ID header, the linked account's stored preference,
+// then the deployment default.
+func marketplaceFor(r *http.Request, preferred string) (string, error) {
+	id := r.URL.Query().Get(marketplaceParam)
+	if id == "" {
+		id = r.Header.Get(marketplaceHeader)
+	}
+	if id == "" {
+		id = preferred
+	}
+	if id == "" {
+		return configuredMarketplace, nil
+	}
+
+	id = strings.ToUpper(id)
+	if _, ok := marketplaceLanguages[id]; !ok {
+		return "", fmt.Errorf("unsupported marketplace %q (supported: %s)", id, strings.Join(supportedMarketplaces(), ", "))
+	}
+	return id, nil
+}
+
+// supportedMarketplaces lists the marketplace IDs we accept.
+func supportedMarketplaces() []string {
+	ids := make([]string, 0, len(marketplaceLanguages))
+	for id := range marketplaceLanguages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// setMarketplaceHeaders injects the marketplace and matching language
+// headers into a request bound for eBay. Content-Language is only needed on
+// requests with a body (e.g. createOrReplaceInventoryItem) and is left alone
+// if the client already set it.
+func setMarketplaceHeaders(req *http.Request, marketplace string) {
+	lang := marketplaceLanguages[marketplace]
+	req.Header.Set(marketplaceHeader, marketplace)
+	req.Header.Set("Accept-Language", lang)
+	if req.ContentLength != 0 && req.Header.Get("Content-Language") == "" {
+		req.Header.Set("Content-Language", lang)
+	}
+}
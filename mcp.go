@@ -0,0 +1,899 @@
+package ebaymcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ### MCP Server #############################################################
+
+// `ebay-mcp mcp` serves the tool registry to MCP clients (Claude Desktop,
+// IDEs) over stdin/stdout: JSON-RPC 2.0, one message per line. Tool calls go
+// through a running proxy at PROXY_URL with PROXY_API_KEY (an eBay access
+// token or a vault:... key) as bearer token, so the policy, scope checks and
+// rate limits apply exactly as for GPT Actions. Remote clients get the same
+// sessions over HTTP at /mcp (see mcphttp.go).
+//
+// Slow tools don't block silently: when a call carries _meta.progressToken
+// the server sends notifications/progress while eBay works, and tools that
+// start a background task (feed and report tasks) poll it, reporting each
+// status as a stage, until it finishes or MCP_TASK_TIMEOUT passes.
+//
+// A call ends early when the client sends notifications/cancelled for it or
+// closes stdin: the in-flight eBay request is aborted, a task the API lets us
+// delete is deleted, and the call is answered with a cancelled result.
+
+// mcpProtocolVersions are the protocol revisions we speak, newest first.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// resourceLinkVersion is the first protocol revision with resource links.
+const resourceLinkVersion = "2025-06-18"
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+const (
+	defaultTaskPollInterval = 5 * time.Second
+	defaultTaskTimeout      = 10 * time.Minute
+
+	// progressHeartbeat is how often a call waiting on eBay reports progress.
+	progressHeartbeat = 5 * time.Second
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// toolCallParams are the params of tools/call.
+type toolCallParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Meta      struct {
+		ProgressToken json.RawMessage `json:"progressToken,omitempty"`
+	} `json:"_meta"`
+}
+
+// toolResult is the result of tools/call.
+type toolResult struct {
+	Content []interface{} `json:"content"`
+	IsError bool          `json:"isError,omitempty"`
+}
+
+type toolContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// resourceLink points the client at a file instead of inlining it.
+type resourceLink struct {
+	Type     string `json:"type"` // always "resource_link"
+	URI      string `json:"uri"`
+	Name     string `json:"name"`
+	MimeType string `json:"mimeType,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+func textResult(text string, isError bool) *toolResult {
+	return &toolResult{Content: []interface{}{toolContent{Type: "text", Text: text}}, IsError: isError}
+}
+
+// attachmentResult describes a file the proxy stored as an attachment: as
+// a resource link when the client understands those, and always as text.
+func attachmentResult(body []byte, links bool) (*toolResult, error) {
+	var doc struct {
+		Attachment attachmentInfo `json:"attachment"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("invalid attachment descriptor: %w", err)
+	}
+	a := doc.Attachment
+	result := textResult(fmt.Sprintf("%s (%s, %d bytes) can be downloaded until %s from %s",
+		a.Name, a.ContentType, a.Size, a.ExpiresAt.Format(time.RFC3339), a.URL), false)
+	if links {
+		result.Content = append(result.Content, resourceLink{
+			Type: "resource_link", URI: a.URL, Name: a.Name, MimeType: a.ContentType, Size: a.Size,
+		})
+	}
+	return result, nil
+}
+
+// cancelledToolCall is the result of a cancelled tools/call, as JSON text.
+type cancelledToolCall struct {
+	Status        string `json:"status"` // always "cancelled"
+	Reason        string `json:"reason,omitempty"`
+	Task          string `json:"task,omitempty"` // path of the eBay task it started
+	TaskCancelled bool   `json:"task_cancelled,omitempty"`
+}
+
+// errClientGone cancels calls still running when the client disconnects.
+var errClientGone = errors.New("client disconnected")
+
+// mcpOutput takes the messages for an MCP client: the session's outbox on
+// stdio, or the stream of one request over HTTP (see mcphttp.go).
+type mcpOutput interface {
+	Push(data []byte, droppable bool) error
+}
+
+// mcpServer handles one MCP session.
+type mcpServer struct {
+	tools     []toolRoute
+	client    *toolClient
+	resources *resourceWatcher
+
+	// notices takes messages outside of requests: resource updates
+	notices mcpOutput
+
+	out    io.Writer
+	outbox *pushQueue // messages waiting to be written to out
+	wg     sync.WaitGroup
+
+	callsMu sync.Mutex
+	calls   map[string]context.CancelCauseFunc // in-flight tools/call by request ID
+}
+
+// runMCPCommand implements `ebay-mcp mcp`, serving the tools enabled by
+// POLICY_FILE in TOOL_PROFILE on stdin/stdout.
+func runMCPCommand(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: ebay-mcp mcp")
+	}
+	apiKey := os.Getenv("PROXY_API_KEY")
+	if apiKey == "" {
+		return errors.New("PROXY_API_KEY must be set to an eBay access token or vault:... key")
+	}
+	p, err := loadPolicy(os.Getenv("POLICY_FILE"))
+	if err != nil {
+		return err
+	}
+	if flags, err = featureFlagsFromEnv(func() []FlagRule { return p.Flags }); err != nil {
+		return err
+	}
+
+	if err := pushSettingsFromEnv(); err != nil {
+		return err
+	}
+	settings, err := mcpSettingsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	s, err := newMCPServer(context.Background(), p, settings, apiKey, strings.TrimRight(envOr("PROXY_URL", "https://localhost"), "/"),
+		&http.Client{Timeout: 2 * time.Minute}, os.Stdout)
+	if err != nil {
+		return err
+	}
+	return s.serve(context.Background(), os.Stdin)
+}
+
+// mcpSettings are the settings every MCP session shares, read once at
+// startup rather than per session.
+type mcpSettings struct {
+	taskTimeout  time.Duration // MCP_TASK_TIMEOUT
+	pageBytes    int           // MCP_RESULT_PAGE_SIZE
+	pageTTL      time.Duration // MCP_RESULT_TTL
+	pollInterval time.Duration // MCP_RESOURCE_POLL_INTERVAL
+}
+
+// mcpSettingsFromEnv reads MCP_TASK_TIMEOUT, MCP_RESULT_PAGE_SIZE,
+// MCP_RESULT_TTL and MCP_RESOURCE_POLL_INTERVAL.
+func mcpSettingsFromEnv() (mcpSettings, error) {
+	s := mcpSettings{
+		taskTimeout:  defaultTaskTimeout,
+		pageBytes:    defaultResultPageBytes,
+		pageTTL:      defaultResultPageTTL,
+		pollInterval: defaultResourcePollInterval,
+	}
+	var err error
+	if v := os.Getenv("MCP_TASK_TIMEOUT"); v != "" {
+		if s.taskTimeout, err = time.ParseDuration(v); err != nil || s.taskTimeout <= 0 {
+			return s, fmt.Errorf("invalid MCP_TASK_TIMEOUT %q", v)
+		}
+	}
+	if v := os.Getenv("MCP_RESULT_PAGE_SIZE"); v != "" {
+		if s.pageBytes, err = strconv.Atoi(v); err != nil || s.pageBytes <= 0 {
+			return s, fmt.Errorf("invalid MCP_RESULT_PAGE_SIZE %q", v)
+		}
+	}
+	if v := os.Getenv("MCP_RESULT_TTL"); v != "" {
+		if s.pageTTL, err = time.ParseDuration(v); err != nil || s.pageTTL <= 0 {
+			return s, fmt.Errorf("invalid MCP_RESULT_TTL %q", v)
+		}
+	}
+	if v := os.Getenv("MCP_RESOURCE_POLL_INTERVAL"); v != "" {
+		if s.pollInterval, err = time.ParseDuration(v); err != nil || s.pollInterval <= 0 {
+			return s, fmt.Errorf("invalid MCP_RESOURCE_POLL_INTERVAL %q", v)
+		}
+	}
+	return s, nil
+}
+
+// newMCPServer returns a session writing to out that offers the tools of p
+// and runs them as apiKey against the proxy at baseURL.
+func newMCPServer(ctx context.Context, p *Policy, settings mcpSettings, apiKey, baseURL string, client *http.Client, out io.Writer) (*mcpServer, error) {
+	tp, err := defaultToolProfile()
+	if err != nil {
+		return nil, err
+	}
+	if !flags.IsEnabled(ctx, flagMCP, flagSubject{Key: tokenHash(apiKey)}) {
+		return nil, errors.New("the MCP server is not enabled for this API key (feature flag " + flagMCP + ")")
+	}
+
+	s := &mcpServer{
+		tools: profileTools(p, tp),
+		client: &toolClient{
+			baseURL:      baseURL,
+			apiKey:       apiKey,
+			http:         client,
+			pollInterval: defaultTaskPollInterval,
+			taskTimeout:  settings.taskTimeout,
+			pageBytes:    settings.pageBytes,
+			pageTTL:      settings.pageTTL,
+		},
+		out: out,
+	}
+	s.resources = newResourceWatcher(s, settings.pollInterval)
+	return s, nil
+}
+
+// serve reads requests from in until it is closed. tools/call requests run
+// concurrently so a slow tool doesn't hold up the session. Messages are
+// written from a bounded outbox: progress notifications are dropped under the
+// push overflow policy when the client reads slowly, and calls are cancelled
+// when the client stops reading.
+func (s *mcpServer) serve(ctx context.Context, in io.Reader) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// A stdio session can't reconnect, so it never disconnects on overflow
+	overflow := pushOverflow
+	if overflow == overflowDisconnect {
+		overflow = overflowDropOldest
+	}
+	s.outbox = newPushQueue(pushBufferSize, overflow)
+	s.notices = s.outbox
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		s.writeOutbox(cancel)
+	}()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), int(maxRequestBodySize))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.replyError(s.outbox, json.RawMessage("null"), rpcParseError, "Parse error")
+			continue
+		}
+		s.handle(ctx, req, s.outbox)
+	}
+	cancel(errClientGone)
+	s.wg.Wait()
+	s.outbox.Close(nil)
+	<-written
+	return scanner.Err()
+}
+
+// writeOutbox writes queued messages to out until the outbox is closed. A
+// failed write means the client is gone: running calls are cancelled.
+func (s *mcpServer) writeOutbox(cancel context.CancelCauseFunc) {
+	for {
+		data, err := s.outbox.Next(context.Background())
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Closing MCP session: %v", err)
+				cancel(errClientGone)
+			}
+			return
+		}
+		if dropped := s.outbox.TakeDropped(); dropped > 0 {
+			log.Printf("Dropped %d MCP notifications for a slow client", dropped)
+		}
+		if _, err := s.out.Write(data); err != nil {
+			log.Printf("Failed to write MCP message: %v", err)
+			s.outbox.Close(errClientGone)
+			cancel(errClientGone)
+			return
+		}
+	}
+}
+
+// handle answers req on out. tools/call runs in the background, under ctx.
+func (s *mcpServer) handle(ctx context.Context, req rpcRequest, out mcpOutput) {
+	isNotification := len(req.ID) == 0
+
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		version := mcpProtocolVersions[0]
+		for _, v := range mcpProtocolVersions {
+			if v == params.ProtocolVersion {
+				version = v
+			}
+		}
+		s.client.resourceLinks = version >= resourceLinkVersion
+		s.reply(out, req.ID, map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities": map[string]interface{}{
+				"tools":     map[string]bool{"listChanged": false},
+				"resources": map[string]bool{"subscribe": true, "listChanged": false},
+			},
+			"serverInfo": map[string]string{"name": "ebay-mcp", "version": "1.0.0"},
+		})
+
+	case "ping":
+		s.reply(out, req.ID, map[string]interface{}{})
+
+	case "tools/list":
+		tools := make([]map[string]interface{}, 0, len(s.tools))
+		for _, t := range s.tools {
+			tools = append(tools, mcpTool(t))
+		}
+		tools = append(tools, nextPageToolInfo())
+		s.reply(out, req.ID, map[string]interface{}{"tools": tools})
+
+	case "tools/call":
+		var params toolCallParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			s.replyError(out, req.ID, rpcInvalidParams, "Invalid tools/call params")
+			return
+		}
+		if params.Name == nextPageTool {
+			s.reply(out, req.ID, s.client.nextPage(ctx, params.Arguments))
+			return
+		}
+		t, ok := findTool(s.tools, params.Name)
+		if !ok {
+			s.replyError(out, req.ID, rpcInvalidParams, "Unknown tool: "+params.Name)
+			return
+		}
+		callCtx, cancel := context.WithCancelCause(ctx)
+		s.track(req.ID, cancel)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(req.ID)
+			progress := &progressReporter{server: s, out: out, token: params.Meta.ProgressToken}
+			result, err := s.client.run(callCtx, t, params.Arguments, progress)
+			if err != nil {
+				log.Printf("MCP tool %s failed: %v", t.Name, err)
+				result = textResult(err.Error(), true)
+			}
+			s.reply(out, req.ID, result)
+		}()
+
+	case "resources/list":
+		resources := make([]map[string]string, 0, len(mcpResources))
+		for _, res := range mcpResources {
+			resources = append(resources, mcpResourceInfo(res))
+		}
+		s.reply(out, req.ID, map[string]interface{}{"resources": resources})
+
+	case "resources/read":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		json.Unmarshal(req.Params, &params)
+		res, marketplace, ok := findResource(params.URI)
+		if !ok {
+			s.replyError(out, req.ID, rpcResourceNotFound, "Resource not found: "+params.URI)
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			body, err := s.client.readResource(ctx, res, marketplace)
+			if err != nil {
+				log.Printf("MCP resource %s failed: %v", params.URI, err)
+				s.replyError(out, req.ID, rpcInternalError, err.Error())
+				return
+			}
+			s.reply(out, req.ID, map[string]interface{}{"contents": []map[string]string{
+				{"uri": params.URI, "mimeType": "application/json", "text": string(body)},
+			}})
+		}()
+
+	case "resources/subscribe", "resources/unsubscribe":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		json.Unmarshal(req.Params, &params)
+		if _, _, ok := findResource(params.URI); !ok {
+			s.replyError(out, req.ID, rpcResourceNotFound, "Resource not found: "+params.URI)
+			return
+		}
+		if req.Method == "resources/subscribe" {
+			s.resources.Subscribe(ctx, params.URI)
+		} else {
+			s.resources.Unsubscribe(params.URI)
+		}
+		s.reply(out, req.ID, map[string]interface{}{})
+
+	case "notifications/cancelled":
+		var params struct {
+			RequestID json.RawMessage `json:"requestId"`
+			Reason    string          `json:"reason"`
+		}
+		json.Unmarshal(req.Params, &params)
+		reason := params.Reason
+		if reason == "" {
+			reason = "cancelled by the client"
+		}
+		s.cancelCall(params.RequestID, reason)
+
+	default:
+		// Notifications such as notifications/initialized need no answer
+		if !isNotification {
+			s.replyError(out, req.ID, rpcMethodNotFound, "Method not found: "+req.Method)
+		}
+	}
+}
+
+func (s *mcpServer) track(id json.RawMessage, cancel context.CancelCauseFunc) {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	if s.calls == nil {
+		s.calls = make(map[string]context.CancelCauseFunc)
+	}
+	s.calls[string(id)] = cancel
+}
+
+func (s *mcpServer) untrack(id json.RawMessage) {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	if cancel, ok := s.calls[string(id)]; ok {
+		cancel(nil)
+		delete(s.calls, string(id))
+	}
+}
+
+// cancelCall cancels the in-flight tools/call with the given request ID.
+// Unknown IDs (calls that already finished) are ignored.
+func (s *mcpServer) cancelCall(id json.RawMessage, reason string) {
+	s.callsMu.Lock()
+	cancel, ok := s.calls[string(bytes.TrimSpace(id))]
+	s.callsMu.Unlock()
+	if ok {
+		log.Printf("MCP call %s cancelled: %s", id, reason)
+		cancel(errors.New(reason))
+	}
+}
+
+// send queues a message for the client on out. Droppable messages may be
+// discarded when the client falls behind.
+func (s *mcpServer) send(out mcpOutput, msg interface{}, droppable bool) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to encode MCP message: %v", err)
+		return
+	}
+	if err := out.Push(append(data, '\n'), droppable); err != nil && err != errClientGone {
+		log.Printf("Failed to queue MCP message: %v", err)
+	}
+}
+
+func (s *mcpServer) reply(out mcpOutput, id json.RawMessage, result interface{}) {
+	s.send(out, rpcResponse{JSONRPC: "2.0", ID: id, Result: result}, false)
+}
+
+func (s *mcpServer) replyError(out mcpOutput, id json.RawMessage, code int, message string) {
+	s.send(out, rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}}, false)
+}
+
+// notify sends a notification; they are informational (progress) and may be
+// dropped for a slow client.
+func (s *mcpServer) notify(out mcpOutput, method string, params interface{}) {
+	s.send(out, rpcNotification{JSONRPC: "2.0", Method: method, Params: params}, true)
+}
+
+// findTool looks up a tool by name.
+func findTool(tools []toolRoute, name string) (toolRoute, bool) {
+	for _, t := range tools {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return toolRoute{}, false
+}
+
+// mcpTool describes a tool for tools/list. Path and query parameters become
+// top-level arguments; the request body is the "body" argument.
+func mcpTool(t toolRoute) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for _, p := range t.Params {
+		schema := map[string]interface{}{"type": p.Type}
+		if p.Description != "" {
+			schema["description"] = p.Description
+		}
+		if len(p.Enum) > 0 {
+			schema["enum"] = p.Enum
+		}
+		properties[p.Name] = schema
+		if p.Required || p.In == "path" {
+			required = append(required, p.Name)
+		}
+	}
+	if t.Body != "" {
+		properties["body"] = map[string]interface{}{"type": "object", "description": t.Body}
+		required = append(required, "body")
+	}
+
+	description := t.Summary
+	if t.Description != "" {
+		description += ". " + t.Description
+	}
+	return map[string]interface{}{
+		"name":        t.Name,
+		"description": description,
+		"inputSchema": map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		},
+	}
+}
+
+// ### Tool Progress ##########################################################
+
+// progressReporter sends notifications/progress for one tool call, as a
+// percentage (total 100). Nothing is sent unless the client asked for
+// progress. Progress only ever increases, as the protocol requires.
+type progressReporter struct {
+	server *mcpServer
+	out    mcpOutput
+	token  json.RawMessage
+
+	mu       sync.Mutex
+	progress float64
+}
+
+// Report moves progress to percent, ignoring values that would not advance it.
+func (p *progressReporter) Report(percent float64, message string) {
+	if len(p.token) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if percent <= p.progress {
+		return
+	}
+	p.progress = percent
+	p.server.notify(p.out, "notifications/progress", map[string]interface{}{
+		"progressToken": p.token,
+		"progress":      percent,
+		"total":         100,
+		"message":       message,
+	})
+}
+
+// Creep advances progress a quarter of the way toward ceiling. It keeps
+// clients informed while waiting on a stage of unknown length.
+func (p *progressReporter) Creep(ceiling float64, message string) {
+	p.mu.Lock()
+	next := p.progress + (ceiling-p.progress)/4
+	p.mu.Unlock()
+	p.Report(next, message)
+}
+
+// ### Tool Execution #########################################################
+
+// toolClient runs tools against the proxy.
+type toolClient struct {
+	baseURL      string
+	http         *http.Client
+	pollInterval time.Duration
+	taskTimeout  time.Duration
+
+	resourceLinks bool // the client accepts resource_link content
+
+	pageBytes int           // results larger than this are paged
+	pageTTL   time.Duration // how long paged results are kept
+
+	keyMu  sync.Mutex
+	apiKey string
+}
+
+// key returns the API key calls are made with.
+func (c *toolClient) key() string {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	return c.apiKey
+}
+
+// setKey replaces the API key, e.g. with a refreshed access token.
+func (c *toolClient) setKey(apiKey string) {
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	c.apiKey = apiKey
+}
+
+// run calls tool t with args and, for task tools, waits for the task.
+func (c *toolClient) run(ctx context.Context, t toolRoute, args map[string]interface{}, progress *progressReporter) (*toolResult, error) {
+	path, query, body, err := toolRequest(t, args)
+	if err != nil {
+		return textResult(err.Error(), true), nil
+	}
+
+	started := "Calling eBay"
+	if n := bulkRequestCount(body); n > 0 {
+		started = fmt.Sprintf("Sending %d items to eBay", n)
+	}
+	progress.Report(1, started)
+
+	status, header, respBody, err := c.do(ctx, t.Method, t.serverPath(path), query, body, progress)
+	if err != nil {
+		if ctx.Err() != nil {
+			return cancelledResult(ctx, cancelledToolCall{}), nil
+		}
+		return nil, err
+	}
+	if status >= 300 {
+		return textResult(fmt.Sprintf("eBay returned status %d: %s", status, respBody), true), nil
+	}
+	if t.Task == nil {
+		progress.Report(100, "Done")
+		if header.Get(attachmentHeader) != "" {
+			return attachmentResult(respBody, c.resourceLinks)
+		}
+		return c.pageResult(ctx, respBody), nil
+	}
+
+	location := header.Get("Location")
+	if location == "" {
+		return nil, fmt.Errorf("eBay created the task but returned no Location")
+	}
+	taskURL, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid task location %q: %w", location, err)
+	}
+	result, err := c.waitForTask(ctx, t.Task, taskURL.Path, progress)
+	if err != nil && ctx.Err() != nil {
+		return cancelledResult(ctx, c.cancelTask(t.Task, taskURL.Path)), nil
+	}
+	return result, err
+}
+
+// cancelTask deletes the task at path if its API allows that. It runs after
+// the call's context is done, so it uses its own.
+func (c *toolClient) cancelTask(task *taskPolling, path string) cancelledToolCall {
+	cancelled := cancelledToolCall{Task: path}
+	if !task.Deletable {
+		return cancelled
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	status, _, body, err := c.do(ctx, http.MethodDelete, "/proxy"+path, nil, nil, nil)
+	switch {
+	case err != nil:
+		log.Printf("Failed to delete cancelled task %s: %v", path, err)
+	case status >= 300:
+		log.Printf("Failed to delete cancelled task %s: status %d: %s", path, status, body)
+	default:
+		cancelled.TaskCancelled = true
+	}
+	return cancelled
+}
+
+// cancelledResult answers a call whose context was cancelled.
+func cancelledResult(ctx context.Context, cancelled cancelledToolCall) *toolResult {
+	cancelled.Status = "cancelled"
+	if cause := context.Cause(ctx); cause != nil {
+		cancelled.Reason = cause.Error()
+	}
+	data, _ := json.Marshal(cancelled)
+	return textResult(string(data), true)
+}
+
+// waitForTask polls the task at path until it finishes, reporting each
+// status as a progress stage.
+func (c *toolClient) waitForTask(ctx context.Context, task *taskPolling, path string, progress *progressReporter) (*toolResult, error) {
+	progress.Report(5, "Task submitted")
+	deadline := time.Now().Add(c.taskTimeout)
+	status := "CREATED"
+
+	for {
+		if time.Now().After(deadline) {
+			return textResult(fmt.Sprintf("The task is still %s after %v. Check it later at %s", status, c.taskTimeout, path), true), nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.pollInterval):
+		}
+
+		code, _, body, err := c.do(ctx, http.MethodGet, "/proxy"+path, nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if code != http.StatusOK {
+			return textResult(fmt.Sprintf("Checking the task returned status %d: %s", code, body), true), nil
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse task: %w", err)
+		}
+		status, _ = doc[task.StatusField].(string)
+
+		percent, pending := task.Stages[status]
+		if !pending {
+			progress.Report(100, "Task "+status)
+			failed := false
+			for _, f := range task.Failed {
+				failed = failed || f == status
+			}
+			return textResult(string(body), failed), nil
+		}
+		progress.Report(percent, "Task "+status)
+		progress.Creep(task.nextStage(percent), "Task "+status)
+	}
+}
+
+// nextStage returns the progress of the stage after one at percent, so
+// creeping within a stage never overtakes the next.
+func (t *taskPolling) nextStage(percent float64) float64 {
+	next := 95.0
+	for _, p := range t.Stages {
+		if p > percent && p < next {
+			next = p
+		}
+	}
+	return next
+}
+
+// do sends one request to path on the proxy. While it waits, progress (if
+// not nil) is nudged every progressHeartbeat.
+func (c *toolClient) do(ctx context.Context, method, path string, query url.Values, body []byte, progress *progressReporter) (int, http.Header, []byte, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.key())
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if progress != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(progressHeartbeat)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					progress.Creep(90, "Waiting for eBay")
+				}
+			}
+		}()
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to reach the proxy: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := readLimited(resp.Body, maxResponseBufferSize)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return resp.StatusCode, resp.Header, respBody, nil
+}
+
+// toolRequest builds the path, query and body of a call to t from the
+// tool's arguments.
+func toolRequest(t toolRoute, args map[string]interface{}) (string, url.Values, []byte, error) {
+	path := t.Path
+	query := url.Values{}
+	for _, p := range t.Params {
+		v, ok := args[p.Name]
+		if !ok || v == nil {
+			if p.Required || p.In == "path" {
+				return "", nil, nil, fmt.Errorf("missing required argument %q", p.Name)
+			}
+			continue
+		}
+		value := argumentString(v)
+		if p.In == "path" {
+			path = strings.Replace(path, "{"+p.Name+"}", url.PathEscape(value), 1)
+		} else {
+			query.Set(p.Name, value)
+		}
+	}
+
+	var body []byte
+	if t.Body != "" {
+		b, ok := args["body"]
+		if !ok || b == nil {
+			return "", nil, nil, errors.New(`missing required argument "body"`)
+		}
+		var err error
+		if body, err = json.Marshal(b); err != nil {
+			return "", nil, nil, fmt.Errorf("invalid body: %w", err)
+		}
+	}
+	return path, query, body, nil
+}
+
+// argumentString formats a JSON argument value as a parameter value.
+func argumentString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// bulkRequestCount returns the number of entries in a bulk body's requests
+// array, or 0.
+func bulkRequestCount(body []byte) int {
+	var bulk struct {
+		Requests []json.RawMessage `json:"requests"`
+	}
+	if json.Unmarshal(body, &bulk) != nil {
+		return 0
+	}
+	return len(bulk.Requests)
+}
@@ -0,0 +1,699 @@
+package ebaymcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ### MCP over HTTP ##########################################################
+
+// /mcp serves the MCP tools to remote clients (Claude on the web, other MCP
+// hosts) with the Streamable HTTP transport: the client POSTs one JSON-RPC
+// message at a time and gets the answer as JSON or, for tools/call, as a
+// server-sent event stream carrying the call's progress notifications and
+// then its result.
+//
+// Every request carries a bearer token, and the session's tool calls use
+// the latest one like PROXY_API_KEY on stdio: an access token of the
+// backend's OAuth server, a vault: key or an eBay token. A request without one, or with an expired
+// backend token, gets 401 pointing at /.well-known/oauth-protected-resource,
+// which names MCP_AUTHORIZATION_SERVER (the backend's OAUTH_ISSUER) so the
+// client can sign the user in there. Backend tokens must have been issued
+// for /mcp (the RFC 8707 resource the client asked for) and carry the mcp
+// scope.
+//
+// initialize starts a session whose ID the client sends back in
+// Mcp-Session-Id; sessions belong to the user (or token) that started them,
+// end with DELETE /mcp and expire after MCP_SESSION_TTL (default 30m)
+// without requests. An owner has at most MCP_MAX_SESSIONS (default 10):
+// starting another ends their least recently used one. Since any token can
+// own sessions, the replica also holds at most MCP_MAX_TOTAL_SESSIONS
+// (default 1000) and refuses new ones with 503 while full. Expired
+// sessions are reaped in the background. Sessions live in the replica's
+// memory, so a load balancer must route a session's requests to one
+// replica.
+//
+// GET /mcp opens the session's stream of messages that answer no request,
+// such as notifications/resources/updated. Streams are resumable: every
+// event has an ID, and a client that lost a stream reconnects with GET /mcp
+// and Last-Event-ID to receive the events it missed and the rest of the
+// stream. Calls keep running while the client is away.
+
+const (
+	mcpSessionHeader     = "Mcp-Session-Id"
+	mcpVersionHeader     = "MCP-Protocol-Version"
+	defaultMCPSessionTTL = 30 * time.Minute
+	defaultMCPSessions   = 10
+	defaultMCPTotal      = 1000
+	mcpScope             = "mcp"
+	mcpResourcePath      = "/.well-known/oauth-protected-resource"
+)
+
+// errSessionEnded cancels the calls of a session that was deleted or expired.
+var errSessionEnded = errors.New("MCP session ended")
+
+// errTooManySessions refuses a session while the replica holds
+// MCP_MAX_TOTAL_SESSIONS.
+var errTooManySessions = errors.New("too many MCP sessions, try again later")
+
+// mcpEndpoint serves /mcp.
+type mcpEndpoint struct {
+	// proxy serves the tool calls in-process; set once the routes are built
+	proxy http.Handler
+
+	ttl            time.Duration
+	maxSessions    int             // per owner
+	maxTotal       int             // on this replica
+	authServer     string          // MCP_AUTHORIZATION_SERVER
+	allowedOrigins map[string]bool // MCP_ALLOWED_ORIGINS
+	settings       mcpSettings
+
+	mu       sync.Mutex
+	sessions map[string]*mcpSession
+}
+
+// mcpSession is one client's MCP session.
+type mcpSession struct {
+	id     string
+	owner  string
+	server *mcpServer
+	ctx    context.Context // cancelled when the session ends
+	cancel context.CancelCauseFunc
+
+	mu       sync.Mutex
+	lastUsed time.Time
+	events   *mcpStream // stream 0, for messages outside of requests
+	streams  map[string]*mcpStream
+	next     int // number of the last request stream
+}
+
+// mcpEndpointFromEnv reads MCP_SESSION_TTL, MCP_MAX_SESSIONS,
+// MCP_MAX_TOTAL_SESSIONS, MCP_AUTHORIZATION_SERVER, MCP_ALLOWED_ORIGINS and
+// the settings of the sessions (see mcpSettingsFromEnv).
+func mcpEndpointFromEnv() (*mcpEndpoint, error) {
+	m := &mcpEndpoint{ttl: defaultMCPSessionTTL, maxSessions: defaultMCPSessions, maxTotal: defaultMCPTotal, allowedOrigins: map[string]bool{}, sessions: map[string]*mcpSession{}}
+	if v := os.Getenv("MCP_SESSION_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid MCP_SESSION_TTL %q", v)
+		}
+		m.ttl = d
+	}
+	if v := os.Getenv("MCP_MAX_SESSIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid MCP_MAX_SESSIONS %q", v)
+		}
+		m.maxSessions = n
+	}
+	if v := os.Getenv("MCP_MAX_TOTAL_SESSIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid MCP_MAX_TOTAL_SESSIONS %q", v)
+		}
+		m.maxTotal = n
+	}
+	var err error
+	if m.settings, err = mcpSettingsFromEnv(); err != nil {
+		return nil, err
+	}
+	if v := os.Getenv("MCP_AUTHORIZATION_SERVER"); v != "" {
+		u, err := url.Parse(v)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid MCP_AUTHORIZATION_SERVER %q", v)
+		}
+		m.authServer = strings.TrimRight(v, "/")
+	}
+	for _, origin := range strings.Split(os.Getenv("MCP_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			m.allowedOrigins[strings.TrimRight(origin, "/")] = true
+		}
+	}
+	return m, nil
+}
+
+// ServeHTTP handles POST, GET and DELETE /mcp.
+func (m *mcpEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !m.originAllowed(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+	if v := r.Header.Get(mcpVersionHeader); v != "" && !supportedMCPVersion(v) {
+		http.Error(w, "Unsupported "+mcpVersionHeader+": "+v, http.StatusBadRequest)
+		return
+	}
+	token, owner, ok := m.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		m.handlePost(w, r, token, owner)
+	case http.MethodGet:
+		m.handleResume(w, r, token, owner)
+	case http.MethodDelete:
+		session, ok := m.session(w, r, token, owner)
+		if !ok {
+			return
+		}
+		m.end(session)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// originAllowed guards against DNS rebinding: browsers send Origin, which
+// must be our own or one of MCP_ALLOWED_ORIGINS. Other clients send none.
+func (m *mcpEndpoint) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || m.allowedOrigins[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	own, err := url.Parse(externalBaseURL(r))
+	return err == nil && u.Scheme == own.Scheme && u.Host == own.Host
+}
+
+func supportedMCPVersion(v string) bool {
+	for _, supported := range mcpProtocolVersions {
+		if v == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate returns the bearer token of r and who it belongs to: the
+// backend's user or client, or else the token itself. It answers 401 when
+// there is no usable token, including backend tokens issued for another
+// resource, and 403 for backend tokens without the mcp scope.
+func (m *mcpEndpoint) authenticate(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	token := ""
+	if parts := strings.Fields(r.Header.Get("Authorization")); len(parts) == 2 && strings.EqualFold(parts[0], "bearer") {
+		token = parts[1]
+	}
+	if token == "" {
+		m.challenge(w, r, "")
+		return "", "", false
+	}
+	if backend == nil || isVaultReference(token) || isEbayToken(token) {
+		return token, "token:" + tokenHash(token), true
+	}
+
+	identity, err := backend.Introspect(r.Context(), token)
+	if err != nil {
+		log.Printf("Failed to check backend token: %v", err)
+		http.Error(w, "Failed to check the access token", http.StatusServiceUnavailable)
+		return "", "", false
+	}
+	switch {
+	case !identity.Active, strings.TrimRight(identity.Audience, "/") != mcpResourceURI(r):
+		m.challenge(w, r, "invalid_token")
+		return "", "", false
+	case !identity.hasScope(mcpScope):
+		m.challenge(w, r, "insufficient_scope")
+		return "", "", false
+	case identity.UserID != nil:
+		return token, fmt.Sprintf("user:%d", *identity.UserID), true
+	default:
+		return token, "client:" + identity.ClientID, true
+	}
+}
+
+// challenge answers 401, or 403 for insufficient_scope, pointing the
+// client at our protected resource metadata when there is an authorization
+// server to sign in with.
+func (m *mcpEndpoint) challenge(w http.ResponseWriter, r *http.Request, errorCode string) {
+	params := []string{}
+	if errorCode != "" {
+		params = append(params, fmt.Sprintf("error=%q", errorCode))
+	}
+	if errorCode == "insufficient_scope" {
+		params = append(params, fmt.Sprintf("scope=%q", mcpScope))
+	}
+	if m.authServer != "" {
+		params = append(params, fmt.Sprintf("resource_metadata=%q", externalBaseURL(r)+mcpResourcePath))
+	}
+	w.Header().Set("WWW-Authenticate", strings.TrimSpace("Bearer "+strings.Join(params, ", ")))
+	if errorCode == "insufficient_scope" {
+		http.Error(w, "The access token lacks the "+mcpScope+" scope", http.StatusForbidden)
+		return
+	}
+	http.Error(w, "A bearer token is required", http.StatusUnauthorized)
+}
+
+// mcpResourceURI returns the resource identifier of /mcp, which backend tokens
+// must have been issued for.
+func mcpResourceURI(r *http.Request) string {
+	return externalBaseURL(r) + "/mcp"
+}
+
+// handlePost handles one JSON-RPC message from the client.
+func (m *mcpEndpoint) handlePost(w http.ResponseWriter, r *http.Request, token, owner string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			writeBodyTooLarge(w, requestBodyLimit(r.URL.Path))
+			return
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	var req rpcRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &rpcError{Code: rpcParseError, Message: "Parse error"}})
+		return
+	}
+
+	var session *mcpSession
+	if req.Method == "initialize" {
+		if session, err = m.start(r, token, owner); err != nil {
+			if errors.Is(err, errTooManySessions) {
+				w.Header().Set("Retry-After", "60")
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		w.Header().Set(mcpSessionHeader, session.id)
+	} else {
+		var ok bool
+		if session, ok = m.session(w, r, token, owner); !ok {
+			return
+		}
+	}
+
+	// Notifications and responses only need to be accepted
+	if len(req.ID) == 0 || req.Method == "" {
+		if req.Method != "" {
+			session.server.handle(session.ctx, req, discardOutput{})
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	stream := session.openStream(!(req.Method == "tools/call" && acceptsEventStream(r)))
+	session.server.handle(session.ctx, req, stream)
+	if stream.plain {
+		data, err := stream.queue.Next(r.Context())
+		session.closeStream(stream)
+		if err != nil {
+			return // the client went away
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+		return
+	}
+	session.serveStream(w, r, stream, 0)
+}
+
+// handleResume continues the stream named by Last-Event-ID after that
+// event or, without one, opens the session's stream of messages outside of
+// requests from now on.
+func (m *mcpEndpoint) handleResume(w http.ResponseWriter, r *http.Request, token, owner string) {
+	session, ok := m.session(w, r, token, owner)
+	if !ok {
+		return
+	}
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		session.serveStream(w, r, session.events, -1)
+		return
+	}
+	streamID, seq, ok := parseEventID(lastEventID)
+	session.mu.Lock()
+	stream := session.streams[streamID]
+	session.mu.Unlock()
+	if !ok || stream == nil {
+		http.Error(w, "Unknown or finished stream", http.StatusNotFound)
+		return
+	}
+	session.serveStream(w, r, stream, seq)
+}
+
+// start creates a session for the client sending initialize.
+func (m *mcpEndpoint) start(r *http.Request, token, owner string) (*mcpSession, error) {
+	// Tool calls go to the proxy in-process; baseURL addresses the routes
+	// below any mount prefix, which the proxy adds back to its links
+	baseURL := externalBaseURL(r)
+	baseURL = strings.TrimSuffix(baseURL, mountPrefix+tenantPrefix(r)) + tenantPrefix(r)
+	client := &http.Client{Transport: handlerTransport{m.proxy}, Timeout: 2 * time.Minute}
+	server, err := newMCPServer(r.Context(), currentPolicy(), m.settings, token, baseURL, client, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := randomID(24)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	session := &mcpSession{
+		id:       id,
+		owner:    owner,
+		server:   server,
+		ctx:      ctx,
+		cancel:   cancel,
+		lastUsed: time.Now(),
+		events:   newMCPStream("0", false),
+		streams:  map[string]*mcpStream{},
+	}
+	session.streams[session.events.id] = session.events
+	server.notices = session.events
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire()
+	var owned []*mcpSession
+	for _, s := range m.sessions {
+		if s.owner == owner {
+			owned = append(owned, s)
+		}
+	}
+	// Keep the owner within maxSessions, ending their least recently used
+	sort.Slice(owned, func(i, j int) bool { return owned[i].idle() > owned[j].idle() })
+	for len(owned) >= m.maxSessions {
+		log.Printf("MCP session %s ended: %s has %d sessions", owned[0].id, owner, len(owned))
+		owned[0].close()
+		delete(m.sessions, owned[0].id)
+		owned = owned[1:]
+	}
+	if len(m.sessions) >= m.maxTotal {
+		session.close()
+		return nil, errTooManySessions
+	}
+	m.sessions[session.id] = session
+	audit.Record("mcp.session_started", map[string]string{"owner": owner})
+	return session, nil
+}
+
+// session returns the session named by the request's Mcp-Session-Id, whose
+// calls now use token. It answers 400 without one and 404 for sessions that
+// ended, expired or belong to someone else, telling the client to
+// initialize a new one.
+func (m *mcpEndpoint) session(w http.ResponseWriter, r *http.Request, token, owner string) (*mcpSession, bool) {
+	id := r.Header.Get(mcpSessionHeader)
+	if id == "" {
+		http.Error(w, "Missing "+mcpSessionHeader+" header", http.StatusBadRequest)
+		return nil, false
+	}
+	m.mu.Lock()
+	session := m.sessions[id]
+	if session != nil && session.idle() > m.ttl {
+		session.close()
+		delete(m.sessions, id)
+		session = nil
+	}
+	m.mu.Unlock()
+	if session == nil || session.owner != owner {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return nil, false
+	}
+	session.touch()
+	session.server.client.setKey(token)
+	return session, true
+}
+
+// expire ends the sessions idle for longer than the TTL. Callers must hold
+// m.mu.
+func (m *mcpEndpoint) expire() {
+	for id, s := range m.sessions {
+		if s.idle() > m.ttl {
+			log.Printf("MCP session %s expired", id)
+			s.close()
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// reap ends expired sessions every minute until ctx is done, so sessions
+// nobody comes back to don't stay in memory.
+func (m *mcpEndpoint) reap(ctx context.Context) {
+	ticker := time.NewTicker(min(m.ttl, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.mu.Lock()
+		m.expire()
+		m.mu.Unlock()
+	}
+}
+
+// end deletes session, cancelling its calls.
+func (m *mcpEndpoint) end(session *mcpSession) {
+	m.mu.Lock()
+	delete(m.sessions, session.id)
+	m.mu.Unlock()
+	session.close()
+}
+
+// close cancels the session's calls and ends its streams.
+func (s *mcpSession) close() {
+	s.cancel(errSessionEnded)
+	s.events.queue.Close(nil)
+}
+
+func (s *mcpSession) touch() {
+	s.mu.Lock()
+	s.lastUsed = time.Now()
+	s.mu.Unlock()
+}
+
+// idle returns how long the session has gone without requests. Sessions
+// with an open stream are in use.
+func (s *mcpSession) idle() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, stream := range s.streams {
+		if stream.reading() {
+			return 0
+		}
+	}
+	return time.Since(s.lastUsed)
+}
+
+// ### Streams ###
+
+// mcpStream carries the messages answering one request. It ends with the
+// response, the only message that isn't droppable. Events written to the
+// client are kept so that a client that reconnects can catch up.
+type mcpStream struct {
+	id    string
+	plain bool // answered as JSON: progress notifications are discarded
+	queue *pushQueue
+
+	mu      sync.Mutex
+	history [][]byte // the last pushBufferSize events written, oldest first
+	seq     int      // number of the last event written
+	reader  *streamReader
+}
+
+// streamReader is the connection currently writing a stream.
+type streamReader struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (st *mcpStream) Push(data []byte, droppable bool) error {
+	if droppable && st.plain {
+		return nil
+	}
+	if err := st.queue.Push(data, droppable); err != nil {
+		return err
+	}
+	if !droppable {
+		st.queue.Close(nil)
+	}
+	return nil
+}
+
+func (st *mcpStream) reading() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.reader != nil
+}
+
+func newMCPStream(id string, plain bool) *mcpStream {
+	// Streams can be resumed, so they never disconnect on overflow
+	overflow := pushOverflow
+	if overflow == overflowDisconnect {
+		overflow = overflowDropOldest
+	}
+	return &mcpStream{id: id, plain: plain, queue: newPushQueue(pushBufferSize, overflow)}
+}
+
+// openStream starts a stream for a request.
+func (s *mcpSession) openStream(plain bool) *mcpStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	stream := newMCPStream(strconv.Itoa(s.next), plain)
+	s.streams[stream.id] = stream
+	return stream
+}
+
+func (s *mcpSession) closeStream(stream *mcpStream) {
+	s.mu.Lock()
+	delete(s.streams, stream.id)
+	s.mu.Unlock()
+}
+
+// serveStream writes stream to the client as server-sent events, starting
+// after event number after (-1 for events yet to come). A connection already writing the stream is
+// replaced. The stream is forgotten once its last event was written.
+func (s *mcpSession) serveStream(w http.ResponseWriter, r *http.Request, stream *mcpStream, after int) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	reader := &streamReader{cancel: cancel, done: make(chan struct{})}
+	defer close(reader.done)
+	stream.mu.Lock()
+	if previous := stream.reader; previous != nil {
+		stream.mu.Unlock()
+		previous.cancel()
+		<-previous.done
+		stream.mu.Lock()
+	}
+	stream.reader = reader
+	if after < 0 {
+		after = stream.seq
+	}
+	missed := stream.history[len(stream.history)-min(max(stream.seq-after, 0), len(stream.history)):]
+	stream.mu.Unlock()
+	defer func() {
+		stream.mu.Lock()
+		if stream.reader == reader {
+			stream.reader = nil
+		}
+		stream.mu.Unlock()
+		s.touch()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	rc := http.NewResponseController(w)
+	write := func(data []byte) error {
+		rc.SetWriteDeadline(time.Now().Add(pushWriteTimeout))
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	for _, event := range missed {
+		if err := write(event); err != nil {
+			return
+		}
+	}
+
+	for {
+		waitCtx, cancelWait := context.WithTimeout(ctx, sseHeartbeatInterval)
+		data, err := stream.queue.Next(waitCtx)
+		cancelWait()
+		switch {
+		case err == nil:
+		case errors.Is(err, io.EOF):
+			s.closeStream(stream)
+			return
+		case ctx.Err() != nil:
+			return // the client went away or resumed elsewhere
+		case errors.Is(err, context.DeadlineExceeded):
+			if write([]byte(": heartbeat\n\n")) != nil {
+				return
+			}
+			continue
+		default:
+			log.Printf("Closing MCP stream: %v", err)
+			return
+		}
+		if dropped := stream.queue.TakeDropped(); dropped > 0 {
+			log.Printf("Dropped %d MCP notifications for a slow client", dropped)
+		}
+
+		stream.mu.Lock()
+		stream.seq++
+		event := []byte(fmt.Sprintf("id: %s-%d\nevent: message\ndata: %s\n", stream.id, stream.seq, data))
+		stream.history = append(stream.history, event)
+		if len(stream.history) > pushBufferSize {
+			stream.history = stream.history[1:]
+		}
+		stream.mu.Unlock()
+		if err := write(event); err != nil {
+			log.Printf("MCP stream interrupted: %v", err)
+			return
+		}
+	}
+}
+
+// parseEventID splits an event ID into its stream and event number.
+func parseEventID(id string) (string, int, bool) {
+	stream, number, ok := strings.Cut(id, "-")
+	seq, err := strconv.Atoi(number)
+	return stream, seq, ok && err == nil && seq >= 0
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accept); err == nil && mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// discardOutput takes the messages of requests that need no answer.
+type discardOutput struct{}
+
+func (discardOutput) Push([]byte, bool) error { return nil }
+
+// ### Protected Resource Metadata ###
+
+// handleProtectedResource describes /mcp to OAuth clients (RFC 9728): the
+// authorization server whose tokens it accepts.
+// GET /.well-known/oauth-protected-resource[/mcp]
+func (m *mcpEndpoint) handleProtectedResource(w http.ResponseWriter, r *http.Request) {
+	if m.authServer == "" {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"resource":                 mcpResourceURI(r),
+		"authorization_servers":    []string{m.authServer},
+		"scopes_supported":         []string{mcpScope},
+		"bearer_methods_supported": []string{"header"},
+		"resource_name":            "eBay MCP",
+	})
+}
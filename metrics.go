@@ -0,0 +1,357 @@
+package ebaymcp
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/telemetry"
+)
+
+// ### eBay Operations ########################################################
+
+// operationTemplates are the eBay REST paths we know how to name. Segments in
+// braces match any single path segment. Paths that match none of these fall
+// back to heuristicOperation.
+var operationTemplates = []string{
+	"/buy/browse/v1/item_summary/search",
+	"/buy/browse/v1/item_summary/search_by_image",
+	"/buy/browse/v1/item/get_item_by_legacy_id",
+	"/buy/browse/v1/item/get_items_by_item_group",
+	"/buy/browse/v1/item/{item_id}",
+	"/buy/deal/v1/deal_item",
+	"/buy/deal/v1/event",
+	"/buy/deal/v1/event_item",
+	"/buy/offer/v1_beta/bidding/{item_id}",
+	"/buy/offer/v1_beta/bidding/{item_id}/place_proxy_bid",
+	"/buy/order/v2/guest_checkout_session/initiate",
+	"/buy/order/v2/guest_checkout_session/{checkout_session_id}",
+	"/buy/order/v2/guest_checkout_session/{checkout_session_id}/place_order",
+	"/buy/order/v2/guest_purchase_order/{purchase_order_id}",
+	"/sell/inventory/v1/inventory_item",
+	"/sell/inventory/v1/inventory_item/{sku}",
+	"/sell/inventory/v1/bulk_create_or_replace_inventory_item",
+	"/sell/inventory/v1/bulk_update_price_quantity",
+	"/sell/inventory/v1/offer",
+	"/sell/inventory/v1/offer/{offer_id}",
+	"/sell/inventory/v1/offer/{offer_id}/publish",
+	"/sell/inventory/v1/offer/{offer_id}/withdraw",
+	"/sell/inventory/v1/location",
+	"/sell/inventory/v1/location/{location_key}",
+	"/sell/fulfillment/v1/order",
+	"/sell/fulfillment/v1/order/{order_id}",
+	"/sell/fulfillment/v1/order/{order_id}/issue_refund",
+	"/sell/fulfillment/v1/order/{order_id}/shipping_fulfillment",
+	"/sell/fulfillment/v1/order/{order_id}/shipping_fulfillment/{fulfillment_id}",
+	"/sell/account/v1/fulfillment_policy",
+	"/sell/account/v1/fulfillment_policy/{policy_id}",
+	"/sell/account/v1/payment_policy",
+	"/sell/account/v1/payment_policy/{policy_id}",
+	"/sell/account/v1/return_policy",
+	"/sell/account/v1/return_policy/{policy_id}",
+	"/sell/account/v1/privilege",
+	"/sell/account/v1/program/get_opted_in_programs",
+	"/sell/account/v1/program/opt_in",
+	"/sell/feed/v1/inventory_task",
+	"/sell/feed/v1/inventory_task/{task_id}",
+	"/sell/feed/v1/order_task",
+	"/sell/feed/v1/order_task/{task_id}",
+	"/sell/feed/v1/task",
+	"/sell/feed/v1/task/{task_id}",
+	"/sell/feed/v1/task/{task_id}/download_result_file",
+	"/sell/feed/v1/task/{task_id}/upload_file",
+	"/sell/marketing/v1/ad_report_task",
+	"/sell/marketing/v1/ad_report_task/{report_task_id}",
+	"/sell/marketing/v1/item_price_markdown",
+	"/sell/marketing/v1/item_price_markdown/{promotion_id}",
+	"/sell/marketing/v1/item_promotion",
+	"/sell/marketing/v1/item_promotion/{promotion_id}",
+	"/sell/marketing/v1/promotion",
+	"/sell/marketing/v1/promotion/{promotion_id}/pause",
+	"/sell/marketing/v1/promotion/{promotion_id}/resume",
+	"/sell/finances/v1/transaction",
+	"/sell/finances/v1/payout",
+	"/sell/finances/v1/payout/{payout_id}",
+	"/commerce/identity/v1/user",
+	"/commerce/taxonomy/v1/get_default_category_tree_id",
+	"/commerce/taxonomy/v1/category_tree/{category_tree_id}",
+	"/commerce/taxonomy/v1/category_tree/{category_tree_id}/get_category_suggestions",
+	"/commerce/taxonomy/v1/category_tree/{category_tree_id}/get_item_aspects_for_category",
+}
+
+// maxOperations caps how many distinct operation labels we track, so a
+// client hammering unusual paths can't grow metric cardinality without bound.
+const maxOperations = 500
+
+// otherOperation labels requests once maxOperations has been reached.
+const otherOperation = "other"
+
+// resourceSegment matches path segments that look like eBay resource or
+// action names (e.g. "item_summary", "publish") rather than identifiers.
+var resourceSegment = regexp.MustCompile(`^[a-z][a-z_]*$`)
+
+// versionSegment matches eBay API version segments such as "v1" or "v1_beta".
+var versionSegment = regexp.MustCompile(`^v[0-9]+(_[a-z0-9]+)?$`)
+
+// operationFor maps a raw eBay API path to a bounded operation name such as
+// "/sell/fulfillment/v1/order/{order_id}".
+func operationFor(path string) string {
+	segments := splitPath(path)
+
+	for _, tmpl := range operationTemplates {
+		if matchTemplate(splitPath(tmpl), segments) {
+			return tmpl
+		}
+	}
+	return heuristicOperation(segments)
+}
+
+// matchTemplate reports whether path segments match a template's segments.
+func matchTemplate(tmpl, segments []string) bool {
+	if len(tmpl) != len(segments) {
+		return false
+	}
+	for i, t := range tmpl {
+		if strings.HasPrefix(t, "{") {
+			continue
+		}
+		if t != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// heuristicOperation names paths we have no template for. eBay REST paths
+// are "/{family}/{api}/{version}" followed by alternating resource names and
+// identifiers, so anything after the version that doesn't look like a
+// resource name is replaced with "{id}".
+func heuristicOperation(segments []string) string {
+	var out []string
+	afterVersion := false
+	for _, seg := range segments {
+		switch {
+		case !afterVersion:
+			if versionSegment.MatchString(seg) {
+				afterVersion = true
+			} else if !resourceSegment.MatchString(seg) {
+				seg = "{id}"
+			}
+		case !resourceSegment.MatchString(seg):
+			seg = "{id}"
+		}
+		out = append(out, seg)
+	}
+	return "/" + strings.Join(out, "/")
+}
+
+// splitPath splits a URL path into its non-empty segments.
+func splitPath(path string) []string {
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// ### Proxy Metrics ##########################################################
+
+// latencyBuckets are the upper bounds (in seconds) of the proxy latency
+// histogram. eBay calls range from tens of milliseconds to tens of seconds.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// requestKey identifies a request counter series.
+type requestKey struct {
+	operation string
+	method    string
+	status    string
+}
+
+// latencyKey identifies a latency histogram series.
+type latencyKey struct {
+	operation string
+	method    string
+}
+
+// histogram is a cumulative latency histogram.
+type histogram struct {
+	buckets []uint64 // counts per latencyBuckets entry (non-cumulative)
+	count   uint64
+	sum     float64
+}
+
+// proxyMetrics collects per-operation request counts and latencies and
+// exposes them in the Prometheus text format.
+type proxyMetrics struct {
+	mu         sync.Mutex
+	operations map[string]bool
+	requests   map[requestKey]uint64
+	latencies  map[latencyKey]*histogram
+	slow       map[string]uint64
+	large      map[string]uint64
+}
+
+// metrics is the process-wide metrics registry.
+var metrics = newProxyMetrics()
+
+func newProxyMetrics() *proxyMetrics {
+	return &proxyMetrics{
+		operations: make(map[string]bool),
+		requests:   make(map[requestKey]uint64),
+		latencies:  make(map[latencyKey]*histogram),
+		slow:       make(map[string]uint64),
+		large:      make(map[string]uint64),
+	}
+}
+
+// boundedOperation returns operation, or otherOperation once maxOperations
+// distinct operations have been seen. Callers must hold m.mu.
+func (m *proxyMetrics) boundedOperation(operation string) string {
+	if !m.operations[operation] {
+		if len(m.operations) >= maxOperations {
+			return otherOperation
+		}
+		m.operations[operation] = true
+	}
+	return operation
+}
+
+// IncSlow counts a call that exceeded the slow request threshold.
+func (m *proxyMetrics) IncSlow(operation string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.slow[m.boundedOperation(operation)]++
+}
+
+// IncLarge counts a response that exceeded the large response threshold.
+func (m *proxyMetrics) IncLarge(operation string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.large[m.boundedOperation(operation)]++
+}
+
+// ObserveProxy records one proxied eBay call.
+func (m *proxyMetrics) ObserveProxy(operation, method string, status int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	operation = m.boundedOperation(operation)
+
+	m.requests[requestKey{operation, method, fmt.Sprintf("%d", status)}]++
+
+	lk := latencyKey{operation, method}
+	h, ok := m.latencies[lk]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		m.latencies[lk] = h
+	}
+	seconds := elapsed.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// writePrometheus writes all metrics in the Prometheus text exposition format.
+func (m *proxyMetrics) writePrometheus(w *strings.Builder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	telemetry.Header(w, "ebay_proxy_requests_total", "Proxied eBay API calls by operation, method and status.", "counter")
+	reqKeys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		reqKeys = append(reqKeys, k)
+	}
+	sort.Slice(reqKeys, func(i, j int) bool {
+		a, b := reqKeys[i], reqKeys[j]
+		if a.operation != b.operation {
+			return a.operation < b.operation
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	for _, k := range reqKeys {
+		fmt.Fprintf(w, "ebay_proxy_requests_total{operation=%q,method=%q,status=%q} %d\n",
+			k.operation, k.method, k.status, m.requests[k])
+	}
+
+	telemetry.Header(w, "ebay_proxy_request_duration_seconds", "Latency of proxied eBay API calls.", "histogram")
+	latKeys := make([]latencyKey, 0, len(m.latencies))
+	for k := range m.latencies {
+		latKeys = append(latKeys, k)
+	}
+	sort.Slice(latKeys, func(i, j int) bool {
+		if latKeys[i].operation != latKeys[j].operation {
+			return latKeys[i].operation < latKeys[j].operation
+		}
+		return latKeys[i].method < latKeys[j].method
+	})
+	for _, k := range latKeys {
+		h := m.latencies[k]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.buckets[i]
+			fmt.Fprintf(w, "ebay_proxy_request_duration_seconds_bucket{operation=%q,method=%q,le=\"%g\"} %d\n",
+				k.operation, k.method, bound, cumulative)
+		}
+		fmt.Fprintf(w, "ebay_proxy_request_duration_seconds_bucket{operation=%q,method=%q,le=\"+Inf\"} %d\n",
+			k.operation, k.method, h.count)
+		fmt.Fprintf(w, "ebay_proxy_request_duration_seconds_sum{operation=%q,method=%q} %g\n",
+			k.operation, k.method, h.sum)
+		fmt.Fprintf(w, "ebay_proxy_request_duration_seconds_count{operation=%q,method=%q} %d\n",
+			k.operation, k.method, h.count)
+	}
+
+	telemetry.Counter(w, "ebay_proxy_slow_requests_total",
+		"Proxied eBay calls slower than SLOW_REQUEST_THRESHOLD.", "operation", m.slow)
+	telemetry.Counter(w, "ebay_proxy_large_responses_total",
+		"Proxied eBay responses larger than LARGE_RESPONSE_BYTES.", "operation", m.large)
+}
+
+// handleMetrics serves the metrics in the Prometheus text format.
+// GET /metrics
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	telemetry.Serve(w, metrics.writePrometheus, upstream.writePrometheus, compression.writePrometheus, writeReloadMetrics)
+}
+
+// statusClientClosedRequest records calls abandoned by the client (the
+// status nginx uses for this); it is never seen by the client.
+const statusClientClosedRequest = 499
+
+// statusRecorder captures the status code and body size written by a
+// handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streamed proxy responses pass through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
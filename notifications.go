@@ -0,0 +1,194 @@
+package ebaymcp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ### eBay Notifications #####################################################
+
+// eBay push notifications carry an X-EBAY-SIGNATURE header: base64 JSON
+// naming the key ("kid") and an ECDSA signature over the raw body. The public
+// key is fetched from the Notification API and cached.
+
+// notificationSignatureHeader is set by eBay on every notification.
+const notificationSignatureHeader = "X-Ebay-Signature"
+
+// publicKeyCacheTTL follows eBay's advice to cache keys for an hour.
+const publicKeyCacheTTL = time.Hour
+
+// notificationSignature is the decoded X-EBAY-SIGNATURE header.
+type notificationSignature struct {
+	Alg       string `json:"alg"`
+	Kid       string `json:"kid"`
+	Signature string `json:"signature"`
+	Digest    string `json:"digest"`
+}
+
+type cachedPublicKey struct {
+	key    *ecdsa.PublicKey
+	digest string
+}
+
+// publicKeyResponse is eBay's getPublicKey response, which is also what
+// publicKeyCache keeps.
+type publicKeyResponse struct {
+	Key       string `json:"key"`
+	Algorithm string `json:"algorithm"`
+	Digest    string `json:"digest"`
+}
+
+// answerChallenge responds to eBay's endpoint verification request
+// (GET ?challenge_code=...) with hex(SHA-256(code + token + endpoint)).
+// endpoint must be exactly the URL registered with eBay.
+func answerChallenge(w http.ResponseWriter, r *http.Request, verificationToken, endpoint string) {
+	challenge := r.URL.Query().Get("challenge_code")
+	if challenge == "" {
+		http.Error(w, "Missing challenge_code", http.StatusBadRequest)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(challenge + verificationToken + endpoint))
+	writeJSON(w, http.StatusOK, map[string]string{"challengeResponse": hex.EncodeToString(sum[:])})
+}
+
+// notificationEnvironment is the environment whose keyset is used to look
+// up notification keys: production when configured.
+func notificationEnvironment() *ebayEnvironment {
+	if env := environments[envProduction]; env != nil {
+		return env
+	}
+	return environments[defaultEnvironment]
+}
+
+// verifyNotification checks the X-EBAY-SIGNATURE header against body.
+func verifyNotification(ctx context.Context, header string, body []byte) error {
+	if header == "" {
+		return errors.New("missing signature header")
+	}
+	raw, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return fmt.Errorf("signature header is not base64: %w", err)
+	}
+	var sig notificationSignature
+	if err := json.Unmarshal(raw, &sig); err != nil {
+		return fmt.Errorf("signature header is not JSON: %w", err)
+	}
+	if sig.Kid == "" || sig.Signature == "" {
+		return errors.New("signature header is incomplete")
+	}
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return fmt.Errorf("signature is not base64: %w", err)
+	}
+
+	key, err := notificationPublicKey(ctx, sig.Kid)
+	if err != nil {
+		return err
+	}
+
+	var digest []byte
+	switch strings.ToUpper(key.digest) {
+	case "SHA1", "":
+		sum := sha1.Sum(body)
+		digest = sum[:]
+	case "SHA256":
+		sum := sha256.Sum256(body)
+		digest = sum[:]
+	default:
+		return fmt.Errorf("unsupported signature digest %q", key.digest)
+	}
+
+	if !ecdsa.VerifyASN1(key.key, digest, signature) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// notificationPublicKey returns the (cached) public key for kid.
+func notificationPublicKey(ctx context.Context, kid string) (cachedPublicKey, error) {
+	if data, ok := publicKeyCache.Get(ctx, "ebay", kid); ok {
+		var result publicKeyResponse
+		if json.Unmarshal(data, &result) == nil {
+			if key, err := parseNotificationKey(result.Key); err == nil {
+				return cachedPublicKey{key: key, digest: result.Digest}, nil
+			}
+		}
+	}
+
+	env := notificationEnvironment()
+	appToken, err := applicationToken(ctx, env, signingScope)
+	if err != nil {
+		return cachedPublicKey{}, fmt.Errorf("failed to get application token: %w", err)
+	}
+
+	endpoint := "https://" + env.APIHost + "/commerce/notification/v1/public_key/" + kid
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return cachedPublicKey{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+appToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return cachedPublicKey{}, fmt.Errorf("failed to fetch notification public key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return cachedPublicKey{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return cachedPublicKey{}, fmt.Errorf("getPublicKey returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var result publicKeyResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return cachedPublicKey{}, fmt.Errorf("failed to parse public key response: %w", err)
+	}
+
+	key, err := parseNotificationKey(result.Key)
+	if err != nil {
+		return cachedPublicKey{}, err
+	}
+
+	data, _ := json.Marshal(result)
+	publicKeyCache.Set(ctx, "ebay", kid, data, publicKeyCacheTTL)
+	return cachedPublicKey{key: key, digest: result.Digest}, nil
+}
+
+// parseNotificationKey parses eBay's PEM public key. eBay sometimes returns
+// it on a single line, so the PEM framing is normalized first.
+func parseNotificationKey(key string) (*ecdsa.PublicKey, error) {
+	const begin, end = "-----BEGIN PUBLIC KEY-----", "-----END PUBLIC KEY-----"
+	body := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(key), begin), end))
+	block, _ := pem.Decode([]byte(begin + "\n" + body + "\n" + end + "\n"))
+	if block == nil {
+		return nil, errors.New("notification public key is not PEM")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse notification public key: %w", err)
+	}
+	ecKey, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("notification public key is not ECDSA")
+	}
+	return ecKey, nil
+}
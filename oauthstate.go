@@ -0,0 +1,139 @@
+package ebaymcp
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ### OAuth State ############################################################
+
+// /authorize has to remember OpenAI's redirect_uri and state until eBay
+// sends the user back to /callback. Rather than keeping them in memory,
+// which breaks as soon as the callback lands on another replica or after a
+// restart, they travel inside the state we hand eBay: a JSON payload with
+// the issue time and a nonce, encrypted and authenticated with AES-GCM
+// under OAUTH_STATE_KEY. eBay and the browser see an opaque blob; a blob
+// that was altered, made with another key or is older than OAUTH_STATE_TTL
+// is rejected. Nonces seen by /callback are remembered in the shared cache
+// until the state expires, so a state is only used once.
+//
+// Replicas must share OAUTH_STATE_KEY. Without it each process picks a
+// random key, and flows started before a restart fail.
+
+const defaultOAuthStateTTL = 10 * time.Minute
+
+var (
+	errStateInvalid = errors.New("invalid OAuth state")
+	errStateExpired = errors.New("expired OAuth state")
+	errStateReused  = errors.New("OAuth state already used")
+)
+
+// stateCache remembers the nonces of redeemed states and the authorization
+// codes being redeemed at /token.
+var stateCache = cacheNamespace{name: "oauth-state"}
+
+// oauthState is what /authorize hands to /callback through eBay.
+type oauthState struct {
+	RedirectURI string `json:"r"` // OpenAI's redirect_uri
+	State       string `json:"s"` // OpenAI's state
+	IssuedAt    int64  `json:"i"`
+	Nonce       string `json:"n"`
+}
+
+// stateSealer encrypts and opens state blobs.
+type stateSealer struct {
+	aead cipher.AEAD
+	ttl  time.Duration
+}
+
+// states is configured at startup.
+var states *stateSealer
+
+// stateSealerFromEnv reads OAUTH_STATE_KEY (any string, hashed into an
+// AES-256 key) and OAUTH_STATE_TTL.
+func stateSealerFromEnv() (*stateSealer, error) {
+	key := make([]byte, 32)
+	if v := os.Getenv("OAUTH_STATE_KEY"); v != "" {
+		sum := sha256.Sum256([]byte(v))
+		key = sum[:]
+	} else if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &stateSealer{aead: aead, ttl: defaultOAuthStateTTL}
+	if v := os.Getenv("OAUTH_STATE_TTL"); v != "" {
+		if s.ttl, err = time.ParseDuration(v); err != nil || s.ttl <= 0 {
+			return nil, fmt.Errorf("invalid OAUTH_STATE_TTL %q", v)
+		}
+	}
+	return s, nil
+}
+
+// Seal returns the state to send to eBay for OpenAI's redirectURI and state.
+func (s *stateSealer) Seal(redirectURI, state string, now time.Time) (string, error) {
+	nonce, err := randomID(12)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(oauthState{RedirectURI: redirectURI, State: state, IssuedAt: now.Unix(), Nonce: nonce})
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(iv, iv, payload, []byte("oauth-state"))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a state received at /callback, checks its age and marks it
+// used.
+func (s *stateSealer) Open(ctx context.Context, blob string, now time.Time) (*oauthState, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(blob)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return nil, errStateInvalid
+	}
+	iv, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	payload, err := s.aead.Open(nil, iv, ciphertext, []byte("oauth-state"))
+	if err != nil {
+		return nil, errStateInvalid
+	}
+
+	var st oauthState
+	if err := json.Unmarshal(payload, &st); err != nil || st.Nonce == "" {
+		return nil, errStateInvalid
+	}
+	issued := time.Unix(st.IssuedAt, 0)
+	if now.Sub(issued) > s.ttl || issued.After(now.Add(time.Minute)) {
+		return nil, errStateExpired
+	}
+
+	claimed, err := stateCache.Claim(ctx, "nonce", st.Nonce, s.ttl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim the OAuth state nonce: %w", err)
+	}
+	if !claimed {
+		return nil, errStateReused
+	}
+	return &st, nil
+}
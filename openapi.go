@@ -0,0 +1,167 @@
+package ebaymcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ### OpenAPI Schema #########################################################
+
+// buildOpenAPI renders the enabled tools of profile tp (nil for all) as an
+// OpenAPI 3.1 document in the shape the GPT builder accepts: one operation
+// per tool under /proxy (or its own path), and OAuth pointing at this server's /authorize and
+// /token endpoints.
+func buildOpenAPI(p *Policy, tp *toolProfile, baseURL, serviceName string, scopes []string) map[string]interface{} {
+	tools := profileTools(p, tp)
+	description := "Calls eBay REST APIs on behalf of the connected eBay account."
+	if tp != nil {
+		serviceName += " " + tp.Title
+		description = tp.Description
+		scopes = profileScopes(p, tools, scopes)
+	}
+
+	paths := make(map[string]map[string]interface{})
+	for _, t := range tools {
+		path := t.serverPath(t.Path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(t.Method)] = openAPIOperation(t)
+	}
+
+	scopeDescriptions := make(map[string]string)
+	for _, s := range scopes {
+		name := strings.TrimPrefix(strings.TrimPrefix(s, scopeBase), "/")
+		if name == "" {
+			name = "public data"
+		}
+		scopeDescriptions[s] = "eBay " + name
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":       serviceName,
+			"description": description,
+			"version":     "1.0.0",
+		},
+		"servers": []map[string]string{{"url": baseURL}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{},
+			"securitySchemes": map[string]interface{}{
+				"ebayOAuth": map[string]interface{}{
+					"type": "oauth2",
+					"flows": map[string]interface{}{
+						"authorizationCode": map[string]interface{}{
+							"authorizationUrl": baseURL + "/authorize",
+							"tokenUrl":         baseURL + "/token",
+							"scopes":           scopeDescriptions,
+						},
+					},
+				},
+			},
+		},
+		"security": []map[string][]string{{"ebayOAuth": scopes}},
+	}
+}
+
+// openAPIOperation describes one tool.
+func openAPIOperation(t toolRoute) map[string]interface{} {
+	op := map[string]interface{}{
+		"operationId": t.Name,
+		"summary":     t.Summary,
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "The eBay API response",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": map[string]string{"type": "object"}},
+				},
+			},
+		},
+	}
+	if t.Description != "" {
+		op["description"] = t.Description
+	}
+
+	params := make([]map[string]interface{}, 0, len(t.Params))
+	for _, p := range t.Params {
+		schema := map[string]interface{}{"type": p.Type}
+		if len(p.Enum) > 0 {
+			schema["enum"] = p.Enum
+		}
+		param := map[string]interface{}{
+			"name":     p.Name,
+			"in":       p.In,
+			"required": p.Required || p.In == "path",
+			"schema":   schema,
+		}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		params = append(params, param)
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if t.Body != "" {
+		op["requestBody"] = map[string]interface{}{
+			"required":    true,
+			"description": t.Body,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]string{"type": "object"}},
+			},
+		}
+	}
+	return op
+}
+
+// handleOpenAPI serves the GPT Actions schema of the profile selected with
+// ?profile=, TOOL_PROFILE by default.
+// GET /openapi.json
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	tp, err := toolProfileFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d := legalDetailsFor(r)
+	writeJSON(w, http.StatusOK, buildOpenAPI(currentPolicy(), tp, d.BaseURL, d.ServiceName, defaultEnvironmentFor(r).OAuth.Scopes))
+}
+
+// runGenOpenAPICommand implements `ebay-mcp gen-openapi <base-url> [file]`,
+// writing the schema for POLICY_FILE, EBAY_SCOPES and TOOL_PROFILE to file
+// or stdout.
+func runGenOpenAPICommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ebay-mcp gen-openapi <base-url> [file]")
+	}
+
+	p, err := loadPolicy(os.Getenv("POLICY_FILE"))
+	if err != nil {
+		return err
+	}
+	tp, err := defaultToolProfile()
+	if err != nil {
+		return err
+	}
+	scopes := strings.Fields(os.Getenv("EBAY_SCOPES"))
+	sort.Strings(scopes)
+
+	doc := buildOpenAPI(p, tp, strings.TrimRight(args[0], "/"), envOr("SERVICE_NAME", "eBay Assistant"), scopes)
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if len(args) > 1 {
+		return os.WriteFile(args[1], data, 0o644)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -0,0 +1,394 @@
+package ebaymcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/ebay"
+)
+
+// ### Order Management #######################################################
+
+// The order tools answer "show my unshipped orders" and "mark order X
+// shipped with tracking Y" without the assistant writing Fulfillment API
+// filters or shipping fulfillment payloads:
+//
+//	GET  /orders?status=unshipped&days=7        listOrders
+//	GET  /orders/{order_id}                     getOrderSummary
+//	POST /orders/{order_id}/shipment            markOrderShipped
+//	     {"tracking_number": "1Z...", "carrier": "UPS"}
+//
+// Orders come back slimmed to what fits an assistant's context: IDs,
+// dates, status, buyer, totals and line items, and where they ship to
+// unless MINIMIZE_BUYER_PII is set. The full order stays available as
+// getOrder.
+
+const (
+	ordersPath          = "/orders"
+	defaultOrderDays    = 30
+	maxOrderDays        = 730 // getOrders' creation date limit: two years
+	defaultOrderResults = 25
+	maxOrderResults     = 200
+)
+
+// orderStatusFilters are the fulfillment statuses of listOrders' status
+// parameter. getOrders only filters by NOT_STARTED|IN_PROGRESS or
+// FULFILLED|IN_PROGRESS, so "shipped" is narrowed down here.
+var orderStatusFilters = map[string]string{
+	"unshipped": "orderfulfillmentstatus:{NOT_STARTED|IN_PROGRESS}",
+	"shipped":   "orderfulfillmentstatus:{FULFILLED|IN_PROGRESS}",
+	"all":       "",
+}
+
+// orderFilter builds the getOrders filter of orders with status created
+// from from until to (either may be zero).
+func orderFilter(status string, from, to time.Time) (string, error) {
+	statusFilter, ok := orderStatusFilters[status]
+	if !ok {
+		return "", errors.New("status must be unshipped, shipped or all")
+	}
+	var filters []string
+	if statusFilter != "" {
+		filters = append(filters, statusFilter)
+	}
+	if !from.IsZero() || !to.IsZero() {
+		const timeFormat = "2006-01-02T15:04:05.000Z"
+		var start, end string
+		if !from.IsZero() {
+			start = from.UTC().Format(timeFormat)
+		}
+		if !to.IsZero() {
+			end = to.UTC().Format(timeFormat)
+		}
+		filters = append(filters, "creationdate:["+start+".."+end+"]")
+	}
+	return strings.Join(filters, ","), nil
+}
+
+// orderSummary is an order slimmed for an assistant.
+type orderSummary struct {
+	OrderID           string             `json:"order_id"`
+	Created           time.Time          `json:"created"`
+	FulfillmentStatus string             `json:"fulfillment_status"`
+	PaymentStatus     string             `json:"payment_status"`
+	Cancelled         bool               `json:"cancelled,omitempty"`
+	Buyer             string             `json:"buyer"`
+	Total             ebay.Amount        `json:"total"`
+	Items             []orderItemSummary `json:"items"`
+	ShipTo            *orderShipTo       `json:"ship_to,omitempty"`
+	ShippingService   string             `json:"shipping_service,omitempty"`
+}
+
+// orderItemSummary is a line item of an orderSummary.
+type orderItemSummary struct {
+	LineItemID string      `json:"line_item_id"`
+	ItemID     string      `json:"item_id,omitempty"`
+	SKU        string      `json:"sku,omitempty"`
+	Title      string      `json:"title"`
+	Quantity   int         `json:"quantity"`
+	Price      ebay.Amount `json:"price"`
+	Status     string      `json:"status"`
+}
+
+// orderShipTo is where an order ships to.
+type orderShipTo struct {
+	Name       string `json:"name,omitempty"`
+	City       string `json:"city,omitempty"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// summarizeOrder slims o.
+func summarizeOrder(o *ebay.Order) orderSummary {
+	s := orderSummary{
+		OrderID:           o.OrderID,
+		Created:           o.CreationDate,
+		FulfillmentStatus: o.OrderFulfillmentStatus,
+		PaymentStatus:     o.OrderPaymentStatus,
+		Cancelled:         o.CancelStatus.CancelState == "CANCELED",
+		Buyer:             o.Buyer.Username,
+		Total:             o.PricingSummary.Total,
+		Items:             make([]orderItemSummary, 0, len(o.LineItems)),
+	}
+	for _, li := range o.LineItems {
+		s.Items = append(s.Items, orderItemSummary{
+			LineItemID: li.LineItemID,
+			ItemID:     li.LegacyItemID,
+			SKU:        li.SKU,
+			Title:      li.Title,
+			Quantity:   li.Quantity,
+			Price:      li.LineItemCost,
+			Status:     li.LineItemFulfillmentStatus,
+		})
+	}
+	for _, instruction := range o.FulfillmentStartInstructions {
+		step := instruction.ShippingStep
+		if step == nil {
+			continue
+		}
+		s.ShippingService = step.ShippingServiceCode
+		if !minimizeBuyerPII {
+			addr := step.ShipTo.ContactAddress
+			s.ShipTo = &orderShipTo{
+				Name:       step.ShipTo.FullName,
+				City:       addr.City,
+				State:      addr.StateOrProvince,
+				PostalCode: addr.PostalCode,
+				Country:    addr.CountryCode,
+			}
+		}
+		break
+	}
+	return s
+}
+
+// handleOrders serves the order tools under /orders.
+func handleOrders(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, ordersPath), "/")
+	parts := strings.Split(rest, "/")
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		handleListOrders(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		handleOrderSummary(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "shipment" && r.Method == http.MethodPost:
+		handleMarkShipped(w, r, parts[0])
+	case rest == "" || len(parts) == 1 || len(parts) == 2 && parts[1] == "shipment":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// orderCaller resolves the caller of an order tool and checks that the
+// policy allows the Fulfillment API path the tool calls.
+func orderCaller(w http.ResponseWriter, r *http.Request, method, path string) (*ebayCaller, bool) {
+	if err := currentPolicy().AllowPath(method, path); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, false
+	}
+	caller, status, err := resolveCaller(w, r)
+	if err != nil {
+		log.Printf("Failed to resolve token for the order tools: %v", err)
+		http.Error(w, err.Error(), status)
+		return nil, false
+	}
+	return caller, true
+}
+
+// handleListOrders (listOrders) lists orders by status and creation date.
+// GET /orders?status=unshipped|shipped|all&days=N (or created_from and
+// created_to as RFC 3339 times or dates)&limit=N&offset=N
+func handleListOrders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status := q.Get("status")
+	if status == "" {
+		status = "unshipped"
+	}
+	from, to, err := orderDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := orderFilter(status, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := boundedParam(r, "limit", defaultOrderResults, maxOrderResults)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			http.Error(w, "offset must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	caller, ok := orderCaller(w, r, http.MethodGet, orderPathPrefix)
+	if !ok {
+		return
+	}
+	page, err := caller.client().GetOrders(r.Context(), ebay.OrderSearch{Filter: filter, Limit: limit, Offset: offset})
+	if err != nil {
+		log.Printf("listOrders failed: %v", err)
+		writeEbayError(w, r, caller, err)
+		return
+	}
+
+	orders := make([]orderSummary, 0, len(page.Orders))
+	for i := range page.Orders {
+		o := &page.Orders[i]
+		if status == "shipped" && o.OrderFulfillmentStatus != "FULFILLED" {
+			continue
+		}
+		orders = append(orders, summarizeOrder(o))
+	}
+	resp := map[string]interface{}{
+		"status": status,
+		"orders": orders,
+		"total":  page.Total,
+		"filter": filter,
+	}
+	if offset+len(page.Orders) < page.Total {
+		resp["next_offset"] = offset + len(page.Orders)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// orderDateRange reads the creation date range of listOrders: created_from
+// and created_to, or the last days days (default 30).
+func orderDateRange(r *http.Request) (from, to time.Time, err error) {
+	q := r.URL.Query()
+	if q.Get("created_from") == "" && q.Get("created_to") == "" {
+		days, err := boundedParam(r, "days", defaultOrderDays, maxOrderDays)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		return time.Now().AddDate(0, 0, -days), time.Time{}, nil
+	}
+	if from, err = parseOrderTime(q.Get("created_from")); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("created_from: %w", err)
+	}
+	if to, err = parseOrderTime(q.Get("created_to")); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("created_to: %w", err)
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("created_to is before created_from")
+	}
+	return from, to, nil
+}
+
+// parseOrderTime parses an RFC 3339 time or a date (midnight UTC); "" is
+// the zero time.
+func parseOrderTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return time.Time{}, errors.New("expected an RFC 3339 time or a date such as 2026-05-01")
+	}
+	return t, nil
+}
+
+// handleOrderSummary (getOrderSummary) returns one order, slimmed.
+// GET /orders/{order_id}
+func handleOrderSummary(w http.ResponseWriter, r *http.Request, orderID string) {
+	caller, ok := orderCaller(w, r, http.MethodGet, orderPathPrefix+"/"+orderID)
+	if !ok {
+		return
+	}
+	order, err := caller.client().GetOrder(r.Context(), orderID)
+	if err != nil {
+		log.Printf("getOrderSummary failed: %v", err)
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, summarizeOrder(order))
+}
+
+// shipmentRequest is the body of markOrderShipped.
+type shipmentRequest struct {
+	TrackingNumber string     `json:"tracking_number"`
+	Carrier        string     `json:"carrier"`                 // eBay's shipping carrier code, e.g. USPS, UPS, FEDEX, DHL
+	LineItemIDs    []string   `json:"line_item_ids,omitempty"` // all unshipped line items when empty
+	ShippedDate    *time.Time `json:"shipped_date,omitempty"`  // now when empty
+}
+
+// handleMarkShipped (markOrderShipped) marks line items of an order
+// shipped, all that aren't yet unless line_item_ids names some, with a
+// tracking number.
+// POST /orders/{order_id}/shipment
+func handleMarkShipped(w http.ResponseWriter, r *http.Request, orderID string) {
+	var req shipmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Body must be JSON with tracking_number and carrier", http.StatusBadRequest)
+		return
+	}
+	req.TrackingNumber = strings.TrimSpace(req.TrackingNumber)
+	req.Carrier = strings.TrimSpace(req.Carrier)
+	if req.TrackingNumber == "" || req.Carrier == "" {
+		http.Error(w, "tracking_number and carrier are required", http.StatusBadRequest)
+		return
+	}
+
+	path := orderPathPrefix + "/" + orderID + "/shipping_fulfillment"
+	caller, ok := orderCaller(w, r, http.MethodPost, path)
+	if !ok {
+		return
+	}
+	client := caller.client()
+	order, err := client.GetOrder(r.Context(), orderID)
+	if err != nil {
+		log.Printf("markOrderShipped failed to load the order: %v", err)
+		writeEbayError(w, r, caller, err)
+		return
+	}
+
+	fulfillment := &ebay.ShippingFulfillment{
+		ShippedDate:         req.ShippedDate,
+		ShippingCarrierCode: req.Carrier,
+		TrackingNumber:      req.TrackingNumber,
+	}
+	wanted := make(map[string]bool, len(req.LineItemIDs))
+	for _, id := range req.LineItemIDs {
+		wanted[id] = true
+	}
+	for _, li := range order.LineItems {
+		if len(wanted) > 0 && !wanted[li.LineItemID] {
+			continue
+		}
+		if len(wanted) == 0 && li.LineItemFulfillmentStatus == "FULFILLED" {
+			continue
+		}
+		delete(wanted, li.LineItemID)
+		fulfillment.LineItems = append(fulfillment.LineItems, ebay.LineItemReference{LineItemID: li.LineItemID, Quantity: li.Quantity})
+	}
+	if len(wanted) > 0 {
+		var unknown []string
+		for id := range wanted {
+			unknown = append(unknown, id)
+		}
+		http.Error(w, "The order has no line items "+strings.Join(unknown, ", "), http.StatusBadRequest)
+		return
+	}
+	if len(fulfillment.LineItems) == 0 {
+		http.Error(w, "Every line item of the order is already shipped", http.StatusConflict)
+		return
+	}
+
+	fulfillmentID, err := client.CreateShippingFulfillment(r.Context(), orderID, fulfillment)
+	if err != nil {
+		log.Printf("markOrderShipped failed: %v", err)
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	audit.Record("order.shipped", map[string]string{
+		"order_id":       orderID,
+		"fulfillment_id": fulfillmentID,
+		"carrier":        req.Carrier,
+		"token_hash":     tokenHash(caller.bearer),
+	})
+	caller.wrote(r.Context())
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"order_id":        orderID,
+		"fulfillment_id":  fulfillmentID,
+		"line_items":      fulfillment.LineItems,
+		"carrier":         req.Carrier,
+		"tracking_number": req.TrackingNumber,
+	})
+}
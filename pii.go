@@ -0,0 +1,106 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ### Buyer PII minimization #################################################
+
+// minimizeBuyerPII strips buyer name, address and phone details from order
+// responses before they reach the LLM client (MINIMIZE_BUYER_PII=true). The
+// data stays with eBay, so label purchase and shipping calls that reference
+// the order ID keep working.
+var minimizeBuyerPII bool
+
+// orderPathPrefix covers getOrders and getOrder.
+const orderPathPrefix = "/sell/fulfillment/v1/order"
+
+// buyerPIIPaths are removed from order responses in minimization mode.
+var buyerPIIPaths = mustCompilePaths(
+	"$..buyer.buyerRegistrationAddress",
+	"$..buyer.taxAddress",
+	"$..buyer.taxIdentifier",
+	"$..shippingStep.shipTo",
+)
+
+func mustCompilePaths(paths ...string) [][]pathStep {
+	compiled := make([][]pathStep, 0, len(paths))
+	for _, path := range paths {
+		steps, err := compileRedactionPath(path)
+		if err != nil {
+			panic(err)
+		}
+		compiled = append(compiled, steps)
+	}
+	return compiled
+}
+
+// stripsBuyerPII reports whether responses for path are rewritten. The
+// shipping_fulfillment sub-resources carry no buyer details.
+func stripsBuyerPII(path string) bool {
+	if !minimizeBuyerPII || !strings.HasPrefix(path, orderPathPrefix) {
+		return false
+	}
+	rest := strings.Trim(strings.TrimPrefix(path, orderPathPrefix), "/")
+	return !strings.Contains(rest, "/")
+}
+
+// stripBuyerPII removes buyerPIIPaths from a successful JSON order response,
+// replacing resp.Body. Non-JSON or unparsable bodies pass through unchanged.
+func stripBuyerPII(resp *http.Response) error {
+	body, err := readLimited(resp.Body, maxResponseBufferSize)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err == nil {
+		for _, steps := range buyerPIIPaths {
+			doc = removePath(doc, steps)
+		}
+		if out, err := json.Marshal(doc); err == nil {
+			body = out
+		}
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// removePath deletes every object key in node selected by steps. It mirrors
+// redactPath but drops the value instead of masking it.
+func removePath(node interface{}, steps []pathStep) interface{} {
+	step := steps[0]
+
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if step.key != "" && key == step.key {
+				if len(steps) == 1 {
+					delete(v, key)
+				} else {
+					v[key] = removePath(child, steps[1:])
+				}
+			} else if step.recursive {
+				v[key] = removePath(child, steps)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if step.key == "" && len(steps) > 1 {
+				v[i] = removePath(child, steps[1:])
+			} else if step.recursive {
+				v[i] = removePath(child, steps)
+			}
+		}
+	}
+	return node
+}
@@ -0,0 +1,350 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ### Proxy Policy ###########################################################
+
+// Policy is the operator-editable configuration of what the proxy exposes:
+// which eBay paths may be called, which tools are offered, how fast clients
+// may call, and which OAuth scopes each API family needs. It is kept in a
+// single YAML document (POLICY_FILE) so it can be exported from one
+// deployment and imported into another.
+type Policy struct {
+	Version       int                `yaml:"version"`
+	Paths         []PathRule         `yaml:"paths,omitempty"`
+	Tools         []ToolRule         `yaml:"tools,omitempty"`
+	RateLimits    RateLimitPolicy    `yaml:"rate_limits"`
+	Scopes        []ScopeMapping     `yaml:"scopes,omitempty"`
+	Redaction     RedactionPolicy    `yaml:"redaction,omitempty"`
+	Transforms    []TransformRule    `yaml:"transforms,omitempty"`
+	TokenResponse []TokenRewriteRule `yaml:"token_response,omitempty"`
+	Cache         []CacheRule        `yaml:"cache,omitempty"`
+	Compression   []CompressionRule  `yaml:"compression,omitempty"`
+	Timeouts      []TimeoutRule      `yaml:"timeouts,omitempty"`
+	Flags         []FlagRule         `yaml:"flags,omitempty"`
+	BestOffers    BestOfferPolicy    `yaml:"best_offers,omitempty"`
+	UnsoldTriage  UnsoldTriagePolicy `yaml:"unsold_triage,omitempty"`
+	Purchases     PurchasePolicy     `yaml:"purchases,omitempty"`
+	Validation    ValidationPolicy   `yaml:"validation,omitempty"`
+	Idempotency   IdempotencyPolicy  `yaml:"idempotency,omitempty"`
+}
+
+// PathRule allows requests whose eBay path starts with Prefix. An empty
+// Methods list allows every method.
+type PathRule struct {
+	Prefix  string   `yaml:"prefix"`
+	Methods []string `yaml:"methods,omitempty"`
+}
+
+// ToolRule enables or disables a named tool exposed to assistants.
+type ToolRule struct {
+	Name    string `yaml:"name"`
+	Enabled bool   `yaml:"enabled"`
+}
+
+// RateLimitPolicy limits how many proxied calls a single access token may
+// make, and how many of them may run at once. Zero values mean "unlimited".
+type RateLimitPolicy struct {
+	RequestsPerMinute int           `yaml:"requests_per_minute"`
+	Burst             int           `yaml:"burst"`
+	MaxInFlight       int           `yaml:"max_in_flight,omitempty"`
+	Queue             int           `yaml:"queue,omitempty"`         // calls waiting for a slot; default MaxInFlight
+	QueueTimeout      time.Duration `yaml:"queue_timeout,omitempty"` // default 10s
+}
+
+// ScopeMapping lists the eBay OAuth scopes required for paths under Prefix:
+// a token must hold at least one of them. An empty Methods list applies the
+// mapping to every method.
+type ScopeMapping struct {
+	Prefix  string   `yaml:"prefix"`
+	Methods []string `yaml:"methods,omitempty"`
+	Scopes  []string `yaml:"scopes"`
+}
+
+// currentPolicyVersion is the schema version written by `config export`.
+const currentPolicyVersion = 1
+
+// activePolicy is the policy in effect for this process, replaced as a
+// whole when the policy is reloaded.
+var activePolicy atomic.Pointer[Policy]
+
+// currentPolicy returns the policy in effect, or the default before one is
+// loaded. Code consulting it several times for one request takes it once,
+// so that a reload in between can't mix two policies.
+func currentPolicy() *Policy {
+	if p := activePolicy.Load(); p != nil {
+		return p
+	}
+	return defaultPolicy()
+}
+
+// defaultPolicy returns the policy used when no POLICY_FILE is configured.
+// It places no restrictions on the proxy, matching its historic behaviour.
+func defaultPolicy() *Policy {
+	return &Policy{Version: currentPolicyVersion}
+}
+
+// loadPolicy reads and validates the policy at path. A missing file is not
+// an error: the default policy is returned instead.
+func loadPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return defaultPolicy(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("Policy file %s not found, using default policy", path)
+		return defaultPolicy(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	return parsePolicy(data)
+}
+
+// parsePolicy decodes a YAML policy document, rejecting unknown keys so that
+// typos don't silently disable a restriction.
+func parsePolicy(data []byte) (*Policy, error) {
+	p := defaultPolicy()
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("invalid policy YAML: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate checks the policy for mistakes an operator is likely to make.
+func (p *Policy) Validate() error {
+	var problems []string
+
+	if p.Version != currentPolicyVersion {
+		problems = append(problems, fmt.Sprintf("unsupported version %d (expected %d)", p.Version, currentPolicyVersion))
+	}
+
+	for i, rule := range p.Paths {
+		if !strings.HasPrefix(rule.Prefix, "/") {
+			problems = append(problems, fmt.Sprintf("paths[%d]: prefix %q must start with /", i, rule.Prefix))
+		}
+		for _, m := range rule.Methods {
+			if !isHTTPMethod(m) {
+				problems = append(problems, fmt.Sprintf("paths[%d]: unknown method %q", i, m))
+			}
+		}
+	}
+
+	seenTools := make(map[string]bool)
+	for i, tool := range p.Tools {
+		if tool.Name == "" {
+			problems = append(problems, fmt.Sprintf("tools[%d]: name is required", i))
+		} else if seenTools[tool.Name] {
+			problems = append(problems, fmt.Sprintf("tools[%d]: duplicate tool %q", i, tool.Name))
+		}
+		seenTools[tool.Name] = true
+	}
+
+	if p.RateLimits.RequestsPerMinute < 0 || p.RateLimits.Burst < 0 ||
+		p.RateLimits.MaxInFlight < 0 || p.RateLimits.Queue < 0 || p.RateLimits.QueueTimeout < 0 {
+		problems = append(problems, "rate_limits: values must not be negative")
+	}
+
+	for i, m := range p.Scopes {
+		if !strings.HasPrefix(m.Prefix, "/") {
+			problems = append(problems, fmt.Sprintf("scopes[%d]: prefix %q must start with /", i, m.Prefix))
+		}
+		if len(m.Scopes) == 0 {
+			problems = append(problems, fmt.Sprintf("scopes[%d]: at least one scope is required", i))
+		}
+		for _, method := range m.Methods {
+			if !isHTTPMethod(method) {
+				problems = append(problems, fmt.Sprintf("scopes[%d]: unknown method %q", i, method))
+			}
+		}
+	}
+
+	for i := range p.Transforms {
+		problems = append(problems, p.Transforms[i].validate(i)...)
+	}
+
+	for i := range p.TokenResponse {
+		problems = append(problems, p.TokenResponse[i].validate(i)...)
+	}
+
+	for i := range p.Cache {
+		problems = append(problems, p.Cache[i].validate(i)...)
+	}
+
+	for i := range p.Compression {
+		problems = append(problems, p.Compression[i].validate(i)...)
+	}
+
+	for i := range p.Timeouts {
+		problems = append(problems, p.Timeouts[i].validate(i)...)
+	}
+
+	seenFlags := make(map[string]bool)
+	for i := range p.Flags {
+		problems = append(problems, p.Flags[i].validate(i)...)
+		if seenFlags[p.Flags[i].Name] {
+			problems = append(problems, fmt.Sprintf("flags[%d]: duplicate flag %q", i, p.Flags[i].Name))
+		}
+		seenFlags[p.Flags[i].Name] = true
+	}
+
+	problems = append(problems, p.BestOffers.validate()...)
+	problems = append(problems, p.UnsoldTriage.validate()...)
+	problems = append(problems, p.Purchases.validate()...)
+	problems = append(problems, p.Validation.validate()...)
+	problems = append(problems, p.Idempotency.validate()...)
+
+	if _, err := newRedactor(p.Redaction); err != nil {
+		problems = append(problems, "redaction: "+err.Error())
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid policy:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// isHTTPMethod reports whether m is a standard HTTP method name.
+func isHTTPMethod(m string) bool {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// pathRuleFor returns the most specific rule whose prefix matches path.
+func (p *Policy) pathRuleFor(path string) (PathRule, bool) {
+	var best PathRule
+	found := false
+	for _, rule := range p.Paths {
+		if strings.HasPrefix(path, rule.Prefix) && (!found || len(rule.Prefix) > len(best.Prefix)) {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
+// AllowPath reports whether the proxy may forward method to the eBay path.
+// A policy without path rules allows everything; otherwise anything not
+// matched by a rule is denied. A HEAD request is allowed wherever GET is.
+func (p *Policy) AllowPath(method, path string) error {
+	if len(p.Paths) == 0 {
+		return nil
+	}
+
+	rule, ok := p.pathRuleFor(path)
+	if !ok {
+		return fmt.Errorf("%s is not enabled on this server", path)
+	}
+	if len(rule.Methods) == 0 {
+		return nil
+	}
+	for _, m := range rule.Methods {
+		if m == method || (method == http.MethodHead && m == http.MethodGet) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %s is not allowed on this server (allowed under %s: %s)",
+		method, path, rule.Prefix, strings.Join(rule.Methods, ", "))
+}
+
+// ### config export / import #################################################
+
+// runConfigCommand implements `ebay-mcp config export [file]` and
+// `ebay-mcp config import <file>`.
+//
+// export writes the effective policy (POLICY_FILE, or the defaults) as YAML to
+// the given file or stdout. import validates a YAML document and installs it
+// as POLICY_FILE, so a configuration tested in staging can be promoted to
+// production unchanged.
+func runConfigCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ebay-mcp config <check|export|import> [file]")
+	}
+
+	policyPath := os.Getenv("POLICY_FILE")
+
+	switch args[0] {
+	case "check":
+		return runConfigCheck(args[1:])
+
+	case "export":
+		p, err := loadPolicy(policyPath)
+		if err != nil {
+			return err
+		}
+		data, err := yaml.Marshal(p)
+		if err != nil {
+			return fmt.Errorf("failed to encode policy: %w", err)
+		}
+		if len(args) > 1 {
+			return os.WriteFile(args[1], data, 0o644)
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+
+	case "import":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: ebay-mcp config import <file>")
+		}
+		if policyPath == "" {
+			return fmt.Errorf("POLICY_FILE must be set to import a policy")
+		}
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", args[1], err)
+		}
+		if _, err := parsePolicy(data); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(policyPath, data); err != nil {
+			return err
+		}
+		log.Printf("Imported policy from %s into %s", args[1], policyPath)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+}
+
+// writeFileAtomic replaces path with data without ever leaving a partially
+// written file behind for a running proxy to read. The file is created with
+// mode 0600.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
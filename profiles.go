@@ -0,0 +1,157 @@
+package ebaymcp
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ### Tool Profiles ##########################################################
+
+// A deployment can publish focused assistants instead of one that does
+// everything: a tool profile is a pre-packaged subset of the tool registry
+// with its own OpenAPI document. GPTs pick theirs with
+// /openapi.json?profile=<name>, the MCP server and gen-openapi with
+// TOOL_PROFILE, which also sets the default for /openapi.json ("all", every
+// tool, when unset). Profiles only
+// narrow what is offered: the policy still decides which tools and routes
+// exist at all.
+
+// toolProfile is a named subset of the tool registry.
+type toolProfile struct {
+	Name        string
+	Title       string // appended to the service name
+	Description string
+	Tools       []string
+}
+
+var toolProfiles = []toolProfile{
+	{
+		Name:        "shopping",
+		Title:       "Shopping Assistant",
+		Description: "Searches eBay listings, finds deals and sales events, bids and buys with confirmation, and tracks purchases.",
+		Tools: []string{
+			"searchItems", "getItem", "getItemByLegacyId",
+			"getDealItems", "getDealEvents", "getEventItems",
+			"getGuestPurchaseOrder", "preparePurchase", "confirmPurchase",
+			"getDefaultCategoryTreeId", "getCategorySuggestions",
+			"research_sold_prices",
+		},
+	},
+	{
+		Name:        "seller",
+		Title:       "Seller Assistant",
+		Description: "Manages the connected seller's inventory, listings, orders, marketing and finances.",
+		Tools: []string{
+			"getInventoryItems", "getInventoryItem", "createOrReplaceInventoryItem",
+			"bulkCreateOrReplaceInventoryItem", "bulkUpdatePriceQuantity",
+			"getOffers", "createOffer", "publishOffer", "withdrawOffer",
+			"createListing", "uploadImage",
+			"getOrders", "getOrder", "createShippingFulfillment",
+			"listOrders", "getOrderSummary", "markOrderShipped",
+			"createFeedTask", "createInventoryTask", "createOrderTask",
+			"getFeedTask", "getFeedTaskStatus", "getFeedResultFile",
+			"createReportTask",
+			"getPromotions", "createItemPriceMarkdown", "getItemPriceMarkdown", "updateItemPriceMarkdown",
+			"deleteItemPriceMarkdown", "createItemPromotion", "getItemPromotion", "updateItemPromotion",
+			"deleteItemPromotion", "pausePromotion", "resumePromotion", "getUnsoldListingReport",
+			"getFulfillmentPolicies", "getPaymentPolicies", "getReturnPolicies",
+			"getFulfillmentPolicy", "createFulfillmentPolicy", "updateFulfillmentPolicy", "deleteFulfillmentPolicy",
+			"getPaymentPolicy", "createPaymentPolicy", "updatePaymentPolicy", "deletePaymentPolicy",
+			"getReturnPolicy", "createReturnPolicy", "updateReturnPolicy", "deleteReturnPolicy",
+			"getPrivileges", "getOptedInPrograms", "optInToProgram", "setupSellerAccount",
+			"getTransactions", "getPayouts",
+			"getUser", "research_sold_prices",
+			"tradingGetMyeBaySelling", "tradingGetItem", "tradingGetSellerList", "tradingGetSellerTransactions",
+			"tradingGetMyMessages", "tradingGetFeedback", "tradingGetStore",
+			"tradingReviseItem", "tradingReviseFixedPriceItem", "tradingReviseInventoryStatus",
+			"tradingEndItem", "tradingRelistItem", "tradingRelistFixedPriceItem",
+			"getDefaultCategoryTreeId", "getCategorySuggestions", "getItemAspectsForCategory",
+			"get_category_suggestions", "get_item_aspects_for_category",
+		},
+	},
+}
+
+// toolProfileNamed returns the profile called name, or nil (every tool)
+// for "all" and an empty name.
+func toolProfileNamed(name string) (*toolProfile, error) {
+	if name == "" || name == "all" {
+		return nil, nil
+	}
+	for i := range toolProfiles {
+		if toolProfiles[i].Name == name {
+			return &toolProfiles[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown tool profile %q (expected all, %s)", name, strings.Join(toolProfileNames(), ", "))
+}
+
+func toolProfileNames() []string {
+	names := make([]string, len(toolProfiles))
+	for i, tp := range toolProfiles {
+		names[i] = tp.Name
+	}
+	return names
+}
+
+// defaultToolProfile returns the profile named by TOOL_PROFILE.
+func defaultToolProfile() (*toolProfile, error) {
+	tp, err := toolProfileNamed(os.Getenv("TOOL_PROFILE"))
+	if err != nil {
+		return nil, fmt.Errorf("TOOL_PROFILE: %w", err)
+	}
+	return tp, nil
+}
+
+// Includes reports whether the profile offers tool name. The nil profile
+// offers every tool.
+func (tp *toolProfile) Includes(name string) bool {
+	if tp == nil {
+		return true
+	}
+	for _, t := range tp.Tools {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// profileTools returns the tools p enables that tp offers.
+func profileTools(p *Policy, tp *toolProfile) []toolRoute {
+	var tools []toolRoute
+	for _, t := range enabledTools(p) {
+		if tp.Includes(t.Name) {
+			tools = append(tools, t)
+		}
+	}
+	return tools
+}
+
+// profileScopes narrows granted to the scopes the tools may need: the base
+// scope and any scope a tool's route requires.
+func profileScopes(p *Policy, tools []toolRoute, granted []string) []string {
+	needed := map[string]bool{scopeBase: true}
+	for _, t := range tools {
+		for _, s := range p.RequiredScopes(t.Method, t.Path) {
+			needed[s] = true
+		}
+	}
+	var scopes []string
+	for _, s := range granted {
+		if needed[s] {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// toolProfileFor returns the profile a request selected with ?profile=, or
+// TOOL_PROFILE's.
+func toolProfileFor(r *http.Request) (*toolProfile, error) {
+	if name := r.URL.Query().Get("profile"); name != "" {
+		return toolProfileNamed(name)
+	}
+	return defaultToolProfile()
+}
@@ -0,0 +1,321 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ### Promotions #############################################################
+
+// Markdown sales (item_price_markdown) and coded coupons and other item
+// promotions (item_promotion) are checked against eBay's eligibility rules
+// before they are sent, so an assistant gets every problem at once, in
+// plain words, instead of eBay's first error code. The rules are eBay's
+// documented limits:
+//
+//   - a name (at most 90 characters), a marketplace, and RFC 3339 start and
+//     end dates, the end after the start and in the future
+//   - markdown sales run for at most 45 days and take 5 to 80 percent, or an
+//     amount, off each item
+//   - items are picked by value (listing IDs or SKUs, not both, at most 500),
+//     by rule, or all of them
+//   - coupons have a code of up to 15 letters and digits and a coupon type
+
+const (
+	maxPromotionNameLength = 90
+	maxMarkdownDuration    = 45 * 24 * time.Hour
+	maxPromotionListings   = 500
+	minMarkdownPercent     = 5
+	maxMarkdownPercent     = 80
+)
+
+// couponCodePattern is what eBay accepts as a coupon code.
+var couponCodePattern = regexp.MustCompile(`^[A-Za-z0-9]{1,15}$`)
+
+var (
+	promotionStatuses = []string{"DRAFT", "SCHEDULED"}
+	promotionTypes    = []string{"CODED_COUPON", "ORDER_DISCOUNT", "VOLUME_DISCOUNT"}
+	couponTypes       = []string{"PRIVATE_SINGLE_USE", "PRIVATE_MULTI_USE", "PUBLIC_SINGLE_USE", "PUBLIC_MULTI_USE"}
+	criterionTypes    = []string{"INVENTORY_BY_VALUE", "INVENTORY_BY_RULE", "INVENTORY_ANY"}
+)
+
+// promotionValidators check the JSON body of a promotion call, keyed by method
+// and operation template, returning its problems.
+var promotionValidators = map[string]func(body []byte, now time.Time) []string{
+	"POST /sell/marketing/v1/item_price_markdown":               validateMarkdown,
+	"PUT /sell/marketing/v1/item_price_markdown/{promotion_id}": validateMarkdown,
+	"POST /sell/marketing/v1/item_promotion":                    validateItemPromotion,
+	"PUT /sell/marketing/v1/item_promotion/{promotion_id}":      validateItemPromotion,
+}
+
+// checkPromotion runs the validator of the route, if any, on the request
+// body. It answers the request and returns false when the body is invalid.
+func checkPromotion(w http.ResponseWriter, r *http.Request, path string, loc localizer) bool {
+	validate := promotionValidators[r.Method+" "+operationFor(path)]
+	if validate == nil {
+		return true
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			writeBodyTooLarge(w, maxRequestBodySize)
+			return false
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	problems := validate(body, time.Now())
+	if len(problems) == 0 {
+		return true
+	}
+	log.Printf("Rejected %s %s before calling eBay: %s", r.Method, path, strings.Join(problems, "; "))
+	loc.setContentLanguage(w)
+	writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"error":    "invalid_promotion",
+		"problems": problems,
+		"message":  loc.T("promotion.invalid", strings.Join(problems, "; ")),
+	})
+	return false
+}
+
+// ### Promotion Rules ###
+
+type promotionAmount struct {
+	Value    string `json:"value"`
+	Currency string `json:"currency"`
+}
+
+type discountBenefit struct {
+	PercentageOffItem  string           `json:"percentageOffItem"`
+	PercentageOffOrder string           `json:"percentageOffOrder"`
+	AmountOffItem      *promotionAmount `json:"amountOffItem"`
+	AmountOffOrder     *promotionAmount `json:"amountOffOrder"`
+}
+
+type inventoryCriterion struct {
+	InventoryCriterionType string            `json:"inventoryCriterionType"`
+	ListingIDs             []string          `json:"listingIds"`
+	InventoryItems         []json.RawMessage `json:"inventoryItems"`
+	RuleCriteria           json.RawMessage   `json:"ruleCriteria"`
+}
+
+// promotionBase holds the fields markdowns and item promotions share.
+type promotionBase struct {
+	Name            string `json:"name"`
+	MarketplaceID   string `json:"marketplaceId"`
+	StartDate       string `json:"startDate"`
+	EndDate         string `json:"endDate"`
+	PromotionStatus string `json:"promotionStatus"`
+}
+
+type markdownRequest struct {
+	promotionBase
+	SelectedInventoryDiscounts []struct {
+		DiscountBenefit    discountBenefit    `json:"discountBenefit"`
+		InventoryCriterion inventoryCriterion `json:"inventoryCriterion"`
+	} `json:"selectedInventoryDiscounts"`
+}
+
+type itemPromotionRequest struct {
+	promotionBase
+	PromotionType string `json:"promotionType"`
+	DiscountRules []struct {
+		DiscountBenefit discountBenefit `json:"discountBenefit"`
+	} `json:"discountRules"`
+	InventoryCriterion  *inventoryCriterion `json:"inventoryCriterion"`
+	CouponConfiguration *struct {
+		CouponCode string `json:"couponCode"`
+		CouponType string `json:"couponType"`
+	} `json:"couponConfiguration"`
+}
+
+// validateMarkdown checks an ItemPriceMarkdown.
+func validateMarkdown(body []byte, now time.Time) []string {
+	var req markdownRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return []string{"body is not a valid ItemPriceMarkdown: " + err.Error()}
+	}
+
+	problems := req.promotionBase.validate(now, maxMarkdownDuration)
+	if len(req.SelectedInventoryDiscounts) == 0 {
+		problems = append(problems, "selectedInventoryDiscounts must list at least one discount")
+	}
+	for i, d := range req.SelectedInventoryDiscounts {
+		field := fmt.Sprintf("selectedInventoryDiscounts[%d]", i)
+		b := d.DiscountBenefit
+		switch {
+		case b.PercentageOffItem != "" && b.AmountOffItem != nil:
+			problems = append(problems, field+".discountBenefit: set percentageOffItem or amountOffItem, not both")
+		case b.PercentageOffItem != "":
+			problems = append(problems, checkPercent(field+".discountBenefit.percentageOffItem", b.PercentageOffItem, minMarkdownPercent, maxMarkdownPercent)...)
+		case b.AmountOffItem != nil:
+			problems = append(problems, checkAmount(field+".discountBenefit.amountOffItem", b.AmountOffItem)...)
+		default:
+			problems = append(problems, field+".discountBenefit: percentageOffItem or amountOffItem is required")
+		}
+		problems = append(problems, d.InventoryCriterion.validate(field+".inventoryCriterion")...)
+	}
+	return problems
+}
+
+// validateItemPromotion checks an ItemPromotion.
+func validateItemPromotion(body []byte, now time.Time) []string {
+	var req itemPromotionRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return []string{"body is not a valid ItemPromotion: " + err.Error()}
+	}
+
+	problems := req.promotionBase.validate(now, 0)
+	if !contains(promotionTypes, req.PromotionType) {
+		problems = append(problems, "promotionType must be one of "+strings.Join(promotionTypes, ", "))
+	}
+	if len(req.DiscountRules) == 0 {
+		problems = append(problems, "discountRules must list at least one rule")
+	}
+	for i, rule := range req.DiscountRules {
+		field := fmt.Sprintf("discountRules[%d].discountBenefit", i)
+		b := rule.DiscountBenefit
+		set := 0
+		for _, percent := range []struct{ name, value string }{{"percentageOffItem", b.PercentageOffItem}, {"percentageOffOrder", b.PercentageOffOrder}} {
+			if percent.value != "" {
+				set++
+				problems = append(problems, checkPercent(field+"."+percent.name, percent.value, 1, 99)...)
+			}
+		}
+		for _, amount := range []struct {
+			name  string
+			value *promotionAmount
+		}{{"amountOffItem", b.AmountOffItem}, {"amountOffOrder", b.AmountOffOrder}} {
+			if amount.value != nil {
+				set++
+				problems = append(problems, checkAmount(field+"."+amount.name, amount.value)...)
+			}
+		}
+		if set != 1 {
+			problems = append(problems, field+": exactly one percentage or amount off is required")
+		}
+	}
+	if req.InventoryCriterion == nil {
+		problems = append(problems, "inventoryCriterion is required")
+	} else {
+		problems = append(problems, req.InventoryCriterion.validate("inventoryCriterion")...)
+	}
+
+	if req.PromotionType == "CODED_COUPON" {
+		switch c := req.CouponConfiguration; {
+		case c == nil:
+			problems = append(problems, "couponConfiguration is required for CODED_COUPON promotions")
+		default:
+			if !couponCodePattern.MatchString(c.CouponCode) {
+				problems = append(problems, "couponConfiguration.couponCode must be 1 to 15 letters and digits")
+			}
+			if !contains(couponTypes, c.CouponType) {
+				problems = append(problems, "couponConfiguration.couponType must be one of "+strings.Join(couponTypes, ", "))
+			}
+		}
+	} else if req.CouponConfiguration != nil {
+		problems = append(problems, "couponConfiguration is only allowed for CODED_COUPON promotions")
+	}
+	return problems
+}
+
+// validate checks the name, marketplace, status and schedule. A zero
+// maxDuration doesn't limit the duration.
+func (p *promotionBase) validate(now time.Time, maxDuration time.Duration) []string {
+	var problems []string
+	if p.Name == "" {
+		problems = append(problems, "name is required")
+	} else if len([]rune(p.Name)) > maxPromotionNameLength {
+		problems = append(problems, fmt.Sprintf("name must be at most %d characters", maxPromotionNameLength))
+	}
+	if p.MarketplaceID == "" {
+		problems = append(problems, "marketplaceId is required")
+	}
+	if p.PromotionStatus != "" && !contains(promotionStatuses, p.PromotionStatus) {
+		problems = append(problems, "promotionStatus must be DRAFT or SCHEDULED")
+	}
+
+	start, startErr := time.Parse(time.RFC3339, p.StartDate)
+	end, endErr := time.Parse(time.RFC3339, p.EndDate)
+	if startErr != nil {
+		problems = append(problems, "startDate must be an RFC 3339 date, e.g. 2025-06-01T00:00:00.000Z")
+	}
+	if endErr != nil {
+		problems = append(problems, "endDate must be an RFC 3339 date, e.g. 2025-06-15T00:00:00.000Z")
+	}
+	if startErr == nil && endErr == nil {
+		switch {
+		case !end.After(start):
+			problems = append(problems, "endDate must be after startDate")
+		case !end.After(now):
+			problems = append(problems, "endDate must be in the future")
+		case maxDuration > 0 && end.Sub(start) > maxDuration:
+			problems = append(problems, fmt.Sprintf("the promotion may run for at most %d days", int(maxDuration.Hours()/24)))
+		}
+	}
+	return problems
+}
+
+// validate checks how the promotion's items are selected.
+func (c *inventoryCriterion) validate(field string) []string {
+	var problems []string
+	switch c.InventoryCriterionType {
+	case "INVENTORY_BY_VALUE":
+		switch n := len(c.ListingIDs) + len(c.InventoryItems); {
+		case len(c.ListingIDs) > 0 && len(c.InventoryItems) > 0:
+			problems = append(problems, field+": list listingIds or inventoryItems, not both")
+		case n == 0:
+			problems = append(problems, field+": INVENTORY_BY_VALUE needs listingIds or inventoryItems")
+		case n > maxPromotionListings:
+			problems = append(problems, fmt.Sprintf("%s: at most %d listings or items per promotion", field, maxPromotionListings))
+		}
+	case "INVENTORY_BY_RULE":
+		if len(c.RuleCriteria) == 0 || string(c.RuleCriteria) == "null" {
+			problems = append(problems, field+": INVENTORY_BY_RULE needs ruleCriteria")
+		}
+	case "INVENTORY_ANY":
+	default:
+		problems = append(problems, field+".inventoryCriterionType must be one of "+strings.Join(criterionTypes, ", "))
+	}
+	return problems
+}
+
+// checkPercent checks a percentage given as a string, as eBay takes them.
+func checkPercent(field, value string, min, max float64) []string {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < min || n > max {
+		return []string{fmt.Sprintf("%s must be a percentage from %g to %g", field, min, max)}
+	}
+	return nil
+}
+
+func checkAmount(field string, a *promotionAmount) []string {
+	n, err := strconv.ParseFloat(a.Value, 64)
+	if err != nil || n <= 0 {
+		return []string{field + ".value must be a positive amount"}
+	}
+	if a.Currency == "" {
+		return []string{field + ".currency is required"}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,626 @@
+package ebaymcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/ebay"
+)
+
+// ### Purchases ##############################################################
+
+// Bidding on auctions (Buy Offer API) and guest checkout (Buy Order API)
+// spend the buyer's money, so an assistant can't do either in one call. The
+// preparePurchase tool (POST /purchases/prepare) looks the item up, prices
+// the purchase and checks it against the policy's spend limits, and returns
+// a summary with a single-use confirmation token; nothing is bought. Only
+// confirmPurchase (POST /purchases/confirm) with that token, from the same
+// account and before it expires, places the bid or the order:
+//
+//	{"type": "bid", "item_id": "v1|110012345678|0",
+//	 "max_amount": {"value": "25.00", "currency": "USD"}}
+//	{"type": "checkout", "item_id": "v1|110012345678|0", "quantity": 1,
+//	 "contact_email": "...", "shipping_address": {...}}
+//
+// /proxy refuses the calls that commit a purchase, so the tools are the only
+// way to make one. Purchases are off unless the policy's purchases section
+// enables them.
+
+const (
+	purchasePreparePath    = "/purchases/prepare"
+	purchaseConfirmPath    = "/purchases/confirm"
+	defaultConfirmationTTL = 10 * time.Minute
+	maxConfirmationTTL     = time.Hour
+	purchaseSpendTTL       = 48 * time.Hour
+)
+
+// PurchasePolicy enables the purchase tools and limits what each account
+// may spend, in Currency; purchases in other currencies are refused.
+type PurchasePolicy struct {
+	Enabled         bool          `yaml:"enabled,omitempty"`
+	Currency        string        `yaml:"currency,omitempty"`
+	ConfirmationTTL time.Duration `yaml:"confirmation_ttl,omitempty"`
+	Default         SpendLimit    `yaml:",inline"`
+	Users           []SpendLimit  `yaml:"users,omitempty"`
+}
+
+// SpendLimit caps a single purchase and the purchases of a UTC day. Users
+// entries name an eBay user ID or username, or a vault: reference, and
+// inherit the limits they leave unset. Bids count at their maximum amount.
+type SpendLimit struct {
+	User        string  `yaml:"user,omitempty"`
+	PerPurchase float64 `yaml:"per_purchase,omitempty"`
+	PerDay      float64 `yaml:"per_day,omitempty"`
+}
+
+// validate checks the section.
+func (p *PurchasePolicy) validate() []string {
+	var problems []string
+	if p.Default.User != "" {
+		problems = append(problems, "purchases: user only belongs in users")
+	}
+	if p.Enabled {
+		if len(p.Currency) != 3 || strings.ToUpper(p.Currency) != p.Currency {
+			problems = append(problems, "purchases: currency must be an ISO 4217 code such as USD")
+		}
+		if p.Default.PerPurchase <= 0 || p.Default.PerDay <= 0 {
+			problems = append(problems, "purchases: per_purchase and per_day are required when purchases are enabled")
+		}
+	}
+	if p.ConfirmationTTL != 0 && (p.ConfirmationTTL < time.Minute || p.ConfirmationTTL > maxConfirmationTTL) {
+		problems = append(problems, fmt.Sprintf("purchases: confirmation_ttl must be from 1m to %s", maxConfirmationTTL))
+	}
+	problems = append(problems, p.Default.validate("purchases")...)
+	seen := make(map[string]bool)
+	for i, u := range p.Users {
+		field := fmt.Sprintf("purchases.users[%d]", i)
+		if u.User == "" {
+			problems = append(problems, field+": user is required")
+		} else if seen[u.User] {
+			problems = append(problems, fmt.Sprintf("%s: duplicate user %q", field, u.User))
+		}
+		seen[u.User] = true
+		problems = append(problems, u.validate(field)...)
+	}
+	return problems
+}
+
+func (l SpendLimit) validate(field string) []string {
+	if l.PerPurchase < 0 || l.PerDay < 0 {
+		return []string{field + ": per_purchase and per_day must not be negative"}
+	}
+	return nil
+}
+
+// limitFor returns the limits of the caller's account.
+func (p *PurchasePolicy) limitFor(c *ebayCaller) SpendLimit {
+	limit := p.Default
+	for _, u := range p.Users {
+		if u.User != c.bearer && (c.user == nil || (u.User != c.user.UserID && u.User != c.user.Username)) {
+			continue
+		}
+		if u.PerPurchase != 0 {
+			limit.PerPurchase = u.PerPurchase
+		}
+		if u.PerDay != 0 {
+			limit.PerDay = u.PerDay
+		}
+	}
+	return limit
+}
+
+func (p *PurchasePolicy) confirmationTTL() time.Duration {
+	if p.ConfirmationTTL == 0 {
+		return defaultConfirmationTTL
+	}
+	return p.ConfirmationTTL
+}
+
+// purchaseAccount is what spend is counted against: the eBay account when
+// it is known, so that its vault entries share a budget, else the token.
+func purchaseAccount(c *ebayCaller) string {
+	if c.user != nil && c.user.UserID != "" {
+		return "user:" + c.user.UserID
+	}
+	return "token:" + tokenHash(c.bearer)
+}
+
+// purchaseRequest is the body of preparePurchase.
+type purchaseRequest struct {
+	Type             string        `json:"type"`    // bid or checkout
+	ItemID           string        `json:"item_id"` // RESTful or legacy item ID
+	MaxAmount        *ebay.Amount  `json:"max_amount"`
+	AdultOnlyConsent bool          `json:"adult_only_consent"`
+	Quantity         int           `json:"quantity"` // default 1
+	ContactEmail     string        `json:"contact_email"`
+	ContactFirstName string        `json:"contact_first_name"`
+	ContactLastName  string        `json:"contact_last_name"`
+	ShippingAddress  *ebay.Address `json:"shipping_address"`
+}
+
+// validate checks req and fills in its defaults.
+func (req *purchaseRequest) validate(marketplace string) error {
+	if req.ItemID == "" {
+		return errors.New("item_id is required")
+	}
+	switch req.Type {
+	case "bid":
+		if req.MaxAmount == nil || req.MaxAmount.Value == "" {
+			return errors.New("max_amount is required for a bid")
+		}
+		if req.MaxAmount.Currency == "" {
+			req.MaxAmount.Currency = marketplaceCurrencies[marketplace]
+		}
+		if _, err := parseCents(req.MaxAmount.Value); err != nil {
+			return fmt.Errorf("max_amount: %v", err)
+		}
+	case "checkout":
+		if req.Quantity == 0 {
+			req.Quantity = 1
+		}
+		if req.Quantity < 0 {
+			return errors.New("quantity must be positive")
+		}
+		if !strings.Contains(req.ContactEmail, "@") {
+			return errors.New("contact_email is required for a checkout")
+		}
+		a := req.ShippingAddress
+		if a == nil || a.Recipient == "" || a.AddressLine1 == "" || a.City == "" || a.PostalCode == "" || a.Country == "" {
+			return errors.New("shipping_address needs recipient, addressLine1, city, postalCode and country")
+		}
+	default:
+		return errors.New("type must be bid or checkout")
+	}
+	return nil
+}
+
+// pendingPurchase is a prepared purchase, kept under its confirmation
+// token until confirmPurchase or expiry.
+type pendingPurchase struct {
+	Type              string      `json:"type"`
+	Account           string      `json:"account"`
+	Environment       string      `json:"environment"`
+	Marketplace       string      `json:"marketplace"`
+	ItemID            string      `json:"item_id"`
+	Title             string      `json:"title"`
+	Amount            ebay.Amount `json:"amount"`
+	Quantity          int         `json:"quantity,omitempty"`
+	AdultOnlyConsent  bool        `json:"adult_only_consent,omitempty"`
+	CheckoutSessionID string      `json:"checkout_session_id,omitempty"`
+	ExpiresAt         time.Time   `json:"expires_at"`
+}
+
+// commitPath is the eBay call that makes the purchase.
+func (p *pendingPurchase) commitPath() string {
+	if p.Type == "bid" {
+		return "/buy/offer/v1_beta/bidding/" + p.ItemID + "/place_proxy_bid"
+	}
+	return "/buy/order/v2/guest_checkout_session/" + p.CheckoutSessionID + "/place_order"
+}
+
+// isPurchaseCommit reports whether a proxied call would commit a purchase,
+// which only confirmPurchase may do.
+func isPurchaseCommit(method, path string) bool {
+	return method == http.MethodPost &&
+		(strings.HasPrefix(path, "/buy/offer/") && strings.HasSuffix(path, "/place_proxy_bid") ||
+			strings.HasPrefix(path, "/buy/order/") && strings.HasSuffix(path, "/place_order"))
+}
+
+// handlePurchasePrepare (preparePurchase) prices a purchase and returns the
+// token that confirms it.
+// POST /purchases/prepare
+func handlePurchasePrepare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req purchaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Body must be JSON", http.StatusBadRequest)
+		return
+	}
+	policy := currentPolicy()
+	if !policy.Purchases.Enabled {
+		http.Error(w, "Purchases are disabled by the policy (purchases.enabled)", http.StatusForbidden)
+		return
+	}
+	if err := policy.AllowPath(http.MethodGet, "/buy/browse/v1/item/"); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	caller, status, err := resolveCaller(w, r)
+	if err != nil {
+		log.Printf("Failed to resolve token for purchase: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	client := caller.client()
+	marketplace := client.Marketplace
+	if marketplace == "" {
+		marketplace = defaultMarketplace
+	}
+	if err := req.validate(marketplace); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+
+	var item *ebay.Item
+	if strings.Contains(req.ItemID, "|") {
+		item, err = client.GetItem(ctx, req.ItemID)
+	} else {
+		item, err = client.GetItemByLegacyID(ctx, req.ItemID)
+	}
+	if err != nil {
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	pending := &pendingPurchase{
+		Type:        req.Type,
+		Account:     purchaseAccount(caller),
+		Environment: caller.env.Name,
+		Marketplace: marketplace,
+		ItemID:      item.ItemID,
+		Title:       item.Title,
+	}
+	resp := map[string]interface{}{"type": req.Type, "item": item.ItemSummary}
+	var summary string
+	switch req.Type {
+	case "bid":
+		if !hasBuyingOption(item.BuyingOptions, "AUCTION") {
+			http.Error(w, "The item is not an auction", http.StatusUnprocessableEntity)
+			return
+		}
+		if item.AdultOnly && !req.AdultOnlyConsent {
+			http.Error(w, "The item is adult-only: bidding needs adult_only_consent", http.StatusBadRequest)
+			return
+		}
+		pending.Amount = *req.MaxAmount
+		pending.AdultOnlyConsent = req.AdultOnlyConsent
+		summary = fmt.Sprintf("Bid up to %s %s on %q (%s)", pending.Amount.Value, pending.Amount.Currency, item.Title, item.ItemID)
+	case "checkout":
+		if !hasBuyingOption(item.BuyingOptions, "FIXED_PRICE") || !item.EnabledForGuestCheckout {
+			http.Error(w, "The item is not eligible for guest checkout", http.StatusUnprocessableEntity)
+			return
+		}
+		if err := policy.AllowPath(http.MethodPost, "/buy/order/v2/guest_checkout_session/initiate"); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		session, err := client.InitiateGuestCheckoutSession(ctx, &ebay.GuestCheckout{
+			ContactEmail:     req.ContactEmail,
+			ContactFirstName: req.ContactFirstName,
+			ContactLastName:  req.ContactLastName,
+			LineItemInputs:   []ebay.LineItemInput{{ItemID: item.ItemID, Quantity: req.Quantity}},
+			ShippingAddress:  *req.ShippingAddress,
+		})
+		if err != nil {
+			writeEbayError(w, r, caller, err)
+			return
+		}
+		pending.Amount = session.PricingSummary.Total
+		pending.Quantity = req.Quantity
+		pending.CheckoutSessionID = session.CheckoutSessionID
+		resp["pricing_summary"] = session.PricingSummary
+		if len(session.Warnings) > 0 {
+			resp["warnings"] = session.Warnings
+		}
+		summary = fmt.Sprintf("Buy %d × %q (%s) for %s %s in total, shipped to %s, %s",
+			req.Quantity, item.Title, item.ItemID, pending.Amount.Value, pending.Amount.Currency,
+			req.ShippingAddress.Recipient, req.ShippingAddress.City)
+	}
+	if err := policy.AllowPath(http.MethodPost, pending.commitPath()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	limit := policy.Purchases.limitFor(caller)
+	spent, err := checkSpend(ctx, &policy.Purchases, limit, pending)
+	if err != nil {
+		writeSpendLimit(w, err, limit, policy.Purchases.Currency, spent)
+		return
+	}
+
+	token, err := randomID(24)
+	if err != nil {
+		http.Error(w, "Failed to create a confirmation token", http.StatusInternalServerError)
+		return
+	}
+	ttl := policy.Purchases.confirmationTTL()
+	pending.ExpiresAt = time.Now().Add(ttl).UTC()
+	data, _ := json.Marshal(pending)
+	purchaseCache.Set(ctx, "pending", token, data, ttl)
+	audit.Record("purchase.prepared", map[string]string{
+		"type":       pending.Type,
+		"item_id":    pending.ItemID,
+		"amount":     pending.Amount.Value + " " + pending.Amount.Currency,
+		"account":    pending.Account,
+		"token_hash": tokenHash(caller.bearer),
+	})
+
+	resp["confirmation_token"] = token
+	resp["expires_at"] = pending.ExpiresAt.Format(time.RFC3339)
+	resp["amount"] = pending.Amount
+	resp["summary"] = summary
+	resp["spent_today"] = formatCents(spent)
+	resp["limits"] = map[string]interface{}{"currency": policy.Purchases.Currency, "per_purchase": limit.PerPurchase, "per_day": limit.PerDay}
+	resp["next"] = "Nothing has been bought. Show the summary to the user and call confirmPurchase with the confirmation_token only after they explicitly agree."
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handlePurchaseConfirm (confirmPurchase) makes a prepared purchase.
+// POST /purchases/confirm
+func handlePurchaseConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ConfirmationToken string `json:"confirmation_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ConfirmationToken == "" {
+		http.Error(w, "Body must be JSON with a confirmation_token", http.StatusBadRequest)
+		return
+	}
+	policy := currentPolicy()
+	if !policy.Purchases.Enabled {
+		http.Error(w, "Purchases are disabled by the policy (purchases.enabled)", http.StatusForbidden)
+		return
+	}
+	caller, status, err := resolveCaller(w, r)
+	if err != nil {
+		log.Printf("Failed to resolve token for purchase: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	ctx := r.Context()
+
+	data, ok := purchaseCache.Get(ctx, "pending", req.ConfirmationToken)
+	var pending pendingPurchase
+	if !ok || json.Unmarshal(data, &pending) != nil || time.Now().After(pending.ExpiresAt) {
+		http.Error(w, "Unknown or expired confirmation token: call preparePurchase again", http.StatusNotFound)
+		return
+	}
+	if pending.Account != purchaseAccount(caller) || pending.Environment != caller.env.Name {
+		http.Error(w, "The confirmation token was issued to another account", http.StatusForbidden)
+		return
+	}
+	claimed, err := purchaseCache.Claim(ctx, "confirmed", req.ConfirmationToken, policy.Purchases.confirmationTTL())
+	if err != nil {
+		http.Error(w, "Can't confirm purchases right now", http.StatusServiceUnavailable)
+		return
+	}
+	if !claimed {
+		http.Error(w, "The confirmation token has already been used", http.StatusConflict)
+		return
+	}
+	purchaseCache.Delete(ctx, "pending", req.ConfirmationToken)
+	if err := policy.AllowPath(http.MethodPost, pending.commitPath()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// The limits may have changed, and other purchases been made, since
+	// the purchase was prepared: reserve the amount before spending it.
+	limit := policy.Purchases.limitFor(caller)
+	spent, err := reserveSpend(ctx, &policy.Purchases, limit, &pending)
+	if err != nil {
+		writeSpendLimit(w, err, limit, policy.Purchases.Currency, spent)
+		return
+	}
+
+	client := caller.client().WithMarketplace(pending.Marketplace)
+	resp := map[string]interface{}{"type": pending.Type, "item_id": pending.ItemID, "amount": pending.Amount}
+	fields := map[string]string{
+		"item_id":    pending.ItemID,
+		"amount":     pending.Amount.Value + " " + pending.Amount.Currency,
+		"account":    pending.Account,
+		"token_hash": tokenHash(caller.bearer),
+	}
+	event := "purchase.bid"
+	if pending.Type == "bid" {
+		bid := &ebay.ProxyBid{MaxAmount: pending.Amount}
+		bid.UserConsent.AdultOnlyItem = pending.AdultOnlyConsent
+		var bidID string
+		if bidID, err = client.PlaceProxyBid(ctx, pending.ItemID, bid); err == nil {
+			resp["proxy_bid_id"] = bidID
+			fields["proxy_bid_id"] = bidID
+		}
+	} else {
+		event = "purchase.order"
+		var order *ebay.PurchaseOrder
+		if order, err = client.PlaceGuestOrder(ctx, pending.CheckoutSessionID); err == nil {
+			resp["purchase_order_id"] = order.PurchaseOrderID
+			resp["purchase_order_payment_status"] = order.PurchaseOrderPaymentStatus
+			if len(order.Warnings) > 0 {
+				resp["warnings"] = order.Warnings
+			}
+			fields["purchase_order_id"] = order.PurchaseOrderID
+		}
+	}
+	if err != nil {
+		releaseSpend(context.WithoutCancel(ctx), &pending)
+		log.Printf("Purchase of %s failed: %v", pending.ItemID, err)
+		fields["error"] = err.Error()
+		audit.Record(event+".failed", fields)
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	audit.Record(event, fields)
+	caller.wrote(ctx)
+	resp["spent_today"] = formatCents(spent)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func hasBuyingOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// ### Spend Limits ###
+
+// Spend is counted per account, UTC day and currency, as cents, by the
+// spend ledger: the backend's database when BACKEND_URL is set, so every
+// replica counts against the same totals and a restart forgets nothing;
+// otherwise a map in the process that never evicts, so each replica
+// enforces the limits on its own and a restart resets them. When the
+// ledger can't be read, purchases are refused.
+type spendLedger interface {
+	// Spent returns what account spent on day in currency.
+	Spent(ctx context.Context, account, day, currency string) (int64, error)
+	// RecordSpend adds amount unless the total would exceed limit, or
+	// takes -amount back when amount is negative, returning the total and
+	// whether the amount was added.
+	RecordSpend(ctx context.Context, account, day, currency string, amount, limit int64) (int64, bool, error)
+}
+
+// localSpend is the ledger without a backend.
+var localSpend = &memorySpendLedger{spent: make(map[string]int64)}
+
+// currentSpendLedger returns the ledger spend limits are counted in.
+func currentSpendLedger() spendLedger {
+	if backend != nil {
+		return backend
+	}
+	return localSpend
+}
+
+// memorySpendLedger keeps the totals of the last few days in the process.
+type memorySpendLedger struct {
+	mu    sync.Mutex
+	spent map[string]int64 // by account, day and currency
+}
+
+func (l *memorySpendLedger) Spent(_ context.Context, account, day, currency string) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.spent[account+"\n"+day+"\n"+currency], nil
+}
+
+func (l *memorySpendLedger) RecordSpend(_ context.Context, account, day, currency string, amount, limit int64) (int64, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := account + "\n" + day + "\n" + currency
+	spent := l.spent[key]
+	if amount >= 0 && spent+amount > limit {
+		return spent, false, nil
+	}
+	spent = max(spent+amount, 0)
+	l.spent[key] = spent
+
+	// Days before yesterday no longer count
+	cutoff := time.Now().UTC().Add(-purchaseSpendTTL).Format("2006-01-02")
+	for k := range l.spent {
+		if parts := strings.Split(k, "\n"); len(parts) == 3 && parts[1] < cutoff {
+			delete(l.spent, k)
+		}
+	}
+	return spent, true, nil
+}
+
+var errSpendLimit = errors.New("spend limit exceeded")
+
+// checkSpend returns what the purchase's account spent today and an error
+// wrapping errSpendLimit if the purchase would break a limit, or another
+// error if the ledger can't be read.
+func checkSpend(ctx context.Context, p *PurchasePolicy, limit SpendLimit, pending *pendingPurchase) (int64, error) {
+	amount, err := parseCents(pending.Amount.Value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: unreadable amount %q", errSpendLimit, pending.Amount.Value)
+	}
+	if pending.Amount.Currency != p.Currency {
+		return 0, fmt.Errorf("%w: the purchase is in %s, but spend limits are in %s", errSpendLimit, pending.Amount.Currency, p.Currency)
+	}
+	spent, err := currentSpendLedger().Spent(ctx, pending.Account, spendDay(), p.Currency)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read today's spending: %w", err)
+	}
+	if amount > toCents(limit.PerPurchase) {
+		return spent, fmt.Errorf("%w: %s %s is above the per-purchase limit of %s", errSpendLimit, formatCents(amount), p.Currency, formatCents(toCents(limit.PerPurchase)))
+	}
+	if spent+amount > toCents(limit.PerDay) {
+		return spent, dailyLimitError(amount, spent, limit, p.Currency)
+	}
+	return spent, nil
+}
+
+// reserveSpend checks the purchase and counts it as spent, returning the
+// new total for the day. The ledger checks the daily limit again as it
+// adds the amount, so concurrent purchases can't both pass it.
+func reserveSpend(ctx context.Context, p *PurchasePolicy, limit SpendLimit, pending *pendingPurchase) (int64, error) {
+	if spent, err := checkSpend(ctx, p, limit, pending); err != nil {
+		return spent, err
+	}
+	amount, _ := parseCents(pending.Amount.Value)
+	spent, reserved, err := currentSpendLedger().RecordSpend(ctx, pending.Account, spendDay(), p.Currency, amount, toCents(limit.PerDay))
+	if err != nil {
+		return 0, fmt.Errorf("failed to record the purchase's spending: %w", err)
+	}
+	if !reserved {
+		return spent, dailyLimitError(amount, spent, limit, p.Currency)
+	}
+	return spent, nil
+}
+
+// releaseSpend takes back a reservation whose purchase failed.
+func releaseSpend(ctx context.Context, pending *pendingPurchase) {
+	amount, _ := parseCents(pending.Amount.Value)
+	if _, _, err := currentSpendLedger().RecordSpend(ctx, pending.Account, spendDay(), pending.Amount.Currency, -amount, 0); err != nil {
+		log.Printf("Failed to release the spending of a failed purchase of %s: %v", pending.ItemID, err)
+	}
+}
+
+func dailyLimitError(amount, spent int64, limit SpendLimit, currency string) error {
+	return fmt.Errorf("%w: %s %s would bring today's spending to %s, above the daily limit of %s", errSpendLimit,
+		formatCents(amount), currency, formatCents(spent+amount), formatCents(toCents(limit.PerDay)))
+}
+
+func spendDay() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+// writeSpendLimit answers a purchase refused by checkSpend or reserveSpend.
+func writeSpendLimit(w http.ResponseWriter, err error, limit SpendLimit, currency string, spent int64) {
+	if !errors.Is(err, errSpendLimit) {
+		log.Printf("Refusing purchase: %v", err)
+		http.Error(w, "Can't check the spend limits right now", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusForbidden, map[string]interface{}{
+		"error":       "spend_limit_exceeded",
+		"message":     strings.TrimPrefix(err.Error(), errSpendLimit.Error()+": "),
+		"spent_today": formatCents(spent),
+		"limits":      map[string]interface{}{"currency": currency, "per_purchase": limit.PerPurchase, "per_day": limit.PerDay},
+	})
+}
+
+// parseCents parses a non-negative decimal amount such as "12.50".
+func parseCents(value string) (int64, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("%q is not an amount", value)
+	}
+	return toCents(v), nil
+}
+
+func toCents(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
+
+func formatCents(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
@@ -0,0 +1,287 @@
+package ebaymcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ### Push Buffering #########################################################
+
+// Messages pushed to clients (the server-sent event stream of eBay
+// notifications, MCP progress notifications) go through a bounded
+// per-connection pushQueue, so a slow client can't make the proxy buffer
+// without limit. When a queue holds PUSH_BUFFER_SIZE messages (default 256),
+// PUSH_OVERFLOW_POLICY decides what happens to the next one:
+//
+//	drop-oldest  discard the oldest droppable message (default)
+//	drop-newest  discard the new message
+//	disconnect   close the connection; the client reconnects and catches up
+//
+// Messages that must arrive (MCP responses) are never dropped. Clients that
+// stop reading altogether are disconnected after PUSH_WRITE_TIMEOUT
+// (default 10s).
+
+// overflowPolicy says what a full pushQueue does with a new message.
+type overflowPolicy string
+
+const (
+	overflowDropOldest overflowPolicy = "drop-oldest"
+	overflowDropNewest overflowPolicy = "drop-newest"
+	overflowDisconnect overflowPolicy = "disconnect"
+)
+
+const (
+	defaultPushBufferSize   = 256
+	defaultPushWriteTimeout = 10 * time.Second
+	sseHeartbeatInterval    = 15 * time.Second
+)
+
+var (
+	pushBufferSize   = defaultPushBufferSize
+	pushOverflow     = overflowDropOldest
+	pushWriteTimeout = defaultPushWriteTimeout
+)
+
+// errPushOverflow closes a queue whose client fell too far behind under the
+// disconnect policy.
+var errPushOverflow = errors.New("client is not keeping up with pushed messages")
+
+// pushSettingsFromEnv reads PUSH_BUFFER_SIZE, PUSH_OVERFLOW_POLICY and
+// PUSH_WRITE_TIMEOUT.
+func pushSettingsFromEnv() error {
+	if v := os.Getenv("PUSH_BUFFER_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid PUSH_BUFFER_SIZE %q", v)
+		}
+		pushBufferSize = n
+	}
+	if v := os.Getenv("PUSH_OVERFLOW_POLICY"); v != "" {
+		switch p := overflowPolicy(v); p {
+		case overflowDropOldest, overflowDropNewest, overflowDisconnect:
+			pushOverflow = p
+		default:
+			return fmt.Errorf("invalid PUSH_OVERFLOW_POLICY %q (expected drop-oldest, drop-newest or disconnect)", v)
+		}
+	}
+	if v := os.Getenv("PUSH_WRITE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid PUSH_WRITE_TIMEOUT %q", v)
+		}
+		pushWriteTimeout = d
+	}
+	return nil
+}
+
+type pushMessage struct {
+	data      []byte
+	droppable bool
+}
+
+// pushQueue buffers the messages of one connection between the producers
+// and the goroutine writing to the client.
+type pushQueue struct {
+	limit  int
+	policy overflowPolicy
+
+	mu      sync.Mutex
+	items   []pushMessage
+	dropped int
+	err     error         // set once closed
+	ready   chan struct{} // signalled when items or err change
+}
+
+func newPushQueue(limit int, policy overflowPolicy) *pushQueue {
+	return &pushQueue{limit: limit, policy: policy, ready: make(chan struct{}, 1)}
+}
+
+// Push queues data, applying the overflow policy when the queue is full.
+// Messages that aren't droppable are always queued. It returns the queue's
+// error once it is closed.
+func (q *pushQueue) Push(data []byte, droppable bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err != nil {
+		return q.err
+	}
+
+	if len(q.items) >= q.limit && droppable {
+		switch q.policy {
+		case overflowDisconnect:
+			q.close(errPushOverflow)
+			return q.err
+		case overflowDropNewest:
+			q.dropped++
+			return nil
+		default:
+			if !q.dropOldest() {
+				q.dropped++
+				return nil
+			}
+		}
+	}
+	q.items = append(q.items, pushMessage{data: data, droppable: droppable})
+	q.signal()
+	return nil
+}
+
+// dropOldest discards the oldest droppable message. Callers must hold q.mu.
+func (q *pushQueue) dropOldest() bool {
+	for i, item := range q.items {
+		if item.droppable {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			q.dropped++
+			return true
+		}
+	}
+	return false
+}
+
+// Next waits for the next message. It returns io.EOF once the queue was
+// closed with Close(nil) and drained, and the close error right away
+// otherwise.
+func (q *pushQueue) Next(ctx context.Context) ([]byte, error) {
+	for {
+		q.mu.Lock()
+		if q.err != nil && (q.err != io.EOF || len(q.items) == 0) {
+			err := q.err
+			q.mu.Unlock()
+			return nil, err
+		}
+		if len(q.items) > 0 {
+			item := q.items[0]
+			q.items[0] = pushMessage{}
+			q.items = q.items[1:]
+			q.mu.Unlock()
+			return item.data, nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// TakeDropped returns how many messages were dropped since the last call.
+func (q *pushQueue) TakeDropped() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := q.dropped
+	q.dropped = 0
+	return n
+}
+
+// Close stops the queue. With a nil err the remaining messages can still be
+// read; otherwise they are discarded.
+func (q *pushQueue) Close(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err == nil {
+		if err == nil {
+			err = io.EOF
+		}
+		q.close(err)
+	}
+}
+
+// close records err and wakes the reader. Callers must hold q.mu.
+func (q *pushQueue) close(err error) {
+	q.err = err
+	if err != io.EOF {
+		q.items = nil
+	}
+	q.signal()
+}
+
+// signal wakes a waiting Next. Callers must hold q.mu.
+func (q *pushQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// ### Notification Stream ###
+
+// handleNotificationStream streams verified eBay notifications as
+// server-sent events: "event: <topic>", "id: <notification ID>" and the
+// stored notification as data. Dropped notifications are announced with a
+// "dropped" event carrying their count.
+// GET /admin/notifications/stream
+func handleNotificationStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	queue := newPushQueue(pushBufferSize, pushOverflow)
+	unsubscribe := notifications.Subscribe(func(n receivedNotification) {
+		data, err := json.Marshal(n)
+		if err != nil {
+			return
+		}
+		event := fmt.Sprintf("event: %s\nid: %s\ndata: %s\n\n", n.Topic, n.NotificationID, data)
+		queue.Push([]byte(event), true)
+	})
+	defer unsubscribe()
+	defer queue.Close(nil)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	rc := http.NewResponseController(w)
+	write := func(data []byte) error {
+		rc.SetWriteDeadline(time.Now().Add(pushWriteTimeout))
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	ctx := r.Context()
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, sseHeartbeatInterval)
+		data, err := queue.Next(waitCtx)
+		cancel()
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			return // the client went away
+		case errors.Is(err, context.DeadlineExceeded):
+			data = []byte(": heartbeat\n\n")
+		default:
+			log.Printf("Closing notification stream: %v", err)
+			write([]byte("event: overflow\ndata: {}\n\n"))
+			return
+		}
+		if dropped := queue.TakeDropped(); dropped > 0 {
+			log.Printf("Notification stream dropped %d notifications for a slow client", dropped)
+			data = append([]byte(fmt.Sprintf("event: dropped\ndata: {\"count\":%d}\n\n", dropped)), data...)
+		}
+		if err := write(data); err != nil {
+			log.Printf("Closing notification stream: %v", err)
+			return
+		}
+	}
+}
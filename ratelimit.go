@@ -0,0 +1,307 @@
+package ebaymcp
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/store"
+)
+
+// ### Rate Limiting ##########################################################
+
+// rateLimiter enforces policy.rate_limits per access token with a token
+// bucket: RequestsPerMinute refill rate and Burst capacity. A nil limiter
+// means unlimited. With a Redis cache the buckets live in Redis, so the
+// limit holds across replicas; while Redis fails, each process falls back
+// to its own buckets.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*rateBucket
+	lastGC  time.Time
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitState is a client's limiter state after a request.
+type rateLimitState struct {
+	Limit     int
+	Remaining int
+	Reset     time.Duration // until the bucket is full again
+	Allowed   bool
+	RetryIn   time.Duration // until the next request is allowed, when denied
+}
+
+// limiter is built from the policy, and replaced when a reload changes its
+// rate limits; nil means unlimited.
+var limiter atomic.Pointer[rateLimiter]
+
+// newRateLimiter returns nil when p doesn't limit anything. Burst defaults
+// to the per-minute rate.
+func newRateLimiter(p RateLimitPolicy) *rateLimiter {
+	if p.RequestsPerMinute == 0 {
+		return nil
+	}
+	burst := p.Burst
+	if burst == 0 {
+		burst = p.RequestsPerMinute
+	}
+	return &rateLimiter{
+		rate:    float64(p.RequestsPerMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*rateBucket),
+	}
+}
+
+// Allow takes one token from key's bucket if available.
+func (l *rateLimiter) Allow(ctx context.Context, key string, now time.Time) rateLimitState {
+	if shared, ok := cache.(store.Buckets); ok {
+		tokens, allowed, err := shared.TakeToken(ctx, cacheKeyPrefix+"ratelimit:"+key, l.rate, l.burst, now)
+		if err == nil {
+			return l.state(tokens, allowed)
+		}
+		log.Printf("Shared rate limit failed, using this replica's: %v", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.collectGarbage(now)
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &rateBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return l.state(b.tokens, allowed)
+}
+
+// state describes a bucket left with tokens after a request.
+func (l *rateLimiter) state(tokens float64, allowed bool) rateLimitState {
+	state := rateLimitState{Limit: int(l.burst), Allowed: allowed}
+	if !allowed {
+		state.RetryIn = l.secondsFor(1 - tokens)
+	}
+	state.Remaining = int(tokens)
+	state.Reset = l.secondsFor(l.burst - tokens)
+	return state
+}
+
+// secondsFor returns how long it takes to refill n tokens.
+func (l *rateLimiter) secondsFor(n float64) time.Duration {
+	return time.Duration(n / l.rate * float64(time.Second))
+}
+
+// collectGarbage drops buckets that have refilled completely; they are
+// indistinguishable from new ones. Callers must hold l.mu.
+func (l *rateLimiter) collectGarbage(now time.Time) {
+	if now.Sub(l.lastGC) < time.Minute {
+		return
+	}
+	l.lastGC = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// takeRateLimit takes a request of bearer from the policy's rate limits,
+// for /proxy and the local tools alike. It returns nil when nothing is
+// limited.
+func takeRateLimit(ctx context.Context, bearer string) *rateLimitState {
+	l := limiter.Load()
+	if l == nil {
+		return nil
+	}
+	state := l.Allow(ctx, tokenHash(bearer), time.Now())
+	return &state
+}
+
+// setRateLimitHeaders writes our limiter state as X-RateLimit-* headers.
+// Reset is in seconds, rounded up.
+func setRateLimitHeaders(h http.Header, state rateLimitState) {
+	h.Set("X-RateLimit-Limit", strconv.Itoa(state.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(state.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(state.Reset.Seconds()))))
+	if !state.Allowed {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(state.RetryIn.Seconds()))))
+	}
+}
+
+// ### Concurrency ############################################################
+
+// A GPT can fire a burst of parallel tool calls; run all at once they trip
+// eBay's velocity limits and hold connections every other user needs.
+// rate_limits.max_in_flight caps the calls each access token has in
+// progress (per replica), through /proxy and the local tools. Calls over
+// the cap wait in a queue of rate_limits.queue for up to queue_timeout;
+// calls that find the queue full, or time out in it, get 429.
+
+const (
+	defaultQueueTimeout   = 10 * time.Second
+	concurrencyRetryAfter = "1"
+)
+
+// concurrencyLimiter holds a semaphore per access token while the token
+// has calls in progress or waiting.
+type concurrencyLimiter struct {
+	max     int
+	queue   int
+	timeout time.Duration
+
+	mu    sync.Mutex
+	slots map[string]*concurrencySlots
+}
+
+type concurrencySlots struct {
+	sem     chan struct{}
+	waiting int
+	users   int // calls holding or waiting for a slot
+}
+
+// inFlight is built from the policy like limiter; nil means unlimited.
+var inFlight atomic.Pointer[concurrencyLimiter]
+
+// errConcurrencyLimited is returned when a call gets no slot.
+var errConcurrencyLimited = errors.New("too many calls in progress")
+
+// newConcurrencyLimiter returns nil when p doesn't cap concurrency.
+func newConcurrencyLimiter(p RateLimitPolicy) *concurrencyLimiter {
+	if p.MaxInFlight == 0 {
+		return nil
+	}
+	l := &concurrencyLimiter{max: p.MaxInFlight, queue: p.Queue, timeout: p.QueueTimeout, slots: make(map[string]*concurrencySlots)}
+	if l.queue == 0 {
+		l.queue = p.MaxInFlight
+	}
+	if l.timeout == 0 {
+		l.timeout = defaultQueueTimeout
+	}
+	return l
+}
+
+// Acquire waits for one of key's slots and returns the function releasing
+// it, or errConcurrencyLimited.
+func (l *concurrencyLimiter) Acquire(ctx context.Context, key string) (func(), error) {
+	l.mu.Lock()
+	s := l.slots[key]
+	if s == nil {
+		s = &concurrencySlots{sem: make(chan struct{}, l.max)}
+		l.slots[key] = s
+	}
+	select {
+	case s.sem <- struct{}{}:
+		s.users++
+		l.mu.Unlock()
+		return l.releaser(key, s), nil
+	default:
+	}
+	if s.waiting >= l.queue {
+		l.mu.Unlock()
+		return nil, errConcurrencyLimited
+	}
+	s.waiting++
+	s.users++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case s.sem <- struct{}{}:
+	case <-timer.C:
+		err = errConcurrencyLimited
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	s.waiting--
+	if err != nil {
+		l.done(key, s)
+		l.mu.Unlock()
+		return nil, err
+	}
+	l.mu.Unlock()
+	return l.releaser(key, s), nil
+}
+
+func (l *concurrencyLimiter) releaser(key string, s *concurrencySlots) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-s.sem
+			l.mu.Lock()
+			l.done(key, s)
+			l.mu.Unlock()
+		})
+	}
+}
+
+// done drops a user of s, and s once it has none. Callers must hold l.mu.
+func (l *concurrencyLimiter) done(key string, s *concurrencySlots) {
+	if s.users--; s.users == 0 {
+		delete(l.slots, key)
+	}
+}
+
+// limitConcurrency applies max_in_flight to the requests that call eBay
+// as an access token: /proxy and the local tools.
+func limitConcurrency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := inFlight.Load()
+		parts := strings.Split(r.Header.Get("Authorization"), " ")
+		if l == nil || len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" || !callsEbay(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		release, err := l.Acquire(r.Context(), tokenHash(parts[1]))
+		if err != nil {
+			if errors.Is(err, errConcurrencyLimited) {
+				log.Printf("Rejected %s %s: too many calls in progress for the token", r.Method, r.URL.Path)
+				loc := localizerFor(r, "", "")
+				loc.setContentLanguage(w)
+				w.Header().Set("Retry-After", concurrencyRetryAfter)
+				http.Error(w, loc.T("concurrency.exceeded"), http.StatusTooManyRequests)
+			}
+			return // the client is gone
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// callsEbay reports whether requests to path are eBay calls made for the
+// caller: /proxy and the routes of local tools.
+func callsEbay(path string) bool {
+	if strings.HasPrefix(path, "/proxy/") {
+		return true
+	}
+	segments := splitPath(path)
+	for _, t := range toolRegistry {
+		if t.Local && matchTemplate(splitPath(t.Path), segments) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// ### Redaction ##############################################################
+
+// redactedValue replaces every masked value.
+const redactedValue = "[REDACTED]"
+
+// RedactionPolicy configures how bodies are masked before they are persisted
+// (logs, audit trails, captured fixtures). Paths use a small JSONPath subset:
+//
+//	$.buyer.username        exact path from the root
+//	$.lineItems[*].title    [*] matches every array element
+//	$..fullName             .. matches the key at any depth
+//
+// Patterns are regular expressions whose matches are masked anywhere in the
+// body, including non-JSON bodies.
+type RedactionPolicy struct {
+	DisableDefaults bool     `yaml:"disable_defaults,omitempty"`
+	Paths           []string `yaml:"paths,omitempty"`
+	Patterns        []string `yaml:"patterns,omitempty"`
+}
+
+// defaultRedactionPaths cover buyer PII in eBay order payloads
+// (sell/fulfillment getOrder(s)) and OAuth credentials in token responses.
+var defaultRedactionPaths = []string{
+	"$..buyer.username",
+	"$..buyerRegistrationAddress",
+	"$..shipTo",
+	"$..contactAddress",
+	"$..fullName",
+	"$..primaryPhone",
+	"$..email",
+	"$..taxAddress",
+	"$..access_token",
+	"$..refresh_token",
+}
+
+// defaultRedactionPatterns catch PII that appears in free text, such as eBay
+// error messages that echo back an address.
+var defaultRedactionPatterns = []string{
+	`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`, // email addresses
+	`\+\d[\d\s().\-]{7,}\d`,                            // international phone numbers
+	`\(\d{3}\)\s?\d{3}[\s.\-]\d{4}`,                    // (555) 123-4567
+}
+
+// redactor applies a compiled RedactionPolicy.
+type redactor struct {
+	paths    [][]pathStep
+	patterns []*regexp.Regexp
+}
+
+// pathStep is one component of a compiled redaction path.
+type pathStep struct {
+	key       string // object key, or "" for [*]
+	recursive bool   // matched at any depth (..key)
+}
+
+// bodyRedactor is the process-wide redactor built from the policy.
+var bodyRedactor atomic.Pointer[redactor]
+
+// defaultRedactor applies the default redactions until the policy is
+// loaded.
+var defaultRedactor = mustRedactor(RedactionPolicy{})
+
+// currentRedactor returns the redactor of the policy in effect.
+func currentRedactor() *redactor {
+	if r := bodyRedactor.Load(); r != nil {
+		return r
+	}
+	return defaultRedactor
+}
+
+// newRedactor compiles a redaction policy.
+func newRedactor(p RedactionPolicy) (*redactor, error) {
+	paths := p.Paths
+	patterns := p.Patterns
+	if !p.DisableDefaults {
+		paths = append(append([]string{}, defaultRedactionPaths...), paths...)
+		patterns = append(append([]string{}, defaultRedactionPatterns...), patterns...)
+	}
+
+	r := &redactor{}
+	for _, path := range paths {
+		steps, err := compileRedactionPath(path)
+		if err != nil {
+			return nil, err
+		}
+		r.paths = append(r.paths, steps)
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+func mustRedactor(p RedactionPolicy) *redactor {
+	r, err := newRedactor(p)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// compileRedactionPath parses "$.a..b[*].c" into steps.
+func compileRedactionPath(path string) ([]pathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("redaction path %q must start with $", path)
+	}
+	rest := strings.ReplaceAll(path[1:], "[*]", ".[*]")
+
+	var steps []pathStep
+	recursive := false
+	for i, part := range strings.Split(rest, ".") {
+		if part == "" {
+			// An empty segment after the first marks "..": the next key is recursive
+			if i > 0 {
+				recursive = true
+			}
+			continue
+		}
+		if part == "[*]" {
+			steps = append(steps, pathStep{})
+		} else {
+			steps = append(steps, pathStep{key: part, recursive: recursive})
+		}
+		recursive = false
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("redaction path %q selects nothing", path)
+	}
+	return steps, nil
+}
+
+// Redact masks sensitive values in body. JSON bodies have matching paths
+// replaced; the regex patterns are then applied to the (re-encoded) text.
+func (r *redactor) Redact(body []byte) []byte {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		var doc interface{}
+		if err := json.Unmarshal(trimmed, &doc); err == nil {
+			for _, steps := range r.paths {
+				doc = redactPath(doc, steps)
+			}
+			if out, err := json.Marshal(doc); err == nil {
+				body = out
+			}
+		}
+	}
+
+	for _, re := range r.patterns {
+		body = re.ReplaceAll(body, []byte(redactedValue))
+	}
+	return body
+}
+
+// RedactString is Redact for string bodies.
+func (r *redactor) RedactString(body string) string {
+	return string(r.Redact([]byte(body)))
+}
+
+// redactPath masks every value in node selected by steps.
+func redactPath(node interface{}, steps []pathStep) interface{} {
+	if len(steps) == 0 {
+		return redactedValue
+	}
+	step := steps[0]
+
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if step.key != "" && key == step.key {
+				v[key] = redactPath(child, steps[1:])
+			} else if step.recursive {
+				// Keep searching deeper for a recursive key
+				v[key] = redactPath(child, steps)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if step.key == "" {
+				v[i] = redactPath(child, steps[1:])
+			} else if step.recursive {
+				v[i] = redactPath(child, steps)
+			}
+		}
+	}
+	return node
+}
@@ -0,0 +1,245 @@
+package ebaymcp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// ### Callback URL Configuration #############################################
+
+// callbackPath is the path our /callback handler is mounted on. Every
+// APP_REDIRECT_URL must point at it.
+const callbackPath = "/callback"
+
+// appRedirectURLs are the proxy's own /callback URLs registered with eBay,
+// one per domain the proxy is served on. The first one is the default.
+var appRedirectURLs []*url.URL
+
+// parseRedirectURLs parses and validates the comma-separated APP_REDIRECT_URL
+// list against the optional APP_ALLOWED_DOMAINS allowlist.
+//
+// Each URL must use https (plain http is accepted only for localhost, for
+// development), point at /callback, and — when an allowlist is configured —
+// be on an allowed domain. Allowlist entries may be exact hosts
+// ("ebayai.dev") or wildcard subdomains ("*.example.com").
+func parseRedirectURLs(raw, allowedDomains string) ([]*url.URL, error) {
+	allowed := splitList(allowedDomains)
+
+	var urls []*url.URL
+	for _, s := range splitList(raw) {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("APP_REDIRECT_URL %q is not a valid URL: %w", s, err)
+		}
+
+		switch {
+		case u.Scheme == "https":
+		case u.Scheme == "http" && isLoopbackHost(u.Hostname()):
+		default:
+			return nil, fmt.Errorf("APP_REDIRECT_URL %q must use https", s)
+		}
+
+		if u.Host == "" || u.Path != mountPrefix+callbackPath || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("APP_REDIRECT_URL %q must be of the form https://<host>%s", s, mountPrefix+callbackPath)
+		}
+
+		if len(allowed) > 0 && !hostAllowed(u.Hostname(), allowed) {
+			return nil, fmt.Errorf("APP_REDIRECT_URL %q is not on an allowed domain (APP_ALLOWED_DOMAINS=%s)", s, allowedDomains)
+		}
+
+		urls = append(urls, u)
+	}
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("APP_REDIRECT_URL must contain at least one URL")
+	}
+	return urls, nil
+}
+
+// hostAllowed reports whether host matches one of the allowlist patterns.
+func hostAllowed(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if strings.HasPrefix(p, "*.") {
+			if strings.HasSuffix(host, p[1:]) && len(host) > len(p)-1 {
+				return true
+			}
+		} else if host == p {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoopbackHost reports whether host refers to the local machine.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// redirectURLFor returns the /callback URL on the domain the request came in
+// on, so a deployment serving several domains keeps each OAuth flow on a
+// single domain. It falls back to the first configured URL. Other tenants
+// use their redirect_url, or /callback under their own host or prefix.
+func redirectURLFor(r *http.Request) string {
+	if t := tenantFor(r); t != defaultTenant {
+		if t.RedirectURL != "" {
+			return t.RedirectURL
+		}
+		return externalBaseURL(r) + "/callback"
+	}
+	host, err := url.Parse(externalBaseURL(r))
+	if err == nil {
+		for _, u := range appRedirectURLs {
+			if strings.EqualFold(u.Host, host.Host) {
+				return u.String()
+			}
+		}
+	}
+	return appRedirectURLs[0].String()
+}
+
+// splitList splits a comma-separated environment value, dropping blanks.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// ### Client Redirect Allowlist ###
+
+// /callback sends the browser, with a fresh authorization code, to the
+// redirect_uri the client passed to /authorize. So that nobody can use the
+// proxy to bounce users (and codes) to a site of their choosing, /authorize
+// only accepts redirect_uris matching OAUTH_REDIRECT_ALLOWLIST: comma-
+// separated patterns of the form [scheme://]host[/path]. The scheme defaults
+// to https (http is only allowed for loopback hosts); host is exact or
+// "*.domain" for any subdomain; in the path, "*" matches one segment, or any
+// number of them as the last segment. Without a path any path matches.
+
+// defaultRedirectAllowlist covers ChatGPT GPT Actions and Claude's MCP
+// connectors.
+var defaultRedirectAllowlist = []string{
+	"https://chat.openai.com/aip/*/oauth/callback",
+	"https://chatgpt.com/aip/*/oauth/callback",
+	"https://claude.ai/api/mcp/auth_callback",
+	"https://claude.com/api/mcp/auth_callback",
+}
+
+// redirectPattern is one parsed allowlist entry.
+type redirectPattern struct {
+	scheme string
+	host   string
+	path   []string // nil for any path
+}
+
+// clientRedirects is the allowlist in effect, replaced on reload.
+var clientRedirects atomic.Pointer[[]redirectPattern]
+
+// currentRedirects returns the allowlist in effect.
+func currentRedirects() []redirectPattern {
+	if patterns := clientRedirects.Load(); patterns != nil {
+		return *patterns
+	}
+	return nil
+}
+
+// redirectAllowlistFromEnv parses OAUTH_REDIRECT_ALLOWLIST, or the default.
+func redirectAllowlistFromEnv() ([]redirectPattern, error) {
+	raw := splitList(os.Getenv("OAUTH_REDIRECT_ALLOWLIST"))
+	if len(raw) == 0 {
+		raw = defaultRedirectAllowlist
+	}
+
+	var patterns []redirectPattern
+	for _, s := range raw {
+		p, err := parseRedirectPattern(s)
+		if err != nil {
+			return nil, fmt.Errorf("OAUTH_REDIRECT_ALLOWLIST: %w", err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// parseRedirectPattern parses one pattern such as
+// "https://chat.openai.com/aip/*/oauth/callback".
+func parseRedirectPattern(s string) (redirectPattern, error) {
+	p := redirectPattern{scheme: "https"}
+	rest := s
+	if scheme, after, ok := strings.Cut(s, "://"); ok {
+		p.scheme, rest = strings.ToLower(scheme), after
+	}
+	host, path, hasPath := strings.Cut(rest, "/")
+	p.host = strings.ToLower(host)
+
+	switch {
+	case p.host == "" || strings.ContainsAny(p.host, "@?#"):
+		return p, fmt.Errorf("invalid host in %q", s)
+	case p.scheme == "http" && !isLoopbackHost(strings.Split(p.host, ":")[0]):
+		return p, fmt.Errorf("%q must use https", s)
+	case p.scheme != "https" && p.scheme != "http":
+		return p, fmt.Errorf("unsupported scheme in %q", s)
+	}
+	if hasPath && path != "" {
+		p.path = strings.Split(path, "/")
+	}
+	return p, nil
+}
+
+// redirectAllowed reports whether the browser may be sent to raw.
+func redirectAllowed(raw string, patterns []redirectPattern) bool {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.User != nil || u.Fragment != "" || u.Opaque != "" {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	segments := strings.Split(strings.TrimPrefix(u.EscapedPath(), "/"), "/")
+	for _, p := range patterns {
+		if strings.ToLower(u.Scheme) != p.scheme {
+			continue
+		}
+		if p.host != host && !(strings.HasPrefix(p.host, "*.") && hostAllowed(host, []string{p.host})) {
+			continue
+		}
+		if p.path == nil || pathMatches(p.path, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathMatches matches path segments against pattern segments.
+func pathMatches(pattern, segments []string) bool {
+	for i, want := range pattern {
+		if i >= len(segments) {
+			return false
+		}
+		if want == "*" {
+			if segments[i] == "" {
+				return false
+			}
+			if i == len(pattern)-1 {
+				return true
+			}
+			continue
+		}
+		if segments[i] != want {
+			return false
+		}
+	}
+	return len(segments) == len(pattern)
+}
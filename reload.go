@@ -0,0 +1,210 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/telemetry"
+	"gopkg.in/yaml.v3"
+)
+
+// ### Hot Reload #############################################################
+
+// A reload re-reads CONFIG_FILE, the policy (POLICY_FILE, or BACKEND_POLICY
+// from the backend) and OAUTH_REDIRECT_ALLOWLIST, and swaps them in for the
+// requests that follow: the path allowlist, rate limits, scope mappings,
+// response cache rules, redaction, transforms, compression and flags, and
+// the redirect allowlist. Requests in flight finish with the policy they
+// started with. Nothing is applied unless all of it is valid, so a typo
+// leaves the running configuration in place. Other settings take effect at
+// the next restart, except those read on every use such as
+// PROXY_ADMIN_TOKEN.
+//
+// Reloads are triggered by SIGHUP, POST /admin/reload, Server.Reload and,
+// with CONFIG_RELOAD_INTERVAL, by a periodic check for changes.
+
+// reloadMu serializes reloads.
+var reloadMu sync.Mutex
+
+// reloadStats counts reloads by outcome: applied, unchanged or failed.
+var reloadStats = struct {
+	sync.Mutex
+	outcomes map[string]uint64
+}{outcomes: make(map[string]uint64)}
+
+// loadActivePolicy reads the policy from the backend when BACKEND_POLICY
+// names one, or from POLICY_FILE.
+func loadActivePolicy(ctx context.Context) (*Policy, error) {
+	if name := os.Getenv("BACKEND_POLICY"); name != "" {
+		if backend == nil {
+			return nil, errors.New("BACKEND_POLICY requires BACKEND_URL")
+		}
+		return backend.Policy(ctx, name)
+	}
+	return loadPolicy(os.Getenv("POLICY_FILE"))
+}
+
+// applyPolicy makes p the policy in effect, with its redactor and rate
+// and concurrency limiters. The limiters are kept while the rate limits
+// stay the same, so clients don't get a fresh burst from a reload.
+func applyPolicy(p *Policy) error {
+	r, err := newRedactor(p.Redaction)
+	if err != nil {
+		return err
+	}
+	if old := activePolicy.Load(); old == nil || old.RateLimits != p.RateLimits {
+		limiter.Store(newRateLimiter(p.RateLimits))
+		inFlight.Store(newConcurrencyLimiter(p.RateLimits))
+	}
+	bodyRedactor.Store(r)
+	activePolicy.Store(p)
+	return nil
+}
+
+// reloadConfig reloads the configuration, reporting whether anything
+// changed.
+func reloadConfig(ctx context.Context) (changed bool, err error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	defer func() {
+		outcome := "unchanged"
+		switch {
+		case err != nil:
+			outcome = "failed"
+		case changed:
+			outcome = "applied"
+		}
+		reloadStats.Lock()
+		reloadStats.outcomes[outcome]++
+		reloadStats.Unlock()
+	}()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if _, err := proxySettings.Load(path); err != nil {
+			return false, err
+		}
+		if err := proxySettings.Validate(); err != nil {
+			return false, err
+		}
+	}
+	redirects, err := redirectAllowlistFromEnv()
+	if err != nil {
+		return false, err
+	}
+	p, err := loadActivePolicy(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if samePolicy(p, currentPolicy()) && reflect.DeepEqual(redirects, currentRedirects()) {
+		return false, nil
+	}
+	if err := applyPolicy(p); err != nil {
+		return false, err
+	}
+	clientRedirects.Store(&redirects)
+	return true, nil
+}
+
+// samePolicy reports whether a and b are the same document.
+func samePolicy(a, b *Policy) bool {
+	da, errA := yaml.Marshal(a)
+	db, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(da, db)
+}
+
+// logReload reloads the configuration and logs the outcome.
+func logReload(ctx context.Context, trigger string) error {
+	changed, err := reloadConfig(ctx)
+	switch {
+	case err != nil:
+		log.Printf("Configuration reload (%s) failed, keeping the running configuration: %v", trigger, err)
+	case changed:
+		log.Printf("Configuration reloaded (%s)", trigger)
+	case trigger != "interval":
+		log.Printf("Configuration reload (%s): nothing changed", trigger)
+	}
+	return err
+}
+
+// reloadOnSignal reloads the configuration on every SIGHUP until ctx is
+// done.
+func reloadOnSignal(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logReload(ctx, "SIGHUP")
+		}
+	}
+}
+
+// watchConfig reloads the configuration every interval until ctx is done,
+// applying it when it changed.
+func watchConfig(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logReload(ctx, "interval")
+		}
+	}
+}
+
+// configReloadIntervalFromEnv reads CONFIG_RELOAD_INTERVAL; 0 disables the
+// periodic check.
+func configReloadIntervalFromEnv() (time.Duration, error) {
+	v := os.Getenv("CONFIG_RELOAD_INTERVAL")
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < time.Second {
+		return 0, fmt.Errorf("invalid CONFIG_RELOAD_INTERVAL %q (expected at least 1s)", v)
+	}
+	return d, nil
+}
+
+// handleAdminReload reloads the configuration now.
+// POST /admin/reload
+func handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	changed, err := reloadConfig(r.Context())
+	if err != nil {
+		log.Printf("Configuration reload (admin) failed, keeping the running configuration: %v", err)
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+	if changed {
+		log.Printf("Configuration reloaded (admin)")
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"changed": changed})
+}
+
+// writeReloadMetrics appends the reload counter.
+func writeReloadMetrics(w *strings.Builder) {
+	reloadStats.Lock()
+	defer reloadStats.Unlock()
+	telemetry.Counter(w, "ebay_proxy_config_reloads_total", "Configuration reloads by outcome.", "outcome", reloadStats.outcomes)
+}
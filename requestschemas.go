@@ -0,0 +1,572 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ### Request Schemas ########################################################
+
+// eBay answers a malformed body with errors such as 25709 "Invalid value
+// for {fieldName}", often naming no field an assistant can act on. The
+// policy's `validation` section checks JSON request bodies sent through
+// /proxy against the operation's schema first and answers 400 with every
+// problem and the field it is in, e.g. "pricingSummary.price.value:
+// expected string, got number".
+//
+// Schemas come from eBay's OpenAPI 3 contracts. Trimmed contracts of the
+// Inventory and Fulfillment APIs' write calls are embedded (schemas/*.json,
+// with the enums eBay documents as type definitions filled in), and
+// REQUEST_SCHEMA_DIR adds the contracts downloaded from the developer
+// portal, whose operations replace the embedded ones. Operations without a
+// schema pass through unchecked.
+
+//go:embed schemas/*.json
+var embeddedSchemaFS embed.FS
+
+// Validation modes.
+const (
+	validationOff     = "off"
+	validationReport  = "report"  // log problems, forward anyway
+	validationEnforce = "enforce" // reject with 400
+)
+
+// maxSchemaProblems caps the problems reported for one body.
+const maxSchemaProblems = 20
+
+// ValidationPolicy turns request schema validation on. Exclude lists path
+// prefixes that are never checked.
+type ValidationPolicy struct {
+	Mode                string   `yaml:"mode,omitempty"`
+	RejectUnknownFields bool     `yaml:"reject_unknown_fields,omitempty"`
+	Exclude             []string `yaml:"exclude,omitempty"`
+}
+
+// validate reports problems with the validation section.
+func (v *ValidationPolicy) validate() []string {
+	var problems []string
+	switch v.Mode {
+	case "", validationOff, validationReport, validationEnforce:
+	default:
+		problems = append(problems, fmt.Sprintf("validation: unknown mode %q (expected off, report or enforce)", v.Mode))
+	}
+	for i, prefix := range v.Exclude {
+		if !strings.HasPrefix(prefix, "/") {
+			problems = append(problems, fmt.Sprintf("validation: exclude[%d] %q must start with /", i, prefix))
+		}
+	}
+	return problems
+}
+
+// enabled reports whether bodies sent to path are checked.
+func (v *ValidationPolicy) enabled(path string) bool {
+	if v.Mode == "" || v.Mode == validationOff {
+		return false
+	}
+	for _, prefix := range v.Exclude {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonSchema is the subset of JSON Schema (as OpenAPI 3 uses it) that
+// eBay's contracts need.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 string                 `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	AllOf                []*jsonSchema          `json:"allOf"`
+	Enum                 []interface{}          `json:"enum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	Pattern              string                 `json:"pattern"`
+
+	pattern    *regexp.Regexp
+	additional *jsonSchema // parsed AdditionalProperties schema
+	closed     bool        // additionalProperties: false
+}
+
+// schemaDocument is the part of an OpenAPI 3 contract we read.
+type schemaDocument struct {
+	Servers []struct {
+		URL       string `json:"url"`
+		Variables map[string]struct {
+			Default string `json:"default"`
+		} `json:"variables"`
+	} `json:"servers"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"` // operations, and parameters
+	Components struct {
+		Schemas map[string]*jsonSchema `json:"schemas"`
+	} `json:"components"`
+}
+
+// schemaOperation is the part of an OpenAPI 3 operation we read.
+type schemaOperation struct {
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema *jsonSchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+// requestSchema is the body schema of one operation.
+type requestSchema struct {
+	method   string
+	template []string // path segments; {name} matches any segment
+	schema   *jsonSchema
+	source   string
+}
+
+// requestSchemas are the loaded operations, set at startup.
+var requestSchemas []*requestSchema
+
+// requestSchemasFromEnv loads the embedded contracts and those in
+// REQUEST_SCHEMA_DIR.
+func requestSchemasFromEnv() ([]*requestSchema, error) {
+	schemas, err := loadSchemaDocuments(embeddedSchemaFS, "schemas", nil)
+	if err != nil {
+		return nil, fmt.Errorf("embedded schemas: %w", err)
+	}
+	if dir := os.Getenv("REQUEST_SCHEMA_DIR"); dir != "" {
+		if schemas, err = loadSchemaDocuments(os.DirFS(dir), ".", schemas); err != nil {
+			return nil, fmt.Errorf("REQUEST_SCHEMA_DIR: %w", err)
+		}
+	}
+	return schemas, nil
+}
+
+// loadSchemaDocuments adds the operations of the *.json contracts in dir
+// of fsys to schemas, replacing operations they define again.
+func loadSchemaDocuments(fsys fs.FS, dir string, schemas []*requestSchema) ([]*requestSchema, error) {
+	names, err := fs.Glob(fsys, filepath.ToSlash(filepath.Join(dir, "*.json")))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		ops, err := parseSchemaDocument(data, filepath.Base(name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, op := range ops {
+			replaced := false
+			for i, existing := range schemas {
+				if existing.method == op.method && strings.Join(existing.template, "/") == strings.Join(op.template, "/") {
+					schemas[i], replaced = op, true
+				}
+			}
+			if !replaced {
+				schemas = append(schemas, op)
+			}
+		}
+		log.Printf("Loaded request schemas of %d operations from %s", len(ops), name)
+	}
+	return schemas, nil
+}
+
+// parseSchemaDocument returns the operations of a contract that take a
+// JSON body, with every $ref resolved.
+func parseSchemaDocument(data []byte, source string) ([]*requestSchema, error) {
+	var doc schemaDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Servers) == 0 {
+		return nil, fmt.Errorf("no servers to take the base path from")
+	}
+	server := doc.Servers[0].URL
+	for name, v := range doc.Servers[0].Variables {
+		server = strings.ReplaceAll(server, "{"+name+"}", v.Default)
+	}
+	base := server
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		base = u.Path
+	}
+
+	resolver := &schemaResolver{components: doc.Components.Schemas, seen: make(map[*jsonSchema]bool)}
+	var ops []*requestSchema
+	for path, methods := range doc.Paths {
+		for method, raw := range methods {
+			var op schemaOperation
+			if !isHTTPMethod(strings.ToUpper(method)) {
+				continue
+			}
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+			}
+			if op.RequestBody == nil {
+				continue
+			}
+			content, ok := op.RequestBody.Content["application/json"]
+			if !ok || content.Schema == nil {
+				continue
+			}
+			schema, err := resolver.resolve(content.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+			}
+			ops = append(ops, &requestSchema{
+				method:   strings.ToUpper(method),
+				template: splitPath(strings.TrimRight(base, "/") + path),
+				schema:   schema,
+				source:   source,
+			})
+		}
+	}
+	return ops, nil
+}
+
+// schemaResolver replaces references to components/schemas with the
+// schemas, which may then be shared and recursive, and compiles patterns.
+type schemaResolver struct {
+	components map[string]*jsonSchema
+	seen       map[*jsonSchema]bool
+}
+
+func (r *schemaResolver) resolve(s *jsonSchema) (*jsonSchema, error) {
+	if s == nil {
+		return nil, nil
+	}
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		target, ok := r.components[name]
+		if !ok || name == s.Ref {
+			return nil, fmt.Errorf("unresolvable $ref %q", s.Ref)
+		}
+		s = target
+	}
+	if r.seen[s] {
+		return s, nil
+	}
+	r.seen[s] = true
+
+	var err error
+	for name, p := range s.Properties {
+		if s.Properties[name], err = r.resolve(p); err != nil {
+			return nil, err
+		}
+	}
+	if s.Items, err = r.resolve(s.Items); err != nil {
+		return nil, err
+	}
+	for i, a := range s.AllOf {
+		if s.AllOf[i], err = r.resolve(a); err != nil {
+			return nil, err
+		}
+	}
+	switch raw := bytes.TrimSpace(s.AdditionalProperties); {
+	case len(raw) == 0, string(raw) == "true":
+	case string(raw) == "false":
+		s.closed = true
+	default:
+		var additional jsonSchema
+		if err := json.Unmarshal(raw, &additional); err != nil {
+			return nil, fmt.Errorf("invalid additionalProperties: %w", err)
+		}
+		if s.additional, err = r.resolve(&additional); err != nil {
+			return nil, err
+		}
+	}
+	if s.Pattern != "" {
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", s.Pattern, err)
+		}
+	}
+	return s, nil
+}
+
+// requestSchemaFor returns the schema of method on path, if one is loaded.
+func requestSchemaFor(method, path string) *requestSchema {
+	segments := splitPath(path)
+	for _, s := range requestSchemas {
+		if s.method == method && matchTemplate(s.template, segments) {
+			return s
+		}
+	}
+	return nil
+}
+
+// checkRequestSchema validates the JSON body of a request to path when the
+// policy asks for it. It answers the request and returns false when the
+// body is invalid and the policy enforces its schema.
+func checkRequestSchema(w http.ResponseWriter, r *http.Request, pol *Policy, path string, loc localizer) bool {
+	if !pol.Validation.enabled(path) {
+		return true
+	}
+	schema := requestSchemaFor(r.Method, path)
+	if schema == nil {
+		return true
+	}
+	if mediaType := r.Header.Get("Content-Type"); mediaType != "" && !strings.Contains(mediaType, "json") {
+		return true
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			writeBodyTooLarge(w, maxRequestBodySize)
+			return false
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(bytes.TrimSpace(body)) == 0 {
+		return true // eBay says what it thinks of an empty body
+	}
+
+	var problems []string
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		problems = []string{"the body is not valid JSON: " + err.Error()}
+	} else {
+		v := &schemaValidator{rejectUnknown: pol.Validation.RejectUnknownFields}
+		v.check(schema.schema, value, "", false)
+		problems = v.problems
+	}
+	if len(problems) == 0 {
+		return true
+	}
+	if pol.Validation.Mode == validationReport {
+		log.Printf("Request to %s %s doesn't match its schema (%s): %s", r.Method, path, schema.source, strings.Join(problems, "; "))
+		return true
+	}
+	log.Printf("Rejected %s %s before calling eBay: %s", r.Method, path, strings.Join(problems, "; "))
+	loc.setContentLanguage(w)
+	writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+		"error":    "invalid_request_body",
+		"problems": problems,
+		"message":  loc.T("schema.invalid", strings.Join(problems, "; ")),
+	})
+	return false
+}
+
+// schemaValidator collects the problems of one value.
+type schemaValidator struct {
+	rejectUnknown bool
+	problems      []string
+}
+
+func (v *schemaValidator) fail(at, format string, args ...interface{}) {
+	if len(v.problems) == maxSchemaProblems {
+		v.problems = append(v.problems, "more problems not shown")
+	}
+	if len(v.problems) > maxSchemaProblems {
+		return
+	}
+	v.problems = append(v.problems, at+": "+fmt.Sprintf(format, args...))
+}
+
+// check validates value, found at path at, against s. Parts of an allOf
+// leave unknown fields to the schema combining them.
+func (v *schemaValidator) check(s *jsonSchema, value interface{}, at string, part bool) {
+	if s == nil {
+		return
+	}
+	for _, sub := range s.AllOf {
+		v.check(sub, value, at, true)
+	}
+	if value == nil {
+		return // eBay treats null like a missing field
+	}
+	if s.Type != "" && !matchesSchemaType(s.Type, value) {
+		v.fail(at, "expected %s, got %s", s.Type, jsonTypeOf(value))
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		v.fail(at, "%s is not one of %s", formatJSONValue(value), formatEnum(s.Enum))
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				v.fail(joinSchemaPath(at, name), "is required")
+			}
+		}
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if p, ok := s.Properties[name]; ok {
+				v.check(p, value[name], joinSchemaPath(at, name), false)
+				continue
+			}
+			known := s.properties()
+			switch {
+			case s.additional != nil:
+				v.check(s.additional, value[name], joinSchemaPath(at, name), false)
+			case part || known[name] != nil:
+			case s.closed || v.rejectUnknown && len(known) > 0:
+				v.fail(joinSchemaPath(at, name), "unknown field%s", suggestField(name, known))
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			v.fail(at, "needs at least %d items, has %d", *s.MinItems, len(value))
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			v.fail(at, "takes at most %d items, has %d", *s.MaxItems, len(value))
+		}
+		for i, item := range value {
+			v.check(s.Items, item, fmt.Sprintf("%s[%d]", at, i), false)
+		}
+	case string:
+		n := len([]rune(value))
+		if s.MinLength != nil && n < *s.MinLength {
+			v.fail(at, "must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			v.fail(at, "must be at most %d characters, is %d", *s.MaxLength, n)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			v.fail(at, "%q doesn't match %s", value, s.Pattern)
+		}
+	case json.Number:
+		f, _ := value.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			v.fail(at, "must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			v.fail(at, "must be at most %v", *s.Maximum)
+		}
+	}
+}
+
+// properties returns the properties of s and of the parts of its allOf.
+func (s *jsonSchema) properties() map[string]*jsonSchema {
+	if len(s.AllOf) == 0 {
+		return s.Properties
+	}
+	all := make(map[string]*jsonSchema, len(s.Properties))
+	for name, p := range s.Properties {
+		all[name] = p
+	}
+	for _, sub := range s.AllOf {
+		for name, p := range sub.properties() {
+			all[name] = p
+		}
+	}
+	return all
+}
+
+func matchesSchemaType(t string, value interface{}) bool {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return t == "object"
+	case []interface{}:
+		return t == "array"
+	case string:
+		return t == "string"
+	case bool:
+		return t == "boolean"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		f, err := value.Float64()
+		return t == "integer" && err == nil && f == math.Trunc(f)
+	}
+	return false
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if strings.ContainsAny(value.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	}
+	return "null"
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if formatJSONValue(e) == formatJSONValue(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatJSONValue(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func formatEnum(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, e := range enum {
+		values[i] = formatJSONValue(e)
+	}
+	return strings.Join(values, ", ")
+}
+
+func joinSchemaPath(at, name string) string {
+	if at == "" {
+		return name
+	}
+	return at + "." + name
+}
+
+// suggestField names a known property that differs from name only in
+// case, or in the order of two neighbouring letters, the typos assistants
+// make.
+func suggestField(name string, properties map[string]*jsonSchema) string {
+	for known := range properties {
+		if strings.EqualFold(known, name) || isTransposition(known, name) {
+			return fmt.Sprintf(" (did you mean %q?)", known)
+		}
+	}
+	return ""
+}
+
+func isTransposition(a, b string) bool {
+	if len(a) != len(b) || a == b {
+		return false
+	}
+	i := 0
+	for i < len(a) && a[i] == b[i] {
+		i++
+	}
+	return i+1 < len(a) && a[i] == b[i+1] && a[i+1] == b[i] && a[i+2:] == b[i+2:]
+}
@@ -0,0 +1,273 @@
+package ebaymcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ### MCP Resources ##########################################################
+
+// Besides tools, the MCP server offers the state of the user's eBay account
+// as resources the client can read into its context without a tool call:
+//
+//	ebay://inventory          inventory items (first 100)
+//	ebay://orders/unshipped   orders waiting to ship, as listOrders returns them
+//	ebay://policies           fulfillment, payment and return policies
+//	                          (?marketplace_id=EBAY_DE, default EBAY_US)
+//	ebay://account/limits     selling limits (getPrivileges)
+//
+// A client that subscribes to a resource gets notifications/resources/updated
+// when it changes. Subscribed resources are read again every
+// MCP_RESOURCE_POLL_INTERVAL (default 5m), and right away when an eBay
+// notification about them (ITEM_AVAILABILITY, ITEM_PRICE_REVISION) reaches
+// the proxy serving the session; `ebay-mcp mcp` runs in its own process and
+// only polls.
+
+const (
+	rpcResourceNotFound = -32002
+	rpcInternalError    = -32603
+
+	defaultResourcePollInterval = 5 * time.Minute
+)
+
+// mcpResource is one resource and the proxy calls that read it.
+type mcpResource struct {
+	URI         string
+	Name        string
+	Description string
+
+	// calls read the resource; the answers of several calls are combined
+	// into one object by key
+	calls []resourceCall
+
+	// topics are the eBay notification topics that may change it
+	topics []string
+
+	// marketplace says the calls take the URI's marketplace_id
+	marketplace bool
+}
+
+type resourceCall struct {
+	key   string
+	path  string
+	query url.Values
+}
+
+var mcpResources = []mcpResource{
+	{
+		URI:         "ebay://inventory",
+		Name:        "Inventory",
+		Description: "The seller's inventory items (the first 100): SKUs, quantities, conditions and product details.",
+		calls:       []resourceCall{{path: "/proxy/sell/inventory/v1/inventory_item", query: url.Values{"limit": {"100"}}}},
+		topics:      []string{"ITEM_AVAILABILITY", "ITEM_PRICE_REVISION"},
+	},
+	{
+		URI:         "ebay://orders/unshipped",
+		Name:        "Unshipped orders",
+		Description: "Orders of the last 30 days that are waiting to be shipped, with buyer, totals and line items.",
+		calls:       []resourceCall{{path: ordersPath, query: url.Values{"status": {"unshipped"}}}},
+	},
+	{
+		URI:         "ebay://policies",
+		Name:        "Business policies",
+		Description: "The seller's fulfillment, payment and return policies on a marketplace (ebay://policies?marketplace_id=EBAY_DE; EBAY_US by default).",
+		calls: []resourceCall{
+			{key: "fulfillment_policies", path: "/proxy/sell/account/v1/fulfillment_policy"},
+			{key: "payment_policies", path: "/proxy/sell/account/v1/payment_policy"},
+			{key: "return_policies", path: "/proxy/sell/account/v1/return_policy"},
+		},
+		marketplace: true,
+	},
+	{
+		URI:         "ebay://account/limits",
+		Name:        "Selling limits",
+		Description: "How many more items and how much more value the seller may list this month.",
+		calls:       []resourceCall{{path: "/proxy/sell/account/v1/privilege"}},
+	},
+}
+
+// findResource returns the resource uri names, and the marketplace it asks
+// for.
+func findResource(uri string) (mcpResource, string, bool) {
+	base, rawQuery, _ := strings.Cut(uri, "?")
+	for _, res := range mcpResources {
+		if res.URI != base {
+			continue
+		}
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil || (rawQuery != "" && !res.marketplace) {
+			return mcpResource{}, "", false
+		}
+		marketplace := query.Get(marketplaceParam)
+		if marketplace == "" {
+			marketplace = defaultMarketplace
+		}
+		return res, marketplace, true
+	}
+	return mcpResource{}, "", false
+}
+
+func mcpResourceInfo(res mcpResource) map[string]string {
+	return map[string]string{
+		"uri":         res.URI,
+		"name":        res.Name,
+		"description": res.Description,
+		"mimeType":    "application/json",
+	}
+}
+
+// readResource reads res from the proxy as JSON.
+func (c *toolClient) readResource(ctx context.Context, res mcpResource, marketplace string) ([]byte, error) {
+	combined := map[string]json.RawMessage{}
+	for _, call := range res.calls {
+		query := url.Values{}
+		for name, values := range call.query {
+			query[name] = values
+		}
+		if res.marketplace {
+			query.Set(marketplaceParam, marketplace)
+		}
+		status, _, body, err := c.do(ctx, http.MethodGet, call.path, query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if status >= 400 {
+			return nil, fmt.Errorf("eBay returned status %d: %s", status, body)
+		}
+		if call.key == "" {
+			return body, nil
+		}
+		if !json.Valid(body) {
+			return nil, fmt.Errorf("%s returned invalid JSON", call.path)
+		}
+		combined[call.key] = body
+	}
+	return json.Marshal(combined)
+}
+
+// ### Subscriptions ###
+
+// resourceWatcher reads a session's subscribed resources again when they may
+// have changed and tells the client about those that did.
+type resourceWatcher struct {
+	server   *mcpServer
+	interval time.Duration
+	wake     chan struct{}
+
+	mu      sync.Mutex
+	started bool
+	digests map[string]string // subscribed URI → digest of its last reading
+}
+
+func newResourceWatcher(s *mcpServer, interval time.Duration) *resourceWatcher {
+	return &resourceWatcher{server: s, interval: interval, wake: make(chan struct{}, 1), digests: map[string]string{}}
+}
+
+// Subscribe watches uri until ctx ends or Unsubscribe is called. Its
+// current state is read first, to notice later changes.
+func (w *resourceWatcher) Subscribe(ctx context.Context, uri string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.digests[uri]; !ok {
+		w.digests[uri] = ""
+	}
+	if !w.started {
+		w.started = true
+		w.server.wg.Add(1)
+		go func() {
+			defer w.server.wg.Done()
+			w.run(ctx)
+		}()
+	}
+	w.poke()
+}
+
+func (w *resourceWatcher) Unsubscribe(uri string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.digests, uri)
+}
+
+// poke makes run check the subscriptions now.
+func (w *resourceWatcher) poke() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *resourceWatcher) run(ctx context.Context) {
+	unsubscribe := notifications.Subscribe(func(n receivedNotification) {
+		if w.watchesTopic(n.Topic) {
+			w.poke()
+		}
+	})
+	defer unsubscribe()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+		w.check(ctx)
+	}
+}
+
+func (w *resourceWatcher) watchesTopic(topic string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for uri := range w.digests {
+		res, _, _ := findResource(uri)
+		for _, t := range res.topics {
+			if t == topic {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// check reads every subscribed resource and notifies the client of those
+// whose content changed since the last reading.
+func (w *resourceWatcher) check(ctx context.Context) {
+	w.mu.Lock()
+	uris := make([]string, 0, len(w.digests))
+	for uri := range w.digests {
+		uris = append(uris, uri)
+	}
+	w.mu.Unlock()
+
+	for _, uri := range uris {
+		res, marketplace, _ := findResource(uri)
+		body, err := w.server.client.readResource(ctx, res, marketplace)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to check MCP resource %s: %v", uri, err)
+			}
+			continue
+		}
+		digest := fmt.Sprintf("%x", sha256.Sum256(body))
+
+		w.mu.Lock()
+		previous, subscribed := w.digests[uri]
+		if subscribed {
+			w.digests[uri] = digest
+		}
+		w.mu.Unlock()
+		if subscribed && previous != "" && previous != digest {
+			w.server.notify(w.server.notices, "notifications/resources/updated", map[string]string{"uri": uri})
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ### Response Cache #########################################################
+
+// Successful GET responses for paths matched by the policy's `cache` rules
+// are kept in the cache (see cache.go) and replayed until their TTL runs
+// out. Responses are cached per caller (bearer token) unless the rule is
+// `shared`, which is only for data that is the same for everybody, such as
+// the Taxonomy API. A successful write (POST, PUT, DELETE, ...) by a caller
+// drops their cached responses, so they read their own writes, whichever
+// replica served the write; `DELETE /admin/cache` drops everything within
+// cacheGenerationLocalTTL. Clients can bypass the cache with
+// `Cache-Control: no-cache`. Responses carry X-Proxy-Cache: HIT or MISS.
+
+// maxCachedResponseSize bounds the (decoded) bodies that are cached.
+const maxCachedResponseSize = 1 << 20
+
+// CacheRule caches GET responses for paths under Prefix for TTL.
+type CacheRule struct {
+	Prefix string        `yaml:"prefix"`
+	TTL    time.Duration `yaml:"ttl"`
+	Shared bool          `yaml:"shared,omitempty"`
+}
+
+// defaultCacheRules apply when the policy has no `cache` section.
+var defaultCacheRules = []CacheRule{
+	{Prefix: "/commerce/taxonomy/", TTL: 24 * time.Hour, Shared: true},
+}
+
+// validate checks the rule at index i of the policy.
+func (c *CacheRule) validate(i int) []string {
+	var problems []string
+	if !strings.HasPrefix(c.Prefix, "/") {
+		problems = append(problems, fmt.Sprintf("cache[%d]: prefix %q must start with /", i, c.Prefix))
+	}
+	if c.TTL <= 0 {
+		problems = append(problems, fmt.Sprintf("cache[%d]: ttl must be positive", i))
+	}
+	return problems
+}
+
+// cacheRuleFor returns the most specific cache rule for path, or nil.
+func (p *Policy) cacheRuleFor(path string) *CacheRule {
+	rules := p.Cache
+	if rules == nil {
+		rules = defaultCacheRules
+	}
+	var best *CacheRule
+	for i := range rules {
+		rule := &rules[i]
+		if strings.HasPrefix(path, rule.Prefix) && (best == nil || len(rule.Prefix) > len(best.Prefix)) {
+			best = rule
+		}
+	}
+	return best
+}
+
+// cachedResponseHeaders are the response headers replayed from the cache.
+var cachedResponseHeaders = []string{"Content-Type", "Content-Language"}
+
+// cachedResponse is a response as stored in the cache.
+type cachedResponse struct {
+	Status   int               `json:"status"`
+	Header   map[string]string `json:"header"`
+	Body     []byte            `json:"body"`
+	StoredAt time.Time         `json:"stored_at"`
+}
+
+// responseCacheKey identifies a response by everything it depends on: the
+// eBay environment and marketplace, the path, the full query (including the
+// proxy's own parameters, e.g. fields) and the response language.
+func responseCacheKey(r *http.Request, envName, marketplace, path string) string {
+	return strings.Join([]string{envName, marketplace, path, r.URL.RawQuery, r.Header.Get("Accept-Language")}, "\n")
+}
+
+// cacheScopeFor returns the scope a rule caches a caller's responses in.
+func cacheScopeFor(rule *CacheRule, callerToken string) string {
+	if rule.Shared {
+		return "shared"
+	}
+	return tokenHash(callerToken)
+}
+
+// wantsCachedResponse reports whether the client allows a cached answer.
+func wantsCachedResponse(r *http.Request) bool {
+	cc := strings.ToLower(r.Header.Get("Cache-Control"))
+	return !strings.Contains(cc, "no-cache") && !strings.Contains(cc, "no-store")
+}
+
+// lookupCachedResponse returns the cached response for key, if any.
+func lookupCachedResponse(ctx context.Context, scope, key string) (*cachedResponse, bool) {
+	data, ok := responseCache.Get(ctx, scope, key)
+	if !ok {
+		return nil, false
+	}
+	var cached cachedResponse
+	if err := json.Unmarshal(data, &cached); err != nil {
+		log.Printf("Ignoring undecodable cached response: %v", err)
+		return nil, false
+	}
+	return &cached, true
+}
+
+// serveCachedResponse writes a cached response, compressed as the client
+// accepts and rule allows.
+func serveCachedResponse(w http.ResponseWriter, r *http.Request, cached *cachedResponse, rateState *rateLimitState, rule CompressionRule) error {
+	resp := &http.Response{
+		StatusCode:    cached.Status,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+		ContentLength: int64(len(cached.Body)),
+		Request:       r,
+	}
+	for name, value := range cached.Header {
+		resp.Header.Set(name, value)
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(cached.Body)))
+	if err := negotiateEncoding(resp, r.Header.Get("Accept-Encoding"), rule); err != nil {
+		return err
+	}
+
+	copyHeaders(w.Header(), resp.Header)
+	if rateState != nil {
+		setRateLimitHeaders(w.Header(), *rateState)
+	}
+	w.Header().Set("X-Proxy-Cache", "HIT")
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(cached.StoredAt).Seconds())))
+	w.WriteHeader(cached.Status)
+	_, err := io.Copy(w, resp.Body)
+	return err
+}
+
+// storeCachedResponse caches a successful response for ttl, unless eBay
+// forbids storing it or it is too large. The body is decoded in the process.
+func storeCachedResponse(resp *http.Response, scope, key string, ttl time.Duration) error {
+	resp.Header.Set("X-Proxy-Cache", "MISS")
+	if strings.Contains(strings.ToLower(resp.Header.Get("Cache-Control")), "no-store") {
+		return nil
+	}
+	if err := decodeBody(resp); err != nil {
+		return err
+	}
+	body, err := peekBody(resp, maxCachedResponseSize+1)
+	if err != nil {
+		return err
+	}
+	if len(body) > maxCachedResponseSize {
+		return nil
+	}
+
+	cached := cachedResponse{Status: resp.StatusCode, Header: map[string]string{}, Body: body, StoredAt: time.Now().UTC()}
+	for _, name := range cachedResponseHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			cached.Header[name] = v
+		}
+	}
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	responseCache.Set(resp.Request.Context(), scope, key, data, ttl)
+	return nil
+}
+
+// handleAdminCache drops every cached response.
+// DELETE /admin/cache
+func handleAdminCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	responseCache.Invalidate(r.Context(), "")
+	log.Printf("Response cache invalidated by admin")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,140 @@
+package ebaymcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ### Result Pages ###########################################################
+
+// A tool result larger than MCP_RESULT_PAGE_SIZE bytes (default 32 KiB),
+// such as hundreds of inventory items, doesn't reach the model in one piece:
+// the largest array of the JSON answer is cut into pages, and each page
+// carries the answer's other fields, a page_info object
+// ({"offset": 0, "count": 50, "total": 400}) and, until the last page, a
+// next_cursor. Passing next_cursor to the getNextPage tool returns the next
+// page. The full answer is kept in the cache for MCP_RESULT_TTL (default
+// 30m), in the scope of the caller's token as in the response cache, so a
+// cursor only works for the caller it was given to. Answers without an
+// array to split are returned whole.
+
+const (
+	nextPageTool           = "getNextPage"
+	defaultResultPageBytes = 32 * 1024
+	defaultResultPageTTL   = 30 * time.Minute
+)
+
+var resultPages = cacheNamespace{name: "mcp_results"}
+
+// nextPageToolInfo describes getNextPage in tools/list.
+func nextPageToolInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"name":        nextPageTool,
+		"description": "Get the next page of a tool result that was too large to return at once. Pass the next_cursor of the previous page; the last page has none.",
+		"inputSchema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"cursor": map[string]interface{}{"type": "string", "description": "next_cursor of the previous page"},
+			},
+			"required": []string{"cursor"},
+		},
+	}
+}
+
+// pageResult returns body as a tool result, or its first page when it is
+// too large.
+func (c *toolClient) pageResult(ctx context.Context, body []byte) *toolResult {
+	if len(body) <= c.pageBytes {
+		return textResult(string(body), false)
+	}
+	id, err := randomID(16)
+	if err != nil {
+		return textResult(string(body), false)
+	}
+	page, ok := resultPage(body, 0, c.pageBytes, id)
+	if !ok {
+		return textResult(string(body), false)
+	}
+	resultPages.Set(ctx, tokenHash(c.key()), id, body, c.pageTTL)
+	return textResult(string(page), false)
+}
+
+// nextPage implements getNextPage.
+func (c *toolClient) nextPage(ctx context.Context, args map[string]interface{}) *toolResult {
+	cursor, _ := args["cursor"].(string)
+	id, rawOffset, _ := strings.Cut(cursor, ".")
+	offset, err := strconv.Atoi(rawOffset)
+	if id == "" || err != nil || offset < 0 {
+		return textResult("Invalid cursor: pass the next_cursor of the previous page", true)
+	}
+	body, ok := resultPages.Get(ctx, tokenHash(c.key()), id)
+	if !ok {
+		return textResult("The cursor has expired; call the original tool again", true)
+	}
+	page, ok := resultPage(body, offset, c.pageBytes, id)
+	if !ok {
+		return textResult("Invalid cursor: pass the next_cursor of the previous page", true)
+	}
+	return textResult(string(page), false)
+}
+
+// resultPage cuts the page starting at item offset of the largest array in
+// body, as many items as fit into about pageBytes but at least one. It
+// reports false when body has no array to page or offset is past its end.
+func resultPage(body []byte, offset, pageBytes int, id string) ([]byte, bool) {
+	var items []json.RawMessage
+	var fields map[string]json.RawMessage
+	field := "items" // for an answer that is an array itself
+	if err := json.Unmarshal(body, &items); err != nil {
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, false
+		}
+		items, field = largestArray(fields)
+	}
+	if len(items) < 2 || offset >= len(items) {
+		return nil, false
+	}
+
+	// Room for the items is what the rest of the answer leaves over
+	arraySize := 2
+	for _, item := range items {
+		arraySize += len(item) + 1
+	}
+	budget := pageBytes - (len(body) - arraySize)
+	end, size := offset, 0
+	for end < len(items) && (end == offset || size+len(items[end])+1 <= budget) {
+		size += len(items[end]) + 1
+		end++
+	}
+
+	page := make(map[string]interface{}, len(fields)+3)
+	for name, value := range fields {
+		page[name] = value
+	}
+	page[field] = items[offset:end]
+	page["page_info"] = map[string]int{"offset": offset, "count": end - offset, "total": len(items)}
+	if end < len(items) {
+		page["next_cursor"] = fmt.Sprintf("%s.%d", id, end)
+	}
+	data, err := json.Marshal(page)
+	return data, err == nil
+}
+
+// largestArray returns the array field of fields that takes up the most
+// bytes, and its name.
+func largestArray(fields map[string]json.RawMessage) ([]json.RawMessage, string) {
+	var largest []json.RawMessage
+	name, size := "", 0
+	for field, value := range fields {
+		var items []json.RawMessage
+		if len(value) <= size || json.Unmarshal(value, &items) != nil {
+			continue
+		}
+		largest, name, size = items, field, len(value)
+	}
+	return largest, name
+}
@@ -0,0 +1,244 @@
+package ebaymcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ### Sandbox Test Users #####################################################
+
+// eBay sandbox test users can only grant consent through a browser sign-in,
+// which integration tests and demos can't do. Instead, a developer signs in
+// once (e.g. on the developer portal's "User Tokens" page) and registers the
+// resulting refresh token here. The proxy keeps it in the vault, labelled
+// with the developer and test user, and mints access tokens from it on
+// demand, through the admin API or `ebay-mcp sandbox token`.
+
+// sandboxUser is the public view of a registered test user.
+type sandboxUser struct {
+	ID        string    `json:"id"`
+	APIKey    string    `json:"api_key"`
+	Developer string    `json:"developer"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newSandboxUser(id string, entry *vaultEntry) sandboxUser {
+	return sandboxUser{
+		ID:        id,
+		APIKey:    vaultKeyPrefix + id,
+		Developer: entry.Developer,
+		Username:  entry.TestUsername,
+		CreatedAt: entry.CreatedAt,
+	}
+}
+
+// isSandboxUser reports whether a vault entry is a registered test user.
+func isSandboxUser(entry *vaultEntry) bool {
+	return entry.TestUsername != "" && entry.environmentName() == envSandbox
+}
+
+// handleSandboxUsers manages sandbox test users.
+//
+//	GET    /admin/sandbox-users?developer=alice      list test users
+//	POST   /admin/sandbox-users                      {"developer", "username", "password", "refresh_token"}
+//	POST   /admin/sandbox-users/{id}/token           mint a user access token
+//	DELETE /admin/sandbox-users/{id}                 forget a test user
+//
+// The password is optional and only kept (encrypted) for manual sign-ins.
+func handleSandboxUsers(w http.ResponseWriter, r *http.Request) {
+	if vault == nil {
+		http.Error(w, "Token vault is not configured (set VAULT_FILE and VAULT_KEY)", http.StatusConflict)
+		return
+	}
+	env := environments[envSandbox]
+	if env == nil {
+		http.Error(w, "The sandbox environment is not configured", http.StatusConflict)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/sandbox-users"), "/")
+	id, action, _ := strings.Cut(rest, "/")
+
+	switch {
+	case r.Method == "GET" && id == "":
+		developer := r.URL.Query().Get("developer")
+		entries := vault.List(func(e *vaultEntry) bool {
+			return isSandboxUser(e) && (developer == "" || e.Developer == developer)
+		})
+		users := make([]sandboxUser, 0, len(entries))
+		for id, entry := range entries {
+			users = append(users, newSandboxUser(id, entry))
+		}
+		sort.Slice(users, func(i, j int) bool {
+			if users[i].Developer != users[j].Developer {
+				return users[i].Developer < users[j].Developer
+			}
+			return users[i].Username < users[j].Username
+		})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"users": users})
+
+	case r.Method == "POST" && id == "":
+		var req struct {
+			Developer    string `json:"developer"`
+			Username     string `json:"username"`
+			Password     string `json:"password"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil ||
+			req.Developer == "" || req.Username == "" || req.RefreshToken == "" {
+			http.Error(w, "Body must be JSON with developer, username and refresh_token", http.StatusBadRequest)
+			return
+		}
+
+		// Validate the refresh token before storing it
+		token, err := mintAccessToken(r.Context(), env, strings.TrimSpace(req.RefreshToken))
+		if err != nil {
+			log.Printf("Sandbox user validation failed: %v", err)
+			http.Error(w, "The refresh token was rejected by the eBay sandbox", http.StatusBadRequest)
+			return
+		}
+
+		entry := &vaultEntry{
+			RefreshToken: strings.TrimSpace(req.RefreshToken),
+			Environment:  envSandbox,
+			Scopes:       env.OAuth.Scopes,
+			CreatedAt:    time.Now().UTC(),
+			Developer:    req.Developer,
+			TestUsername: req.Username,
+			TestPassword: req.Password,
+			accessToken:  token.AccessToken,
+			expiresAt:    time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+		}
+		id, err := vault.Put(entry)
+		if err != nil {
+			log.Printf("Failed to store sandbox user: %v", err)
+			http.Error(w, "Failed to store sandbox user", http.StatusInternalServerError)
+			return
+		}
+		audit.Record("sandbox.user_added", map[string]string{"developer": req.Developer, "username": req.Username})
+		writeJSON(w, http.StatusCreated, newSandboxUser(id, entry))
+
+	case r.Method == "POST" && action == "token":
+		entry, ok := vault.Get(id)
+		if !ok || !isSandboxUser(entry) {
+			http.NotFound(w, r)
+			return
+		}
+		accessToken, entry, err := vaultAccessToken(r.Context(), vaultKeyPrefix+id)
+		if err != nil {
+			log.Printf("Failed to mint sandbox user token: %v", err)
+			http.Error(w, "The eBay sandbox rejected the stored refresh token", http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": accessToken,
+			"token_type":   "Bearer",
+			"expires_in":   int(time.Until(entry.expiresAt).Seconds()),
+			"api_key":      vaultKeyPrefix + id,
+		})
+
+	case r.Method == "DELETE" && id != "" && action == "":
+		entry, ok := vault.Get(id)
+		if !ok || !isSandboxUser(entry) {
+			http.NotFound(w, r)
+			return
+		}
+		if err := vault.Delete(id); err != nil {
+			http.Error(w, "Failed to delete sandbox user", http.StatusInternalServerError)
+			return
+		}
+		audit.Record("sandbox.user_removed", map[string]string{"developer": entry.Developer, "username": entry.TestUsername})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// runSandboxCommand implements `ebay-mcp sandbox list [developer]` and
+// `ebay-mcp sandbox token <developer> <username>` against a running proxy
+// (PROXY_URL, authenticated with PROXY_ADMIN_TOKEN). The token is printed
+// alone on stdout so scripts can capture it.
+func runSandboxCommand(args []string) error {
+	usage := errors.New("usage: ebay-mcp sandbox <list [developer] | token <developer> <username>>")
+	if len(args) == 0 {
+		return usage
+	}
+
+	var developer string
+	if len(args) > 1 {
+		developer = args[1]
+	}
+	var list struct {
+		Users []sandboxUser `json:"users"`
+	}
+	if err := adminRequest("GET", "/admin/sandbox-users?developer="+url.QueryEscape(developer), &list); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		for _, u := range list.Users {
+			fmt.Printf("%s\t%s\t%s\n", u.Developer, u.Username, u.APIKey)
+		}
+		return nil
+
+	case "token":
+		if len(args) != 3 {
+			return usage
+		}
+		for _, u := range list.Users {
+			if u.Username == args[2] {
+				var token struct {
+					AccessToken string `json:"access_token"`
+				}
+				if err := adminRequest("POST", "/admin/sandbox-users/"+u.ID+"/token", &token); err != nil {
+					return err
+				}
+				fmt.Println(token.AccessToken)
+				return nil
+			}
+		}
+		return fmt.Errorf("no sandbox user %q registered for developer %q", args[2], developer)
+
+	default:
+		return usage
+	}
+}
+
+// adminRequest calls an admin endpoint of the proxy at PROXY_URL and decodes
+// the JSON response into out.
+func adminRequest(method, path string, out interface{}) error {
+	baseURL := strings.TrimRight(envOr("PROXY_URL", "https://localhost"), "/")
+	req, err := http.NewRequest(method, baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("PROXY_ADMIN_TOKEN"))
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the proxy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
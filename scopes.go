@@ -0,0 +1,182 @@
+package ebaymcp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ### Scope Enforcement ######################################################
+
+// eBay answers calls made with a token lacking the right scope with an
+// opaque 403. When we know which scopes a token was granted (tokens issued
+// through /token, and vault entries) the proxy checks them against the
+// route's required scopes first and names the missing scope.
+
+// scopeBase is the common prefix of eBay OAuth scope URLs.
+const scopeBase = "https://api.ebay.com/oauth/api_scope"
+
+// defaultScopeMappings apply when the policy defines no scopes section.
+// Reads accept the read-only variant of a scope; writes need the full one.
+var defaultScopeMappings = append(
+	readWriteScopes("/sell/inventory/", "sell.inventory",
+		"/sell/fulfillment/", "sell.fulfillment",
+		"/sell/account/", "sell.account",
+		"/sell/marketing/", "sell.marketing",
+		"/sell/finances/", "sell.finances",
+		tradingAPIPath+"/", "sell.inventory"), // the Trading bridge: reads GET, writes POST
+	ScopeMapping{Prefix: "/sell/analytics/", Scopes: []string{scopeBase + "/sell.analytics.readonly"}},
+	ScopeMapping{Prefix: "/buy/deal/", Scopes: []string{scopeBase + "/buy.deal"}},
+	ScopeMapping{Prefix: "/buy/offer/", Scopes: []string{scopeBase + "/buy.offer.auction"}},
+	ScopeMapping{Prefix: "/buy/order/", Scopes: []string{scopeBase + "/buy.guest.order"}},
+	ScopeMapping{Prefix: "/commerce/identity/", Scopes: []string{scopeBase + "/commerce.identity.readonly"}},
+	ScopeMapping{Prefix: "/commerce/media/", Scopes: []string{scopeBase + "/sell.inventory"}},
+)
+
+// readWriteScopes builds mappings from (prefix, scope) pairs for API
+// families that have both a full and a ".readonly" scope.
+func readWriteScopes(pairs ...string) []ScopeMapping {
+	var mappings []ScopeMapping
+	for i := 0; i+1 < len(pairs); i += 2 {
+		full := scopeBase + "/" + pairs[i+1]
+		mappings = append(mappings,
+			ScopeMapping{Prefix: pairs[i], Methods: []string{http.MethodGet, http.MethodHead}, Scopes: []string{full, full + ".readonly"}},
+			ScopeMapping{Prefix: pairs[i], Scopes: []string{full}},
+		)
+	}
+	return mappings
+}
+
+// scopeMappings returns the mappings in effect.
+func (p *Policy) scopeMappings() []ScopeMapping {
+	if len(p.Scopes) > 0 {
+		return p.Scopes
+	}
+	return defaultScopeMappings
+}
+
+// RequiredScopes returns the scopes of which a token needs at least one to
+// call method on path, or nil if the route has no requirement. The most
+// specific prefix wins; a mapping restricted to the method beats one that
+// isn't at the same prefix.
+func (p *Policy) RequiredScopes(method, path string) []string {
+	mappings := p.scopeMappings()
+	var best *ScopeMapping
+	for i := range mappings {
+		m := &mappings[i]
+		if !strings.HasPrefix(path, m.Prefix) || !m.appliesTo(method) {
+			continue
+		}
+		if best == nil || len(m.Prefix) > len(best.Prefix) ||
+			(len(m.Prefix) == len(best.Prefix) && len(m.Methods) > 0 && len(best.Methods) == 0) {
+			best = m
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.Scopes
+}
+
+// appliesTo reports whether the mapping covers method.
+func (m *ScopeMapping) appliesTo(method string) bool {
+	if len(m.Methods) == 0 {
+		return true
+	}
+	for _, allowed := range m.Methods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+// checkScopes returns an error naming the required scopes if granted holds
+// none of them.
+func checkScopes(granted, required []string) error {
+	if len(required) == 0 {
+		return nil
+	}
+	for _, r := range required {
+		for _, g := range granted {
+			if g == r {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("missing scope %s", strings.Join(required, " or "))
+}
+
+// scopeError is the error of a call the caller's token has no scope for.
+type scopeError struct {
+	method, path string
+	required     []string
+}
+
+func (e *scopeError) Error() string {
+	return fmt.Sprintf("%s %s: missing scope %s", e.method, e.path, strings.Join(e.required, " or "))
+}
+
+// writeInsufficientScope sends an RFC 6750 insufficient_scope error.
+func writeInsufficientScope(w http.ResponseWriter, loc localizer, method, path string, required []string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(required, " ")))
+	loc.setContentLanguage(w)
+	writeJSON(w, http.StatusForbidden, map[string]interface{}{
+		"error":          "insufficient_scope",
+		"required_scope": required,
+		"message":        loc.T("scope.insufficient", method, path, strings.Join(required, ", ")),
+	})
+}
+
+// ### Backend Token Scopes ###
+
+// Tokens of the backend carry the scopes their user consented to, and the
+// proxy and the tools check those too: the linked account's scopes say what
+// eBay allows, the token's what the client may do with it. The backend's
+// scopes name eBay's in full or without scopeBase ("sell.inventory").
+// Linking an eBay account through /token/exchange needs linkAccountScope.
+
+// linkAccountScope lets a backend token link an eBay account to its user.
+const linkAccountScope = "link_account"
+
+// backendScopes returns the eBay scopes granted to a backend token.
+func backendScopes(id *backendToken) []string {
+	scopes := []string{}
+	for _, s := range strings.Fields(id.Scope) {
+		if !strings.Contains(s, "://") {
+			s = scopeBase + "/" + s
+		}
+		scopes = append(scopes, s)
+	}
+	return scopes
+}
+
+// hasScope reports whether a backend token was granted scope.
+func (t *backendToken) hasScope(scope string) bool {
+	for _, s := range strings.Fields(t.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// scopedTransport refuses calls its scopes don't cover before they reach
+// eBay.
+type scopedTransport struct {
+	base   http.RoundTripper
+	scopes [][]string // each set must cover the call
+}
+
+func (t *scopedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	required := currentPolicy().RequiredScopes(req.Method, req.URL.Path)
+	for _, granted := range t.scopes {
+		if checkScopes(granted, required) != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, &scopeError{method: req.Method, path: req.URL.Path, required: required}
+		}
+	}
+	return t.base.RoundTrip(req)
+}
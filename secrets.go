@@ -0,0 +1,99 @@
+package ebaymcp
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/secrets"
+)
+
+// ### Secrets ################################################################
+
+// The eBay client secrets, VAULT_KEY, PROXY_ADMIN_TOKEN and the other
+// secrets can come from a secret manager instead of the environment.
+// SECRETS_BACKEND picks it:
+//
+//	env    the environment itself (default)
+//	file   one file per secret in SECRETS_DIR, e.g. Docker/Kubernetes secrets
+//	vault  a HashiCorp Vault KV v2 secret (SECRETS_VAULT_*)
+//	aws    an AWS Secrets Manager secret holding a JSON object
+//	gcp    Google Cloud Secret Manager, one secret per name
+//
+// The providers live in internal/secrets, shared with the account backend,
+// and use the official SDKs with their default credential chains.
+//
+// At startup the secrets are copied into the environment, where the rest of
+// the proxy reads them as usual. With SECRETS_REFRESH_INTERVAL they are
+// re-read and rotated values picked up: the eBay client secrets and the
+// secrets read per request apply at once, the others log that a restart is
+// needed. The account backend has the same settings for its own secrets.
+
+// secretNames are the secrets asked of the provider, plus SECRETS_NAMES.
+var secretNames = []string{
+	"EBAY_CLIENT_SECRET",
+	"EBAY_SANDBOX_CLIENT_SECRET",
+	"EBAY_PRODUCTION_CLIENT_SECRET",
+	"VAULT_KEY",
+	"PROXY_ADMIN_TOKEN",
+	"PROXY_API_KEY",
+	"INTERNAL_SIGNING_SECRETS",
+	"FEATURE_FLAGS_TOKEN",
+	"ATTACHMENT_SIGNING_KEY",
+	"OAUTH_STATE_KEY",
+	"EBAY_DELETION_VERIFICATION_TOKEN",
+	"EBAY_WEBHOOK_VERIFICATION_TOKEN",
+}
+
+// liveSecrets are read from the environment on every use, so a rotated
+// value applies as soon as it is copied there.
+var liveSecrets = map[string]bool{
+	"PROXY_ADMIN_TOKEN":                true,
+	"EBAY_DELETION_VERIFICATION_TOKEN": true,
+	"EBAY_WEBHOOK_VERIFICATION_TOKEN":  true,
+}
+
+func allSecretNames() []string {
+	return append(append([]string(nil), secretNames...), splitList(os.Getenv("SECRETS_NAMES"))...)
+}
+
+// loadSecretsFromEnv reads the secrets from SECRETS_BACKEND into the
+// environment and returns the provider with the values it had.
+func loadSecretsFromEnv() (secrets.Provider, map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	p, err := secrets.FromEnv(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	loaded, err := secrets.Load(ctx, p, allSecretNames())
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, loaded, nil
+}
+
+// watchSecrets re-reads the secrets every interval, until ctx is done, and
+// applies the ones that changed since seen, which starts as the values
+// loadSecretsFromEnv returned.
+func watchSecrets(ctx context.Context, p secrets.Provider, interval time.Duration, seen map[string]string) {
+	secrets.Watch(ctx, p, allSecretNames, interval, seen, applyRotatedSecret)
+}
+
+// applyRotatedSecret puts a changed secret to use where that is possible
+// without a restart.
+func applyRotatedSecret(name, value string) {
+	if liveSecrets[name] {
+		log.Printf("Picked up rotated %s", name)
+		return
+	}
+	for _, env := range allEnvironments() {
+		if name == env.secretName() {
+			env.setClientSecret(value)
+			log.Printf("Picked up rotated %s for the %s environment", name, env.key())
+			return
+		}
+	}
+	log.Printf("Secret %s changed; restart to use the new value", name)
+}
@@ -0,0 +1,381 @@
+package ebaymcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ayouroukov/ebay-mcp/internal/ebay"
+)
+
+// ### Seller Setup ###########################################################
+
+// Offers can't be published before the seller has a fulfillment, a payment
+// and a return policy on the marketplace, and business policies need the
+// SELLING_POLICY_MANAGEMENT program. The setupSellerAccount tool (POST
+// /seller/setup) walks a first-time seller through that in one call:
+//
+//  1. getPrivileges: the account must be registered for selling;
+//  2. getOptedInPrograms, and optInToProgram SELLING_POLICY_MANAGEMENT
+//     unless the seller joined it;
+//  3. for each kind of policy, the seller's default one, or else a new one
+//     built from the request (free shipping with handling in a day and
+//     30-day returns the buyer pays for by default).
+//
+// It returns each step and the listingPolicies to put in createOffer. With
+// "dry_run": true it only reports what it would create.
+
+const (
+	sellerSetupPath         = "/seller/setup"
+	sellingPolicyManagement = "SELLING_POLICY_MANAGEMENT"
+	allCategoryTypes        = "ALL_EXCLUDING_MOTORS_VEHICLES"
+)
+
+// marketplaceCurrencies are the currencies of the marketplaces in
+// marketplaceLanguages.
+var marketplaceCurrencies = map[string]string{
+	"EBAY_US": "USD", "EBAY_MOTORS_US": "USD", "EBAY_CA": "CAD", "EBAY_GB": "GBP",
+	"EBAY_IE": "EUR", "EBAY_AU": "AUD", "EBAY_DE": "EUR", "EBAY_AT": "EUR",
+	"EBAY_CH": "CHF", "EBAY_FR": "EUR", "EBAY_BE": "EUR", "EBAY_IT": "EUR",
+	"EBAY_ES": "EUR", "EBAY_NL": "EUR", "EBAY_PL": "PLN", "EBAY_HK": "HKD",
+	"EBAY_SG": "SGD", "EBAY_MY": "MYR", "EBAY_PH": "PHP",
+}
+
+// defaultShippingServices are the domestic shipping services a new
+// fulfillment policy uses unless the request names one. Other marketplaces
+// need shipping_service.
+var defaultShippingServices = map[string]string{
+	"EBAY_US":        "USPSPriority",
+	"EBAY_MOTORS_US": "USPSPriority",
+	"EBAY_CA":        "CA_PostRegularParcel",
+	"EBAY_GB":        "UK_RoyalMailSecondClassStandard",
+	"EBAY_AU":        "AU_Regular",
+	"EBAY_DE":        "DE_DHLPaket",
+}
+
+// sellerSetupRequest is the body of setupSellerAccount. Every field is
+// optional.
+type sellerSetupRequest struct {
+	HandlingTimeDays     int          `json:"handling_time_days"`      // default 1
+	ShippingService      string       `json:"shipping_service"`        // eBay shipping service code
+	ShippingCost         *ebay.Amount `json:"shipping_cost"`           // free shipping when empty
+	ReturnsAccepted      *bool        `json:"returns_accepted"`        // default true
+	ReturnDays           int          `json:"return_days"`             // 30 (default) or 60
+	ReturnShippingPaidBy string       `json:"return_shipping_paid_by"` // BUYER (default) or SELLER
+	DryRun               bool         `json:"dry_run"`
+}
+
+// workflowStep is one step of a tool that makes several calls, such as
+// setupSellerAccount.
+type workflowStep struct {
+	Step   string     `json:"step"`
+	Status string     `json:"status"` // done, existing, created, planned, pending or failed
+	ID     string     `json:"id,omitempty"`
+	Name   string     `json:"name,omitempty"`
+	Error  string     `json:"error,omitempty"`
+	Hint   *errorHint `json:"hint,omitempty"`
+}
+
+// handleSellerSetup (setupSellerAccount) prepares the caller's account for
+// publishing offers.
+// POST /seller/setup
+func handleSellerSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req sellerSetupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Body must be JSON", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	policy := currentPolicy()
+	for _, call := range [][2]string{
+		{http.MethodGet, "/sell/account/v1/privilege"},
+		{http.MethodGet, "/sell/account/v1/program/get_opted_in_programs"},
+		{http.MethodPost, "/sell/account/v1/program/opt_in"},
+		{http.MethodGet, "/sell/account/v1/fulfillment_policy"},
+		{http.MethodPost, "/sell/account/v1/fulfillment_policy"},
+		{http.MethodGet, "/sell/account/v1/payment_policy"},
+		{http.MethodPost, "/sell/account/v1/payment_policy"},
+		{http.MethodGet, "/sell/account/v1/return_policy"},
+		{http.MethodPost, "/sell/account/v1/return_policy"},
+	} {
+		if err := policy.AllowPath(call[0], call[1]); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	caller, status, err := resolveCaller(w, r)
+	if err != nil {
+		log.Printf("Failed to resolve token for seller setup: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	client := caller.client()
+	ctx := r.Context()
+	loc := localizerFor(r, caller.language, caller.marketplace)
+
+	// The first call also tells whether eBay is reachable at all: its
+	// errors answer the request, later ones only fail their step.
+	privileges, err := client.GetPrivileges(ctx)
+	if err != nil {
+		log.Printf("Seller setup failed to get privileges: %v", err)
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	marketplace := client.Marketplace
+	if marketplace == "" {
+		marketplace = defaultMarketplace
+	}
+	resp := map[string]interface{}{"marketplace_id": marketplace, "dry_run": req.DryRun}
+	if !privileges.SellerRegistrationCompleted {
+		hint, _ := hintFor(loc, http.StatusBadRequest, ebay.ErrorDetail{ErrorID: 25018})
+		resp["steps"] = []workflowStep{{Step: "check_privileges", Status: "failed", Hint: hint,
+			Error: "The account has not completed its seller registration"}}
+		resp["complete"] = false
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	steps := []workflowStep{{Step: "check_privileges", Status: "done"}}
+	failed := func(step string, err error) workflowStep {
+		s := workflowStep{Step: step, Status: "failed", Error: err.Error()}
+		var apiErr *ebay.Error
+		if errors.As(err, &apiErr) && len(apiErr.Errors) > 0 {
+			s.Error = apiErr.Errors[0].Message
+			s.Hint, _ = hintFor(loc, apiErr.StatusCode, apiErr.Errors[0])
+		}
+		return s
+	}
+
+	programs, err := client.GetOptedInPrograms(ctx)
+	switch {
+	case err != nil:
+		steps = append(steps, failed("opt_in_business_policies", err))
+	case hasProgram(programs, sellingPolicyManagement):
+		steps = append(steps, workflowStep{Step: "opt_in_business_policies", Status: "existing", Name: sellingPolicyManagement})
+	case req.DryRun:
+		steps = append(steps, workflowStep{Step: "opt_in_business_policies", Status: "planned", Name: sellingPolicyManagement})
+	default:
+		if err := client.OptInToProgram(ctx, sellingPolicyManagement); err != nil {
+			steps = append(steps, failed("opt_in_business_policies", err))
+		} else {
+			// eBay opts in asynchronously; creating policies may fail
+			// until it has.
+			steps = append(steps, workflowStep{Step: "opt_in_business_policies", Status: "pending", Name: sellingPolicyManagement})
+			caller.wrote(ctx)
+		}
+	}
+
+	listingPolicies := map[string]string{}
+	setUp := func(step, field string, existing func() (string, string, error), create func() (string, string, error)) {
+		id, name, err := existing()
+		switch {
+		case err != nil:
+			steps = append(steps, failed(step, err))
+			return
+		case id != "":
+			steps = append(steps, workflowStep{Step: step, Status: "existing", ID: id, Name: name})
+			listingPolicies[field] = id
+			return
+		case req.DryRun:
+			if _, name, err = create(); err != nil {
+				steps = append(steps, failed(step, err))
+			} else {
+				steps = append(steps, workflowStep{Step: step, Status: "planned", Name: name})
+			}
+			return
+		}
+		id, name, err = create()
+		if err != nil {
+			steps = append(steps, failed(step, err))
+			return
+		}
+		audit.Record("seller.policy_created", map[string]string{
+			"step":        step,
+			"policy_id":   id,
+			"marketplace": marketplace,
+			"token_hash":  tokenHash(caller.bearer),
+		})
+		caller.wrote(ctx)
+		steps = append(steps, workflowStep{Step: step, Status: "created", ID: id, Name: name})
+		listingPolicies[field] = id
+	}
+
+	setUp("fulfillment_policy", "fulfillmentPolicyId", func() (string, string, error) {
+		policies, err := client.GetFulfillmentPolicies(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		if i := preferredPolicy(len(policies), func(i int) []ebay.CategoryType { return policies[i].CategoryTypes }); i >= 0 {
+			return policies[i].FulfillmentPolicyID, policies[i].Name, nil
+		}
+		return "", "", nil
+	}, func() (string, string, error) {
+		p, err := req.fulfillmentPolicy(marketplace)
+		if err != nil || req.DryRun {
+			return "", p.Name, err
+		}
+		id, err := client.CreateFulfillmentPolicy(ctx, p)
+		return id, p.Name, err
+	})
+	setUp("payment_policy", "paymentPolicyId", func() (string, string, error) {
+		policies, err := client.GetPaymentPolicies(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		if i := preferredPolicy(len(policies), func(i int) []ebay.CategoryType { return policies[i].CategoryTypes }); i >= 0 {
+			return policies[i].PaymentPolicyID, policies[i].Name, nil
+		}
+		return "", "", nil
+	}, func() (string, string, error) {
+		p := req.paymentPolicy(marketplace)
+		if req.DryRun {
+			return "", p.Name, nil
+		}
+		id, err := client.CreatePaymentPolicy(ctx, p)
+		return id, p.Name, err
+	})
+	setUp("return_policy", "returnPolicyId", func() (string, string, error) {
+		policies, err := client.GetReturnPolicies(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		if i := preferredPolicy(len(policies), func(i int) []ebay.CategoryType { return policies[i].CategoryTypes }); i >= 0 {
+			return policies[i].ReturnPolicyID, policies[i].Name, nil
+		}
+		return "", "", nil
+	}, func() (string, string, error) {
+		p := req.returnPolicy(marketplace)
+		if req.DryRun {
+			return "", p.Name, nil
+		}
+		id, err := client.CreateReturnPolicy(ctx, p)
+		return id, p.Name, err
+	})
+
+	resp["steps"] = steps
+	resp["listing_policies"] = listingPolicies
+	resp["complete"] = len(listingPolicies) == 3
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// validate checks req and fills in its defaults.
+func (req *sellerSetupRequest) validate() error {
+	if req.HandlingTimeDays == 0 {
+		req.HandlingTimeDays = 1
+	}
+	if req.HandlingTimeDays < 0 || req.HandlingTimeDays > 30 {
+		return errors.New("handling_time_days must be between 1 and 30")
+	}
+	if req.ReturnsAccepted == nil {
+		accepted := true
+		req.ReturnsAccepted = &accepted
+	}
+	if req.ReturnDays == 0 {
+		req.ReturnDays = 30
+	}
+	if req.ReturnDays != 30 && req.ReturnDays != 60 {
+		return errors.New("return_days must be 30 or 60")
+	}
+	req.ReturnShippingPaidBy = strings.ToUpper(req.ReturnShippingPaidBy)
+	if req.ReturnShippingPaidBy == "" {
+		req.ReturnShippingPaidBy = "BUYER"
+	}
+	if req.ReturnShippingPaidBy != "BUYER" && req.ReturnShippingPaidBy != "SELLER" {
+		return errors.New("return_shipping_paid_by must be BUYER or SELLER")
+	}
+	return nil
+}
+
+// fulfillmentPolicy is the fulfillment policy req creates on marketplace.
+func (req *sellerSetupRequest) fulfillmentPolicy(marketplace string) (*ebay.FulfillmentPolicy, error) {
+	service := req.ShippingService
+	if service == "" {
+		service = defaultShippingServices[marketplace]
+	}
+	if service == "" {
+		return &ebay.FulfillmentPolicy{}, fmt.Errorf("shipping_service is required on %s", marketplace)
+	}
+	shipping := ebay.ShippingService{ShippingServiceCode: service, ShippingCost: req.ShippingCost, SortOrder: 1}
+	name := "Standard shipping"
+	if shipping.ShippingCost == nil {
+		shipping.FreeShipping = true
+		shipping.ShippingCost = &ebay.Amount{Value: "0.0", Currency: marketplaceCurrencies[marketplace]}
+		name = "Free shipping"
+	}
+	return &ebay.FulfillmentPolicy{
+		Name:          name,
+		MarketplaceID: marketplace,
+		CategoryTypes: []ebay.CategoryType{{Name: allCategoryTypes}},
+		HandlingTime:  &ebay.TimeDuration{Value: req.HandlingTimeDays, Unit: "DAY"},
+		ShippingOptions: []ebay.ShippingOption{{
+			CostType:         "FLAT_RATE",
+			OptionType:       "DOMESTIC",
+			ShippingServices: []ebay.ShippingService{shipping},
+		}},
+	}, nil
+}
+
+// paymentPolicy is the payment policy req creates on marketplace: eBay
+// handles payments, so it only asks for immediate payment.
+func (req *sellerSetupRequest) paymentPolicy(marketplace string) *ebay.PaymentPolicy {
+	return &ebay.PaymentPolicy{
+		Name:          "Immediate payment",
+		MarketplaceID: marketplace,
+		CategoryTypes: []ebay.CategoryType{{Name: allCategoryTypes}},
+		ImmediatePay:  true,
+	}
+}
+
+// returnPolicy is the return policy req creates on marketplace.
+func (req *sellerSetupRequest) returnPolicy(marketplace string) *ebay.ReturnPolicy {
+	p := &ebay.ReturnPolicy{
+		Name:            "No returns",
+		MarketplaceID:   marketplace,
+		CategoryTypes:   []ebay.CategoryType{{Name: allCategoryTypes}},
+		ReturnsAccepted: *req.ReturnsAccepted,
+	}
+	if p.ReturnsAccepted {
+		p.Name = fmt.Sprintf("%d-day returns", req.ReturnDays)
+		p.ReturnPeriod = &ebay.TimeDuration{Value: req.ReturnDays, Unit: "DAY"}
+		p.ReturnShippingCostPayer = req.ReturnShippingPaidBy
+		p.RefundMethod = "MONEY_BACK"
+	}
+	return p
+}
+
+// preferredPolicy returns the index of the policy to reuse of n: the
+// default one for all categories, or else the first. It is -1 when n is 0.
+func preferredPolicy(n int, categoryTypes func(i int) []ebay.CategoryType) int {
+	for i := 0; i < n; i++ {
+		for _, ct := range categoryTypes(i) {
+			if ct.Default && ct.Name == allCategoryTypes {
+				return i
+			}
+		}
+	}
+	if n == 0 {
+		return -1
+	}
+	return 0
+}
+
+// hasProgram reports whether programs includes programType.
+func hasProgram(programs []ebay.Program, programType string) bool {
+	for _, p := range programs {
+		if p.ProgramType == programType {
+			return true
+		}
+	}
+	return false
+}
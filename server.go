@@ -0,0 +1,206 @@
+package ebaymcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ### Server Lifecycle #######################################################
+
+// TLS modes selectable with TLS_MODE.
+const (
+	tlsModeFiles    = "files"    // SSL_CERTFILE / SSL_KEYFILE (default)
+	tlsModeAutocert = "autocert" // Let's Encrypt via ACME HTTP-01
+	tlsModeOff      = "off"      // Plain HTTP behind a TLS-terminating reverse proxy
+)
+
+// tlsModeFromEnv returns TLS_MODE, "files" by default, after checking that
+// the settings the mode needs are set.
+func tlsModeFromEnv() (string, error) {
+	tlsMode := envOr("TLS_MODE", tlsModeFiles)
+	switch tlsMode {
+	case tlsModeFiles:
+		if os.Getenv("SSL_CERTFILE") == "" || os.Getenv("SSL_KEYFILE") == "" {
+			return "", errors.New("missing SSL certificate configuration. \n" +
+				"Please set: SSL_CERTFILE, SSL_KEYFILE (or TLS_MODE=autocert)")
+		}
+	case tlsModeAutocert:
+		if len(autocertDomains()) == 0 {
+			return "", errors.New("TLS_MODE=autocert requires AUTOCERT_DOMAINS")
+		}
+	case tlsModeOff:
+	default:
+		return "", fmt.Errorf("unknown TLS_MODE %q (expected %q, %q or %q)", tlsMode, tlsModeFiles, tlsModeAutocert, tlsModeOff)
+	}
+	return tlsMode, nil
+}
+
+// defaultShutdownTimeout bounds how long we wait for in-flight proxied
+// requests to drain after SIGTERM/SIGINT before forcibly closing them.
+const defaultShutdownTimeout = 30 * time.Second
+
+// serve runs the server until it receives SIGINT or SIGTERM, then gracefully
+// shuts it down: the listener is closed immediately so no new connections are
+// accepted, and in-flight requests (including long eBay proxy calls) are
+// given SHUTDOWN_TIMEOUT to complete.
+//
+// When useTLS is false the server speaks plain HTTP, for deployments where
+// nginx, Caddy or Cloudflare terminates TLS in front of the proxy.
+func serve(server *http.Server, useTLS bool, certFile, keyFile string) error {
+	ln, err := listen(server.Addr)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if useTLS {
+			serveErr <- server.ServeTLS(ln, certFile, keyFile)
+		} else {
+			serveErr <- server.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		// The server stopped on its own (e.g. bad certificate); nothing to drain.
+		return err
+	case <-ctx.Done():
+	}
+
+	// Restore default signal behaviour so a second Ctrl+C kills us immediately.
+	stop()
+
+	timeout := shutdownTimeout()
+	log.Printf("Shutdown signal received, draining in-flight requests (timeout %v)...", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Graceful shutdown did not complete: %v", err)
+		server.Close()
+		return err
+	}
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	log.Println("Server shut down cleanly")
+	return nil
+}
+
+// listen returns the listener the server should accept connections on.
+// When started under systemd socket activation (LISTEN_PID/LISTEN_FDS), the
+// already-bound socket passed as fd 3 is reused. This lets a new process be
+// started on the same socket before the old one exits, giving zero-downtime
+// restarts without needing SO_REUSEPORT.
+func listen(addr string) (net.Listener, error) {
+	if ln, err := systemdListener(); ln != nil || err != nil {
+		if ln != nil {
+			log.Printf("Using systemd socket-activated listener on %s", ln.Addr())
+		}
+		return ln, err
+	}
+	return net.Listen("tcp", addr)
+}
+
+// systemdListener returns the first socket passed by systemd, or nil if the
+// process was not socket-activated.
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+
+	// Don't let child processes think the sockets were meant for them.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	// systemd passes sockets starting at fd 3 (SD_LISTEN_FDS_START).
+	f := os.NewFile(3, "systemd-listener")
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use systemd socket: %w", err)
+	}
+	return ln, nil
+}
+
+// shutdownTimeout reads SHUTDOWN_TIMEOUT (a Go duration such as "45s"),
+// falling back to defaultShutdownTimeout.
+func shutdownTimeout() time.Duration {
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Ignoring invalid SHUTDOWN_TIMEOUT %q", v)
+	}
+	return defaultShutdownTimeout
+}
+
+// ### Reverse Proxy Awareness ################################################
+
+// trustForwardedHeaders reports whether X-Forwarded-* headers should be
+// believed. Only enable TRUST_FORWARDED_HEADERS when the proxy is reachable
+// exclusively through a reverse proxy that overwrites these headers;
+// otherwise clients could spoof their address.
+func trustForwardedHeaders() bool {
+	return os.Getenv("TRUST_FORWARDED_HEADERS") == "true"
+}
+
+// clientIP returns the originating client address for logging, preferring
+// the first X-Forwarded-For hop when forwarded headers are trusted.
+func clientIP(r *http.Request) string {
+	if trustForwardedHeaders() {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	return r.RemoteAddr
+}
+
+// externalBaseURL returns the scheme and host clients used to reach us,
+// e.g. "https://ebayai.dev", honoring X-Forwarded-Proto/X-Forwarded-Host
+// when forwarded headers are trusted, plus the /t/<tenant> prefix the
+// request was addressed with.
+func externalBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	if trustForwardedHeaders() {
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if fwdHost := r.Header.Get("X-Forwarded-Host"); fwdHost != "" {
+			host = fwdHost
+		}
+	}
+
+	return scheme + "://" + host + mountPrefix + tenantPrefix(r)
+}
@@ -0,0 +1,302 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ### Digital Signatures ####################################################
+
+// Some eBay APIs (Finances, issueRefund, and several EU/UK flows) reject
+// calls that aren't signed with an eBay-provisioned key as described in
+// RFC 9421 (HTTP Message Signatures). The proxy creates a signing key per
+// environment through the Key Management API, persists it, and signs the
+// routes listed in signedRoutes.
+
+// signingScope is the client-credentials scope the Key Management API needs.
+const signingScope = "https://api.ebay.com/oauth/api_scope"
+
+// signedRoutes are path templates (as in operationTemplates) or, when they
+// end in "/", prefixes.
+var signedRoutes = []string{
+	"/sell/finances/",
+	"/sell/fulfillment/v1/order/{order_id}/issue_refund",
+	"/post-order/v2/return/{return_id}/issue_refund",
+	"/post-order/v2/cancellation/{cancel_id}/approve",
+	"/post-order/v2/cancellation/{cancel_id}/reject",
+}
+
+// requiresSignature reports whether calls to path must be signed.
+func requiresSignature(path string) bool {
+	for _, route := range signedRoutes {
+		if strings.HasSuffix(route, "/") {
+			if strings.HasPrefix(path, route) {
+				return true
+			}
+		} else if matchTemplate(splitPath(route), splitPath(path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// apizHost returns the "apiz" host variant used by the Finances and Key
+// Management APIs, e.g. api.sandbox.ebay.com -> apiz.sandbox.ebay.com.
+func apizHost(apiHost string) string {
+	if strings.HasPrefix(apiHost, "api.") {
+		return "apiz." + strings.TrimPrefix(apiHost, "api.")
+	}
+	return apiHost
+}
+
+// apimHost returns the "apim" host variant used by the Media API, e.g.
+// api.sandbox.ebay.com -> apim.sandbox.ebay.com.
+func apimHost(apiHost string) string {
+	if strings.HasPrefix(apiHost, "api.") {
+		return "apim." + strings.TrimPrefix(apiHost, "api.")
+	}
+	return apiHost
+}
+
+// apiHostFor returns the host serving path in env.
+func apiHostFor(env *ebayEnvironment, path string) string {
+	if strings.HasPrefix(path, "/sell/finances/") {
+		return apizHost(env.APIHost)
+	}
+	if strings.HasPrefix(path, "/commerce/media/") {
+		return apimHost(env.APIHost)
+	}
+	return env.APIHost
+}
+
+// signingKey is a key as returned by the Key Management API. PrivateKey is
+// the base64 PKCS#8 DER key; JWE is sent verbatim as x-ebay-signature-key.
+type signingKey struct {
+	ID         string `json:"signingKeyId"`
+	PrivateKey string `json:"privateKey"`
+	JWE        string `json:"jwe"`
+
+	private ed25519.PrivateKey
+}
+
+// signingKeyStore keeps one signing key per environment, persisted as JSON in
+// EBAY_SIGNING_KEY_FILE (the file holds private keys, so it is written 0600).
+type signingKeyStore struct {
+	path string
+	mu   sync.Mutex
+	keys map[string]*signingKey
+}
+
+// signingKeys is the process-wide key store.
+var signingKeys = &signingKeyStore{keys: make(map[string]*signingKey)}
+
+// loadSigningKeys reads the key file if it exists.
+func loadSigningKeys(path string) (*signingKeyStore, error) {
+	store := &signingKeyStore{path: path, keys: make(map[string]*signingKey)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing keys: %w", err)
+	}
+	if err := json.Unmarshal(data, &store.keys); err != nil {
+		return nil, fmt.Errorf("failed to parse signing keys %s: %w", path, err)
+	}
+	for envName, key := range store.keys {
+		if err := key.parse(); err != nil {
+			return nil, fmt.Errorf("signing key for %s: %w", envName, err)
+		}
+	}
+	return store, nil
+}
+
+// parse decodes the private key. Both raw base64 DER and PEM are accepted.
+func (k *signingKey) parse() error {
+	der := []byte(k.PrivateKey)
+	if block, _ := pem.Decode(der); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(k.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("private key is not base64: %w", err)
+		}
+		der = decoded
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return fmt.Errorf("failed to parse private key: %w", err)
+	}
+	private, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return fmt.Errorf("signing key %s is not an Ed25519 key", k.ID)
+	}
+	k.private = private
+	return nil
+}
+
+// Key returns the signing key for env, creating one through the Key
+// Management API the first time it's needed.
+func (s *signingKeyStore) Key(ctx context.Context, env *ebayEnvironment) (*signingKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key := s.keys[env.key()]; key != nil {
+		return key, nil
+	}
+
+	key, err := createSigningKey(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Created eBay signing key %s for %s", key.ID, env.key())
+
+	s.keys[env.key()] = key
+	if s.path != "" {
+		data, err := json.MarshalIndent(s.keys, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(s.path, data); err != nil {
+			return nil, fmt.Errorf("failed to save signing keys: %w", err)
+		}
+	}
+	return key, nil
+}
+
+// createSigningKey provisions a new Ed25519 key for env.
+func createSigningKey(ctx context.Context, env *ebayEnvironment) (*signingKey, error) {
+	appToken, err := applicationToken(ctx, env, signingScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get application token: %w", err)
+	}
+
+	endpoint := "https://" + apizHost(env.APIHost) + "/developer/key_management/v1/signing_key"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(`{"signingKeyCipher":"ED25519"}`))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+appToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Key Management API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("Key Management API returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var key signingKey
+	if err := json.Unmarshal(body, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	if err := key.parse(); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// applicationToken returns a client-credentials (application) access token,
+// minting one unless a cached one is still fresh.
+func applicationToken(ctx context.Context, env *ebayEnvironment, scope string) (string, error) {
+	cacheKey := env.key() + "\n" + scope
+	if data, ok := tokenCache.Get(ctx, "application", cacheKey); ok {
+		var cached cachedAccessToken
+		if json.Unmarshal(data, &cached) == nil && time.Until(cached.ExpiresAt) > accessTokenRefreshMargin {
+			return cached.AccessToken, nil
+		}
+	}
+
+	formData := url.Values{}
+	formData.Set("grant_type", "client_credentials")
+	formData.Set("scope", scope)
+
+	resp, body, err := postTokenRequest(ctx, env, formData)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("eBay rejected the client credentials (status %d): %s", resp.StatusCode, body)
+	}
+
+	var token ebayTokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("failed to parse eBay token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("eBay token response did not contain an access token")
+	}
+
+	expiresAt := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	data, _ := json.Marshal(cachedAccessToken{AccessToken: token.AccessToken, ExpiresAt: expiresAt})
+	tokenCache.Set(ctx, "application", cacheKey, data, time.Until(expiresAt)-accessTokenRefreshMargin)
+	return token.AccessToken, nil
+}
+
+// signRequest adds x-ebay-signature-key, Content-Digest (when there is a
+// body), Signature-Input and Signature to req. req.URL and req.Host must
+// already point at eBay.
+func signRequest(req *http.Request, key *signingKey, body []byte, now time.Time) {
+	req.Header.Set("x-ebay-signature-key", key.JWE)
+
+	components := []string{"x-ebay-signature-key", "@method", "@path", "@authority"}
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		components = append([]string{"content-digest"}, components...)
+	}
+
+	quoted := make([]string, len(components))
+	for i, c := range components {
+		quoted[i] = strconv.Quote(c)
+	}
+	params := "(" + strings.Join(quoted, " ") + ");created=" + strconv.FormatInt(now.Unix(), 10)
+
+	// Signature base (RFC 9421 section 2.5)
+	var base bytes.Buffer
+	for _, c := range components {
+		var value string
+		switch c {
+		case "@method":
+			value = req.Method
+		case "@path":
+			value = req.URL.EscapedPath()
+		case "@authority":
+			value = strings.ToLower(req.Host)
+		default:
+			value = req.Header.Get(c)
+		}
+		fmt.Fprintf(&base, "%q: %s\n", c, value)
+	}
+	fmt.Fprintf(&base, "%q: %s", "@signature-params", params)
+
+	signature := ed25519.Sign(key.private, base.Bytes())
+	req.Header.Set("Signature-Input", "sig1="+params)
+	req.Header.Set("Signature", "sig1=:"+base64.StdEncoding.EncodeToString(signature)+":")
+}
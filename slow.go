@@ -0,0 +1,180 @@
+package ebaymcp
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ### Slow Request Detection #################################################
+
+// Defaults for SLOW_REQUEST_THRESHOLD and LARGE_RESPONSE_BYTES.
+const (
+	defaultSlowRequestThreshold = 5 * time.Second
+	defaultLargeResponseBytes   = 1 << 20 // 1 MiB, already a lot of LLM context
+)
+
+// slowWindow is how far back the "slowest operations" report looks, and
+// slowLogSize bounds how many recent observations are kept for it.
+const (
+	slowWindow  = time.Hour
+	slowLogSize = 2048
+)
+
+// observation is one completed proxy call.
+type observation struct {
+	operation string
+	elapsed   time.Duration
+	bytes     int64
+	at        time.Time
+}
+
+// slowTracker flags proxy calls that exceed the latency or size thresholds
+// and keeps a ring buffer of recent calls for the slowest-operations report.
+type slowTracker struct {
+	latencyThreshold time.Duration
+	sizeThreshold    int64
+
+	mu     sync.Mutex
+	recent []observation
+	next   int
+}
+
+// slowRequests is the process-wide tracker, configured in main.
+var slowRequests = newSlowTracker(defaultSlowRequestThreshold, defaultLargeResponseBytes)
+
+func newSlowTracker(latency time.Duration, size int64) *slowTracker {
+	return &slowTracker{
+		latencyThreshold: latency,
+		sizeThreshold:    size,
+		recent:           make([]observation, 0, slowLogSize),
+	}
+}
+
+// slowTrackerFromEnv builds a tracker from SLOW_REQUEST_THRESHOLD (a Go
+// duration) and LARGE_RESPONSE_BYTES.
+func slowTrackerFromEnv() *slowTracker {
+	latency := defaultSlowRequestThreshold
+	if v := os.Getenv("SLOW_REQUEST_THRESHOLD"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			latency = d
+		} else {
+			log.Printf("Ignoring invalid SLOW_REQUEST_THRESHOLD %q", v)
+		}
+	}
+
+	var size int64 = defaultLargeResponseBytes
+	if v := os.Getenv("LARGE_RESPONSE_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			size = n
+		} else {
+			log.Printf("Ignoring invalid LARGE_RESPONSE_BYTES %q", v)
+		}
+	}
+
+	return newSlowTracker(latency, size)
+}
+
+// Observe records a completed call, logging a warning and counting it in the
+// metrics when it was slow or its response was large.
+func (t *slowTracker) Observe(operation string, elapsed time.Duration, bytes int64) {
+	if elapsed >= t.latencyThreshold {
+		log.Printf("WARNING: slow eBay call: %s took %v (threshold %v)", operation, elapsed, t.latencyThreshold)
+		metrics.IncSlow(operation)
+	}
+	if bytes >= t.sizeThreshold {
+		log.Printf("WARNING: large eBay response: %s returned %d bytes (threshold %d)", operation, bytes, t.sizeThreshold)
+		metrics.IncLarge(operation)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	obs := observation{operation: operation, elapsed: elapsed, bytes: bytes, at: time.Now()}
+	if len(t.recent) < slowLogSize {
+		t.recent = append(t.recent, obs)
+	} else {
+		t.recent[t.next] = obs
+	}
+	t.next = (t.next + 1) % slowLogSize
+}
+
+// operationReport summarizes one operation's recent calls.
+type operationReport struct {
+	Operation    string  `json:"operation"`
+	Calls        int     `json:"calls"`
+	MaxLatencyMS int64   `json:"max_latency_ms"`
+	AvgLatencyMS int64   `json:"avg_latency_ms"`
+	MaxBytes     int64   `json:"max_response_bytes"`
+	SlowFraction float64 `json:"slow_fraction"`
+}
+
+// Slowest returns the n operations with the highest maximum latency over the
+// last slowWindow.
+func (t *slowTracker) Slowest(n int) []operationReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := time.Now().Add(-slowWindow)
+	type agg struct {
+		calls, slow int
+		total, max  time.Duration
+		maxBytes    int64
+	}
+	byOp := make(map[string]*agg)
+	for _, obs := range t.recent {
+		if obs.at.Before(cutoff) {
+			continue
+		}
+		a, ok := byOp[obs.operation]
+		if !ok {
+			a = &agg{}
+			byOp[obs.operation] = a
+		}
+		a.calls++
+		a.total += obs.elapsed
+		if obs.elapsed > a.max {
+			a.max = obs.elapsed
+		}
+		if obs.elapsed >= t.latencyThreshold {
+			a.slow++
+		}
+		if obs.bytes > a.maxBytes {
+			a.maxBytes = obs.bytes
+		}
+	}
+
+	reports := make([]operationReport, 0, len(byOp))
+	for op, a := range byOp {
+		reports = append(reports, operationReport{
+			Operation:    op,
+			Calls:        a.calls,
+			MaxLatencyMS: a.max.Milliseconds(),
+			AvgLatencyMS: (a.total / time.Duration(a.calls)).Milliseconds(),
+			MaxBytes:     a.maxBytes,
+			SlowFraction: float64(a.slow) / float64(a.calls),
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].MaxLatencyMS > reports[j].MaxLatencyMS
+	})
+	if len(reports) > n {
+		reports = reports[:n]
+	}
+	return reports
+}
+
+// handleSlowOperations reports the 10 slowest operations of the last hour.
+// GET /admin/slow-operations
+func handleSlowOperations(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"window":                   slowWindow.String(),
+		"slow_threshold_ms":        slowRequests.latencyThreshold.Milliseconds(),
+		"large_response_threshold": slowRequests.sizeThreshold,
+		"slowest_operations":       slowRequests.Slowest(10),
+	})
+}
@@ -0,0 +1,517 @@
+package ebaymcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/ebay"
+)
+
+// ### Sold Price Research ####################################################
+
+// Asking prices say little about what a product sells for. The local
+// research_sold_prices tool summarizes recent sales instead:
+//
+//	GET /research/sold-prices?q=iphone+13+128gb&condition=used&days=90
+//
+// It asks the Marketplace Insights API first, which only applications eBay
+// approved for the buy.marketplace.insights scope may call, and falls back
+// to the Finding API's findCompletedItems where eBay still serves it. The
+// result has the low, quartiles, median, high and mean sold price in the
+// marketplace's currency, how many listings (and, from Marketplace
+// Insights, units) sold, and from findCompletedItems how many listings
+// ended and what share of them sold. Results are cached for
+// soldPricesCacheTTL, since both APIs have small daily call limits.
+
+const (
+	soldPricesPath       = "/research/sold-prices"
+	soldPricesCacheTTL   = 6 * time.Hour
+	defaultSoldPriceDays = 90
+	maxSoldPriceDays     = 90 // neither API looks further back
+	defaultSoldSample    = 100
+	maxSoldSample        = 100
+	recentSoldSales      = 10
+
+	insightsScope       = "https://api.ebay.com/oauth/api_scope/buy.marketplace.insights"
+	insightsSearchPath  = "/buy/marketplace_insights/v1_beta/item_sales/search"
+	findingAPIPath      = "/services/search/FindingService/v1"
+	findingVersion      = "1.13.0"
+	findingTimeout      = 30 * time.Second
+	soldSourceInsights  = "marketplace_insights"
+	soldSourceFinding   = "finding"
+	findingSoldState    = "EndedWithSales"
+	findingNoMatchState = "EndedWithoutSales"
+)
+
+var soldPriceCache = cacheNamespace{name: "sold-prices"}
+
+// findingGlobalIDs maps the marketplaces in marketplaceLanguages to the
+// Finding API's GLOBAL-ID.
+var findingGlobalIDs = map[string]string{
+	"EBAY_US": "EBAY-US", "EBAY_MOTORS_US": "EBAY-MOTOR", "EBAY_CA": "EBAY-ENCA", "EBAY_GB": "EBAY-GB",
+	"EBAY_IE": "EBAY-IE", "EBAY_AU": "EBAY-AU", "EBAY_DE": "EBAY-DE", "EBAY_AT": "EBAY-AT",
+	"EBAY_CH": "EBAY-CH", "EBAY_FR": "EBAY-FR", "EBAY_BE": "EBAY-FRBE", "EBAY_IT": "EBAY-IT",
+	"EBAY_ES": "EBAY-ES", "EBAY_NL": "EBAY-NL", "EBAY_PL": "EBAY-PL", "EBAY_HK": "EBAY-HK",
+	"EBAY_SG": "EBAY-SG", "EBAY_MY": "EBAY-MY", "EBAY_PH": "EBAY-PH",
+}
+
+// soldConditions maps the condition parameter to eBay's condition IDs.
+var soldConditions = map[string]string{"new": "1000", "used": "3000"}
+
+// soldPriceQuery is what research_sold_prices was asked.
+type soldPriceQuery struct {
+	Query      string `json:"q,omitempty"`
+	CategoryID string `json:"category_id,omitempty"`
+	Condition  string `json:"condition,omitempty"`
+	Days       int    `json:"days"`
+	Limit      int    `json:"-"`
+}
+
+// soldSale is one sold listing.
+type soldSale struct {
+	ItemID    string  `json:"item_id"`
+	Title     string  `json:"title"`
+	Price     float64 `json:"price"`
+	Currency  string  `json:"currency"`
+	SoldDate  string  `json:"sold_date,omitempty"`
+	Quantity  int     `json:"quantity,omitempty"`
+	Condition string  `json:"condition,omitempty"`
+	URL       string  `json:"url,omitempty"`
+}
+
+// soldPriceStats summarizes the sold prices.
+type soldPriceStats struct {
+	Low    float64 `json:"low"`
+	P25    float64 `json:"p25"`
+	Median float64 `json:"median"`
+	P75    float64 `json:"p75"`
+	High   float64 `json:"high"`
+	Mean   float64 `json:"mean"`
+}
+
+// soldPriceResearch is the result of research_sold_prices.
+type soldPriceResearch struct {
+	soldPriceQuery
+	Marketplace   string          `json:"marketplace"`
+	Source        string          `json:"source"`
+	Currency      string          `json:"currency"`
+	TotalMatches  int             `json:"total_matches"`
+	SoldListings  int             `json:"sold_listings"`
+	UnitsSold     int             `json:"units_sold,omitempty"`
+	EndedListings int             `json:"ended_listings,omitempty"`
+	SellThrough   *float64        `json:"sell_through_rate,omitempty"`
+	Prices        *soldPriceStats `json:"prices,omitempty"`
+	RecentSales   []soldSale      `json:"recent_sales"`
+	Summary       string          `json:"summary"`
+	Warnings      []string        `json:"warnings,omitempty"`
+	GeneratedAt   time.Time       `json:"generated_at"`
+}
+
+// errNoSoldPriceSource is returned when neither API may be called.
+var errNoSoldPriceSource = errors.New("the policy allows neither the Marketplace Insights API nor the Finding API")
+
+// handleSoldPrices (research_sold_prices) researches what a product sold
+// for recently.
+// GET /research/sold-prices?q=...&category_id=...&condition=new|used&days=N&limit=N
+func handleSoldPrices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := soldPriceQuery{
+		Query:      strings.TrimSpace(r.URL.Query().Get("q")),
+		CategoryID: strings.TrimSpace(r.URL.Query().Get("category_id")),
+		Condition:  strings.ToLower(strings.TrimSpace(r.URL.Query().Get("condition"))),
+	}
+	if q.Query == "" && q.CategoryID == "" {
+		http.Error(w, "q or category_id is required", http.StatusBadRequest)
+		return
+	}
+	if _, ok := soldConditions[q.Condition]; !ok && q.Condition != "" {
+		http.Error(w, "condition must be new or used", http.StatusBadRequest)
+		return
+	}
+	var err error
+	if q.Days, err = boundedParam(r, "days", defaultSoldPriceDays, maxSoldPriceDays); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Limit, err = boundedParam(r, "limit", defaultSoldSample, maxSoldSample); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	caller, status, err := resolveCaller(w, r)
+	if err != nil {
+		log.Printf("Failed to resolve token for sold price research: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	ctx := r.Context()
+	cacheKey := fmt.Sprintf("%s\n%s\n%s\n%s\n%s\n%d\n%d", caller.env.key(), caller.marketplace, q.Query, q.CategoryID, q.Condition, q.Days, q.Limit)
+	if data, ok := soldPriceCache.Get(ctx, "research", cacheKey); ok {
+		var cached soldPriceResearch
+		if json.Unmarshal(data, &cached) == nil {
+			writeJSON(w, http.StatusOK, cached)
+			return
+		}
+	}
+
+	research, err := researchSoldPrices(ctx, caller.env, caller.marketplace, q)
+	switch {
+	case errors.Is(err, errNoSoldPriceSource):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		log.Printf("Sold price research failed: %v", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{
+			"error":   "sold_prices_unavailable",
+			"message": err.Error(),
+		})
+		return
+	}
+	if data, err := json.Marshal(research); err == nil {
+		soldPriceCache.Set(ctx, "research", cacheKey, data, soldPricesCacheTTL)
+	}
+	writeJSON(w, http.StatusOK, research)
+}
+
+// researchSoldPrices asks each source the policy allows in turn, keeping
+// why the ones before failed as warnings.
+func researchSoldPrices(ctx context.Context, env *ebayEnvironment, marketplace string, q soldPriceQuery) (*soldPriceResearch, error) {
+	var (
+		warnings []string
+		tried    bool
+	)
+	if currentPolicy().AllowPath(http.MethodGet, insightsSearchPath) == nil {
+		tried = true
+		research, err := insightsSoldPrices(ctx, env, marketplace, q)
+		if err == nil {
+			return research, nil
+		}
+		log.Printf("Marketplace Insights sold prices failed, trying findCompletedItems: %v", err)
+		warnings = append(warnings, "Marketplace Insights unavailable: "+err.Error())
+	}
+	if currentPolicy().AllowPath(http.MethodGet, findingAPIPath) == nil {
+		tried = true
+		research, err := findingSoldPrices(ctx, env, marketplace, q)
+		if err == nil {
+			research.Warnings = append(warnings, research.Warnings...)
+			return research, nil
+		}
+		warnings = append(warnings, "findCompletedItems unavailable: "+err.Error())
+	}
+	if !tried {
+		return nil, errNoSoldPriceSource
+	}
+	return nil, errors.New(strings.Join(warnings, "; "))
+}
+
+// insightsSoldPrices searches the Marketplace Insights API with an
+// application token.
+func insightsSoldPrices(ctx context.Context, env *ebayEnvironment, marketplace string, q soldPriceQuery) (*soldPriceResearch, error) {
+	token, err := applicationToken(ctx, env, insightsScope)
+	if err != nil {
+		return nil, err
+	}
+	p := ebay.SearchParams{
+		Query:  q.Query,
+		Filter: []string{"lastSoldDate:[" + time.Now().UTC().AddDate(0, 0, -q.Days).Format(time.RFC3339) + "..]"},
+		Limit:  q.Limit,
+	}
+	if q.CategoryID != "" {
+		p.CategoryIDs = []string{q.CategoryID}
+	}
+	if id := soldConditions[q.Condition]; id != "" {
+		p.Filter = append(p.Filter, "conditionIds:{"+id+"}")
+	}
+	result, err := ebayClient(env, token, marketplace).SearchItemSales(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	research := newSoldPriceResearch(marketplace, soldSourceInsights, q)
+	research.TotalMatches = result.Total
+	var sales []soldSale
+	for _, s := range result.ItemSales {
+		price, err := strconv.ParseFloat(s.LastSoldPrice.Value, 64)
+		if err != nil || price <= 0 {
+			continue
+		}
+		sales = append(sales, soldSale{
+			ItemID:    s.ItemID,
+			Title:     s.Title,
+			Price:     price,
+			Currency:  s.LastSoldPrice.Currency,
+			SoldDate:  s.LastSoldDate,
+			Quantity:  s.TotalSoldQuantity,
+			Condition: s.Condition,
+			URL:       s.ItemWebURL,
+		})
+	}
+	research.summarize(sales)
+	return research, nil
+}
+
+// findingResponse is the part of a findCompletedItems JSON response we
+// read. The Finding API wraps every value in an array.
+type findingResponse struct {
+	FindCompletedItemsResponse []struct {
+		Ack          []string `json:"ack"`
+		ErrorMessage []struct {
+			Error []struct {
+				ErrorID []string `json:"errorId"`
+				Message []string `json:"message"`
+			} `json:"error"`
+		} `json:"errorMessage"`
+		SearchResult []struct {
+			Item []findingItem `json:"item"`
+		} `json:"searchResult"`
+		PaginationOutput []struct {
+			TotalEntries []string `json:"totalEntries"`
+		} `json:"paginationOutput"`
+	} `json:"findCompletedItemsResponse"`
+}
+
+// findingItem is an ended listing of findCompletedItems.
+type findingItem struct {
+	ItemID        []string `json:"itemId"`
+	Title         []string `json:"title"`
+	ViewItemURL   []string `json:"viewItemURL"`
+	SellingStatus []struct {
+		ConvertedCurrentPrice []struct {
+			CurrencyID string `json:"@currencyId"`
+			Value      string `json:"__value__"`
+		} `json:"convertedCurrentPrice"`
+		SellingState []string `json:"sellingState"`
+	} `json:"sellingStatus"`
+	ListingInfo []struct {
+		EndTime []string `json:"endTime"`
+	} `json:"listingInfo"`
+	Condition []struct {
+		ConditionDisplayName []string `json:"conditionDisplayName"`
+	} `json:"condition"`
+}
+
+// findingValue returns the first of the Finding API's one-element arrays.
+func findingValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// findingHost returns the Finding API's host for an API host, e.g.
+// api.sandbox.ebay.com -> svcs.sandbox.ebay.com.
+func findingHost(apiHost string) string {
+	if strings.HasPrefix(apiHost, "api.") {
+		return "svcs." + strings.TrimPrefix(apiHost, "api.")
+	}
+	return apiHost
+}
+
+// findingSoldPrices asks the Finding API's findCompletedItems for the
+// listings that ended, sold or not, so the sell-through rate can be worked
+// out too. It only needs the application's client ID.
+func findingSoldPrices(ctx context.Context, env *ebayEnvironment, marketplace string, q soldPriceQuery) (*soldPriceResearch, error) {
+	globalID, ok := findingGlobalIDs[marketplace]
+	if !ok {
+		return nil, fmt.Errorf("the Finding API doesn't serve %s", marketplace)
+	}
+	params := url.Values{}
+	params.Set("OPERATION-NAME", "findCompletedItems")
+	params.Set("SERVICE-VERSION", findingVersion)
+	params.Set("SECURITY-APPNAME", env.ClientID)
+	params.Set("GLOBAL-ID", globalID)
+	params.Set("RESPONSE-DATA-FORMAT", "JSON")
+	params.Set("REST-PAYLOAD", "")
+	if q.Query != "" {
+		params.Set("keywords", q.Query)
+	}
+	if q.CategoryID != "" {
+		params.Set("categoryId", q.CategoryID)
+	}
+	params.Set("sortOrder", "EndTimeSoonest")
+	params.Set("paginationInput.entriesPerPage", strconv.Itoa(q.Limit))
+	params.Set("itemFilter(0).name", "EndTimeFrom")
+	params.Set("itemFilter(0).value", time.Now().UTC().AddDate(0, 0, -q.Days).Format("2006-01-02T15:04:05.000Z"))
+	if id := soldConditions[q.Condition]; id != "" {
+		params.Set("itemFilter(1).name", "Condition")
+		params.Set("itemFilter(1).value", id)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, findingTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+findingHost(env.APIHost)+findingAPIPath+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Transport: ebayTransport}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("findCompletedItems failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := readLimited(resp.Body, maxResponseBufferSize)
+	if err != nil {
+		return nil, fmt.Errorf("findCompletedItems failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("findCompletedItems returned status %d", resp.StatusCode)
+	}
+	var parsed findingResponse
+	if err := json.Unmarshal(data, &parsed); err != nil || len(parsed.FindCompletedItemsResponse) == 0 {
+		return nil, errors.New("findCompletedItems returned an unexpected response")
+	}
+	result := parsed.FindCompletedItemsResponse[0]
+	if ack := findingValue(result.Ack); ack != "Success" && ack != "Warning" {
+		var messages []string
+		for _, m := range result.ErrorMessage {
+			for _, e := range m.Error {
+				messages = append(messages, findingValue(e.Message)+" ("+findingValue(e.ErrorID)+")")
+			}
+		}
+		return nil, fmt.Errorf("findCompletedItems failed: %s", strings.Join(messages, "; "))
+	}
+
+	research := newSoldPriceResearch(marketplace, soldSourceFinding, q)
+	if len(result.PaginationOutput) > 0 {
+		research.TotalMatches, _ = strconv.Atoi(findingValue(result.PaginationOutput[0].TotalEntries))
+	}
+	var sales []soldSale
+	for _, sr := range result.SearchResult {
+		for _, it := range sr.Item {
+			if len(it.SellingStatus) == 0 {
+				continue
+			}
+			status := it.SellingStatus[0]
+			switch findingValue(status.SellingState) {
+			case findingSoldState:
+			case findingNoMatchState:
+				research.EndedListings++
+				continue
+			default:
+				continue // still active or ended early
+			}
+			research.EndedListings++
+			if len(status.ConvertedCurrentPrice) == 0 {
+				continue
+			}
+			price, err := strconv.ParseFloat(status.ConvertedCurrentPrice[0].Value, 64)
+			if err != nil || price <= 0 {
+				continue
+			}
+			sale := soldSale{
+				ItemID:   findingValue(it.ItemID),
+				Title:    findingValue(it.Title),
+				Price:    price,
+				Currency: status.ConvertedCurrentPrice[0].CurrencyID,
+				URL:      findingValue(it.ViewItemURL),
+			}
+			if len(it.ListingInfo) > 0 {
+				sale.SoldDate = findingValue(it.ListingInfo[0].EndTime)
+			}
+			if len(it.Condition) > 0 {
+				sale.Condition = findingValue(it.Condition[0].ConditionDisplayName)
+			}
+			sales = append(sales, sale)
+		}
+	}
+	research.summarize(sales)
+	if research.EndedListings > 0 {
+		rate := math.Round(float64(research.SoldListings)/float64(research.EndedListings)*1000) / 1000
+		research.SellThrough = &rate
+	}
+	return research, nil
+}
+
+func newSoldPriceResearch(marketplace, source string, q soldPriceQuery) *soldPriceResearch {
+	currency := marketplaceCurrencies[marketplace]
+	if currency == "" {
+		currency = marketplaceCurrencies[defaultMarketplace]
+	}
+	return &soldPriceResearch{
+		soldPriceQuery: q,
+		Marketplace:    marketplace,
+		Source:         source,
+		Currency:       currency,
+		RecentSales:    []soldSale{},
+		GeneratedAt:    time.Now().UTC(),
+	}
+}
+
+// summarize fills in the counts, price statistics, recent sales and
+// summary from sales, leaving out sales in other currencies than the
+// marketplace's.
+func (s *soldPriceResearch) summarize(sales []soldSale) {
+	var prices []float64
+	kept := sales[:0]
+	other := 0
+	for _, sale := range sales {
+		if sale.Currency != s.Currency {
+			other++
+			continue
+		}
+		kept = append(kept, sale)
+		prices = append(prices, sale.Price)
+		s.UnitsSold += sale.Quantity
+	}
+	if other > 0 {
+		s.Warnings = append(s.Warnings, fmt.Sprintf("left out %d sales in other currencies than %s", other, s.Currency))
+	}
+	s.SoldListings = len(kept)
+
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].SoldDate > kept[j].SoldDate })
+	if len(kept) > recentSoldSales {
+		kept = kept[:recentSoldSales]
+	}
+	s.RecentSales = append(s.RecentSales, kept...)
+
+	if len(prices) == 0 {
+		s.Summary = fmt.Sprintf("No sales found in the last %d days. Try broader keywords or leave out the condition.", s.Days)
+		return
+	}
+	sort.Float64s(prices)
+	sum := 0.0
+	for _, p := range prices {
+		sum += p
+	}
+	s.Prices = &soldPriceStats{
+		Low:    prices[0],
+		P25:    roundCents(quantile(prices, 0.25)),
+		Median: roundCents(quantile(prices, 0.5)),
+		P75:    roundCents(quantile(prices, 0.75)),
+		High:   prices[len(prices)-1],
+		Mean:   roundCents(sum / float64(len(prices))),
+	}
+	s.Summary = fmt.Sprintf("%d listings sold in the last %d days for a median of %.2f %s; half sold between %.2f and %.2f.",
+		s.SoldListings, s.Days, s.Prices.Median, s.Currency, s.Prices.P25, s.Prices.P75)
+	if len(prices) < 5 {
+		s.Summary += " Too few sales to price with confidence."
+	}
+}
+
+// quantile returns the q-quantile of sorted, interpolating between
+// neighbours; quantile(sorted, 0.5) is the median.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	if lo+1 >= len(sorted) {
+		return sorted[lo]
+	}
+	return sorted[lo] + (sorted[lo+1]-sorted[lo])*(pos-float64(lo))
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
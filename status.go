@@ -0,0 +1,174 @@
+package ebaymcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ### Connection Status ######################################################
+
+// handleConnectionStatus (operation get_connection_status) tells the
+// assistant which eBay account its token is linked to, what it may do, when
+// the token expires and how much API quota is left, so it can work out why
+// calls are failing without asking the user.
+//
+// GET /connection-status with the same Authorization header as /proxy/...
+func handleConnectionStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		loc := localizerFor(r, "", "")
+		loc.setContentLanguage(w)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"linked": false,
+			"reason": loc.T("status.no_token"),
+		})
+		return
+	}
+	accessToken := parts[1]
+
+	env, err := environmentFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := map[string]interface{}{"linked": true}
+	var language, marketplace string
+	var expiresAt time.Time
+	var linkedUser *ebayUser // recorded when the account was linked
+	restartNote := false
+
+	if isVaultReference(accessToken) {
+		token, entry, err := vaultAccessToken(r.Context(), accessToken)
+		if err != nil {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"linked":    false,
+				"link_type": "vault",
+				"reason":    err.Error(),
+			})
+			return
+		}
+		accessToken = token
+		env = entry.environment()
+		status["link_type"] = "vault"
+		status["scopes"] = entry.Scopes
+		status["marketplace"] = entry.Marketplace
+		status["linked_at"] = entry.CreatedAt
+		entry.mu.Lock()
+		expiresAt = entry.expiresAt.UTC()
+		entry.mu.Unlock()
+		status["token_expires_at"] = expiresAt
+		language, marketplace = entry.Language, entry.Marketplace
+		linkedUser = entry.ebayUser()
+	} else if backend != nil && !isEbayToken(accessToken) {
+		token, entry, _, err := backend.AccessToken(r.Context(), accessToken, env.Name)
+		if err != nil {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"linked":    false,
+				"link_type": "backend",
+				"reason":    err.Error(),
+			})
+			return
+		}
+		accessToken = token
+		env = entry.environment()
+		status["link_type"] = "backend"
+		status["scopes"] = entry.Scopes
+		status["marketplace"] = entry.Marketplace
+		status["linked_at"] = entry.CreatedAt
+		entry.mu.Lock()
+		expiresAt = entry.expiresAt.UTC()
+		entry.mu.Unlock()
+		status["token_expires_at"] = expiresAt
+		language, marketplace = entry.Language, entry.Marketplace
+		linkedUser = entry.ebayUser()
+	} else {
+		status["link_type"] = "oauth"
+		if info, ok := issuedTokens.Lookup(r.Context(), accessToken); ok {
+			env = environmentNamed(info.Tenant, info.Environment)
+			status["scopes"] = info.Scopes
+			expiresAt = info.ExpiresAt.UTC()
+			status["token_expires_at"] = expiresAt
+		} else {
+			status["scopes"] = env.OAuth.Scopes
+			restartNote = true
+		}
+	}
+	status["environment"] = env.Name
+
+	loc := localizerFor(r, language, marketplace)
+	if restartNote {
+		status["note"] = loc.T("status.restart_note")
+	}
+
+	// Both lookups below are best effort: failures are reported, not fatal
+	summary := loc.T("status.summary_anon", env.Name)
+	if user, err := fetchEbayUser(r.Context(), env, accessToken); err == nil {
+		status["account"] = user
+		summary = loc.T("status.summary", user.Username, env.Name)
+	} else {
+		status["account_error"] = err.Error()
+		if linkedUser != nil {
+			status["account"] = linkedUser
+			summary = loc.T("status.summary", linkedUser.Username, env.Name)
+		}
+	}
+	if !expiresAt.IsZero() {
+		summary += " " + loc.T("status.expires", expiresAt.Format(time.RFC3339))
+	}
+	status["summary"] = summary
+	status["language"] = loc.lang
+	if quota, err := fetchUserRateLimits(r.Context(), env, accessToken); err == nil {
+		status["quota"] = quota
+	} else {
+		status["quota_error"] = err.Error()
+	}
+
+	loc.setContentLanguage(w)
+	writeJSON(w, http.StatusOK, status)
+}
+
+// fetchUserRateLimits calls the Developer Analytics getUserRateLimits
+// operation and returns its rateLimits array as-is.
+func fetchUserRateLimits(ctx context.Context, env *ebayEnvironment, accessToken string) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://"+env.APIHost+"/developer/analytics/v1_beta/user_rate_limit/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getUserRateLimits returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		RateLimits json.RawMessage `json:"rateLimits"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse rate limits: %w", err)
+	}
+	return result.RateLimits, nil
+}
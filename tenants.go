@@ -0,0 +1,304 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ### Tenants ################################################################
+
+// One deployment can serve several eBay developer applications. Each tenant
+// has its own keysets (one per eBay environment), scopes and API hosts, and
+// is selected by the request's hostname or a /t/<tenant>/ path prefix, e.g.
+// https://proxy.example/t/acme/authorize. The EBAY_* keysets form the
+// default tenant, used when neither matches. Other tenants are listed in
+// TENANTS_FILE:
+//
+//	tenants:
+//	  - name: acme
+//	    hosts: [ebay.acme.example]
+//	    redirect_url: https://ebay.acme.example/callback
+//	    default_environment: production
+//	    environments:
+//	      production:
+//	        client_id: Acme-Assist-PRD-...
+//	        scopes: https://api.ebay.com/oauth/api_scope https://api.ebay.com/oauth/api_scope/sell.inventory
+//
+// Client secrets stay out of the file: they are read from
+// EBAY_<TENANT>_<ENVIRONMENT>_CLIENT_SECRET (e.g.
+// EBAY_ACME_PRODUCTION_CLIENT_SECRET), which a secret manager can provide
+// through SECRETS_NAMES. Unset hosts and scopes default to eBay's
+// well-known hosts and EBAY_SCOPES; redirect_url defaults to /callback on
+// the tenant's own host or prefix, and must be the one registered with the
+// tenant's application.
+//
+// Everything stored per application is keyed by tenant: application tokens,
+// signing keys, cached responses, linked accounts and issued tokens. A token
+// is only accepted by the tenant that issued it.
+
+const (
+	defaultTenantName = "default"
+	tenantPathPrefix  = "/t/"
+)
+
+// tenantNamePattern keeps tenant names usable in paths and variable names.
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,30}$`)
+
+// tenant is one eBay developer application with its environments.
+type tenant struct {
+	Name               string
+	Hosts              []string
+	RedirectURL        string
+	Environments       map[string]*ebayEnvironment
+	DefaultEnvironment string
+}
+
+// tenants holds every tenant by name, including the default one.
+var (
+	tenants       = make(map[string]*tenant)
+	defaultTenant *tenant
+)
+
+// tenantsFile is the format of TENANTS_FILE.
+type tenantsFile struct {
+	Tenants []struct {
+		Name               string   `yaml:"name"`
+		Hosts              []string `yaml:"hosts,omitempty"`
+		RedirectURL        string   `yaml:"redirect_url,omitempty"`
+		DefaultEnvironment string   `yaml:"default_environment,omitempty"`
+		Environments       map[string]struct {
+			ClientID string `yaml:"client_id"`
+			Scopes   string `yaml:"scopes,omitempty"`
+			APIHost  string `yaml:"api_host,omitempty"`
+			AuthURL  string `yaml:"auth_url,omitempty"`
+			TokenURL string `yaml:"token_url,omitempty"`
+		} `yaml:"environments"`
+	} `yaml:"tenants"`
+}
+
+// registerDefaultTenant makes the EBAY_* environments the default tenant.
+func registerDefaultTenant() {
+	defaultTenant = &tenant{
+		Name:               defaultTenantName,
+		Environments:       environments,
+		DefaultEnvironment: defaultEnvironment,
+	}
+	tenants[defaultTenantName] = defaultTenant
+}
+
+// loadTenants reads the tenants of path, if set, into the registry.
+// defaultScopes are used for environments that don't list theirs.
+func loadTenants(path, defaultScopes string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read TENANTS_FILE: %w", err)
+	}
+	var file tenantsFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil {
+		return fmt.Errorf("invalid TENANTS_FILE: %w", err)
+	}
+
+	hosts := make(map[string]string)
+	for _, tf := range file.Tenants {
+		if !tenantNamePattern.MatchString(tf.Name) || tf.Name == defaultTenantName {
+			return fmt.Errorf("TENANTS_FILE: invalid tenant name %q (lowercase letters, digits and dashes, not %q)", tf.Name, defaultTenantName)
+		}
+		if tenants[tf.Name] != nil {
+			return fmt.Errorf("TENANTS_FILE: duplicate tenant %q", tf.Name)
+		}
+		if len(tf.Environments) == 0 {
+			return fmt.Errorf("TENANTS_FILE: tenant %s has no environments", tf.Name)
+		}
+
+		t := &tenant{
+			Name:               tf.Name,
+			RedirectURL:        tf.RedirectURL,
+			Environments:       make(map[string]*ebayEnvironment),
+			DefaultEnvironment: tf.DefaultEnvironment,
+		}
+		for _, host := range tf.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := hosts[host]; ok {
+				return fmt.Errorf("TENANTS_FILE: host %s is used by tenants %s and %s", host, other, tf.Name)
+			}
+			hosts[host] = tf.Name
+			t.Hosts = append(t.Hosts, host)
+		}
+
+		for name, ef := range tf.Environments {
+			defaults, ok := defaultEndpoints[name]
+			if !ok {
+				return fmt.Errorf("TENANTS_FILE: tenant %s: unknown environment %q (expected %s or %s)", tf.Name, name, envProduction, envSandbox)
+			}
+			if ef.ClientID == "" {
+				return fmt.Errorf("TENANTS_FILE: tenant %s: %s needs a client_id", tf.Name, name)
+			}
+			env := newEnvironment(name, ef.ClientID, "", firstNonEmpty(ef.Scopes, defaultScopes),
+				firstNonEmpty(ef.APIHost, defaults.APIHost),
+				firstNonEmpty(ef.AuthURL, defaults.AuthURL),
+				firstNonEmpty(ef.TokenURL, defaults.TokenURL))
+			env.Tenant = tf.Name
+			secret := os.Getenv(env.secretName())
+			if secret == "" {
+				return fmt.Errorf("TENANTS_FILE: tenant %s: %s is not set", tf.Name, env.secretName())
+			}
+			env.setClientSecret(secret)
+			t.Environments[name] = env
+		}
+		if t.DefaultEnvironment == "" {
+			if len(t.Environments) > 1 {
+				return fmt.Errorf("TENANTS_FILE: tenant %s needs a default_environment", tf.Name)
+			}
+			for name := range t.Environments {
+				t.DefaultEnvironment = name
+			}
+		}
+		if t.Environments[t.DefaultEnvironment] == nil {
+			return fmt.Errorf("TENANTS_FILE: tenant %s: default_environment %q is not configured", tf.Name, t.DefaultEnvironment)
+		}
+		tenants[t.Name] = t
+	}
+	return nil
+}
+
+// errOtherTenant rejects credentials of one tenant presented to another.
+var errOtherTenant = errors.New("the token belongs to another tenant")
+
+// has reports whether env is one of the tenant's environments.
+func (t *tenant) has(env *ebayEnvironment) bool {
+	return env != nil && t.Environments[env.Name] == env
+}
+
+// tenantNames lists the registered tenants.
+func tenantNames() []string {
+	names := make([]string, 0, len(tenants))
+	for name := range tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// allEnvironments returns the environments of every tenant.
+func allEnvironments() []*ebayEnvironment {
+	var envs []*ebayEnvironment
+	for _, name := range tenantNames() {
+		for _, envName := range tenants[name].environmentNames() {
+			envs = append(envs, tenants[name].Environments[envName])
+		}
+	}
+	return envs
+}
+
+// environmentNames lists the tenant's environments.
+func (t *tenant) environmentNames() []string {
+	names := make([]string, 0, len(t.Environments))
+	for name := range t.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// environmentNamed returns the environment of a tenant ("" for the default
+// one), or nil if either isn't configured.
+func environmentNamed(tenantName, envName string) *ebayEnvironment {
+	if tenantName == "" {
+		tenantName = defaultTenantName
+	}
+	t := tenants[tenantName]
+	if t == nil {
+		return nil
+	}
+	return t.Environments[envName]
+}
+
+// ### Tenant Selection ###
+
+// tenantSelection is what selectTenant found for a request.
+type tenantSelection struct {
+	tenant *tenant
+	prefix string // "/t/<name>" when selected by path, else ""
+}
+
+type tenantContextKey struct{}
+
+// selectTenant picks the tenant of each request by its /t/<name>/ prefix,
+// which it strips, or its host.
+func selectTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(tenants) <= 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if rest, ok := strings.CutPrefix(r.URL.Path, tenantPathPrefix); ok {
+			name, path, _ := strings.Cut(rest, "/")
+			t := tenants[name]
+			if t == nil || t == defaultTenant {
+				http.Error(w, fmt.Sprintf("unknown tenant %q", name), http.StatusNotFound)
+				return
+			}
+			prefix := tenantPathPrefix + name
+			r2 := r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tenantSelection{t, prefix}))
+			r2.URL.Path = "/" + path
+			r2.URL.RawPath = ""
+			next.ServeHTTP(w, r2)
+			return
+		}
+
+		host := strings.ToLower(r.Host)
+		if trustForwardedHeaders() && r.Header.Get("X-Forwarded-Host") != "" {
+			host = strings.ToLower(r.Header.Get("X-Forwarded-Host"))
+		}
+		if h, _, ok := strings.Cut(host, ":"); ok {
+			host = h
+		}
+		for _, t := range tenants {
+			for _, h := range t.Hosts {
+				if h == host {
+					next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tenantSelection{tenant: t})))
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tenantFor returns the tenant selectTenant picked for r.
+func tenantFor(r *http.Request) *tenant {
+	if sel, ok := r.Context().Value(tenantContextKey{}).(tenantSelection); ok {
+		return sel.tenant
+	}
+	return defaultTenant
+}
+
+// tenantPrefix returns the path prefix r was addressed with, if any.
+func tenantPrefix(r *http.Request) string {
+	sel, _ := r.Context().Value(tenantContextKey{}).(tenantSelection)
+	return sel.prefix
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
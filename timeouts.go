@@ -0,0 +1,75 @@
+package ebaymcp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ### Upstream Timeouts ######################################################
+
+// A proxied call runs under the client's request context, so a client that
+// disconnects cancels the eBay call, including retries waiting out their
+// backoff. On top of that, the policy's `timeouts` rules bound how long a
+// call to an eBay path may take as a whole, retries and streaming the body
+// included; the most specific prefix wins. A call that runs out of time gets
+// 504. Without the section, calls get 60s and Feed API transfers 10m.
+
+// TimeoutRule bounds calls to eBay paths under Prefix.
+type TimeoutRule struct {
+	Prefix  string        `yaml:"prefix"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// defaultTimeoutRules apply when the policy has no `timeouts` section.
+var defaultTimeoutRules = []TimeoutRule{
+	{Prefix: "/", Timeout: time.Minute},
+	{Prefix: "/sell/feed/v1/", Timeout: 10 * time.Minute},
+}
+
+// validate checks the rule at index i of the policy.
+func (t *TimeoutRule) validate(i int) []string {
+	var problems []string
+	if !strings.HasPrefix(t.Prefix, "/") {
+		problems = append(problems, fmt.Sprintf("timeouts[%d]: prefix %q must start with /", i, t.Prefix))
+	}
+	if t.Timeout <= 0 {
+		problems = append(problems, fmt.Sprintf("timeouts[%d]: timeout must be positive", i))
+	}
+	return problems
+}
+
+// upstreamTimeoutFor returns how long a call to path may take, or 0 for no
+// limit but the client's.
+func (p *Policy) upstreamTimeoutFor(path string) time.Duration {
+	rules := p.Timeouts
+	if rules == nil {
+		rules = defaultTimeoutRules
+	}
+	var best *TimeoutRule
+	for i := range rules {
+		rule := &rules[i]
+		if strings.HasPrefix(path, rule.Prefix) && (best == nil || len(rule.Prefix) > len(best.Prefix)) {
+			best = rule
+		}
+	}
+	if best == nil {
+		return 0
+	}
+	return best.Timeout
+}
+
+// proxyTransport carries the calls of handleProxy, so they share its
+// connections to eBay. eBay requires HTTP/2.
+var proxyTransport = &http.Transport{
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+	ResponseHeaderTimeout: 45 * time.Second, // Increased timeout for eBay API
+	IdleConnTimeout:       90 * time.Second, // Keep idle connections for 90 seconds
+	MaxIdleConns:          100,              // Maximum idle connections
+	MaxIdleConnsPerHost:   10,               // Maximum idle connections per host
+	MaxConnsPerHost:       50,               // Maximum total connections per host
+	DisableKeepAlives:     false,            // Enable keep-alives for better performance
+	ForceAttemptHTTP2:     true,             // Enable HTTP/2
+}
@@ -0,0 +1,170 @@
+package ebaymcp
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ### Token Response Rewrites ################################################
+
+// eBay's token responses don't quite follow RFC 6749: token_type is "User
+// Access Token" and there is an extra refresh_token_expires_in. OAuth clients
+// differ in what they tolerate, so /token rewrites the response by the
+// policy's token_response rules, in order. Each rule changes one top-level
+// field: `set` gives it a value (adding it if missing), `rename` moves it,
+// `delete` removes it. The tokens themselves (access_token, refresh_token,
+// id_token) can't be rewritten. A rule with `clients` only applies to those
+// client IDs, as authenticated by OAUTH_CLIENTS, for codes and refreshes
+// alike.
+//
+// Without rules, token_type is set to "Bearer", which ChatGPT requires.
+// Listing rules replaces that default, so keep it in the list.
+
+// TokenRewriteRule changes one field of /token responses.
+type TokenRewriteRule struct {
+	Field   string      `yaml:"field"`
+	Set     interface{} `yaml:"set,omitempty"`
+	Rename  string      `yaml:"rename,omitempty"`
+	Delete  bool        `yaml:"delete,omitempty"`
+	Clients []string    `yaml:"clients,omitempty"`
+}
+
+// defaultTokenRewrites apply when the policy has no token_response rules.
+var defaultTokenRewrites = []TokenRewriteRule{{Field: "token_type", Set: "Bearer"}}
+
+// tokenFields are the response fields rules may not touch.
+var tokenFields = []string{"access_token", "refresh_token", "id_token"}
+
+// validate checks the rule at index i of the policy.
+func (t *TokenRewriteRule) validate(i int) []string {
+	var problems []string
+	if t.Field == "" {
+		problems = append(problems, fmt.Sprintf("token_response[%d]: field is required", i))
+	}
+	actions := 0
+	for _, set := range []bool{t.Set != nil, t.Rename != "", t.Delete} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		problems = append(problems, fmt.Sprintf("token_response[%d]: exactly one of set, rename and delete is required", i))
+	}
+	if t.Rename != "" && t.Rename == t.Field {
+		problems = append(problems, fmt.Sprintf("token_response[%d]: rename must name another field", i))
+	}
+	for _, name := range tokenFields {
+		if t.Field == name || t.Rename == name {
+			problems = append(problems, fmt.Sprintf("token_response[%d]: %s can't be rewritten", i, name))
+		}
+	}
+	for _, client := range t.Clients {
+		if client == "" {
+			problems = append(problems, fmt.Sprintf("token_response[%d]: empty client ID", i))
+		}
+	}
+	return problems
+}
+
+// appliesTo reports whether the rule covers the client clientID ("" for an
+// unauthenticated one).
+func (t *TokenRewriteRule) appliesTo(clientID string) bool {
+	if len(t.Clients) == 0 {
+		return true
+	}
+	for _, client := range t.Clients {
+		if clientID != "" && client == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// apply rewrites response and says what it did, or "" when the field was
+// missing.
+func (t *TokenRewriteRule) apply(response map[string]interface{}) string {
+	value, present := response[t.Field]
+	switch {
+	case t.Set != nil:
+		response[t.Field] = t.Set
+		return fmt.Sprintf("%s: %v -> %v", t.Field, value, t.Set)
+	case !present:
+		return ""
+	case t.Rename != "":
+		delete(response, t.Field)
+		response[t.Rename] = value
+		return fmt.Sprintf("%s -> %s", t.Field, t.Rename)
+	default:
+		delete(response, t.Field)
+		return "-" + t.Field
+	}
+}
+
+// rewriteTokenResponse applies p's token_response rules for the client
+// clientID.
+func rewriteTokenResponse(p *Policy, response map[string]interface{}, clientID string) {
+	rules := p.TokenResponse
+	if len(rules) == 0 {
+		rules = defaultTokenRewrites
+	}
+	var applied []string
+	for i := range rules {
+		if rules[i].appliesTo(clientID) {
+			if change := rules[i].apply(response); change != "" {
+				applied = append(applied, change)
+			}
+		}
+	}
+	if len(applied) > 0 {
+		log.Printf("Rewrote token response: %s", strings.Join(applied, ", "))
+	}
+}
+
+// ### Token Clients ###
+
+// OAUTH_CLIENTS lists the clients allowed to call /token as
+// "client_id:client_secret" pairs. When set, /token requires one of them,
+// sent as HTTP Basic or in the form (client_secret_basic or
+// client_secret_post), and answers invalid_client otherwise. Without it
+// /token takes any client, as before, and rules naming clients never apply.
+
+// tokenClients maps client IDs to secrets; nil when OAUTH_CLIENTS is unset.
+var tokenClients map[string]string
+
+// tokenClientsFromEnv parses OAUTH_CLIENTS.
+func tokenClientsFromEnv() (map[string]string, error) {
+	raw := splitList(os.Getenv("OAUTH_CLIENTS"))
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	clients := make(map[string]string, len(raw))
+	for i, entry := range raw {
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("OAUTH_CLIENTS: entry %d is not client_id:client_secret", i+1)
+		}
+		clients[id] = secret
+	}
+	return clients, nil
+}
+
+// authenticateTokenClient returns the client ID r authenticates as, "" when
+// OAUTH_CLIENTS is unset, or false when the credentials don't match.
+func authenticateTokenClient(r *http.Request) (string, bool) {
+	if tokenClients == nil {
+		return "", true
+	}
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.Form.Get("client_id"), r.Form.Get("client_secret")
+	}
+	want, known := tokenClients[id]
+	if !known || subtle.ConstantTimeCompare([]byte(secret), []byte(want)) != 1 {
+		return "", false
+	}
+	return id, true
+}
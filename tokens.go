@@ -0,0 +1,91 @@
+package ebaymcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// ### Issued Token Registry ##################################################
+
+// eBay access tokens are opaque and we don't store them, but some features
+// need to know what a token was issued for. handleToken records a hash of
+// every access token it hands out along with its environment, scopes and
+// expiry. The registry is kept in memory and in the shared cache, so with
+// Redis or memcached every replica knows the tokens any of them issued; with
+// the in-memory cache, tokens are unknown after a restart until they are
+// refreshed.
+type tokenInfo struct {
+	Tenant      string // "" for the default tenant
+	Environment string
+	Scopes      []string
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+}
+
+type tokenRegistry struct {
+	mu     sync.Mutex
+	tokens map[string]tokenInfo
+}
+
+var issuedTokens = &tokenRegistry{tokens: make(map[string]tokenInfo)}
+
+// tokenHash keys the registry so raw tokens are never held in memory twice.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Record remembers an issued access token, dropping expired ones.
+func (t *tokenRegistry) Record(ctx context.Context, token string, info tokenInfo) {
+	hash := tokenHash(token)
+	if data, err := json.Marshal(info); err == nil {
+		tokenCache.Set(ctx, "issued", hash, data, time.Until(info.ExpiresAt))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for hash, existing := range t.tokens {
+		if now.After(existing.ExpiresAt) {
+			delete(t.tokens, hash)
+		}
+	}
+	t.tokens[hash] = info
+}
+
+// Lookup returns what is known about an access token, here or by the
+// replica that issued it.
+func (t *tokenRegistry) Lookup(ctx context.Context, token string) (tokenInfo, bool) {
+	hash := tokenHash(token)
+	t.mu.Lock()
+	info, ok := t.tokens[hash]
+	t.mu.Unlock()
+
+	if !ok {
+		data, cached := tokenCache.Get(ctx, "issued", hash)
+		ok = cached && json.Unmarshal(data, &info) == nil
+	}
+	if ok && time.Now().After(info.ExpiresAt) {
+		return tokenInfo{}, false
+	}
+	return info, ok
+}
+
+// issuedTokenScopes returns the scopes /token issued token with, or nil
+// when it wasn't issued here. A token issued for another tenant than env's
+// is refused with errOtherTenant.
+func issuedTokenScopes(ctx context.Context, env *ebayEnvironment, token string) ([]string, error) {
+	info, ok := issuedTokens.Lookup(ctx, token)
+	if !ok {
+		return nil, nil
+	}
+	if info.Tenant != env.Tenant {
+		return nil, errOtherTenant
+	}
+	return info.Scopes, nil
+}
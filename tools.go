@@ -0,0 +1,630 @@
+package ebaymcp
+
+import (
+	"net/http"
+)
+
+// ### Tool Registry ##########################################################
+
+// toolRegistry lists the eBay operations the proxy exposes to assistants as
+// named tools. It is the single source for the GPT Actions OpenAPI document
+// (/openapi.json, `ebay-mcp gen-openapi`) and the MCP server (`ebay-mcp
+// mcp`); the policy's `tools` section can
+// disable individual tools, and its `paths` section hides tools whose route
+// isn't allowed.
+
+// toolParam describes a path or query parameter of a tool.
+type toolParam struct {
+	Name        string
+	In          string // "path" or "query"
+	Type        string // JSON Schema type: "string", "integer" or "boolean"
+	Required    bool
+	Description string
+	Enum        []string
+}
+
+// toolRoute is one tool: an eBay operation reached through /proxy, or a
+// Local one the proxy answers itself at Path.
+type toolRoute struct {
+	Name        string // operationId, e.g. "searchItems"
+	Method      string
+	Path        string // eBay path template, as in operationTemplates
+	Summary     string
+	Description string
+	Params      []toolParam
+	Body        string // description of the JSON request body, if any
+	Task        *taskPolling
+	Local       bool
+}
+
+// serverPath returns where the proxy serves path, a path of the tool.
+func (t toolRoute) serverPath(path string) string {
+	if t.Local {
+		return path
+	}
+	return "/proxy" + path
+}
+
+// taskPolling describes a tool that starts an eBay background task: the
+// response's Location header points at the task, which is polled until its
+// status leaves Stages.
+type taskPolling struct {
+	StatusField string             // field of the task resource holding its status
+	Stages      map[string]float64 // unfinished statuses and their progress percentage
+	Failed      []string           // finished statuses meaning the task failed
+	Deletable   bool               // DELETE on the task cancels it
+}
+
+// feedTaskPolling and reportTaskPolling describe Feed API and Marketing API
+// report tasks.
+var (
+	feedTaskPolling = &taskPolling{
+		StatusField: "status",
+		Stages:      map[string]float64{"CREATED": 10, "QUEUED": 20, "IN_PROCESS": 50},
+		Failed:      []string{"FAILED"},
+	}
+	reportTaskPolling = &taskPolling{
+		StatusField: "reportTaskStatus",
+		Stages:      map[string]float64{"PENDING": 20},
+		Failed:      []string{"FAILED"},
+		Deletable:   true,
+	}
+)
+
+// Parameters shared by many tools.
+var (
+	limitParam     = toolParam{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of results to return"}
+	offsetParam    = toolParam{Name: "offset", In: "query", Type: "integer", Description: "Number of results to skip"}
+	skuParam       = toolParam{Name: "sku", In: "path", Type: "string", Required: true, Description: "Seller-defined SKU of the inventory item"}
+	offerParam     = toolParam{Name: "offer_id", In: "path", Type: "string", Required: true, Description: "ID of the offer"}
+	orderParam     = toolParam{Name: "order_id", In: "path", Type: "string", Required: true, Description: "ID of the order"}
+	promotionParam = toolParam{Name: "promotion_id", In: "path", Type: "string", Required: true, Description: "ID of the promotion"}
+	policyParam    = toolParam{Name: "policy_id", In: "path", Type: "string", Required: true, Description: "ID of the business policy"}
+	treeParam      = toolParam{Name: "category_tree_id", In: "path", Type: "string", Required: true, Description: "Category tree ID from getDefaultCategoryTreeId"}
+)
+
+var toolRegistry = []toolRoute{
+	{
+		Name: "searchItems", Method: http.MethodGet, Path: "/buy/browse/v1/item_summary/search",
+		Summary:     "Search eBay listings",
+		Description: "Searches active eBay listings by keyword, category or GTIN.",
+		Params: []toolParam{
+			{Name: "q", In: "query", Type: "string", Description: "Keywords to search for"},
+			{Name: "category_ids", In: "query", Type: "string", Description: "Comma-separated category IDs"},
+			{Name: "gtin", In: "query", Type: "string", Description: "GTIN (UPC, EAN or ISBN) of the product"},
+			{Name: "filter", In: "query", Type: "string", Description: "eBay filter expression, e.g. price:[10..50],priceCurrency:USD"},
+			{Name: "sort", In: "query", Type: "string", Description: "Sort order, e.g. price or -price"},
+			limitParam, offsetParam,
+		},
+	},
+	{
+		Name: "getItem", Method: http.MethodGet, Path: "/buy/browse/v1/item/{item_id}",
+		Summary:     "Get an eBay listing",
+		Description: "Returns the details of a listing by its RESTful item ID (e.g. v1|123456789|0).",
+		Params:      []toolParam{{Name: "item_id", In: "path", Type: "string", Required: true, Description: "RESTful item ID"}},
+	},
+	{
+		Name: "getItemByLegacyId", Method: http.MethodGet, Path: "/buy/browse/v1/item/get_item_by_legacy_id",
+		Summary: "Get an eBay listing by its legacy item number",
+		Params:  []toolParam{{Name: "legacy_item_id", In: "query", Type: "string", Required: true, Description: "Item number shown on the eBay listing page"}},
+	},
+	{
+		Name: "getDealItems", Method: http.MethodGet, Path: "/buy/deal/v1/deal_item",
+		Summary:     "List eBay deals",
+		Description: "Returns items currently on an eBay Deals promotion, optionally in given categories.",
+		Params: []toolParam{
+			{Name: "category_ids", In: "query", Type: "string", Description: "Comma-separated category IDs"},
+			limitParam, offsetParam,
+		},
+	},
+	{
+		Name: "getDealEvents", Method: http.MethodGet, Path: "/buy/deal/v1/event",
+		Summary: "List eBay sales events",
+		Params:  []toolParam{limitParam, offsetParam},
+	},
+	{
+		Name: "getEventItems", Method: http.MethodGet, Path: "/buy/deal/v1/event_item",
+		Summary: "List the items of sales events",
+		Params: []toolParam{
+			{Name: "event_ids", In: "query", Type: "string", Required: true, Description: "Comma-separated event IDs from getDealEvents"},
+			limitParam, offsetParam,
+		},
+	},
+	{
+		Name: "getGuestPurchaseOrder", Method: http.MethodGet, Path: "/buy/order/v2/guest_purchase_order/{purchase_order_id}",
+		Summary:     "Track a purchase",
+		Description: "Returns a purchase order with the status and shipment tracking of each line item.",
+		Params:      []toolParam{{Name: "purchase_order_id", In: "path", Type: "string", Required: true, Description: "ID of the purchase order"}},
+	},
+	{
+		Name: "preparePurchase", Method: http.MethodPost, Path: purchasePreparePath, Local: true,
+		Summary:     "Prepare a bid or a guest checkout",
+		Description: "Prices a proxy bid on an auction or a guest checkout of a fixed-price item and checks it against the spend limits. Nothing is bought: it returns a summary and a confirmation_token for confirmPurchase. Show the summary to the user first.",
+		Body:        "type (bid or checkout) and item_id; for a bid max_amount {value, currency} and adult_only_consent if the item is adult-only; for a checkout quantity, contact_email and shipping_address {recipient, phoneNumber, addressLine1, city, stateOrProvince, postalCode, country}",
+	},
+	{
+		Name: "confirmPurchase", Method: http.MethodPost, Path: purchaseConfirmPath, Local: true,
+		Summary:     "Place a prepared bid or order",
+		Description: "Commits a purchase prepared by preparePurchase. Only call it after the user has explicitly agreed to that purchase's summary; the token works once.",
+		Body:        "confirmation_token from preparePurchase",
+	},
+	{
+		Name: "getInventoryItems", Method: http.MethodGet, Path: "/sell/inventory/v1/inventory_item",
+		Summary: "List the seller's inventory items",
+		Params:  []toolParam{limitParam, offsetParam},
+	},
+	{
+		Name: "getInventoryItem", Method: http.MethodGet, Path: "/sell/inventory/v1/inventory_item/{sku}",
+		Summary: "Get an inventory item",
+		Params:  []toolParam{skuParam},
+	},
+	{
+		Name: "createOrReplaceInventoryItem", Method: http.MethodPut, Path: "/sell/inventory/v1/inventory_item/{sku}",
+		Summary: "Create or replace an inventory item",
+		Params:  []toolParam{skuParam},
+		Body:    "InventoryItem: product details, condition and available quantity",
+	},
+	{
+		Name: "bulkCreateOrReplaceInventoryItem", Method: http.MethodPost, Path: "/sell/inventory/v1/bulk_create_or_replace_inventory_item",
+		Summary: "Create or replace up to 25 inventory items",
+		Body:    "BulkInventoryItem: a requests array of inventory items, each with its SKU",
+	},
+	{
+		Name: "bulkUpdatePriceQuantity", Method: http.MethodPost, Path: "/sell/inventory/v1/bulk_update_price_quantity",
+		Summary: "Update the price and quantity of up to 25 inventory items and their offers",
+		Body:    "BulkPriceQuantity: a requests array of SKUs with their new quantity and offer prices",
+	},
+	{
+		Name: "getOffers", Method: http.MethodGet, Path: "/sell/inventory/v1/offer",
+		Summary: "List the offers for an inventory item",
+		Params:  []toolParam{{Name: "sku", In: "query", Type: "string", Required: true, Description: "SKU of the inventory item"}, limitParam, offsetParam},
+	},
+	{
+		Name: "createOffer", Method: http.MethodPost, Path: "/sell/inventory/v1/offer",
+		Summary: "Create an offer for an inventory item",
+		Body:    "EbayOfferDetailsWithKeys: SKU, marketplace, format, price, category and listing policies",
+	},
+	{
+		Name: "publishOffer", Method: http.MethodPost, Path: "/sell/inventory/v1/offer/{offer_id}/publish",
+		Summary:     "Publish an offer as a live listing",
+		Description: "Creates a live eBay listing from an unpublished offer.",
+		Params:      []toolParam{offerParam},
+	},
+	{
+		Name: "withdrawOffer", Method: http.MethodPost, Path: "/sell/inventory/v1/offer/{offer_id}/withdraw",
+		Summary: "End the listing of a published offer",
+		Params:  []toolParam{offerParam},
+	},
+	{
+		Name: "getOrders", Method: http.MethodGet, Path: "/sell/fulfillment/v1/order",
+		Summary: "List the seller's orders",
+		Params: []toolParam{
+			{Name: "filter", In: "query", Type: "string", Description: "e.g. orderfulfillmentstatus:{NOT_STARTED|IN_PROGRESS}"},
+			limitParam, offsetParam,
+		},
+	},
+	{
+		Name: "getOrder", Method: http.MethodGet, Path: "/sell/fulfillment/v1/order/{order_id}",
+		Summary: "Get an order",
+		Params:  []toolParam{orderParam},
+	},
+	{
+		Name: "createShippingFulfillment", Method: http.MethodPost, Path: "/sell/fulfillment/v1/order/{order_id}/shipping_fulfillment",
+		Summary: "Mark order line items as shipped",
+		Params:  []toolParam{orderParam},
+		Body:    "ShippingFulfillmentDetails: line items, carrier code and tracking number",
+	},
+	{
+		Name: "createFeedTask", Method: http.MethodPost, Path: "/sell/feed/v1/task",
+		Summary:     "Start a bulk upload or download feed task",
+		Description: "Creates a Feed API task, e.g. an order report (LMS_ORDER_REPORT), and waits for it to finish.",
+		Body:        "CreateTaskRequest: feedType, schemaVersion and optional filterCriteria",
+		Task:        feedTaskPolling,
+	},
+	{
+		Name: "createInventoryTask", Method: http.MethodPost, Path: "/sell/feed/v1/inventory_task",
+		Summary:     "Start an active inventory report",
+		Description: "Creates a Feed API inventory task (LMS_ACTIVE_INVENTORY_REPORT) and waits for it to finish. Get the file with getFeedResultFile.",
+		Body:        "CreateInventoryTaskRequest: feedType, schemaVersion and optional filterCriteria {listingFormat}",
+		Task:        feedTaskPolling,
+	},
+	{
+		Name: "createOrderTask", Method: http.MethodPost, Path: "/sell/feed/v1/order_task",
+		Summary:     "Start an order report",
+		Description: "Creates a Feed API order task (LMS_ORDER_REPORT) for orders created or modified in a date range, and waits for it to finish. Get the file with getFeedResultFile.",
+		Body:        "CreateOrderTaskRequest: feedType, schemaVersion and filterCriteria {creationDateRange or modifiedDateRange, orderStatus}",
+		Task:        feedTaskPolling,
+	},
+	{
+		Name: "getFeedTaskStatus", Method: http.MethodGet, Path: feedTasksPath + "/{task_id}", Local: true,
+		Summary:     "Check a feed task",
+		Description: "Returns a Feed API task's status and progress, whether it is done, its upload summary, and what to do next: upload its input file or download its result.",
+		Params: []toolParam{
+			{Name: "task_id", In: "path", Type: "string", Required: true, Description: "ID of the feed task"},
+			{Name: "task_type", In: "query", Type: "string", Description: "task (default, createFeedTask), inventory_task (createInventoryTask) or order_task (createOrderTask)"},
+		},
+	},
+	{
+		Name: "getFeedTask", Method: http.MethodGet, Path: "/sell/feed/v1/task/{task_id}",
+		Summary: "Get the status of a feed task",
+		Params:  []toolParam{{Name: "task_id", In: "path", Type: "string", Required: true, Description: "ID of the feed task"}},
+	},
+	{
+		Name: "getFeedResultFile", Method: http.MethodGet, Path: "/sell/feed/v1/task/{task_id}/download_result_file",
+		Summary:     "Download the result file of a completed feed task",
+		Description: "Returns a download link for the file rather than its contents.",
+		Params:      []toolParam{{Name: "task_id", In: "path", Type: "string", Required: true, Description: "ID of the feed task"}},
+	},
+	{
+		Name: "createReportTask", Method: http.MethodPost, Path: "/sell/marketing/v1/ad_report_task",
+		Summary:     "Generate a Promoted Listings report",
+		Description: "Creates a Marketing API report task and waits for the report to be generated.",
+		Body:        "CreateReportTask: reportType, dateFrom, dateTo, marketplaceId, dimensions and metricKeys",
+		Task:        reportTaskPolling,
+	},
+	{
+		Name: "getPromotions", Method: http.MethodGet, Path: "/sell/marketing/v1/promotion",
+		Summary: "List the seller's promotions",
+		Params: []toolParam{
+			{Name: "marketplace_id", In: "query", Type: "string", Required: true, Description: "eBay marketplace, e.g. EBAY_US"},
+			{Name: "promotion_status", In: "query", Type: "string", Description: "Only promotions in this status", Enum: []string{"DRAFT", "SCHEDULED", "RUNNING", "PAUSED", "ENDED"}},
+			{Name: "promotion_type", In: "query", Type: "string", Description: "Only promotions of this type", Enum: []string{"MARKDOWN_SALE", "CODED_COUPON", "ORDER_DISCOUNT", "VOLUME_DISCOUNT"}},
+			limitParam, offsetParam,
+		},
+	},
+	{
+		Name: "createItemPriceMarkdown", Method: http.MethodPost, Path: "/sell/marketing/v1/item_price_markdown",
+		Summary:     "Create a markdown sale",
+		Description: "Schedules a percentage or amount off selected listings between a start and end date (at most 45 days). The request is checked against eBay's rules first.",
+		Body:        "ItemPriceMarkdown: name, marketplaceId, startDate, endDate, promotionStatus (DRAFT or SCHEDULED) and selectedInventoryDiscounts (discountBenefit and inventoryCriterion)",
+	},
+	{
+		Name: "getItemPriceMarkdown", Method: http.MethodGet, Path: "/sell/marketing/v1/item_price_markdown/{promotion_id}",
+		Summary: "Get a markdown sale",
+		Params:  []toolParam{promotionParam},
+	},
+	{
+		Name: "updateItemPriceMarkdown", Method: http.MethodPut, Path: "/sell/marketing/v1/item_price_markdown/{promotion_id}",
+		Summary: "Replace a markdown sale",
+		Params:  []toolParam{promotionParam},
+		Body:    "ItemPriceMarkdown: the complete sale, as for createItemPriceMarkdown",
+	},
+	{
+		Name: "deleteItemPriceMarkdown", Method: http.MethodDelete, Path: "/sell/marketing/v1/item_price_markdown/{promotion_id}",
+		Summary: "Delete a draft, scheduled or ended markdown sale",
+		Params:  []toolParam{promotionParam},
+	},
+	{
+		Name: "createItemPromotion", Method: http.MethodPost, Path: "/sell/marketing/v1/item_promotion",
+		Summary:     "Create a coded coupon, order or volume discount",
+		Description: "Creates a promotion of type CODED_COUPON, ORDER_DISCOUNT or VOLUME_DISCOUNT. The request is checked against eBay's rules first.",
+		Body:        "ItemPromotion: name, marketplaceId, promotionType, startDate, endDate, promotionStatus, discountRules, inventoryCriterion and, for coupons, couponConfiguration (couponCode, couponType)",
+	},
+	{
+		Name: "getItemPromotion", Method: http.MethodGet, Path: "/sell/marketing/v1/item_promotion/{promotion_id}",
+		Summary: "Get a coded coupon, order or volume discount",
+		Params:  []toolParam{promotionParam},
+	},
+	{
+		Name: "updateItemPromotion", Method: http.MethodPut, Path: "/sell/marketing/v1/item_promotion/{promotion_id}",
+		Summary: "Replace a coded coupon, order or volume discount",
+		Params:  []toolParam{promotionParam},
+		Body:    "ItemPromotion: the complete promotion, as for createItemPromotion",
+	},
+	{
+		Name: "deleteItemPromotion", Method: http.MethodDelete, Path: "/sell/marketing/v1/item_promotion/{promotion_id}",
+		Summary: "Delete a draft, scheduled or ended promotion",
+		Params:  []toolParam{promotionParam},
+	},
+	{
+		Name: "pausePromotion", Method: http.MethodPost, Path: "/sell/marketing/v1/promotion/{promotion_id}/pause",
+		Summary: "Pause a running promotion",
+		Params:  []toolParam{promotionParam},
+	},
+	{
+		Name: "resumePromotion", Method: http.MethodPost, Path: "/sell/marketing/v1/promotion/{promotion_id}/resume",
+		Summary: "Resume a paused promotion",
+		Params:  []toolParam{promotionParam},
+	},
+	{
+		Name: "getUnsoldListingReport", Method: http.MethodGet, Path: unsoldReportPath, Local: true,
+		Summary:     "Triage listings that ended without a sale",
+		Description: "Lists the seller's listings that ended unsold with their views, watchers and the prices of comparable active listings, and recommends what to relist and at what price.",
+		Params: []toolParam{
+			{Name: "days", In: "query", Type: "integer", Description: "Days to look back, up to 60 (default 30)"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of listings, up to 100 (default 25)"},
+		},
+	},
+	{
+		Name: "tradingGetMyeBaySelling", Method: http.MethodPost, Path: tradingBridgePath + "/GetMyeBaySelling", Local: true,
+		Summary:     "Get the seller's My eBay selling lists",
+		Description: "Trading API GetMyeBaySelling: active, sold, unsold and scheduled listings with their bids, watchers and questions.",
+		Body:        "Any of ActiveList, SoldList, UnsoldList, ScheduledList, each {\"Include\": true, \"Pagination\": {\"EntriesPerPage\": 25, \"PageNumber\": 1}}, and DetailLevel",
+	},
+	{
+		Name: "tradingGetItem", Method: http.MethodPost, Path: tradingBridgePath + "/GetItem", Local: true,
+		Summary:     "Get a listing through the Trading API",
+		Description: "Trading API GetItem: every detail of one of the seller's listings, including fields the Browse API leaves out.",
+		Body:        "ItemID, and optional DetailLevel (ReturnAll) and IncludeItemSpecifics",
+	},
+	{
+		Name: "tradingGetSellerList", Method: http.MethodPost, Path: tradingBridgePath + "/GetSellerList", Local: true,
+		Summary:     "List the seller's listings by start or end date",
+		Description: "Trading API GetSellerList: the seller's listings that started or end in a window of up to 120 days.",
+		Body:        "StartTimeFrom and StartTimeTo, or EndTimeFrom and EndTimeTo, as ISO 8601 times; Pagination {EntriesPerPage, PageNumber}; optional GranularityLevel",
+	},
+	{
+		Name: "tradingGetSellerTransactions", Method: http.MethodPost, Path: tradingBridgePath + "/GetSellerTransactions", Local: true,
+		Summary:     "List the seller's sales",
+		Description: "Trading API GetSellerTransactions: sales of the last 30 days or a modification window, with buyer and payment details.",
+		Body:        "Optional ModTimeFrom and ModTimeTo or NumberOfDays, and Pagination {EntriesPerPage, PageNumber}",
+	},
+	{
+		Name: "tradingGetMyMessages", Method: http.MethodPost, Path: tradingBridgePath + "/GetMyMessages", Local: true,
+		Summary:     "Read the seller's eBay messages",
+		Description: "Trading API GetMyMessages: message headers or bodies from the seller's inbox.",
+		Body:        "DetailLevel (ReturnHeaders or ReturnMessages), and optional FolderID, MessageIDs {MessageID: [...]}, StartTime and EndTime",
+	},
+	{
+		Name: "tradingGetFeedback", Method: http.MethodPost, Path: tradingBridgePath + "/GetFeedback", Local: true,
+		Summary:     "Get the seller's feedback",
+		Description: "Trading API GetFeedback: feedback received or left, with its summary.",
+		Body:        "Optional UserID, FeedbackType (FeedbackReceivedAsSeller, ...), DetailLevel (ReturnAll) and Pagination",
+	},
+	{
+		Name: "tradingGetStore", Method: http.MethodPost, Path: tradingBridgePath + "/GetStore", Local: true,
+		Summary:     "Get the seller's eBay Store",
+		Description: "Trading API GetStore: the store's name, theme and custom categories.",
+		Body:        "Optional CategoryStructureOnly, RootCategoryID and LevelLimit",
+	},
+	{
+		Name: "tradingReviseItem", Method: http.MethodPost, Path: tradingBridgePath + "/ReviseItem", Local: true,
+		Summary:     "Revise a listing through the Trading API",
+		Description: "Trading API ReviseItem: changes fields of an active listing, including listings not managed through the Inventory API.",
+		Body:        "Item {ItemID and the fields to change, e.g. Title, StartPrice {\"@currencyID\", \"#text\"}, Quantity}, and optional DeletedField",
+	},
+	{
+		Name: "tradingReviseFixedPriceItem", Method: http.MethodPost, Path: tradingBridgePath + "/ReviseFixedPriceItem", Local: true,
+		Summary:     "Revise a fixed-price listing through the Trading API",
+		Description: "Trading API ReviseFixedPriceItem: changes fields of an active fixed-price listing, including its variations.",
+		Body:        "Item {ItemID or SKU, and the fields to change}, and optional DeletedField",
+	},
+	{
+		Name: "tradingReviseInventoryStatus", Method: http.MethodPost, Path: tradingBridgePath + "/ReviseInventoryStatus", Local: true,
+		Summary:     "Change the price or quantity of listings",
+		Description: "Trading API ReviseInventoryStatus: updates the price and quantity of up to 4 listings or variations in one call.",
+		Body:        "InventoryStatus: [{ItemID or SKU, StartPrice, Quantity}], up to 4",
+	},
+	{
+		Name: "tradingEndItem", Method: http.MethodPost, Path: tradingBridgePath + "/EndItem", Local: true,
+		Summary:     "End a listing early",
+		Description: "Trading API EndItem: ends an active listing before its scheduled end.",
+		Body:        "ItemID and EndingReason (NotAvailable, LostOrBroken, Incorrect, OtherListingError or SellToHighBidder)",
+	},
+	{
+		Name: "tradingRelistItem", Method: http.MethodPost, Path: tradingBridgePath + "/RelistItem", Local: true,
+		Summary:     "Relist an ended auction or listing",
+		Description: "Trading API RelistItem: relists an ended listing, optionally changing its fields. Returns the new ItemID.",
+		Body:        "Item {ItemID and any fields to change}, and optional DeletedField",
+	},
+	{
+		Name: "tradingRelistFixedPriceItem", Method: http.MethodPost, Path: tradingBridgePath + "/RelistFixedPriceItem", Local: true,
+		Summary:     "Relist an ended fixed-price listing",
+		Description: "Trading API RelistFixedPriceItem: relists an ended fixed-price listing, optionally changing its fields. Returns the new ItemID.",
+		Body:        "Item {ItemID or SKU, and any fields to change}, and optional DeletedField",
+	},
+	{
+		Name: "listOrders", Method: http.MethodGet, Path: ordersPath, Local: true,
+		Summary:     "List the seller's orders by status and date, slimmed",
+		Description: "Lists orders with their buyer, total, line items and shipping status, e.g. the unshipped orders of the last week, without writing getOrders filters.",
+		Params: []toolParam{
+			{Name: "status", In: "query", Type: "string", Description: "unshipped (default), shipped or all"},
+			{Name: "days", In: "query", Type: "integer", Description: "Days to look back, up to 730 (default 30)"},
+			{Name: "created_from", In: "query", Type: "string", Description: "Start of the creation date range instead of days, e.g. 2026-05-01"},
+			{Name: "created_to", In: "query", Type: "string", Description: "End of the creation date range"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of orders, up to 200 (default 25)"},
+			offsetParam,
+		},
+	},
+	{
+		Name: "getOrderSummary", Method: http.MethodGet, Path: ordersPath + "/{order_id}", Local: true,
+		Summary: "Get an order, slimmed",
+		Params:  []toolParam{orderParam},
+	},
+	{
+		Name: "markOrderShipped", Method: http.MethodPost, Path: ordersPath + "/{order_id}/shipment", Local: true,
+		Summary:     "Mark an order shipped with a tracking number",
+		Description: "Adds the tracking number to the order's line items that aren't shipped yet, or to line_item_ids, and returns the shipping fulfillment.",
+		Params:      []toolParam{orderParam},
+		Body:        "tracking_number, carrier (eBay carrier code, e.g. USPS, UPS, FEDEX), optional line_item_ids and shipped_date",
+	},
+	{
+		Name: "createListing", Method: http.MethodPost, Path: createListingPath, Local: true,
+		Summary:     "List an item on eBay in one call",
+		Description: "Creates the inventory item and offer from a flat description and publishes it, picking the category, the seller's default policies and inventory location unless given, and undoing every step if one fails. Returns the listing_id. Use dry_run to preview.",
+		Body:        "title, description, price, image_urls and the category's required aspects; optional sku, category_id, condition, quantity, currency, brand, mpn, upc, ean, format, listing_duration, *_policy_id, merchant_location_key, location {country, postal_code}, overwrite (replace an existing inventory item of sku that has no offer) and dry_run",
+	},
+	{
+		Name: "uploadImage", Method: http.MethodPost, Path: imagesPath, Local: true,
+		Summary:     "Host a listing photo on eBay",
+		Description: "Uploads an image to eBay Picture Services and returns its image_url for an inventory item's imageUrls or createListing's image_urls. JPEG, PNG, GIF, BMP, TIFF, WEBP, HEIC or AVIF, up to 12 MB and at least 500 pixels on the longest side.",
+		Body:        "image_url (a public http or https URL to fetch) or image_base64 (optionally a data: URL), and optional file_name",
+	},
+	{
+		Name: "getFulfillmentPolicies", Method: http.MethodGet, Path: "/sell/account/v1/fulfillment_policy",
+		Summary: "List the seller's shipping policies",
+		Params:  []toolParam{{Name: "marketplace_id", In: "query", Type: "string", Required: true, Description: "eBay marketplace, e.g. EBAY_US"}},
+	},
+	{
+		Name: "getPaymentPolicies", Method: http.MethodGet, Path: "/sell/account/v1/payment_policy",
+		Summary: "List the seller's payment policies",
+		Params:  []toolParam{{Name: "marketplace_id", In: "query", Type: "string", Required: true, Description: "eBay marketplace, e.g. EBAY_US"}},
+	},
+	{
+		Name: "getReturnPolicies", Method: http.MethodGet, Path: "/sell/account/v1/return_policy",
+		Summary: "List the seller's return policies",
+		Params:  []toolParam{{Name: "marketplace_id", In: "query", Type: "string", Required: true, Description: "eBay marketplace, e.g. EBAY_US"}},
+	},
+	{
+		Name: "getFulfillmentPolicy", Method: http.MethodGet, Path: "/sell/account/v1/fulfillment_policy/{policy_id}",
+		Summary: "Get a shipping policy",
+		Params:  []toolParam{policyParam},
+	},
+	{
+		Name: "createFulfillmentPolicy", Method: http.MethodPost, Path: "/sell/account/v1/fulfillment_policy",
+		Summary: "Create a shipping policy",
+		Body:    "FulfillmentPolicyRequest: name, marketplaceId, categoryTypes, handlingTime and shippingOptions",
+	},
+	{
+		Name: "updateFulfillmentPolicy", Method: http.MethodPut, Path: "/sell/account/v1/fulfillment_policy/{policy_id}",
+		Summary: "Replace a shipping policy",
+		Params:  []toolParam{policyParam},
+		Body:    "FulfillmentPolicyRequest: the complete policy, as for createFulfillmentPolicy",
+	},
+	{
+		Name: "deleteFulfillmentPolicy", Method: http.MethodDelete, Path: "/sell/account/v1/fulfillment_policy/{policy_id}",
+		Summary: "Delete a shipping policy no offer uses",
+		Params:  []toolParam{policyParam},
+	},
+	{
+		Name: "getPaymentPolicy", Method: http.MethodGet, Path: "/sell/account/v1/payment_policy/{policy_id}",
+		Summary: "Get a payment policy",
+		Params:  []toolParam{policyParam},
+	},
+	{
+		Name: "createPaymentPolicy", Method: http.MethodPost, Path: "/sell/account/v1/payment_policy",
+		Summary: "Create a payment policy",
+		Body:    "PaymentPolicyRequest: name, marketplaceId, categoryTypes and immediatePay",
+	},
+	{
+		Name: "updatePaymentPolicy", Method: http.MethodPut, Path: "/sell/account/v1/payment_policy/{policy_id}",
+		Summary: "Replace a payment policy",
+		Params:  []toolParam{policyParam},
+		Body:    "PaymentPolicyRequest: the complete policy, as for createPaymentPolicy",
+	},
+	{
+		Name: "deletePaymentPolicy", Method: http.MethodDelete, Path: "/sell/account/v1/payment_policy/{policy_id}",
+		Summary: "Delete a payment policy no offer uses",
+		Params:  []toolParam{policyParam},
+	},
+	{
+		Name: "getReturnPolicy", Method: http.MethodGet, Path: "/sell/account/v1/return_policy/{policy_id}",
+		Summary: "Get a return policy",
+		Params:  []toolParam{policyParam},
+	},
+	{
+		Name: "createReturnPolicy", Method: http.MethodPost, Path: "/sell/account/v1/return_policy",
+		Summary: "Create a return policy",
+		Body:    "ReturnPolicyRequest: name, marketplaceId, categoryTypes, returnsAccepted, returnPeriod and returnShippingCostPayer",
+	},
+	{
+		Name: "updateReturnPolicy", Method: http.MethodPut, Path: "/sell/account/v1/return_policy/{policy_id}",
+		Summary: "Replace a return policy",
+		Params:  []toolParam{policyParam},
+		Body:    "ReturnPolicyRequest: the complete policy, as for createReturnPolicy",
+	},
+	{
+		Name: "deleteReturnPolicy", Method: http.MethodDelete, Path: "/sell/account/v1/return_policy/{policy_id}",
+		Summary: "Delete a return policy no offer uses",
+		Params:  []toolParam{policyParam},
+	},
+	{
+		Name: "getPrivileges", Method: http.MethodGet, Path: "/sell/account/v1/privilege",
+		Summary:     "Get the seller's registration status and selling limits",
+		Description: "Tells whether the account may sell at all and how many items, or how much, it may list.",
+	},
+	{
+		Name: "getOptedInPrograms", Method: http.MethodGet, Path: "/sell/account/v1/program/get_opted_in_programs",
+		Summary: "List the seller programs the seller joined",
+	},
+	{
+		Name: "optInToProgram", Method: http.MethodPost, Path: "/sell/account/v1/program/opt_in",
+		Summary: "Join a seller program",
+		Body:    "Program: programType, e.g. SELLING_POLICY_MANAGEMENT for business policies",
+	},
+	{
+		Name: "setupSellerAccount", Method: http.MethodPost, Path: sellerSetupPath, Local: true,
+		Summary:     "Prepare a first-time seller's account for listing",
+		Description: "Checks the seller's privileges, joins business policies and reuses or creates a shipping, a payment and a return policy, returning the listingPolicies for createOffer. Use dry_run to preview.",
+		Body:        "All optional: handling_time_days, shipping_service, shipping_cost (free shipping when empty), returns_accepted, return_days, return_shipping_paid_by and dry_run",
+	},
+	{
+		Name: "getTransactions", Method: http.MethodGet, Path: "/sell/finances/v1/transaction",
+		Summary: "List the seller's monetary transactions",
+		Params:  []toolParam{{Name: "filter", In: "query", Type: "string", Description: "e.g. transactionDate:[2024-01-01T00:00:00.000Z..]"}, limitParam, offsetParam},
+	},
+	{
+		Name: "getPayouts", Method: http.MethodGet, Path: "/sell/finances/v1/payout",
+		Summary: "List the seller's payouts",
+		Params:  []toolParam{limitParam, offsetParam},
+	},
+	{
+		Name: "getUser", Method: http.MethodGet, Path: "/commerce/identity/v1/user",
+		Summary: "Get the connected eBay account",
+	},
+	{
+		Name: "getDefaultCategoryTreeId", Method: http.MethodGet, Path: "/commerce/taxonomy/v1/get_default_category_tree_id",
+		Summary: "Get the category tree ID of a marketplace",
+		Params:  []toolParam{{Name: "marketplace_id", In: "query", Type: "string", Required: true, Description: "eBay marketplace, e.g. EBAY_US"}},
+	},
+	{
+		Name: "getCategorySuggestions", Method: http.MethodGet, Path: "/commerce/taxonomy/v1/category_tree/{category_tree_id}/get_category_suggestions",
+		Summary: "Suggest leaf categories for a product description",
+		Params:  []toolParam{treeParam, {Name: "q", In: "query", Type: "string", Required: true, Description: "Product keywords"}},
+	},
+	{
+		Name: "getItemAspectsForCategory", Method: http.MethodGet, Path: "/commerce/taxonomy/v1/category_tree/{category_tree_id}/get_item_aspects_for_category",
+		Summary: "List the item specifics a category requires",
+		Params:  []toolParam{treeParam, {Name: "category_id", In: "query", Type: "string", Required: true, Description: "Leaf category ID"}},
+	},
+	{
+		Name: "get_category_suggestions", Method: http.MethodGet, Path: categoriesPath + "/suggestions", Local: true,
+		Summary:     "Find the leaf category to list a product in",
+		Description: "Suggests leaf categories of the marketplace for a product, each with its categoryId and full path. Prefer it to guessing a categoryId.",
+		Params: []toolParam{
+			{Name: "q", In: "query", Type: "string", Required: true, Description: "Product keywords, e.g. iphone 13 128gb"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of categories, up to 50 (default 10)"},
+		},
+	},
+	{
+		Name: "get_item_aspects_for_category", Method: http.MethodGet, Path: categoriesPath + "/{category_id}/aspects", Local: true,
+		Summary:     "List the item specifics a leaf category requires",
+		Description: "Lists the aspects (item specifics) of a leaf category, required ones first, with their allowed values. Listings must set every required aspect.",
+		Params:      []toolParam{{Name: "category_id", In: "path", Type: "string", Required: true, Description: "Leaf category ID from get_category_suggestions"}},
+	},
+	{
+		Name: "research_sold_prices", Method: http.MethodGet, Path: soldPricesPath, Local: true,
+		Summary:     "Research what a product sold for recently",
+		Description: "Summarizes the marketplace's sales of the last days: how many listings sold, the low, quartiles, median, high and mean sold price, the most recent sales and, where eBay reports unsold listings too, the sell-through rate. Use it to advise on pricing instead of asking prices.",
+		Params: []toolParam{
+			{Name: "q", In: "query", Type: "string", Description: "Product keywords, e.g. iphone 13 128gb (q or category_id is required)"},
+			{Name: "category_id", In: "query", Type: "string", Description: "Category ID to search in"},
+			{Name: "condition", In: "query", Type: "string", Description: "Only sales in this condition", Enum: []string{"new", "used"}},
+			{Name: "days", In: "query", Type: "integer", Description: "How many days to look back, up to 90 (default 90)"},
+			{Name: "limit", In: "query", Type: "integer", Description: "How many sales to sample, up to 100 (default 100)"},
+		},
+	},
+}
+
+// ToolEnabled reports whether the policy enables a tool. Tools the policy
+// doesn't mention are enabled.
+func (p *Policy) ToolEnabled(name string) bool {
+	for _, t := range p.Tools {
+		if t.Name == name {
+			return t.Enabled
+		}
+	}
+	return true
+}
+
+// enabledTools returns the tools p exposes: enabled and, unless local, on an
+// allowed route.
+func enabledTools(p *Policy) []toolRoute {
+	var tools []toolRoute
+	for _, t := range toolRegistry {
+		if p.ToolEnabled(t.Name) && (t.Local || p.AllowPath(t.Method, t.Path) == nil) {
+			tools = append(tools, t)
+		}
+	}
+	return tools
+}
@@ -0,0 +1,136 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ### Trading API ############################################################
+
+// Some seller workflows, such as answering Best Offers, only exist in eBay's
+// XML Trading API. Calls go to /ws/api.dll on the environment's API host and
+// authenticate with the OAuth user token in X-EBAY-API-IAF-TOKEN.
+
+const (
+	tradingAPIPath            = "/ws/api.dll"
+	tradingCompatibilityLevel = "1349"
+	tradingNamespace          = "urn:ebay:apis:eBLBaseComponents"
+	tradingTimeout            = 30 * time.Second
+)
+
+// tradingSiteIDs maps marketplaces to Trading API site IDs.
+var tradingSiteIDs = map[string]string{
+	"EBAY_US":        "0",
+	"EBAY_MOTORS_US": "100",
+	"EBAY_CA":        "2",
+	"EBAY_GB":        "3",
+	"EBAY_AU":        "15",
+	"EBAY_AT":        "16",
+	"EBAY_BE":        "23",
+	"EBAY_FR":        "71",
+	"EBAY_DE":        "77",
+	"EBAY_IT":        "101",
+	"EBAY_NL":        "146",
+	"EBAY_ES":        "186",
+	"EBAY_CH":        "193",
+	"EBAY_HK":        "201",
+	"EBAY_IE":        "205",
+	"EBAY_MY":        "207",
+	"EBAY_PH":        "211",
+	"EBAY_PL":        "212",
+	"EBAY_SG":        "216",
+}
+
+// tradingAmount is an amount with its currencyID attribute.
+type tradingAmount struct {
+	Currency string  `xml:"currencyID,attr"`
+	Value    float64 `xml:",chardata"`
+}
+
+// tradingAck is the status part every Trading API response has.
+type tradingAck struct {
+	Ack    string `xml:"Ack"`
+	Errors []struct {
+		ShortMessage string `xml:"ShortMessage"`
+		LongMessage  string `xml:"LongMessage"`
+		ErrorCode    string `xml:"ErrorCode"`
+		SeverityCode string `xml:"SeverityCode"`
+	} `xml:"Errors"`
+}
+
+// err returns the response's errors, ignoring warnings.
+func (a *tradingAck) err(call string) error {
+	if a.Ack != "Failure" && a.Ack != "PartialFailure" {
+		return nil
+	}
+	var messages []string
+	for _, e := range a.Errors {
+		if e.SeverityCode == "Warning" {
+			continue
+		}
+		msg := e.LongMessage
+		if msg == "" {
+			msg = e.ShortMessage
+		}
+		messages = append(messages, fmt.Sprintf("%s (%s)", msg, e.ErrorCode))
+	}
+	return fmt.Errorf("%s failed: %s", call, strings.Join(messages, "; "))
+}
+
+// tradingCall sends the XML request of call and decodes the response into
+// resp, which must embed tradingAck. The request's root element must carry
+// tradingNamespace.
+func tradingCall(ctx context.Context, env *ebayEnvironment, token, marketplace, call string, req interface{}, resp interface{ ack() *tradingAck }) error {
+	payload, err := xml.Marshal(req)
+	if err != nil {
+		return err
+	}
+	data, status, err := tradingPost(ctx, env, token, marketplace, call, payload)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, resp); err != nil {
+		return fmt.Errorf("%s returned status %d and an unreadable body: %w", call, status, err)
+	}
+	return resp.ack().err(call)
+}
+
+// tradingPost sends the XML document payload as call and returns the
+// response body and status. Trading API failures come back as documents
+// with an Ack of Failure, usually with status 200.
+func tradingPost(ctx context.Context, env *ebayEnvironment, token, marketplace, call string, payload []byte) ([]byte, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, tradingTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+env.APIHost+tradingAPIPath,
+		bytes.NewReader(append([]byte(xml.Header), payload...)))
+	if err != nil {
+		return nil, 0, err
+	}
+	siteID, ok := tradingSiteIDs[marketplace]
+	if !ok {
+		siteID = tradingSiteIDs[defaultMarketplace]
+	}
+	httpReq.Header.Set("Content-Type", "text/xml")
+	httpReq.Header.Set("X-EBAY-API-CALL-NAME", call)
+	httpReq.Header.Set("X-EBAY-API-SITEID", siteID)
+	httpReq.Header.Set("X-EBAY-API-COMPATIBILITY-LEVEL", tradingCompatibilityLevel)
+	httpReq.Header.Set("X-EBAY-API-IAF-TOKEN", token)
+
+	httpResp, err := (&http.Client{Transport: ebayTransport}).Do(httpReq)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s failed: %w", call, err)
+	}
+	defer httpResp.Body.Close()
+	data, err := readLimited(httpResp.Body, maxResponseBufferSize)
+	if err != nil {
+		return nil, httpResp.StatusCode, fmt.Errorf("%s failed: %w", call, err)
+	}
+	return data, httpResp.StatusCode, nil
+}
+
+func (a *tradingAck) ack() *tradingAck { return a }
@@ -0,0 +1,418 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ### Trading Bridge #########################################################
+
+// Some seller features, such as the details of GetMyeBaySelling or revising
+// listings that predate the Inventory API, only exist in the XML Trading
+// API. The bridge (POST /trading/{CallName}) takes the call's fields as
+// JSON, renders the XML request, sends it with the account's OAuth token in
+// X-EBAY-API-IAF-TOKEN and answers with the response as JSON:
+//
+//	POST /trading/ReviseFixedPriceItem
+//	{"Item": {"ItemID": "110012345678", "StartPrice": {"@currencyID": "USD", "#text": "19.99"}}}
+//
+// Object keys become elements in the order given, arrays repeat their
+// element, and "@name" and "#text" keys hold attributes and text. In
+// responses an element appears as an array only when it repeats, and every
+// value is a string. Only the calls in tradingBridgeCalls are bridged. The
+// policy's paths see them as /ws/api.dll/{CallName}, GET for reads and POST
+// for writes, so a rule for the prefix /ws/api.dll/ with methods [GET]
+// allows only the reads.
+
+const tradingBridgePath = "/trading"
+
+// tradingBridgeCalls are the bridged calls; true marks those that change
+// the account.
+var tradingBridgeCalls = map[string]bool{
+	"GetMyeBaySelling":      false,
+	"GetItem":               false,
+	"GetSellerList":         false,
+	"GetSellerTransactions": false,
+	"GetMyMessages":         false,
+	"GetFeedback":           false,
+	"GetStore":              false,
+	"ReviseItem":            true,
+	"ReviseFixedPriceItem":  true,
+	"ReviseInventoryStatus": true,
+	"EndItem":               true,
+	"RelistItem":            true,
+	"RelistFixedPriceItem":  true,
+}
+
+// tradingAuthErrors are the Trading API error codes of a token eBay
+// doesn't accept.
+var tradingAuthErrors = map[string]bool{"931": true, "932": true, "16110": true, "21916984": true}
+
+// handleTradingBridge sends a Trading API call given as JSON.
+// POST /trading/{CallName}
+func handleTradingBridge(w http.ResponseWriter, r *http.Request) {
+	call := strings.Trim(strings.TrimPrefix(r.URL.Path, tradingBridgePath), "/")
+	write, ok := tradingBridgeCalls[call]
+	if !ok {
+		calls := make([]string, 0, len(tradingBridgeCalls))
+		for name := range tradingBridgeCalls {
+			calls = append(calls, name)
+		}
+		sort.Strings(calls)
+		http.Error(w, fmt.Sprintf("Unknown Trading API call %q (available: %s)", call, strings.Join(calls, ", ")), http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			writeBodyTooLarge(w, maxRequestBodySize)
+			return
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		body = []byte("{}")
+	}
+
+	method := http.MethodGet
+	if write {
+		method = http.MethodPost
+	}
+	if err := currentPolicy().AllowPath(method, tradingAPIPath+"/"+call); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	caller, status, err := resolveCaller(w, r)
+	if err != nil {
+		log.Printf("Failed to resolve token for the Trading bridge: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err := caller.allow(method, tradingAPIPath+"/"+call); err != nil {
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	payload, err := tradingRequestXML(call, body, caller.language)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	data, _, err := tradingPost(ctx, caller.env, caller.token, caller.marketplace, call, payload)
+	if err != nil {
+		log.Printf("Trading bridge call %s failed: %v", call, err)
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	doc, err := tradingResponseJSON(data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s returned an unreadable body: %v", call, err), http.StatusBadGateway)
+		return
+	}
+	var ack tradingAck
+	xml.Unmarshal(data, &ack)
+	delete(doc, "Ack")
+	delete(doc, "Errors")
+
+	resp := map[string]interface{}{"call": call, "ack": ack.Ack}
+	var problems, warnings []map[string]string
+	authFailed := false
+	for _, e := range ack.Errors {
+		item := map[string]string{"code": e.ErrorCode, "message": e.LongMessage, "severity": e.SeverityCode}
+		if item["message"] == "" {
+			item["message"] = e.ShortMessage
+		}
+		if e.SeverityCode == "Warning" {
+			warnings = append(warnings, item)
+			continue
+		}
+		problems = append(problems, item)
+		authFailed = authFailed || tradingAuthErrors[e.ErrorCode]
+	}
+	if len(warnings) > 0 {
+		resp["warnings"] = warnings
+	}
+	if ack.Ack == "Failure" {
+		resp["errors"] = problems
+		status := http.StatusBadRequest
+		if authFailed {
+			status = http.StatusUnauthorized
+		}
+		writeJSON(w, status, resp)
+		return
+	}
+	if len(problems) > 0 {
+		resp["errors"] = problems
+	}
+	if write {
+		audit.Record("trading."+call, map[string]string{
+			"ack":        ack.Ack,
+			"token_hash": tokenHash(caller.bearer),
+		})
+		caller.wrote(ctx)
+	}
+	resp["response"] = doc
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// tradingRequestXML renders the JSON object body as the XML request of
+// call. The proxy authenticates the call, so the body can't carry
+// credentials; ErrorLanguage defaults to the caller's language.
+func tradingRequestXML(call string, body []byte, language string) ([]byte, error) {
+	fields, err := jsonObjectFields(body)
+	if err != nil {
+		return nil, errors.New("Body must be a JSON object of the call's fields")
+	}
+	hasLanguage := false
+	for _, f := range fields {
+		switch f.key {
+		case "RequesterCredentials":
+			return nil, errors.New("RequesterCredentials can't be set: the proxy authenticates the call")
+		case "ErrorLanguage":
+			hasLanguage = true
+		}
+	}
+	if !hasLanguage && language != "" {
+		fields = append(fields, jsonField{"ErrorLanguage", json.RawMessage(strconv.Quote(strings.ReplaceAll(language, "-", "_")))})
+	}
+
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	root := xml.StartElement{
+		Name: xml.Name{Local: call + "Request"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: tradingNamespace}},
+	}
+	if err := enc.EncodeToken(root); err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		if strings.HasPrefix(f.key, "@") || f.key == "#text" {
+			return nil, fmt.Errorf("%s: the request itself takes no attributes or text", f.key)
+		}
+		if err := encodeTradingElement(enc, f.key, f.value); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.EncodeToken(root.End()); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonField is a member of a JSON object, kept in document order.
+type jsonField struct {
+	key   string
+	value json.RawMessage
+}
+
+// jsonObjectFields returns the members of the JSON object data in order.
+func jsonObjectFields(data []byte) ([]jsonField, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("not a JSON object")
+	}
+	var fields []jsonField
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		fields = append(fields, jsonField{tok.(string), value})
+	}
+	return fields, nil
+}
+
+// encodeTradingElement writes value as the element name: objects as
+// nested elements, arrays as repeated elements, and scalars as text.
+func encodeTradingElement(enc *xml.Encoder, name string, value json.RawMessage) error {
+	if !isXMLName(name) {
+		return fmt.Errorf("%q is not a valid element name", name)
+	}
+	value = bytes.TrimSpace(value)
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	switch {
+	case len(value) == 0 || string(value) == "null":
+		return nil
+	case value[0] == '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(value, &items); err != nil {
+			return err
+		}
+		for _, item := range items {
+			if bytes.HasPrefix(bytes.TrimSpace(item), []byte("[")) {
+				return fmt.Errorf("%s: arrays can't be nested", name)
+			}
+			if err := encodeTradingElement(enc, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case value[0] == '{':
+		fields, err := jsonObjectFields(value)
+		if err != nil {
+			return err
+		}
+		text := ""
+		var children []jsonField
+		for _, f := range fields {
+			switch {
+			case f.key == "#text":
+				if text, err = jsonScalar(f.value); err != nil {
+					return fmt.Errorf("%s.#text: %v", name, err)
+				}
+			case strings.HasPrefix(f.key, "@"):
+				attr, err := jsonScalar(f.value)
+				if err != nil || !isXMLName(f.key[1:]) {
+					return fmt.Errorf("%s.%s: attributes must be named and hold a string, number or boolean", name, f.key)
+				}
+				start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: f.key[1:]}, Value: attr})
+			default:
+				children = append(children, f)
+			}
+		}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		if text != "" {
+			if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+				return err
+			}
+		}
+		for _, c := range children {
+			if err := encodeTradingElement(enc, c.key, c.value); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	default:
+		text, err := jsonScalar(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		return enc.EncodeElement(text, start)
+	}
+}
+
+// jsonScalar returns a JSON string, number or boolean as text.
+func jsonScalar(value json.RawMessage) (string, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", errors.New("expected a string, number or boolean")
+}
+
+// isXMLName reports whether name can be used as a Trading API element or
+// attribute name.
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		letter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+		if !letter && (i == 0 || !(c >= '0' && c <= '9' || c == '-' || c == '.')) {
+			return false
+		}
+	}
+	return true
+}
+
+// tradingResponseJSON converts a Trading API response document to JSON
+// values: the root element's children as an object.
+func tradingResponseJSON(data []byte) (map[string]interface{}, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			value, err := decodeTradingElement(dec, start)
+			if err != nil {
+				return nil, err
+			}
+			if doc, ok := value.(map[string]interface{}); ok {
+				return doc, nil
+			}
+			return map[string]interface{}{}, nil
+		}
+	}
+}
+
+// decodeTradingElement reads the rest of the element start: text alone
+// becomes a string, anything else an object of its attributes ("@name"),
+// children (arrays when repeated) and text ("#text").
+func decodeTradingElement(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	obj := make(map[string]interface{})
+	for _, a := range start.Attr {
+		if a.Name.Local != "xmlns" && a.Name.Space != "xmlns" {
+			obj["@"+a.Name.Local] = a.Value
+		}
+	}
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			child, err := decodeTradingElement(dec, tok)
+			if err != nil {
+				return nil, err
+			}
+			name := tok.Name.Local
+			switch existing := obj[name].(type) {
+			case nil:
+				obj[name] = child
+			case []interface{}:
+				obj[name] = append(existing, child)
+			default:
+				obj[name] = []interface{}{existing, child}
+			}
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+			if len(obj) == 0 {
+				return s, nil
+			}
+			if s != "" {
+				obj["#text"] = s
+			}
+			return obj, nil
+		}
+	}
+}
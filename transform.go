@@ -0,0 +1,252 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ### Response Transformation ################################################
+
+// Browse and Sell responses are far larger than an assistant needs. A
+// response transform shrinks successful JSON responses before they reach the
+// client: it keeps only selected fields, drops verbose sections and
+// summarizes image arrays. Transforms come from the policy's `transforms`
+// rules and from the ?fields= query parameter, which overrides a rule's
+// field list.
+
+// fieldsParam selects fields per request, e.g. ?fields=itemId,title,price.
+const fieldsParam = "fields"
+
+// maxSummaryImageURLs is how many URLs an image summary keeps.
+const maxSummaryImageURLs = 3
+
+// paginationFields are kept at the top level whenever fields are selected,
+// so clients can still page through results.
+var paginationFields = map[string]bool{
+	"href": true, "total": true, "next": true, "prev": true,
+	"limit": true, "offset": true, "warnings": true,
+}
+
+// TransformRule shrinks responses for paths under Prefix. Fields are names
+// or dotted paths ("price.value") matched at any depth; Drop takes redaction
+// paths ("$..shortDescription").
+type TransformRule struct {
+	Prefix          string   `yaml:"prefix"`
+	Methods         []string `yaml:"methods,omitempty"`
+	Fields          []string `yaml:"fields,omitempty"`
+	Drop            []string `yaml:"drop,omitempty"`
+	SummarizeImages bool     `yaml:"summarize_images,omitempty"`
+}
+
+// responseTransform is a compiled transform for one request.
+type responseTransform struct {
+	fields          [][]string
+	drop            [][]pathStep
+	summarizeImages bool
+}
+
+// validate checks the rule at index i of the policy.
+func (t *TransformRule) validate(i int) []string {
+	var problems []string
+	if !strings.HasPrefix(t.Prefix, "/") {
+		problems = append(problems, fmt.Sprintf("transforms[%d]: prefix %q must start with /", i, t.Prefix))
+	}
+	for _, m := range t.Methods {
+		if !isHTTPMethod(m) {
+			problems = append(problems, fmt.Sprintf("transforms[%d]: unknown method %q", i, m))
+		}
+	}
+	for _, d := range t.Drop {
+		if _, err := compileRedactionPath(d); err != nil {
+			problems = append(problems, fmt.Sprintf("transforms[%d]: %v", i, err))
+		}
+	}
+	return problems
+}
+
+// appliesTo reports whether the rule covers method.
+func (t *TransformRule) appliesTo(method string) bool {
+	return (&ScopeMapping{Methods: t.Methods}).appliesTo(method)
+}
+
+// transformRuleFor returns the most specific transform rule for a request.
+func (p *Policy) transformRuleFor(method, path string) *TransformRule {
+	var best *TransformRule
+	for i := range p.Transforms {
+		t := &p.Transforms[i]
+		if strings.HasPrefix(path, t.Prefix) && t.appliesTo(method) &&
+			(best == nil || len(t.Prefix) > len(best.Prefix)) {
+			best = t
+		}
+	}
+	return best
+}
+
+// transformFor returns the transform for a request under p, or nil when the
+// response passes through unchanged.
+func transformFor(p *Policy, method, path, fields string) *responseTransform {
+	rule := p.transformRuleFor(method, path)
+	if rule == nil && fields == "" {
+		return nil
+	}
+
+	t := &responseTransform{}
+	selected := splitList(fields)
+	if rule != nil {
+		if len(selected) == 0 {
+			selected = rule.Fields
+		}
+		t.summarizeImages = rule.SummarizeImages
+		t.drop = mustCompilePaths(rule.Drop...)
+	}
+	for _, f := range selected {
+		t.fields = append(t.fields, strings.Split(f, "."))
+	}
+	return t
+}
+
+// transformResponse applies t to a successful JSON response, replacing
+// resp.Body. Non-JSON or unparsable bodies pass through unchanged.
+func transformResponse(resp *http.Response, t *responseTransform) error {
+	body, err := readLimited(resp.Body, maxResponseBufferSize)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err == nil {
+		if out, err := json.Marshal(t.apply(doc)); err == nil {
+			body = out
+		}
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// apply transforms a decoded JSON document.
+func (t *responseTransform) apply(doc interface{}) interface{} {
+	for _, steps := range t.drop {
+		doc = removePath(doc, steps)
+	}
+	if t.summarizeImages {
+		doc = summarizeImages(doc)
+	}
+	if len(t.fields) > 0 {
+		if obj, ok := doc.(map[string]interface{}); ok {
+			kept, _ := selectFields(obj, t.fields, nil)
+			result, _ := kept.(map[string]interface{})
+			if result == nil {
+				result = make(map[string]interface{})
+			}
+			for key := range paginationFields {
+				if v, ok := obj[key]; ok {
+					result[key] = v
+				}
+			}
+			doc = result
+		} else {
+			doc, _ = selectFields(doc, t.fields, nil)
+		}
+	}
+	return doc
+}
+
+// selectFields keeps the parts of node matched by fields. path is node's
+// key path (array indexes are skipped); a field matches when it is a suffix
+// of the path, and keeps the whole value. The second result is false when
+// nothing matched.
+func selectFields(node interface{}, fields [][]string, path []string) (interface{}, bool) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		kept := make(map[string]interface{})
+		for key, child := range v {
+			childPath := append(path[:len(path):len(path)], key)
+			if matchesField(childPath, fields) {
+				kept[key] = child
+			} else if sub, ok := selectFields(child, fields, childPath); ok {
+				kept[key] = sub
+			}
+		}
+		return kept, len(kept) > 0
+	case []interface{}:
+		var kept []interface{}
+		for _, child := range v {
+			if sub, ok := selectFields(child, fields, path); ok {
+				kept = append(kept, sub)
+			}
+		}
+		return kept, len(kept) > 0
+	}
+	return nil, false
+}
+
+func matchesField(path []string, fields [][]string) bool {
+	for _, f := range fields {
+		if len(f) > len(path) {
+			continue
+		}
+		suffix := path[len(path)-len(f):]
+		match := true
+		for i := range f {
+			if f[i] != suffix[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// summarizeImages replaces arrays of eBay image objects ({"imageUrl": ...})
+// with their count and first few URLs.
+func summarizeImages(node interface{}) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if summary, ok := imageSummary(child); ok {
+				v[key] = summary
+			} else {
+				v[key] = summarizeImages(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = summarizeImages(child)
+		}
+	}
+	return node
+}
+
+func imageSummary(node interface{}) (map[string]interface{}, bool) {
+	images, ok := node.([]interface{})
+	if !ok || len(images) == 0 {
+		return nil, false
+	}
+	urls := []string{}
+	for _, img := range images {
+		obj, ok := img.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		url, ok := obj["imageUrl"].(string)
+		if !ok {
+			return nil, false
+		}
+		if len(urls) < maxSummaryImageURLs {
+			urls = append(urls, url)
+		}
+	}
+	return map[string]interface{}{"count": len(images), "urls": urls}, true
+}
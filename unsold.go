@@ -0,0 +1,622 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/ebay"
+)
+
+// ### Unsold Listing Triage ##################################################
+
+// The unsold listing triage answers "what should I relist, and at what
+// price?". It lists the seller's listings that ended without a sale
+// (GetMyeBaySelling's UnsoldList in the Trading API), adds their views from
+// the Sell Analytics traffic report and their watchers, and compares each
+// asking price with active listings found by searching its title. Every
+// listing gets a recommendation and a suggested price.
+//
+// Assistants get it as the getUnsoldListingReport tool (GET
+// /reports/unsold-listings with the same Authorization header as /proxy/...).
+// The policy's `unsold_triage` section also sends a digest of linked (vault)
+// accounts to digest_urls every interval:
+//
+//	unsold_triage:
+//	  accounts: ["3q2-7w..."]
+//	  interval: 24h
+//	  days: 14
+//	  digest_urls: [https://hooks.example/ebay-digest]
+
+const (
+	unsoldReportPath            = "/reports/unsold-listings"
+	defaultUnsoldTriageInterval = 24 * time.Hour
+	minUnsoldTriageInterval     = time.Hour
+	defaultUnsoldDays           = 30
+	maxUnsoldDays               = 60 // GetMyeBaySelling's limit
+	defaultUnsoldItems          = 25
+	maxUnsoldItems              = 100
+	unsoldMarketSample          = 50 // active listings compared per item
+	unsoldLookups               = 4  // concurrent Browse searches
+	unsoldReportTimeout         = 2 * time.Minute
+)
+
+// Thresholds of the recommendations.
+const (
+	overpricedAbove = 1.10 // asking above 110% of the market median
+	fewViews        = 10   // views in the period
+	minMarketSample = 3    // comparable listings needed to judge the price
+	watcherDiscount = 0.95 // suggested price for listings that had watchers
+)
+
+// UnsoldTriagePolicy configures the scheduled digest. It is off without
+// accounts.
+type UnsoldTriagePolicy struct {
+	Accounts   []string      `yaml:"accounts,omitempty"` // vault IDs
+	Interval   time.Duration `yaml:"interval,omitempty"`
+	Days       int           `yaml:"days,omitempty"`
+	MaxItems   int           `yaml:"max_items,omitempty"`
+	DigestURLs []string      `yaml:"digest_urls,omitempty"`
+}
+
+// validate checks the section.
+func (u *UnsoldTriagePolicy) validate() []string {
+	var problems []string
+	if u.Interval != 0 && u.Interval < minUnsoldTriageInterval {
+		problems = append(problems, fmt.Sprintf("unsold_triage: interval must be at least %s", minUnsoldTriageInterval))
+	}
+	if u.Days < 0 || u.Days > maxUnsoldDays {
+		problems = append(problems, fmt.Sprintf("unsold_triage: days must be from 1 to %d", maxUnsoldDays))
+	}
+	if u.MaxItems < 0 || u.MaxItems > maxUnsoldItems {
+		problems = append(problems, fmt.Sprintf("unsold_triage: max_items must be from 1 to %d", maxUnsoldItems))
+	}
+	if len(u.Accounts) > 0 && len(u.DigestURLs) == 0 {
+		problems = append(problems, "unsold_triage: accounts need digest_urls to deliver the digest to")
+	}
+	for _, target := range u.DigestURLs {
+		if parsed, err := url.Parse(target); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("unsold_triage: invalid digest URL %q", target))
+		}
+	}
+	return problems
+}
+
+// Recommendations of the triage.
+const (
+	recommendReprice = "reprice"      // priced above comparable listings
+	recommendImprove = "improve"      // hardly seen: fix title, photos or category first
+	recommendOffer   = "relist_offer" // watched but not bought: relist and send watchers an offer
+	recommendRelist  = "relist"       // relist as is
+	recommendReview  = "review"       // no price to work with
+)
+
+// unsoldListing is one row of the report.
+type unsoldListing struct {
+	ItemID         string        `json:"item_id"`
+	SKU            string        `json:"sku,omitempty"`
+	Title          string        `json:"title"`
+	EndedAt        time.Time     `json:"ended_at"`
+	Price          float64       `json:"price"`
+	Currency       string        `json:"currency"`
+	Views          *int          `json:"views,omitempty"` // nil when the traffic report had none
+	Watchers       int           `json:"watchers"`
+	Market         *marketPrices `json:"market,omitempty"`
+	Recommendation string        `json:"recommendation"`
+	SuggestedPrice float64       `json:"suggested_price,omitempty"`
+	Reason         string        `json:"reason"`
+}
+
+// marketPrices summarizes the active listings found for an item.
+type marketPrices struct {
+	Listings int     `json:"listings"`
+	Low      float64 `json:"low"`
+	Median   float64 `json:"median"`
+	High     float64 `json:"high"`
+}
+
+// unsoldReport is the report of one account.
+type unsoldReport struct {
+	Account     string          `json:"account,omitempty"`
+	Marketplace string          `json:"marketplace"`
+	Days        int             `json:"days"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Listings    []unsoldListing `json:"listings"`
+	Unsold      int             `json:"unsold"` // listings that ended unsold, before max_items
+	Summary     string          `json:"summary"`
+	Warnings    []string        `json:"warnings,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// recommend fills in the recommendation, suggested price and reason.
+func (l *unsoldListing) recommend() {
+	switch {
+	case l.Price <= 0:
+		l.Recommendation = recommendReview
+		l.Reason = "the listing had no price to compare"
+	case l.Market != nil && l.Market.Listings >= minMarketSample && l.Price > l.Market.Median*overpricedAbove:
+		l.Recommendation = recommendReprice
+		l.SuggestedPrice = l.Market.Median
+		l.Reason = fmt.Sprintf("asking %.2f is %.0f%% above the median %.2f of %d active listings",
+			l.Price, (l.Price/l.Market.Median-1)*100, l.Market.Median, l.Market.Listings)
+	case l.Views != nil && *l.Views < fewViews && l.Watchers == 0:
+		l.Recommendation = recommendImprove
+		l.SuggestedPrice = l.Price
+		l.Reason = fmt.Sprintf("only %d views: revise the title, photos or category before relisting", *l.Views)
+	case l.Watchers > 0:
+		l.Recommendation = recommendOffer
+		l.SuggestedPrice = math.Round(l.Price*watcherDiscount*100) / 100
+		l.Reason = fmt.Sprintf("%d watchers did not buy: relist and send them an offer", l.Watchers)
+	default:
+		l.Recommendation = recommendRelist
+		l.SuggestedPrice = l.Price
+		l.Reason = "priced in line with the market"
+		if l.Market == nil || l.Market.Listings < minMarketSample {
+			l.Reason = "too few comparable listings to judge the price"
+		}
+	}
+}
+
+// summarize describes the report in a sentence.
+func (r *unsoldReport) summarize() {
+	counts := make(map[string]int)
+	for _, l := range r.Listings {
+		counts[l.Recommendation]++
+	}
+	r.Summary = fmt.Sprintf("%d listings ended unsold in the last %d days", r.Unsold, r.Days)
+	var parts []string
+	for _, rec := range []string{recommendReprice, recommendOffer, recommendRelist, recommendImprove, recommendReview} {
+		if counts[rec] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[rec], rec))
+		}
+	}
+	if len(parts) > 0 {
+		r.Summary += ": " + strings.Join(parts, ", ")
+	}
+}
+
+// ### Data Sources ###
+
+type getMyeBaySellingRequest struct {
+	XMLName    xml.Name `xml:"urn:ebay:apis:eBLBaseComponents GetMyeBaySellingRequest"`
+	UnsoldList struct {
+		Include        bool   `xml:"Include"`
+		DurationInDays int    `xml:"DurationInDays"`
+		Sort           string `xml:"Sort"`
+		Pagination     struct {
+			EntriesPerPage int `xml:"EntriesPerPage"`
+			PageNumber     int `xml:"PageNumber"`
+		} `xml:"Pagination"`
+	} `xml:"UnsoldList"`
+}
+
+type getMyeBaySellingResponse struct {
+	tradingAck
+	UnsoldList struct {
+		Items []struct {
+			ItemID         string         `xml:"ItemID"`
+			SKU            string         `xml:"SKU"`
+			Title          string         `xml:"Title"`
+			WatchCount     int            `xml:"WatchCount"`
+			BuyItNowPrice  *tradingAmount `xml:"BuyItNowPrice"`
+			ListingDetails struct {
+				EndTime time.Time `xml:"EndTime"`
+			} `xml:"ListingDetails"`
+			SellingStatus struct {
+				CurrentPrice *tradingAmount `xml:"CurrentPrice"`
+			} `xml:"SellingStatus"`
+		} `xml:"ItemArray>Item"`
+		Pagination struct {
+			TotalNumberOfEntries int `xml:"TotalNumberOfEntries"`
+		} `xml:"PaginationResult"`
+	} `xml:"UnsoldList"`
+}
+
+// trafficReport is the part of the Analytics getTrafficReport response we
+// read.
+type trafficReport struct {
+	Header struct {
+		Metrics []struct {
+			Key string `json:"key"`
+		} `json:"metrics"`
+	} `json:"header"`
+	Records []struct {
+		DimensionValues []struct {
+			Value string `json:"value"`
+		} `json:"dimensionValues"`
+		MetricValues []struct {
+			Value      json.Number `json:"value"`
+			Applicable bool        `json:"applicable"`
+		} `json:"metricValues"`
+	} `json:"records"`
+}
+
+// unsoldListings returns up to limit listings that ended unsold in the last
+// days, most recently ended first, and how many there were in total.
+func unsoldListings(ctx context.Context, env *ebayEnvironment, token, marketplace string, days, limit int) ([]unsoldListing, int, error) {
+	var req getMyeBaySellingRequest
+	req.UnsoldList.Include = true
+	req.UnsoldList.DurationInDays = days
+	req.UnsoldList.Sort = "EndTimeDescending"
+	req.UnsoldList.Pagination.EntriesPerPage = limit
+	req.UnsoldList.Pagination.PageNumber = 1
+
+	var resp getMyeBaySellingResponse
+	if err := tradingCall(ctx, env, token, marketplace, "GetMyeBaySelling", req, &resp); err != nil {
+		return nil, 0, err
+	}
+	listings := make([]unsoldListing, 0, len(resp.UnsoldList.Items))
+	for _, item := range resp.UnsoldList.Items {
+		price := item.BuyItNowPrice
+		if price == nil || price.Value == 0 {
+			price = item.SellingStatus.CurrentPrice
+		}
+		l := unsoldListing{
+			ItemID:   item.ItemID,
+			SKU:      item.SKU,
+			Title:    item.Title,
+			EndedAt:  item.ListingDetails.EndTime,
+			Watchers: item.WatchCount,
+		}
+		if price != nil {
+			l.Price, l.Currency = price.Value, price.Currency
+		}
+		listings = append(listings, l)
+	}
+	total := max(resp.UnsoldList.Pagination.TotalNumberOfEntries, len(listings))
+	return listings, total, nil
+}
+
+// listingViews returns the views of each listing over the last days from the
+// traffic report.
+func listingViews(ctx context.Context, env *ebayEnvironment, token, marketplace string, itemIDs []string, days int) (map[string]int, error) {
+	const path = "/sell/analytics/v1/traffic_report"
+	if err := currentPolicy().AllowPath(http.MethodGet, path); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	query := url.Values{}
+	query.Set("dimension", "LISTING")
+	query.Set("metric", "LISTING_VIEWS_TOTAL")
+	query.Set("filter", fmt.Sprintf("marketplace_ids:{%s},date_range:[%s..%s],listing_ids:{%s}",
+		marketplace, now.AddDate(0, 0, -days).Format("20060102"), now.Format("20060102"), strings.Join(itemIDs, "|")))
+
+	var report trafficReport
+	if err := getEbayJSON(ctx, env, token, marketplace, path, query, &report); err != nil {
+		return nil, err
+	}
+	metric := -1
+	for i, m := range report.Header.Metrics {
+		if m.Key == "LISTING_VIEWS_TOTAL" {
+			metric = i
+		}
+	}
+	if metric < 0 {
+		return nil, errors.New("the traffic report has no LISTING_VIEWS_TOTAL")
+	}
+	views := make(map[string]int)
+	for _, rec := range report.Records {
+		if len(rec.DimensionValues) == 0 || len(rec.MetricValues) <= metric || !rec.MetricValues[metric].Applicable {
+			continue
+		}
+		if n, err := rec.MetricValues[metric].Value.Int64(); err == nil {
+			views[rec.DimensionValues[0].Value] = int(n)
+		}
+	}
+	return views, nil
+}
+
+// marketFor summarizes the prices of active fixed-price listings matching
+// the title of l, leaving out l itself.
+func marketFor(ctx context.Context, env *ebayEnvironment, token, marketplace string, l unsoldListing) (*marketPrices, error) {
+	const path = "/buy/browse/v1/item_summary/search"
+	if err := currentPolicy().AllowPath(http.MethodGet, path); err != nil {
+		return nil, err
+	}
+	results, err := ebayClient(env, token, marketplace).SearchItems(ctx, ebay.SearchParams{
+		Query:  l.Title,
+		Filter: []string{"buyingOptions:{FIXED_PRICE}"},
+		Limit:  unsoldMarketSample,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var prices []float64
+	for _, s := range results.ItemSummaries {
+		if s.LegacyItemID == l.ItemID || (l.Currency != "" && s.Price.Currency != l.Currency) {
+			continue
+		}
+		if p, err := strconv.ParseFloat(s.Price.Value, 64); err == nil && p > 0 {
+			prices = append(prices, p)
+		}
+	}
+	if len(prices) == 0 {
+		return nil, nil
+	}
+	sort.Float64s(prices)
+	median := prices[len(prices)/2]
+	if len(prices)%2 == 0 {
+		median = (prices[len(prices)/2-1] + median) / 2
+	}
+	return &marketPrices{
+		Listings: len(prices),
+		Low:      prices[0],
+		Median:   math.Round(median*100) / 100,
+		High:     prices[len(prices)-1],
+	}, nil
+}
+
+// buildUnsoldReport runs the triage for one account. Views and market
+// prices are best effort: when they can't be fetched the report says so in
+// its warnings.
+func buildUnsoldReport(ctx context.Context, env *ebayEnvironment, token, marketplace string, days, limit int) (*unsoldReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, unsoldReportTimeout)
+	defer cancel()
+
+	listings, total, err := unsoldListings(ctx, env, token, marketplace, days, limit)
+	if err != nil {
+		return nil, err
+	}
+	report := &unsoldReport{
+		Marketplace: marketplace,
+		Days:        days,
+		GeneratedAt: time.Now().UTC(),
+		Listings:    listings,
+		Unsold:      total,
+	}
+
+	if len(listings) > 0 {
+		ids := make([]string, len(listings))
+		for i, l := range listings {
+			ids[i] = l.ItemID
+		}
+		if views, err := listingViews(ctx, env, token, marketplace, ids, days); err != nil {
+			report.Warnings = append(report.Warnings, "views unavailable: "+err.Error())
+		} else {
+			for i := range listings {
+				if n, ok := views[listings[i].ItemID]; ok {
+					listings[i].Views = &n
+				}
+			}
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures int
+		lastErr  error
+	)
+	slots := make(chan struct{}, unsoldLookups)
+	for i := range listings {
+		wg.Add(1)
+		go func(l *unsoldListing) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			market, err := marketFor(ctx, env, token, marketplace, *l)
+			if err != nil {
+				mu.Lock()
+				failures, lastErr = failures+1, err
+				mu.Unlock()
+				return
+			}
+			l.Market = market
+		}(&listings[i])
+	}
+	wg.Wait()
+	if failures > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("market prices unavailable for %d listings: %v", failures, lastErr))
+	}
+
+	for i := range listings {
+		listings[i].recommend()
+	}
+	report.summarize()
+	return report, nil
+}
+
+// ### Report Endpoint ###
+
+// handleUnsoldReport (tool getUnsoldListingReport) runs the triage for the
+// caller's account.
+//
+// GET /reports/unsold-listings?days=30&limit=25 with the same Authorization
+// header as /proxy/...
+func handleUnsoldReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	days, err := boundedParam(r, "days", defaultUnsoldDays, maxUnsoldDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := boundedParam(r, "limit", defaultUnsoldItems, maxUnsoldItems)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	caller, status, err := resolveCaller(w, r)
+	if err != nil {
+		log.Printf("Failed to resolve token for the unsold report: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	// The report calls eBay with the bare token, so check its scopes first
+	for _, path := range []string{tradingAPIPath + "/GetMyeBaySelling", "/sell/analytics/v1/traffic_report", "/buy/browse/v1/item_summary/search"} {
+		if err := caller.allow(http.MethodGet, path); err != nil {
+			writeEbayError(w, r, caller, err)
+			return
+		}
+	}
+
+	report, err := buildUnsoldReport(r.Context(), caller.env, caller.token, caller.marketplace, days, limit)
+	if err != nil {
+		log.Printf("Unsold report failed: %v", err)
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// boundedParam reads a positive integer query parameter of at most limit.
+func boundedParam(r *http.Request, name string, fallback, limit int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > limit {
+		return 0, fmt.Errorf("%s must be a number from 1 to %d", name, limit)
+	}
+	return n, nil
+}
+
+// ### Digest ###
+
+// unsoldDigest is what is POSTed to digest_urls.
+type unsoldDigest struct {
+	Type        string         `json:"type"` // "unsold_triage"
+	GeneratedAt time.Time      `json:"generated_at"`
+	Reports     []unsoldReport `json:"reports"`
+}
+
+// unsoldTriage serializes digest runs.
+var unsoldTriage sync.Mutex
+
+// startUnsoldTriage sends the digest every interval. It does nothing when
+// the policy names no accounts.
+func startUnsoldTriage(ctx context.Context) {
+	u := currentPolicy().UnsoldTriage
+	if len(u.Accounts) == 0 {
+		return
+	}
+	if vault == nil {
+		log.Printf("Unsold listing triage needs VAULT_FILE for its accounts; not starting")
+		return
+	}
+	interval := u.Interval
+	if interval == 0 {
+		interval = defaultUnsoldTriageInterval
+	}
+	log.Printf("Unsold listing triage: %d account(s), digest every %s", len(u.Accounts), interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if digest, ok := runUnsoldTriage(ctx); ok {
+				deliverUnsoldDigest(ctx, currentPolicy().UnsoldTriage.DigestURLs, digest)
+			}
+		}
+	}()
+}
+
+// runUnsoldTriage builds the report of every account. A run that starts
+// while another runs returns at once and reports false.
+func runUnsoldTriage(ctx context.Context) (*unsoldDigest, bool) {
+	if !unsoldTriage.TryLock() {
+		return nil, false
+	}
+	defer unsoldTriage.Unlock()
+
+	u := currentPolicy().UnsoldTriage
+	days, limit := u.Days, u.MaxItems
+	if days == 0 {
+		days = defaultUnsoldDays
+	}
+	if limit == 0 {
+		limit = defaultUnsoldItems
+	}
+
+	digest := &unsoldDigest{Type: "unsold_triage", GeneratedAt: time.Now().UTC(), Reports: []unsoldReport{}}
+	for _, account := range u.Accounts {
+		report, err := accountUnsoldReport(ctx, account, days, limit)
+		if err != nil {
+			log.Printf("Unsold listing triage for account %s: %v", account, err)
+			report = &unsoldReport{Days: days, GeneratedAt: time.Now().UTC(), Listings: []unsoldListing{}, Error: err.Error()}
+		}
+		report.Account = account
+		digest.Reports = append(digest.Reports, *report)
+	}
+	return digest, true
+}
+
+// accountUnsoldReport runs the triage for a vault account.
+func accountUnsoldReport(ctx context.Context, account string, days, limit int) (*unsoldReport, error) {
+	token, entry, err := vaultAccessToken(ctx, vaultKeyPrefix+account)
+	if err != nil {
+		return nil, err
+	}
+	marketplace := entry.Marketplace
+	if marketplace == "" {
+		marketplace = configuredMarketplace
+	}
+	return buildUnsoldReport(ctx, entry.environment(), token, marketplace, days, limit)
+}
+
+// deliverUnsoldDigest POSTs the digest to urls. Delivery is best effort.
+func deliverUnsoldDigest(ctx context.Context, urls []string, digest *unsoldDigest) {
+	payload, err := json.Marshal(digest)
+	if err != nil {
+		log.Printf("Failed to encode the unsold listing digest: %v", err)
+		return
+	}
+	client := &http.Client{Timeout: webhookForwardTimeout}
+	for _, target := range urls {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+		if err != nil {
+			log.Printf("Failed to send the unsold listing digest to %s: %v", target, err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("Failed to send the unsold listing digest to %s: %v", target, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("Sending the unsold listing digest to %s returned status %d", target, resp.StatusCode)
+		}
+	}
+}
+
+// handleUnsoldTriageRun builds and delivers the digest now, and returns it.
+// POST /admin/unsold-triage/run
+func handleUnsoldTriageRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(currentPolicy().UnsoldTriage.Accounts) == 0 || vault == nil {
+		http.Error(w, "Unsold listing triage is not configured", http.StatusNotFound)
+		return
+	}
+	digest, ran := runUnsoldTriage(r.Context())
+	if !ran {
+		http.Error(w, "A run is already in progress", http.StatusConflict)
+		return
+	}
+	deliverUnsoldDigest(r.Context(), currentPolicy().UnsoldTriage.DigestURLs, digest)
+	writeJSON(w, http.StatusOK, digest)
+}
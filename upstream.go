@@ -0,0 +1,311 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayouroukov/ebay-mcp/internal/telemetry"
+)
+
+// ### Upstream Resilience ####################################################
+
+// Calls to eBay go through retryTransport, which retries transient failures
+// (connection errors, 429 and 502/503/504) of idempotent requests with
+// jittered exponential backoff, honoring Retry-After. A circuit breaker per
+// upstream host stops sending traffic to a host that keeps failing, so
+// clients get a fast 503 instead of waiting out timeouts while eBay is down.
+
+const (
+	retryBaseDelay   = 200 * time.Millisecond
+	retryMaxDelay    = 10 * time.Second
+	breakerThreshold = 5                // consecutive failures that open the breaker
+	breakerCooldown  = 30 * time.Second // how long an open breaker rejects calls
+)
+
+// errCircuitOpen is returned while a host's breaker is open.
+var errCircuitOpen = errors.New("eBay upstream circuit breaker is open")
+
+// Breaker states, also the values of the ebay_upstream_circuit_state gauge.
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+var breakerStateNames = map[int]string{breakerClosed: "closed", breakerOpen: "open", breakerHalfOpen: "half_open"}
+
+// circuitBreaker tracks one upstream host.
+type circuitBreaker struct {
+	state    int
+	failures int
+	openedAt time.Time
+	trial    bool // a half-open trial request is in flight
+}
+
+// upstreamGuard holds the breakers and retry counters of all hosts.
+type upstreamGuard struct {
+	mu         sync.Mutex
+	maxRetries int
+	breakers   map[string]*circuitBreaker
+	retries    map[string]uint64
+}
+
+// upstream is shared by every proxied request.
+var upstream = newUpstreamGuard(2)
+
+func newUpstreamGuard(maxRetries int) *upstreamGuard {
+	return &upstreamGuard{
+		maxRetries: maxRetries,
+		breakers:   make(map[string]*circuitBreaker),
+		retries:    make(map[string]uint64),
+	}
+}
+
+// upstreamGuardFromEnv reads PROXY_MAX_RETRIES (default 2, 0 disables).
+func upstreamGuardFromEnv() (*upstreamGuard, error) {
+	maxRetries := 2
+	if v := os.Getenv("PROXY_MAX_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid PROXY_MAX_RETRIES %q", v)
+		}
+		maxRetries = n
+	}
+	return newUpstreamGuard(maxRetries), nil
+}
+
+// allow reports whether a call to host may proceed.
+func (g *upstreamGuard) allow(host string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b := g.breakers[host]
+	if b == nil {
+		return true
+	}
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < breakerCooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.trial = true
+		return true
+	case breakerHalfOpen:
+		// Only one trial request at a time
+		if b.trial {
+			return false
+		}
+		b.trial = true
+	}
+	return true
+}
+
+// record updates host's breaker with the outcome of a call.
+func (g *upstreamGuard) record(host string, failed bool, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b := g.breakers[host]
+	if b == nil {
+		b = &circuitBreaker{}
+		g.breakers[host] = b
+	}
+	b.trial = false
+
+	if !failed {
+		if b.state != breakerClosed {
+			log.Printf("Circuit breaker for %s closed", host)
+		}
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= breakerThreshold {
+		if b.state != breakerOpen {
+			log.Printf("Circuit breaker for %s opened after %d failures", host, b.failures)
+		}
+		b.state, b.openedAt = breakerOpen, now
+	}
+}
+
+// countRetry counts a retried call to host.
+func (g *upstreamGuard) countRetry(host string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.retries[host]++
+}
+
+// States returns every known host's breaker state.
+func (g *upstreamGuard) States() map[string]string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	states := make(map[string]string, len(g.breakers))
+	for host, b := range g.breakers {
+		states[host] = breakerStateNames[b.state]
+	}
+	return states
+}
+
+// writePrometheus appends breaker state and retry counters.
+func (g *upstreamGuard) writePrometheus(w *strings.Builder) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	telemetry.Header(w, "ebay_upstream_circuit_state", "Circuit breaker state per eBay host (0 closed, 1 open, 2 half-open).", "gauge")
+	for _, host := range sortedKeys(g.breakers) {
+		fmt.Fprintf(w, "ebay_upstream_circuit_state{host=%q} %d\n", host, g.breakers[host].state)
+	}
+
+	telemetry.Counter(w, "ebay_upstream_retries_total", "Retried eBay calls per host.", "host", g.retries)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// retryTransport wraps the eBay transport with retries and the breaker.
+type retryTransport struct {
+	base  http.RoundTripper
+	guard *upstreamGuard
+}
+
+// isIdempotent reports whether method may safely be repeated.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether a response status is worth retrying.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if !t.guard.allow(host, time.Now()) {
+		return nil, errCircuitOpen
+	}
+
+	attempts := 1
+	if isIdempotent(req.Method) {
+		attempts += t.guard.maxRetries
+	}
+
+	// Buffer the body so it can be replayed
+	var body []byte
+	if attempts > 1 && req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	for attempt := 0; ; attempt++ {
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		// A client hanging up says nothing about eBay's health
+		failed := (err != nil && req.Context().Err() == nil) ||
+			(err == nil && resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented)
+		last := attempt+1 >= attempts || (err == nil && !retryable(resp.StatusCode))
+		if last {
+			t.guard.record(host, failed, time.Now())
+			return resp, err
+		}
+
+		delay := backoff(attempt)
+		if err == nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if after > retryMaxDelay {
+					// eBay wants us to wait longer than a client will: give up now
+					t.guard.record(host, failed, time.Now())
+					return resp, nil
+				}
+				delay = after
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			log.Printf("eBay returned %d for %s %s, retrying in %v", resp.StatusCode, req.Method, req.URL.Path, delay)
+		} else {
+			log.Printf("eBay call %s %s failed (%v), retrying in %v", req.Method, req.URL.Path, err, delay)
+		}
+		t.guard.countRetry(host)
+
+		select {
+		case <-req.Context().Done():
+			t.guard.record(host, failed, time.Now())
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns a full-jitter exponential delay for the given attempt.
+func backoff(attempt int) time.Duration {
+	ceiling := retryBaseDelay << attempt
+	if ceiling > retryMaxDelay {
+		ceiling = retryMaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
+
+// retryAfter parses a Retry-After value in seconds or as an HTTP date.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// handleUpstreamHealth reports breaker states and maintenance windows: 503
+// while any breaker is open or an environment is in maintenance.
+// GET /health/upstream
+func handleUpstreamHealth(w http.ResponseWriter, r *http.Request) {
+	states := upstream.States()
+	status := http.StatusOK
+	for _, s := range states {
+		if s == breakerStateNames[breakerOpen] {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	inMaintenance := maintenance.Active(time.Now())
+	if len(inMaintenance) > 0 {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, map[string]interface{}{"upstreams": states, "maintenance": inMaintenance})
+}
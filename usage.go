@@ -0,0 +1,390 @@
+package ebaymcp
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ### Usage Export ###########################################################
+
+// GET /admin/usage-export publishes per-day, per-operation call counts and
+// latency distributions that are safe to share publicly or with eBay
+// developer support. Callers never appear in it:
+//
+//   - each caller (bearer token) contributes at most USAGE_EXPORT_MAX_CALLS
+//     calls (default 100) to a day's operation, bounding their influence;
+//   - USAGE_EXPORT_EPSILON (default 1) is split evenly between the four
+//     statistics of a day's operation (distinct callers, calls, errors and
+//     the latency histogram), and each gets Laplace noise for its share: the
+//     caller count of scale 4 / epsilon, the others of scale
+//     4 * USAGE_EXPORT_MAX_CALLS / epsilon, so the operation's row is
+//     epsilon-differentially private as a whole;
+//   - operations whose noisy count of distinct callers on a day is below
+//     USAGE_EXPORT_MIN_CALLERS (default 5) are withheld, and caller counts
+//     are only given as ranges of the noisy count, such as "5-9";
+//   - a day is exported once it is over, and the noise of each row is drawn
+//     once and reused by every later export, so downloading again reveals
+//     nothing new.
+//
+// Epsilon is spent per row: a caller who used k operations on d days
+// appears in k * d rows and spends up to k * d * epsilon in total across
+// the export. Statistics are kept in memory for USAGE_RETENTION_DAYS
+// (default 30).
+
+const (
+	defaultUsageEpsilon    = 1.0
+	defaultUsageMaxCalls   = 100
+	defaultUsageMinCallers = 5
+	defaultUsageRetention  = 30
+)
+
+// callerBuckets are the lower bounds of the ranges distinct caller counts
+// are reported in.
+var callerBuckets = []int{5, 10, 25, 50, 100, 250, 500, 1000}
+
+// usageKey identifies one day of one operation.
+type usageKey struct {
+	day       string // UTC, 2006-01-02
+	operation string
+	method    string
+}
+
+// usageCell aggregates the calls counted for a usageKey.
+type usageCell struct {
+	callers map[string]int // calls counted per caller token hash
+	calls   int
+	errors  int      // 5xx responses and transport failures
+	latency []uint64 // per latencyBuckets entry, plus one overflow bucket
+
+	// released is the noisy row, drawn by the first export after the day
+	// ended; nil until then
+	released *usageRelease
+}
+
+// usageRelease is the noisy row exported for a usageKey.
+type usageRelease struct {
+	withheld bool
+	row      usageExportOperation
+}
+
+// usageStats collects the raw statistics behind the export.
+type usageStats struct {
+	epsilon    float64
+	maxCalls   int
+	minCallers int
+	retention  int
+
+	mu    sync.Mutex
+	cells map[usageKey]*usageCell
+}
+
+// usage is nil until configured at startup.
+var usage *usageStats
+
+// usageStatsFromEnv reads USAGE_EXPORT_EPSILON, USAGE_EXPORT_MAX_CALLS,
+// USAGE_EXPORT_MIN_CALLERS and USAGE_RETENTION_DAYS.
+func usageStatsFromEnv() (*usageStats, error) {
+	s := &usageStats{
+		epsilon:    defaultUsageEpsilon,
+		maxCalls:   defaultUsageMaxCalls,
+		minCallers: defaultUsageMinCallers,
+		retention:  defaultUsageRetention,
+		cells:      make(map[usageKey]*usageCell),
+	}
+	if v := os.Getenv("USAGE_EXPORT_EPSILON"); v != "" {
+		eps, err := strconv.ParseFloat(v, 64)
+		if err != nil || eps <= 0 {
+			return nil, fmt.Errorf("invalid USAGE_EXPORT_EPSILON %q", v)
+		}
+		s.epsilon = eps
+	}
+	for _, setting := range []struct {
+		name  string
+		value *int
+	}{
+		{"USAGE_EXPORT_MAX_CALLS", &s.maxCalls},
+		{"USAGE_EXPORT_MIN_CALLERS", &s.minCallers},
+		{"USAGE_RETENTION_DAYS", &s.retention},
+	} {
+		if v := os.Getenv(setting.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid %s %q", setting.name, v)
+			}
+			*setting.value = n
+		}
+	}
+	return s, nil
+}
+
+// Observe counts one proxied call by the caller with token hash caller.
+func (s *usageStats) Observe(operation, method, caller string, status int, elapsed time.Duration, now time.Time) {
+	key := usageKey{day: now.UTC().Format(time.DateOnly), operation: operation, method: method}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cell, ok := s.cells[key]
+	if !ok {
+		s.prune(now)
+		cell = &usageCell{callers: make(map[string]int), latency: make([]uint64, len(latencyBuckets)+1)}
+		s.cells[key] = cell
+	}
+	if cell.callers[caller] >= s.maxCalls {
+		return
+	}
+	cell.callers[caller]++
+	cell.calls++
+	if status >= 500 {
+		cell.errors++
+	}
+	cell.latency[latencyBucket(elapsed)]++
+}
+
+// prune drops days older than the retention. Callers must hold s.mu.
+func (s *usageStats) prune(now time.Time) {
+	oldest := now.UTC().AddDate(0, 0, -s.retention).Format(time.DateOnly)
+	for key := range s.cells {
+		if key.day < oldest {
+			delete(s.cells, key)
+		}
+	}
+}
+
+// usageDay is the raw statistics of one operation on one day, without the
+// callers.
+type usageDay struct {
+	Operation string
+	Method    string
+	Calls     int
+	Errors    int
+	Callers   int
+	Latency   []int64 // per latencyBuckets entry, plus one overflow bucket
+}
+
+// Day returns the raw statistics of day (2006-01-02), sorted by operation.
+func (s *usageStats) Day(day string) []usageDay {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stats []usageDay
+	for key, cell := range s.cells {
+		if key.day != day {
+			continue
+		}
+		d := usageDay{
+			Operation: key.operation,
+			Method:    key.method,
+			Calls:     cell.calls,
+			Errors:    cell.errors,
+			Callers:   len(cell.callers),
+			Latency:   make([]int64, len(cell.latency)),
+		}
+		for i, n := range cell.latency {
+			d.Latency[i] = int64(n)
+		}
+		stats = append(stats, d)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Operation != stats[j].Operation {
+			return stats[i].Operation < stats[j].Operation
+		}
+		return stats[i].Method < stats[j].Method
+	})
+	return stats
+}
+
+// latencyBucket returns the index of the latencyBuckets entry elapsed falls
+// in, or len(latencyBuckets) when it exceeds them all.
+func latencyBucket(elapsed time.Duration) int {
+	seconds := elapsed.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			return i
+		}
+	}
+	return len(latencyBuckets)
+}
+
+// usageExport is the body of /admin/usage-export.
+type usageExport struct {
+	GeneratedAt       time.Time        `json:"generated_at"`
+	Epsilon           float64          `json:"epsilon"`
+	MaxCallsPerCaller int              `json:"max_calls_per_caller"`
+	MinCallers        int              `json:"min_callers"`
+	WithheldCells     int              `json:"withheld"`
+	LatencyBucketsMS  []float64        `json:"latency_buckets_ms"`
+	Days              []usageExportDay `json:"days"`
+}
+
+type usageExportDay struct {
+	Date       string                 `json:"date"`
+	Operations []usageExportOperation `json:"operations"`
+}
+
+type usageExportOperation struct {
+	Operation string `json:"operation"`
+	Method    string `json:"method"`
+	Calls     int64  `json:"calls"`
+	Errors    int64  `json:"errors"`
+	Callers   string `json:"callers"`
+	// Latency is the noisy histogram: counts per latency_buckets_ms entry,
+	// plus a final bucket for slower calls
+	Latency     []int64            `json:"latency"`
+	Percentiles map[string]float64 `json:"latency_percentiles_ms"`
+}
+
+// Export builds a differentially private export of the last days days that
+// are over. noise returns Laplace noise of the given scale; it is drawn once
+// per row, the first time the row is exported.
+func (s *usageStats) Export(days int, now time.Time, noise func(scale float64) float64) usageExport {
+	export := usageExport{
+		GeneratedAt:       now.UTC(),
+		Epsilon:           s.epsilon,
+		MaxCallsPerCaller: s.maxCalls,
+		MinCallers:        s.minCallers,
+		Days:              []usageExportDay{},
+	}
+	for _, bound := range latencyBuckets {
+		export.LatencyBucketsMS = append(export.LatencyBucketsMS, bound*1000)
+	}
+	// One caller changes the caller count by 1 and each of the other
+	// statistics by up to maxCalls; each statistic spends a quarter of
+	// epsilon
+	const statistics = 4
+	callerScale := statistics / s.epsilon
+	scale := statistics * float64(s.maxCalls) / s.epsilon
+	noisy := func(n int64) int64 {
+		return max(0, int64(math.Round(float64(n)+noise(scale))))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Today's counts still change, so releasing them would mean drawing
+	// noise again later
+	today := now.UTC().Format(time.DateOnly)
+	oldest := now.UTC().AddDate(0, 0, -days).Format(time.DateOnly)
+	byDay := make(map[string][]usageExportOperation)
+	for key, cell := range s.cells {
+		if key.day < oldest || key.day >= today {
+			continue
+		}
+		if cell.released == nil {
+			cell.released = &usageRelease{}
+			callers := max(0, int(math.Round(float64(len(cell.callers))+noise(callerScale))))
+			if callers < s.minCallers {
+				cell.released.withheld = true
+			} else {
+				op := usageExportOperation{
+					Operation: key.operation,
+					Method:    key.method,
+					Calls:     noisy(int64(cell.calls)),
+					Errors:    noisy(int64(cell.errors)),
+					Callers:   callerRange(callers),
+					Latency:   make([]int64, len(cell.latency)),
+				}
+				for i, n := range cell.latency {
+					op.Latency[i] = noisy(int64(n))
+				}
+				op.Percentiles = latencyPercentiles(op.Latency)
+				cell.released.row = op
+			}
+		}
+		if cell.released.withheld {
+			export.WithheldCells++
+			continue
+		}
+		byDay[key.day] = append(byDay[key.day], cell.released.row)
+	}
+
+	for day, ops := range byDay {
+		sort.Slice(ops, func(i, j int) bool {
+			if ops[i].Operation != ops[j].Operation {
+				return ops[i].Operation < ops[j].Operation
+			}
+			return ops[i].Method < ops[j].Method
+		})
+		export.Days = append(export.Days, usageExportDay{Date: day, Operations: ops})
+	}
+	sort.Slice(export.Days, func(i, j int) bool { return export.Days[i].Date < export.Days[j].Date })
+	return export
+}
+
+// callerRange reports a distinct caller count as a range of callerBuckets.
+func callerRange(n int) string {
+	for i := len(callerBuckets) - 1; i >= 0; i-- {
+		if n < callerBuckets[i] {
+			continue
+		}
+		if i == len(callerBuckets)-1 {
+			return fmt.Sprintf("%d+", callerBuckets[i])
+		}
+		return fmt.Sprintf("%d-%d", callerBuckets[i], callerBuckets[i+1]-1)
+	}
+	return fmt.Sprintf("<%d", callerBuckets[0])
+}
+
+// latencyPercentiles estimates p50, p90 and p99 (in milliseconds) from a
+// latency histogram, as the upper bound of the bucket holding the
+// percentile. Calls slower than every bucket report the largest bound.
+func latencyPercentiles(counts []int64) map[string]float64 {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	result := make(map[string]float64)
+	if total == 0 {
+		return result
+	}
+	for _, p := range []struct {
+		name     string
+		fraction float64
+	}{{"p50", 0.5}, {"p90", 0.9}, {"p99", 0.99}} {
+		rank := int64(math.Ceil(p.fraction * float64(total)))
+		var seen int64
+		for i, n := range counts {
+			seen += n
+			if seen >= rank {
+				bucket := min(i, len(latencyBuckets)-1)
+				result[p.name] = latencyBuckets[bucket] * 1000
+				break
+			}
+		}
+	}
+	return result
+}
+
+// laplaceNoise draws from the Laplace distribution with mean 0.
+func laplaceNoise(scale float64) float64 {
+	u := rand.Float64() - 0.5
+	return -scale * math.Copysign(1, u) * math.Log(1-2*math.Abs(u))
+}
+
+// handleUsageExport serves the anonymized usage export of the last days
+// completed days. Repeated downloads return the same rows.
+// GET /admin/usage-export?days=7
+func handleUsageExport(w http.ResponseWriter, r *http.Request) {
+	if usage == nil {
+		http.NotFound(w, r)
+		return
+	}
+	days := 7
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "days must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		days = min(n, usage.retention)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, usage.Export(days, time.Now(), laplaceNoise))
+}
@@ -0,0 +1,247 @@
+package ebaymcp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ### Token Vault ############################################################
+
+// vaultKeyPrefix marks bearer tokens that are references to a vault entry
+// rather than eBay access tokens, e.g. "vault:3q2-7w...".
+const vaultKeyPrefix = "vault:"
+
+// vaultEntry is a stored eBay credential.
+type vaultEntry struct {
+	RefreshToken                string    `json:"refresh_token"`
+	Environment                 string    `json:"environment"`
+	Tenant                      string    `json:"tenant,omitempty"` // "" for the default tenant
+	Marketplace                 string    `json:"marketplace,omitempty"`
+	Language                    string    `json:"language,omitempty"` // preferred language of proxy messages
+	EbayUserID                  string    `json:"ebay_user_id,omitempty"`
+	EbayUsername                string    `json:"ebay_username,omitempty"`
+	EbayAccountType             string    `json:"ebay_account_type,omitempty"`             // INDIVIDUAL or BUSINESS
+	EbayRegistrationMarketplace string    `json:"ebay_registration_marketplace,omitempty"` // marketplace the account registered on
+	Scopes                      []string  `json:"scopes"`
+	CreatedAt                   time.Time `json:"created_at"`
+
+	// Sandbox test users (see sandbox.go)
+	Developer    string `json:"developer,omitempty"`
+	TestUsername string `json:"test_username,omitempty"`
+	TestPassword string `json:"test_password,omitempty"`
+
+	// Cached access token minted from RefreshToken. Not persisted.
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// environmentName returns the eBay environment the entry belongs to.
+func (e *vaultEntry) environmentName() string {
+	if e.Environment == "" {
+		return defaultEnvironment // entries stored before environments existed
+	}
+	return e.Environment
+}
+
+// environment returns the entry's environment, or nil when its tenant or
+// environment is no longer configured.
+func (e *vaultEntry) environment() *ebayEnvironment {
+	return environmentNamed(e.Tenant, e.environmentName())
+}
+
+// ebayUser returns the eBay account recorded when the entry was linked, or
+// nil when it could not be identified then.
+func (e *vaultEntry) ebayUser() *ebayUser {
+	if e.EbayUserID == "" && e.EbayUsername == "" {
+		return nil
+	}
+	return &ebayUser{
+		UserID:                    e.EbayUserID,
+		Username:                  e.EbayUsername,
+		AccountType:               e.EbayAccountType,
+		RegistrationMarketplaceID: e.EbayRegistrationMarketplace,
+	}
+}
+
+// tokenVault keeps eBay refresh tokens at rest in a single AES-GCM encrypted
+// file (VAULT_FILE, key from VAULT_KEY). It is small by design: entries are
+// created by power users linking manually, not on every OAuth flow.
+type tokenVault struct {
+	mu      sync.Mutex
+	path    string
+	aead    cipher.AEAD
+	entries map[string]*vaultEntry
+}
+
+// vault is nil when VAULT_FILE is not configured.
+var vault *tokenVault
+
+// openVault loads (or creates) the vault at path. key must be a base64
+// encoded 32-byte AES-256 key.
+func openVault(path, key string) (*tokenVault, error) {
+	rawKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(rawKey) != 32 {
+		return nil, errors.New("VAULT_KEY must be a base64-encoded 32-byte key")
+	}
+
+	block, err := aes.NewCipher(rawKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &tokenVault{path: path, aead: aead, entries: make(map[string]*vaultEntry)}
+
+	ciphertext, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault: %w", err)
+	}
+
+	plaintext, err := v.open(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt vault (wrong VAULT_KEY?): %w", err)
+	}
+	if err := json.Unmarshal(plaintext, &v.entries); err != nil {
+		return nil, fmt.Errorf("failed to decode vault: %w", err)
+	}
+
+	return v, nil
+}
+
+// Put stores entry under a new random ID and returns the ID.
+func (v *tokenVault) Put(entry *vaultEntry) (string, error) {
+	id, err := randomID(32)
+	if err != nil {
+		return "", err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.entries[id] = entry
+	if err := v.save(); err != nil {
+		delete(v.entries, id)
+		return "", err
+	}
+	return id, nil
+}
+
+// Get returns the entry stored under id.
+func (v *tokenVault) Get(id string) (*vaultEntry, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	entry, ok := v.entries[id]
+	return entry, ok
+}
+
+// List returns the entries for which match returns true, keyed by ID.
+func (v *tokenVault) List(match func(*vaultEntry) bool) map[string]*vaultEntry {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	found := make(map[string]*vaultEntry)
+	for id, entry := range v.entries {
+		if match(entry) {
+			found[id] = entry
+		}
+	}
+	return found
+}
+
+// Delete removes the entry stored under id.
+func (v *tokenVault) Delete(id string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.entries, id)
+	return v.save()
+}
+
+// DeleteUser removes every entry linked to the given eBay user (matched by
+// immutable user ID, or by username) and returns how many were removed.
+func (v *tokenVault) DeleteUser(userID, username string) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	removed := make(map[string]*vaultEntry)
+	for id, entry := range v.entries {
+		if (userID != "" && entry.EbayUserID == userID) || (username != "" && entry.EbayUsername == username) {
+			removed[id] = entry
+			delete(v.entries, id)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+
+	if err := v.save(); err != nil {
+		for id, entry := range removed {
+			v.entries[id] = entry
+		}
+		return 0, err
+	}
+	return len(removed), nil
+}
+
+// save encrypts and writes all entries. Callers must hold v.mu.
+func (v *tokenVault) save() error {
+	plaintext, err := json.Marshal(v.entries)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := v.seal(plaintext)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(v.path, ciphertext)
+}
+
+// seal encrypts plaintext with the vault key, prefixing the nonce.
+func (v *tokenVault) seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return v.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts what seal produced.
+func (v *tokenVault) open(ciphertext []byte) ([]byte, error) {
+	nonceSize := v.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("ciphertext is truncated")
+	}
+	return v.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], nil)
+}
+
+// randomID returns n random bytes encoded as unpadded base64url.
+func randomID(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// isVaultReference reports whether a bearer token refers to a vault entry.
+func isVaultReference(token string) bool {
+	return strings.HasPrefix(token, vaultKeyPrefix)
+}
@@ -0,0 +1,435 @@
+package ebaymcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ### eBay Webhooks ##########################################################
+
+// eBay Notification API deliveries (e.g. ITEM_AVAILABILITY,
+// AUTHORIZATION_REVOCATION) arrive at /webhooks/ebay. Each signed payload is
+// appended to NOTIFICATIONS_FILE, kept in a short in-memory history, and
+// forwarded to WEBHOOK_FORWARD_URLS and any in-process listeners.
+//
+// Subscriptions are managed by the operator through /admin/notifications/...
+// which wraps the Notification API's destination and subscription calls.
+
+const (
+	webhookPath           = "/webhooks/ebay"
+	notificationAPIPath   = "/commerce/notification/v1"
+	notificationHistory   = 100
+	destinationName       = "ebay-mcp"
+	webhookForwardTimeout = 10 * time.Second
+)
+
+// ebayNotification is the common envelope of Notification API payloads.
+type ebayNotification struct {
+	Metadata struct {
+		Topic         string `json:"topic"`
+		SchemaVersion string `json:"schemaVersion"`
+	} `json:"metadata"`
+	Notification struct {
+		NotificationID string          `json:"notificationId"`
+		EventDate      string          `json:"eventDate"`
+		PublishDate    string          `json:"publishDate"`
+		Data           json.RawMessage `json:"data"`
+	} `json:"notification"`
+}
+
+// receivedNotification is what we persist for each delivery.
+type receivedNotification struct {
+	ReceivedAt     time.Time       `json:"received_at"`
+	Topic          string          `json:"topic"`
+	NotificationID string          `json:"notification_id"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// notificationStore persists deliveries, in monthly partitions of
+// NOTIFICATIONS_FILE (see partitionedFile), and keeps the latest in memory.
+type notificationStore struct {
+	mu        sync.Mutex
+	file      *partitionedFile
+	recent    []receivedNotification
+	listeners map[int]func(receivedNotification)
+	lastID    int
+}
+
+var notifications = &notificationStore{}
+
+// openNotificationStore opens path for appending; empty keeps memory only.
+func openNotificationStore(path string) (*notificationStore, error) {
+	if path == "" {
+		return &notificationStore{}, nil
+	}
+	f, err := openPartitionedFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &notificationStore{file: f}, nil
+}
+
+// Subscribe registers fn to be called for every verified notification and
+// returns a function that unregisters it.
+func (s *notificationStore) Subscribe(fn func(receivedNotification)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listeners == nil {
+		s.listeners = make(map[int]func(receivedNotification))
+	}
+	s.lastID++
+	id := s.lastID
+	s.listeners[id] = fn
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.listeners, id)
+	}
+}
+
+// Add persists n and notifies listeners.
+func (s *notificationStore) Add(n receivedNotification) error {
+	s.mu.Lock()
+	if s.file != nil {
+		line, err := json.Marshal(n)
+		if err == nil {
+			err = s.file.WriteLine(line)
+		}
+		if err != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("failed to persist notification: %w", err)
+		}
+	}
+	s.recent = append(s.recent, n)
+	if len(s.recent) > notificationHistory {
+		s.recent = s.recent[len(s.recent)-notificationHistory:]
+	}
+	listeners := make([]func(receivedNotification), 0, len(s.listeners))
+	for _, fn := range s.listeners {
+		listeners = append(listeners, fn)
+	}
+	s.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(n)
+	}
+	return nil
+}
+
+// Recent returns the latest notifications, newest first.
+func (s *notificationStore) Recent() []receivedNotification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]receivedNotification, len(s.recent))
+	for i, n := range s.recent {
+		out[len(s.recent)-1-i] = n
+	}
+	return out
+}
+
+// webhookEndpoint is the public URL registered with eBay for deliveries.
+func webhookEndpoint(r *http.Request) string {
+	return envOr("EBAY_WEBHOOK_ENDPOINT", externalBaseURL(r)+webhookPath)
+}
+
+// handleEbayWebhook answers eBay's challenge and accepts signed deliveries.
+func handleEbayWebhook(w http.ResponseWriter, r *http.Request) {
+	verificationToken := os.Getenv("EBAY_WEBHOOK_VERIFICATION_TOKEN")
+	if verificationToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		answerChallenge(w, r, verificationToken, webhookEndpoint(r))
+
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+		if err := verifyNotification(r.Context(), r.Header.Get(notificationSignatureHeader), body); err != nil {
+			log.Printf("Rejected eBay notification: %v", err)
+			http.Error(w, "Signature verification failed", http.StatusPreconditionFailed)
+			return
+		}
+
+		var n ebayNotification
+		if err := json.Unmarshal(body, &n); err != nil {
+			http.Error(w, "Invalid notification body", http.StatusBadRequest)
+			return
+		}
+
+		// Acknowledge redeliveries without processing them again
+		id := n.Notification.NotificationID
+		if !seenNotifications.Begin(id, time.Now()) {
+			log.Printf("Ignoring duplicate eBay notification %s (%s)", id, n.Metadata.Topic)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		received := receivedNotification{
+			ReceivedAt:     time.Now().UTC(),
+			Topic:          n.Metadata.Topic,
+			NotificationID: id,
+			Payload:        body,
+		}
+		err = notifications.Add(received)
+		if ferr := seenNotifications.Finish(id, err == nil, time.Now()); ferr != nil {
+			log.Printf("%v", ferr)
+		}
+		if err != nil {
+			// A 5xx makes eBay redeliver
+			log.Printf("%v", err)
+			http.Error(w, "Failed to store notification", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Received eBay notification %s (%s)", received.NotificationID, received.Topic)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// forwardNotifications returns a listener that POSTs each payload to urls.
+// Delivery is asynchronous and best effort.
+func forwardNotifications(urls []string) func(receivedNotification) {
+	client := &http.Client{Timeout: webhookForwardTimeout}
+	return func(n receivedNotification) {
+		for _, target := range urls {
+			go func(target string) {
+				req, err := http.NewRequest("POST", target, bytes.NewReader(n.Payload))
+				if err != nil {
+					log.Printf("Failed to forward notification to %s: %v", target, err)
+					return
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Ebay-Topic", n.Topic)
+				req.Header.Set("X-Ebay-Notification-Id", n.NotificationID)
+
+				resp, err := client.Do(req)
+				if err != nil {
+					log.Printf("Failed to forward notification to %s: %v", target, err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode >= 300 {
+					log.Printf("Forwarding notification to %s returned status %d", target, resp.StatusCode)
+				}
+			}(target)
+		}
+	}
+}
+
+// ### Subscription Management ################################################
+
+// notificationAPI calls the Notification API and returns the response body.
+func notificationAPI(ctx context.Context, env *ebayEnvironment, token, method, path string, payload interface{}) (int, []byte, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return 0, nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "https://"+env.APIHost+notificationAPIPath+path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, data, err
+}
+
+// findDestination returns the ID of the destination delivering to endpoint,
+// or "" if there is none.
+func findDestination(ctx context.Context, env *ebayEnvironment, appToken, endpoint string) (string, error) {
+	status, body, err := notificationAPI(ctx, env, appToken, "GET", "/destination", nil)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("getDestinations returned status %d: %s", status, body)
+	}
+
+	var list struct {
+		Destinations []struct {
+			DestinationID  string `json:"destinationId"`
+			DeliveryConfig struct {
+				Endpoint string `json:"endpoint"`
+			} `json:"deliveryConfig"`
+		} `json:"destinations"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return "", fmt.Errorf("failed to parse destinations: %w", err)
+	}
+	for _, d := range list.Destinations {
+		if d.DeliveryConfig.Endpoint == endpoint {
+			return d.DestinationID, nil
+		}
+	}
+	return "", nil
+}
+
+// ensureDestination returns the ID of our webhook destination, creating it
+// if eBay doesn't have one for endpoint yet.
+func ensureDestination(ctx context.Context, env *ebayEnvironment, appToken, endpoint string) (string, error) {
+	if id, err := findDestination(ctx, env, appToken, endpoint); err != nil || id != "" {
+		return id, err
+	}
+
+	// eBay verifies the endpoint with a challenge before accepting it
+	status, body, err := notificationAPI(ctx, env, appToken, "POST", "/destination", map[string]interface{}{
+		"name":   destinationName,
+		"status": "ENABLED",
+		"deliveryConfig": map[string]string{
+			"endpoint":          endpoint,
+			"verificationToken": os.Getenv("EBAY_WEBHOOK_VERIFICATION_TOKEN"),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusCreated && status != http.StatusOK {
+		return "", fmt.Errorf("createDestination returned status %d: %s", status, body)
+	}
+
+	// The new ID is only returned in the Location header, so look it up again
+	id, err := findDestination(ctx, env, appToken, endpoint)
+	if err == nil && id == "" {
+		err = errors.New("created destination was not found")
+	}
+	return id, err
+}
+
+// handleAdminSubscriptions manages Notification API subscriptions:
+//
+//	GET    /admin/notifications/subscriptions        list subscriptions
+//	POST   /admin/notifications/subscriptions        {"topic_id": "...", "api_key": "vault:..."}
+//	DELETE /admin/notifications/subscriptions/{id}   delete a subscription
+//
+// api_key is only needed for user-level topics; application-level topics
+// use an application token. Add ?ebay_env=sandbox for the sandbox.
+func handleAdminSubscriptions(w http.ResponseWriter, r *http.Request) {
+	env, err := environmentFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	appToken, err := applicationToken(r.Context(), env, signingScope)
+	if err != nil {
+		log.Printf("Failed to get application token: %v", err)
+		http.Error(w, "Failed to authenticate with eBay", http.StatusBadGateway)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/notifications/subscriptions"), "/")
+
+	var status int
+	var body []byte
+	switch {
+	case r.Method == "GET" && id == "":
+		status, body, err = notificationAPI(r.Context(), env, appToken, "GET", "/subscription", nil)
+
+	case r.Method == "POST" && id == "":
+		var req struct {
+			TopicID string `json:"topic_id"`
+			APIKey  string `json:"api_key"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TopicID == "" {
+			http.Error(w, "Body must be JSON with topic_id", http.StatusBadRequest)
+			return
+		}
+
+		token := appToken
+		if req.APIKey != "" {
+			if token, _, err = vaultAccessToken(r.Context(), req.APIKey); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if os.Getenv("EBAY_WEBHOOK_VERIFICATION_TOKEN") == "" {
+			http.Error(w, errNoWebhookToken.Error(), http.StatusConflict)
+			return
+		}
+
+		var destinationID string
+		if destinationID, err = ensureDestination(r.Context(), env, appToken, webhookEndpoint(r)); err != nil {
+			break
+		}
+		status, body, err = notificationAPI(r.Context(), env, token, "POST", "/subscription", map[string]interface{}{
+			"topicId":       req.TopicID,
+			"status":        "ENABLED",
+			"destinationId": destinationID,
+			"payload": map[string]string{
+				"format":           "JSON",
+				"schemaVersion":    "1.0",
+				"deliveryProtocol": "HTTPS",
+			},
+		})
+		if err == nil && status < 300 {
+			audit.Record("notifications.subscribed", map[string]string{"topic_id": req.TopicID, "environment": env.Name})
+		}
+
+	case r.Method == "DELETE" && id != "":
+		status, body, err = notificationAPI(r.Context(), env, appToken, "DELETE", "/subscription/"+id, nil)
+		if err == nil && status < 300 {
+			audit.Record("notifications.unsubscribed", map[string]string{"subscription_id": id, "environment": env.Name})
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Notification API call failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if len(body) == 0 {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// handleRecentNotifications lists the latest deliveries (GET).
+func handleRecentNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"notifications": notifications.Recent()})
+}
+
+// errNoWebhookToken is returned when webhooks are used without a token.
+var errNoWebhookToken = errors.New("EBAY_WEBHOOK_VERIFICATION_TOKEN is required for webhook subscriptions")
@@ -0,0 +1,541 @@
+package ebaymcp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ayouroukov/ebay-mcp/internal/ebay"
+)
+
+// ### Listing Workflow #######################################################
+
+// Listing an item through the Inventory API takes an inventory item, an
+// offer with three business policies and an inventory location, and a
+// publish call, in that order; assistants reliably get some of it wrong.
+// The createListing tool (POST /workflows/create-listing) takes a flat
+// description of the listing instead:
+//
+//	{"title": "Apple iPhone 13 128GB Blue", "description": "...",
+//	 "condition": "USED_EXCELLENT", "price": "389.00", "quantity": 1,
+//	 "image_urls": ["https://..."], "aspects": {"Brand": ["Apple"], ...}}
+//
+// and fills in the rest: the category (the first suggestion for the title
+// unless category_id is given, checked to be a leaf with all its required
+// aspects set), the seller's default business policies, their first enabled
+// inventory location (or a new one from "location") and a SKU. It then
+// creates the inventory item and the offer and publishes it. When a step
+// fails, the steps before it are undone: the offer is deleted, the
+// inventory item deleted or put back as it was, and a new location deleted.
+// "dry_run": true stops after working out what it would create.
+
+const createListingPath = "/workflows/create-listing"
+
+// createListingRequest is the body of createListing.
+type createListingRequest struct {
+	SKU                  string              `json:"sku"` // generated when empty
+	Title                string              `json:"title"`
+	Description          string              `json:"description"`
+	CategoryID           string              `json:"category_id"`
+	Condition            string              `json:"condition"` // e.g. NEW, USED_EXCELLENT; default NEW
+	ConditionDescription string              `json:"condition_description"`
+	Price                string              `json:"price"`
+	Currency             string              `json:"currency"` // the marketplace's when empty
+	Quantity             int                 `json:"quantity"` // default 1
+	ImageURLs            []string            `json:"image_urls"`
+	Aspects              map[string][]string `json:"aspects"`
+	Brand                string              `json:"brand"`
+	MPN                  string              `json:"mpn"`
+	UPC                  []string            `json:"upc"`
+	EAN                  []string            `json:"ean"`
+	Format               string              `json:"format"`           // FIXED_PRICE (default) or AUCTION
+	ListingDuration      string              `json:"listing_duration"` // default GTC
+	FulfillmentPolicyID  string              `json:"fulfillment_policy_id"`
+	PaymentPolicyID      string              `json:"payment_policy_id"`
+	ReturnPolicyID       string              `json:"return_policy_id"`
+	MerchantLocationKey  string              `json:"merchant_location_key"`
+	Location             *listingLocation    `json:"location"`  // created when the seller has none
+	Overwrite            bool                `json:"overwrite"` // replace an inventory item of sku without offers
+	DryRun               bool                `json:"dry_run"`
+}
+
+// listingLocation is the address of an inventory location createListing
+// creates.
+type listingLocation struct {
+	Country    string `json:"country"`
+	PostalCode string `json:"postal_code"`
+	City       string `json:"city"`
+	State      string `json:"state"`
+}
+
+// validate checks req and fills in its defaults.
+func (req *createListingRequest) validate() error {
+	req.Title = strings.TrimSpace(req.Title)
+	switch {
+	case req.Title == "":
+		return errors.New("title is required")
+	case len(req.Title) > 80:
+		return errors.New("title must be at most 80 characters")
+	case strings.TrimSpace(req.Description) == "":
+		return errors.New("description is required")
+	case len(req.ImageURLs) == 0:
+		return errors.New("image_urls needs at least one picture")
+	case len(req.SKU) > 50:
+		return errors.New("sku must be at most 50 characters")
+	}
+	if price, err := strconv.ParseFloat(req.Price, 64); err != nil || price <= 0 {
+		return errors.New(`price must be a positive amount, e.g. "19.99"`)
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 0 {
+		return errors.New("quantity must be positive")
+	}
+	req.Condition = strings.ToUpper(req.Condition)
+	if req.Condition == "" {
+		req.Condition = "NEW"
+	}
+	req.Format = strings.ToUpper(req.Format)
+	if req.Format == "" {
+		req.Format = "FIXED_PRICE"
+	}
+	if req.Format != "FIXED_PRICE" && req.Format != "AUCTION" {
+		return errors.New("format must be FIXED_PRICE or AUCTION")
+	}
+	if req.ListingDuration == "" {
+		req.ListingDuration = "GTC"
+	}
+	if req.Location != nil && req.Location.Country == "" {
+		return errors.New("location needs a country")
+	}
+	if req.Brand != "" && !hasAspect(req.Aspects, "Brand") {
+		if req.Aspects == nil {
+			req.Aspects = make(map[string][]string)
+		}
+		req.Aspects["Brand"] = []string{req.Brand}
+	}
+	return nil
+}
+
+// hasAspect reports whether aspects sets name, ignoring case.
+func hasAspect(aspects map[string][]string, name string) bool {
+	for k, v := range aspects {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// listingRollback undoes the steps of a createListing that failed, last
+// first.
+type listingRollback []rollbackStep
+
+// rollbackStep is how to undo one step.
+type rollbackStep struct {
+	step string
+	undo func(ctx context.Context) error
+}
+
+// add records how to undo step.
+func (rb *listingRollback) add(step string, undo func(ctx context.Context) error) {
+	*rb = append(*rb, rollbackStep{step, undo})
+}
+
+// run undoes every recorded step, even once the request is cancelled, and
+// reports how each went.
+func (rb listingRollback) run(ctx context.Context) []workflowStep {
+	ctx = context.WithoutCancel(ctx)
+	var steps []workflowStep
+	for i := len(rb) - 1; i >= 0; i-- {
+		s := workflowStep{Step: "undo_" + rb[i].step, Status: "done"}
+		if err := rb[i].undo(ctx); err != nil {
+			log.Printf("createListing failed to undo %s: %v", rb[i].step, err)
+			s.Status, s.Error = "failed", err.Error()
+		}
+		steps = append(steps, s)
+	}
+	return steps
+}
+
+// handleCreateListing (createListing) creates and publishes a listing from a
+// flat description.
+// POST /workflows/create-listing
+func handleCreateListing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req createListingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Body must be JSON describing the listing", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	calls := [][2]string{
+		{http.MethodGet, "/commerce/taxonomy/v1/get_default_category_tree_id"},
+		{http.MethodGet, "/sell/account/v1/fulfillment_policy"},
+		{http.MethodGet, "/sell/account/v1/payment_policy"},
+		{http.MethodGet, "/sell/account/v1/return_policy"},
+		{http.MethodGet, "/sell/inventory/v1/location"},
+		{http.MethodGet, "/sell/inventory/v1/offer"},
+	}
+	if !req.DryRun {
+		calls = append(calls,
+			[2]string{http.MethodGet, "/sell/inventory/v1/inventory_item/{sku}"},
+			[2]string{http.MethodPut, "/sell/inventory/v1/inventory_item/{sku}"},
+			[2]string{http.MethodDelete, "/sell/inventory/v1/inventory_item/{sku}"},
+			[2]string{http.MethodPost, "/sell/inventory/v1/offer"},
+			[2]string{http.MethodDelete, "/sell/inventory/v1/offer/{offer_id}"},
+			[2]string{http.MethodPost, "/sell/inventory/v1/offer/{offer_id}/publish"},
+		)
+		if req.Location != nil {
+			calls = append(calls,
+				[2]string{http.MethodPost, "/sell/inventory/v1/location/{location_key}"},
+				[2]string{http.MethodDelete, "/sell/inventory/v1/location/{location_key}"},
+			)
+		}
+	}
+	policy := currentPolicy()
+	for _, call := range calls {
+		if err := policy.AllowPath(call[0], call[1]); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	caller, status, err := resolveCaller(w, r)
+	if err != nil {
+		log.Printf("Failed to resolve token for createListing: %v", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	ctx := r.Context()
+	client := caller.client()
+	marketplace := client.Marketplace
+	if req.Currency == "" {
+		req.Currency = marketplaceCurrencies[marketplace]
+	}
+	if req.SKU == "" {
+		b := make([]byte, 6)
+		rand.Read(b)
+		req.SKU = "MCP-" + strings.ToUpper(hex.EncodeToString(b))
+	}
+
+	// Work out everything the listing needs before writing anything.
+	tree, err := categoryTrees.tree(ctx, caller)
+	if err != nil {
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	if req.CategoryID == "" {
+		suggestions, err := client.GetCategorySuggestions(ctx, tree.ID, req.Title)
+		if err != nil {
+			writeEbayError(w, r, caller, err)
+			return
+		}
+		for _, s := range suggestions {
+			if n := tree.byID[s.Category.CategoryID]; n != nil && n.Leaf {
+				req.CategoryID = n.ID
+				break
+			}
+		}
+		if req.CategoryID == "" {
+			http.Error(w, "No category found for the title; set category_id (get_category_suggestions finds one)", http.StatusUnprocessableEntity)
+			return
+		}
+	}
+	node := tree.byID[req.CategoryID]
+	if node == nil || !node.Leaf {
+		http.Error(w, fmt.Sprintf("Category %s is not a leaf category of this marketplace; get_category_suggestions finds one", req.CategoryID), http.StatusUnprocessableEntity)
+		return
+	}
+	aspects, err := categoryAspects(ctx, caller, tree, req.CategoryID)
+	if err != nil {
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	var missing []categoryAspect
+	for _, a := range aspects {
+		if a.Required && !hasAspect(req.Aspects, a.Name) {
+			missing = append(missing, a)
+		}
+	}
+	if len(missing) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":           "The listing lacks aspects its category requires; set each in aspects, e.g. {\"" + missing[0].Name + "\": [\"...\"]}",
+			"category_id":     node.ID,
+			"category_path":   tree.path(node.ID),
+			"missing_aspects": missing,
+		})
+		return
+	}
+
+	policies, err := listingPolicies(ctx, client, &req)
+	if err != nil {
+		var apiErr *ebay.Error
+		if errors.As(err, &apiErr) {
+			writeEbayError(w, r, caller, err)
+		} else {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		}
+		return
+	}
+	offers, err := client.GetOffers(ctx, req.SKU)
+	if err != nil && !ebay.IsNotFound(err) {
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	if offers != nil && len(offers.Offers) > 0 {
+		o := offers.Offers[0]
+		http.Error(w, fmt.Sprintf("SKU %s already has offer %s (%s) on %s; choose another sku", req.SKU, o.OfferID, o.Status, marketplace), http.StatusConflict)
+		return
+	}
+	// An existing item is only replaced when asked to; with an offer it is
+	// never touched, since that would change a live listing
+	previous, err := client.GetInventoryItem(ctx, req.SKU)
+	if err != nil && !ebay.IsNotFound(err) {
+		writeEbayError(w, r, caller, err)
+		return
+	}
+	if previous != nil && !req.Overwrite {
+		http.Error(w, fmt.Sprintf("SKU %s already has an inventory item; choose another sku, or set overwrite to replace it", req.SKU), http.StatusConflict)
+		return
+	}
+	if previous != nil {
+		// The item is shared by every marketplace's offers
+		offers, err := client.WithMarketplace("").GetOffers(ctx, req.SKU)
+		if err != nil && !ebay.IsNotFound(err) {
+			writeEbayError(w, r, caller, err)
+			return
+		}
+		if offers != nil && len(offers.Offers) > 0 {
+			o := offers.Offers[0]
+			http.Error(w, fmt.Sprintf("SKU %s has offer %s (%s) on %s, so its inventory item can't be replaced; choose another sku", req.SKU, o.OfferID, o.Status, o.MarketplaceID), http.StatusConflict)
+			return
+		}
+	}
+	locationKey, newLocation, err := listingLocationKey(ctx, client, &req)
+	if err != nil {
+		var apiErr *ebay.Error
+		if errors.As(err, &apiErr) {
+			writeEbayError(w, r, caller, err)
+		} else {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		}
+		return
+	}
+
+	item := &ebay.InventoryItem{
+		Product: &ebay.Product{
+			Title:       req.Title,
+			Description: req.Description,
+			Aspects:     req.Aspects,
+			Brand:       req.Brand,
+			MPN:         req.MPN,
+			UPC:         req.UPC,
+			EAN:         req.EAN,
+			ImageURLs:   req.ImageURLs,
+		},
+		Condition:            req.Condition,
+		ConditionDescription: req.ConditionDescription,
+		Availability:         &ebay.Availability{},
+	}
+	item.Availability.ShipToLocationAvailability.Quantity = req.Quantity
+	offer := &ebay.Offer{
+		SKU:                 req.SKU,
+		MarketplaceID:       marketplace,
+		Format:              req.Format,
+		AvailableQuantity:   req.Quantity,
+		CategoryID:          req.CategoryID,
+		ListingDescription:  req.Description,
+		ListingDuration:     req.ListingDuration,
+		ListingPolicies:     policies,
+		PricingSummary:      &ebay.PricingSummary{Price: ebay.Amount{Value: req.Price, Currency: req.Currency}},
+		MerchantLocationKey: locationKey,
+	}
+	resp := map[string]interface{}{
+		"sku":                   req.SKU,
+		"category_id":           req.CategoryID,
+		"category_path":         tree.path(req.CategoryID),
+		"listing_policies":      policies,
+		"merchant_location_key": locationKey,
+		"dry_run":               req.DryRun,
+	}
+	if req.DryRun {
+		resp["inventory_item"] = item
+		resp["offer"] = offer
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	// Create the listing, undoing what was done when a step fails.
+	var steps []workflowStep
+	var rollback listingRollback
+	fail := func(step string, err error) {
+		log.Printf("createListing failed to %s: %v", step, err)
+		steps = append(steps, workflowStep{Step: step, Status: "failed", Error: err.Error()})
+		steps = append(steps, rollback.run(ctx)...)
+		status, body := http.StatusBadGateway, map[string]interface{}{"error": err.Error()}
+		var apiErr *ebay.Error
+		var me *maintenanceError
+		switch {
+		case errors.As(err, &apiErr) && len(apiErr.Errors) > 0:
+			status, body = apiErr.StatusCode, ebayErrorBody(apiErr, localizerFor(r, caller.language, marketplace))
+		case errors.As(err, &me):
+			status = http.StatusServiceUnavailable
+		}
+		body["failed_step"] = step
+		body["steps"] = steps
+		caller.wrote(ctx)
+		writeJSON(w, status, body)
+	}
+
+	if newLocation != nil {
+		if err := client.CreateInventoryLocation(ctx, locationKey, newLocation); err != nil {
+			fail("create_location", err)
+			return
+		}
+		steps = append(steps, workflowStep{Step: "create_location", Status: "created", ID: locationKey})
+		rollback.add("create_location", func(ctx context.Context) error {
+			return client.DeleteInventoryLocation(ctx, locationKey)
+		})
+	}
+
+	if err := client.CreateOrReplaceInventoryItem(ctx, req.SKU, item); err != nil {
+		fail("create_inventory_item", err)
+		return
+	}
+	if previous != nil {
+		steps = append(steps, workflowStep{Step: "create_inventory_item", Status: "replaced", ID: req.SKU})
+		previous.SKU = ""
+		rollback.add("create_inventory_item", func(ctx context.Context) error {
+			return client.CreateOrReplaceInventoryItem(ctx, req.SKU, previous)
+		})
+	} else {
+		steps = append(steps, workflowStep{Step: "create_inventory_item", Status: "created", ID: req.SKU})
+		rollback.add("create_inventory_item", func(ctx context.Context) error {
+			return client.DeleteInventoryItem(ctx, req.SKU)
+		})
+	}
+
+	offerID, err := client.CreateOffer(ctx, offer)
+	if err != nil {
+		fail("create_offer", err)
+		return
+	}
+	steps = append(steps, workflowStep{Step: "create_offer", Status: "created", ID: offerID})
+	rollback.add("create_offer", func(ctx context.Context) error {
+		return client.DeleteOffer(ctx, offerID)
+	})
+
+	listingID, err := client.PublishOffer(ctx, offerID)
+	if err != nil {
+		fail("publish_offer", err)
+		return
+	}
+	steps = append(steps, workflowStep{Step: "publish_offer", Status: "done", ID: listingID})
+
+	audit.Record("listing.created", map[string]string{
+		"sku":         req.SKU,
+		"offer_id":    offerID,
+		"listing_id":  listingID,
+		"marketplace": marketplace,
+		"token_hash":  tokenHash(caller.bearer),
+	})
+	caller.wrote(ctx)
+	resp["listing_id"] = listingID
+	resp["offer_id"] = offerID
+	resp["steps"] = steps
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// listingPolicies returns the business policies of req, the seller's
+// default ones where it names none.
+func listingPolicies(ctx context.Context, client *ebay.Client, req *createListingRequest) (*ebay.ListingPolicies, error) {
+	p := &ebay.ListingPolicies{
+		FulfillmentPolicyID: req.FulfillmentPolicyID,
+		PaymentPolicyID:     req.PaymentPolicyID,
+		ReturnPolicyID:      req.ReturnPolicyID,
+	}
+	var missing []string
+	if p.FulfillmentPolicyID == "" {
+		policies, err := client.GetFulfillmentPolicies(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if i := preferredPolicy(len(policies), func(i int) []ebay.CategoryType { return policies[i].CategoryTypes }); i >= 0 {
+			p.FulfillmentPolicyID = policies[i].FulfillmentPolicyID
+		} else {
+			missing = append(missing, "fulfillment")
+		}
+	}
+	if p.PaymentPolicyID == "" {
+		policies, err := client.GetPaymentPolicies(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if i := preferredPolicy(len(policies), func(i int) []ebay.CategoryType { return policies[i].CategoryTypes }); i >= 0 {
+			p.PaymentPolicyID = policies[i].PaymentPolicyID
+		} else {
+			missing = append(missing, "payment")
+		}
+	}
+	if p.ReturnPolicyID == "" {
+		policies, err := client.GetReturnPolicies(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if i := preferredPolicy(len(policies), func(i int) []ebay.CategoryType { return policies[i].CategoryTypes }); i >= 0 {
+			p.ReturnPolicyID = policies[i].ReturnPolicyID
+		} else {
+			missing = append(missing, "return")
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("the seller has no %s policy on %s; run setupSellerAccount first", strings.Join(missing, ", "), client.Marketplace)
+	}
+	return p, nil
+}
+
+// listingLocationKey returns the inventory location of req: the one it
+// names, the seller's first enabled one, or a new one from req.Location,
+// returned to be created.
+func listingLocationKey(ctx context.Context, client *ebay.Client, req *createListingRequest) (string, *ebay.InventoryLocation, error) {
+	if req.MerchantLocationKey != "" {
+		return req.MerchantLocationKey, nil, nil
+	}
+	locations, err := client.GetInventoryLocations(ctx, 100)
+	if err != nil && !ebay.IsNotFound(err) {
+		return "", nil, err
+	}
+	for _, l := range locations {
+		if l.MerchantLocationStatus != "DISABLED" {
+			return l.MerchantLocationKey, nil, nil
+		}
+	}
+	if req.Location == nil {
+		return "", nil, errors.New("the seller has no inventory location; set location (country and postal_code, or city and state) to create one")
+	}
+	loc := &ebay.InventoryLocation{
+		Name:                   "Default location",
+		LocationTypes:          []string{"WAREHOUSE"},
+		MerchantLocationStatus: "ENABLED",
+	}
+	loc.Location.Address.Country = strings.ToUpper(req.Location.Country)
+	loc.Location.Address.PostalCode = req.Location.PostalCode
+	loc.Location.Address.City = req.Location.City
+	loc.Location.Address.StateOrProvince = req.Location.State
+	return "default-" + strings.ToLower(loc.Location.Address.Country), loc, nil
+}